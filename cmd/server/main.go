@@ -2,43 +2,63 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"io"
 	"log/slog"
-	"net/http"
 	"os"
-	"strings"
-	"time"
-
-	"github.com/gin-contrib/cors"
-	"github.com/gin-gonic/gin"
-	"github.com/lmittmann/tint"
-	"github.com/tus/tusd/v2/pkg/handler"
+	"os/signal"
+	"syscall"
 
 	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/events"
+	"github.com/devsnb/large-file-uploads/pkg/logging"
+	"github.com/devsnb/large-file-uploads/pkg/selftest"
+	"github.com/devsnb/large-file-uploads/pkg/server"
 	"github.com/devsnb/large-file-uploads/pkg/storage"
 )
 
 func main() {
-	cfg, err := config.Load("config.yml")
-	if err != nil {
-		slog.Error("Failed to load configuration", "error", err)
-		os.Exit(1)
+	selfTest := flag.Bool("selftest", false, "upload, download and delete a test file against the configured storage, then exit")
+	checkPermissions := flag.Bool("check-permissions", false, "try every storage operation the server performs, report missing permissions, then exit")
+	service := flag.String("service", "", "install, uninstall, start or stop the Windows service, then exit")
+	dir := flag.String("dir", "", "directory holding config.yml and the data directory, e.g. for the Windows service")
+	flag.Parse()
+
+	if *dir != "" {
+		if err := os.Chdir(*dir); err != nil {
+			slog.Error("Failed to change directory", "dir", *dir, "error", err)
+			os.Exit(1)
+		}
 	}
 
-	// Setup logging
-	logLevel := slog.LevelInfo
-	if cfg.App.Debug {
-		logLevel = slog.LevelDebug
+	// Manage the Windows service and exit
+	if *service != "" {
+		if err := controlService(*service); err != nil {
+			slog.Error("Failed to control service", "action", *service, "error", err)
+			os.Exit(1)
+		}
+		return
 	}
 
-	// Custom log handler to filter excessive error messages
-	logHandler := tint.NewHandler(os.Stdout, &tint.Options{
-		Level:      logLevel,
-		TimeFormat: time.DateTime,
-	})
+	// Run under the service control manager if started by it, in the
+	// foreground otherwise
+	os.Exit(runService(func(ctx context.Context, logs io.Writer) int {
+		return run(ctx, logs, *selfTest, *checkPermissions)
+	}))
+}
 
-	// Set up the logger with our custom handler
-	slog.SetDefault(slog.New(logHandler))
+// run starts the server and serves until the context is done or SIGINT or
+// SIGTERM arrives. It returns the exit code of the process.
+func run(ctx context.Context, logs io.Writer, selfTest, checkPermissions bool) int {
+	cfg, err := config.Load("config.yml")
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		return 1
+	}
+
+	// Setup logging from the logging configuration
+	slog.SetDefault(logging.New(logs, cfg.Logging, cfg.App.Debug))
 
 	// Log basic configuration information
 	slog.Info("Configuration loaded successfully",
@@ -59,91 +79,56 @@ func main() {
 
 	// Create storage factory and initialize storage backend
 	factory := storage.NewFactory()
+	factory.SetSSEKMSKeyID(cfg.Storage.S3.SSEKMSKeyID)
 	store, err := factory.CreateFromEnv(context.Background())
 	if err != nil {
 		slog.Error("Failed to create storage", "error", err)
-		os.Exit(1)
+		return 1
 	}
 
 	slog.Info("Storage backend initialized successfully", "provider", store.GetProvider())
 
-	// Get the tus handler
-	tusHandler, err := store.GetHandler("/files/")
-	if err != nil {
-		slog.Error("Failed to create tus handler", "error", err)
-		os.Exit(1)
+	// Verify the storage backend end to end and exit with the result
+	if selfTest {
+		report := selftest.Run(context.Background(), store)
+		fmt.Print(report)
+		if !report.Passed() {
+			return 1
+		}
+		return 0
 	}
 
-	// Add hooks for logging
-	tusHandler.CompleteUploads = make(chan handler.HookEvent)
-	go func() {
-		for event := range tusHandler.CompleteUploads {
-			slog.Info("Upload completed",
-				"id", event.Upload.ID,
-				"size", event.Upload.Size,
-				"offset", event.Upload.Offset,
-				"metadata", event.Upload.MetaData)
+	// Verify the credentials allow every storage operation and exit with the result
+	if checkPermissions {
+		report, err := selftest.CheckPermissions(context.Background(), store)
+		if err != nil {
+			slog.Error("Failed to check storage permissions", "error", err)
+			return 1
 		}
-	}()
+		fmt.Print(report)
+		if !report.Passed() {
+			return 1
+		}
+		return 0
+	}
 
-	// Set up Gin router
-	if !cfg.App.Debug {
-		gin.SetMode(gin.ReleaseMode)
+	// Create the upload server
+	srv, err := server.New(cfg, store)
+	if err != nil {
+		slog.Error("Failed to create server", "error", err)
+		return 1
 	}
-	r := gin.New() // Use New() instead of Default() to avoid using the default logger
-
-	// Add our custom request logger middleware
-	r.Use(requestLoggerMiddleware())
-
-	// Add recovery middleware to handle panics
-	r.Use(gin.Recovery())
-
-	// Configure CORS
-	r.Use(cors.New(cors.Config{
-		AllowOrigins: []string{"*"},
-		AllowMethods: []string{"GET", "POST", "PATCH", "DELETE", "HEAD", "OPTIONS"},
-		AllowHeaders: []string{
-			"Authorization",
-			"Content-Type",
-			"Tus-Resumable",
-			"Upload-Length",
-			"Upload-Metadata",
-			"Upload-Offset",
-			"Content-Length",
-			"X-Requested-With",
-		},
-		ExposeHeaders: []string{
-			"Location",
-			"Tus-Resumable",
-			"Upload-Length",
-			"Upload-Offset",
-			"Upload-Metadata",
-			"Content-Type",
-		},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
 
-	// Health check
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"status":  "ok",
-			"storage": string(store.GetProvider()),
-		})
+	// Log completed uploads
+	srv.OnUploadComplete(func(ctx context.Context, event events.Event) error {
+		slog.Info("Upload completed",
+			"id", event.Upload.ID,
+			"size", event.Upload.Size,
+			"offset", event.Upload.Offset,
+			"metadata", event.Upload.MetaData)
+		return nil
 	})
 
-	// Define routes with middleware
-	tusGroup := r.Group("/files")
-
-	// Temporarily disable authentication for testing
-	// TODO: Re-enable and ensure auth.JWTMiddleware is defined and exported
-	// tusGroup.Use(auth.JWTMiddleware())
-
-	// Handle all TUS protocol methods using the simplified StripPrefix approach
-	// This uses gin.WrapH to directly wrap the HTTP handler with a StripPrefix handler
-	// which is the method from the working code
-	tusGroup.Any("/*any", gin.WrapH(http.StripPrefix("/files/", tusHandler)))
-
 	// Determine port from config or environment
 	port := "8080"
 	if cfg.App.Port != 0 {
@@ -152,78 +137,32 @@ func main() {
 		port = os.Getenv("PORT")
 	}
 
-	// Start server
-	slog.Info(fmt.Sprintf("Server starting on port %s", port))
-	err = r.Run(":" + port)
-	if err != nil {
-		slog.Error("Failed to start server", "error", err)
-		os.Exit(1)
-	}
-}
+	// Start server and shut it down gracefully on SIGINT or SIGTERM. On
+	// Windows, Ctrl-C and Ctrl-Break arrive as SIGINT, closing the console,
+	// logging off and shutting down as SIGTERM.
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-// requestLoggerMiddleware returns a gin middleware for logging HTTP requests and responses
-func requestLoggerMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// Start timer
-		start := time.Now()
-		path := c.Request.URL.Path
-		query := c.Request.URL.RawQuery
-
-		// Get request headers
-		headers := map[string]string{}
-		for k, v := range c.Request.Header {
-			// Skip sensitive headers
-			if strings.ToLower(k) == "authorization" {
-				headers[k] = "REDACTED"
+	// Apply the log level of the config file again on SIGHUP
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+	go func() {
+		for range hangups {
+			reloaded, err := config.Read("config.yml")
+			if err != nil {
+				slog.Error("Failed to reload configuration", "error", err)
 				continue
 			}
-			headers[k] = strings.Join(v, ",")
-		}
-
-		// Log request
-		slog.Info("Request received",
-			"method", c.Request.Method,
-			"path", path,
-			"query", query,
-			"client_ip", c.ClientIP(),
-			"user_agent", c.Request.UserAgent(),
-			"headers", fmt.Sprintf("%v", headers),
-		)
-
-		// Process request
-		c.Next()
-
-		// Calculate request duration
-		duration := time.Since(start)
-
-		// Get response status
-		statusCode := c.Writer.Status()
-		statusClass := statusCode / 100
-
-		// Log level based on status code
-		var logFn func(msg string, args ...any)
-		switch statusClass {
-		case 5: // 5xx
-			logFn = slog.Error
-		case 4: // 4xx
-			// Filter common errors that we don't want to spam logs with
-			if strings.Contains(c.Errors.String(), "feature not supported") {
-				logFn = slog.Debug // Downgrade to debug level
-			} else {
-				logFn = slog.Warn
-			}
-		default: // 2xx, 3xx
-			logFn = slog.Info
+			srv.SetLogLevel(logging.ConfiguredLevel(reloaded.Logging, reloaded.App.Debug), 0)
 		}
+	}()
 
-		// Log response
-		logFn("Request completed",
-			"method", c.Request.Method,
-			"path", path,
-			"status", statusCode,
-			"duration_ms", duration.Milliseconds(),
-			"content_length", c.Writer.Size(),
-			"errors", c.Errors.String(),
-		)
+	slog.Info(fmt.Sprintf("Server starting on port %s", port))
+	err = srv.Serve(ctx, ":"+port)
+	if err != nil {
+		slog.Error("Failed to start server", "error", err)
+		return 1
 	}
+	return 0
 }
@@ -0,0 +1,21 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+)
+
+// runService runs the server in the foreground, services being a Windows
+// feature
+func runService(run func(ctx context.Context, logs io.Writer) int) int {
+	return run(context.Background(), os.Stdout)
+}
+
+// controlService fails, services being a Windows feature
+func controlService(action string) error {
+	return errors.New("services are only supported on Windows")
+}
@@ -0,0 +1,191 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// Name and description of the Windows service
+const (
+	serviceName        = "large-file-uploads"
+	serviceDisplayName = "Large File Uploads"
+	serviceDescription = "Resumable uploads of large files over the tus protocol"
+)
+
+// serviceLog is the file the service logs to, relative to its directory,
+// since services have no console
+const serviceLog = "server.log"
+
+// stopCheckpoint is how often the service tells the service control manager
+// it is still draining
+const stopCheckpoint = 5 * time.Second
+
+// runService runs the server under the service control manager if started by
+// it, in the foreground otherwise
+func runService(run func(ctx context.Context, logs io.Writer) int) int {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		slog.Error("Failed to detect the service control manager", "error", err)
+		return 1
+	}
+	if !isService {
+		return run(context.Background(), os.Stdout)
+	}
+
+	var logs io.Writer = io.Discard
+	if file, err := os.OpenFile(serviceLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644); err == nil {
+		defer file.Close()
+		logs = file
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(logs, nil)))
+
+	service := &windowsService{run: run, logs: logs}
+	if err := svc.Run(serviceName, service); err != nil {
+		slog.Error("Failed to run service", "error", err)
+		return 1
+	}
+	return service.exitCode
+}
+
+// windowsService runs the server as a Windows service
+type windowsService struct {
+	run      func(ctx context.Context, logs io.Writer) int
+	logs     io.Writer
+	exitCode int
+}
+
+// Execute serves until the service is stopped. Stop, shutdown and
+// preshutdown requests drain the server like SIGTERM; the service reports
+// progress while it drains so the service control manager waits for it.
+func (s *windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan int, 1)
+	go func() { done <- s.run(ctx, s.logs) }()
+
+	const accepts = svc.AcceptStop | svc.AcceptShutdown | svc.AcceptPreShutdown
+	changes <- svc.Status{State: svc.Running, Accepts: accepts}
+
+	var checkpoints <-chan time.Time
+	stopping := svc.Status{State: svc.StopPending, WaitHint: uint32(2 * stopCheckpoint / time.Millisecond)}
+	for {
+		select {
+		case code := <-done:
+			s.exitCode = code
+			changes <- svc.Status{State: svc.StopPending}
+			// A non-zero exit code is reported as service specific, so the
+			// service control manager knows the server failed
+			return code != 0, uint32(code)
+		case <-checkpoints:
+			stopping.CheckPoint++
+			changes <- stopping
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				changes <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown, svc.PreShutdown:
+				if checkpoints != nil {
+					continue
+				}
+				slog.Info("Service stop requested")
+				changes <- stopping
+				ticker := time.NewTicker(stopCheckpoint)
+				defer ticker.Stop()
+				checkpoints = ticker.C
+				cancel()
+			}
+		}
+	}
+}
+
+// controlService installs, uninstalls, starts or stops the Windows service.
+// The installed service runs the current executable in the current
+// directory, which must hold config.yml.
+func controlService(action string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service control manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	if action == "install" {
+		return installService(m)
+	}
+
+	service, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("failed to open service %s: %w", serviceName, err)
+	}
+	defer service.Close()
+
+	switch action {
+	case "uninstall":
+		if err := service.Delete(); err != nil {
+			return fmt.Errorf("failed to uninstall service: %w", err)
+		}
+		slog.Info("Service uninstalled", "name", serviceName)
+	case "start":
+		if err := service.Start(); err != nil {
+			return fmt.Errorf("failed to start service: %w", err)
+		}
+		slog.Info("Service started", "name", serviceName)
+	case "stop":
+		if _, err := service.Control(svc.Stop); err != nil {
+			return fmt.Errorf("failed to stop service: %w", err)
+		}
+		slog.Info("Service stopping, in-flight requests are drained first", "name", serviceName)
+	default:
+		return fmt.Errorf("unknown service action %q, expected install, uninstall, start or stop", action)
+	}
+	return nil
+}
+
+// installService installs the service to start automatically and restart
+// after failures
+func installService(m *mgr.Mgr) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the executable: %w", err)
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to determine the working directory: %w", err)
+	}
+
+	if service, err := m.OpenService(serviceName); err == nil {
+		service.Close()
+		return fmt.Errorf("service %s is already installed", serviceName)
+	} else if !errors.Is(err, windows.ERROR_SERVICE_DOES_NOT_EXIST) {
+		return fmt.Errorf("failed to look up service %s: %w", serviceName, err)
+	}
+
+	service, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: serviceDisplayName,
+		Description: serviceDescription,
+		StartType:   mgr.StartAutomatic,
+	}, "-dir", dir)
+	if err != nil {
+		return fmt.Errorf("failed to install service: %w", err)
+	}
+	defer service.Close()
+
+	restart := mgr.RecoveryAction{Type: mgr.ServiceRestart, Delay: 10 * time.Second}
+	if err := service.SetRecoveryActions([]mgr.RecoveryAction{restart, restart, restart}, uint32((24 * time.Hour).Seconds())); err != nil {
+		slog.Warn("Failed to set service recovery actions", "error", err)
+	}
+	slog.Info("Service installed", "name", serviceName, "dir", dir)
+	return nil
+}
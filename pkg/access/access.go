@@ -0,0 +1,118 @@
+// Package access counts downloads per upload in memory and writes them to
+// the metadata store in batches, so busy downloads don't turn into a write
+// per request
+package access
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// DefaultFlushInterval is how often pending counts are written unless
+// configured
+const DefaultFlushInterval = 30 * time.Second
+
+// Hit is the download activity of an upload since the last flush
+type Hit struct {
+	Count      int64
+	LastAccess time.Time
+}
+
+// FlushFunc adds the hits of one upload to the store. Hits it fails to
+// write are kept and retried with the next batch.
+type FlushFunc func(ctx context.Context, id string, hit Hit) error
+
+// Recorder collects hits and flushes them periodically
+type Recorder struct {
+	flush    FlushFunc
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[string]Hit
+}
+
+// NewRecorder creates a recorder writing batches with flush
+func NewRecorder(interval time.Duration, flush FlushFunc) *Recorder {
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+	return &Recorder{
+		flush:    flush,
+		interval: interval,
+		pending:  make(map[string]Hit),
+	}
+}
+
+// Record counts a download of an upload
+func (r *Recorder) Record(id string, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hit := r.pending[id]
+	hit.Count++
+	if at.After(hit.LastAccess) {
+		hit.LastAccess = at
+	}
+	r.pending[id] = hit
+}
+
+// Pending returns the hits of an upload that have not been flushed yet
+func (r *Recorder) Pending(id string) Hit {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pending[id]
+}
+
+// Forget drops the pending hits of an upload, e.g. once it was terminated
+func (r *Recorder) Forget(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.pending, id)
+}
+
+// Run flushes pending hits every interval until the context is canceled,
+// then flushes a final time
+func (r *Recorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.Flush(ctx)
+		case <-ctx.Done():
+			r.Flush(context.Background())
+			return
+		}
+	}
+}
+
+// Flush writes all pending hits in one batch
+func (r *Recorder) Flush(ctx context.Context) {
+	r.mu.Lock()
+	batch := r.pending
+	r.pending = make(map[string]Hit)
+	r.mu.Unlock()
+
+	for id, hit := range batch {
+		if err := r.flush(ctx, id, hit); err != nil {
+			slog.Error("Failed to write download statistics", "id", id, "error", err)
+			r.restore(id, hit)
+		}
+	}
+}
+
+// restore merges hits that failed to flush back into the pending hits
+func (r *Recorder) restore(id string, hit Hit) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pending := r.pending[id]
+	pending.Count += hit.Count
+	if hit.LastAccess.After(pending.LastAccess) {
+		pending.LastAccess = hit.LastAccess
+	}
+	r.pending[id] = pending
+}
@@ -0,0 +1,46 @@
+package access
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRecorderBatchesHits(t *testing.T) {
+	written := make(map[string]Hit)
+	failing := "a"
+	recorder := NewRecorder(time.Hour, func(ctx context.Context, id string, hit Hit) error {
+		if id == failing {
+			return errors.New("store unavailable")
+		}
+		written[id] = hit
+		return nil
+	})
+
+	first := time.Now()
+	recorder.Record("a", first)
+	recorder.Record("a", first.Add(time.Second))
+	recorder.Record("b", first)
+
+	// A failed write keeps the hits for the next batch, others are written
+	recorder.Flush(context.Background())
+	if hit := recorder.Pending("a"); hit.Count != 2 {
+		t.Fatalf("expected hits to be kept after failure, got %+v", hit)
+	}
+	if written["b"].Count != 1 {
+		t.Fatalf("unexpected hit: %+v", written["b"])
+	}
+
+	recorder.Record("a", first.Add(2*time.Second))
+	failing = ""
+	recorder.Flush(context.Background())
+
+	hit := written["a"]
+	if hit.Count != 3 || !hit.LastAccess.Equal(first.Add(2*time.Second)) {
+		t.Fatalf("unexpected hit: %+v", hit)
+	}
+	if hit := recorder.Pending("a"); hit.Count != 0 {
+		t.Fatalf("expected no pending hits after flush, got %+v", hit)
+	}
+}
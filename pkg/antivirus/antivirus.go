@@ -0,0 +1,56 @@
+// Package antivirus scans upload data for malware with an external engine,
+// either clamd or any ICAP server such as c-icap or a commercial appliance
+package antivirus
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Engines scans can be sent to
+const (
+	EngineClamd = "clamd"
+	EngineICAP  = "icap"
+)
+
+// Verdict is the outcome of a scan
+type Verdict struct {
+	Engine   string `json:"engine"`
+	Infected bool   `json:"infected"`
+
+	// Signature names the malware found, if the engine reports it
+	Signature string `json:"signature,omitempty"`
+}
+
+// Engine scans data for malware. A scan that can't reach a verdict, e.g.
+// because the engine is unavailable or the data exceeds its limits, returns
+// an error.
+type Engine interface {
+	Name() string
+	Scan(ctx context.Context, data io.Reader) (Verdict, error)
+}
+
+// New creates the engine with the given name. The address is a clamd
+// address such as tcp://clamav:3310 or unix:///run/clamd.sock, or an ICAP
+// service URL such as icap://icap:1344/avscan.
+func New(engine, address string, timeout time.Duration) (Engine, error) {
+	switch engine {
+	case EngineClamd:
+		return NewClamd(address, timeout)
+	case EngineICAP:
+		return NewICAP(address, timeout)
+	default:
+		return nil, fmt.Errorf("unknown antivirus engine %q, expected %q or %q", engine, EngineClamd, EngineICAP)
+	}
+}
+
+// deadline returns when a scan started now must finish
+func deadline(ctx context.Context, timeout time.Duration) time.Time {
+	d, ok := ctx.Deadline()
+	if timeout > 0 && (!ok || time.Now().Add(timeout).Before(d)) {
+		return time.Now().Add(timeout)
+	}
+	return d
+}
@@ -0,0 +1,229 @@
+package antivirus
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http/httputil"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// eicar is the standard antivirus test string
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// serve accepts connections on a local listener and handles each with fn
+func serve(t *testing.T, fn func(conn net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				fn(conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestClamd(t *testing.T) {
+	addr := serve(t, func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		switch cmd, _ := r.ReadString(0); cmd {
+		case "zINSTREAM\x00":
+		case "zVERSION\x00":
+			conn.Write([]byte("ClamAV 1.3.1/27360/Tue Aug  6 08:35:26 2024\x00"))
+			return
+		default:
+			conn.Write([]byte("UNKNOWN COMMAND\x00"))
+			return
+		}
+		var data bytes.Buffer
+		for {
+			var size uint32
+			if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+				return
+			}
+			if size == 0 {
+				break
+			}
+			io.CopyN(&data, r, int64(size))
+		}
+		if strings.Contains(data.String(), "EICAR") {
+			conn.Write([]byte("stream: Eicar-Signature FOUND\x00"))
+		} else {
+			conn.Write([]byte("stream: OK\x00"))
+		}
+	})
+
+	engine, err := New(EngineClamd, "tcp://"+addr, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verdict, err := engine.Scan(context.Background(), strings.NewReader(strings.Repeat("a", 200<<10)))
+	if err != nil || verdict.Infected {
+		t.Fatalf("clean data: verdict = %+v, err = %v", verdict, err)
+	}
+	verdict, err = engine.Scan(context.Background(), strings.NewReader(eicar))
+	if err != nil || !verdict.Infected || verdict.Signature != "Eicar-Signature" {
+		t.Fatalf("infected data: verdict = %+v, err = %v", verdict, err)
+	}
+	if version, err := engine.(SignatureVersioner).SignatureVersion(context.Background()); err != nil || version != "ClamAV 1.3.1/27360/Tue Aug  6 08:35:26 2024" {
+		t.Fatalf("signature version = %q, err = %v", version, err)
+	}
+}
+
+func TestICAP(t *testing.T) {
+	addr := serve(t, func(conn net.Conn) {
+		r := textproto.NewReader(bufio.NewReader(conn))
+		line, _ := r.ReadLine()
+		if strings.HasPrefix(line, "OPTIONS icap://") {
+			r.ReadMIMEHeader()
+			conn.Write([]byte("ICAP/1.0 200 OK\r\nMethods: RESPMOD\r\nISTag: \"sig-27360\"\r\nEncapsulated: null-body=0\r\n\r\n"))
+			return
+		}
+		if !strings.HasPrefix(line, "RESPMOD icap://") {
+			conn.Write([]byte("ICAP/1.0 400 Bad Request\r\n\r\n"))
+			return
+		}
+		r.ReadMIMEHeader()
+		// Request and response headers of the encapsulated HTTP message
+		for blank := 0; blank < 2; {
+			line, err := r.ReadLine()
+			if err != nil {
+				return
+			}
+			if line == "" {
+				blank++
+			}
+		}
+		body, _ := io.ReadAll(httputil.NewChunkedReader(r.R))
+
+		switch {
+		case strings.Contains(string(body), "EICAR"):
+			conn.Write([]byte("ICAP/1.0 200 OK\r\nX-Infection-Found: Type=0; Resolution=2; Threat=EICAR-Test-File;\r\n" +
+				"Encapsulated: res-hdr=0, res-body=19\r\n\r\nHTTP/1.1 403 Forbidden\r\n\r\n"))
+		case strings.Contains(string(body), "blocked"):
+			conn.Write([]byte("ICAP/1.0 200 OK\r\nEncapsulated: res-hdr=0, res-body=19\r\n\r\nHTTP/1.1 403 Forbidden\r\n\r\n"))
+		default:
+			conn.Write([]byte("ICAP/1.0 204 No Content\r\n\r\n"))
+		}
+	})
+
+	engine, err := New(EngineICAP, "icap://"+addr+"/avscan", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		data      string
+		infected  bool
+		signature string
+	}{
+		{strings.Repeat("a", 200<<10), false, ""},
+		{eicar, true, "EICAR-Test-File"},
+		{"blocked by policy", true, ""},
+	} {
+		verdict, err := engine.Scan(context.Background(), strings.NewReader(tc.data))
+		if err != nil || verdict.Infected != tc.infected || verdict.Signature != tc.signature {
+			t.Errorf("verdict = %+v, err = %v, want infected %v with signature %q", verdict, err, tc.infected, tc.signature)
+		}
+	}
+	if version, err := engine.(SignatureVersioner).SignatureVersion(context.Background()); err != nil || version != "sig-27360" {
+		t.Fatalf("signature version = %q, err = %v", version, err)
+	}
+}
+
+// countingEngine counts scans and reports a signature version
+type countingEngine struct {
+	scans      int
+	signatures string
+}
+
+func (e *countingEngine) Name() string { return "counting" }
+
+func (e *countingEngine) Scan(ctx context.Context, data io.Reader) (Verdict, error) {
+	e.scans++
+	body, _ := io.ReadAll(data)
+	return Verdict{Engine: e.Name(), Infected: strings.Contains(string(body), "EICAR")}, nil
+}
+
+func (e *countingEngine) SignatureVersion(ctx context.Context) (string, error) {
+	return e.signatures, nil
+}
+
+func TestScanCache(t *testing.T) {
+	var now time.Time
+	clock := func() time.Time { return now }
+	memoryCache := NewMemoryCache()
+	memoryCache.now = clock
+	fileCache, err := NewFileCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileCache.now = clock
+
+	for name, cache := range map[string]Cache{"memory": memoryCache, "file": fileCache} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			engine := &countingEngine{signatures: "27360"}
+			scans := NewScanCache(engine, cache, time.Hour)
+			now = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+			scans.now = clock
+			open := func(data string) func() (io.ReadCloser, error) {
+				return func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader(data)), nil }
+			}
+
+			if _, cached, err := scans.Scan(ctx, "clean", open("data")); err != nil || cached {
+				t.Fatalf("first scan: cached = %v, err = %v", cached, err)
+			}
+			verdict, cached, err := scans.Scan(ctx, "clean", open("data"))
+			if err != nil || !cached || verdict.Infected || engine.scans != 1 {
+				t.Fatalf("second scan: verdict = %+v, cached = %v, scans = %d, err = %v", verdict, cached, engine.scans, err)
+			}
+			if verdict, _, _ := scans.Scan(ctx, "infected", open(eicar)); !verdict.Infected {
+				t.Fatalf("expected infected verdict, got %+v", verdict)
+			}
+			if verdict, cached, _ := scans.Scan(ctx, "infected", open(eicar)); !cached || !verdict.Infected {
+				t.Fatalf("expected cached infected verdict, got %+v, cached = %v", verdict, cached)
+			}
+
+			// New signatures may detect content found clean before
+			engine.signatures = "27361"
+			if _, cached, _ := scans.Scan(ctx, "clean", open("data")); cached || engine.scans != 3 {
+				t.Fatalf("expected a rescan after a signature update, cached = %v, scans = %d", cached, engine.scans)
+			}
+			if _, err := cache.Get(ctx, "infected"); !errors.Is(err, ErrNotCached) {
+				t.Fatalf("expected verdicts to be cleared on a signature update, got %v", err)
+			}
+
+			now = now.Add(2 * time.Hour)
+			if _, cached, _ := scans.Scan(ctx, "clean", open("data")); cached {
+				t.Fatal("expected expired verdicts to be rescanned")
+			}
+
+			if err := scans.Clear(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if _, cached, _ := scans.Scan(ctx, "clean", open("data")); cached {
+				t.Fatal("expected cleared verdicts to be rescanned")
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package antivirus
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/devsnb/large-file-uploads/pkg/internal/jsonstore"
+)
+
+// ErrNotCached is returned by caches without a verdict for a digest
+var ErrNotCached = errors.New("verdict not cached")
+
+// CacheEntry is the verdict reached for content with a SHA-256 digest
+type CacheEntry struct {
+	Digest  string  `json:"digest"`
+	Verdict Verdict `json:"verdict"`
+
+	// Signatures is the version of the signature databases the verdict was
+	// reached with, if the engine reports it
+	Signatures string    `json:"signatures,omitempty"`
+	ScannedAt  time.Time `json:"scannedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// Cache stores verdicts by content digest. Implementations may drop
+// entries at any time, e.g. once they expire.
+type Cache interface {
+	Get(ctx context.Context, digest string) (CacheEntry, error)
+	Put(ctx context.Context, entry CacheEntry) error
+	Clear(ctx context.Context) error
+}
+
+// SignatureVersioner is implemented by engines that report the version of
+// their signature databases, which changes when they are updated
+type SignatureVersioner interface {
+	SignatureVersion(ctx context.Context) (string, error)
+}
+
+// ScanCache scans data with an engine unless a verdict for the same content
+// is cached, so identical uploads are only scanned once. Verdicts expire
+// after the TTL, and when the engine reports new signature databases, since
+// content found clean before may be detected now.
+type ScanCache struct {
+	engine Engine
+	cache  Cache
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu         sync.Mutex
+	signatures string
+}
+
+// NewScanCache creates a scan cache keeping verdicts of the engine in the
+// cache for the TTL
+func NewScanCache(engine Engine, cache Cache, ttl time.Duration) *ScanCache {
+	return &ScanCache{engine: engine, cache: cache, ttl: ttl, now: time.Now}
+}
+
+// Scan returns the cached verdict for the digest, or scans the data opened
+// by open and caches its verdict. The second result reports whether the
+// verdict was cached.
+func (c *ScanCache) Scan(ctx context.Context, digest string, open func() (io.ReadCloser, error)) (Verdict, bool, error) {
+	signatures := c.signatureVersion(ctx)
+
+	entry, err := c.cache.Get(ctx, digest)
+	switch {
+	case err == nil && entry.Signatures == signatures && c.now().Before(entry.ExpiresAt):
+		return entry.Verdict, true, nil
+	case err != nil && !errors.Is(err, ErrNotCached):
+		// The cache is an optimization, so scanning goes on without it
+		slog.Warn("Failed to read cached scan verdict", "digest", digest, "error", err)
+	}
+
+	data, err := open()
+	if err != nil {
+		return Verdict{}, false, err
+	}
+	defer data.Close()
+	verdict, err := c.engine.Scan(ctx, data)
+	if err != nil {
+		return Verdict{}, false, err
+	}
+
+	now := c.now()
+	entry = CacheEntry{
+		Digest:     digest,
+		Verdict:    verdict,
+		Signatures: signatures,
+		ScannedAt:  now,
+		ExpiresAt:  now.Add(c.ttl),
+	}
+	if err := c.cache.Put(ctx, entry); err != nil {
+		slog.Warn("Failed to cache scan verdict", "digest", digest, "error", err)
+	}
+	return verdict, false, nil
+}
+
+// Clear drops all cached verdicts
+func (c *ScanCache) Clear(ctx context.Context) error {
+	return c.cache.Clear(ctx)
+}
+
+// signatureVersion returns the version of the engine's signature databases,
+// or an empty string if it doesn't report one. Cached verdicts are dropped
+// when the version changes.
+func (c *ScanCache) signatureVersion(ctx context.Context) string {
+	versioner, ok := c.engine.(SignatureVersioner)
+	if !ok {
+		return ""
+	}
+	signatures, err := versioner.SignatureVersion(ctx)
+	if err != nil {
+		// Cached verdicts carry a version, so none of them match
+		slog.Warn("Failed to read signature version", "engine", c.engine.Name(), "error", err)
+		return ""
+	}
+
+	c.mu.Lock()
+	previous := c.signatures
+	c.signatures = signatures
+	c.mu.Unlock()
+	if previous != "" && previous != signatures {
+		slog.Info("Antivirus signatures updated, clearing cached verdicts", "engine", c.engine.Name(), "previous", previous, "signatures", signatures)
+		if err := c.cache.Clear(ctx); err != nil {
+			slog.Warn("Failed to clear cached scan verdicts", "error", err)
+		}
+	}
+	return signatures
+}
+
+// MemoryCache keeps verdicts in memory. They are lost on restart.
+type MemoryCache struct {
+	entries *jsonstore.Memory[CacheEntry]
+	now     func() time.Time
+}
+
+// NewMemoryCache creates an empty in-memory cache
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		entries: jsonstore.NewMemory[CacheEntry](ErrNotCached),
+		now:     time.Now,
+	}
+}
+
+// Get returns the verdict for a digest
+func (c *MemoryCache) Get(ctx context.Context, digest string) (CacheEntry, error) {
+	return c.entries.Get(digest)
+}
+
+// Put inserts or replaces a verdict, dropping expired ones
+func (c *MemoryCache) Put(ctx context.Context, entry CacheEntry) error {
+	now := c.now()
+	c.entries.DeleteFunc(func(cached CacheEntry) bool {
+		return !now.Before(cached.ExpiresAt)
+	})
+	c.entries.Put(entry.Digest, entry)
+	return nil
+}
+
+// Clear drops all verdicts
+func (c *MemoryCache) Clear(ctx context.Context) error {
+	c.entries.DeleteFunc(func(CacheEntry) bool { return true })
+	return nil
+}
+
+// FileCache persists each verdict as a JSON file in a directory, so
+// verdicts survive restarts and are shared by instances mounting it
+type FileCache struct {
+	entries *jsonstore.Dir[CacheEntry]
+	now     func() time.Time
+}
+
+// NewFileCache creates a file cache, creating the directory if needed
+func NewFileCache(dir string) (*FileCache, error) {
+	entries, err := jsonstore.NewDir[CacheEntry](dir, "cached verdict", ErrNotCached)
+	if err != nil {
+		return nil, err
+	}
+	return &FileCache{entries: entries, now: time.Now}, nil
+}
+
+// Get returns the verdict for a digest. Expired verdicts are removed.
+func (c *FileCache) Get(ctx context.Context, digest string) (CacheEntry, error) {
+	entry, err := c.entries.Get(digest)
+	if err != nil {
+		return CacheEntry{}, err
+	}
+	if !c.now().Before(entry.ExpiresAt) {
+		c.entries.Delete(digest)
+		return CacheEntry{}, ErrNotCached
+	}
+	return entry, nil
+}
+
+// Put inserts or replaces a verdict
+func (c *FileCache) Put(ctx context.Context, entry CacheEntry) error {
+	return c.entries.Put(entry.Digest, entry)
+}
+
+// Clear removes all verdicts
+func (c *FileCache) Clear(ctx context.Context) error {
+	return c.entries.Clear()
+}
@@ -0,0 +1,147 @@
+package antivirus
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// clamdChunkSize is the size of the chunks data is streamed to clamd in
+const clamdChunkSize = 64 << 10
+
+// Clamd scans data with the INSTREAM command of a clamd daemon
+type Clamd struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamd creates a clamd engine for an address such as tcp://clamav:3310,
+// unix:///run/clamd.sock or host:port
+func NewClamd(address string, timeout time.Duration) (*Clamd, error) {
+	network, addr := "tcp", address
+	switch {
+	case strings.HasPrefix(address, "tcp://"):
+		addr = strings.TrimPrefix(address, "tcp://")
+	case strings.HasPrefix(address, "unix://"):
+		network, addr = "unix", strings.TrimPrefix(address, "unix://")
+	}
+	if addr == "" {
+		return nil, fmt.Errorf("clamd requires an address")
+	}
+	return &Clamd{network: network, address: addr, timeout: timeout}, nil
+}
+
+// Name returns the engine name
+func (c *Clamd) Name() string {
+	return EngineClamd
+}
+
+// Scan streams the data to clamd and reads its verdict
+func (c *Clamd) Scan(ctx context.Context, data io.Reader) (Verdict, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	if d := deadline(ctx, c.timeout); !d.IsZero() {
+		conn.SetDeadline(d)
+	}
+
+	reader := bufio.NewReader(conn)
+	if err := c.stream(conn, data); err != nil {
+		// clamd closes the stream early when it exceeds StreamMaxLength,
+		// and says why
+		if reply, readErr := reader.ReadString(0); readErr == nil {
+			return c.verdict(reply)
+		}
+		return Verdict{}, err
+	}
+
+	reply, err := reader.ReadString(0)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	return c.verdict(reply)
+}
+
+// SignatureVersion returns the reply to the VERSION command, such as
+// "ClamAV 1.3.1/27360/Tue Aug 6 08:35:26 2024", which includes the version
+// of the signature databases
+func (c *Clamd) SignatureVersion(ctx context.Context) (string, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+	if d := deadline(ctx, c.timeout); !d.IsZero() {
+		conn.SetDeadline(d)
+	}
+
+	if _, err := conn.Write([]byte("zVERSION\x00")); err != nil {
+		return "", fmt.Errorf("failed to send command to clamd: %w", err)
+	}
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil {
+		return "", fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	return strings.TrimSpace(strings.TrimRight(reply, "\x00")), nil
+}
+
+// stream sends the INSTREAM command and the data in length-prefixed chunks
+func (c *Clamd) stream(conn net.Conn, data io.Reader) error {
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return fmt.Errorf("failed to send data to clamd: %w", err)
+	}
+
+	buf := make([]byte, 4+clamdChunkSize)
+	for {
+		n, err := io.ReadFull(data, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				return fmt.Errorf("failed to send data to clamd: %w", err)
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read upload data: %w", err)
+		}
+	}
+
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return fmt.Errorf("failed to send data to clamd: %w", err)
+	}
+	return nil
+}
+
+// verdict parses a reply such as "stream: OK" or
+// "stream: Eicar-Signature FOUND"
+func (c *Clamd) verdict(reply string) (Verdict, error) {
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	result := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case result == "OK":
+		return Verdict{Engine: EngineClamd}, nil
+	case strings.HasSuffix(result, " FOUND"):
+		return Verdict{
+			Engine:    EngineClamd,
+			Infected:  true,
+			Signature: strings.TrimSuffix(result, " FOUND"),
+		}, nil
+	default:
+		return Verdict{}, fmt.Errorf("clamd failed to scan: %s", reply)
+	}
+}
@@ -0,0 +1,220 @@
+package antivirus
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// icapDefaultPort is the registered ICAP port
+const icapDefaultPort = "1344"
+
+// icapChunkSize is the size of the chunks data is sent to the ICAP server in
+const icapChunkSize = 64 << 10
+
+// ICAP scans data by sending it to an ICAP service in a RESPMOD request, as
+// if it were the body of an HTTP response a proxy is about to deliver
+type ICAP struct {
+	service *url.URL
+	host    string
+	timeout time.Duration
+}
+
+// NewICAP creates an ICAP engine for a service URL such as
+// icap://icap:1344/avscan
+func NewICAP(service string, timeout time.Duration) (*ICAP, error) {
+	u, err := url.Parse(service)
+	if err != nil || u.Scheme != "icap" || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid ICAP service URL %q, expected icap://host[:port]/service", service)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), icapDefaultPort)
+	}
+	return &ICAP{service: u, host: host, timeout: timeout}, nil
+}
+
+// Name returns the engine name
+func (e *ICAP) Name() string {
+	return EngineICAP
+}
+
+// Scan sends the data to the ICAP service. A 204 response means the data is
+// clean. A 200 response is a verdict of infected if it reports an infection
+// header or replaces the response, typically with a block page.
+func (e *ICAP) Scan(ctx context.Context, data io.Reader) (Verdict, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", e.host)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("failed to connect to ICAP server: %w", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	if d := deadline(ctx, e.timeout); !d.IsZero() {
+		conn.SetDeadline(d)
+	}
+
+	reader := textproto.NewReader(bufio.NewReader(conn))
+	if err := e.send(conn, data); err != nil {
+		// Servers may answer before reading the whole body
+		if verdict, readErr := e.verdict(reader); readErr == nil {
+			return verdict, nil
+		}
+		return Verdict{}, err
+	}
+	return e.verdict(reader)
+}
+
+// SignatureVersion returns the ISTag of the ICAP service, which servers
+// change whenever their signatures are updated
+func (e *ICAP) SignatureVersion(ctx context.Context) (string, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", e.host)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to ICAP server: %w", err)
+	}
+	defer conn.Close()
+	if d := deadline(ctx, e.timeout); !d.IsZero() {
+		conn.SetDeadline(d)
+	}
+
+	if _, err := fmt.Fprintf(conn, "OPTIONS %s ICAP/1.0\r\nHost: %s\r\nEncapsulated: null-body=0\r\n\r\n", e.service, e.host); err != nil {
+		return "", fmt.Errorf("failed to send request to ICAP server: %w", err)
+	}
+	reader := textproto.NewReader(bufio.NewReader(conn))
+	status, err := reader.ReadLine()
+	if err != nil {
+		return "", fmt.Errorf("failed to read ICAP response: %w", err)
+	}
+	if code, err := statusCode(status, "ICAP/"); err != nil || code != 200 {
+		return "", fmt.Errorf("ICAP server refused OPTIONS: %s", status)
+	}
+	header, err := reader.ReadMIMEHeader()
+	if err != nil {
+		return "", fmt.Errorf("failed to read ICAP response: %w", err)
+	}
+	return strings.Trim(header.Get("ISTag"), `"`), nil
+}
+
+// send writes the RESPMOD request with the data as a chunked response body
+func (e *ICAP) send(conn net.Conn, data io.Reader) error {
+	reqHdr := "GET / HTTP/1.1\r\nHost: " + e.service.Hostname() + "\r\n\r\n"
+	resHdr := "HTTP/1.1 200 OK\r\nContent-Type: application/octet-stream\r\nTransfer-Encoding: chunked\r\n\r\n"
+
+	w := bufio.NewWriterSize(conn, icapChunkSize+16)
+	fmt.Fprintf(w, "RESPMOD %s ICAP/1.0\r\n", e.service)
+	fmt.Fprintf(w, "Host: %s\r\n", e.host)
+	fmt.Fprintf(w, "Allow: 204\r\n")
+	fmt.Fprintf(w, "Encapsulated: req-hdr=0, res-hdr=%d, res-body=%d\r\n\r\n", len(reqHdr), len(reqHdr)+len(resHdr))
+	w.WriteString(reqHdr)
+	w.WriteString(resHdr)
+
+	buf := make([]byte, icapChunkSize)
+	for {
+		n, err := data.Read(buf)
+		if n > 0 {
+			fmt.Fprintf(w, "%x\r\n", n)
+			w.Write(buf[:n])
+			if _, err := w.WriteString("\r\n"); err != nil {
+				return fmt.Errorf("failed to send data to ICAP server: %w", err)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read upload data: %w", err)
+		}
+	}
+
+	w.WriteString("0\r\n\r\n")
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to send data to ICAP server: %w", err)
+	}
+	return nil
+}
+
+// verdict reads the ICAP response
+func (e *ICAP) verdict(reader *textproto.Reader) (Verdict, error) {
+	status, err := reader.ReadLine()
+	if err != nil {
+		return Verdict{}, fmt.Errorf("failed to read ICAP response: %w", err)
+	}
+	code, err := statusCode(status, "ICAP/")
+	if err != nil {
+		return Verdict{}, err
+	}
+	header, err := reader.ReadMIMEHeader()
+	if err != nil {
+		return Verdict{}, fmt.Errorf("failed to read ICAP response: %w", err)
+	}
+
+	verdict := Verdict{Engine: EngineICAP}
+	switch code {
+	case 204:
+		return verdict, nil
+	case 200:
+	default:
+		return Verdict{}, fmt.Errorf("ICAP server failed to scan: %s", status)
+	}
+
+	if threat := infection(header); threat != "" {
+		verdict.Infected = true
+		verdict.Signature = threat
+		return verdict, nil
+	}
+
+	// Without an infection header, a replaced response means the data was
+	// blocked, while the original response means it was left alone
+	if !strings.Contains(header.Get("Encapsulated"), "res-hdr=") {
+		return verdict, nil
+	}
+	httpStatus, err := reader.ReadLine()
+	if err != nil {
+		return Verdict{}, fmt.Errorf("failed to read ICAP response: %w", err)
+	}
+	if code, err := statusCode(httpStatus, "HTTP/"); err != nil || code != 200 {
+		verdict.Infected = true
+	}
+	return verdict, nil
+}
+
+// infection returns the threat named by the headers ICAP servers report
+// infections in, such as X-Infection-Found: Type=0; Resolution=2; Threat=EICAR;
+func infection(header textproto.MIMEHeader) string {
+	if found := header.Get("X-Infection-Found"); found != "" {
+		for _, field := range strings.Split(found, ";") {
+			if threat, ok := strings.CutPrefix(strings.TrimSpace(field), "Threat="); ok {
+				return threat
+			}
+		}
+		return found
+	}
+	for _, name := range []string{"X-Virus-ID", "X-Violations-Found"} {
+		if value := header.Get(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// statusCode parses the code of a status line such as "ICAP/1.0 204 No Content"
+func statusCode(line, protocol string) (int, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], protocol) {
+		return 0, fmt.Errorf("malformed status line %q", line)
+	}
+	code, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, fmt.Errorf("malformed status line %q", line)
+	}
+	return code, nil
+}
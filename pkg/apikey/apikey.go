@@ -0,0 +1,300 @@
+// Package apikey manages API keys that tenant admins issue to their own
+// integrations, so new integrations don't need a server config change
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefix starts every API key, telling keys apart from JWTs
+const Prefix = "lfu_"
+
+// MaxNameLen limits key names
+const MaxNameLen = 128
+
+// touchInterval is how often the last use of a key is written to the store
+const touchInterval = time.Minute
+
+// Common errors returned by key operations
+var (
+	ErrNotFound  = errors.New("api key not found")
+	ErrInvalid   = errors.New("invalid api key")
+	ErrRevoked   = errors.New("api key revoked")
+	ErrExpired   = errors.New("api key expired")
+	ErrBadSecret = errors.New("api key secret mismatch")
+	ErrMalformed = errors.New("malformed api key")
+)
+
+// Key is an API key of a tenant. Only a digest of its secret is stored.
+type Key struct {
+	ID        string `json:"id"`
+	Tenant    string `json:"tenant"`
+	Name      string `json:"name"`
+	Hash      string `json:"hash"` // Hex encoded SHA-256 digest of the secret
+	CreatedBy string `json:"createdBy,omitempty"`
+
+	// PreviousHash is the digest of the secret before the last rotation,
+	// accepted until PreviousExpiresAt
+	PreviousHash      string     `json:"previousHash,omitempty"`
+	PreviousExpiresAt *time.Time `json:"previousExpiresAt,omitempty"`
+
+	CreatedAt  time.Time  `json:"createdAt"`
+	RotatedAt  *time.Time `json:"rotatedAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+}
+
+// Expired reports whether the key can no longer be used
+func (k Key) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// Store persists keys
+type Store interface {
+	Put(ctx context.Context, key Key) error
+	Get(ctx context.Context, id string) (Key, error)
+	List(ctx context.Context) ([]Key, error)
+}
+
+// Registry issues, rotates, revokes and authenticates keys
+type Registry struct {
+	store Store
+	now   func() time.Time
+
+	// mu serializes updates, so recording a use never undoes a revocation
+	mu sync.Mutex
+}
+
+// NewRegistry creates a registry backed by the store
+func NewRegistry(store Store) *Registry {
+	return &Registry{store: store, now: time.Now}
+}
+
+// IsKey reports whether a bearer token looks like an API key
+func IsKey(token string) bool {
+	return strings.HasPrefix(token, Prefix)
+}
+
+// Create issues a key for the tenant and returns it with its secret, which
+// can't be retrieved afterwards
+func (r *Registry) Create(ctx context.Context, key Key) (Key, string, error) {
+	key.Name = strings.TrimSpace(key.Name)
+	if key.Name == "" || len(key.Name) > MaxNameLen {
+		return Key{}, "", fmt.Errorf("%w: name must be 1 to %d characters", ErrInvalid, MaxNameLen)
+	}
+	if key.Tenant == "" {
+		return Key{}, "", fmt.Errorf("%w: tenant is required", ErrInvalid)
+	}
+
+	now := r.now()
+	if key.ExpiresAt != nil && !key.ExpiresAt.After(now) {
+		return Key{}, "", fmt.Errorf("%w: expiresAt must be in the future", ErrInvalid)
+	}
+
+	secret := newSecret()
+	key.ID = newID()
+	key.Hash = digest(secret)
+	key.CreatedAt = now
+	key.PreviousHash, key.PreviousExpiresAt = "", nil
+	key.RotatedAt, key.LastUsedAt, key.RevokedAt = nil, nil, nil
+	if err := r.store.Put(ctx, key); err != nil {
+		return Key{}, "", fmt.Errorf("failed to store api key: %w", err)
+	}
+	return key, token(key.ID, secret), nil
+}
+
+// Get returns a key of the tenant
+func (r *Registry) Get(ctx context.Context, tenant, id string) (Key, error) {
+	key, err := r.store.Get(ctx, id)
+	if err != nil {
+		return Key{}, err
+	}
+	if key.Tenant != tenant {
+		return Key{}, ErrNotFound
+	}
+	return key, nil
+}
+
+// List returns the keys of the tenant, newest first, including revoked ones
+func (r *Registry) List(ctx context.Context, tenant string) ([]Key, error) {
+	all, err := r.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]Key, 0, len(all))
+	for _, key := range all {
+		if key.Tenant == tenant {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+// Rotate replaces the secret of a key and returns the new one. The old
+// secret keeps working for the grace period, so integrations can switch
+// over without downtime.
+func (r *Registry) Rotate(ctx context.Context, tenant, id string, grace time.Duration) (Key, string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, err := r.Get(ctx, tenant, id)
+	if err != nil {
+		return Key{}, "", err
+	}
+	now := r.now()
+	if key.RevokedAt != nil {
+		return key, "", ErrRevoked
+	}
+	if key.Expired(now) {
+		return key, "", ErrExpired
+	}
+
+	key.PreviousHash, key.PreviousExpiresAt = "", nil
+	if grace > 0 {
+		until := now.Add(grace)
+		key.PreviousHash, key.PreviousExpiresAt = key.Hash, &until
+	}
+	secret := newSecret()
+	key.Hash = digest(secret)
+	key.RotatedAt = &now
+	if err := r.store.Put(ctx, key); err != nil {
+		return Key{}, "", fmt.Errorf("failed to store api key: %w", err)
+	}
+	return key, token(key.ID, secret), nil
+}
+
+// Revoke disables a key for good. Revoked keys are kept so they remain
+// listed for auditing.
+func (r *Registry) Revoke(ctx context.Context, tenant, id string) (Key, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, err := r.Get(ctx, tenant, id)
+	if err != nil {
+		return Key{}, err
+	}
+	if key.RevokedAt != nil {
+		return key, nil
+	}
+	now := r.now()
+	key.RevokedAt = &now
+	key.PreviousHash, key.PreviousExpiresAt = "", nil
+	if err := r.store.Put(ctx, key); err != nil {
+		return Key{}, fmt.Errorf("failed to store api key: %w", err)
+	}
+	return key, nil
+}
+
+// Authenticate returns the key a token belongs to and records its use
+func (r *Registry) Authenticate(ctx context.Context, token string) (Key, error) {
+	id, secret, ok := parseToken(token)
+	if !ok {
+		return Key{}, ErrMalformed
+	}
+	key, err := r.store.Get(ctx, id)
+	if err != nil {
+		return Key{}, err
+	}
+
+	now := r.now()
+	if !matches(secret, key.Hash) &&
+		!(key.PreviousExpiresAt != nil && now.Before(*key.PreviousExpiresAt) && matches(secret, key.PreviousHash)) {
+		return Key{}, ErrBadSecret
+	}
+	if key.RevokedAt != nil {
+		return Key{}, ErrRevoked
+	}
+	if key.Expired(now) {
+		return Key{}, ErrExpired
+	}
+
+	// Uses are only written once per interval to keep requests cheap
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= touchInterval {
+		key, err = r.touch(ctx, id, now)
+		if err != nil {
+			return Key{}, err
+		}
+	}
+	return key, nil
+}
+
+// touch records the use of a key
+func (r *Registry) touch(ctx context.Context, id string, now time.Time) (Key, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, err := r.store.Get(ctx, id)
+	if err != nil {
+		return Key{}, err
+	}
+	if key.RevokedAt != nil {
+		return Key{}, ErrRevoked
+	}
+	key.LastUsedAt = &now
+	if err := r.store.Put(ctx, key); err != nil {
+		return Key{}, fmt.Errorf("failed to record api key use: %w", err)
+	}
+	return key, nil
+}
+
+// token formats the API key handed to clients
+func token(id, secret string) string {
+	return Prefix + id + "_" + secret
+}
+
+// parseToken splits an API key into its ID and secret. IDs are hex, so the
+// first underscore after the prefix ends the ID.
+func parseToken(token string) (id, secret string, ok bool) {
+	rest, ok := strings.CutPrefix(token, Prefix)
+	if !ok {
+		return "", "", false
+	}
+	id, secret, ok = strings.Cut(rest, "_")
+	if !ok || id == "" || secret == "" {
+		return "", "", false
+	}
+	if _, err := hex.DecodeString(id); err != nil {
+		return "", "", false
+	}
+	return id, secret, true
+}
+
+// matches compares a secret to a stored digest in constant time
+func matches(secret, hash string) bool {
+	return hash != "" && subtle.ConstantTimeCompare([]byte(digest(secret)), []byte(hash)) == 1
+}
+
+// digest returns the hex encoded SHA-256 digest of a secret
+func digest(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// newID generates a random key ID
+func newID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// newSecret generates a random key secret
+func newSecret() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,87 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	r := NewRegistry(NewMemoryStore())
+
+	key, secret, err := r.Create(ctx, Key{Tenant: "acme", Name: "ci"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Hash == "" || key.Hash == secret {
+		t.Fatalf("expected only a digest of the secret to be stored, got %q", key.Hash)
+	}
+
+	got, err := r.Authenticate(ctx, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != key.ID || got.Tenant != "acme" || got.LastUsedAt == nil {
+		t.Fatalf("authenticated key = %+v", got)
+	}
+
+	for _, token := range []string{secret + "x", Prefix + key.ID, "lfu_zz_abc", "eyJ.x.y"} {
+		if _, err := r.Authenticate(ctx, token); err == nil {
+			t.Errorf("expected %q to be refused", token)
+		}
+	}
+}
+
+func TestRotateWithGracePeriod(t *testing.T) {
+	ctx := context.Background()
+	r := NewRegistry(NewMemoryStore())
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	key, oldSecret, _ := r.Create(ctx, Key{Tenant: "acme", Name: "ci"})
+	_, newSecret, err := r.Rotate(ctx, "acme", key.ID, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, secret := range []string{oldSecret, newSecret} {
+		if _, err := r.Authenticate(ctx, secret); err != nil {
+			t.Fatalf("expected secret to work during the grace period: %v", err)
+		}
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, err := r.Authenticate(ctx, oldSecret); !errors.Is(err, ErrBadSecret) {
+		t.Fatalf("expected the old secret to expire, got %v", err)
+	}
+	if _, err := r.Authenticate(ctx, newSecret); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRevokeAndTenantIsolation(t *testing.T) {
+	ctx := context.Background()
+	r := NewRegistry(NewMemoryStore())
+
+	key, secret, _ := r.Create(ctx, Key{Tenant: "acme", Name: "ci"})
+	r.Create(ctx, Key{Tenant: "globex", Name: "ci"})
+
+	if _, err := r.Revoke(ctx, "globex", key.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected other tenants not to see the key, got %v", err)
+	}
+	if keys, _ := r.List(ctx, "acme"); len(keys) != 1 || keys[0].ID != key.ID {
+		t.Fatalf("keys = %+v", keys)
+	}
+
+	if _, err := r.Revoke(ctx, "acme", key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Authenticate(ctx, secret); !errors.Is(err, ErrRevoked) {
+		t.Fatalf("expected the key to be revoked, got %v", err)
+	}
+	if _, _, err := r.Rotate(ctx, "acme", key.ID, 0); !errors.Is(err, ErrRevoked) {
+		t.Fatalf("expected revoked keys not to rotate, got %v", err)
+	}
+}
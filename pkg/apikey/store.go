@@ -0,0 +1,62 @@
+package apikey
+
+import (
+	"context"
+
+	"github.com/devsnb/large-file-uploads/pkg/internal/jsonstore"
+)
+
+// MemoryStore keeps API keys in memory. They are lost on restart.
+type MemoryStore struct {
+	keys *jsonstore.Memory[Key]
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{keys: jsonstore.NewMemory[Key](ErrNotFound)}
+}
+
+// Put inserts or replaces an API key
+func (s *MemoryStore) Put(ctx context.Context, key Key) error {
+	s.keys.Put(key.ID, key)
+	return nil
+}
+
+// Get returns an API key by ID
+func (s *MemoryStore) Get(ctx context.Context, id string) (Key, error) {
+	return s.keys.Get(id)
+}
+
+// List returns all API keys
+func (s *MemoryStore) List(ctx context.Context) ([]Key, error) {
+	return s.keys.List(), nil
+}
+
+// FileStore persists each API key as a JSON file in a directory
+type FileStore struct {
+	keys *jsonstore.Dir[Key]
+}
+
+// NewFileStore creates a file store, creating the directory if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	keys, err := jsonstore.NewDir[Key](dir, "api key", ErrNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{keys: keys}, nil
+}
+
+// Put inserts or replaces an API key
+func (s *FileStore) Put(ctx context.Context, key Key) error {
+	return s.keys.Put(key.ID, key)
+}
+
+// Get returns an API key by ID
+func (s *FileStore) Get(ctx context.Context, id string) (Key, error) {
+	return s.keys.Get(id)
+}
+
+// List returns all API keys
+func (s *FileStore) List(ctx context.Context) ([]Key, error) {
+	return s.keys.List()
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+// Action is an operation on an upload that an Authorizer decides on
+type Action string
+
+// Actions on uploads
+const (
+	ActionCreate   Action = "create"   // Create an upload; the upload ID is empty
+	ActionRead     Action = "read"     // Query the offset, state, tags or diagnostics of an upload
+	ActionWrite    Action = "write"    // Upload data, or hand the upload to another device
+	ActionDownload Action = "download" // Download the content, or issue a download link
+	ActionUpdate   Action = "update"   // Change the tags or collections of an upload
+	ActionDelete   Action = "delete"   // Terminate an upload
+)
+
+// ErrForbidden is returned by authorizers to deny an action
+var ErrForbidden = errors.New("action not allowed")
+
+// Authorizer decides whether a user may perform an action on an upload. It
+// is consulted after the built-in ownership rules, so it can only deny
+// actions they allow. The user is nil when authentication is disabled or the
+// request carries a claim or download token instead of credentials. The
+// upload itself is available from the context with UploadFromContext.
+//
+// Denials should wrap ErrForbidden; other errors are treated as failures of
+// the authorizer itself.
+type Authorizer interface {
+	Authorize(ctx context.Context, user *User, action Action, uploadID string) error
+}
+
+// AuthorizerFunc adapts a function to the Authorizer interface
+type AuthorizerFunc func(ctx context.Context, user *User, action Action, uploadID string) error
+
+// Authorize calls f
+func (f AuthorizerFunc) Authorize(ctx context.Context, user *User, action Action, uploadID string) error {
+	return f(ctx, user, action, uploadID)
+}
+
+// Upload describes the upload an action is performed on. For creation
+// requests it holds the declared size and metadata.
+type Upload struct {
+	ID             string
+	Size           int64
+	SizeIsDeferred bool
+	Offset         int64
+	MetaData       map[string]string
+}
+
+// uploadKey is the context key for the upload an action is performed on
+type uploadKey struct{}
+
+// WithUpload returns a context carrying the upload an action is performed on
+func WithUpload(ctx context.Context, upload Upload) context.Context {
+	return context.WithValue(ctx, uploadKey{}, upload)
+}
+
+// UploadFromContext returns the upload an action is performed on
+func UploadFromContext(ctx context.Context) (Upload, bool) {
+	upload, ok := ctx.Value(uploadKey{}).(Upload)
+	return upload, ok
+}
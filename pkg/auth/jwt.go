@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is returned when a token is malformed, has an invalid
+// signature or is expired
+var ErrInvalidToken = errors.New("invalid token")
+
+// jwtHeader is the JOSE header of a JWT
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+}
+
+// jwtClaims are the claims read from a JWT
+type jwtClaims struct {
+	Subject   string `json:"sub"`
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	Tenant    string `json:"tenant"`
+	ExpiresAt int64  `json:"exp"`
+	NotBefore int64  `json:"nbf"`
+}
+
+// JWTVerifier implements TokenVerifier for HS256 signed JWT tokens
+type JWTVerifier struct {
+	secretKey string
+	now       func() time.Time
+}
+
+// NewJWTVerifier creates a new JWT verifier
+func NewJWTVerifier(secretKey string) *JWTVerifier {
+	return &JWTVerifier{
+		secretKey: secretKey,
+		now:       time.Now,
+	}
+}
+
+// VerifyToken verifies the signature and validity period of an HS256 JWT and
+// returns the user described by its sub, name, role and tenant claims. The
+// tenant defaults to the subject.
+func (v *JWTVerifier) VerifyToken(token string) (*User, error) {
+	if v.secretKey == "" {
+		return nil, fmt.Errorf("%w: no secret configured", ErrInvalidToken)
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Algorithm != "HS256" {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, header.Algorithm)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+
+	mac := hmac.New(sha256.New, []byte(v.secretKey))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	now := v.now().Unix()
+	if claims.ExpiresAt != 0 && now >= claims.ExpiresAt {
+		return nil, fmt.Errorf("%w: token expired", ErrInvalidToken)
+	}
+	if claims.NotBefore != 0 && now < claims.NotBefore {
+		return nil, fmt.Errorf("%w: token not yet valid", ErrInvalidToken)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	}
+
+	role := claims.Role
+	if role == "" {
+		role = "user"
+	}
+
+	tenant := claims.Tenant
+	if tenant == "" {
+		tenant = claims.Subject
+	}
+
+	return &User{
+		ID:       claims.Subject,
+		Username: claims.Name,
+		Role:     role,
+		Tenant:   tenant,
+	}, nil
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a JWT
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: malformed segment", ErrInvalidToken)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: malformed segment", ErrInvalidToken)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+// signToken builds an HS256 JWT for the given header and claims JSON
+func signToken(secret, header, claims string) string {
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestJWTVerifier(t *testing.T) {
+	verifier := NewJWTVerifier("secret")
+	verifier.now = func() time.Time { return time.Unix(1000, 0) }
+
+	header := `{"alg":"HS256","typ":"JWT"}`
+
+	user, err := verifier.VerifyToken(signToken("secret", header, `{"sub":"u1","name":"Test","exp":2000}`))
+	if err != nil {
+		t.Fatalf("Expected valid token, got %v", err)
+	}
+	if user.ID != "u1" || user.Username != "Test" || user.Role != "user" {
+		t.Errorf("Unexpected user: %+v", user)
+	}
+
+	invalid := map[string]string{
+		"wrong secret":  signToken("other", header, `{"sub":"u1"}`),
+		"expired":       signToken("secret", header, `{"sub":"u1","exp":1000}`),
+		"not yet valid": signToken("secret", header, `{"sub":"u1","nbf":1001}`),
+		"no subject":    signToken("secret", header, `{"name":"x"}`),
+		"alg none":      signToken("secret", `{"alg":"none"}`, `{"sub":"u1"}`),
+		"malformed":     "abc.def",
+	}
+	for name, token := range invalid {
+		if _, err := verifier.VerifyToken(token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+}
@@ -2,11 +2,16 @@ package auth
 
 import (
 	"context"
+	"crypto/subtle"
 	"errors"
 	"net/http"
 	"strings"
 )
 
+// OwnerMetadataKey is the upload metadata field recording the ID of the user
+// who created the upload
+const OwnerMetadataKey = "owner"
+
 // UserKey is the context key for storing the authenticated user
 type UserKey struct{}
 
@@ -15,6 +20,7 @@ type User struct {
 	ID       string
 	Username string
 	Role     string
+	Tenant   string
 }
 
 // TokenVerifier defines the interface for token verification
@@ -103,36 +109,28 @@ func extractToken(r *http.Request) (string, error) {
 	return parts[1], nil
 }
 
-// JWTVerifier implements TokenVerifier for JWT tokens
-// This is a placeholder - implement actual JWT verification
-type JWTVerifier struct {
-	secretKey string
+// StaticTokenVerifier implements TokenVerifier for a single shared secret,
+// used to protect operator endpoints
+type StaticTokenVerifier struct {
+	token string
+	user  User
 }
 
-// NewJWTVerifier creates a new JWT verifier
-func NewJWTVerifier(secretKey string) *JWTVerifier {
-	return &JWTVerifier{
-		secretKey: secretKey,
+// NewStaticTokenVerifier creates a verifier that accepts only the given token
+// and authenticates it as the given user
+func NewStaticTokenVerifier(token string, user User) *StaticTokenVerifier {
+	return &StaticTokenVerifier{
+		token: token,
+		user:  user,
 	}
 }
 
-// VerifyToken verifies a JWT token
-// Note: This is a simplified placeholder. In a real implementation, use a proper JWT library
-func (v *JWTVerifier) VerifyToken(token string) (*User, error) {
-	// In a real implementation, parse and verify the JWT token
-	// For this example, we'll just return a mock user
-	// In a production environment, use a proper JWT library like github.com/golang-jwt/jwt
-
-	// Placeholder implementation
-	if token == "" {
+// VerifyToken verifies the token matches the configured secret
+func (v *StaticTokenVerifier) VerifyToken(token string) (*User, error) {
+	if v.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(v.token)) != 1 {
 		return nil, errors.New("invalid token")
 	}
 
-	// Mock user for this example
-	return &User{
-		ID:       "user-123",
-		Username: "testuser",
-		Role:     "user",
-	}, nil
+	user := v.user
+	return &user, nil
 }
- 
@@ -0,0 +1,177 @@
+// Package banlist keeps the SHA-256 digests of content that must not be
+// distributed, so matching uploads can be quarantined for abuse handling
+package banlist
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sources of ban list entries
+const (
+	// SourceAPI entries were added through the admin API and can be removed
+	SourceAPI = "api"
+
+	// SourceFile entries come from the configured list file and are read-only
+	SourceFile = "file"
+)
+
+// MaxReasonLen limits ban reasons
+const MaxReasonLen = 256
+
+// digestPattern matches hex encoded SHA-256 digests
+var digestPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Common errors returned by ban list operations
+var (
+	ErrNotFound = errors.New("ban list entry not found")
+	ErrInvalid  = errors.New("invalid ban list entry")
+	ErrReadOnly = errors.New("ban list entry comes from the list file")
+)
+
+// Entry bans content by its digest
+type Entry struct {
+	Digest  string    `json:"digest"`
+	Reason  string    `json:"reason,omitempty"`
+	Source  string    `json:"source"`
+	AddedAt time.Time `json:"addedAt"`
+}
+
+// Store persists the entries added through the API
+type Store interface {
+	Put(ctx context.Context, entry Entry) error
+	Get(ctx context.Context, digest string) (Entry, error)
+	List(ctx context.Context) ([]Entry, error)
+	Delete(ctx context.Context, digest string) error
+}
+
+// List matches digests against the entries of the list file and the store
+type List struct {
+	store Store
+	file  map[string]Entry
+	now   func() time.Time
+}
+
+// New creates a ban list from the store and the entries of the list file
+func New(store Store, file []Entry) *List {
+	entries := make(map[string]Entry, len(file))
+	for _, entry := range file {
+		entries[entry.Digest] = entry
+	}
+	return &List{store: store, file: entries, now: time.Now}
+}
+
+// LoadFile reads a list file with one hex encoded SHA-256 digest per line,
+// optionally followed by a reason. Empty lines and lines starting with #
+// are skipped.
+func LoadFile(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ban list: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ban list: %w", err)
+	}
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		digest, reason, _ := strings.Cut(text, " ")
+		digest = strings.ToLower(digest)
+		if !digestPattern.MatchString(digest) {
+			return nil, fmt.Errorf("ban list %s line %d: %q is not a SHA-256 digest", path, line, digest)
+		}
+		entries = append(entries, Entry{
+			Digest:  digest,
+			Reason:  strings.TrimSpace(reason),
+			Source:  SourceFile,
+			AddedAt: info.ModTime(),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ban list: %w", err)
+	}
+	return entries, nil
+}
+
+// Add bans a digest, replacing the reason of an existing entry
+func (l *List) Add(ctx context.Context, digest, reason string) (Entry, error) {
+	digest = strings.ToLower(strings.TrimSpace(digest))
+	if !digestPattern.MatchString(digest) {
+		return Entry{}, fmt.Errorf("%w: digest must be a hex encoded SHA-256 digest", ErrInvalid)
+	}
+	reason = strings.TrimSpace(reason)
+	if len(reason) > MaxReasonLen {
+		return Entry{}, fmt.Errorf("%w: reason must be at most %d characters", ErrInvalid, MaxReasonLen)
+	}
+	if _, ok := l.file[digest]; ok {
+		return Entry{}, ErrReadOnly
+	}
+
+	entry := Entry{Digest: digest, Reason: reason, Source: SourceAPI, AddedAt: l.now()}
+	if err := l.store.Put(ctx, entry); err != nil {
+		return Entry{}, fmt.Errorf("failed to store ban list entry: %w", err)
+	}
+	return entry, nil
+}
+
+// Remove lifts the ban of a digest added through the API
+func (l *List) Remove(ctx context.Context, digest string) error {
+	digest = strings.ToLower(digest)
+	if _, ok := l.file[digest]; ok {
+		return ErrReadOnly
+	}
+	return l.store.Delete(ctx, digest)
+}
+
+// Match returns the entry banning a digest, if any
+func (l *List) Match(ctx context.Context, digest string) (Entry, bool, error) {
+	digest = strings.ToLower(digest)
+	if entry, ok := l.file[digest]; ok {
+		return entry, true, nil
+	}
+	if !digestPattern.MatchString(digest) {
+		return Entry{}, false, nil
+	}
+
+	entry, err := l.store.Get(ctx, digest)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return Entry{}, false, nil
+	case err != nil:
+		return Entry{}, false, err
+	}
+	return entry, true, nil
+}
+
+// Entries returns all entries, newest first
+func (l *List) Entries(ctx context.Context) ([]Entry, error) {
+	entries, err := l.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range l.file {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].AddedAt.Equal(entries[j].AddedAt) {
+			return entries[i].AddedAt.After(entries[j].AddedAt)
+		}
+		return entries[i].Digest < entries[j].Digest
+	})
+	return entries, nil
+}
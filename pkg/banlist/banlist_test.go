@@ -0,0 +1,62 @@
+package banlist
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	fileDigest = "275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f"
+	apiDigest  = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+)
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "banned.txt")
+	os.WriteFile(path, []byte("# known abuse\n"+strings.ToUpper(fileDigest)+" reported by partner\n\n"), 0644)
+
+	file, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := New(NewMemoryStore(), file)
+
+	if _, err := list.Add(ctx, apiDigest, "abuse report 42"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := list.Add(ctx, "not-a-digest", ""); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected invalid digests to be refused, got %v", err)
+	}
+
+	for digest, reason := range map[string]string{fileDigest: "reported by partner", apiDigest: "abuse report 42"} {
+		entry, ok, err := list.Match(ctx, digest)
+		if err != nil || !ok || entry.Reason != reason {
+			t.Errorf("match %s = %+v, %v, %v", digest, entry, ok, err)
+		}
+	}
+	if _, ok, _ := list.Match(ctx, strings.Repeat("0", 64)); ok {
+		t.Fatal("expected unknown digests not to match")
+	}
+
+	if err := list.Remove(ctx, fileDigest); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected file entries to be read-only, got %v", err)
+	}
+	if err := list.Remove(ctx, apiDigest); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := list.Entries(ctx); len(entries) != 1 || entries[0].Source != SourceFile {
+		t.Fatalf("entries = %+v", entries)
+	}
+}
+
+func TestLoadFileRejectsMalformedDigests(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "banned.txt")
+	os.WriteFile(path, []byte("abc123\n"), 0644)
+	if _, err := LoadFile(path); err == nil {
+		t.Fatal("expected malformed digests to be rejected")
+	}
+}
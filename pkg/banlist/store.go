@@ -0,0 +1,72 @@
+package banlist
+
+import (
+	"context"
+
+	"github.com/devsnb/large-file-uploads/pkg/internal/jsonstore"
+)
+
+// MemoryStore keeps entries in memory. They are lost on restart.
+type MemoryStore struct {
+	entries *jsonstore.Memory[Entry]
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: jsonstore.NewMemory[Entry](ErrNotFound)}
+}
+
+// Put inserts or replaces an entry
+func (s *MemoryStore) Put(ctx context.Context, entry Entry) error {
+	s.entries.Put(entry.Digest, entry)
+	return nil
+}
+
+// Get returns an entry by digest
+func (s *MemoryStore) Get(ctx context.Context, digest string) (Entry, error) {
+	return s.entries.Get(digest)
+}
+
+// List returns all entries
+func (s *MemoryStore) List(ctx context.Context) ([]Entry, error) {
+	return s.entries.List(), nil
+}
+
+// Delete removes an entry
+func (s *MemoryStore) Delete(ctx context.Context, digest string) error {
+	return s.entries.Delete(digest)
+}
+
+// FileStore persists each entry as a JSON file in a directory
+type FileStore struct {
+	entries *jsonstore.Dir[Entry]
+}
+
+// NewFileStore creates a file store, creating the directory if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	entries, err := jsonstore.NewDir[Entry](dir, "ban list entry", ErrNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{entries: entries}, nil
+}
+
+// Put inserts or replaces an entry
+func (s *FileStore) Put(ctx context.Context, entry Entry) error {
+	return s.entries.Put(entry.Digest, entry)
+}
+
+// Get returns an entry by digest
+func (s *FileStore) Get(ctx context.Context, digest string) (Entry, error) {
+	return s.entries.Get(digest)
+}
+
+// List returns all entries
+func (s *FileStore) List(ctx context.Context) ([]Entry, error) {
+	return s.entries.List()
+}
+
+// Delete removes an entry
+func (s *FileStore) Delete(ctx context.Context, digest string) error {
+	return s.entries.Delete(digest)
+}
@@ -0,0 +1,350 @@
+// Package batch groups uploads of a multi-file dataset, so the dataset can
+// be handed downstream once all of its uploads have finished
+package batch
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Limits of batches
+const (
+	MaxNameLen = 128
+	MaxUploads = 10000
+)
+
+// Status of a batch
+const (
+	StatusOpen     = "open"     // Uploads can join
+	StatusClosed   = "closed"   // No more uploads can join, some are still in progress
+	StatusComplete = "complete" // All uploads finished and the manifest was written
+)
+
+// Common errors returned by batch operations
+var (
+	ErrNotFound = errors.New("batch not found")
+	ErrInvalid  = errors.New("invalid batch")
+	ErrClosed   = errors.New("batch is closed")
+	ErrFull     = errors.New("batch is full")
+)
+
+// Member is an upload that joined a batch
+type Member struct {
+	UploadID    string     `json:"uploadId"`
+	JoinedAt    time.Time  `json:"joinedAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+}
+
+// Batch is a group of uploads that complete together. A batch is closed
+// explicitly or once the expected number of uploads joined, and completes
+// when all of its uploads finished after it was closed.
+type Batch struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	Owner     string    `json:"owner,omitempty"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Expected  int       `json:"expected,omitempty"`  // Uploads after which the batch closes, 0 to close explicitly
+	NotifyURL string    `json:"notifyUrl,omitempty"` // Notified when the batch completes
+	Status    string    `json:"status"`
+	Uploads   []Member  `json:"uploads"`
+	Completed int       `json:"completed"` // Uploads that finished
+	CreatedAt time.Time `json:"createdAt"`
+
+	ClosedAt    *time.Time `json:"closedAt,omitempty"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	ManifestID  string     `json:"manifestId,omitempty"` // Upload holding the manifest of the complete batch
+}
+
+// closed reports whether uploads can no longer join the batch
+func (b Batch) closed() bool {
+	return b.ClosedAt != nil || (b.Expected > 0 && len(b.Uploads) >= b.Expected)
+}
+
+// finished reports whether all uploads of a closed batch finished
+func (b Batch) finished() bool {
+	return b.closed() && len(b.Uploads) > 0 && b.Completed == len(b.Uploads)
+}
+
+// refresh recomputes the derived fields after the members changed
+func (b *Batch) refresh() {
+	b.Completed = 0
+	for _, m := range b.Uploads {
+		if m.CompletedAt != nil {
+			b.Completed++
+		}
+	}
+	switch {
+	case b.ManifestID != "":
+		b.Status = StatusComplete
+	case b.closed():
+		b.Status = StatusClosed
+	default:
+		b.Status = StatusOpen
+	}
+}
+
+// member returns the index of an upload among the members, or -1
+func (b Batch) member(uploadID string) int {
+	for i, m := range b.Uploads {
+		if m.UploadID == uploadID {
+			return i
+		}
+	}
+	return -1
+}
+
+// Manifest describes the uploads of a complete batch. It is stored as an
+// upload of its own for downstream consumers.
+type Manifest struct {
+	BatchID     string    `json:"batchId"`
+	Name        string    `json:"name,omitempty"`
+	Owner       string    `json:"owner,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	CompletedAt time.Time `json:"completedAt"`
+	Files       []File    `json:"files"`
+}
+
+// File is an upload listed in a manifest
+type File struct {
+	UploadID    string            `json:"uploadId"`
+	Size        int64             `json:"size"`
+	MetaData    map[string]string `json:"metadata,omitempty"`
+	Storage     map[string]string `json:"storage,omitempty"`
+	CompletedAt time.Time         `json:"completedAt"`
+}
+
+// Store persists batches
+type Store interface {
+	Put(ctx context.Context, b Batch) error
+	Get(ctx context.Context, id string) (Batch, error)
+	List(ctx context.Context) ([]Batch, error)
+}
+
+// Registry tracks batches and their uploads. It reports when a batch
+// finished, so its manifest can be written once.
+type Registry struct {
+	store Store
+	now   func() time.Time
+
+	// mu serializes updates, so concurrent completions of the last uploads
+	// of a batch report it finished exactly once
+	mu sync.Mutex
+
+	// finishing holds the batches whose manifest is being written
+	finishing map[string]bool
+}
+
+// NewRegistry creates a registry backed by the store
+func NewRegistry(store Store) *Registry {
+	return &Registry{store: store, now: time.Now, finishing: make(map[string]bool)}
+}
+
+// Open creates a batch uploads can join
+func (r *Registry) Open(ctx context.Context, b Batch) (Batch, error) {
+	if len(b.Name) > MaxNameLen {
+		return Batch{}, fmt.Errorf("%w: name is longer than %d characters", ErrInvalid, MaxNameLen)
+	}
+	if b.Expected < 0 || b.Expected > MaxUploads {
+		return Batch{}, fmt.Errorf("%w: expected must be between 0 and %d", ErrInvalid, MaxUploads)
+	}
+
+	b.ID = newID()
+	b.Uploads = []Member{}
+	b.CreatedAt = r.now()
+	b.ClosedAt, b.CompletedAt, b.ManifestID = nil, nil, ""
+	b.refresh()
+	if err := r.store.Put(ctx, b); err != nil {
+		return Batch{}, fmt.Errorf("failed to store batch: %w", err)
+	}
+	return b, nil
+}
+
+// Get returns a batch
+func (r *Registry) Get(ctx context.Context, id string) (Batch, error) {
+	return r.store.Get(ctx, id)
+}
+
+// List returns the batches of an owner, or of all owners, newest first
+func (r *Registry) List(ctx context.Context, owner string, allOwners bool) ([]Batch, error) {
+	batches, err := r.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Batch, 0, len(batches))
+	for _, b := range batches {
+		if allOwners || b.Owner == owner {
+			result = append(result, b)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.After(result[j].CreatedAt) })
+	return result, nil
+}
+
+// Join adds an upload to an open batch
+func (r *Registry) Join(ctx context.Context, id, uploadID string) (Batch, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, err := r.store.Get(ctx, id)
+	if err != nil {
+		return Batch{}, err
+	}
+	if b.member(uploadID) >= 0 {
+		return b, nil
+	}
+	if b.closed() {
+		return b, ErrClosed
+	}
+	if len(b.Uploads) >= MaxUploads {
+		return b, ErrFull
+	}
+
+	b.Uploads = append(b.Uploads, Member{UploadID: uploadID, JoinedAt: r.now()})
+	return b, r.put(ctx, &b)
+}
+
+// Rename records a member under the ID its upload was created with, when
+// the storage backend changed the ID the upload joined with
+func (r *Registry) Rename(ctx context.Context, id, joinedID, uploadID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, err := r.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	i := b.member(joinedID)
+	if i < 0 {
+		return fmt.Errorf("upload %s is not part of batch %s: %w", joinedID, id, ErrNotFound)
+	}
+	b.Uploads[i].UploadID = uploadID
+	return r.put(ctx, &b)
+}
+
+// Leave removes an upload that was terminated or failed to be created. It
+// reports whether the batch finished, as the upload may have been the last
+// one still in progress.
+func (r *Registry) Leave(ctx context.Context, id, uploadID string) (Batch, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, err := r.store.Get(ctx, id)
+	if err != nil {
+		return Batch{}, false, err
+	}
+	i := b.member(uploadID)
+	if i < 0 || b.ManifestID != "" {
+		return b, false, nil
+	}
+
+	b.Uploads = append(b.Uploads[:i], b.Uploads[i+1:]...)
+	if err := r.put(ctx, &b); err != nil {
+		return Batch{}, false, err
+	}
+	return b, r.claimFinished(b), nil
+}
+
+// Complete records that an upload finished and reports whether the batch
+// finished with it
+func (r *Registry) Complete(ctx context.Context, id, uploadID string) (Batch, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, err := r.store.Get(ctx, id)
+	if err != nil {
+		return Batch{}, false, err
+	}
+	i := b.member(uploadID)
+	if i < 0 {
+		return b, false, fmt.Errorf("upload %s is not part of batch %s: %w", uploadID, id, ErrNotFound)
+	}
+	if b.Uploads[i].CompletedAt == nil {
+		now := r.now()
+		b.Uploads[i].CompletedAt = &now
+		if err := r.put(ctx, &b); err != nil {
+			return Batch{}, false, err
+		}
+	}
+	return b, r.claimFinished(b), nil
+}
+
+// Close stops further uploads from joining a batch and reports whether the
+// batch finished. Closing a finished batch whose manifest could not be
+// written reports it finished again, so the manifest is retried.
+func (r *Registry) Close(ctx context.Context, id string) (Batch, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, err := r.store.Get(ctx, id)
+	if err != nil {
+		return Batch{}, false, err
+	}
+	if len(b.Uploads) == 0 {
+		return b, false, fmt.Errorf("%w: a batch without uploads can't be closed", ErrInvalid)
+	}
+	if b.ClosedAt == nil {
+		now := r.now()
+		b.ClosedAt = &now
+		if err := r.put(ctx, &b); err != nil {
+			return Batch{}, false, err
+		}
+	}
+	return b, r.claimFinished(b), nil
+}
+
+// Finish records the manifest of a finished batch, completing it
+func (r *Registry) Finish(ctx context.Context, id, manifestID string) (Batch, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer delete(r.finishing, id)
+
+	b, err := r.store.Get(ctx, id)
+	if err != nil {
+		return Batch{}, err
+	}
+	now := r.now()
+	b.CompletedAt = &now
+	b.ManifestID = manifestID
+	return b, r.put(ctx, &b)
+}
+
+// Abandon gives up writing the manifest of a finished batch. It is retried
+// when the batch is closed again.
+func (r *Registry) Abandon(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.finishing, id)
+}
+
+// claimFinished reports whether a batch finished and its manifest is not
+// being written yet, in which case the caller writes it
+func (r *Registry) claimFinished(b Batch) bool {
+	if !b.finished() || b.ManifestID != "" || r.finishing[b.ID] {
+		return false
+	}
+	r.finishing[b.ID] = true
+	return true
+}
+
+// put stores a batch after refreshing its derived fields
+func (r *Registry) put(ctx context.Context, b *Batch) error {
+	b.refresh()
+	if err := r.store.Put(ctx, *b); err != nil {
+		return fmt.Errorf("failed to store batch: %w", err)
+	}
+	return nil
+}
+
+// newID generates a random batch ID
+func newID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,95 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestBatchFinishesOnce(t *testing.T) {
+	ctx := context.Background()
+	r := NewRegistry(NewMemoryStore())
+
+	b, err := r.Open(ctx, Batch{Name: "dataset", Expected: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b"} {
+		if _, err := r.Join(ctx, b.ID, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := r.Join(ctx, b.ID, "c"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected a batch to close once the expected uploads joined, got %v", err)
+	}
+
+	if _, done, err := r.Complete(ctx, b.ID, "a"); err != nil || done {
+		t.Fatalf("batch finished with an upload in progress: %v, %v", done, err)
+	}
+	b, done, err := r.Complete(ctx, b.ID, "b")
+	if err != nil || !done {
+		t.Fatalf("expected the batch to finish with its last upload: %v, %v", done, err)
+	}
+	if _, done, _ := r.Complete(ctx, b.ID, "b"); done {
+		t.Fatal("expected a batch to be reported finished once")
+	}
+
+	b, err = r.Finish(ctx, b.ID, "manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Status != StatusComplete || b.Completed != 2 {
+		t.Fatalf("status = %s with %d completed uploads", b.Status, b.Completed)
+	}
+}
+
+func TestCloseAfterTermination(t *testing.T) {
+	ctx := context.Background()
+	r := NewRegistry(NewMemoryStore())
+
+	b, _ := r.Open(ctx, Batch{})
+	if _, _, err := r.Close(ctx, b.ID); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected an empty batch not to close, got %v", err)
+	}
+	_, _ = r.Join(ctx, b.ID, "a")
+	_, _ = r.Join(ctx, b.ID, "b")
+	if _, done, _ := r.Complete(ctx, b.ID, "a"); done {
+		t.Fatal("expected an open batch not to finish")
+	}
+	if _, done, _ := r.Close(ctx, b.ID); done {
+		t.Fatal("expected the batch to wait for its upload in progress")
+	}
+
+	// The terminated upload was the last one in progress
+	if _, done, _ := r.Leave(ctx, b.ID, "b"); !done {
+		t.Fatal("expected the batch to finish when its last upload in progress left")
+	}
+
+	// A manifest that couldn't be written is retried on the next close
+	r.Abandon(b.ID)
+	if _, done, _ := r.Close(ctx, b.ID); !done {
+		t.Fatal("expected closing again to retry the manifest")
+	}
+}
+
+func TestRename(t *testing.T) {
+	ctx := context.Background()
+	r := NewRegistry(NewMemoryStore())
+
+	b, err := r.Open(ctx, Batch{Expected: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Join(ctx, b.ID, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Rename(ctx, b.ID, "x", "x+1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected renaming a stranger to fail, got %v", err)
+	}
+	if err := r.Rename(ctx, b.ID, "a", "a+1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, done, err := r.Complete(ctx, b.ID, "a+1"); err != nil || !done {
+		t.Fatalf("expected the renamed upload to finish the batch: %v, %v", done, err)
+	}
+}
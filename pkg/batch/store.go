@@ -0,0 +1,62 @@
+package batch
+
+import (
+	"context"
+
+	"github.com/devsnb/large-file-uploads/pkg/internal/jsonstore"
+)
+
+// MemoryStore keeps batches in memory. They are lost on restart.
+type MemoryStore struct {
+	batches *jsonstore.Memory[Batch]
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{batches: jsonstore.NewMemory[Batch](ErrNotFound)}
+}
+
+// Put inserts or replaces a batch
+func (s *MemoryStore) Put(ctx context.Context, b Batch) error {
+	s.batches.Put(b.ID, b)
+	return nil
+}
+
+// Get returns a batch by ID
+func (s *MemoryStore) Get(ctx context.Context, id string) (Batch, error) {
+	return s.batches.Get(id)
+}
+
+// List returns all batches
+func (s *MemoryStore) List(ctx context.Context) ([]Batch, error) {
+	return s.batches.List(), nil
+}
+
+// FileStore persists each batch as a JSON file in a directory
+type FileStore struct {
+	batches *jsonstore.Dir[Batch]
+}
+
+// NewFileStore creates a file store, creating the directory if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	batches, err := jsonstore.NewDir[Batch](dir, "batch", ErrNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{batches: batches}, nil
+}
+
+// Put inserts or replaces a batch
+func (s *FileStore) Put(ctx context.Context, b Batch) error {
+	return s.batches.Put(b.ID, b)
+}
+
+// Get returns a batch by ID
+func (s *FileStore) Get(ctx context.Context, id string) (Batch, error) {
+	return s.batches.Get(id)
+}
+
+// List returns all batches
+func (s *FileStore) List(ctx context.Context) ([]Batch, error) {
+	return s.batches.List()
+}
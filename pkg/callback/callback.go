@@ -0,0 +1,332 @@
+// Package callback notifies client-provided callback URLs when their
+// uploads have finished
+package callback
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/deadletter"
+	"github.com/devsnb/large-file-uploads/pkg/events"
+	"github.com/devsnb/large-file-uploads/pkg/eventschema"
+	"github.com/devsnb/large-file-uploads/pkg/jws"
+	"github.com/devsnb/large-file-uploads/pkg/rejection"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+	"github.com/devsnb/large-file-uploads/pkg/uploadstate"
+	"github.com/devsnb/large-file-uploads/pkg/webhook"
+)
+
+// MetadataKey is the upload metadata field holding the callback URL
+const MetadataKey = "callback_url"
+
+// ProgressMetadataKey is the upload metadata field holding the URL progress
+// milestones are posted to
+const ProgressMetadataKey = "progress_url"
+
+// DeadLetterKind identifies callback deliveries in the dead-letter queue
+const DeadLetterKind = "callback"
+
+// Default delivery settings used when the configuration leaves them unset
+const (
+	DefaultTimeout    = 10 * time.Second
+	DefaultMaxRetries = 3
+)
+
+// ErrCallbackNotAllowed is returned when a callback URL is not permitted
+var ErrCallbackNotAllowed = errors.New("callback url not allowed")
+
+// ProcessedEvent identifies processing callbacks, which are posted to the
+// same URL as completion callbacks
+const ProcessedEvent = "upload.processed"
+
+// Payload is the JSON body posted to the callback URL
+type Payload = eventschema.Completion
+
+// ProcessedPayload is the JSON body posted to the callback URL once
+// post-processing has decided the upload's state
+type ProcessedPayload = eventschema.Processed
+
+// Checksum describes the digest of the uploaded content
+type Checksum = eventschema.Checksum
+
+// MilestonePayload is the JSON body posted to the progress URL when an
+// upload passes a milestone
+type MilestonePayload = eventschema.Milestone
+
+// ChecksumFunc returns the hex encoded SHA-256 digest of an upload
+type ChecksumFunc func(ctx context.Context, id string) (string, error)
+
+// AnnotationsFunc returns the current annotations of an upload
+type AnnotationsFunc func(ctx context.Context, id string) (map[string]json.RawMessage, error)
+
+// Notifier validates callback URLs at creation and posts to them once the
+// upload has completed
+type Notifier struct {
+	allowedHosts []string
+	client       *webhook.Client
+	store        storage.Storage
+	deadLetters  *deadletter.Queue
+	checksum     ChecksumFunc
+	annotations  AnnotationsFunc
+}
+
+// NewNotifier creates a callback notifier from the callback configuration.
+// Deliveries that exhaust their retries are recorded in deadLetters, if set.
+func NewNotifier(cfg config.CallbackConfig, store storage.Storage, deadLetters *deadletter.Queue) *Notifier {
+	timeout := DefaultTimeout
+	if cfg.Timeout > 0 {
+		timeout = time.Duration(cfg.Timeout) * time.Second
+	}
+
+	maxRetries := DefaultMaxRetries
+	if cfg.MaxRetries > 0 {
+		maxRetries = cfg.MaxRetries
+	}
+
+	n := &Notifier{
+		allowedHosts: cfg.AllowedHosts,
+		client:       webhook.NewClient(timeout, maxRetries),
+		store:        store,
+		deadLetters:  deadLetters,
+	}
+	n.checksum = func(ctx context.Context, id string) (string, error) {
+		return storage.Checksum(ctx, n.store, id)
+	}
+
+	if deadLetters != nil {
+		deadLetters.RegisterDeliverer(DeadLetterKind, n.redeliver)
+	}
+
+	return n
+}
+
+// UseChecksum replaces how the digest sent in the payload is computed, e.g.
+// to reuse a digest that is computed anyway
+func (n *Notifier) UseChecksum(fn ChecksumFunc) {
+	n.checksum = fn
+}
+
+// UseAnnotations sets how the annotations sent in payloads are read.
+// Payloads then carry the annotations current when they are built, such as
+// a verdict attached after the event was emitted, rather than the event's.
+func (n *Notifier) UseAnnotations(fn AnnotationsFunc) {
+	n.annotations = fn
+}
+
+// currentAnnotations returns the upload's annotations as they are now, or
+// the event's if they can't be read
+func (n *Notifier) currentAnnotations(ctx context.Context, event events.Event) map[string]json.RawMessage {
+	if n.annotations == nil {
+		return event.Annotations
+	}
+	annotations, err := n.annotations(ctx, event.Upload.ID)
+	if err != nil {
+		slog.Warn("Failed to read upload annotations for callback", "id", event.Upload.ID, "error", err)
+		return event.Annotations
+	}
+	return annotations
+}
+
+// UseSigner signs every payload the notifier posts with a detached JWS, so
+// receivers can verify the checksum and annotations came from the server
+func (n *Notifier) UseSigner(signer *jws.Signer) {
+	n.client.UseSigner(signer.Sign)
+}
+
+// Validate rejects upload creations whose callback or progress URL is
+// malformed or not on the allowlist. It is meant to be subscribed
+// synchronously.
+func (n *Notifier) Validate(ctx context.Context, event events.Event) error {
+	for _, key := range []string{MetadataKey, ProgressMetadataKey} {
+		rawURL, ok := event.Upload.MetaData[key]
+		if !ok {
+			continue
+		}
+
+		if err := n.CheckURL(rawURL); err != nil {
+			return rejection.New(http.StatusBadRequest, rejection.CodeCallbackNotAllowed, fmt.Sprintf("%s: %v", key, err))
+		}
+	}
+
+	return nil
+}
+
+// Deliver posts the completion payload to the upload's callback URL, if any
+func (n *Notifier) Deliver(ctx context.Context, event events.Event) error {
+	rawURL, ok := event.Upload.MetaData[MetadataKey]
+	if !ok {
+		return nil
+	}
+
+	// The URL was validated at creation but the allowlist may have changed
+	if err := n.CheckURL(rawURL); err != nil {
+		return err
+	}
+
+	checksum, err := n.checksum(ctx, event.Upload.ID)
+	if err != nil {
+		return fmt.Errorf("failed to compute checksum for callback: %w", err)
+	}
+
+	payload := Payload{
+		SchemaVersion: eventschema.Version,
+		ID:            event.Upload.ID,
+		Size:          event.Upload.Size,
+		MetaData:      event.Upload.MetaData,
+		Storage:       event.Upload.Storage,
+		Checksum: Checksum{
+			Algorithm: "sha256",
+			Value:     checksum,
+		},
+		CompletedAt: event.Time,
+		Annotations: n.currentAnnotations(ctx, event),
+	}
+
+	if err := n.client.Post(ctx, rawURL, payload); err != nil {
+		n.deadLetter(ctx, rawURL, payload.ID, payload, err)
+		return fmt.Errorf("failed to deliver callback for upload %s: %w", event.Upload.ID, err)
+	}
+
+	slog.Info("Upload callback delivered", "id", event.Upload.ID, "url", rawURL)
+	return nil
+}
+
+// DeliverProcessed posts the state post-processing moved the upload to,
+// with the annotations it attached such as the antivirus verdict, to the
+// upload's callback URL, if any. It is meant to be subscribed to state
+// changes; only changes out of the processing state, other than deletion,
+// are posted.
+func (n *Notifier) DeliverProcessed(ctx context.Context, event events.Event) error {
+	if event.PreviousState != string(uploadstate.Processing) || event.State == string(uploadstate.Deleted) {
+		return nil
+	}
+	rawURL, ok := event.Upload.MetaData[MetadataKey]
+	if !ok {
+		return nil
+	}
+
+	if err := n.CheckURL(rawURL); err != nil {
+		return err
+	}
+
+	payload := ProcessedPayload{
+		SchemaVersion: eventschema.Version,
+		Event:         ProcessedEvent,
+		ID:            event.Upload.ID,
+		State:         event.State,
+		Size:          event.Upload.Size,
+		MetaData:      event.Upload.MetaData,
+		ProcessedAt:   event.Time,
+		Annotations:   n.currentAnnotations(ctx, event),
+	}
+
+	if err := n.client.Post(ctx, rawURL, payload); err != nil {
+		n.deadLetter(ctx, rawURL, payload.ID, payload, err)
+		return fmt.Errorf("failed to deliver processing callback for upload %s: %w", event.Upload.ID, err)
+	}
+
+	slog.Info("Upload processing callback delivered", "id", event.Upload.ID, "state", event.State, "url", rawURL)
+	return nil
+}
+
+// DeliverMilestone posts a progress milestone to the upload's progress URL,
+// if any. A failed milestone is superseded by the next one, so it isn't
+// dead-lettered.
+func (n *Notifier) DeliverMilestone(ctx context.Context, event events.Event) error {
+	rawURL, ok := event.Upload.MetaData[ProgressMetadataKey]
+	if !ok {
+		return nil
+	}
+
+	if err := n.CheckURL(rawURL); err != nil {
+		return err
+	}
+
+	payload := MilestonePayload{
+		SchemaVersion: eventschema.Version,
+		ID:            event.Upload.ID,
+		Milestone:     event.Milestone,
+		Offset:        event.Upload.Offset,
+		Size:          event.Upload.Size,
+		MetaData:      event.Upload.MetaData,
+		ReachedAt:     event.Time,
+	}
+
+	if err := n.client.Post(ctx, rawURL, payload); err != nil {
+		return fmt.Errorf("failed to deliver %d%% milestone for upload %s: %w", event.Milestone, event.Upload.ID, err)
+	}
+
+	slog.Debug("Upload milestone delivered", "id", event.Upload.ID, "milestone", event.Milestone, "url", rawURL)
+	return nil
+}
+
+// deadLetter records a failed delivery in the dead-letter queue
+func (n *Notifier) deadLetter(ctx context.Context, target, uploadID string, payload any, deliveryErr error) {
+	if n.deadLetters == nil {
+		return
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("Failed to encode dead-letter payload", "id", uploadID, "error", err)
+		return
+	}
+
+	_, err = n.deadLetters.Add(ctx, deadletter.Entry{
+		Kind:     DeadLetterKind,
+		Target:   target,
+		UploadID: uploadID,
+		Payload:  body,
+		Error:    deliveryErr.Error(),
+		Attempts: 1,
+	})
+	if err != nil {
+		slog.Error("Failed to record dead letter", "id", uploadID, "error", err)
+	}
+}
+
+// redeliver posts a dead-lettered payload to its callback URL again
+func (n *Notifier) redeliver(ctx context.Context, entry deadletter.Entry) error {
+	if err := n.CheckURL(entry.Target); err != nil {
+		return err
+	}
+	return n.client.Post(ctx, entry.Target, entry.Payload)
+}
+
+// CheckURL verifies that the URL uses http(s) and its host is allowlisted.
+// Allowlist entries match the host exactly, or any subdomain when prefixed
+// with "*.".
+func (n *Notifier) CheckURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCallbackNotAllowed, err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: unsupported scheme %q", ErrCallbackNotAllowed, u.Scheme)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range n.allowedHosts {
+		allowed = strings.ToLower(allowed)
+		if suffix, ok := strings.CutPrefix(allowed, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return nil
+			}
+			continue
+		}
+		if host == allowed {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: host %q is not on the allowlist", ErrCallbackNotAllowed, host)
+}
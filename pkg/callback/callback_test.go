@@ -0,0 +1,188 @@
+package callback
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/events"
+	"github.com/devsnb/large-file-uploads/pkg/jws"
+	"github.com/devsnb/large-file-uploads/pkg/webhook"
+)
+
+func TestCheckURL(t *testing.T) {
+	n := NewNotifier(config.CallbackConfig{
+		AllowedHosts: []string{"hooks.example.com", "*.internal.example.org"},
+	}, nil, nil)
+
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://hooks.example.com/done", true},
+		{"http://HOOKS.example.com:8080/done", true},
+		{"https://api.internal.example.org/cb", true},
+		{"https://internal.example.org/cb", false},
+		{"https://evil.example.com/done", false},
+		{"ftp://hooks.example.com/done", false},
+		{"://bad", false},
+	}
+
+	for _, tt := range tests {
+		err := n.CheckURL(tt.url)
+		if tt.allowed && err != nil {
+			t.Errorf("Expected %s to be allowed, got %v", tt.url, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrCallbackNotAllowed) {
+			t.Errorf("Expected %s to be rejected, got %v", tt.url, err)
+		}
+	}
+}
+
+func TestValidateRejectsDisallowedCallback(t *testing.T) {
+	n := NewNotifier(config.CallbackConfig{}, nil, nil)
+
+	event := events.Event{
+		Type: events.UploadCreated,
+		Upload: tusd.FileInfo{
+			MetaData: tusd.MetaData{MetadataKey: "https://example.com/cb"},
+		},
+	}
+	if err := n.Validate(context.Background(), event); err == nil {
+		t.Error("Expected callback to be rejected with an empty allowlist")
+	}
+
+	event.Upload.MetaData = tusd.MetaData{ProgressMetadataKey: "https://example.com/progress"}
+	if err := n.Validate(context.Background(), event); err == nil {
+		t.Error("Expected progress URL to be rejected with an empty allowlist")
+	}
+
+	event.Upload.MetaData = tusd.MetaData{"filename": "a.bin"}
+	if err := n.Validate(context.Background(), event); err != nil {
+		t.Errorf("Expected uploads without callback to be accepted, got %v", err)
+	}
+}
+
+func TestDeliverSigned(t *testing.T) {
+	var body []byte
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(webhook.SignatureHeader)
+	}))
+	defer server.Close()
+
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := jws.NewSigner(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := NewNotifier(config.CallbackConfig{AllowedHosts: []string{"127.0.0.1"}}, nil, nil)
+	n.UseChecksum(func(ctx context.Context, id string) (string, error) { return "9f86d0", nil })
+	n.UseSigner(signer)
+
+	event := events.Event{
+		Type:   events.UploadCompleted,
+		Upload: tusd.FileInfo{ID: "abc", Size: 4, MetaData: tusd.MetaData{MetadataKey: server.URL}},
+	}
+	if err := n.Deliver(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	if err := jws.Verify(signature, body, signer.JWK()); err != nil {
+		t.Fatalf("expected the delivered payload to verify, got %v", err)
+	}
+	tampered := bytes.Replace(body, []byte("9f86d0"), []byte("000000"), 1)
+	if err := jws.Verify(signature, tampered, signer.JWK()); !errors.Is(err, jws.ErrInvalidSignature) {
+		t.Fatalf("expected a tampered checksum to fail verification, got %v", err)
+	}
+}
+
+func TestDeliverProcessedCarriesVerdict(t *testing.T) {
+	var bodies [][]byte
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, body)
+		signature = r.Header.Get(webhook.SignatureHeader)
+	}))
+	defer server.Close()
+
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := jws.NewSigner(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := NewNotifier(config.CallbackConfig{AllowedHosts: []string{"127.0.0.1"}}, nil, nil)
+	n.UseSigner(signer)
+
+	upload := tusd.FileInfo{ID: "abc", Size: 4, MetaData: tusd.MetaData{MetadataKey: server.URL}}
+	verdict := map[string]json.RawMessage{"antivirus": json.RawMessage(`{"verdict":"clean"}`)}
+	for _, event := range []events.Event{
+		{Type: events.UploadStateChanged, Upload: upload, PreviousState: "uploaded", State: "processing"},
+		{Type: events.UploadStateChanged, Upload: upload, PreviousState: "processing", State: "deleted"},
+		{Type: events.UploadStateChanged, Upload: upload, PreviousState: "processing", State: "ready", Annotations: verdict},
+	} {
+		if err := n.DeliverProcessed(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(bodies) != 1 {
+		t.Fatalf("expected only the change out of processing to be posted, got %d callbacks", len(bodies))
+	}
+	var payload ProcessedPayload
+	if err := json.Unmarshal(bodies[0], &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != ProcessedEvent || payload.State != "ready" || string(payload.Annotations["antivirus"]) != `{"verdict":"clean"}` {
+		t.Fatalf("expected the processed payload to carry the verdict, got %s", bodies[0])
+	}
+	if err := jws.Verify(signature, bodies[0], signer.JWK()); err != nil {
+		t.Fatalf("expected the processed payload to verify, got %v", err)
+	}
+}
+
+func TestDeliverRereadsAnnotations(t *testing.T) {
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	n := NewNotifier(config.CallbackConfig{AllowedHosts: []string{"127.0.0.1"}}, nil, nil)
+	n.UseChecksum(func(ctx context.Context, id string) (string, error) { return "9f86d0", nil })
+	// Annotated after the completion event was emitted
+	n.UseAnnotations(func(ctx context.Context, id string) (map[string]json.RawMessage, error) {
+		return map[string]json.RawMessage{"antivirus": json.RawMessage(`{"verdict":"clean"}`)}, nil
+	})
+
+	event := events.Event{
+		Type:   events.UploadCompleted,
+		Upload: tusd.FileInfo{ID: "abc", Size: 4, MetaData: tusd.MetaData{MetadataKey: server.URL}},
+	}
+	if err := n.Deliver(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	var payload Payload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if string(payload.Annotations["antivirus"]) != `{"verdict":"clean"}` {
+		t.Fatalf("expected the payload to carry the current annotations, got %s", body)
+	}
+}
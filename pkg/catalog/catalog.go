@@ -0,0 +1,418 @@
+// Package catalog lets users organize their uploads with tags and named
+// collections, and list them by either
+package catalog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits on user-provided values
+const (
+	MaxTags              = 32
+	MaxCollectionNameLen = 128
+)
+
+// tagPattern restricts tags to characters that are safe in query strings
+// and allows label-style tags such as env:prod
+var tagPattern = regexp.MustCompile(`^[A-Za-z0-9_.:/-]{1,64}$`)
+
+// Common errors returned by catalog operations
+var (
+	ErrNotFound          = errors.New("not found in catalog")
+	ErrInvalidTag        = errors.New("invalid tag")
+	ErrTooManyTags       = errors.New("too many tags")
+	ErrInvalidName       = errors.New("invalid collection name")
+	ErrDuplicateName     = errors.New("a collection with this name already exists")
+	ErrCollectionMissing = errors.New("collection not found")
+)
+
+// Entry describes how an upload is organized
+type Entry struct {
+	UploadID    string    `json:"uploadId"`
+	Owner       string    `json:"owner,omitempty"`
+	Filename    string    `json:"filename,omitempty"`
+	Tags        []string  `json:"tags"`
+	Collections []string  `json:"collections"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+
+	// Downloads counts completed download requests
+	Downloads      int64      `json:"downloads"`
+	LastAccessedAt *time.Time `json:"lastAccessedAt,omitempty"`
+}
+
+// Collection is a named group of uploads, like a folder
+type Collection struct {
+	ID        string    `json:"id"`
+	Owner     string    `json:"owner,omitempty"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Filter selects entries when listing
+type Filter struct {
+	// Owner restricts the listing to one owner unless AllOwners is set
+	Owner     string
+	AllOwners bool
+
+	// Tags lists tags every entry must have
+	Tags []string
+
+	// Collection restricts the listing to members of a collection
+	Collection string
+}
+
+// Store persists entries and collections
+type Store interface {
+	PutEntry(ctx context.Context, entry Entry) error
+	GetEntry(ctx context.Context, uploadID string) (Entry, error)
+	ListEntries(ctx context.Context) ([]Entry, error)
+	WalkEntries(ctx context.Context, fn func(Entry) error) error
+	DeleteEntry(ctx context.Context, uploadID string) error
+
+	PutCollection(ctx context.Context, collection Collection) error
+	GetCollection(ctx context.Context, id string) (Collection, error)
+	ListCollections(ctx context.Context) ([]Collection, error)
+	DeleteCollection(ctx context.Context, id string) error
+}
+
+// matches reports whether the filter selects an entry
+func (f Filter) matches(entry Entry) bool {
+	if !f.AllOwners && entry.Owner != f.Owner {
+		return false
+	}
+	if f.Collection != "" && !slices.Contains(entry.Collections, f.Collection) {
+		return false
+	}
+	return hasTags(entry, f.Tags)
+}
+
+// Catalog organizes uploads into tags and collections
+type Catalog struct {
+	store Store
+	mu    sync.Mutex
+	now   func() time.Time
+}
+
+// New creates a catalog backed by the given store
+func New(store Store) *Catalog {
+	return &Catalog{
+		store: store,
+		now:   time.Now,
+	}
+}
+
+// Register records a new upload, so it shows up in listings before it is
+// tagged or collected
+func (c *Catalog) Register(ctx context.Context, uploadID, owner, filename string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := c.entry(ctx, uploadID, owner, filename)
+	return err
+}
+
+// Entry returns the catalog entry of an upload
+func (c *Catalog) Entry(ctx context.Context, uploadID string) (Entry, error) {
+	return c.store.GetEntry(ctx, uploadID)
+}
+
+// SetTags replaces the tags of an upload. Tags are deduplicated and sorted.
+func (c *Catalog) SetTags(ctx context.Context, uploadID, owner string, tags []string) (Entry, error) {
+	normalized, err := normalizeTags(tags)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, err := c.entry(ctx, uploadID, owner, "")
+	if err != nil {
+		return Entry{}, err
+	}
+
+	entry.Tags = normalized
+	return entry, c.put(ctx, &entry)
+}
+
+// RecordDownloads adds downloads to an upload's entry. It returns
+// ErrNotFound for uploads that are not cataloged.
+func (c *Catalog) RecordDownloads(ctx context.Context, uploadID string, count int64, lastAccess time.Time) (Entry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, err := c.store.GetEntry(ctx, uploadID)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	entry.Downloads += count
+	if entry.LastAccessedAt == nil || lastAccess.After(*entry.LastAccessedAt) {
+		entry.LastAccessedAt = &lastAccess
+	}
+
+	// Downloads don't change the entry itself, so UpdatedAt is kept
+	if err := c.store.PutEntry(ctx, entry); err != nil {
+		return Entry{}, fmt.Errorf("failed to store catalog entry: %w", err)
+	}
+	return entry, nil
+}
+
+// Forget removes an upload from the catalog, e.g. once it was terminated
+func (c *Catalog) Forget(ctx context.Context, uploadID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := c.store.DeleteEntry(ctx, uploadID)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// List returns the entries matching the filter, newest first
+func (c *Catalog) List(ctx context.Context, filter Filter) ([]Entry, error) {
+	entries, err := c.store.ListEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]Entry, 0, len(entries))
+	for _, entry := range entries {
+		if filter.matches(entry) {
+			matches = append(matches, entry)
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].CreatedAt.After(matches[j].CreatedAt)
+	})
+	return matches, nil
+}
+
+// Walk calls fn for each entry matching the filter until it returns an
+// error. Unlike List, entries are visited in no particular order and are
+// never all held in memory, so it suits exports of large catalogs.
+func (c *Catalog) Walk(ctx context.Context, filter Filter, fn func(Entry) error) error {
+	return c.store.WalkEntries(ctx, func(entry Entry) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !filter.matches(entry) {
+			return nil
+		}
+		return fn(entry)
+	})
+}
+
+// CreateCollection creates a named collection. Names are unique per owner.
+func (c *Catalog) CreateCollection(ctx context.Context, owner, name string) (Collection, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > MaxCollectionNameLen {
+		return Collection{}, fmt.Errorf("%w: must be 1 to %d characters", ErrInvalidName, MaxCollectionNameLen)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	existing, err := c.store.ListCollections(ctx)
+	if err != nil {
+		return Collection{}, err
+	}
+	for _, collection := range existing {
+		if collection.Owner == owner && strings.EqualFold(collection.Name, name) {
+			return Collection{}, ErrDuplicateName
+		}
+	}
+
+	collection := Collection{
+		ID:        newID(),
+		Owner:     owner,
+		Name:      name,
+		CreatedAt: c.now(),
+	}
+	if err := c.store.PutCollection(ctx, collection); err != nil {
+		return Collection{}, fmt.Errorf("failed to store collection: %w", err)
+	}
+	return collection, nil
+}
+
+// Collection returns a single collection
+func (c *Catalog) Collection(ctx context.Context, id string) (Collection, error) {
+	collection, err := c.store.GetCollection(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return Collection{}, ErrCollectionMissing
+	}
+	return collection, err
+}
+
+// Collections returns the collections of an owner, or of all owners when
+// allOwners is set, sorted by name
+func (c *Catalog) Collections(ctx context.Context, owner string, allOwners bool) ([]Collection, error) {
+	collections, err := c.store.ListCollections(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]Collection, 0, len(collections))
+	for _, collection := range collections {
+		if allOwners || collection.Owner == owner {
+			matches = append(matches, collection)
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return strings.ToLower(matches[i].Name) < strings.ToLower(matches[j].Name)
+	})
+	return matches, nil
+}
+
+// DeleteCollection deletes a collection. Its uploads are kept.
+func (c *Catalog) DeleteCollection(ctx context.Context, id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := c.store.GetCollection(ctx, id); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrCollectionMissing
+		}
+		return err
+	}
+
+	entries, err := c.store.ListEntries(ctx)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if slices.Contains(entry.Collections, id) {
+			entry.Collections = slices.DeleteFunc(entry.Collections, func(cid string) bool { return cid == id })
+			if err := c.put(ctx, &entry); err != nil {
+				return err
+			}
+		}
+	}
+
+	return c.store.DeleteCollection(ctx, id)
+}
+
+// AddToCollection adds an upload to a collection
+func (c *Catalog) AddToCollection(ctx context.Context, collectionID, uploadID, owner string) (Entry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := c.store.GetCollection(ctx, collectionID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return Entry{}, ErrCollectionMissing
+		}
+		return Entry{}, err
+	}
+
+	entry, err := c.entry(ctx, uploadID, owner, "")
+	if err != nil {
+		return Entry{}, err
+	}
+	if slices.Contains(entry.Collections, collectionID) {
+		return entry, nil
+	}
+
+	entry.Collections = append(entry.Collections, collectionID)
+	return entry, c.put(ctx, &entry)
+}
+
+// RemoveFromCollection removes an upload from a collection
+func (c *Catalog) RemoveFromCollection(ctx context.Context, collectionID, uploadID string) (Entry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, err := c.store.GetEntry(ctx, uploadID)
+	if err != nil {
+		return Entry{}, err
+	}
+	if !slices.Contains(entry.Collections, collectionID) {
+		return Entry{}, ErrNotFound
+	}
+
+	entry.Collections = slices.DeleteFunc(entry.Collections, func(cid string) bool { return cid == collectionID })
+	return entry, c.put(ctx, &entry)
+}
+
+// entry returns the entry of an upload, creating it if needed. Callers
+// must hold the lock.
+func (c *Catalog) entry(ctx context.Context, uploadID, owner, filename string) (Entry, error) {
+	entry, err := c.store.GetEntry(ctx, uploadID)
+	if err == nil {
+		return entry, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return Entry{}, err
+	}
+
+	now := c.now()
+	entry = Entry{
+		UploadID:    uploadID,
+		Owner:       owner,
+		Filename:    filename,
+		Tags:        []string{},
+		Collections: []string{},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	return entry, c.store.PutEntry(ctx, entry)
+}
+
+// put stores an updated entry
+func (c *Catalog) put(ctx context.Context, entry *Entry) error {
+	entry.UpdatedAt = c.now()
+	if err := c.store.PutEntry(ctx, *entry); err != nil {
+		return fmt.Errorf("failed to store catalog entry: %w", err)
+	}
+	return nil
+}
+
+// normalizeTags validates, deduplicates and sorts tags
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if !tagPattern.MatchString(tag) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidTag, tag)
+		}
+		if !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	if len(normalized) > MaxTags {
+		return nil, fmt.Errorf("%w: at most %d are allowed", ErrTooManyTags, MaxTags)
+	}
+
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// hasTags reports whether the entry has all of the tags
+func hasTags(entry Entry, tags []string) bool {
+	for _, tag := range tags {
+		if !slices.Contains(entry.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// newID generates a random collection ID
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
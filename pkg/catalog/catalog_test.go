@@ -0,0 +1,114 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCatalog(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(store)
+
+	if err := c.Register(ctx, "a", "alice", "a.mp4"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Register(ctx, "b", "alice", "b.mp4"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Register(ctx, "c", "bob", "c.mp4"); err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := c.SetTags(ctx, "a", "alice", []string{"video", "env:prod", "video"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(entry.Tags, []string{"env:prod", "video"}) {
+		t.Fatalf("unexpected tags: %v", entry.Tags)
+	}
+	if _, err := c.SetTags(ctx, "a", "alice", []string{"has space"}); !errors.Is(err, ErrInvalidTag) {
+		t.Fatalf("expected invalid tag, got %v", err)
+	}
+
+	holiday, err := c.CreateCollection(ctx, "alice", "Holiday")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CreateCollection(ctx, "alice", "holiday"); !errors.Is(err, ErrDuplicateName) {
+		t.Fatalf("expected duplicate name, got %v", err)
+	}
+	if _, err := c.CreateCollection(ctx, "bob", "Holiday"); err != nil {
+		t.Fatalf("names should be unique per owner only: %v", err)
+	}
+
+	if _, err := c.AddToCollection(ctx, holiday.ID, "b", "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(filter Filter) []string {
+		entries, err := c.List(ctx, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, entry := range entries {
+			ids = append(ids, entry.UploadID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+
+	if ids := list(Filter{Owner: "alice"}); !slices.Equal(ids, []string{"a", "b"}) {
+		t.Fatalf("unexpected owner listing: %v", ids)
+	}
+	if ids := list(Filter{Owner: "alice", Tags: []string{"video"}}); !slices.Equal(ids, []string{"a"}) {
+		t.Fatalf("unexpected tag listing: %v", ids)
+	}
+	if ids := list(Filter{Owner: "alice", Collection: holiday.ID}); !slices.Equal(ids, []string{"b"}) {
+		t.Fatalf("unexpected collection listing: %v", ids)
+	}
+	if ids := list(Filter{AllOwners: true}); len(ids) != 3 {
+		t.Fatalf("unexpected listing across owners: %v", ids)
+	}
+
+	// Deleting a collection keeps its uploads but drops the membership
+	if err := c.DeleteCollection(ctx, holiday.ID); err != nil {
+		t.Fatal(err)
+	}
+	entry, err = c.Entry(ctx, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entry.Collections) != 0 {
+		t.Fatalf("expected membership to be dropped: %v", entry.Collections)
+	}
+
+	accessed := time.Now()
+	if _, err := c.RecordDownloads(ctx, "b", 2, accessed); err != nil {
+		t.Fatal(err)
+	}
+	entry, err = c.RecordDownloads(ctx, "b", 1, accessed.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Downloads != 3 || !entry.LastAccessedAt.Equal(accessed) {
+		t.Fatalf("unexpected download statistics: %d, %v", entry.Downloads, entry.LastAccessedAt)
+	}
+	if _, err := c.RecordDownloads(ctx, "missing", 1, accessed); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	if err := c.Forget(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Entry(ctx, "a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected forgotten entry, got %v", err)
+	}
+}
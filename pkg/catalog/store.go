@@ -0,0 +1,135 @@
+package catalog
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/devsnb/large-file-uploads/pkg/internal/jsonstore"
+)
+
+// MemoryStore keeps the catalog in memory. It is lost on restart.
+type MemoryStore struct {
+	entries     *jsonstore.Memory[Entry]
+	collections *jsonstore.Memory[Collection]
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries:     jsonstore.NewMemory[Entry](ErrNotFound),
+		collections: jsonstore.NewMemory[Collection](ErrNotFound),
+	}
+}
+
+// PutEntry inserts or replaces an entry
+func (s *MemoryStore) PutEntry(ctx context.Context, entry Entry) error {
+	s.entries.Put(entry.UploadID, entry)
+	return nil
+}
+
+// GetEntry returns the entry of an upload
+func (s *MemoryStore) GetEntry(ctx context.Context, uploadID string) (Entry, error) {
+	return s.entries.Get(uploadID)
+}
+
+// ListEntries returns all entries
+func (s *MemoryStore) ListEntries(ctx context.Context) ([]Entry, error) {
+	return s.entries.List(), nil
+}
+
+// WalkEntries calls fn for each entry until it returns an error
+func (s *MemoryStore) WalkEntries(ctx context.Context, fn func(Entry) error) error {
+	return s.entries.Walk(fn)
+}
+
+// DeleteEntry removes the entry of an upload
+func (s *MemoryStore) DeleteEntry(ctx context.Context, uploadID string) error {
+	return s.entries.Delete(uploadID)
+}
+
+// PutCollection inserts or replaces a collection
+func (s *MemoryStore) PutCollection(ctx context.Context, collection Collection) error {
+	s.collections.Put(collection.ID, collection)
+	return nil
+}
+
+// GetCollection returns a single collection
+func (s *MemoryStore) GetCollection(ctx context.Context, id string) (Collection, error) {
+	return s.collections.Get(id)
+}
+
+// ListCollections returns all collections
+func (s *MemoryStore) ListCollections(ctx context.Context) ([]Collection, error) {
+	return s.collections.List(), nil
+}
+
+// DeleteCollection removes a collection
+func (s *MemoryStore) DeleteCollection(ctx context.Context, id string) error {
+	return s.collections.Delete(id)
+}
+
+// FileStore persists entries and collections as JSON files in the uploads
+// and collections subdirectories of a directory
+type FileStore struct {
+	entries     *jsonstore.Dir[Entry]
+	collections *jsonstore.Dir[Collection]
+}
+
+// NewFileStore creates a file store, creating the directories if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	entries, err := jsonstore.NewDir[Entry](filepath.Join(dir, "uploads"), "catalog entry", ErrNotFound)
+	if err != nil {
+		return nil, err
+	}
+	collections, err := jsonstore.NewDir[Collection](filepath.Join(dir, "collections"), "catalog collection", ErrNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{entries: entries, collections: collections}, nil
+}
+
+// PutEntry inserts or replaces an entry
+func (s *FileStore) PutEntry(ctx context.Context, entry Entry) error {
+	return s.entries.Put(entry.UploadID, entry)
+}
+
+// GetEntry returns the entry of an upload
+func (s *FileStore) GetEntry(ctx context.Context, uploadID string) (Entry, error) {
+	return s.entries.Get(uploadID)
+}
+
+// ListEntries returns all entries
+func (s *FileStore) ListEntries(ctx context.Context) ([]Entry, error) {
+	return s.entries.List()
+}
+
+// WalkEntries calls fn for each entry until it returns an error, reading
+// entries one at a time
+func (s *FileStore) WalkEntries(ctx context.Context, fn func(Entry) error) error {
+	return s.entries.Walk(fn)
+}
+
+// DeleteEntry removes the entry of an upload
+func (s *FileStore) DeleteEntry(ctx context.Context, uploadID string) error {
+	return s.entries.Delete(uploadID)
+}
+
+// PutCollection inserts or replaces a collection
+func (s *FileStore) PutCollection(ctx context.Context, collection Collection) error {
+	return s.collections.Put(collection.ID, collection)
+}
+
+// GetCollection returns a single collection
+func (s *FileStore) GetCollection(ctx context.Context, id string) (Collection, error) {
+	return s.collections.Get(id)
+}
+
+// ListCollections returns all collections
+func (s *FileStore) ListCollections(ctx context.Context) ([]Collection, error) {
+	return s.collections.List()
+}
+
+// DeleteCollection removes a collection
+func (s *FileStore) DeleteCollection(ctx context.Context, id string) error {
+	return s.collections.Delete(id)
+}
@@ -0,0 +1,205 @@
+// Package cdn signs download URLs for uploads served through a CDN in
+// front of the storage bucket, so private objects can be cached at the edge
+package cdn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// Providers selectable in the CDN configuration
+const (
+	CloudFront = "cloudfront"
+	Azure      = "azure"
+)
+
+// ErrInvalidConfig is returned for incomplete or unsupported CDN settings
+var ErrInvalidConfig = errors.New("invalid CDN configuration")
+
+// Options configures a signed URL
+type Options struct {
+	Expires time.Time
+
+	// CacheControl and Filename set the Cache-Control and
+	// Content-Disposition headers of the response, if not empty
+	CacheControl string
+	Filename     string
+}
+
+// Signer creates signed CDN URLs for object keys
+type Signer interface {
+	SignURL(key string, opts Options) (string, error)
+}
+
+// CloudFrontSigner signs CloudFront URLs with a canned policy
+type CloudFrontSigner struct {
+	baseURL   string
+	keyPairID string
+	key       *rsa.PrivateKey
+}
+
+// NewCloudFront creates a signer for the distribution at baseURL using the
+// key pair (public key ID) and its PEM encoded RSA private key
+func NewCloudFront(baseURL, keyPairID string, privateKeyPEM []byte) (*CloudFrontSigner, error) {
+	if baseURL == "" || keyPairID == "" {
+		return nil, fmt.Errorf("base URL and key pair ID are required: %w", ErrInvalidConfig)
+	}
+
+	key, err := parseRSAKey(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CloudFrontSigner{
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		keyPairID: keyPairID,
+		key:       key,
+	}, nil
+}
+
+// cannedPolicy is the policy CloudFront reconstructs to verify signatures
+// of URLs carrying an Expires parameter
+type cannedPolicy struct {
+	Statement []cannedStatement `json:"Statement"`
+}
+
+type cannedStatement struct {
+	Resource  string `json:"Resource"`
+	Condition struct {
+		DateLessThan struct {
+			EpochTime int64 `json:"AWS:EpochTime"`
+		} `json:"DateLessThan"`
+	} `json:"Condition"`
+}
+
+// SignURL returns a URL for key valid until opts.Expires. Response headers
+// are overridden with S3's response-* parameters, which the distribution
+// must forward to the origin.
+func (s *CloudFrontSigner) SignURL(key string, opts Options) (string, error) {
+	query := url.Values{}
+	if opts.CacheControl != "" {
+		query.Set("response-cache-control", opts.CacheControl)
+	}
+	if opts.Filename != "" {
+		query.Set("response-content-disposition", attachment(opts.Filename))
+	}
+
+	resource := s.baseURL + "/" + escapeKey(key)
+	if len(query) > 0 {
+		resource += "?" + query.Encode()
+	}
+
+	statement := cannedStatement{Resource: resource}
+	statement.Condition.DateLessThan.EpochTime = opts.Expires.Unix()
+
+	// CloudFront compares the policy byte by byte, so & must not be escaped
+	var policy bytes.Buffer
+	encoder := json.NewEncoder(&policy)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(cannedPolicy{Statement: []cannedStatement{statement}}); err != nil {
+		return "", fmt.Errorf("failed to encode policy: %w", err)
+	}
+
+	hash := sha1.Sum(bytes.TrimSuffix(policy.Bytes(), []byte("\n")))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA1, hash[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign policy: %w", err)
+	}
+
+	separator := "?"
+	if len(query) > 0 {
+		separator = "&"
+	}
+	return resource + separator +
+		"Expires=" + strconv.FormatInt(opts.Expires.Unix(), 10) +
+		"&Signature=" + cloudFrontEncoding.Replace(base64.StdEncoding.EncodeToString(signature)) +
+		"&Key-Pair-Id=" + url.QueryEscape(s.keyPairID), nil
+}
+
+// cloudFrontEncoding replaces characters that are invalid in query strings,
+// as CloudFront expects
+var cloudFrontEncoding = strings.NewReplacer("+", "-", "=", "_", "/", "~")
+
+// AzureSigner signs Azure CDN URLs with a shared access signature of the
+// origin storage account, which the CDN passes through to the origin
+type AzureSigner struct {
+	baseURL string
+	sas     storage.SASSigner
+}
+
+// NewAzure creates a signer for the CDN endpoint at baseURL, which includes
+// the container path, e.g. https://uploads.azureedge.net/uploads
+func NewAzure(baseURL string, sas storage.SASSigner) (*AzureSigner, error) {
+	if baseURL == "" {
+		return nil, fmt.Errorf("base URL is required: %w", ErrInvalidConfig)
+	}
+	return &AzureSigner{baseURL: strings.TrimSuffix(baseURL, "/"), sas: sas}, nil
+}
+
+// SignURL returns a URL for key valid until opts.Expires
+func (s *AzureSigner) SignURL(key string, opts Options) (string, error) {
+	sasOpts := storage.SASOptions{
+		Expires:      opts.Expires,
+		CacheControl: opts.CacheControl,
+	}
+	if opts.Filename != "" {
+		sasOpts.ContentDisposition = attachment(opts.Filename)
+	}
+
+	query, err := s.sas.SignSAS(key, sasOpts)
+	if err != nil {
+		return "", err
+	}
+	return s.baseURL + "/" + escapeKey(key) + "?" + query, nil
+}
+
+// parseRSAKey decodes a PKCS #1 or PKCS #8 PEM encoded RSA private key
+func parseRSAKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("private key is not PEM encoded: %w", ErrInvalidConfig)
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", ErrInvalidConfig)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not an RSA key: %w", ErrInvalidConfig)
+	}
+	return key, nil
+}
+
+// escapeKey escapes an object key for use as a URL path, keeping slashes
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// attachment returns a Content-Disposition value downloading as filename
+func attachment(filename string) string {
+	return mime.FormatMediaType("attachment", map[string]string{"filename": filename})
+}
@@ -0,0 +1,100 @@
+package cdn
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+func TestCloudFrontSignURL(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	signer, err := NewCloudFront("https://d111111abcdef8.cloudfront.net/", "K2JCJMDEHXQW5F", keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expires := time.Unix(1767225600, 0)
+	signed, err := signer.SignURL("acme~0123", Options{
+		Expires:      expires,
+		CacheControl: "private, max-age=3600",
+		Filename:     "report.pdf",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if parsed.Path != "/acme~0123" || query.Get("Expires") != "1767225600" || query.Get("Key-Pair-Id") != "K2JCJMDEHXQW5F" {
+		t.Fatalf("unexpected URL %s", signed)
+	}
+	if query.Get("response-cache-control") != "private, max-age=3600" {
+		t.Fatalf("response-cache-control = %q", query.Get("response-cache-control"))
+	}
+
+	// Rebuild the canned policy the way CloudFront does and check the signature
+	resource, _, _ := strings.Cut(signed, "&Expires=")
+	policy := fmt.Sprintf(`{"Statement":[{"Resource":"%s","Condition":{"DateLessThan":{"AWS:EpochTime":%d}}}]}`, resource, expires.Unix())
+	signature, err := base64.StdEncoding.DecodeString(strings.NewReplacer("-", "+", "_", "=", "~", "/").Replace(query.Get("Signature")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha1.Sum([]byte(policy))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA1, hash[:], signature); err != nil {
+		t.Fatalf("signature does not verify: %v", err)
+	}
+
+	if _, err := NewCloudFront("https://example.com", "K1", []byte("not a key")); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expected ErrInvalidConfig, got %v", err)
+	}
+}
+
+// fakeSAS records the options it signs
+type fakeSAS struct {
+	key  string
+	opts storage.SASOptions
+}
+
+func (f *fakeSAS) SignSAS(key string, opts storage.SASOptions) (string, error) {
+	f.key, f.opts = key, opts
+	return "sv=2023-11-03&sig=abc", nil
+}
+
+func TestAzureSignURL(t *testing.T) {
+	sas := &fakeSAS{}
+	signer, err := NewAzure("https://uploads.azureedge.net/uploads/", sas)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := signer.SignURL("0123", Options{Expires: time.Now().Add(time.Hour), CacheControl: "no-store", Filename: "a b.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signed != "https://uploads.azureedge.net/uploads/0123?sv=2023-11-03&sig=abc" {
+		t.Fatalf("unexpected URL %s", signed)
+	}
+	if sas.key != "0123" || sas.opts.CacheControl != "no-store" || sas.opts.ContentDisposition != `attachment; filename="a b.txt"` {
+		t.Fatalf("unexpected SAS options %+v", sas.opts)
+	}
+}
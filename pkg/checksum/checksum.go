@@ -0,0 +1,114 @@
+// Package checksum implements the tus checksum extension: parsing the
+// Upload-Checksum header or trailer and verifying chunks against it
+package checksum
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// Header is the request header or trailer carrying a chunk's checksum
+const Header = "Upload-Checksum"
+
+// AlgorithmHeader advertises the supported algorithms in OPTIONS responses
+const AlgorithmHeader = "Tus-Checksum-Algorithm"
+
+// StatusMismatch is the tus status code for a chunk whose checksum doesn't
+// match
+const StatusMismatch = 460
+
+// Errors returned when parsing a checksum
+var (
+	ErrMalformed            = errors.New("malformed checksum")
+	ErrUnsupportedAlgorithm = errors.New("unsupported checksum algorithm")
+)
+
+// algorithms maps the supported algorithm names to their hash constructors
+var algorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+}
+
+// Algorithms lists the supported algorithm names, as advertised to clients
+var Algorithms = []string{"md5", "sha1", "sha256"}
+
+// Checksum is an expected digest of a chunk
+type Checksum struct {
+	Algorithm string
+	Sum       []byte
+}
+
+// Parse parses a checksum in the form `<algorithm> <base64 digest>`
+func Parse(value string) (Checksum, error) {
+	algorithm, encoded, ok := strings.Cut(strings.TrimSpace(value), " ")
+	if !ok {
+		return Checksum{}, fmt.Errorf("%w: expected algorithm and digest", ErrMalformed)
+	}
+	algorithm = strings.ToLower(algorithm)
+
+	newHash, ok := algorithms[algorithm]
+	if !ok {
+		return Checksum{}, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, algorithm)
+	}
+
+	sum, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(sum) != newHash().Size() {
+		return Checksum{}, fmt.Errorf("%w: invalid %s digest", ErrMalformed, algorithm)
+	}
+	return Checksum{Algorithm: algorithm, Sum: sum}, nil
+}
+
+// String formats the checksum as it is sent in headers
+func (c Checksum) String() string {
+	return c.Algorithm + " " + base64.StdEncoding.EncodeToString(c.Sum)
+}
+
+// Hasher hashes a chunk with one or all supported algorithms, for checksums
+// that are only known once the chunk has been read from a trailer
+type Hasher struct {
+	hashes map[string]hash.Hash
+}
+
+// NewHasher hashes with the given algorithm, or with all supported
+// algorithms if it is empty
+func NewHasher(algorithm string) (*Hasher, error) {
+	h := &Hasher{hashes: make(map[string]hash.Hash)}
+	if algorithm == "" {
+		for name, newHash := range algorithms {
+			h.hashes[name] = newHash()
+		}
+		return h, nil
+	}
+
+	newHash, ok := algorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, algorithm)
+	}
+	h.hashes[algorithm] = newHash()
+	return h, nil
+}
+
+// Write implements io.Writer
+func (h *Hasher) Write(p []byte) (int, error) {
+	for _, hash := range h.hashes {
+		hash.Write(p)
+	}
+	return len(p), nil
+}
+
+// Verify reports whether the hashed data matches the checksum
+func (h *Hasher) Verify(expected Checksum) (bool, error) {
+	hash, ok := h.hashes[expected.Algorithm]
+	if !ok {
+		return false, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, expected.Algorithm)
+	}
+	return subtle.ConstantTimeCompare(hash.Sum(nil), expected.Sum) == 1, nil
+}
@@ -0,0 +1,61 @@
+package checksum
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	sum := sha1.Sum([]byte("hello"))
+	value := "sha1 " + base64.StdEncoding.EncodeToString(sum[:])
+
+	parsed, err := Parse(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Algorithm != "sha1" || parsed.String() != value {
+		t.Fatalf("unexpected checksum %+v", parsed)
+	}
+
+	invalid := map[string]error{
+		"sha1":                          ErrMalformed,
+		"sha1 not-base64!":              ErrMalformed,
+		"sha1 aGVsbG8=":                 ErrMalformed,
+		"crc32 " + value[len("sha1 "):]: ErrUnsupportedAlgorithm,
+	}
+	for value, want := range invalid {
+		if _, err := Parse(value); !errors.Is(err, want) {
+			t.Errorf("Parse(%q) error = %v, want %v", value, err, want)
+		}
+	}
+}
+
+func TestHasherVerify(t *testing.T) {
+	sum := sha1.Sum([]byte("hello"))
+	expected := Checksum{Algorithm: "sha1", Sum: sum[:]}
+
+	// Without a known algorithm all are computed, as for trailers
+	for _, algorithm := range []string{"sha1", ""} {
+		hasher, err := NewHasher(algorithm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(hasher, strings.NewReader("hello"))
+		if ok, err := hasher.Verify(expected); err != nil || !ok {
+			t.Fatalf("NewHasher(%q): Verify = %v, %v", algorithm, ok, err)
+		}
+	}
+
+	hasher, _ := NewHasher("sha1")
+	io.Copy(hasher, strings.NewReader("hellO"))
+	if ok, _ := hasher.Verify(expected); ok {
+		t.Fatal("expected a mismatch")
+	}
+	if _, err := hasher.Verify(Checksum{Algorithm: "md5"}); !errors.Is(err, ErrUnsupportedAlgorithm) {
+		t.Fatalf("expected ErrUnsupportedAlgorithm, got %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+// Package chunkadvice recommends a chunk size to each upload from the
+// throughput its client reached on earlier chunks, so fast clients send
+// fewer, larger requests and slow clients don't run into timeouts.
+package chunkadvice
+
+import (
+	"sync"
+	"time"
+)
+
+// Header is the response header carrying the chunk size advised to an
+// upload's client
+const Header = "Upload-Chunk-Size-Hint"
+
+// DefaultSampleChunks is how many chunks are measured before a size is
+// advised unless configured
+const DefaultSampleChunks = 2
+
+// MinSampleSize is the smallest chunk whose throughput is measured, as
+// request overhead dominates the transfer time of smaller ones
+const MinSampleSize = 256 << 10
+
+// retention is how long an upload is remembered after its last chunk
+const retention = 24 * time.Hour
+
+// smoothing is the weight of the latest chunk in the measured throughput
+const smoothing = 0.5
+
+// Limits bound the advised chunk sizes. Zero fields don't limit.
+type Limits struct {
+	Min      int64
+	Max      int64
+	Multiple int64 // Advised sizes are rounded down to a multiple, e.g. the S3 part size
+}
+
+// entry is the measured throughput of an upload
+type entry struct {
+	samples    int
+	throughput float64 // bytes per second
+	seen       time.Time
+}
+
+// Advisor measures the throughput of uploads in memory and advises each
+// the chunk size its client can send within the target duration
+type Advisor struct {
+	target  time.Duration
+	samples int
+	limits  Limits
+
+	mu        sync.Mutex
+	uploads   map[string]*entry
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+// NewAdvisor creates an advisor aiming for chunks that take the target
+// duration, advising once samples chunks were measured
+func NewAdvisor(target time.Duration, samples int, limits Limits) *Advisor {
+	if samples <= 0 {
+		samples = DefaultSampleChunks
+	}
+	return &Advisor{
+		target:  target,
+		samples: samples,
+		limits:  limits,
+		uploads: make(map[string]*entry),
+		now:     time.Now,
+	}
+}
+
+// Observe records that a chunk of an upload was received in the given
+// time. Chunks smaller than MinSampleSize are ignored.
+func (a *Advisor) Observe(id string, size int64, elapsed time.Duration) {
+	if size < MinSampleSize || elapsed <= 0 {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.now()
+	a.prune(now)
+
+	e, ok := a.uploads[id]
+	if !ok {
+		e = &entry{}
+		a.uploads[id] = e
+	}
+	throughput := float64(size) / elapsed.Seconds()
+	if e.samples == 0 {
+		e.throughput = throughput
+	} else {
+		e.throughput = smoothing*throughput + (1-smoothing)*e.throughput
+	}
+	e.samples++
+	e.seen = now
+}
+
+// Advise returns the chunk size advised to an upload, once enough chunks
+// were measured
+func (a *Advisor) Advise(id string) (int64, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	e, ok := a.uploads[id]
+	if !ok || e.samples < a.samples {
+		return 0, false
+	}
+
+	size := int64(e.throughput * a.target.Seconds())
+	if a.limits.Multiple > 0 {
+		size -= size % a.limits.Multiple
+	}
+	size = max(size, a.limits.Min, 1)
+	if a.limits.Max > 0 {
+		size = min(size, a.limits.Max)
+	}
+	return size, true
+}
+
+// Forget drops the measurements of an upload
+func (a *Advisor) Forget(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.uploads, id)
+}
+
+// prune drops uploads not seen for the retention period at most once a
+// minute. Callers must hold mu.
+func (a *Advisor) prune(now time.Time) {
+	if now.Sub(a.lastPrune) < time.Minute {
+		return
+	}
+	a.lastPrune = now
+
+	for id, e := range a.uploads {
+		if now.Sub(e.seen) > retention {
+			delete(a.uploads, id)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package chunkadvice
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdvisorAdaptsToThroughput(t *testing.T) {
+	advisor := NewAdvisor(10*time.Second, 2, Limits{Min: 5 << 20, Max: 100 << 20, Multiple: 5 << 20})
+
+	// 1 MiB/s, advised after the second chunk
+	advisor.Observe("slow", 4<<20, 4*time.Second)
+	if _, ok := advisor.Advise("slow"); ok {
+		t.Fatal("expected no advice after one chunk")
+	}
+	advisor.Observe("slow", 2<<20, 2*time.Second)
+	if size, ok := advisor.Advise("slow"); !ok || size != 10<<20 {
+		t.Fatalf("expected 10 MiB, got %d %v", size, ok)
+	}
+
+	// Small chunks are not measured
+	advisor.Observe("slow", 1<<10, time.Hour)
+	if size, _ := advisor.Advise("slow"); size != 10<<20 {
+		t.Fatalf("expected small chunk to be ignored, got %d", size)
+	}
+
+	// Throughput changes are smoothed: 1 MiB/s and 3 MiB/s average to 2 MiB/s
+	advisor.Observe("slow", 3<<20, time.Second)
+	if size, _ := advisor.Advise("slow"); size != 20<<20 {
+		t.Fatalf("expected 20 MiB, got %d", size)
+	}
+
+	// Sizes are rounded to the multiple and kept within the limits
+	advisor.Observe("fast", 64<<20, time.Second)
+	advisor.Observe("fast", 64<<20, time.Second)
+	if size, _ := advisor.Advise("fast"); size != 100<<20 {
+		t.Fatalf("expected the maximum, got %d", size)
+	}
+	advisor.Observe("crawl", 1<<20, 10*time.Second)
+	advisor.Observe("crawl", 1<<20, 10*time.Second)
+	if size, _ := advisor.Advise("crawl"); size != 5<<20 {
+		t.Fatalf("expected the minimum, got %d", size)
+	}
+	advisor.Observe("odd", 7<<20, 10*time.Second)
+	advisor.Observe("odd", 7<<20, 10*time.Second)
+	if size, _ := advisor.Advise("odd"); size != 5<<20 {
+		t.Fatalf("expected 7 MiB rounded down to 5 MiB, got %d", size)
+	}
+
+	advisor.Forget("slow")
+	if _, ok := advisor.Advise("slow"); ok {
+		t.Fatal("expected forgotten upload to have no advice")
+	}
+}
+
+func TestAdvisorForgetsIdleUploads(t *testing.T) {
+	advisor := NewAdvisor(time.Second, 1, Limits{})
+	now := time.Now()
+	advisor.now = func() time.Time { return now }
+
+	advisor.Observe("idle", 1<<20, time.Second)
+	now = now.Add(retention + time.Minute)
+	advisor.Observe("active", 1<<20, time.Second)
+
+	if _, ok := advisor.Advise("idle"); ok {
+		t.Fatal("expected idle upload to be pruned")
+	}
+	if size, ok := advisor.Advise("active"); !ok || size != 1<<20 {
+		t.Fatalf("expected 1 MiB for active upload, got %d %v", size, ok)
+	}
+}
@@ -3,10 +3,14 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -19,12 +23,69 @@ const (
 	EnvPrefix         = "APP_"
 )
 
+// DefaultContentSecurityPolicy allows the demo page's inline script and the
+// tus-js-client it loads from jsDelivr, and nothing else from other origins
+const DefaultContentSecurityPolicy = "default-src 'self'; script-src 'self' 'unsafe-inline' https://cdn.jsdelivr.net; " +
+	"style-src 'self' 'unsafe-inline'; connect-src 'self'; frame-ancestors 'none'"
+
 // Config represents the application configuration structure
 type Config struct {
-	App     AppConfig     `yaml:"app"`
-	Storage StorageConfig `yaml:"storage"`
-	Logging LoggingConfig `yaml:"logging"`
-	CORS    CORSConfig    `yaml:"cors"`
+	App         AppConfig         `yaml:"app"`
+	Storage     StorageConfig     `yaml:"storage"`
+	Logging     LoggingConfig     `yaml:"logging"`
+	CORS        CORSConfig        `yaml:"cors"`
+	Callbacks   CallbackConfig    `yaml:"callbacks"`
+	DeadLetters DeadLetterConfig  `yaml:"deadLetters"`
+	Admin       AdminConfig       `yaml:"admin"`
+	Auth        AuthConfig        `yaml:"auth"`
+	Claims      ClaimsConfig      `yaml:"claims"`
+	Diagnostics DiagnosticsConfig `yaml:"diagnostics"`
+	Policy      PolicyConfig      `yaml:"policy"`
+	Rejections  RejectionConfig   `yaml:"rejections"`
+	Downloads   DownloadConfig    `yaml:"downloads"`
+	Demo        DemoConfig        `yaml:"demo"`
+	SignedURLs  SignedURLConfig   `yaml:"signedUrls"`
+	Schemas     SchemaConfig      `yaml:"metadataSchemas"`
+	States      StateConfig       `yaml:"states"`
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+	Metrics     MetricsConfig     `yaml:"metrics"`
+	Catalog     CatalogConfig     `yaml:"catalog"`
+	Content     ContentConfig     `yaml:"contentAddressing"`
+	CDN         CDNConfig         `yaml:"cdn"`
+	Intakes     IntakeConfig      `yaml:"intakes"`
+	Faults      FaultConfig       `yaml:"faultInjection"`
+	Checksums   ChecksumConfig    `yaml:"checksums"`
+	Headers     HeaderConfig      `yaml:"headers"`
+	Middleware  MiddlewareConfig  `yaml:"middleware"`
+	EventLog    EventLogConfig    `yaml:"eventLog"`
+	UploadIDs   UploadIDConfig    `yaml:"uploadIds"`
+	Milestones  MilestoneConfig   `yaml:"progressMilestones"`
+	Schedule    ScheduleConfig    `yaml:"schedule"`
+	UploadHints UploadHintsConfig `yaml:"uploadHints"`
+	Journal     JournalConfig     `yaml:"journal"`
+	APIKeys     APIKeysConfig     `yaml:"apiKeys"`
+	Shares      SharesConfig      `yaml:"shares"`
+	Antivirus   AntivirusConfig   `yaml:"antivirus"`
+	BanList     BanListConfig     `yaml:"banList"`
+	Origins     OriginConfig      `yaml:"origins"`
+	Stamps      StampConfig       `yaml:"stamps"`
+	Costs       CostConfig        `yaml:"costs"`
+	Reports     ReportConfig      `yaml:"reports"`
+	Termination TerminationConfig `yaml:"termination"`
+	Traffic     TrafficConfig     `yaml:"traffic"`
+	Review      ReviewConfig      `yaml:"review"`
+	TLS         TLSConfig         `yaml:"tls"`
+	Readiness   ReadinessConfig   `yaml:"readiness"`
+	TusdHooks   TusdHooksConfig   `yaml:"tusdHooks"`
+	Tenants     TenantConfig      `yaml:"tenants"`
+	Exports     ExportConfig      `yaml:"exports"`
+	Features    FeatureConfig     `yaml:"features"`
+
+	Reservations ReservationConfig `yaml:"reservations"`
+	DeltaUploads DeltaConfig       `yaml:"deltaUploads"`
+	Batches      BatchConfig       `yaml:"batches"`
+	RateLimit    RateLimitConfig   `yaml:"rateLimit"`
+	ContentTypes ContentTypeConfig `yaml:"contentTypes"`
 }
 
 // AppConfig contains general application settings
@@ -33,7 +94,54 @@ type AppConfig struct {
 	Environment string `yaml:"environment"`
 	Port        int    `yaml:"port"`
 	Debug       bool   `yaml:"debug"`
-	Timeout     int    `yaml:"timeout"`
+
+	// Timeout is how long a request body may stall before its connection is
+	// closed, in seconds
+	Timeout int `yaml:"timeout"`
+
+	// ShutdownTimeout bounds draining requests and running stop hooks, in
+	// seconds
+	ShutdownTimeout int `yaml:"shutdownTimeout"`
+}
+
+// TLSConfig contains settings for serving HTTPS natively instead of behind
+// a proxy terminating TLS
+type TLSConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	CertFile     string   `yaml:"certFile"`
+	KeyFile      string   `yaml:"keyFile"`
+	MinVersion   string   `yaml:"minVersion"`   // 1.2 or 1.3
+	CipherSuites []string `yaml:"cipherSuites"` // TLS 1.2 suites by IANA name, empty uses Go's defaults
+	ClientAuth   string   `yaml:"clientAuth"`   // none, request, require, verify_if_given, require_and_verify
+	ClientCAFile string   `yaml:"clientCaFile"` // PEM bundle client certificates are verified against
+}
+
+// ReadinessConfig contains settings for the /readyz endpoint
+type ReadinessConfig struct {
+	Timeout  int      `yaml:"timeout"`  // seconds each check may take
+	Required []string `yaml:"required"` // Checks that take the server out of rotation when failing, besides storage
+}
+
+// TusdHooksConfig contains settings for invoking hooks written for tusd's
+// file, gRPC or plugin hook systems
+type TusdHooksConfig struct {
+	Type    string         `yaml:"type"`    // file, grpc or plugin; empty disables the hooks
+	Enabled []string       `yaml:"enabled"` // Hook types invoked, e.g. pre-create or post-finish
+	Dir     string         `yaml:"dir"`     // file: directory of executables named after the hook types
+	Plugin  string         `yaml:"plugin"`  // plugin: path of the plugin executable
+	GRPC    GRPCHookConfig `yaml:"grpc"`
+}
+
+// GRPCHookConfig contains settings for invoking hooks on a gRPC endpoint
+type GRPCHookConfig struct {
+	Endpoint       string   `yaml:"endpoint"`       // host:port of the hook service
+	MaxRetries     int      `yaml:"maxRetries"`     // retries of failed invocations
+	Backoff        int      `yaml:"backoff"`        // seconds between retries
+	Secure         bool     `yaml:"secure"`         // Connect with TLS
+	ServerCertFile string   `yaml:"serverCertFile"` // PEM certificate the hook service is verified against
+	ClientCertFile string   `yaml:"clientCertFile"` // Client certificate for mutual TLS
+	ClientKeyFile  string   `yaml:"clientKeyFile"`
+	ForwardHeaders []string `yaml:"forwardHeaders"` // Request headers passed as gRPC metadata
 }
 
 // StorageConfig contains settings for various storage backends
@@ -43,6 +151,54 @@ type StorageConfig struct {
 	S3    S3Storage    `yaml:"s3"`
 	Azure AzureStorage `yaml:"azure"`
 	Minio MinioStorage `yaml:"minio"`
+
+	// StorageClass selects the storage class or access tier of new uploads
+	StorageClass StorageClassConfig `yaml:"storageClass"`
+
+	// Tiering moves completed uploads to cheaper storage classes
+	Tiering TieringConfig `yaml:"tiering"`
+
+	// Throttling sets the delay clients are asked to retry after when the
+	// backend throttles requests
+	Throttling ThrottlingConfig `yaml:"throttling"`
+}
+
+// ThrottlingConfig sets the Retry-After delays used when the storage backend
+// refuses a request without saying how long to wait
+type ThrottlingConfig struct {
+	RetryAfter      int `yaml:"retryAfter"`      // seconds, when rate limited
+	QuotaRetryAfter int `yaml:"quotaRetryAfter"` // seconds, when out of space
+}
+
+// StorageClassConfig configures per-upload storage class selection
+type StorageClassConfig struct {
+	Default             string             `yaml:"default"`
+	AllowClientOverride bool               `yaml:"allowClientOverride"`
+	Rules               []StorageClassRule `yaml:"rules"`
+}
+
+// StorageClassRule selects a storage class for uploads of at least MinSize bytes
+type StorageClassRule struct {
+	MinSize int64  `yaml:"minSize"`
+	Class   string `yaml:"class"`
+}
+
+// TieringConfig contains settings for moving completed uploads to another
+// storage class or access tier
+type TieringConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Dir      string        `yaml:"dir"`      // Empty keeps scheduled transitions in memory only
+	Interval int           `yaml:"interval"` // seconds between runs of due transitions
+	Rules    []TieringRule `yaml:"rules"`
+}
+
+// TieringRule moves completed uploads matching it to a storage class once
+// they are old enough. The first matching rule wins.
+type TieringRule struct {
+	Class    string            `yaml:"class"`
+	MinAge   int               `yaml:"minAge"`   // seconds since the upload completed
+	MinSize  int64             `yaml:"minSize"`  // bytes
+	Metadata map[string]string `yaml:"metadata"` // Upload metadata that must match, * matches any value
 }
 
 // LocalStorage configuration
@@ -58,6 +214,10 @@ type S3Storage struct {
 	AccessKey string `yaml:"accessKey"`
 	SecretKey string `yaml:"secretKey"`
 	Endpoint  string `yaml:"endpoint"`
+
+	// SSEKMSKeyID encrypts the objects of S3 and MinIO backends with this
+	// KMS key, and fails uploads S3 doesn't report encrypted with it
+	SSEKMSKeyID string `yaml:"sseKmsKeyId"`
 }
 
 // AzureStorage configuration
@@ -80,14 +240,530 @@ type MinioStorage struct {
 type LoggingConfig struct {
 	Level  string `yaml:"level"`
 	Format string `yaml:"format"`
+
+	// Redact hides request details from the request log beyond the
+	// Authorization header and URL tokens, which are always hidden
+	Redact []RedactionRule `yaml:"redact"`
+}
+
+// RedactionRule hides headers, Upload-Metadata values and query parameters
+// from the request log for requests matching all of its conditions. Empty
+// conditions match every request.
+type RedactionRule struct {
+	Path    string   `yaml:"path"`    // Path prefix, e.g. /files/
+	Tenants []string `yaml:"tenants"` // Tenants of the user or upload
+	Roles   []string `yaml:"roles"`   // Roles of the user
+
+	Headers  []string `yaml:"headers"`
+	Metadata []string `yaml:"metadata"` // Upload-Metadata keys, "*" for all
+	Query    []string `yaml:"query"`
 }
 
-// CORSConfig contains CORS settings
+// CORSConfig contains the CORS settings of the API and tus endpoints
 type CORSConfig struct {
-	AllowedOrigins []string `yaml:"allowedOrigins"`
-	AllowedMethods []string `yaml:"allowedMethods"`
-	AllowedHeaders []string `yaml:"allowedHeaders"`
-	MaxAge         int      `yaml:"maxAge"`
+	AllowedOrigins   []string `yaml:"allowedOrigins"` // "*", exact origins or wildcards like https://*.example.com
+	AllowedMethods   []string `yaml:"allowedMethods"` // Added to the methods the endpoints need
+	AllowedHeaders   []string `yaml:"allowedHeaders"` // Added to the request headers the endpoints need
+	ExposedHeaders   []string `yaml:"exposedHeaders"` // Added to the response headers the endpoints expose
+	AllowCredentials bool     `yaml:"allowCredentials"`
+	MaxAge           int      `yaml:"maxAge"` // seconds preflight responses are cached
+}
+
+// CallbackConfig contains settings for per-upload completion callbacks
+type CallbackConfig struct {
+	Enabled      bool                  `yaml:"enabled"`
+	AllowedHosts []string              `yaml:"allowedHosts"`
+	Timeout      int                   `yaml:"timeout"` // seconds
+	MaxRetries   int                   `yaml:"maxRetries"`
+	Signing      CallbackSigningConfig `yaml:"signing"`
+}
+
+// CallbackSigningConfig contains the key callback payloads are signed with
+type CallbackSigningConfig struct {
+	KeyFile string `yaml:"keyFile"` // PEM encoded PKCS #8 Ed25519 or P-256 key, empty leaves payloads unsigned
+	KeyID   string `yaml:"keyId"`   // Empty uses the key's JWK thumbprint
+}
+
+// DeadLetterConfig contains settings for the dead-letter queue of failed
+// event deliveries
+type DeadLetterConfig struct {
+	Dir string `yaml:"dir"` // Empty keeps dead letters in memory only
+}
+
+// AdminConfig contains settings for the operator API
+type AdminConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Token   string `yaml:"token"`
+}
+
+// AuthConfig contains settings for authenticating upload requests
+type AuthConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	JWTSecret string `yaml:"jwtSecret"`
+
+	// PolicyEngine evaluates policies on every upload operation after the
+	// built-in ownership rules: opa, or empty for the built-in rules only
+	PolicyEngine string    `yaml:"policyEngine"`
+	OPA          OPAConfig `yaml:"opa"`
+}
+
+// OPAConfig contains settings for querying policy decisions from an Open
+// Policy Agent server
+type OPAConfig struct {
+	URL     string `yaml:"url"`     // Decision in OPA's data API, e.g. http://opa:8181/v1/data/uploads/allow
+	Timeout int    `yaml:"timeout"` // seconds per decision
+}
+
+// APIKeysConfig contains settings for the API keys tenant admins issue to
+// their integrations. It requires authentication to be enabled.
+type APIKeysConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	Dir           string `yaml:"dir"`           // Empty keeps keys in memory only
+	RotationGrace int    `yaml:"rotationGrace"` // seconds the old secret keeps working after a rotation
+}
+
+// SharesConfig contains settings for the public links owners create to
+// share completed uploads. It requires authentication to be enabled.
+type SharesConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Dir     string `yaml:"dir"`    // Empty keeps links in memory only
+	TTL     int    `yaml:"ttl"`    // seconds links stay valid unless they set an expiry
+	MaxTTL  int    `yaml:"maxTtl"` // seconds links may stay valid at most, 0 for no limit
+}
+
+// ReservationConfig contains settings for the upload capacity tenants
+// reserve ahead of bulk ingests. It requires authentication to be enabled.
+type ReservationConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Dir      string `yaml:"dir"`      // Empty keeps reservations in memory only
+	Capacity int64  `yaml:"capacity"` // bytes overlapping reservations may reserve in total, 0 for no limit
+}
+
+// DeltaConfig contains settings for uploads of changed files that only send
+// the blocks that differ from a previous upload
+type DeltaConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Dir     string `yaml:"dir"` // Empty keeps delta plans in memory only
+	TTL     int    `yaml:"ttl"` // seconds a plan waits for an upload to be created with it
+}
+
+// BatchConfig contains settings for batches of uploads that complete
+// together
+type BatchConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Dir     string `yaml:"dir"` // Empty keeps batches in memory only
+}
+
+// RateLimitConfig contains the limits of upload requests. Zero disables a
+// limit.
+type RateLimitConfig struct {
+	RequestsPerSecond    float64 `yaml:"requestsPerSecond"`    // per client, refilling its token bucket
+	Burst                int     `yaml:"burst"`                // requests a client may send at once
+	MaxConcurrentUploads int     `yaml:"maxConcurrentUploads"` // chunks received at the same time
+	RetryAfter           int     `yaml:"retryAfter"`           // seconds, when the concurrency limit is reached
+}
+
+// ClaimsConfig contains settings for claim links that hand an in-progress
+// upload over to another device
+type ClaimsConfig struct {
+	Secret string `yaml:"secret"` // Random per process when empty
+	TTL    int    `yaml:"ttl"`    // seconds
+}
+
+// DiagnosticsConfig contains settings for per-upload retry statistics
+type DiagnosticsConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	Dir       string `yaml:"dir"`       // Empty keeps statistics in memory only
+	Retention int    `yaml:"retention"` // seconds
+	Timeline  int    `yaml:"timeline"`  // PATCH requests kept per upload, 0 disables the timeline
+}
+
+// PolicyConfig contains limits enforced when an upload is created
+type PolicyConfig struct {
+	MaxSize      int64    `yaml:"maxSize"`      // bytes, 0 for no limit
+	AllowedTypes []string `yaml:"allowedTypes"` // MIME types such as image/*, empty allows all
+}
+
+// ScheduleConfig restricts when uploads may be created
+type ScheduleConfig struct {
+	// Rules are evaluated in order, the first rule matching an upload decides
+	Rules []ScheduleRule `yaml:"rules"`
+}
+
+// ScheduleRule restricts uploads of some tenants and sizes to windows and
+// excludes blackout periods
+type ScheduleRule struct {
+	Tenants   []string         `yaml:"tenants"`   // Empty applies to all tenants
+	MinSize   int64            `yaml:"minSize"`   // bytes, 0 applies to all uploads
+	Timezone  string           `yaml:"timezone"`  // IANA name such as 'Europe/Berlin', UTC when empty
+	Windows   []ScheduleWindow `yaml:"windows"`   // Empty accepts uploads at any time outside blackouts
+	Blackouts []BlackoutPeriod `yaml:"blackouts"` // One-off periods without uploads
+	Action    string           `yaml:"action"`    // reject or queue
+}
+
+// ScheduleWindow is a recurring period uploads are accepted in
+type ScheduleWindow struct {
+	Days  []string `yaml:"days"`  // mon, tue, ...; empty for every day
+	Start string   `yaml:"start"` // HH:MM
+	End   string   `yaml:"end"`   // HH:MM, at or before start for windows spanning midnight
+}
+
+// BlackoutPeriod is a one-off period without uploads
+type BlackoutPeriod struct {
+	From   string `yaml:"from"` // RFC 3339
+	To     string `yaml:"to"`   // RFC 3339
+	Reason string `yaml:"reason"`
+}
+
+// UploadHintsConfig tunes the chunk size and parallelism recommended to
+// clients by GET /api/upload-hints
+type UploadHintsConfig struct {
+	ChunkSize      int64 `yaml:"chunkSize"`      // bytes, 0 uses the storage backend's preferred size
+	MaxParallelism int   `yaml:"maxParallelism"` // Parallel uploads per file recommended when idle
+	Capacity       int   `yaml:"capacity"`       // Concurrent chunk writes at full load, 0 ignores load
+	ChunkDuration  int   `yaml:"chunkDuration"`  // seconds a chunk should take each client, 0 disables per-upload advice
+	SampleChunks   int   `yaml:"sampleChunks"`   // Chunks measured before a size is advised
+}
+
+// JournalConfig contains settings for the write-ahead journal of chunk
+// acknowledgements, reconciled against the storage backend after a restart
+type JournalConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Dir     string `yaml:"dir"`
+	Sync    bool   `yaml:"sync"` // Flush every acknowledgement to disk before responding
+}
+
+// AntivirusConfig contains settings for scanning completed uploads for
+// malware before they become ready
+type AntivirusConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Engine  string `yaml:"engine"` // clamd or icap
+
+	// Address is the clamd address, e.g. tcp://clamav:3310 or
+	// unix:///run/clamd.sock, or the ICAP service URL, e.g.
+	// icap://icap:1344/avscan
+	Address     string `yaml:"address"`
+	Timeout     int    `yaml:"timeout"`     // seconds per scan
+	Concurrency int    `yaml:"concurrency"` // scans run at once
+
+	// Cache remembers verdicts by content digest, so identical uploads are
+	// only scanned once
+	Cache ScanCacheConfig `yaml:"cache"`
+}
+
+// ScanCacheConfig contains settings for caching antivirus verdicts. Cached
+// verdicts are dropped when the engine's signature databases change.
+type ScanCacheConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Dir     string `yaml:"dir"` // Empty keeps verdicts in memory only
+	TTL     int    `yaml:"ttl"` // seconds a verdict is reused
+}
+
+// BanListConfig contains settings for the list of content digests whose
+// uploads are quarantined, for abuse handling
+type BanListConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Dir     string `yaml:"dir"`  // Entries added through the admin API, empty keeps them in memory only
+	File    string `yaml:"file"` // Read-only list of SHA-256 digests, one per line with an optional reason
+
+	// AlertURL receives a JSON alert for every upload matching the list
+	AlertURL string `yaml:"alertUrl"`
+}
+
+// OriginConfig contains settings for recording the address and country
+// uploads are created from
+type OriginConfig struct {
+	Enabled        bool     `yaml:"enabled"`
+	TrustedProxies []string `yaml:"trustedProxies"` // Addresses or CIDRs whose X-Forwarded-For and country headers are honored
+	CountryHeader  string   `yaml:"countryHeader"`  // e.g. CloudFront-Viewer-Country, set by a trusted proxy
+	GeoIPDatabase  string   `yaml:"geoipDatabase"`  // CSV of start address, end address and country rows, e.g. DB-IP's IP to Country Lite
+}
+
+// StampConfig contains settings for stamping downloaded PDFs and images
+// with the identity of the user they are served to
+type StampConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Template is a Go text/template rendering the stamp text from .User,
+	// .UserID, .Tenant, .UploadID, .Filename and .Time
+	Template string   `yaml:"template"`
+	Formats  []string `yaml:"formats"` // pdf, png and jpeg
+	MaxSize  int64    `yaml:"maxSize"` // bytes, larger uploads can't be downloaded
+	TempDir  string   `yaml:"tempDir"` // Stamped copies are written here, empty uses the system default
+}
+
+// RejectionConfig contains settings for rejection responses
+type RejectionConfig struct {
+	// Messages replaces the message of rejections by error code
+	Messages map[string]string `yaml:"messages"`
+}
+
+// DownloadConfig contains settings for download tokens, which grant access
+// to a single upload without an Authorization header
+type DownloadConfig struct {
+	Secret        string `yaml:"secret"`        // Random per process when empty
+	TTL           int    `yaml:"ttl"`           // seconds
+	StatsInterval int    `yaml:"statsInterval"` // seconds between writes of download counts
+	MaxBatch      int    `yaml:"maxBatch"`      // uploads a batch of download URLs may be requested for
+
+	// Replicas routes presigned download URLs to the closest replica bucket
+	Replicas ReplicaRoutingConfig `yaml:"replicas"`
+}
+
+// ReplicaRoutingConfig selects the replica region serving a download
+type ReplicaRoutingConfig struct {
+	RegionHeader  string              `yaml:"regionHeader"`  // Header clients request a region with, X-Client-Region when empty
+	CountryHeader string              `yaml:"countryHeader"` // Header carrying the client's country, e.g. CloudFront-Viewer-Country
+	Regions       map[string][]string `yaml:"regions"`       // Countries served by each region
+}
+
+// DemoConfig contains settings for the upload demo page
+type DemoConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// SignedURLConfig contains settings for signing upload URLs returned in
+// Location headers
+type SignedURLConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Secret  string `yaml:"secret"` // Random per process when empty
+	TTL     int    `yaml:"ttl"`    // seconds
+}
+
+// SchemaConfig contains the JSON Schema files upload metadata is validated
+// against at creation
+type SchemaConfig struct {
+	Default string            `yaml:"default"` // Applies to tenants without their own schema
+	Tenants map[string]string `yaml:"tenants"` // Schema file per tenant
+}
+
+// StateConfig contains settings for the per-upload state machine
+type StateConfig struct {
+	Dir string `yaml:"dir"` // Empty keeps upload states in memory only
+	// Processing keeps completed uploads in the uploaded state until a
+	// post-processor moves them on. Otherwise they become ready at once.
+	Processing bool `yaml:"processing"`
+	// ProcessingConcurrency is the number of completed uploads the built-in
+	// post-processors work on at once
+	ProcessingConcurrency int `yaml:"processingConcurrency"`
+}
+
+// ReviewConfig contains settings for holding completed uploads back until
+// an approver accepts them
+type ReviewConfig struct {
+	Enabled      bool   `yaml:"enabled"`
+	ApproverRole string `yaml:"approverRole"` // JWT role allowed to review uploads, besides admins
+}
+
+// ContentTypeConfig contains settings for detecting the content type of
+// uploads that don't declare one
+type ContentTypeConfig struct {
+	Detect bool `yaml:"detect"` // Sniff the first bytes of completed uploads without a filetype
+}
+
+// IdempotencyConfig contains settings for replaying responses to requests
+// repeating an Idempotency-Key header
+type IdempotencyConfig struct {
+	Enabled bool `yaml:"enabled"`
+	Window  int  `yaml:"window"` // seconds
+}
+
+// MetricsConfig contains settings for the Prometheus endpoint
+type MetricsConfig struct {
+	Enabled    bool `yaml:"enabled"`
+	StaleAfter int  `yaml:"staleAfter"` // seconds without progress before an upload counts as stale
+	Exemplars  bool `yaml:"exemplars"`  // attach trace IDs from traceparent headers to latency histograms
+	MaxTenants int  `yaml:"maxTenants"` // tenants labeled separately in lifecycle histograms and cost gauges, the rest are "other"
+}
+
+// CostConfig contains settings for estimating the storage costs of each
+// tenant
+type CostConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Interval int    `yaml:"interval"` // seconds between reports
+	Currency string `yaml:"currency"`
+
+	// DefaultClass is the storage class of uploads stored without one,
+	// i.e. the bucket's default
+	DefaultClass string             `yaml:"defaultClass"`
+	Prices       map[string]float64 `yaml:"prices"` // per GiB-month by storage class
+	File         string             `yaml:"file"`   // CSV file rewritten with every report, empty to skip
+}
+
+// ReportConfig contains settings for the storage health reports posted
+// to a webhook at the end of every period
+type ReportConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	URL        string `yaml:"url"`        // Webhook receiving each report, e.g. a Slack incoming webhook
+	Interval   int    `yaml:"interval"`   // seconds between reports
+	TopTenants int    `yaml:"topTenants"` // Tenants listed by uploaded bytes
+	Instance   string `yaml:"instance"`   // Names this instance in its reports, the hostname if empty
+}
+
+// TerminationConfig contains settings for keeping terminated uploads for a
+// grace period before deleting their data
+type TerminationConfig struct {
+	Enabled     bool   `yaml:"enabled"`     // Offer the tus termination extension
+	GracePeriod int    `yaml:"gracePeriod"` // seconds, 0 deletes terminated uploads at once
+	Dir         string `yaml:"dir"`         // Empty keeps pending deletions in memory only
+}
+
+// TrafficConfig contains settings for accounting the bytes each tenant and
+// user transfer
+type TrafficConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	Dir           string `yaml:"dir"`           // Empty keeps the totals in memory only
+	FlushInterval int    `yaml:"flushInterval"` // seconds between writes of the counts
+}
+
+// CatalogConfig contains settings for upload tags and collections
+type CatalogConfig struct {
+	Dir string `yaml:"dir"` // Empty keeps the catalog in memory only
+}
+
+// ContentConfig contains settings for content-addressable storage, which
+// stores finished uploads under sha256/<digest> keys
+type ContentConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Dir     string `yaml:"dir"` // Reference table directory, empty keeps it in memory only
+}
+
+// CDNConfig contains settings for signed download URLs served through a
+// CDN in front of the storage bucket
+type CDNConfig struct {
+	Provider       string             `yaml:"provider"` // cloudfront or azure, empty disables CDN URLs
+	BaseURL        string             `yaml:"baseUrl"`
+	KeyPairID      string             `yaml:"keyPairId"`      // CloudFront public key ID
+	PrivateKeyFile string             `yaml:"privateKeyFile"` // CloudFront PEM encoded RSA private key
+	CacheControl   CacheControlConfig `yaml:"cacheControl"`
+}
+
+// CacheControlConfig selects the Cache-Control header of CDN downloads
+type CacheControlConfig struct {
+	Default             string             `yaml:"default"`
+	AllowClientOverride bool               `yaml:"allowClientOverride"`
+	Rules               []CacheControlRule `yaml:"rules"`
+}
+
+// CacheControlRule sets the Cache-Control header for uploads of matching
+// MIME types, e.g. "video/*"
+type CacheControlRule struct {
+	Types []string `yaml:"types"`
+	Value string   `yaml:"value"`
+}
+
+// IntakeConfig contains settings for intakes, the named upload
+// configurations managed through the admin API
+type IntakeConfig struct {
+	Dir string `yaml:"dir"` // Empty keeps intakes in memory only
+}
+
+// TenantConfig contains settings for tenants, the customers managed
+// through the admin API
+type TenantConfig struct {
+	Dir               string `yaml:"dir"`               // Empty keeps tenants in memory only
+	RequireRegistered bool   `yaml:"requireRegistered"` // Refuse uploads of tenants that aren't registered
+}
+
+// ExportConfig contains settings for exports of the upload inventory that
+// run as background jobs
+type ExportConfig struct {
+	Dir       string `yaml:"dir"`       // Where exports are written, empty disables export jobs
+	Retention int    `yaml:"retention"` // seconds a finished export can be downloaded
+	MaxJobs   int    `yaml:"maxJobs"`   // export jobs running at once, 0 for no limit
+}
+
+// FeatureConfig contains the flags gating experimental subsystems
+type FeatureConfig struct {
+	Dir   string                       `yaml:"dir"` // Overrides set through the admin API, empty keeps them in memory only
+	Flags map[string]FeatureFlagConfig `yaml:"flags"`
+}
+
+// FeatureFlagConfig is the state of a flag, overridden per environment
+// (app.environment) or per tenant, the tenant taking precedence
+type FeatureFlagConfig struct {
+	Enabled      bool            `yaml:"enabled"`
+	Environments map[string]bool `yaml:"environments"`
+	Tenants      map[string]bool `yaml:"tenants"`
+}
+
+// FaultConfig contains settings for injecting storage faults, to test
+// client retries and pipeline resilience. It is refused in production.
+type FaultConfig struct {
+	Enabled          bool     `yaml:"enabled"`
+	Seed             int      `yaml:"seed"` // 0 picks a random seed, which is logged
+	ErrorRate        float64  `yaml:"errorRate"`
+	LatencyRate      float64  `yaml:"latencyRate"`
+	Latency          int      `yaml:"latency"` // maximum delay in milliseconds
+	PartialWriteRate float64  `yaml:"partialWriteRate"`
+	Operations       []string `yaml:"operations"` // Empty targets all operations
+}
+
+// ChecksumConfig contains settings for verifying chunks against the
+// Upload-Checksum header or trailer of the tus checksum extension
+type ChecksumConfig struct {
+	Enabled      bool   `yaml:"enabled"`
+	SpoolDir     string `yaml:"spoolDir"`     // Empty uses the system temp directory
+	MaxChunkSize int64  `yaml:"maxChunkSize"` // bytes spooled per chunk before verification
+}
+
+// MiddlewareConfig orders the built-in middleware of the server. An order
+// must name every built-in middleware of its chain exactly once; empty keeps
+// the default order.
+type MiddlewareConfig struct {
+	Global  []string `yaml:"global"`  // Middleware of every request
+	Uploads []string `yaml:"uploads"` // Middleware of tus requests
+}
+
+// HeaderConfig contains settings for security and custom response headers
+type HeaderConfig struct {
+	HSTS HSTSConfig `yaml:"hsts"`
+
+	// ContentTypeOptions sends X-Content-Type-Options: nosniff
+	ContentTypeOptions bool `yaml:"contentTypeOptions"`
+
+	// ContentSecurityPolicy is sent with the demo page and the admin API
+	ContentSecurityPolicy string `yaml:"contentSecurityPolicy"`
+
+	// Custom adds headers to the responses of routes by path prefix
+	Custom []RouteHeaderConfig `yaml:"custom"`
+}
+
+// HSTSConfig contains settings for the Strict-Transport-Security header
+type HSTSConfig struct {
+	Enabled           bool `yaml:"enabled"`
+	MaxAge            int  `yaml:"maxAge"` // seconds
+	IncludeSubDomains bool `yaml:"includeSubDomains"`
+	Preload           bool `yaml:"preload"`
+}
+
+// RouteHeaderConfig adds headers to responses of requests whose path starts
+// with Path
+type RouteHeaderConfig struct {
+	Path    string            `yaml:"path"`
+	Headers map[string]string `yaml:"headers"`
+}
+
+// EventLogConfig contains settings for persisting upload events so they can
+// be replayed through the admin API
+type EventLogConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	Dir       string `yaml:"dir"`       // Empty keeps events in memory only
+	Retention int    `yaml:"retention"` // seconds, 0 keeps events forever
+}
+
+// UploadIDConfig selects how upload IDs are generated
+type UploadIDConfig struct {
+	Scheme       string `yaml:"scheme"`       // random, uuidv7 or ulid
+	DatePrefix   bool   `yaml:"datePrefix"`   // Prefix IDs with the UTC creation date
+	TenantPrefix bool   `yaml:"tenantPrefix"` // Prefix IDs with the tenant even if storage is not tenant scoped
+}
+
+// MilestoneConfig contains settings for progress events at percentage
+// milestones
+type MilestoneConfig struct {
+	Enabled     bool  `yaml:"enabled"`
+	Percentages []int `yaml:"percentages"` // 25, 50, 75 and 100 when empty
 }
 
 var (
@@ -105,16 +781,12 @@ func Load(configPath string) (*Config, error) {
 			configPath = DefaultConfigPath
 		}
 
-		// Load config from YAML file
-		cfg, err := loadFromFile(configPath)
+		cfg, err := load(configPath)
 		if err != nil {
-			loadErr = fmt.Errorf("failed to load config from file: %w", err)
+			loadErr = err
 			return
 		}
 
-		// Override with environment variables
-		applyEnvironmentOverrides(cfg)
-
 		instance = cfg
 		slog.Info("configuration loaded successfully",
 			"path", configPath,
@@ -128,6 +800,208 @@ func Load(configPath string) (*Config, error) {
 	return instance, nil
 }
 
+// Read reads the configuration like Load, but from the file each time and
+// without replacing the configuration Load returns, e.g. to pick up
+// settings that can change while the server runs
+func Read(configPath string) (*Config, error) {
+	if configPath == "" {
+		configPath = DefaultConfigPath
+	}
+	return load(configPath)
+}
+
+// load reads the configuration file and applies environment variable
+// overrides. A missing file is not an error: the configuration then starts
+// from Defaults, so deployments can be configured from environment alone.
+func load(path string) (*Config, error) {
+	cfg, err := loadFromFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		slog.Info("config file not found, using defaults and environment variables", "path", path)
+		cfg = Defaults()
+	case err != nil:
+		return nil, fmt.Errorf("failed to load config from file: %w", err)
+	}
+
+	// Override with environment variables
+	applyEnvironmentOverrides(cfg)
+
+	return cfg, nil
+}
+
+// Defaults returns the configuration used when no config file is present
+func Defaults() *Config {
+	return &Config{
+		App: AppConfig{
+			Name:            "large-file-uploads",
+			Environment:     "production",
+			Port:            8080,
+			Timeout:         60,
+			ShutdownTimeout: 30,
+		},
+		Storage: StorageConfig{
+			Type: "minio",
+			Azure: AzureStorage{
+				ContainerName: "uploads",
+			},
+			Minio: MinioStorage{
+				Endpoint: "localhost:9000",
+				Bucket:   "uploads",
+			},
+			Throttling: ThrottlingConfig{
+				RetryAfter:      5,
+				QuotaRetryAfter: 300,
+			},
+			Tiering: TieringConfig{
+				Dir:      "./data/tiering",
+				Interval: 300,
+			},
+		},
+		Logging: LoggingConfig{
+			Level:  "info",
+			Format: "text",
+		},
+		CORS: CORSConfig{
+			AllowedOrigins: []string{"*"},
+			MaxAge:         43200,
+		},
+		Claims: ClaimsConfig{
+			TTL: 900,
+		},
+		Diagnostics: DiagnosticsConfig{
+			Enabled:   true,
+			Dir:       "./data/diagnostics",
+			Retention: 86400,
+		},
+		Checksums: ChecksumConfig{
+			Enabled:      true,
+			MaxChunkSize: 1 << 30,
+		},
+		Headers: HeaderConfig{
+			HSTS: HSTSConfig{
+				MaxAge: 31536000,
+			},
+			ContentTypeOptions:    true,
+			ContentSecurityPolicy: DefaultContentSecurityPolicy,
+		},
+		Downloads: DownloadConfig{
+			TTL:           300,
+			StatsInterval: 30,
+			MaxBatch:      100,
+		},
+		SignedURLs: SignedURLConfig{
+			TTL: 86400,
+		},
+		Idempotency: IdempotencyConfig{
+			Enabled: true,
+			Window:  86400,
+		},
+		Metrics: MetricsConfig{
+			StaleAfter: 86400,
+		},
+		UploadHints: UploadHintsConfig{
+			MaxParallelism: 4,
+			SampleChunks:   2,
+		},
+		Journal: JournalConfig{
+			Dir:  "./data/journal",
+			Sync: true,
+		},
+		APIKeys: APIKeysConfig{
+			Dir:           "./data/apikeys",
+			RotationGrace: 86400,
+		},
+		Shares: SharesConfig{
+			Dir:    "./data/shares",
+			TTL:    604800,
+			MaxTTL: 2592000,
+		},
+		Reservations: ReservationConfig{
+			Dir: "./data/reservations",
+		},
+		DeltaUploads: DeltaConfig{
+			Dir: "./data/delta",
+			TTL: 86400,
+		},
+		Batches: BatchConfig{
+			Dir: "./data/batches",
+		},
+		Exports: ExportConfig{
+			Dir:       "./data/exports",
+			Retention: 86400,
+			MaxJobs:   2,
+		},
+		Features: FeatureConfig{
+			Dir: "./data/features",
+		},
+		Auth: AuthConfig{
+			OPA: OPAConfig{
+				Timeout: 2,
+			},
+		},
+		RateLimit: RateLimitConfig{
+			Burst:      20,
+			RetryAfter: 2,
+		},
+		States: StateConfig{
+			ProcessingConcurrency: 4,
+		},
+		BanList: BanListConfig{
+			Dir: "./data/banlist",
+		},
+		Antivirus: AntivirusConfig{
+			Engine:      "clamd",
+			Timeout:     600,
+			Concurrency: 2,
+			Cache: ScanCacheConfig{
+				TTL: 7 * 24 * 3600,
+			},
+		},
+		Stamps: StampConfig{
+			Formats: []string{"pdf", "png", "jpeg"},
+			MaxSize: 512 << 20,
+		},
+		Costs: CostConfig{
+			Interval:     3600,
+			Currency:     "USD",
+			DefaultClass: "STANDARD",
+		},
+		Reports: ReportConfig{
+			Interval:   24 * 3600,
+			TopTenants: 5,
+		},
+		Termination: TerminationConfig{
+			Enabled: true,
+			Dir:     "./data/deletions",
+		},
+		Traffic: TrafficConfig{
+			Dir:           "./data/traffic",
+			FlushInterval: 30,
+		},
+		Review: ReviewConfig{
+			ApproverRole: "reviewer",
+		},
+		ContentTypes: ContentTypeConfig{
+			Detect: true,
+		},
+		TLS: TLSConfig{
+			MinVersion: "1.2",
+			ClientAuth: "none",
+		},
+		Readiness: ReadinessConfig{
+			Timeout: 5,
+		},
+		TusdHooks: TusdHooksConfig{
+			Dir:     "./hooks",
+			Enabled: []string{"pre-create", "post-create", "post-receive", "post-terminate", "post-finish"},
+			GRPC: GRPCHookConfig{
+				MaxRetries: 5,
+				Backoff:    1,
+			},
+		},
+	}
+}
+
 // Get returns the singleton configuration instance.
 // It loads the configuration from the default path if not already loaded.
 func Get() (*Config, error) {
@@ -189,12 +1063,24 @@ func applyEnvOverride(cfg *Config, key, value string) {
 		if _, err := fmt.Sscanf(value, "%d", &port); err == nil {
 			cfg.App.Port = port
 		}
+	case key == "app_name":
+		cfg.App.Name = value
 	case key == "app_debug":
 		cfg.App.Debug = strings.ToLower(value) == "true"
 	case key == "app_environment":
 		cfg.App.Environment = value
+	case key == "app_timeout":
+		setInt(&cfg.App.Timeout, value)
+	case key == "app_shutdowntimeout":
+		setInt(&cfg.App.ShutdownTimeout, value)
 	case key == "storage_type":
 		cfg.Storage.Type = value
+	case key == "local_rootdir":
+		cfg.Storage.Local.RootDir = value
+	case key == "local_tempdir":
+		cfg.Storage.Local.TempDir = value
+	case key == "s3_endpoint":
+		cfg.Storage.S3.Endpoint = value
 	case key == "s3_accesskey":
 		cfg.Storage.S3.AccessKey = value
 	case key == "s3_secretkey":
@@ -203,6 +1089,8 @@ func applyEnvOverride(cfg *Config, key, value string) {
 		cfg.Storage.S3.Bucket = value
 	case key == "s3_region":
 		cfg.Storage.S3.Region = value
+	case key == "s3_ssekmskeyid":
+		cfg.Storage.S3.SSEKMSKeyID = value
 	case key == "azure_accountkey":
 		cfg.Storage.Azure.AccountKey = value
 	case key == "azure_accountname":
@@ -215,11 +1103,454 @@ func applyEnvOverride(cfg *Config, key, value string) {
 		cfg.Storage.Minio.SecretKey = value
 	case key == "minio_bucket":
 		cfg.Storage.Minio.Bucket = value
+	case key == "minio_endpoint":
+		cfg.Storage.Minio.Endpoint = value
+	case key == "minio_ssl":
+		cfg.Storage.Minio.SSL = strings.ToLower(value) == "true"
+	case key == "throttling_retryafter":
+		setInt(&cfg.Storage.Throttling.RetryAfter, value)
+	case key == "throttling_quotaretryafter":
+		setInt(&cfg.Storage.Throttling.QuotaRetryAfter, value)
+	case key == "storageclass_default":
+		cfg.Storage.StorageClass.Default = value
+	case key == "storageclass_allowclientoverride":
+		cfg.Storage.StorageClass.AllowClientOverride = strings.ToLower(value) == "true"
+	case key == "tiering_enabled":
+		cfg.Storage.Tiering.Enabled = strings.ToLower(value) == "true"
+	case key == "tiering_dir":
+		cfg.Storage.Tiering.Dir = value
+	case key == "tiering_interval":
+		setInt(&cfg.Storage.Tiering.Interval, value)
 	case key == "logging_level":
 		cfg.Logging.Level = value
+	case key == "logging_format":
+		cfg.Logging.Format = value
+	case key == "cors_allowedorigins":
+		cfg.CORS.AllowedOrigins = splitList(value)
+	case key == "cors_allowedmethods":
+		cfg.CORS.AllowedMethods = splitList(value)
+	case key == "cors_allowedheaders":
+		cfg.CORS.AllowedHeaders = splitList(value)
+	case key == "cors_exposedheaders":
+		cfg.CORS.ExposedHeaders = splitList(value)
+	case key == "cors_allowcredentials":
+		cfg.CORS.AllowCredentials = strings.ToLower(value) == "true"
+	case key == "cors_maxage":
+		setInt(&cfg.CORS.MaxAge, value)
+	case key == "callbacks_enabled":
+		cfg.Callbacks.Enabled = strings.ToLower(value) == "true"
+	case key == "callbacks_allowedhosts":
+		cfg.Callbacks.AllowedHosts = splitList(value)
+	case key == "callbacks_timeout":
+		setInt(&cfg.Callbacks.Timeout, value)
+	case key == "callbacks_maxretries":
+		setInt(&cfg.Callbacks.MaxRetries, value)
+	case key == "callbacks_signing_keyfile":
+		cfg.Callbacks.Signing.KeyFile = value
+	case key == "callbacks_signing_keyid":
+		cfg.Callbacks.Signing.KeyID = value
+	case key == "deadletters_dir":
+		cfg.DeadLetters.Dir = value
+	case key == "states_dir":
+		cfg.States.Dir = value
+	case key == "states_processing":
+		cfg.States.Processing = strings.ToLower(value) == "true"
+	case key == "states_processingconcurrency":
+		setInt(&cfg.States.ProcessingConcurrency, value)
+	case key == "idempotency_enabled":
+		cfg.Idempotency.Enabled = strings.ToLower(value) == "true"
+	case key == "idempotency_window":
+		setInt(&cfg.Idempotency.Window, value)
+	case key == "metrics_enabled":
+		cfg.Metrics.Enabled = strings.ToLower(value) == "true"
+	case key == "metrics_staleafter":
+		setInt(&cfg.Metrics.StaleAfter, value)
+	case key == "metrics_exemplars":
+		cfg.Metrics.Exemplars = strings.ToLower(value) == "true"
+	case key == "metrics_maxtenants":
+		setInt(&cfg.Metrics.MaxTenants, value)
+	case key == "catalog_dir":
+		cfg.Catalog.Dir = value
+	case key == "contentaddressing_enabled":
+		cfg.Content.Enabled = strings.ToLower(value) == "true"
+	case key == "contentaddressing_dir":
+		cfg.Content.Dir = value
+	case key == "cdn_provider":
+		cfg.CDN.Provider = value
+	case key == "cdn_baseurl":
+		cfg.CDN.BaseURL = value
+	case key == "cdn_keypairid":
+		cfg.CDN.KeyPairID = value
+	case key == "cdn_privatekeyfile":
+		cfg.CDN.PrivateKeyFile = value
+	case key == "cdn_cachecontrol_default":
+		cfg.CDN.CacheControl.Default = value
+	case key == "cdn_cachecontrol_allowclientoverride":
+		cfg.CDN.CacheControl.AllowClientOverride = strings.ToLower(value) == "true"
+	case key == "intakes_dir":
+		cfg.Intakes.Dir = value
+	case key == "tenants_dir":
+		cfg.Tenants.Dir = value
+	case key == "tenants_requireregistered":
+		cfg.Tenants.RequireRegistered = strings.ToLower(value) == "true"
+	case key == "exports_dir":
+		cfg.Exports.Dir = value
+	case key == "exports_retention":
+		setInt(&cfg.Exports.Retention, value)
+	case key == "exports_maxjobs":
+		setInt(&cfg.Exports.MaxJobs, value)
+	case key == "features_dir":
+		cfg.Features.Dir = value
+	case key == "features_enabled", key == "features_disabled":
+		// Comma-separated flags switched on or off in this environment
+		if cfg.Features.Flags == nil {
+			cfg.Features.Flags = make(map[string]FeatureFlagConfig)
+		}
+		for _, name := range splitList(value) {
+			flag := cfg.Features.Flags[name]
+			flag.Enabled = key == "features_enabled"
+			cfg.Features.Flags[name] = flag
+		}
+	case key == "faultinjection_enabled":
+		cfg.Faults.Enabled = strings.ToLower(value) == "true"
+	case key == "faultinjection_seed":
+		setInt(&cfg.Faults.Seed, value)
+	case key == "faultinjection_errorrate":
+		setFloat(&cfg.Faults.ErrorRate, value)
+	case key == "faultinjection_latencyrate":
+		setFloat(&cfg.Faults.LatencyRate, value)
+	case key == "faultinjection_latency":
+		setInt(&cfg.Faults.Latency, value)
+	case key == "faultinjection_partialwriterate":
+		setFloat(&cfg.Faults.PartialWriteRate, value)
+	case key == "faultinjection_operations":
+		cfg.Faults.Operations = splitList(value)
+	case key == "headers_hsts_enabled":
+		cfg.Headers.HSTS.Enabled = strings.ToLower(value) == "true"
+	case key == "headers_hsts_maxage":
+		setInt(&cfg.Headers.HSTS.MaxAge, value)
+	case key == "headers_hsts_includesubdomains":
+		cfg.Headers.HSTS.IncludeSubDomains = strings.ToLower(value) == "true"
+	case key == "headers_hsts_preload":
+		cfg.Headers.HSTS.Preload = strings.ToLower(value) == "true"
+	case key == "headers_contenttypeoptions":
+		cfg.Headers.ContentTypeOptions = strings.ToLower(value) == "true"
+	case key == "headers_contentsecuritypolicy":
+		cfg.Headers.ContentSecurityPolicy = value
+	case key == "middleware_global":
+		cfg.Middleware.Global = splitList(value)
+	case key == "middleware_uploads":
+		cfg.Middleware.Uploads = splitList(value)
+	case key == "uploadids_scheme":
+		cfg.UploadIDs.Scheme = value
+	case key == "uploadids_dateprefix":
+		cfg.UploadIDs.DatePrefix = strings.ToLower(value) == "true"
+	case key == "uploadids_tenantprefix":
+		cfg.UploadIDs.TenantPrefix = strings.ToLower(value) == "true"
+	case key == "milestones_enabled":
+		cfg.Milestones.Enabled = strings.ToLower(value) == "true"
+	case key == "milestones_percentages":
+		cfg.Milestones.Percentages = nil
+		for _, item := range splitList(value) {
+			var percentage int
+			setInt(&percentage, item)
+			cfg.Milestones.Percentages = append(cfg.Milestones.Percentages, percentage)
+		}
+	case key == "uploadhints_chunksize":
+		var chunkSize int64
+		if _, err := fmt.Sscanf(value, "%d", &chunkSize); err == nil {
+			cfg.UploadHints.ChunkSize = chunkSize
+		}
+	case key == "uploadhints_maxparallelism":
+		setInt(&cfg.UploadHints.MaxParallelism, value)
+	case key == "uploadhints_capacity":
+		setInt(&cfg.UploadHints.Capacity, value)
+	case key == "uploadhints_chunkduration":
+		setInt(&cfg.UploadHints.ChunkDuration, value)
+	case key == "uploadhints_samplechunks":
+		setInt(&cfg.UploadHints.SampleChunks, value)
+	case key == "banlist_enabled":
+		cfg.BanList.Enabled = strings.ToLower(value) == "true"
+	case key == "banlist_dir":
+		cfg.BanList.Dir = value
+	case key == "banlist_file":
+		cfg.BanList.File = value
+	case key == "banlist_alerturl":
+		cfg.BanList.AlertURL = value
+	case key == "origins_enabled":
+		cfg.Origins.Enabled = strings.ToLower(value) == "true"
+	case key == "origins_trustedproxies":
+		cfg.Origins.TrustedProxies = splitList(value)
+	case key == "origins_countryheader":
+		cfg.Origins.CountryHeader = value
+	case key == "origins_geoipdatabase":
+		cfg.Origins.GeoIPDatabase = value
+	case key == "antivirus_enabled":
+		cfg.Antivirus.Enabled = strings.ToLower(value) == "true"
+	case key == "antivirus_engine":
+		cfg.Antivirus.Engine = value
+	case key == "antivirus_address":
+		cfg.Antivirus.Address = value
+	case key == "antivirus_timeout":
+		setInt(&cfg.Antivirus.Timeout, value)
+	case key == "antivirus_concurrency":
+		setInt(&cfg.Antivirus.Concurrency, value)
+	case key == "antivirus_cache_enabled":
+		cfg.Antivirus.Cache.Enabled = strings.ToLower(value) == "true"
+	case key == "antivirus_cache_dir":
+		cfg.Antivirus.Cache.Dir = value
+	case key == "antivirus_cache_ttl":
+		setInt(&cfg.Antivirus.Cache.TTL, value)
+	case key == "stamps_enabled":
+		cfg.Stamps.Enabled = strings.ToLower(value) == "true"
+	case key == "stamps_template":
+		cfg.Stamps.Template = value
+	case key == "stamps_formats":
+		cfg.Stamps.Formats = splitList(value)
+	case key == "stamps_maxsize":
+		setInt64(&cfg.Stamps.MaxSize, value)
+	case key == "stamps_tempdir":
+		cfg.Stamps.TempDir = value
+	case key == "costs_enabled":
+		cfg.Costs.Enabled = strings.ToLower(value) == "true"
+	case key == "costs_interval":
+		setInt(&cfg.Costs.Interval, value)
+	case key == "costs_currency":
+		cfg.Costs.Currency = value
+	case key == "costs_defaultclass":
+		cfg.Costs.DefaultClass = value
+	case key == "costs_prices":
+		// e.g. STANDARD=0.023,GLACIER=0.0036
+		prices := make(map[string]float64)
+		for _, entry := range splitList(value) {
+			class, rawPrice, ok := strings.Cut(entry, "=")
+			if price, err := strconv.ParseFloat(strings.TrimSpace(rawPrice), 64); ok && err == nil {
+				prices[strings.TrimSpace(class)] = price
+			}
+		}
+		cfg.Costs.Prices = prices
+	case key == "costs_file":
+		cfg.Costs.File = value
+	case key == "reports_enabled":
+		cfg.Reports.Enabled = strings.ToLower(value) == "true"
+	case key == "reports_url":
+		cfg.Reports.URL = value
+	case key == "reports_interval":
+		setInt(&cfg.Reports.Interval, value)
+	case key == "reports_instance":
+		cfg.Reports.Instance = value
+	case key == "reports_toptenants":
+		setInt(&cfg.Reports.TopTenants, value)
+	case key == "termination_enabled":
+		cfg.Termination.Enabled = strings.ToLower(value) == "true"
+	case key == "termination_graceperiod":
+		setInt(&cfg.Termination.GracePeriod, value)
+	case key == "termination_dir":
+		cfg.Termination.Dir = value
+	case key == "traffic_enabled":
+		cfg.Traffic.Enabled = strings.ToLower(value) == "true"
+	case key == "traffic_dir":
+		cfg.Traffic.Dir = value
+	case key == "traffic_flushinterval":
+		setInt(&cfg.Traffic.FlushInterval, value)
+	case key == "review_enabled":
+		cfg.Review.Enabled = strings.ToLower(value) == "true"
+	case key == "review_approverrole":
+		cfg.Review.ApproverRole = value
+	case key == "contenttypes_detect":
+		cfg.ContentTypes.Detect = strings.ToLower(value) == "true"
+	case key == "tls_enabled":
+		cfg.TLS.Enabled = strings.ToLower(value) == "true"
+	case key == "tls_certfile":
+		cfg.TLS.CertFile = value
+	case key == "tls_keyfile":
+		cfg.TLS.KeyFile = value
+	case key == "tls_minversion":
+		cfg.TLS.MinVersion = value
+	case key == "tls_ciphersuites":
+		cfg.TLS.CipherSuites = splitList(value)
+	case key == "tls_clientauth":
+		cfg.TLS.ClientAuth = value
+	case key == "tls_clientcafile":
+		cfg.TLS.ClientCAFile = value
+	case key == "readiness_timeout":
+		setInt(&cfg.Readiness.Timeout, value)
+	case key == "readiness_required":
+		cfg.Readiness.Required = splitList(value)
+	case key == "tusdhooks_type":
+		cfg.TusdHooks.Type = value
+	case key == "tusdhooks_enabled":
+		cfg.TusdHooks.Enabled = splitList(value)
+	case key == "tusdhooks_dir":
+		cfg.TusdHooks.Dir = value
+	case key == "tusdhooks_plugin":
+		cfg.TusdHooks.Plugin = value
+	case key == "tusdhooks_grpc_endpoint":
+		cfg.TusdHooks.GRPC.Endpoint = value
+	case key == "tusdhooks_grpc_maxretries":
+		setInt(&cfg.TusdHooks.GRPC.MaxRetries, value)
+	case key == "tusdhooks_grpc_backoff":
+		setInt(&cfg.TusdHooks.GRPC.Backoff, value)
+	case key == "tusdhooks_grpc_secure":
+		cfg.TusdHooks.GRPC.Secure = strings.ToLower(value) == "true"
+	case key == "tusdhooks_grpc_servercertfile":
+		cfg.TusdHooks.GRPC.ServerCertFile = value
+	case key == "tusdhooks_grpc_clientcertfile":
+		cfg.TusdHooks.GRPC.ClientCertFile = value
+	case key == "tusdhooks_grpc_clientkeyfile":
+		cfg.TusdHooks.GRPC.ClientKeyFile = value
+	case key == "tusdhooks_grpc_forwardheaders":
+		cfg.TusdHooks.GRPC.ForwardHeaders = splitList(value)
+	case key == "apikeys_enabled":
+		cfg.APIKeys.Enabled = strings.ToLower(value) == "true"
+	case key == "apikeys_dir":
+		cfg.APIKeys.Dir = value
+	case key == "apikeys_rotationgrace":
+		setInt(&cfg.APIKeys.RotationGrace, value)
+	case key == "shares_enabled":
+		cfg.Shares.Enabled = strings.ToLower(value) == "true"
+	case key == "shares_dir":
+		cfg.Shares.Dir = value
+	case key == "shares_ttl":
+		setInt(&cfg.Shares.TTL, value)
+	case key == "shares_maxttl":
+		setInt(&cfg.Shares.MaxTTL, value)
+	case key == "reservations_enabled":
+		cfg.Reservations.Enabled = strings.ToLower(value) == "true"
+	case key == "reservations_dir":
+		cfg.Reservations.Dir = value
+	case key == "reservations_capacity":
+		var capacity int64
+		if _, err := fmt.Sscanf(value, "%d", &capacity); err == nil {
+			cfg.Reservations.Capacity = capacity
+		}
+	case key == "deltauploads_enabled":
+		cfg.DeltaUploads.Enabled = strings.ToLower(value) == "true"
+	case key == "deltauploads_dir":
+		cfg.DeltaUploads.Dir = value
+	case key == "deltauploads_ttl":
+		setInt(&cfg.DeltaUploads.TTL, value)
+	case key == "batches_enabled":
+		cfg.Batches.Enabled = strings.ToLower(value) == "true"
+	case key == "batches_dir":
+		cfg.Batches.Dir = value
+	case key == "ratelimit_requestspersecond":
+		setFloat(&cfg.RateLimit.RequestsPerSecond, value)
+	case key == "ratelimit_burst":
+		setInt(&cfg.RateLimit.Burst, value)
+	case key == "ratelimit_maxconcurrentuploads":
+		setInt(&cfg.RateLimit.MaxConcurrentUploads, value)
+	case key == "ratelimit_retryafter":
+		setInt(&cfg.RateLimit.RetryAfter, value)
+	case key == "journal_enabled":
+		cfg.Journal.Enabled = strings.ToLower(value) == "true"
+	case key == "journal_dir":
+		cfg.Journal.Dir = value
+	case key == "journal_sync":
+		cfg.Journal.Sync = strings.ToLower(value) == "true"
+	case key == "eventlog_enabled":
+		cfg.EventLog.Enabled = strings.ToLower(value) == "true"
+	case key == "eventlog_dir":
+		cfg.EventLog.Dir = value
+	case key == "eventlog_retention":
+		setInt(&cfg.EventLog.Retention, value)
+	case key == "checksums_enabled":
+		cfg.Checksums.Enabled = strings.ToLower(value) == "true"
+	case key == "checksums_spooldir":
+		cfg.Checksums.SpoolDir = value
+	case key == "checksums_maxchunksize":
+		setInt64(&cfg.Checksums.MaxChunkSize, value)
+	case key == "admin_enabled":
+		cfg.Admin.Enabled = strings.ToLower(value) == "true"
+	case key == "admin_token":
+		cfg.Admin.Token = value
+	case key == "auth_enabled":
+		cfg.Auth.Enabled = strings.ToLower(value) == "true"
+	case key == "auth_jwtsecret":
+		cfg.Auth.JWTSecret = value
+	case key == "auth_policyengine":
+		cfg.Auth.PolicyEngine = value
+	case key == "auth_opa_url":
+		cfg.Auth.OPA.URL = value
+	case key == "auth_opa_timeout":
+		setInt(&cfg.Auth.OPA.Timeout, value)
+	case key == "claims_secret":
+		cfg.Claims.Secret = value
+	case key == "claims_ttl":
+		setInt(&cfg.Claims.TTL, value)
+	case key == "metadataschemas_default":
+		cfg.Schemas.Default = value
+	case key == "demo_enabled":
+		cfg.Demo.Enabled = strings.ToLower(value) == "true"
+	case key == "downloads_secret":
+		cfg.Downloads.Secret = value
+	case key == "downloads_ttl":
+		setInt(&cfg.Downloads.TTL, value)
+	case key == "downloads_statsinterval":
+		setInt(&cfg.Downloads.StatsInterval, value)
+	case key == "downloads_maxbatch":
+		setInt(&cfg.Downloads.MaxBatch, value)
+	case key == "downloads_replicas_regionheader":
+		cfg.Downloads.Replicas.RegionHeader = value
+	case key == "downloads_replicas_countryheader":
+		cfg.Downloads.Replicas.CountryHeader = value
+	case key == "signedurls_enabled":
+		cfg.SignedURLs.Enabled = strings.ToLower(value) == "true"
+	case key == "signedurls_secret":
+		cfg.SignedURLs.Secret = value
+	case key == "signedurls_ttl":
+		setInt(&cfg.SignedURLs.TTL, value)
+	case key == "diagnostics_enabled":
+		cfg.Diagnostics.Enabled = strings.ToLower(value) == "true"
+	case key == "diagnostics_dir":
+		cfg.Diagnostics.Dir = value
+	case key == "diagnostics_retention":
+		setInt(&cfg.Diagnostics.Retention, value)
+	case key == "diagnostics_timeline":
+		setInt(&cfg.Diagnostics.Timeline, value)
+	case key == "policy_maxsize":
+		var maxSize int64
+		if _, err := fmt.Sscanf(value, "%d", &maxSize); err == nil {
+			cfg.Policy.MaxSize = maxSize
+		}
+	case key == "policy_allowedtypes":
+		cfg.Policy.AllowedTypes = splitList(value)
 	}
 }
 
+// setInt parses an integer override, leaving dst unchanged if it is invalid
+func setInt(dst *int, value string) {
+	if i, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+		*dst = i
+	}
+}
+
+// setInt64 parses value into dst, leaving dst unchanged if it is not a
+// number
+func setInt64(dst *int64, value string) {
+	if i, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+		*dst = i
+	}
+}
+
+// setFloat parses value into dst, leaving dst unchanged if it is not a number
+func setFloat(dst *float64, value string) {
+	if f, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+		*dst = f
+	}
+}
+
+// splitList splits a comma-separated value into trimmed, non-empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // Validate performs validation on the configuration values
 func (c *Config) Validate() error {
 	// Basic validation
@@ -255,8 +1586,81 @@ func (c *Config) Validate() error {
 		if c.Storage.Minio.Endpoint == "" || c.Storage.Minio.Bucket == "" {
 			return fmt.Errorf("minio storage requires endpoint and bucket to be set")
 		}
+	case "s3compat", "r2", "memory":
+		// Configured by the S3COMPAT_, R2_ or MEMORY_ environment variables
+	default:
+		// External providers are configured by their own environment
+		// variables, and may be registered on the factory that builds the
+		// storage, which refuses unknown types
+	}
+
+	// Only the S3 family of backends can encrypt with a KMS key
+	if c.Storage.S3.SSEKMSKeyID != "" {
+		switch c.Storage.Type {
+		case "", "s3", "minio", "s3compat":
+		default:
+			return fmt.Errorf("storage.s3.sseKmsKeyId is not supported by %s storage", c.Storage.Type)
+		}
+	}
+
+	if c.Admin.Enabled && c.Admin.Token == "" {
+		return fmt.Errorf("admin API requires a token to be set")
+	}
+
+	if c.Auth.Enabled && c.Auth.JWTSecret == "" {
+		return fmt.Errorf("authentication requires jwtSecret to be set")
+	}
+
+	if c.TLS.Enabled && (c.TLS.CertFile == "" || c.TLS.KeyFile == "") {
+		return fmt.Errorf("tls requires certFile and keyFile to be set")
+	}
+
+	// Browsers refuse credentials for "*", and echoing every origin back
+	// instead would let any site make authenticated requests
+	if c.CORS.AllowCredentials && slices.Contains(c.CORS.AllowedOrigins, "*") {
+		return fmt.Errorf("cors.allowCredentials can't be combined with the \"*\" origin, list the allowed origins instead")
+	}
+
+	if c.Reports.Enabled && c.Reports.URL == "" {
+		return fmt.Errorf("health reports require url to be set")
+	}
+
+	if c.Storage.Tiering.Enabled {
+		if len(c.Storage.Tiering.Rules) == 0 {
+			return fmt.Errorf("tiering requires at least one rule")
+		}
+		for i, rule := range c.Storage.Tiering.Rules {
+			if rule.Class == "" {
+				return fmt.Errorf("tiering rule %d requires class to be set", i)
+			}
+			if rule.MinAge < 0 || rule.MinSize < 0 {
+				return fmt.Errorf("tiering rule %d must not have a negative minAge or minSize", i)
+			}
+		}
+	}
+
+	for i, rule := range c.Logging.Redact {
+		if len(rule.Headers) == 0 && len(rule.Metadata) == 0 && len(rule.Query) == 0 {
+			return fmt.Errorf("logging redaction rule %d redacts nothing", i)
+		}
+	}
+
+	switch c.TusdHooks.Type {
+	case "":
+	case "file":
+		if c.TusdHooks.Dir == "" {
+			return fmt.Errorf("file hooks require dir to be set")
+		}
+	case "grpc":
+		if c.TusdHooks.GRPC.Endpoint == "" {
+			return fmt.Errorf("grpc hooks require endpoint to be set")
+		}
+	case "plugin":
+		if c.TusdHooks.Plugin == "" {
+			return fmt.Errorf("plugin hooks require plugin to be set")
+		}
 	default:
-		return fmt.Errorf("unsupported storage type: %s", c.Storage.Type)
+		return fmt.Errorf("unsupported hook type: %s", c.TusdHooks.Type)
 	}
 
 	return nil
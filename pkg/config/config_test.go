@@ -144,6 +144,21 @@ func TestEnvironmentOverrides(t *testing.T) {
 	}
 }
 
+func TestInt64EnvironmentOverrides(t *testing.T) {
+	// Sizes beyond 2 GiB must survive 32-bit builds
+	t.Setenv("APP_CHECKSUMS_MAXCHUNKSIZE", "8589934592")
+	t.Setenv("APP_STAMPS_MAXSIZE", "8589934592")
+	cfg := &Config{}
+	applyEnvironmentOverrides(cfg)
+
+	if cfg.Checksums.MaxChunkSize != 8<<30 {
+		t.Errorf("expected checksums.maxChunkSize 8589934592, got %d", cfg.Checksums.MaxChunkSize)
+	}
+	if cfg.Stamps.MaxSize != 8<<30 {
+		t.Errorf("expected stamps.maxSize 8589934592, got %d", cfg.Stamps.MaxSize)
+	}
+}
+
 func TestGetConfig(t *testing.T) {
 	configPath, cleanup := setup(t)
 	defer cleanup()
@@ -228,6 +243,22 @@ func TestValidate(t *testing.T) {
 	if err := invalidConfig.Validate(); err != nil {
 		t.Errorf("Expected no validation error, got: %v", err)
 	}
+
+	// Credentials can't be shared with every origin
+	invalidConfig.CORS = CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}
+	if err := invalidConfig.Validate(); err == nil {
+		t.Error("Expected validation error for credentials with the \"*\" origin, got nil")
+	}
+	invalidConfig.CORS.AllowedOrigins = []string{"https://app.example.com"}
+	if err := invalidConfig.Validate(); err != nil {
+		t.Errorf("Expected no validation error for credentials with listed origins, got: %v", err)
+	}
+
+	// Types of external providers are left to the storage factory
+	invalidConfig.Storage.Type = "objstore"
+	if err := invalidConfig.Validate(); err != nil {
+		t.Errorf("Expected no validation error for an external provider, got: %v", err)
+	}
 }
 
 func TestEnvHelpers(t *testing.T) {
@@ -284,3 +315,48 @@ func TestEnvHelpers(t *testing.T) {
 		t.Errorf("FormatKey failed: got %s, want APP_STORAGE_TYPE", key)
 	}
 }
+
+func TestLoadWithoutConfigFile(t *testing.T) {
+	os.Setenv("APP_APP_PORT", "7070")
+	os.Setenv("APP_STORAGE_TYPE", "azure")
+	os.Setenv("APP_AZURE_CONTAINERNAME", "intake")
+	os.Setenv("APP_CLAIMS_TTL", "60")
+	defer func() {
+		os.Unsetenv("APP_APP_PORT")
+		os.Unsetenv("APP_STORAGE_TYPE")
+		os.Unsetenv("APP_AZURE_CONTAINERNAME")
+		os.Unsetenv("APP_CLAIMS_TTL")
+	}()
+
+	cfg, err := load(filepath.Join(t.TempDir(), "missing.yml"))
+	if err != nil {
+		t.Fatalf("Expected missing config file to fall back to defaults, got: %v", err)
+	}
+
+	if cfg.App.Port != 7070 {
+		t.Errorf("Expected port 7070, got %d", cfg.App.Port)
+	}
+	if cfg.Storage.Type != "azure" || cfg.Storage.Azure.ContainerName != "intake" {
+		t.Errorf("Storage not configured from environment: %+v", cfg.Storage)
+	}
+	if cfg.Claims.TTL != 60 {
+		t.Errorf("Expected claims TTL 60, got %d", cfg.Claims.TTL)
+	}
+	if cfg.Logging.Level != "info" {
+		t.Errorf("Expected default logging level 'info', got '%s'", cfg.Logging.Level)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected defaults with environment overrides to be valid, got: %v", err)
+	}
+}
+
+func TestLoadInvalidConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte("app: ["), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	if _, err := load(path); err == nil {
+		t.Error("Expected error for malformed config file, got nil")
+	}
+}
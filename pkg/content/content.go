@@ -0,0 +1,76 @@
+// Package content keeps the reference table of content-addressed storage:
+// which logical upload points at which stored content, so identical uploads
+// share one object and content is only deleted with its last reference
+package content
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when an upload has no reference
+var ErrNotFound = errors.New("content reference not found")
+
+// Reference maps a logical upload to the content it consists of
+type Reference struct {
+	UploadID     string    `json:"uploadId"`
+	Digest       string    `json:"digest"`
+	Size         int64     `json:"size"`
+	Deduplicated bool      `json:"deduplicated"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// Store persists references
+type Store interface {
+	Put(ctx context.Context, ref Reference) error
+	Get(ctx context.Context, uploadID string) (Reference, error)
+	List(ctx context.Context) ([]Reference, error)
+	Delete(ctx context.Context, uploadID string) error
+}
+
+// Table tracks references to content
+type Table struct {
+	store Store
+}
+
+// NewTable creates a reference table backed by the store
+func NewTable(store Store) *Table {
+	return &Table{store: store}
+}
+
+// Add records that an upload consists of the content with the digest
+func (t *Table) Add(ctx context.Context, ref Reference) error {
+	if ref.CreatedAt.IsZero() {
+		ref.CreatedAt = time.Now()
+	}
+	return t.store.Put(ctx, ref)
+}
+
+// Get returns the reference of an upload
+func (t *Table) Get(ctx context.Context, uploadID string) (Reference, error) {
+	return t.store.Get(ctx, uploadID)
+}
+
+// Remove deletes the reference of an upload and reports whether it was the
+// last reference to its content, which may then be deleted
+func (t *Table) Remove(ctx context.Context, uploadID string) (Reference, bool, error) {
+	ref, err := t.store.Get(ctx, uploadID)
+	if err != nil {
+		return Reference{}, false, err
+	}
+	if err := t.store.Delete(ctx, uploadID); err != nil {
+		return Reference{}, false, err
+	}
+
+	refs, err := t.store.List(ctx)
+	if err != nil {
+		return ref, false, err
+	}
+	for _, other := range refs {
+		if other.Digest == ref.Digest {
+			return ref, false, nil
+		}
+	}
+	return ref, true, nil
+}
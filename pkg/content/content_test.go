@@ -0,0 +1,34 @@
+package content
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTableRemoveReportsLastReference(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := NewTable(store)
+
+	digest := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	for _, id := range []string{"a", "b"} {
+		if err := table.Add(ctx, Reference{UploadID: id, Digest: digest, Size: 5}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, last, err := table.Remove(ctx, "a"); err != nil || last {
+		t.Fatalf("expected remaining reference, got last=%v, %v", last, err)
+	}
+	ref, last, err := table.Remove(ctx, "b")
+	if err != nil || !last || ref.Digest != digest {
+		t.Fatalf("expected last reference, got %+v, last=%v, %v", ref, last, err)
+	}
+	if _, _, err := table.Remove(ctx, "b"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package content
+
+import (
+	"context"
+
+	"github.com/devsnb/large-file-uploads/pkg/internal/jsonstore"
+)
+
+// MemoryStore keeps references in memory. They are lost on restart.
+type MemoryStore struct {
+	refs *jsonstore.Memory[Reference]
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{refs: jsonstore.NewMemory[Reference](ErrNotFound)}
+}
+
+// Put inserts or replaces a reference
+func (s *MemoryStore) Put(ctx context.Context, ref Reference) error {
+	s.refs.Put(ref.UploadID, ref)
+	return nil
+}
+
+// Get returns the reference of an upload
+func (s *MemoryStore) Get(ctx context.Context, uploadID string) (Reference, error) {
+	return s.refs.Get(uploadID)
+}
+
+// List returns all references
+func (s *MemoryStore) List(ctx context.Context) ([]Reference, error) {
+	return s.refs.List(), nil
+}
+
+// Delete removes the reference of an upload
+func (s *MemoryStore) Delete(ctx context.Context, uploadID string) error {
+	return s.refs.Delete(uploadID)
+}
+
+// FileStore persists each reference as a JSON file in a directory
+type FileStore struct {
+	refs *jsonstore.Dir[Reference]
+}
+
+// NewFileStore creates a file store, creating the directory if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	refs, err := jsonstore.NewDir[Reference](dir, "content reference", ErrNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{refs: refs}, nil
+}
+
+// Put inserts or replaces a reference
+func (s *FileStore) Put(ctx context.Context, ref Reference) error {
+	return s.refs.Put(ref.UploadID, ref)
+}
+
+// Get returns the reference of an upload
+func (s *FileStore) Get(ctx context.Context, uploadID string) (Reference, error) {
+	return s.refs.Get(uploadID)
+}
+
+// List returns all references
+func (s *FileStore) List(ctx context.Context) ([]Reference, error) {
+	return s.refs.List()
+}
+
+// Delete removes the reference of an upload
+func (s *FileStore) Delete(ctx context.Context, uploadID string) error {
+	return s.refs.Delete(uploadID)
+}
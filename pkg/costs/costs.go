@@ -0,0 +1,137 @@
+// Package costs estimates what storing uploads costs each tenant, from the
+// bytes they store in each storage class and a pricing table, for
+// chargeback reports without bucket-level billing exports
+package costs
+
+import (
+	"encoding/csv"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BytesPerGiB is the unit prices are given in
+const BytesPerGiB = 1 << 30
+
+// Pricing is the monthly price of storing a GiB in each storage class
+type Pricing struct {
+	Currency string
+
+	// DefaultClass is the class of uploads stored without an explicit
+	// storage class, i.e. the bucket's default
+	DefaultClass string
+
+	// Prices per GiB-month by storage class, e.g. STANDARD or Cool
+	Prices map[string]float64
+}
+
+// Usage is the data stored for one upload
+type Usage struct {
+	Tenant       string // Empty for uploads outside any tenant
+	StorageClass string // Empty for the default class
+	Bytes        int64
+}
+
+// Line is the estimate for the uploads of a tenant in one storage class
+type Line struct {
+	Tenant       string `json:"tenant"`
+	StorageClass string `json:"storageClass"`
+	Uploads      int    `json:"uploads"`
+	Bytes        int64  `json:"bytes"`
+
+	// PricePerGiB is nil if the pricing table lacks the class, in which
+	// case the line costs nothing
+	PricePerGiB *float64 `json:"pricePerGiBMonth"`
+	MonthlyCost float64  `json:"monthlyCost"`
+}
+
+// Report estimates the monthly storage costs of every tenant
+type Report struct {
+	GeneratedAt time.Time `json:"generatedAt"`
+	Currency    string    `json:"currency"`
+	Lines       []Line    `json:"lines"` // By tenant, then storage class
+	Total       float64   `json:"total"`
+
+	// Unpriced lists the storage classes the pricing table lacks
+	Unpriced []string `json:"unpriced,omitempty"`
+}
+
+// Estimate sums the usage of each tenant by storage class and prices it
+func Estimate(usage []Usage, pricing Pricing, now time.Time) Report {
+	type key struct{ tenant, class string }
+	lines := make(map[key]*Line)
+	for _, u := range usage {
+		class := u.StorageClass
+		if class == "" {
+			class = pricing.DefaultClass
+		}
+		k := key{u.Tenant, class}
+		line, ok := lines[k]
+		if !ok {
+			line = &Line{Tenant: u.Tenant, StorageClass: class}
+			lines[k] = line
+		}
+		line.Uploads++
+		line.Bytes += u.Bytes
+	}
+
+	report := Report{GeneratedAt: now, Currency: pricing.Currency, Lines: make([]Line, 0, len(lines))}
+	for _, line := range lines {
+		if price, ok := pricing.Prices[line.StorageClass]; ok {
+			line.PricePerGiB = &price
+			line.MonthlyCost = float64(line.Bytes) / BytesPerGiB * price
+			report.Total += line.MonthlyCost
+		} else if !slices.Contains(report.Unpriced, line.StorageClass) {
+			report.Unpriced = append(report.Unpriced, line.StorageClass)
+		}
+		report.Lines = append(report.Lines, *line)
+	}
+
+	slices.SortFunc(report.Lines, func(a, b Line) int {
+		if c := strings.Compare(a.Tenant, b.Tenant); c != 0 {
+			return c
+		}
+		return strings.Compare(a.StorageClass, b.StorageClass)
+	})
+	slices.Sort(report.Unpriced)
+	return report
+}
+
+// csvHeader names the columns of CSV reports
+var csvHeader = []string{"tenant", "storage_class", "uploads", "bytes", "gib", "price_per_gib_month", "monthly_cost", "currency", "generated_at"}
+
+// WriteCSV writes the report with one row per line. Unpriced lines have an
+// empty price.
+func (r Report) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+
+	generatedAt := r.GeneratedAt.UTC().Format(time.RFC3339)
+	for _, line := range r.Lines {
+		var price string
+		if line.PricePerGiB != nil {
+			price = strconv.FormatFloat(*line.PricePerGiB, 'f', -1, 64)
+		}
+		record := []string{
+			line.Tenant,
+			line.StorageClass,
+			strconv.Itoa(line.Uploads),
+			strconv.FormatInt(line.Bytes, 10),
+			strconv.FormatFloat(float64(line.Bytes)/BytesPerGiB, 'f', 6, 64),
+			price,
+			strconv.FormatFloat(line.MonthlyCost, 'f', 4, 64),
+			r.Currency,
+			generatedAt,
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,65 @@
+package costs
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEstimate(t *testing.T) {
+	pricing := Pricing{
+		Currency:     "USD",
+		DefaultClass: "STANDARD",
+		Prices:       map[string]float64{"STANDARD": 0.02, "GLACIER": 0.004},
+	}
+	usage := []Usage{
+		{Tenant: "acme", Bytes: 2 * BytesPerGiB},
+		{Tenant: "acme", StorageClass: "STANDARD", Bytes: BytesPerGiB},
+		{Tenant: "acme", StorageClass: "GLACIER", Bytes: 10 * BytesPerGiB},
+		{Tenant: "beta", StorageClass: "ONEZONE_IA", Bytes: BytesPerGiB},
+		{Bytes: BytesPerGiB / 2},
+	}
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	report := Estimate(usage, pricing, now)
+	if len(report.Lines) != 4 {
+		t.Fatalf("got %d lines, want 4: %+v", len(report.Lines), report.Lines)
+	}
+
+	// Lines are sorted by tenant, the untenanted uploads first
+	first := report.Lines[0]
+	if first.Tenant != "" || first.StorageClass != "STANDARD" || first.MonthlyCost != 0.01 {
+		t.Errorf("untenanted line = %+v", first)
+	}
+	glacier, standard := report.Lines[1], report.Lines[2]
+	if glacier.StorageClass != "GLACIER" || glacier.MonthlyCost != 0.04 {
+		t.Errorf("glacier line = %+v", glacier)
+	}
+	if standard.Uploads != 2 || standard.Bytes != 3*BytesPerGiB || standard.MonthlyCost != 0.06 {
+		t.Errorf("standard line = %+v", standard)
+	}
+	if unpriced := report.Lines[3]; unpriced.PricePerGiB != nil || unpriced.MonthlyCost != 0 {
+		t.Errorf("unpriced line = %+v", unpriced)
+	}
+	if len(report.Unpriced) != 1 || report.Unpriced[0] != "ONEZONE_IA" {
+		t.Errorf("Unpriced = %v", report.Unpriced)
+	}
+	if report.Total < 0.1099 || report.Total > 0.1101 {
+		t.Errorf("Total = %v, want 0.11", report.Total)
+	}
+
+	var csv strings.Builder
+	if err := report.WriteCSV(&csv); err != nil {
+		t.Fatal(err)
+	}
+	rows := strings.Split(strings.TrimSpace(csv.String()), "\n")
+	if len(rows) != 5 || !strings.HasPrefix(rows[0], "tenant,storage_class,") {
+		t.Fatalf("CSV = %q", csv.String())
+	}
+	if want := "acme,STANDARD,2,3221225472,3.000000,0.02,0.0600,USD,2024-05-01T00:00:00Z"; rows[3] != want {
+		t.Errorf("row = %q, want %q", rows[3], want)
+	}
+	if want := "beta,ONEZONE_IA,1,1073741824,1.000000,,0.0000,USD,2024-05-01T00:00:00Z"; rows[4] != want {
+		t.Errorf("unpriced row = %q, want %q", rows[4], want)
+	}
+}
@@ -0,0 +1,159 @@
+// Package deadletter persists event deliveries that exhausted their retries
+// so they can be inspected and redelivered later
+package deadletter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Common errors returned by dead-letter operations
+var (
+	ErrNotFound         = errors.New("dead letter not found")
+	ErrUnknownDeliverer = errors.New("no deliverer registered for kind")
+)
+
+// Entry is a failed delivery
+type Entry struct {
+	ID        string          `json:"id"`
+	Kind      string          `json:"kind"`
+	Target    string          `json:"target"`
+	UploadID  string          `json:"uploadId,omitempty"`
+	Payload   json.RawMessage `json:"payload"`
+	Error     string          `json:"error"`
+	Attempts  int             `json:"attempts"`
+	CreatedAt time.Time       `json:"createdAt"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+}
+
+// Store persists dead-letter entries
+type Store interface {
+	// Put inserts or replaces an entry
+	Put(ctx context.Context, entry Entry) error
+
+	// Get returns the entry with the given ID or ErrNotFound
+	Get(ctx context.Context, id string) (Entry, error)
+
+	// List returns all entries
+	List(ctx context.Context) ([]Entry, error)
+
+	// Delete removes the entry with the given ID or returns ErrNotFound
+	Delete(ctx context.Context, id string) error
+}
+
+// DeliverFunc redelivers an entry to its target
+type DeliverFunc func(ctx context.Context, entry Entry) error
+
+// Queue records failed deliveries and redelivers them on request
+type Queue struct {
+	store Store
+
+	mu         sync.RWMutex
+	deliverers map[string]DeliverFunc
+}
+
+// NewQueue creates a dead-letter queue backed by the given store
+func NewQueue(store Store) *Queue {
+	return &Queue{
+		store:      store,
+		deliverers: make(map[string]DeliverFunc),
+	}
+}
+
+// RegisterDeliverer sets the function used to redeliver entries of a kind
+func (q *Queue) RegisterDeliverer(kind string, deliver DeliverFunc) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.deliverers[kind] = deliver
+}
+
+// Add records a failed delivery
+func (q *Queue) Add(ctx context.Context, entry Entry) (Entry, error) {
+	now := time.Now()
+	entry.ID = newID()
+	entry.CreatedAt = now
+	entry.UpdatedAt = now
+
+	if err := q.store.Put(ctx, entry); err != nil {
+		return Entry{}, fmt.Errorf("failed to store dead letter: %w", err)
+	}
+
+	slog.Warn("Delivery moved to dead-letter queue",
+		"dead_letter_id", entry.ID,
+		"kind", entry.Kind,
+		"target", entry.Target,
+		"id", entry.UploadID,
+		"error", entry.Error)
+
+	return entry, nil
+}
+
+// List returns all entries, oldest first
+func (q *Queue) List(ctx context.Context) ([]Entry, error) {
+	entries, err := q.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+
+	return entries, nil
+}
+
+// Get returns a single entry
+func (q *Queue) Get(ctx context.Context, id string) (Entry, error) {
+	return q.store.Get(ctx, id)
+}
+
+// Delete discards an entry without redelivering it
+func (q *Queue) Delete(ctx context.Context, id string) error {
+	return q.store.Delete(ctx, id)
+}
+
+// Redeliver attempts to deliver an entry again. On success the entry is
+// removed; on failure its attempt count and error are updated.
+func (q *Queue) Redeliver(ctx context.Context, id string) error {
+	entry, err := q.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	q.mu.RLock()
+	deliver, ok := q.deliverers[entry.Kind]
+	q.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownDeliverer, entry.Kind)
+	}
+
+	deliveryErr := deliver(ctx, entry)
+	if deliveryErr == nil {
+		slog.Info("Dead letter redelivered", "dead_letter_id", entry.ID, "kind", entry.Kind)
+		return q.store.Delete(ctx, id)
+	}
+
+	entry.Attempts++
+	entry.Error = deliveryErr.Error()
+	entry.UpdatedAt = time.Now()
+	if err := q.store.Put(ctx, entry); err != nil {
+		return fmt.Errorf("failed to update dead letter: %w", err)
+	}
+
+	return deliveryErr
+}
+
+// newID returns a random identifier for an entry
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,106 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestRedeliverRemovesEntryOnSuccess(t *testing.T) {
+	ctx := context.Background()
+	queue := NewQueue(NewMemoryStore())
+
+	var delivered Entry
+	queue.RegisterDeliverer("webhook", func(ctx context.Context, entry Entry) error {
+		delivered = entry
+		return nil
+	})
+
+	entry, err := queue.Add(ctx, Entry{
+		Kind:    "webhook",
+		Target:  "https://example.com/hook",
+		Payload: json.RawMessage(`{"id":"abc"}`),
+	})
+	if err != nil {
+		t.Fatalf("Failed to add entry: %v", err)
+	}
+
+	if err := queue.Redeliver(ctx, entry.ID); err != nil {
+		t.Fatalf("Redeliver failed: %v", err)
+	}
+	if delivered.ID != entry.ID {
+		t.Errorf("Expected entry %s to be delivered, got %s", entry.ID, delivered.ID)
+	}
+	if _, err := queue.Get(ctx, entry.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected entry to be removed after redelivery, got %v", err)
+	}
+}
+
+func TestRedeliverKeepsEntryOnFailure(t *testing.T) {
+	ctx := context.Background()
+	queue := NewQueue(NewMemoryStore())
+	queue.RegisterDeliverer("webhook", func(ctx context.Context, entry Entry) error {
+		return errors.New("still down")
+	})
+
+	entry, _ := queue.Add(ctx, Entry{Kind: "webhook", Attempts: 1})
+
+	if err := queue.Redeliver(ctx, entry.ID); err == nil {
+		t.Fatal("Expected redelivery error")
+	}
+
+	updated, err := queue.Get(ctx, entry.ID)
+	if err != nil {
+		t.Fatalf("Expected entry to be kept, got %v", err)
+	}
+	if updated.Attempts != 2 || updated.Error != "still down" {
+		t.Errorf("Expected attempts=2 and error recorded, got %d / %q", updated.Attempts, updated.Error)
+	}
+}
+
+func TestRedeliverUnknownKind(t *testing.T) {
+	ctx := context.Background()
+	queue := NewQueue(NewMemoryStore())
+	entry, _ := queue.Add(ctx, Entry{Kind: "kafka"})
+
+	if err := queue.Redeliver(ctx, entry.ID); !errors.Is(err, ErrUnknownDeliverer) {
+		t.Errorf("Expected ErrUnknownDeliverer, got %v", err)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file store: %v", err)
+	}
+
+	entry := Entry{ID: "one", Kind: "webhook", Payload: json.RawMessage(`{"a":1}`)}
+	if err := store.Put(ctx, entry); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	got, err := store.Get(ctx, "one")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got.Kind != "webhook" || string(got.Payload) != `{"a":1}` {
+		t.Errorf("Unexpected entry: %+v", got)
+	}
+
+	entries, err := store.List(ctx)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Expected one entry, got %d (%v)", len(entries), err)
+	}
+
+	if err := store.Delete(ctx, "one"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := store.Delete(ctx, "one"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound on second delete, got %v", err)
+	}
+	if _, err := store.Get(ctx, "../one"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for traversal ID, got %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package deadletter
+
+import (
+	"context"
+
+	"github.com/devsnb/large-file-uploads/pkg/internal/jsonstore"
+)
+
+// MemoryStore keeps entries in memory. Entries are lost on restart.
+type MemoryStore struct {
+	entries *jsonstore.Memory[Entry]
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: jsonstore.NewMemory[Entry](ErrNotFound)}
+}
+
+// Put inserts or replaces an entry
+func (s *MemoryStore) Put(ctx context.Context, entry Entry) error {
+	s.entries.Put(entry.ID, entry)
+	return nil
+}
+
+// Get returns the entry with the given ID
+func (s *MemoryStore) Get(ctx context.Context, id string) (Entry, error) {
+	return s.entries.Get(id)
+}
+
+// List returns all entries
+func (s *MemoryStore) List(ctx context.Context) ([]Entry, error) {
+	return s.entries.List(), nil
+}
+
+// Delete removes the entry with the given ID
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	return s.entries.Delete(id)
+}
+
+// FileStore persists each entry as a JSON file in a directory
+type FileStore struct {
+	entries *jsonstore.Dir[Entry]
+}
+
+// NewFileStore creates a file store, creating the directory if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	entries, err := jsonstore.NewDir[Entry](dir, "dead letter", ErrNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{entries: entries}, nil
+}
+
+// Put inserts or replaces an entry
+func (s *FileStore) Put(ctx context.Context, entry Entry) error {
+	return s.entries.Put(entry.ID, entry)
+}
+
+// Get returns the entry with the given ID
+func (s *FileStore) Get(ctx context.Context, id string) (Entry, error) {
+	return s.entries.Get(id)
+}
+
+// List returns all entries
+func (s *FileStore) List(ctx context.Context) ([]Entry, error) {
+	return s.entries.List()
+}
+
+// Delete removes the entry with the given ID
+func (s *FileStore) Delete(ctx context.Context, id string) error {
+	return s.entries.Delete(id)
+}
@@ -0,0 +1,118 @@
+// Package deletion keeps terminated uploads for a grace period before their
+// data is deleted, so a termination sent by mistake can be undone
+package deletion
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+// ErrNotFound is returned for uploads that are not pending deletion
+var ErrNotFound = errors.New("upload is not pending deletion")
+
+// Pending is an upload whose termination was requested
+type Pending struct {
+	UploadID    string    `json:"uploadId"`
+	RequestedAt time.Time `json:"requestedAt"`
+	DeleteAt    time.Time `json:"deleteAt"`
+	RequestedBy string    `json:"requestedBy,omitempty"` // User who terminated the upload, if authenticated
+}
+
+// Store persists pending deletions
+type Store interface {
+	Put(ctx context.Context, pending Pending) error
+	Get(ctx context.Context, uploadID string) (Pending, error)
+	List(ctx context.Context) ([]Pending, error)
+	Delete(ctx context.Context, uploadID string) error
+}
+
+// Queue schedules the deletion of terminated uploads after a grace period
+type Queue struct {
+	store Store
+	grace time.Duration
+	now   func() time.Time
+}
+
+// NewQueue creates a queue deleting uploads grace after their termination
+func NewQueue(store Store, grace time.Duration) *Queue {
+	return &Queue{
+		store: store,
+		grace: grace,
+		now:   time.Now,
+	}
+}
+
+// Grace returns how long terminated uploads are kept
+func (q *Queue) Grace() time.Duration {
+	return q.grace
+}
+
+// Schedule records the termination of an upload. Terminating an upload
+// that is already pending deletion keeps its original deletion time.
+func (q *Queue) Schedule(ctx context.Context, uploadID, requestedBy string) (Pending, error) {
+	if pending, err := q.store.Get(ctx, uploadID); err == nil {
+		return pending, nil
+	} else if !errors.Is(err, ErrNotFound) {
+		return Pending{}, err
+	}
+
+	now := q.now()
+	pending := Pending{
+		UploadID:    uploadID,
+		RequestedAt: now,
+		DeleteAt:    now.Add(q.grace),
+		RequestedBy: requestedBy,
+	}
+	return pending, q.store.Put(ctx, pending)
+}
+
+// Get returns the pending deletion of an upload
+func (q *Queue) Get(ctx context.Context, uploadID string) (Pending, error) {
+	return q.store.Get(ctx, uploadID)
+}
+
+// List returns all pending deletions, the next one first
+func (q *Queue) List(ctx context.Context) ([]Pending, error) {
+	pending, err := q.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].DeleteAt.Before(pending[j].DeleteAt)
+	})
+	return pending, nil
+}
+
+// Restore cancels the pending deletion of an upload
+func (q *Queue) Restore(ctx context.Context, uploadID string) (Pending, error) {
+	pending, err := q.store.Get(ctx, uploadID)
+	if err != nil {
+		return Pending{}, err
+	}
+	return pending, q.store.Delete(ctx, uploadID)
+}
+
+// Due returns the pending deletions whose grace period has ended
+func (q *Queue) Due(ctx context.Context) ([]Pending, error) {
+	pending, err := q.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := q.now()
+	for i, p := range pending {
+		if p.DeleteAt.After(now) {
+			return pending[:i], nil
+		}
+	}
+	return pending, nil
+}
+
+// Done forgets a pending deletion once the upload was deleted
+func (q *Queue) Done(ctx context.Context, uploadID string) error {
+	if err := q.store.Delete(ctx, uploadID); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package deletion
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue := NewQueue(store, time.Hour)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	queue.now = func() time.Time { return now }
+
+	first, err := queue.Schedule(ctx, "acme/a", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.DeleteAt.Equal(now.Add(time.Hour)) || first.RequestedBy != "alice" {
+		t.Fatalf("unexpected pending deletion %+v", first)
+	}
+
+	// Terminating again must not push the deletion back
+	now = now.Add(30 * time.Minute)
+	again, err := queue.Schedule(ctx, "acme/a", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !again.DeleteAt.Equal(first.DeleteAt) || again.RequestedBy != "alice" {
+		t.Fatalf("rescheduled deletion %+v, want %+v", again, first)
+	}
+	if _, err := queue.Schedule(ctx, "b", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	due, err := queue.Due(ctx)
+	if err != nil || len(due) != 0 {
+		t.Fatalf("Due before the grace period = %v, %v", due, err)
+	}
+	now = now.Add(45 * time.Minute)
+	due, err = queue.Due(ctx)
+	if err != nil || len(due) != 1 || due[0].UploadID != "acme/a" {
+		t.Fatalf("Due = %v, %v", due, err)
+	}
+
+	if _, err := queue.Restore(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := queue.Get(ctx, "b"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of restored upload = %v, want ErrNotFound", err)
+	}
+	if _, err := queue.Restore(ctx, "b"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("second Restore = %v, want ErrNotFound", err)
+	}
+
+	if err := queue.Done(ctx, "acme/a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := queue.Done(ctx, "acme/a"); err != nil {
+		t.Fatalf("Done of a forgotten deletion = %v", err)
+	}
+	pending, err := queue.List(ctx)
+	if err != nil || len(pending) != 0 {
+		t.Fatalf("List = %v, %v", pending, err)
+	}
+}
@@ -0,0 +1,72 @@
+package deletion
+
+import (
+	"context"
+
+	"github.com/devsnb/large-file-uploads/pkg/internal/jsonstore"
+)
+
+// MemoryStore keeps pending deletions in memory. They are lost on restart.
+type MemoryStore struct {
+	pending *jsonstore.Memory[Pending]
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{pending: jsonstore.NewMemory[Pending](ErrNotFound)}
+}
+
+// Put inserts or replaces a pending deletion
+func (s *MemoryStore) Put(ctx context.Context, pending Pending) error {
+	s.pending.Put(pending.UploadID, pending)
+	return nil
+}
+
+// Get returns the pending deletion of an upload
+func (s *MemoryStore) Get(ctx context.Context, uploadID string) (Pending, error) {
+	return s.pending.Get(uploadID)
+}
+
+// List returns all pending deletions
+func (s *MemoryStore) List(ctx context.Context) ([]Pending, error) {
+	return s.pending.List(), nil
+}
+
+// Delete removes a pending deletion
+func (s *MemoryStore) Delete(ctx context.Context, uploadID string) error {
+	return s.pending.Delete(uploadID)
+}
+
+// FileStore persists each pending deletion as a JSON file in a directory
+type FileStore struct {
+	pending *jsonstore.Dir[Pending]
+}
+
+// NewFileStore creates a file store, creating the directory if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	pending, err := jsonstore.NewDir[Pending](dir, "pending deletion", ErrNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{pending: pending}, nil
+}
+
+// Put inserts or replaces a pending deletion
+func (s *FileStore) Put(ctx context.Context, pending Pending) error {
+	return s.pending.Put(pending.UploadID, pending)
+}
+
+// Get returns the pending deletion of an upload
+func (s *FileStore) Get(ctx context.Context, uploadID string) (Pending, error) {
+	return s.pending.Get(uploadID)
+}
+
+// List returns all pending deletions
+func (s *FileStore) List(ctx context.Context) ([]Pending, error) {
+	return s.pending.List()
+}
+
+// Delete removes a pending deletion
+func (s *FileStore) Delete(ctx context.Context, uploadID string) error {
+	return s.pending.Delete(uploadID)
+}
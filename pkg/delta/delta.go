@@ -0,0 +1,237 @@
+// Package delta compares a changed file with a previous upload block by
+// block, so only the blocks that differ need to be uploaded again
+package delta
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Limits of block manifests
+const (
+	MinBlockSize = 64 << 10
+	MaxBlockSize = 64 << 20
+	MaxBlocks    = 1 << 17
+
+	// MaxManifestSize bounds the JSON encoding of a manifest of MaxBlocks
+	MaxManifestSize = 16 << 20
+)
+
+// blockDigest matches hex encoded SHA-256 digests
+var blockDigest = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Common errors returned by delta operations
+var (
+	ErrNotFound = errors.New("delta plan not found")
+	ErrExpired  = errors.New("delta plan expired")
+	ErrClaimed  = errors.New("delta plan is used by another upload")
+	ErrInvalid  = errors.New("invalid block manifest")
+)
+
+// Manifest lists the SHA-256 digests of the blocks of a file. All blocks
+// but the last are BlockSize bytes long.
+type Manifest struct {
+	Size      int64    `json:"size"`
+	BlockSize int64    `json:"blockSize"`
+	Blocks    []string `json:"blocks"`
+}
+
+// Validate checks that the manifest describes a file of its size
+func (m Manifest) Validate() error {
+	if m.BlockSize < MinBlockSize || m.BlockSize > MaxBlockSize {
+		return fmt.Errorf("%w: blockSize must be between %d and %d bytes", ErrInvalid, MinBlockSize, MaxBlockSize)
+	}
+	if m.Size <= 0 {
+		return fmt.Errorf("%w: size must be positive", ErrInvalid)
+	}
+	blocks := (m.Size + m.BlockSize - 1) / m.BlockSize
+	if blocks > MaxBlocks {
+		return fmt.Errorf("%w: at most %d blocks are supported, use larger blocks", ErrInvalid, MaxBlocks)
+	}
+	if int64(len(m.Blocks)) != blocks {
+		return fmt.Errorf("%w: %d bytes in blocks of %d bytes need %d digests, got %d",
+			ErrInvalid, m.Size, m.BlockSize, blocks, len(m.Blocks))
+	}
+	for i, digest := range m.Blocks {
+		if !blockDigest.MatchString(digest) {
+			return fmt.Errorf("%w: block %d is not a hex encoded SHA-256 digest", ErrInvalid, i)
+		}
+	}
+	return nil
+}
+
+// Range is a span of bytes of a file
+type Range struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// End returns the offset after the range
+func (r Range) End() int64 {
+	return r.Offset + r.Length
+}
+
+// Compare reads the previous upload and returns the ranges of the file
+// described by the manifest that differ from it. Adjacent changed blocks
+// are merged. The last block is always reported as changed, so the upload
+// is completed by the client.
+func Compare(base io.Reader, m Manifest) ([]Range, error) {
+	var changed []Range
+	add := func(offset, length int64) {
+		if n := len(changed); n > 0 && changed[n-1].End() == offset {
+			changed[n-1].Length += length
+			return
+		}
+		changed = append(changed, Range{Offset: offset, Length: length})
+	}
+
+	buf := make([]byte, m.BlockSize)
+	baseEnded := false
+	for i, digest := range m.Blocks {
+		offset := int64(i) * m.BlockSize
+		length := min(m.BlockSize, m.Size-offset)
+
+		last := i == len(m.Blocks)-1
+		if baseEnded || last {
+			add(offset, length)
+			continue
+		}
+
+		n, err := io.ReadFull(base, buf[:length])
+		switch {
+		case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+			baseEnded = true
+		case err != nil:
+			return nil, fmt.Errorf("failed to read previous upload: %w", err)
+		}
+		sum := sha256.Sum256(buf[:n])
+		if int64(n) != length || hex.EncodeToString(sum[:]) != digest {
+			add(offset, length)
+		}
+	}
+	return changed, nil
+}
+
+// Plan tells how a file differs from a previous upload. The upload created
+// with the plan receives the unchanged ranges from the previous upload.
+type Plan struct {
+	ID           string    `json:"id"`
+	BaseID       string    `json:"baseId"`
+	UploadID     string    `json:"uploadId,omitempty"` // Upload created with the plan
+	Owner        string    `json:"owner,omitempty"`
+	Size         int64     `json:"size"`
+	BlockSize    int64     `json:"blockSize"`
+	Changed      []Range   `json:"changed"`
+	ChangedBytes int64     `json:"changedBytes"`
+	CreatedAt    time.Time `json:"createdAt"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+// Unchanged returns the unchanged range starting at offset, if any
+func (p Plan) Unchanged(offset int64) (Range, bool) {
+	next := p.Size
+	for _, r := range p.Changed {
+		if offset >= r.Offset && offset < r.End() {
+			return Range{}, false
+		}
+		if r.Offset > offset {
+			next = r.Offset
+			break
+		}
+	}
+	if offset >= next {
+		return Range{}, false
+	}
+	return Range{Offset: offset, Length: next - offset}, true
+}
+
+// Store persists plans
+type Store interface {
+	Put(ctx context.Context, plan Plan) error
+	Get(ctx context.Context, id string) (Plan, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// Plans creates plans and hands each to one upload. Plans no upload was
+// created with expire.
+type Plans struct {
+	store Store
+	ttl   time.Duration
+	now   func() time.Time
+
+	// mu serializes claims, so a plan is never used by two uploads
+	mu sync.Mutex
+}
+
+// NewPlans creates a plan registry backed by the store
+func NewPlans(store Store, ttl time.Duration) *Plans {
+	return &Plans{store: store, ttl: ttl, now: time.Now}
+}
+
+// Create stores a plan for the changed ranges of a file
+func (p *Plans) Create(ctx context.Context, plan Plan) (Plan, error) {
+	plan.ID = newID()
+	plan.UploadID = ""
+	plan.CreatedAt = p.now()
+	plan.ExpiresAt = plan.CreatedAt.Add(p.ttl)
+	plan.ChangedBytes = 0
+	for _, r := range plan.Changed {
+		plan.ChangedBytes += r.Length
+	}
+	if err := p.store.Put(ctx, plan); err != nil {
+		return Plan{}, fmt.Errorf("failed to store delta plan: %w", err)
+	}
+	return plan, nil
+}
+
+// Get returns a plan. Expired plans no upload was created with are deleted.
+func (p *Plans) Get(ctx context.Context, id string) (Plan, error) {
+	plan, err := p.store.Get(ctx, id)
+	if err != nil {
+		return Plan{}, err
+	}
+	if plan.UploadID == "" && !p.now().Before(plan.ExpiresAt) {
+		_ = p.store.Delete(ctx, id)
+		return Plan{}, ErrExpired
+	}
+	return plan, nil
+}
+
+// Claim hands a plan to the upload created with it
+func (p *Plans) Claim(ctx context.Context, id, uploadID string) (Plan, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	plan, err := p.Get(ctx, id)
+	if err != nil {
+		return Plan{}, err
+	}
+	if plan.UploadID != "" && plan.UploadID != uploadID {
+		return Plan{}, ErrClaimed
+	}
+	plan.UploadID = uploadID
+	if err := p.store.Put(ctx, plan); err != nil {
+		return Plan{}, fmt.Errorf("failed to store delta plan: %w", err)
+	}
+	return plan, nil
+}
+
+// Delete removes a plan once its upload completed or was terminated
+func (p *Plans) Delete(ctx context.Context, id string) error {
+	return p.store.Delete(ctx, id)
+}
+
+// newID generates a random plan ID
+func newID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
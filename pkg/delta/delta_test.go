@@ -0,0 +1,97 @@
+package delta
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// manifest describes data in blocks of MinBlockSize
+func manifest(data []byte) Manifest {
+	m := Manifest{Size: int64(len(data)), BlockSize: MinBlockSize}
+	for offset := 0; offset < len(data); offset += MinBlockSize {
+		sum := sha256.Sum256(data[offset:min(offset+MinBlockSize, len(data))])
+		m.Blocks = append(m.Blocks, hex.EncodeToString(sum[:]))
+	}
+	return m
+}
+
+func TestCompare(t *testing.T) {
+	base := bytes.Repeat([]byte("a"), 6*MinBlockSize)
+	changed := bytes.Clone(base)
+	changed[MinBlockSize+10] = 'b'
+	changed[2*MinBlockSize] = 'b'
+	changed = append(changed, bytes.Repeat([]byte("c"), 100)...)
+
+	m := manifest(changed)
+	if err := m.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	ranges, err := Compare(bytes.NewReader(base), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Blocks 1 and 2 changed, and the last block is always uploaded
+	want := []Range{{Offset: MinBlockSize, Length: 2 * MinBlockSize}, {Offset: 6 * MinBlockSize, Length: 100}}
+	if !reflect.DeepEqual(ranges, want) {
+		t.Fatalf("changed ranges = %v, want %v", ranges, want)
+	}
+
+	plan := Plan{Size: m.Size, Changed: ranges}
+	if r, ok := plan.Unchanged(0); !ok || r.Length != MinBlockSize {
+		t.Errorf("unchanged range at 0 = %v, %v", r, ok)
+	}
+	if r, ok := plan.Unchanged(3 * MinBlockSize); !ok || r.End() != 6*MinBlockSize {
+		t.Errorf("unchanged range at block 3 = %v, %v", r, ok)
+	}
+	if _, ok := plan.Unchanged(MinBlockSize); ok {
+		t.Error("expected no unchanged range within a changed one")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	m := manifest(bytes.Repeat([]byte("a"), 3*MinBlockSize))
+	m.Blocks = m.Blocks[:2]
+	if err := m.Validate(); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected missing blocks to be refused, got %v", err)
+	}
+}
+
+func TestClaim(t *testing.T) {
+	ctx := context.Background()
+	plans := NewPlans(NewMemoryStore(), time.Hour)
+	now := time.Now()
+	plans.now = func() time.Time { return now }
+
+	plan, err := plans.Create(ctx, Plan{Changed: []Range{{Offset: 0, Length: 10}, {Offset: 20, Length: 5}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.ChangedBytes != 15 {
+		t.Fatalf("changed bytes = %d, want 15", plan.ChangedBytes)
+	}
+	if _, err := plans.Claim(ctx, plan.ID, "upload-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plans.Claim(ctx, plan.ID, "upload-2"); !errors.Is(err, ErrClaimed) {
+		t.Fatalf("expected a plan to be used by one upload, got %v", err)
+	}
+
+	// Claimed plans outlive their expiry, so the upload can finish
+	now = now.Add(2 * time.Hour)
+	if _, err := plans.Get(ctx, plan.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	unused, _ := plans.Create(ctx, Plan{})
+	now = now.Add(2 * time.Hour)
+	if _, err := plans.Get(ctx, unused.ID); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expected unused plans to expire, got %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package delta
+
+import (
+	"context"
+
+	"github.com/devsnb/large-file-uploads/pkg/internal/jsonstore"
+)
+
+// MemoryStore keeps plans in memory. They are lost on restart.
+type MemoryStore struct {
+	plans *jsonstore.Memory[Plan]
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{plans: jsonstore.NewMemory[Plan](ErrNotFound)}
+}
+
+// Put inserts or replaces a plan
+func (s *MemoryStore) Put(ctx context.Context, plan Plan) error {
+	s.plans.Put(plan.ID, plan)
+	return nil
+}
+
+// Get returns a plan by ID
+func (s *MemoryStore) Get(ctx context.Context, id string) (Plan, error) {
+	return s.plans.Get(id)
+}
+
+// Delete removes a plan
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	return s.plans.Delete(id)
+}
+
+// FileStore persists each plan as a JSON file in a directory
+type FileStore struct {
+	plans *jsonstore.Dir[Plan]
+}
+
+// NewFileStore creates a file store, creating the directory if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	plans, err := jsonstore.NewDir[Plan](dir, "delta plan", ErrNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{plans: plans}, nil
+}
+
+// Put inserts or replaces a plan
+func (s *FileStore) Put(ctx context.Context, plan Plan) error {
+	return s.plans.Put(plan.ID, plan)
+}
+
+// Get returns a plan by ID
+func (s *FileStore) Get(ctx context.Context, id string) (Plan, error) {
+	return s.plans.Get(id)
+}
+
+// Delete removes a plan
+func (s *FileStore) Delete(ctx context.Context, id string) error {
+	return s.plans.Delete(id)
+}
@@ -0,0 +1,254 @@
+// Package diagnostics tracks per-upload transfer statistics, such as how
+// often a client had to retry a chunk and the last error it hit, along with
+// an optional timeline of the chunks received, so support can debug flaky
+// client networks and stalled uploads.
+package diagnostics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Header is the response header carrying an upload's diagnostics
+const Header = "Upload-Diagnostics"
+
+// DefaultRetention is how long statistics are kept after the last request
+// for an upload
+const DefaultRetention = 24 * time.Hour
+
+// maxErrorLength bounds the stored error message
+const maxErrorLength = 256
+
+// ErrNotFound is returned for uploads without statistics
+var ErrNotFound = errors.New("no diagnostics recorded for upload")
+
+// Stats are the transfer statistics of a single upload
+type Stats struct {
+	Patches     int        `json:"patches"`
+	Retries     int        `json:"retries"`
+	Failures    int        `json:"failures"`
+	Aborts      int        `json:"aborts"` // Requests the client went away from mid-chunk
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+
+	// Timeline lists the most recent PATCH requests, oldest first
+	Timeline []Chunk `json:"timeline,omitempty"`
+}
+
+// Patch is the outcome of a PATCH request
+type Patch struct {
+	Start    int64 // Upload-Offset of the request
+	End      int64 // Offset after the request, Start if nothing was stored
+	Duration time.Duration
+	Status   int
+	Error    string // Empty if the request succeeded
+	Aborted  bool   // The client went away before sending the whole chunk
+}
+
+// Chunk is a PATCH request in the timeline of an upload
+type Chunk struct {
+	Index      int       `json:"index"` // Position among all PATCH requests of the upload, from 1
+	Start      int64     `json:"start"`
+	End        int64     `json:"end"`
+	DurationMS int64     `json:"durationMs"`
+	Retry      bool      `json:"retry,omitempty"`
+	Status     int       `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	Aborted    bool      `json:"aborted,omitempty"`
+	At         time.Time `json:"at"` // When the request completed
+}
+
+// String formats the statistics as a structured header dictionary, e.g.
+// `patches=12, retries=2, failures=1, last-error="connection reset"`.
+// Aborts are only included once a client went away mid-chunk.
+func (s Stats) String() string {
+	parts := []string{
+		"patches=" + strconv.Itoa(s.Patches),
+		"retries=" + strconv.Itoa(s.Retries),
+		"failures=" + strconv.Itoa(s.Failures),
+	}
+	if s.Aborts > 0 {
+		parts = append(parts, "aborts="+strconv.Itoa(s.Aborts))
+	}
+	if s.LastError != "" {
+		parts = append(parts, "last-error="+strconv.QuoteToASCII(s.LastError))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Record holds the statistics and the retry detection state of an upload
+type Record struct {
+	ID    string `json:"id"`
+	Stats Stats  `json:"stats"`
+
+	// LastStart is the offset the previous PATCH request started at
+	LastStart int64 `json:"lastStart"`
+}
+
+// Store persists the records of uploads
+type Store interface {
+	Put(ctx context.Context, record Record) error
+	Get(ctx context.Context, id string) (Record, error)
+	List(ctx context.Context) ([]Record, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// Tracker records transfer statistics per upload in a store
+type Tracker struct {
+	store     Store
+	retention time.Duration
+	timeline  int
+	now       func() time.Time
+
+	// mu serializes updates, so concurrent requests for an upload don't
+	// lose each other's counts
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+// NewTracker creates a tracker backed by the store that forgets uploads
+// once no request was seen for the retention period. A non-positive
+// retention uses DefaultRetention. The timeline of each upload keeps its
+// last timeline PATCH requests; zero disables it.
+func NewTracker(store Store, retention time.Duration, timeline int) *Tracker {
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+	return &Tracker{
+		store:     store,
+		retention: retention,
+		timeline:  max(timeline, 0),
+		now:       time.Now,
+	}
+}
+
+// RecordPatch records a PATCH request for the upload and returns its entry
+// in the timeline. A request starting at or before the offset of the
+// previous one re-sends data and counts as a retry. A non-empty error counts
+// as a failure, unless the client aborted the request.
+func (t *Tracker) RecordPatch(ctx context.Context, id string, patch Patch) (Chunk, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	if err := t.prune(ctx, now); err != nil {
+		return Chunk{}, err
+	}
+
+	e, err := t.store.Get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		e = Record{ID: id, LastStart: -1}
+	} else if err != nil {
+		return Chunk{}, err
+	}
+
+	retry := e.Stats.Patches > 0 && patch.Start <= e.LastStart
+	if retry {
+		e.Stats.Retries++
+	}
+	e.Stats.Patches++
+	e.LastStart = patch.Start
+	e.Stats.UpdatedAt = now
+
+	if patch.Aborted {
+		e.Stats.Aborts++
+	} else if patch.Error != "" {
+		e.Stats.Failures++
+	}
+	if patch.Error != "" {
+		e.Stats.LastError = truncate(patch.Error)
+		e.Stats.LastErrorAt = &now
+	}
+
+	chunk := Chunk{
+		Index:      e.Stats.Patches,
+		Start:      patch.Start,
+		End:        max(patch.End, patch.Start),
+		DurationMS: patch.Duration.Milliseconds(),
+		Retry:      retry,
+		Status:     patch.Status,
+		Aborted:    patch.Aborted,
+		At:         now,
+	}
+	if patch.Error != "" {
+		chunk.Error = truncate(patch.Error)
+	}
+	if t.timeline > 0 {
+		// Timelines kept with a longer limit before a restart are cut
+		if drop := len(e.Stats.Timeline) - t.timeline + 1; drop > 0 {
+			e.Stats.Timeline = slices.Delete(e.Stats.Timeline, 0, drop)
+		}
+		e.Stats.Timeline = append(e.Stats.Timeline, chunk)
+	}
+	if err := t.store.Put(ctx, e); err != nil {
+		return Chunk{}, fmt.Errorf("failed to store diagnostics: %w", err)
+	}
+	return chunk, nil
+}
+
+// Get returns the statistics of an upload, or ErrNotFound if none were
+// recorded within the retention period
+func (t *Tracker) Get(ctx context.Context, id string) (Stats, error) {
+	e, err := t.store.Get(ctx, id)
+	if err != nil {
+		return Stats{}, err
+	}
+	if t.now().Sub(e.Stats.UpdatedAt) > t.retention {
+		return Stats{}, ErrNotFound
+	}
+	return e.Stats, nil
+}
+
+// Timeline reports whether the tracker keeps timelines
+func (t *Tracker) Timeline() bool {
+	return t.timeline > 0
+}
+
+// Forget drops the statistics of an upload
+func (t *Tracker) Forget(ctx context.Context, id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.store.Delete(ctx, id); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// prune drops expired uploads at most once a minute. Callers must hold mu.
+func (t *Tracker) prune(ctx context.Context, now time.Time) error {
+	if now.Sub(t.lastPrune) < time.Minute {
+		return nil
+	}
+	t.lastPrune = now
+
+	records, err := t.store.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list diagnostics: %w", err)
+	}
+	for _, e := range records {
+		if now.Sub(e.Stats.UpdatedAt) <= t.retention {
+			continue
+		}
+		if err := t.store.Delete(ctx, e.ID); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// truncate shortens error messages to maxErrorLength bytes
+func truncate(msg string) string {
+	msg = strings.TrimSpace(msg)
+	if len(msg) <= maxErrorLength {
+		return msg
+	}
+	return fmt.Sprintf("%s...", strings.ToValidUTF8(msg[:maxErrorLength], ""))
+}
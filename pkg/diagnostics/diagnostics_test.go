@@ -0,0 +1,142 @@
+package diagnostics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// record records a PATCH request, failing the test on errors
+func record(t *testing.T, tracker *Tracker, id string, patch Patch) Chunk {
+	t.Helper()
+	chunk, err := tracker.RecordPatch(context.Background(), id, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chunk
+}
+
+func TestTrackerCountsRetries(t *testing.T) {
+	tracker := NewTracker(NewMemoryStore(), time.Hour, 0)
+
+	record(t, tracker, "a", Patch{Start: 0})
+	record(t, tracker, "a", Patch{Start: 100, Error: "unexpected EOF"})
+	record(t, tracker, "a", Patch{Start: 100})
+	record(t, tracker, "a", Patch{Start: 50})
+	record(t, tracker, "a", Patch{Start: 200})
+
+	stats, err := tracker.Get(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Patches != 5 || stats.Retries != 2 || stats.Failures != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if stats.LastError != "unexpected EOF" || stats.LastErrorAt == nil {
+		t.Fatalf("unexpected last error: %+v", stats)
+	}
+	if stats.Timeline != nil {
+		t.Fatalf("expected no timeline, got %+v", stats.Timeline)
+	}
+
+	want := `patches=5, retries=2, failures=1, last-error="unexpected EOF"`
+	if got := stats.String(); got != want {
+		t.Fatalf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestTrackerCountsAborts(t *testing.T) {
+	tracker := NewTracker(NewMemoryStore(), time.Hour, 2)
+
+	record(t, tracker, "a", Patch{Start: 0, End: 40, Status: 400, Error: "client disconnected", Aborted: true})
+	chunk := record(t, tracker, "a", Patch{Start: 40, End: 100, Status: 204})
+
+	stats, _ := tracker.Get(context.Background(), "a")
+	if stats.Aborts != 1 || stats.Failures != 0 || stats.LastError != "client disconnected" {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if !stats.Timeline[0].Aborted || chunk.Aborted {
+		t.Fatalf("unexpected timeline: %+v", stats.Timeline)
+	}
+	want := `patches=2, retries=0, failures=0, aborts=1, last-error="client disconnected"`
+	if got := stats.String(); got != want {
+		t.Fatalf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestTrackerPrunesExpiredUploads(t *testing.T) {
+	now := time.Now()
+	tracker := NewTracker(NewMemoryStore(), time.Hour, 0)
+	tracker.now = func() time.Time { return now }
+
+	record(t, tracker, "old", Patch{})
+
+	now = now.Add(2 * time.Hour)
+	record(t, tracker, "new", Patch{})
+
+	if _, err := tracker.store.Get(context.Background(), "old"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected expired upload to be pruned, got %v", err)
+	}
+	if _, err := tracker.Get(context.Background(), "new"); err != nil {
+		t.Fatalf("expected recent upload to be kept, got %v", err)
+	}
+
+	if err := tracker.Forget(context.Background(), "new"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tracker.Get(context.Background(), "new"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected forgotten upload to be dropped, got %v", err)
+	}
+}
+
+func TestTrackerKeepsTimeline(t *testing.T) {
+	tracker := NewTracker(NewMemoryStore(), time.Hour, 3)
+
+	record(t, tracker, "a", Patch{Start: 0, End: 100, Duration: 2 * time.Second, Status: 204})
+	record(t, tracker, "a", Patch{Start: 100, End: 150, Duration: time.Minute, Status: 500, Error: "unexpected EOF"})
+	record(t, tracker, "a", Patch{Start: 150, End: 250, Status: 204})
+	last := record(t, tracker, "a", Patch{Start: 150, End: 250, Status: 204})
+
+	if last.Index != 4 || !last.Retry {
+		t.Fatalf("unexpected chunk: %+v", last)
+	}
+	stats, _ := tracker.Get(context.Background(), "a")
+	if len(stats.Timeline) != 3 || stats.Timeline[0].Index != 2 {
+		t.Fatalf("expected the last 3 chunks, got %+v", stats.Timeline)
+	}
+	if first := stats.Timeline[0]; first.Start != 100 || first.End != 150 || first.DurationMS != 60000 || first.Error != "unexpected EOF" {
+		t.Fatalf("unexpected chunk: %+v", first)
+	}
+	if stats.Timeline[1].Retry || !stats.Timeline[2].Retry {
+		t.Fatalf("unexpected retries: %+v", stats.Timeline)
+	}
+}
+
+func TestTrackerPersistsStatistics(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := NewTracker(store, time.Hour, 2)
+	record(t, tracker, "a", Patch{Start: 0, End: 100, Status: 204})
+	record(t, tracker, "a", Patch{Start: 100, End: 100, Status: 500, Error: "unexpected EOF"})
+
+	// A restarted tracker continues the statistics, so a re-sent chunk
+	// still counts as a retry
+	if store, err = NewFileStore(dir); err != nil {
+		t.Fatal(err)
+	}
+	restarted := NewTracker(store, time.Hour, 2)
+	if chunk := record(t, restarted, "a", Patch{Start: 100, End: 200, Status: 204}); chunk.Index != 3 || !chunk.Retry {
+		t.Fatalf("unexpected chunk after a restart: %+v", chunk)
+	}
+	stats, err := restarted.Get(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Patches != 3 || stats.Retries != 1 || stats.Failures != 1 || len(stats.Timeline) != 2 {
+		t.Fatalf("expected the statistics to survive a restart, got %+v", stats)
+	}
+}
@@ -0,0 +1,221 @@
+// Package eventlog persists upload lifecycle events so they can be replayed
+// to consumers that were down, instead of them re-scanning the bucket
+package eventlog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/devsnb/large-file-uploads/pkg/events"
+)
+
+// PruneInterval is how often records past the retention are removed
+const PruneInterval = time.Hour
+
+// Types are the event types recorded in the log
+var Types = []events.Type{events.UploadCreated, events.UploadCompleted, events.UploadTerminated, events.BatchCompleted}
+
+// ErrReplayFailed is returned when a record could not be sent to the sink
+var ErrReplayFailed = errors.New("replay failed")
+
+// Record is a persisted upload event
+type Record struct {
+	Seq      int64             `json:"seq"`
+	Type     events.Type       `json:"type"`
+	UploadID string            `json:"uploadId"`
+	Size     int64             `json:"size"`
+	Offset   int64             `json:"offset"`
+	MetaData map[string]string `json:"metadata,omitempty"`
+	Storage  map[string]string `json:"storage,omitempty"`
+	Time     time.Time         `json:"time"`
+
+	// Annotations are the results post-processors attached to the upload
+	Annotations map[string]json.RawMessage `json:"annotations,omitempty"`
+}
+
+// Filter selects records. Zero fields match all records.
+type Filter struct {
+	UploadID string
+	From     time.Time // inclusive
+	To       time.Time // exclusive
+	Types    []events.Type
+	Limit    int
+}
+
+// Match reports whether a record is selected by the filter
+func (f Filter) Match(r Record) bool {
+	if f.UploadID != "" && r.UploadID != f.UploadID {
+		return false
+	}
+	if !f.From.IsZero() && r.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !r.Time.Before(f.To) {
+		return false
+	}
+	return len(f.Types) == 0 || slices.Contains(f.Types, r.Type)
+}
+
+// Store persists records in the order they are appended
+type Store interface {
+	// Append adds a record to the end of the log
+	Append(ctx context.Context, record Record) error
+
+	// Scan calls fn for every record in append order, stopping at the first
+	// error
+	Scan(ctx context.Context, fn func(Record) error) error
+
+	// Prune removes records older than the given time and returns how many
+	// were removed
+	Prune(ctx context.Context, before time.Time) (int, error)
+}
+
+// Sink receives replayed records
+type Sink interface {
+	Send(ctx context.Context, record Record) error
+}
+
+// Log records upload events and replays them
+type Log struct {
+	store     Store
+	retention time.Duration
+
+	mu  sync.Mutex
+	seq int64
+}
+
+// New creates a log backed by the store. Records older than the retention
+// are pruned by Run; zero keeps them forever.
+func New(ctx context.Context, store Store, retention time.Duration) (*Log, error) {
+	l := &Log{store: store, retention: retention}
+
+	// Continue the sequence where the stored log ends
+	err := store.Scan(ctx, func(r Record) error {
+		l.seq = max(l.seq, r.Seq)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read event log: %w", err)
+	}
+	return l, nil
+}
+
+// Record appends an event to the log. It is meant to be subscribed
+// asynchronously to the recorded event types.
+func (l *Log) Record(ctx context.Context, event events.Event) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	record := Record{
+		Seq:         l.seq + 1,
+		Type:        event.Type,
+		UploadID:    event.Upload.ID,
+		Size:        event.Upload.Size,
+		Offset:      event.Upload.Offset,
+		MetaData:    event.Upload.MetaData,
+		Storage:     event.Upload.Storage,
+		Time:        event.Time,
+		Annotations: event.Annotations,
+	}
+	if err := l.store.Append(ctx, record); err != nil {
+		return fmt.Errorf("failed to record event: %w", err)
+	}
+	l.seq = record.Seq
+	return nil
+}
+
+// Query returns the records matching the filter, oldest first
+func (l *Log) Query(ctx context.Context, filter Filter) ([]Record, error) {
+	var records []Record
+	err := l.store.Scan(ctx, func(r Record) error {
+		if filter.Match(r) {
+			records = append(records, r)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Subscribers record asynchronously, so the append order can differ
+	// slightly from the order events happened in
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.Before(records[j].Time)
+	})
+	if filter.Limit > 0 && len(records) > filter.Limit {
+		records = records[:filter.Limit]
+	}
+	return records, nil
+}
+
+// Replay sends the records matching the filter to the sink, oldest first.
+// It stops at the first failure and returns how many records were sent
+// before it, so a replay can be resumed from the failed record.
+func (l *Log) Replay(ctx context.Context, filter Filter, sink Sink) (int, error) {
+	records, err := l.Query(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, record := range records {
+		if err := sink.Send(ctx, record); err != nil {
+			return i, &ReplayError{Record: record, Err: err}
+		}
+	}
+	return len(records), nil
+}
+
+// Run prunes records past the retention every PruneInterval until the
+// context is canceled
+func (l *Log) Run(ctx context.Context) {
+	if l.retention <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(PruneInterval)
+	defer ticker.Stop()
+
+	for {
+		l.prune(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// prune removes records past the retention
+func (l *Log) prune(ctx context.Context) {
+	removed, err := l.store.Prune(ctx, time.Now().Add(-l.retention))
+	if err != nil {
+		slog.Error("Failed to prune event log", "error", err)
+		return
+	}
+	if removed > 0 {
+		slog.Info("Pruned event log", "removed", removed)
+	}
+}
+
+// ReplayError describes the record a replay stopped at
+type ReplayError struct {
+	Record Record
+	Err    error
+}
+
+// Error implements the error interface
+func (e *ReplayError) Error() string {
+	return fmt.Sprintf("%s at event %d: %v", ErrReplayFailed, e.Record.Seq, e.Err)
+}
+
+// Unwrap lets errors.Is match ErrReplayFailed and the cause
+func (e *ReplayError) Unwrap() []error {
+	return []error{ErrReplayFailed, e.Err}
+}
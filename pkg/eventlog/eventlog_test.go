@@ -0,0 +1,100 @@
+package eventlog
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/events"
+)
+
+// sinkFunc adapts a function to the Sink interface
+type sinkFunc func(ctx context.Context, record Record) error
+
+func (f sinkFunc) Send(ctx context.Context, record Record) error {
+	return f(ctx, record)
+}
+
+func TestLogReplay(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, err := New(ctx, store, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	record := func(eventType events.Type, id string, offset time.Duration) {
+		event := events.Event{Type: eventType, Upload: tusd.FileInfo{ID: id}, Time: start.Add(offset)}
+		if err := log.Record(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	record(events.UploadCreated, "a", 0)
+	record(events.UploadCreated, "b", time.Minute)
+	// Recorded late, as async subscribers may be
+	record(events.UploadCompleted, "a", 30*time.Second)
+	record(events.UploadTerminated, "b", 2*time.Minute)
+
+	records, err := log.Query(ctx, Filter{UploadID: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Type != events.UploadCreated || records[1].Type != events.UploadCompleted {
+		t.Fatalf("unexpected records for upload a: %+v", records)
+	}
+
+	var replayed []string
+	sent, err := log.Replay(ctx, Filter{From: start.Add(30 * time.Second), To: start.Add(2 * time.Minute)},
+		sinkFunc(func(ctx context.Context, r Record) error {
+			replayed = append(replayed, r.UploadID+":"+string(r.Type))
+			return nil
+		}))
+	if err != nil || sent != 2 || replayed[0] != "a:upload.completed" || replayed[1] != "b:upload.created" {
+		t.Fatalf("Replay = %d, %v, sent %v", sent, err, replayed)
+	}
+
+	// Replays stop at the first failure and report the failed record
+	sent, err = log.Replay(ctx, Filter{}, sinkFunc(func(ctx context.Context, r Record) error {
+		if r.UploadID == "b" {
+			return errors.New("sink down")
+		}
+		return nil
+	}))
+	var replayErr *ReplayError
+	if sent != 2 || !errors.As(err, &replayErr) || replayErr.Record.Seq != 2 || !errors.Is(err, ErrReplayFailed) {
+		t.Fatalf("Replay with failing sink = %d, %v", sent, err)
+	}
+
+	// A reopened log continues the sequence
+	reopened, err := New(ctx, store, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record = func(eventType events.Type, id string, offset time.Duration) {
+		if err := reopened.Record(ctx, events.Event{Type: eventType, Upload: tusd.FileInfo{ID: id}, Time: start.Add(offset)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	record(events.UploadCreated, "c", 3*time.Minute)
+	records, _ = reopened.Query(ctx, Filter{UploadID: "c"})
+	if len(records) != 1 || records[0].Seq != 5 {
+		t.Fatalf("unexpected records after reopening: %+v", records)
+	}
+
+	removed, err := store.Prune(ctx, start.Add(time.Minute))
+	if err != nil || removed != 2 {
+		t.Fatalf("Prune = %d, %v", removed, err)
+	}
+	records, _ = reopened.Query(ctx, Filter{})
+	if len(records) != 3 || records[0].UploadID != "b" {
+		t.Fatalf("unexpected records after pruning: %+v", records)
+	}
+}
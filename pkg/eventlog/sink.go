@@ -0,0 +1,45 @@
+package eventlog
+
+import (
+	"context"
+
+	"github.com/devsnb/large-file-uploads/pkg/eventschema"
+	"github.com/devsnb/large-file-uploads/pkg/webhook"
+)
+
+// ReplayedRecord is the body posted for a replayed record. Replayed lets
+// consumers tell replays from live deliveries.
+type ReplayedRecord = eventschema.Record
+
+// Replayed converts a record to the body posted when it is replayed
+func (r Record) Replayed() ReplayedRecord {
+	return ReplayedRecord{
+		SchemaVersion: eventschema.Version,
+		Seq:           r.Seq,
+		Type:          string(r.Type),
+		UploadID:      r.UploadID,
+		Size:          r.Size,
+		Offset:        r.Offset,
+		MetaData:      r.MetaData,
+		Storage:       r.Storage,
+		Time:          r.Time,
+		Replayed:      true,
+		Annotations:   r.Annotations,
+	}
+}
+
+// WebhookSink posts replayed records to a URL, one request per record
+type WebhookSink struct {
+	client *webhook.Client
+	url    string
+}
+
+// NewWebhookSink creates a sink posting to the URL with the given client
+func NewWebhookSink(client *webhook.Client, url string) *WebhookSink {
+	return &WebhookSink{client: client, url: url}
+}
+
+// Send posts a record to the webhook
+func (s *WebhookSink) Send(ctx context.Context, record Record) error {
+	return s.client.Post(ctx, s.url, record.Replayed())
+}
@@ -0,0 +1,184 @@
+package eventlog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// maxRecordSize bounds a single encoded record when reading the log file
+const maxRecordSize = 1 << 20
+
+// MemoryStore keeps records in memory. Records are lost on restart.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	records []Record
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Append adds a record to the end of the log
+func (s *MemoryStore) Append(ctx context.Context, record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, record)
+	return nil
+}
+
+// Scan calls fn for every record in append order
+func (s *MemoryStore) Scan(ctx context.Context, fn func(Record) error) error {
+	s.mu.RLock()
+	records := append([]Record(nil), s.records...)
+	s.mu.RUnlock()
+
+	for _, record := range records {
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prune removes records older than the given time
+func (s *MemoryStore) Prune(ctx context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.records[:0]
+	for _, record := range s.records {
+		if !record.Time.Before(before) {
+			kept = append(kept, record)
+		}
+	}
+	removed := len(s.records) - len(kept)
+	s.records = kept
+	return removed, nil
+}
+
+// FileStore appends records as JSON lines to a file in a directory
+type FileStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileStore creates a file store, creating the directory if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create event log directory: %w", err)
+	}
+	return &FileStore{path: filepath.Join(dir, "events.jsonl")}, nil
+}
+
+// Append adds a record to the end of the log file
+func (s *FileStore) Append(ctx context.Context, record Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open event log: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write event log: %w", err)
+	}
+	return f.Close()
+}
+
+// Scan calls fn for every record in the log file
+func (s *FileStore) Scan(ctx context.Context, fn func(Record) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.scan(fn)
+}
+
+// Prune rewrites the log file without records older than the given time
+func (s *FileStore) Prune(ctx context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var kept []Record
+	removed := 0
+	err := s.scan(func(r Record) error {
+		if r.Time.Before(before) {
+			removed++
+		} else {
+			kept = append(kept, r)
+		}
+		return nil
+	})
+	if err != nil || removed == 0 {
+		return 0, err
+	}
+
+	// Write to a temporary file first so a crash never truncates the log
+	tmp := s.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune event log: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, record := range kept {
+		if err := enc.Encode(record); err != nil {
+			f.Close()
+			return 0, fmt.Errorf("failed to prune event log: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return 0, fmt.Errorf("failed to prune event log: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return 0, fmt.Errorf("failed to prune event log: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return 0, fmt.Errorf("failed to prune event log: %w", err)
+	}
+	return removed, nil
+}
+
+// scan reads the log file line by line. A line cut short by a crash is
+// skipped.
+func (s *FileStore) scan(fn func(Record) error) error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to open event log: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), maxRecordSize)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			slog.Warn("Skipping malformed event log record", "path", s.path, "error", err)
+			continue
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read event log: %w", err)
+	}
+	return nil
+}
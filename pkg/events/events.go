@@ -0,0 +1,340 @@
+// Package events provides a typed event bus for upload lifecycle notifications
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+)
+
+// Type identifies the kind of upload event
+type Type string
+
+const (
+	// UploadCreated is emitted when a new upload is created
+	UploadCreated Type = "upload.created"
+
+	// UploadProgress is emitted periodically while data is being received
+	UploadProgress Type = "upload.progress"
+
+	// UploadCompleted is emitted once all bytes of an upload have been received
+	UploadCompleted Type = "upload.completed"
+
+	// UploadTerminated is emitted when an upload is terminated by the client
+	UploadTerminated Type = "upload.terminated"
+
+	// UploadStateChanged is emitted when an upload moves to a new lifecycle
+	// state
+	UploadStateChanged Type = "upload.state_changed"
+
+	// UploadMilestone is emitted when an upload passes a configured progress
+	// percentage
+	UploadMilestone Type = "upload.milestone"
+
+	// UploadBanned is emitted when a completed upload matches the content
+	// ban list and is quarantined
+	UploadBanned Type = "upload.banned"
+
+	// UploadReviewRequested is emitted when an upload enters the
+	// pending_review state and waits for an approver
+	UploadReviewRequested Type = "upload.review_requested"
+
+	// UploadApproved is emitted when an approver accepts an upload, which
+	// becomes ready
+	UploadApproved Type = "upload.approved"
+
+	// UploadRejected is emitted when an approver rejects an upload
+	UploadRejected Type = "upload.rejected"
+
+	// UploadReplicated is emitted when a completed upload was copied to a
+	// storage mirror
+	UploadReplicated Type = "upload.replicated"
+
+	// UploadReplicationFailed is emitted when copying an upload to a
+	// storage mirror failed too often and waits for an operator
+	UploadReplicationFailed Type = "upload.replication_failed"
+
+	// UploadTransitioned is emitted when a tiering rule moved a completed
+	// upload to another storage class
+	UploadTransitioned Type = "upload.transitioned"
+
+	// BatchCompleted is emitted when all uploads of a closed batch have
+	// completed. Upload is the manifest of the batch.
+	BatchCompleted Type = "batch.completed"
+
+	// RequestPanicked is emitted when the handler of a request panicked.
+	// Upload only carries the ID of the upload the request was about, if
+	// any.
+	RequestPanicked Type = "request.panicked"
+)
+
+// Event describes something that happened to an upload
+type Event struct {
+	// Type is the kind of event
+	Type Type
+
+	// Upload contains the upload state at the time of the event
+	Upload tusd.FileInfo
+
+	// HTTPRequest contains details about the request that caused the event
+	HTTPRequest tusd.HTTPRequest
+
+	// State is the lifecycle state of the upload after a state change
+	State string
+
+	// PreviousState is the lifecycle state before a state change, empty for
+	// the first state of an upload
+	PreviousState string
+
+	// Milestone is the progress percentage reached by a milestone event
+	Milestone int
+
+	// Reviewer is the user who approved or rejected an upload, and Reason
+	// why
+	Reviewer string
+	Reason   string
+
+	// Batch is the ID of the batch a batch completion event is about
+	Batch string
+
+	// Mirror is the storage mirror a replication event is about
+	Mirror string
+
+	// Panic is the value a panicking handler panicked with, and RequestID
+	// identifies the request in logs and in the error response
+	Panic     string
+	RequestID string
+
+	// Annotations are the results post-processors attached to the upload,
+	// set on completion and state change events
+	Annotations map[string]json.RawMessage
+
+	// Time is when the event was emitted
+	Time time.Time
+}
+
+// Handler is a function that receives upload events. Handlers subscribed in
+// synchronous mode can reject the operation by returning an error.
+type Handler func(ctx context.Context, event Event) error
+
+// Mode controls how a subscriber is invoked
+type Mode int
+
+const (
+	// Async subscribers are invoked in their own goroutine after the operation
+	// has been committed. Returned errors are logged but otherwise ignored.
+	Async Mode = iota
+
+	// Sync subscribers are invoked inline before the operation is acknowledged
+	// to the client. A returned error rejects the operation.
+	Sync
+)
+
+// SubscribeOption customizes a subscription
+type SubscribeOption func(*subscription)
+
+// WithMode sets the invocation mode of a subscription
+func WithMode(mode Mode) SubscribeOption {
+	return func(s *subscription) {
+		s.mode = mode
+	}
+}
+
+// Ordered makes an asynchronous subscriber receive the events of each
+// upload one at a time, in the order they were notified. Events of
+// different uploads are still handled concurrently.
+func Ordered() SubscribeOption {
+	return func(s *subscription) {
+		s.queues = &uploadQueues{pending: make(map[string][]queuedEvent)}
+	}
+}
+
+// subscription is a registered handler for a single event type
+type subscription struct {
+	handler Handler
+	mode    Mode
+	queues  *uploadQueues // set for ordered subscriptions
+}
+
+// queuedEvent is an event waiting for an ordered subscriber
+type queuedEvent struct {
+	ctx   context.Context
+	event Event
+}
+
+// uploadQueues holds the events of each upload an ordered subscriber hasn't
+// handled yet. An upload has a queue while a goroutine drains it.
+type uploadQueues struct {
+	mu      sync.Mutex
+	pending map[string][]queuedEvent
+}
+
+// push queues an event and starts draining the upload's queue unless that
+// is already underway
+func (q *uploadQueues) push(ctx context.Context, event Event, handler Handler, running *deliveries) {
+	id := event.Upload.ID
+	q.mu.Lock()
+	queue, draining := q.pending[id]
+	q.pending[id] = append(queue, queuedEvent{ctx, event})
+	q.mu.Unlock()
+	if draining {
+		return
+	}
+
+	started := running.start(func() {
+		for {
+			q.mu.Lock()
+			queue := q.pending[id]
+			if len(queue) == 0 {
+				delete(q.pending, id)
+				q.mu.Unlock()
+				return
+			}
+			next := queue[0]
+			q.pending[id] = queue[1:]
+			q.mu.Unlock()
+
+			invokeAsync(next.ctx, handler, next.event)
+		}
+	})
+	if !started {
+		q.mu.Lock()
+		delete(q.pending, id)
+		q.mu.Unlock()
+	}
+}
+
+// deliveries tracks the goroutines invoking asynchronous subscribers
+type deliveries struct {
+	mu     sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// start runs fn in a goroutine unless the bus is closed, and reports
+// whether it was started
+func (d *deliveries) start(fn func()) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return false
+	}
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		fn()
+	}()
+	return true
+}
+
+// Bus dispatches upload events to subscribers
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[Type][]subscription
+	running     deliveries
+}
+
+// NewBus creates a new, empty event bus
+func NewBus() *Bus {
+	return &Bus{
+		subscribers: make(map[Type][]subscription),
+	}
+}
+
+// Subscribe registers a handler for the given event type. Subscriptions are
+// asynchronous unless WithMode(Sync) is passed.
+func (b *Bus) Subscribe(eventType Type, handler Handler, opts ...SubscribeOption) {
+	sub := subscription{
+		handler: handler,
+		mode:    Async,
+	}
+	for _, opt := range opts {
+		opt(&sub)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[eventType] = append(b.subscribers[eventType], sub)
+}
+
+// HasSubscribers reports whether any handler with the given mode is
+// subscribed to the event type
+func (b *Bus) HasSubscribers(eventType Type, mode Mode) bool {
+	for _, sub := range b.snapshot(eventType) {
+		if sub.mode == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// Emit invokes all synchronous subscribers of the event type in registration
+// order and returns the first error, which rejects the operation
+func (b *Bus) Emit(ctx context.Context, event Event) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	for _, sub := range b.snapshot(event.Type) {
+		if sub.mode != Sync {
+			continue
+		}
+		if err := sub.handler(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Notify invokes all asynchronous subscribers of the event type, each in its
+// own goroutine, or after the upload's earlier events for ordered
+// subscribers. Errors are logged.
+func (b *Bus) Notify(ctx context.Context, event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	for _, sub := range b.snapshot(event.Type) {
+		if sub.mode != Async {
+			continue
+		}
+		if sub.queues != nil {
+			sub.queues.push(ctx, event, sub.handler, &b.running)
+			continue
+		}
+		b.running.start(func() {
+			invokeAsync(ctx, sub.handler, event)
+		})
+	}
+}
+
+// Close waits for asynchronous subscribers to handle the events notified so
+// far. Events notified afterwards are dropped.
+func (b *Bus) Close() {
+	b.running.mu.Lock()
+	b.running.closed = true
+	b.running.mu.Unlock()
+	b.running.wg.Wait()
+}
+
+// invokeAsync runs an asynchronous subscriber, logging its error
+func invokeAsync(ctx context.Context, handler Handler, event Event) {
+	if err := handler(ctx, event); err != nil {
+		slog.Warn("Event subscriber failed",
+			"event", event.Type,
+			"id", event.Upload.ID,
+			"error", err)
+	}
+}
+
+// snapshot returns a copy of the subscribers for an event type
+func (b *Bus) snapshot(eventType Type) []subscription {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return append([]subscription(nil), b.subscribers[eventType]...)
+}
@@ -0,0 +1,157 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestEmitRunsSyncSubscribersInOrder(t *testing.T) {
+	bus := NewBus()
+
+	var calls []string
+	bus.Subscribe(UploadCompleted, func(ctx context.Context, e Event) error {
+		calls = append(calls, "first")
+		return nil
+	}, WithMode(Sync))
+	bus.Subscribe(UploadCompleted, func(ctx context.Context, e Event) error {
+		calls = append(calls, "second")
+		return nil
+	}, WithMode(Sync))
+	bus.Subscribe(UploadCompleted, func(ctx context.Context, e Event) error {
+		calls = append(calls, "async")
+		return nil
+	})
+
+	if err := bus.Emit(context.Background(), Event{Type: UploadCompleted}); err != nil {
+		t.Fatalf("Emit returned unexpected error: %v", err)
+	}
+
+	if len(calls) != 2 || calls[0] != "first" || calls[1] != "second" {
+		t.Errorf("Expected sync subscribers to run in order, got %v", calls)
+	}
+}
+
+func TestEmitStopsAtFirstRejection(t *testing.T) {
+	bus := NewBus()
+	errRejected := errors.New("rejected")
+
+	called := false
+	bus.Subscribe(UploadCreated, func(ctx context.Context, e Event) error {
+		return errRejected
+	}, WithMode(Sync))
+	bus.Subscribe(UploadCreated, func(ctx context.Context, e Event) error {
+		called = true
+		return nil
+	}, WithMode(Sync))
+
+	err := bus.Emit(context.Background(), Event{Type: UploadCreated})
+	if !errors.Is(err, errRejected) {
+		t.Errorf("Expected rejection error, got %v", err)
+	}
+	if called {
+		t.Error("Expected subscribers after a rejection not to run")
+	}
+}
+
+func TestNotifyRunsAsyncSubscribers(t *testing.T) {
+	bus := NewBus()
+
+	received := make(chan Event, 1)
+	bus.Subscribe(UploadCompleted, func(ctx context.Context, e Event) error {
+		received <- e
+		return nil
+	})
+	bus.Subscribe(UploadCompleted, func(ctx context.Context, e Event) error {
+		t.Error("Sync subscriber should not be invoked by Notify")
+		return nil
+	}, WithMode(Sync))
+
+	bus.Notify(context.Background(), Event{
+		Type:   UploadCompleted,
+		Upload: tusd.FileInfo{ID: "abc"},
+	})
+
+	select {
+	case e := <-received:
+		if e.Upload.ID != "abc" {
+			t.Errorf("Expected upload ID 'abc', got '%s'", e.Upload.ID)
+		}
+		if e.Time.IsZero() {
+			t.Error("Expected event time to be set")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Async subscriber was not invoked")
+	}
+}
+
+func TestOrderedSubscriberHandlesUploadsInOrder(t *testing.T) {
+	bus := NewBus()
+
+	var mu sync.Mutex
+	received := map[string][]int{}
+	done := make(chan struct{}, 20)
+	bus.Subscribe(UploadMilestone, func(ctx context.Context, e Event) error {
+		// Early milestones take longest, so unordered delivery would
+		// overtake them
+		time.Sleep(time.Duration(100-e.Milestone) * 50 * time.Microsecond)
+		mu.Lock()
+		received[e.Upload.ID] = append(received[e.Upload.ID], e.Milestone)
+		mu.Unlock()
+		done <- struct{}{}
+		return nil
+	}, Ordered())
+
+	for _, milestone := range []int{10, 25, 50, 75, 90, 100} {
+		for _, id := range []string{"a", "b"} {
+			bus.Notify(context.Background(), Event{Type: UploadMilestone, Upload: tusd.FileInfo{ID: id}, Milestone: milestone})
+		}
+	}
+	for range 12 {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("ordered subscriber was not invoked")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, id := range []string{"a", "b"} {
+		if !slices.Equal(received[id], []int{10, 25, 50, 75, 90, 100}) {
+			t.Fatalf("expected the milestones of %s in order, got %v", id, received[id])
+		}
+	}
+}
+
+func TestCloseWaitsForAsyncSubscribers(t *testing.T) {
+	bus := NewBus()
+
+	var handled atomic.Int32
+	slow := func(ctx context.Context, e Event) error {
+		time.Sleep(20 * time.Millisecond)
+		handled.Add(1)
+		return nil
+	}
+	bus.Subscribe(UploadCompleted, slow)
+	bus.Subscribe(UploadCompleted, slow, Ordered())
+
+	bus.Notify(context.Background(), Event{Type: UploadCompleted, Upload: tusd.FileInfo{ID: "a"}})
+	bus.Close()
+	if got := handled.Load(); got != 2 {
+		t.Fatalf("expected Close to wait for both subscribers, %d finished", got)
+	}
+
+	// The bus is closed, so later events are dropped
+	bus.Notify(context.Background(), Event{Type: UploadCompleted, Upload: tusd.FileInfo{ID: "a"}})
+	time.Sleep(50 * time.Millisecond)
+	if got := handled.Load(); got != 2 {
+		t.Fatalf("expected events notified after Close to be dropped, got %d handled", got)
+	}
+}
@@ -0,0 +1,168 @@
+// Package eventschema defines the payloads the server posts to consumers
+// as Go types and versioned JSON Schemas: completion and processing
+// callbacks, progress milestones, ban alerts, replayed event log records and
+// health reports.
+// Consumers decode into these types instead of keeping their own copies.
+package eventschema
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Version is the schema version every payload carries as schemaVersion.
+// Fields are only ever added within a version, so consumers must ignore
+// fields they don't know. Removing, renaming or changing the meaning of a
+// field bumps the version.
+const Version = 1
+
+// Names of the payload schemas
+const (
+	CompletionSchema   = "completion"
+	ProcessedSchema    = "processed"
+	MilestoneSchema    = "milestone"
+	BanAlertSchema     = "ban_alert"
+	RecordSchema       = "record"
+	HealthReportSchema = "health_report"
+)
+
+// ErrUnknownSchema is returned for schema names that don't exist
+var ErrUnknownSchema = errors.New("unknown event schema")
+
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+// Completion is posted to an upload's callback URL once it has completed
+type Completion struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	ID            string            `json:"id"`
+	Size          int64             `json:"size"`
+	MetaData      map[string]string `json:"metadata"`
+	Storage       map[string]string `json:"storage"`
+	Checksum      Checksum          `json:"checksum"`
+	CompletedAt   time.Time         `json:"completedAt"`
+
+	// Annotations are the results post-processors attached to the upload
+	// before it completed
+	Annotations map[string]json.RawMessage `json:"annotations,omitempty"`
+}
+
+// Processed is posted to an upload's callback URL once post-processing,
+// such as the antivirus scan, has decided its state
+type Processed struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	Event         string            `json:"event"`
+	ID            string            `json:"id"`
+	State         string            `json:"state"`
+	Size          int64             `json:"size"`
+	MetaData      map[string]string `json:"metadata"`
+	ProcessedAt   time.Time         `json:"processedAt"`
+
+	// Annotations are the results post-processors attached to the upload,
+	// including the antivirus verdict
+	Annotations map[string]json.RawMessage `json:"annotations,omitempty"`
+}
+
+// Checksum describes the digest of the uploaded content
+type Checksum struct {
+	Algorithm string `json:"algorithm"`
+	Value     string `json:"value"`
+}
+
+// Milestone is posted to an upload's progress URL when it passes a
+// progress milestone
+type Milestone struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	ID            string            `json:"id"`
+	Milestone     int               `json:"milestone"`
+	Offset        int64             `json:"offset"`
+	Size          int64             `json:"size"`
+	MetaData      map[string]string `json:"metadata"`
+	ReachedAt     time.Time         `json:"reachedAt"`
+}
+
+// BanAlert is posted to the ban list alert URL for every upload matching
+// the ban list
+type BanAlert struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	Event         string            `json:"event"`
+	UploadID      string            `json:"uploadId"`
+	Size          int64             `json:"size"`
+	MetaData      map[string]string `json:"metadata"`
+	Digest        string            `json:"digest"`
+	Reason        string            `json:"reason,omitempty"`
+	Source        string            `json:"source"`
+	DetectedAt    time.Time         `json:"detectedAt"`
+}
+
+// Record is posted for every event log record replayed to a sink. Replayed
+// lets consumers tell replays from live deliveries.
+type Record struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	Seq           int64             `json:"seq"`
+	Type          string            `json:"type"`
+	UploadID      string            `json:"uploadId"`
+	Size          int64             `json:"size"`
+	Offset        int64             `json:"offset"`
+	MetaData      map[string]string `json:"metadata,omitempty"`
+	Storage       map[string]string `json:"storage,omitempty"`
+	Time          time.Time         `json:"time"`
+	Replayed      bool              `json:"replayed"`
+
+	// Annotations are the results post-processors attached to the upload
+	Annotations map[string]json.RawMessage `json:"annotations,omitempty"`
+}
+
+// HealthReport is posted to the report URL at the end of every report
+// period. Text summarizes it for chat webhooks, such as Slack's, that only
+// look at the text.
+type HealthReport struct {
+	SchemaVersion int `json:"schemaVersion"`
+
+	// Instance names the server the counts were kept by
+	Instance       string    `json:"instance"`
+	Text           string    `json:"text"`
+	From           time.Time `json:"from"`
+	To             time.Time `json:"to"`
+	Created        int64     `json:"created"`
+	Completed      int64     `json:"completed"`
+	CompletedBytes int64     `json:"completedBytes"`
+
+	// Failures counts failures by kind
+	Failures       map[string]int64 `json:"failures"`
+	Reclaimed      int64            `json:"reclaimed"`
+	ReclaimedBytes int64            `json:"reclaimedBytes"`
+
+	// QuotaBreaches counts uploads refused by a tenant quota by tenant,
+	// StorageQuotaBreaches those refused by the storage backend's quota
+	QuotaBreaches        map[string]int64 `json:"quotaBreaches"`
+	StorageQuotaBreaches int64            `json:"storageQuotaBreaches"`
+	TopTenants           []TenantUsage    `json:"topTenants"`
+}
+
+// TenantUsage is what a tenant uploaded during a report period
+type TenantUsage struct {
+	Tenant  string `json:"tenant"`
+	Uploads int64  `json:"uploads"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// Names returns the names of all payload schemas, sorted
+func Names() []string {
+	names := []string{CompletionSchema, ProcessedSchema, MilestoneSchema, BanAlertSchema, RecordSchema, HealthReportSchema}
+	sort.Strings(names)
+	return names
+}
+
+// Schema returns the JSON Schema of a payload in the current version
+func Schema(name string) (json.RawMessage, error) {
+	data, err := schemaFiles.ReadFile(fmt.Sprintf("schemas/%s.v%d.json", name, Version))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSchema, name)
+	}
+	return data, nil
+}
@@ -0,0 +1,65 @@
+package eventschema
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// schemaDocument is the part of a JSON Schema the tests look at
+type schemaDocument struct {
+	Required   []string                   `json:"required"`
+	Properties map[string]json.RawMessage `json:"properties"`
+}
+
+func TestSchemasMatchTypes(t *testing.T) {
+	types := map[string]any{
+		CompletionSchema:   Completion{},
+		ProcessedSchema:    Processed{},
+		MilestoneSchema:    Milestone{},
+		BanAlertSchema:     BanAlert{},
+		RecordSchema:       Record{},
+		HealthReportSchema: HealthReport{},
+	}
+	if len(types) != len(Names()) {
+		t.Fatalf("expected a type for every schema, got %v", Names())
+	}
+
+	for name, value := range types {
+		data, err := Schema(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc schemaDocument
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Fatalf("%s: invalid schema: %v", name, err)
+		}
+
+		typ := reflect.TypeOf(value)
+		var fields []string
+		for i := range typ.NumField() {
+			tag, options, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+			fields = append(fields, tag)
+			if _, ok := doc.Properties[tag]; !ok {
+				t.Errorf("%s: field %s is missing from the schema", name, tag)
+			}
+			if required := slices.Contains(doc.Required, tag); required == (options == "omitempty") {
+				t.Errorf("%s: field %s is required %v in the schema, but omitempty is %q", name, tag, required, options)
+			}
+		}
+		for property := range doc.Properties {
+			if !slices.Contains(fields, property) {
+				t.Errorf("%s: property %s has no field", name, property)
+			}
+		}
+	}
+}
+
+func TestUnknownSchema(t *testing.T) {
+	if _, err := Schema("nope"); !errors.Is(err, ErrUnknownSchema) {
+		t.Fatalf("expected ErrUnknownSchema, got %v", err)
+	}
+}
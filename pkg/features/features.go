@@ -0,0 +1,265 @@
+// Package features gates experimental subsystems behind flags, so they can
+// be enabled per environment or per tenant from the config file, and
+// switched at runtime through the admin API without a deploy
+package features
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Flags of the subsystems the server gates
+const (
+	// TusV2 accepts uploads with the IETF resumable uploads draft, the
+	// successor of tus v1, alongside tus v1
+	TusV2 = "tusV2"
+
+	// Dedup stores completed uploads by content, so identical uploads share
+	// their storage, when content-addressable storage is configured
+	Dedup = "dedup"
+)
+
+// refreshInterval is how often the overrides are read from the store, so
+// changes made by instances sharing it are picked up
+const refreshInterval = 10 * time.Second
+
+// namePattern restricts flag names to characters that are safe in URLs and
+// file names
+var namePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]{0,63}$`)
+
+// tenantPattern matches the tenants of upload IDs
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Common errors returned by flag operations
+var (
+	ErrNotFound = errors.New("feature flag not found")
+	ErrInvalid  = errors.New("invalid feature flag")
+)
+
+// Definition is the configured state of a flag
+type Definition struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+
+	// Enabled is the state of the flag unless overridden
+	Enabled bool `json:"enabled"`
+
+	// Environments and Tenants override the state in an environment or for
+	// a tenant, the tenant taking precedence
+	Environments map[string]bool `json:"environments,omitempty"`
+	Tenants      map[string]bool `json:"tenants,omitempty"`
+}
+
+// Override is a state of a flag set at runtime, for one tenant or, with an
+// empty tenant, for all of them
+type Override struct {
+	Flag      string    `json:"flag"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Enabled   bool      `json:"enabled"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Status is the state of a flag in the running environment
+type Status struct {
+	Definition
+
+	// Effective is the state of the flag for tenants without an override
+	Effective bool `json:"effective"`
+
+	// Overrides are the states set at runtime
+	Overrides []Override `json:"overrides"`
+}
+
+// Store persists the overrides set at runtime
+type Store interface {
+	Put(ctx context.Context, override Override) error
+	Get(ctx context.Context, flag, tenant string) (Override, error)
+	List(ctx context.Context) ([]Override, error)
+	Delete(ctx context.Context, flag, tenant string) error
+}
+
+// Registry resolves the state of flags. Runtime overrides take precedence
+// over the configuration, and at each level the state for a tenant over the
+// state for everyone, so a flag can be switched off everywhere at runtime.
+// Overrides are cached in memory, written through on changes and re-read
+// from the store every few seconds.
+type Registry struct {
+	environment string
+	flags       map[string]Definition
+	store       Store
+	now         func() time.Time
+
+	mu        sync.RWMutex
+	overrides map[string]Override // by overrideID, nil until read
+	readAt    time.Time
+}
+
+// New creates a registry of the defined flags for an environment, keeping
+// runtime overrides in the store
+func New(environment string, flags []Definition, store Store) (*Registry, error) {
+	r := &Registry{environment: environment, flags: make(map[string]Definition, len(flags)), store: store, now: time.Now}
+	for _, flag := range flags {
+		if !namePattern.MatchString(flag.Name) {
+			return nil, fmt.Errorf("%w: name %q", ErrInvalid, flag.Name)
+		}
+		for tenant := range flag.Tenants {
+			if !tenantPattern.MatchString(tenant) {
+				return nil, fmt.Errorf("%w: tenant %q of %s", ErrInvalid, tenant, flag.Name)
+			}
+		}
+		r.flags[flag.Name] = flag
+	}
+	return r, nil
+}
+
+// Enabled reports whether a flag is on for a tenant, which may be empty.
+// Unknown flags are off, and runtime overrides that can't be read are
+// ignored.
+func (r *Registry) Enabled(ctx context.Context, name, tenant string) bool {
+	flag, ok := r.flags[name]
+	if !ok {
+		return false
+	}
+
+	if tenant != "" {
+		if enabled, ok := r.override(ctx, name, tenant); ok {
+			return enabled
+		}
+	}
+	if enabled, ok := r.override(ctx, name, ""); ok {
+		return enabled
+	}
+	if enabled, ok := flag.Tenants[tenant]; ok && tenant != "" {
+		return enabled
+	}
+	return r.configured(flag)
+}
+
+// configured returns the configured state of a flag in the environment
+func (r *Registry) configured(flag Definition) bool {
+	if enabled, ok := flag.Environments[r.environment]; ok {
+		return enabled
+	}
+	return flag.Enabled
+}
+
+// override returns the runtime state of a flag for a tenant
+func (r *Registry) override(ctx context.Context, name, tenant string) (bool, bool) {
+	r.refresh(ctx)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	o, ok := r.overrides[overrideID(name, tenant)]
+	return o.Enabled, ok
+}
+
+// refresh re-reads the cached overrides once they are older than the
+// refresh interval. If the store can't be read, the cached ones are kept.
+func (r *Registry) refresh(ctx context.Context) {
+	r.mu.RLock()
+	fresh := r.overrides != nil && r.now().Sub(r.readAt) < refreshInterval
+	r.mu.RUnlock()
+	if fresh {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.overrides != nil && r.now().Sub(r.readAt) < refreshInterval {
+		return
+	}
+	r.readAt = r.now()
+	list, err := r.store.List(ctx)
+	if err != nil {
+		slog.Warn("Failed to read feature flag overrides", "error", err)
+		if r.overrides == nil {
+			r.overrides = make(map[string]Override)
+		}
+		return
+	}
+	r.overrides = make(map[string]Override, len(list))
+	for _, o := range list {
+		r.overrides[overrideID(o.Flag, o.Tenant)] = o
+	}
+}
+
+// Set overrides the state of a flag at runtime, for a tenant or, with an
+// empty tenant, for everyone
+func (r *Registry) Set(ctx context.Context, name, tenant string, enabled bool) (Override, error) {
+	if _, ok := r.flags[name]; !ok {
+		return Override{}, ErrNotFound
+	}
+	if tenant != "" && !tenantPattern.MatchString(tenant) {
+		return Override{}, fmt.Errorf("%w: tenant %q", ErrInvalid, tenant)
+	}
+	o := Override{Flag: name, Tenant: tenant, Enabled: enabled, UpdatedAt: r.now().UTC()}
+	if err := r.store.Put(ctx, o); err != nil {
+		return Override{}, err
+	}
+
+	r.mu.Lock()
+	if r.overrides != nil {
+		r.overrides[overrideID(name, tenant)] = o
+	}
+	r.mu.Unlock()
+	return o, nil
+}
+
+// Reset removes a runtime override, returning to the configured state
+func (r *Registry) Reset(ctx context.Context, name, tenant string) error {
+	if _, ok := r.flags[name]; !ok {
+		return ErrNotFound
+	}
+	err := r.store.Delete(ctx, name, tenant)
+	if err == nil || errors.Is(err, ErrNotFound) {
+		r.mu.Lock()
+		delete(r.overrides, overrideID(name, tenant))
+		r.mu.Unlock()
+	}
+	return err
+}
+
+// Get returns the state of a flag
+func (r *Registry) Get(ctx context.Context, name string) (Status, error) {
+	flag, ok := r.flags[name]
+	if !ok {
+		return Status{}, ErrNotFound
+	}
+	overrides, err := r.store.List(ctx)
+	if err != nil {
+		return Status{}, err
+	}
+	return r.status(ctx, flag, overrides), nil
+}
+
+// List returns the state of all flags, sorted by name
+func (r *Registry) List(ctx context.Context) ([]Status, error) {
+	overrides, err := r.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, 0, len(r.flags))
+	for _, flag := range r.flags {
+		statuses = append(statuses, r.status(ctx, flag, overrides))
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses, nil
+}
+
+// status combines a flag with its runtime overrides
+func (r *Registry) status(ctx context.Context, flag Definition, overrides []Override) Status {
+	status := Status{Definition: flag, Effective: r.Enabled(ctx, flag.Name, ""), Overrides: []Override{}}
+	for _, o := range overrides {
+		if o.Flag == flag.Name {
+			status.Overrides = append(status.Overrides, o)
+		}
+	}
+	sort.Slice(status.Overrides, func(i, j int) bool { return status.Overrides[i].Tenant < status.Overrides[j].Tenant })
+	return status
+}
@@ -0,0 +1,167 @@
+package features
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEnabled(t *testing.T) {
+	ctx := context.Background()
+	flags := []Definition{
+		{Name: TusV2, Environments: map[string]bool{"staging": true}, Tenants: map[string]bool{"acme": true}},
+		{Name: Dedup, Enabled: true, Environments: map[string]bool{"production": false}, Tenants: map[string]bool{"globex": true}},
+	}
+
+	staging, err := New("staging", flags, NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	production, err := New("production", flags, NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		registry *Registry
+		flag     string
+		tenant   string
+		want     bool
+	}{
+		{staging, TusV2, "", true},
+		{production, TusV2, "", false},
+		{production, TusV2, "acme", true},
+		{staging, Dedup, "initech", true},
+		{production, Dedup, "initech", false},
+		{production, Dedup, "globex", true},
+		{staging, "grpcUploads", "", false},
+	}
+	for _, tt := range tests {
+		if got := tt.registry.Enabled(ctx, tt.flag, tt.tenant); got != tt.want {
+			t.Errorf("%s in %s for %q: got %v, want %v", tt.flag, tt.registry.environment, tt.tenant, got, tt.want)
+		}
+	}
+
+	if _, err := New("", []Definition{{Name: "tus v2"}}, NewMemoryStore()); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected ErrInvalid for an invalid name, got %v", err)
+	}
+	if _, err := New("", []Definition{{Name: TusV2, Tenants: map[string]bool{"../acme": true}}}, NewMemoryStore()); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected ErrInvalid for an invalid tenant, got %v", err)
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range map[string]Store{"memory": NewMemoryStore(), "file": mustFileStore(t)} {
+		registry, err := New("production", []Definition{{Name: TusV2, Tenants: map[string]bool{"acme": true}}}, store)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A runtime override for everyone takes precedence over configured tenants
+		if _, err := registry.Set(ctx, TusV2, "", false); err != nil {
+			t.Fatal(err)
+		}
+		if registry.Enabled(ctx, TusV2, "acme") {
+			t.Fatalf("%s: expected the runtime override to switch the flag off for acme", name)
+		}
+		if _, err := registry.Set(ctx, TusV2, "globex", true); err != nil {
+			t.Fatal(err)
+		}
+		if !registry.Enabled(ctx, TusV2, "globex") || registry.Enabled(ctx, TusV2, "initech") {
+			t.Fatalf("%s: expected the flag on for globex only", name)
+		}
+
+		status, err := registry.Get(ctx, TusV2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Effective || len(status.Overrides) != 2 || status.Overrides[0].Tenant != "" || status.Overrides[1].Tenant != "globex" {
+			t.Fatalf("%s: unexpected status %+v", name, status)
+		}
+
+		// Resetting returns to the configuration
+		if err := registry.Reset(ctx, TusV2, ""); err != nil {
+			t.Fatal(err)
+		}
+		if !registry.Enabled(ctx, TusV2, "acme") {
+			t.Fatalf("%s: expected the configured tenant state after a reset", name)
+		}
+		if err := registry.Reset(ctx, TusV2, ""); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("%s: expected ErrNotFound resetting twice, got %v", name, err)
+		}
+
+		if _, err := registry.Set(ctx, "unknown", "", true); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("%s: expected ErrNotFound for an unknown flag, got %v", name, err)
+		}
+		if _, err := registry.Set(ctx, TusV2, "../acme", true); !errors.Is(err, ErrInvalid) {
+			t.Fatalf("%s: expected ErrInvalid for an invalid tenant, got %v", name, err)
+		}
+	}
+}
+
+// mustFileStore creates a file store in a temporary directory
+func mustFileStore(t *testing.T) *FileStore {
+	t.Helper()
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// countingStore counts the reads of a store
+type countingStore struct {
+	Store
+	reads int
+}
+
+func (s *countingStore) Get(ctx context.Context, flag, tenant string) (Override, error) {
+	s.reads++
+	return s.Store.Get(ctx, flag, tenant)
+}
+
+func (s *countingStore) List(ctx context.Context) ([]Override, error) {
+	s.reads++
+	return s.Store.List(ctx)
+}
+
+func TestOverridesCached(t *testing.T) {
+	ctx := context.Background()
+	shared := mustFileStore(t)
+	store := &countingStore{Store: shared}
+	registry, err := New("production", []Definition{{Name: TusV2}}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	registry.now = func() time.Time { return now }
+
+	for range 10 {
+		registry.Enabled(ctx, TusV2, "acme")
+	}
+	if store.reads != 1 {
+		t.Fatalf("expected the overrides to be read once, got %d reads", store.reads)
+	}
+
+	// Changes through the registry are written through
+	if _, err := registry.Set(ctx, TusV2, "acme", true); err != nil {
+		t.Fatal(err)
+	}
+	if !registry.Enabled(ctx, TusV2, "acme") || store.reads != 1 {
+		t.Fatalf("expected the override to apply without a read, got %d reads", store.reads)
+	}
+
+	// Changes by other instances are picked up after the refresh interval
+	if err := shared.Put(ctx, Override{Flag: TusV2, Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	if registry.Enabled(ctx, TusV2, "globex") {
+		t.Fatal("expected the cached overrides until the refresh interval passed")
+	}
+	now = now.Add(refreshInterval)
+	if !registry.Enabled(ctx, TusV2, "globex") {
+		t.Fatal("expected the override of another instance after the refresh interval")
+	}
+}
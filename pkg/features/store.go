@@ -0,0 +1,83 @@
+package features
+
+import (
+	"context"
+
+	"github.com/devsnb/large-file-uploads/pkg/internal/jsonstore"
+)
+
+// overrideID returns the ID an override of a flag for a tenant is stored
+// under. Flag names and tenants can't contain dots, so the flag's ID never
+// collides with a tenant's.
+func overrideID(flag, tenant string) string {
+	if tenant == "" {
+		return flag
+	}
+	return flag + "." + tenant
+}
+
+// MemoryStore keeps overrides in memory. They are lost on restart.
+type MemoryStore struct {
+	overrides *jsonstore.Memory[Override]
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{overrides: jsonstore.NewMemory[Override](ErrNotFound)}
+}
+
+// Put inserts or replaces an override
+func (s *MemoryStore) Put(ctx context.Context, override Override) error {
+	s.overrides.Put(overrideID(override.Flag, override.Tenant), override)
+	return nil
+}
+
+// Get returns the override of a flag for a tenant
+func (s *MemoryStore) Get(ctx context.Context, flag, tenant string) (Override, error) {
+	return s.overrides.Get(overrideID(flag, tenant))
+}
+
+// List returns all overrides
+func (s *MemoryStore) List(ctx context.Context) ([]Override, error) {
+	return s.overrides.List(), nil
+}
+
+// Delete removes the override of a flag for a tenant
+func (s *MemoryStore) Delete(ctx context.Context, flag, tenant string) error {
+	return s.overrides.Delete(overrideID(flag, tenant))
+}
+
+// FileStore persists each override as a JSON file in a directory, so
+// instances sharing it see the same overrides
+type FileStore struct {
+	overrides *jsonstore.Dir[Override]
+}
+
+// NewFileStore creates a file store, creating the directory if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	overrides, err := jsonstore.NewDir[Override](dir, "feature flag override", ErrNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{overrides: overrides}, nil
+}
+
+// Put inserts or replaces an override
+func (s *FileStore) Put(ctx context.Context, override Override) error {
+	return s.overrides.Put(overrideID(override.Flag, override.Tenant), override)
+}
+
+// Get returns the override of a flag for a tenant
+func (s *FileStore) Get(ctx context.Context, flag, tenant string) (Override, error) {
+	return s.overrides.Get(overrideID(flag, tenant))
+}
+
+// List returns all overrides
+func (s *FileStore) List(ctx context.Context) ([]Override, error) {
+	return s.overrides.List()
+}
+
+// Delete removes the override of a flag for a tenant
+func (s *FileStore) Delete(ctx context.Context, flag, tenant string) error {
+	return s.overrides.Delete(overrideID(flag, tenant))
+}
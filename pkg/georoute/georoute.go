@@ -0,0 +1,70 @@
+// Package georoute selects the storage region closest to a client, from an
+// explicit region header or the country a CDN or load balancer resolved
+// the client's address to
+package georoute
+
+import (
+	"net/http"
+	"strings"
+)
+
+// DefaultRegionHeader lets clients request a region explicitly
+const DefaultRegionHeader = "X-Client-Region"
+
+// Policy maps requests to regions
+type Policy struct {
+	regionHeader  string
+	countryHeader string
+	countries     map[string]string
+}
+
+// NewPolicy creates a policy. countryHeader names a header carrying the
+// client's ISO country code, e.g. CloudFront-Viewer-Country, and regions
+// lists the countries each region serves.
+func NewPolicy(regionHeader, countryHeader string, regions map[string][]string) *Policy {
+	if regionHeader == "" {
+		regionHeader = DefaultRegionHeader
+	}
+
+	countries := make(map[string]string)
+	for region, codes := range regions {
+		for _, code := range codes {
+			countries[strings.ToUpper(strings.TrimSpace(code))] = region
+		}
+	}
+
+	return &Policy{
+		regionHeader:  regionHeader,
+		countryHeader: countryHeader,
+		countries:     countries,
+	}
+}
+
+// Select returns the region of available that should serve the request, or
+// an empty string for the default region. An explicit region header takes
+// precedence over the client's country.
+func (p *Policy) Select(r *http.Request, available []string) string {
+	if requested := strings.TrimSpace(r.Header.Get(p.regionHeader)); requested != "" {
+		for _, region := range available {
+			if strings.EqualFold(region, requested) {
+				return region
+			}
+		}
+	}
+
+	if p.countryHeader == "" {
+		return ""
+	}
+
+	country := strings.ToUpper(strings.TrimSpace(r.Header.Get(p.countryHeader)))
+	region, ok := p.countries[country]
+	if !ok {
+		return ""
+	}
+	for _, candidate := range available {
+		if candidate == region {
+			return region
+		}
+	}
+	return ""
+}
@@ -0,0 +1,41 @@
+package georoute
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPolicySelect(t *testing.T) {
+	policy := NewPolicy("", "CloudFront-Viewer-Country", map[string][]string{
+		"eu-west-1":      {"de", "FR"},
+		"ap-southeast-1": {"SG"},
+		"sa-east-1":      {"BR"},
+	})
+	available := []string{"us-east-1", "eu-west-1", "ap-southeast-1"}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{"no hints", nil, ""},
+		{"explicit region", map[string]string{"X-Client-Region": "AP-southeast-1"}, "ap-southeast-1"},
+		{"explicit region wins", map[string]string{"X-Client-Region": "ap-southeast-1", "CloudFront-Viewer-Country": "DE"}, "ap-southeast-1"},
+		{"unknown explicit region", map[string]string{"X-Client-Region": "mars-1", "CloudFront-Viewer-Country": "DE"}, "eu-west-1"},
+		{"country", map[string]string{"CloudFront-Viewer-Country": "fr"}, "eu-west-1"},
+		{"unmapped country", map[string]string{"CloudFront-Viewer-Country": "US"}, ""},
+		{"region without replica", map[string]string{"CloudFront-Viewer-Country": "BR"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			if got := policy.Select(r, available); got != tt.want {
+				t.Fatalf("Select = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
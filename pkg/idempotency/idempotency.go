@@ -0,0 +1,133 @@
+// Package idempotency remembers the responses to requests carrying an
+// Idempotency-Key header, so client retries after network failures replay
+// the original response instead of creating duplicate resources
+package idempotency
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Header is the request header carrying the client-chosen key
+const Header = "Idempotency-Key"
+
+// ReplayedHeader marks responses that were replayed from the cache
+const ReplayedHeader = "Idempotent-Replayed"
+
+// DefaultWindow is how long responses are remembered unless configured
+const DefaultWindow = 24 * time.Hour
+
+// MaxKeyLength bounds the length of accepted keys
+const MaxKeyLength = 255
+
+// pruneInterval limits how often expired entries are swept
+const pruneInterval = time.Minute
+
+// Errors returned when a key can't be used for a request
+var (
+	ErrInProgress = errors.New("a request with this idempotency key is still in progress")
+	ErrKeyReused  = errors.New("idempotency key was already used for a different request")
+)
+
+// Response is a remembered response
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// entry is the state of a key. Its response is nil while the first request
+// is still being handled.
+type entry struct {
+	fingerprint string
+	response    *Response
+	expiresAt   time.Time
+}
+
+// Cache remembers responses by key for a fixed window
+type Cache struct {
+	window    time.Duration
+	mu        sync.Mutex
+	entries   map[string]*entry
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+// NewCache creates a cache remembering responses for the given window
+func NewCache(window time.Duration) *Cache {
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	return &Cache{
+		window:  window,
+		entries: make(map[string]*entry),
+		now:     time.Now,
+	}
+}
+
+// Begin looks up a key. It returns the remembered response for repeats of a
+// completed request. Otherwise it reserves the key and returns nil; the
+// caller must then call Complete or Release. The fingerprint identifies the
+// request, so a key reused for a different request is rejected.
+func (c *Cache) Begin(key, fingerprint string) (*Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.prune(now)
+
+	if e, ok := c.entries[key]; ok && now.Before(e.expiresAt) {
+		switch {
+		case e.fingerprint != fingerprint:
+			return nil, ErrKeyReused
+		case e.response == nil:
+			return nil, ErrInProgress
+		default:
+			return e.response, nil
+		}
+	}
+
+	c.entries[key] = &entry{
+		fingerprint: fingerprint,
+		expiresAt:   now.Add(c.window),
+	}
+	return nil, nil
+}
+
+// Complete remembers the response to a reserved key
+func (c *Cache) Complete(key string, response Response) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		e.response = &response
+		e.expiresAt = c.now().Add(c.window)
+	}
+}
+
+// Release frees a reserved key without remembering a response, so the
+// request can be retried, e.g. after it failed
+func (c *Cache) Release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok && e.response == nil {
+		delete(c.entries, key)
+	}
+}
+
+// prune drops expired entries, at most once per interval
+func (c *Cache) prune(now time.Time) {
+	if now.Sub(c.lastPrune) < pruneInterval {
+		return
+	}
+	c.lastPrune = now
+
+	for key, e := range c.entries {
+		if !now.Before(e.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package idempotency
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	now := time.Now()
+	cache := NewCache(time.Hour)
+	cache.now = func() time.Time { return now }
+
+	if resp, err := cache.Begin("k", "POST /files/"); resp != nil || err != nil {
+		t.Fatalf("expected reservation, got %v, %v", resp, err)
+	}
+	if _, err := cache.Begin("k", "POST /files/"); !errors.Is(err, ErrInProgress) {
+		t.Fatalf("expected in progress, got %v", err)
+	}
+
+	cache.Complete("k", Response{
+		Status: http.StatusCreated,
+		Header: http.Header{"Location": {"/files/abc"}},
+	})
+
+	resp, err := cache.Begin("k", "POST /files/")
+	if err != nil || resp == nil || resp.Header.Get("Location") != "/files/abc" {
+		t.Fatalf("expected replay, got %v, %v", resp, err)
+	}
+	if _, err := cache.Begin("k", "POST /api/other"); !errors.Is(err, ErrKeyReused) {
+		t.Fatalf("expected key reuse, got %v", err)
+	}
+
+	// Keys can be used again once the window has passed
+	now = now.Add(2 * time.Hour)
+	if resp, err := cache.Begin("k", "POST /api/other"); resp != nil || err != nil {
+		t.Fatalf("expected reservation after expiry, got %v, %v", resp, err)
+	}
+}
+
+func TestCacheRelease(t *testing.T) {
+	cache := NewCache(time.Hour)
+
+	if _, err := cache.Begin("k", "a"); err != nil {
+		t.Fatal(err)
+	}
+	cache.Release("k")
+
+	if resp, err := cache.Begin("k", "a"); resp != nil || err != nil {
+		t.Fatalf("expected released key to be reusable, got %v, %v", resp, err)
+	}
+}
@@ -0,0 +1,140 @@
+// Package intake manages named upload configurations that bundle the limits,
+// key prefix and notification target of one upload use case, so new use
+// cases can be set up through the API instead of a config deploy
+package intake
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/devsnb/large-file-uploads/pkg/internal/uploadpolicy"
+)
+
+// MaxNameLen limits intake names
+const MaxNameLen = 128
+
+// Common errors returned by intake operations
+var (
+	ErrNotFound = errors.New("intake not found")
+	ErrExpired  = errors.New("intake expired")
+	ErrInvalid  = errors.New("invalid intake")
+)
+
+// Intake is the configuration uploads created against it must satisfy
+type Intake struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	AllowedTypes []string   `json:"allowedTypes,omitempty"` // Empty allows all types
+	MaxSize      int64      `json:"maxSize,omitempty"`      // bytes, 0 for no limit
+	Prefix       string     `json:"prefix,omitempty"`       // Key prefix of uploads
+	NotifyURL    string     `json:"notifyUrl,omitempty"`    // Notified when uploads complete
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`    // No uploads can be created afterwards
+	CreatedAt    time.Time  `json:"createdAt"`
+
+	// DisableTermination refuses terminations of uploads created against
+	// the intake
+	DisableTermination bool `json:"disableTermination,omitempty"`
+}
+
+// Expired reports whether uploads can no longer be created against the
+// intake
+func (i Intake) Expired(now time.Time) bool {
+	return i.ExpiresAt != nil && !now.Before(*i.ExpiresAt)
+}
+
+// Store persists intakes
+type Store interface {
+	Put(ctx context.Context, intake Intake) error
+	Get(ctx context.Context, id string) (Intake, error)
+	List(ctx context.Context) ([]Intake, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// Registry validates and stores intakes
+type Registry struct {
+	store Store
+	now   func() time.Time
+}
+
+// NewRegistry creates a registry backed by the store
+func NewRegistry(store Store) *Registry {
+	return &Registry{store: store, now: time.Now}
+}
+
+// Create validates an intake and stores it under a new ID
+func (r *Registry) Create(ctx context.Context, intake Intake) (Intake, error) {
+	intake.Name = strings.TrimSpace(intake.Name)
+	if intake.Name == "" || len(intake.Name) > MaxNameLen {
+		return Intake{}, fmt.Errorf("%w: name must be 1 to %d characters", ErrInvalid, MaxNameLen)
+	}
+	if intake.MaxSize < 0 {
+		return Intake{}, fmt.Errorf("%w: maxSize must not be negative", ErrInvalid)
+	}
+	if intake.Prefix != "" && !uploadpolicy.ValidPrefix(intake.Prefix) {
+		return Intake{}, fmt.Errorf("%w: prefix must match %s", ErrInvalid, uploadpolicy.PrefixPattern)
+	}
+	types, err := uploadpolicy.NormalizeTypes(intake.AllowedTypes)
+	if err != nil {
+		return Intake{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	intake.AllowedTypes = types
+
+	now := r.now()
+	if intake.ExpiresAt != nil && !intake.ExpiresAt.After(now) {
+		return Intake{}, fmt.Errorf("%w: expiresAt must be in the future", ErrInvalid)
+	}
+
+	intake.ID = newID()
+	intake.CreatedAt = now
+	if err := r.store.Put(ctx, intake); err != nil {
+		return Intake{}, fmt.Errorf("failed to store intake: %w", err)
+	}
+	return intake, nil
+}
+
+// Get returns an intake, including expired ones
+func (r *Registry) Get(ctx context.Context, id string) (Intake, error) {
+	return r.store.Get(ctx, id)
+}
+
+// Resolve returns an intake uploads can currently be created against
+func (r *Registry) Resolve(ctx context.Context, id string) (Intake, error) {
+	intake, err := r.store.Get(ctx, id)
+	if err != nil {
+		return Intake{}, err
+	}
+	if intake.Expired(r.now()) {
+		return intake, ErrExpired
+	}
+	return intake, nil
+}
+
+// List returns all intakes, newest first
+func (r *Registry) List(ctx context.Context) ([]Intake, error) {
+	intakes, err := r.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(intakes, func(i, j int) bool {
+		return intakes[i].CreatedAt.After(intakes[j].CreatedAt)
+	})
+	return intakes, nil
+}
+
+// Delete removes an intake. Uploads created against it are kept.
+func (r *Registry) Delete(ctx context.Context, id string) error {
+	return r.store.Delete(ctx, id)
+}
+
+// newID generates a random intake ID
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,65 @@
+package intake
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := NewRegistry(store)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	registry.now = func() time.Time { return now }
+
+	expires := now.Add(time.Hour)
+	created, err := registry.Create(ctx, Intake{
+		Name:         " Receipts ",
+		AllowedTypes: []string{"Image/*", "application/pdf"},
+		MaxSize:      10 << 20,
+		Prefix:       "receipts",
+		ExpiresAt:    &expires,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == "" || created.Name != "Receipts" || created.AllowedTypes[0] != "image/*" {
+		t.Fatalf("unexpected intake %+v", created)
+	}
+
+	if _, err := registry.Resolve(ctx, created.ID); err != nil {
+		t.Fatalf("Resolve = %v", err)
+	}
+	now = expires
+	if _, err := registry.Resolve(ctx, created.ID); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expected ErrExpired, got %v", err)
+	}
+	if _, err := registry.Get(ctx, created.ID); err != nil {
+		t.Fatalf("Get of expired intake = %v", err)
+	}
+
+	invalid := []Intake{
+		{Name: ""},
+		{Name: "x", MaxSize: -1},
+		{Name: "x", Prefix: "../etc"},
+		{Name: "x", AllowedTypes: []string{"pdf"}},
+		{Name: "x", ExpiresAt: &now},
+	}
+	for _, in := range invalid {
+		if _, err := registry.Create(ctx, in); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Create(%+v) error = %v, want ErrInvalid", in, err)
+		}
+	}
+
+	if err := registry.Delete(ctx, created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Resolve(ctx, created.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package intake
+
+import (
+	"context"
+
+	"github.com/devsnb/large-file-uploads/pkg/internal/jsonstore"
+)
+
+// MemoryStore keeps intakes in memory. They are lost on restart.
+type MemoryStore struct {
+	intakes *jsonstore.Memory[Intake]
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{intakes: jsonstore.NewMemory[Intake](ErrNotFound)}
+}
+
+// Put inserts or replaces an intake
+func (s *MemoryStore) Put(ctx context.Context, intake Intake) error {
+	s.intakes.Put(intake.ID, intake)
+	return nil
+}
+
+// Get returns an intake by ID
+func (s *MemoryStore) Get(ctx context.Context, id string) (Intake, error) {
+	return s.intakes.Get(id)
+}
+
+// List returns all intakes
+func (s *MemoryStore) List(ctx context.Context) ([]Intake, error) {
+	return s.intakes.List(), nil
+}
+
+// Delete removes an intake
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	return s.intakes.Delete(id)
+}
+
+// FileStore persists each intake as a JSON file in a directory
+type FileStore struct {
+	intakes *jsonstore.Dir[Intake]
+}
+
+// NewFileStore creates a file store, creating the directory if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	intakes, err := jsonstore.NewDir[Intake](dir, "intake", ErrNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{intakes: intakes}, nil
+}
+
+// Put inserts or replaces an intake
+func (s *FileStore) Put(ctx context.Context, intake Intake) error {
+	return s.intakes.Put(intake.ID, intake)
+}
+
+// Get returns an intake by ID
+func (s *FileStore) Get(ctx context.Context, id string) (Intake, error) {
+	return s.intakes.Get(id)
+}
+
+// List returns all intakes
+func (s *FileStore) List(ctx context.Context) ([]Intake, error) {
+	return s.intakes.List()
+}
+
+// Delete removes an intake
+func (s *FileStore) Delete(ctx context.Context, id string) error {
+	return s.intakes.Delete(id)
+}
@@ -0,0 +1,292 @@
+// Package jsonstore keeps records as JSON, in memory or as files in a
+// directory. The packages persisting records build their stores on it.
+package jsonstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Memory keeps records of one type in memory, keyed by ID. Records are lost
+// on restart.
+type Memory[T any] struct {
+	notFound error
+
+	mu      sync.RWMutex
+	records map[string]T
+}
+
+// NewMemory creates an empty in-memory store. Lookups of missing IDs return
+// notFound.
+func NewMemory[T any](notFound error) *Memory[T] {
+	return &Memory[T]{notFound: notFound, records: make(map[string]T)}
+}
+
+// Put inserts or replaces a record
+func (m *Memory[T]) Put(id string, record T) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records[id] = record
+}
+
+// Get returns a record
+func (m *Memory[T]) Get(id string) (T, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	record, ok := m.records[id]
+	if !ok {
+		return record, m.notFound
+	}
+	return record, nil
+}
+
+// List returns all records
+func (m *Memory[T]) List() []T {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	records := make([]T, 0, len(m.records))
+	for _, record := range m.records {
+		records = append(records, record)
+	}
+	return records
+}
+
+// Walk calls fn for each record until it returns an error. Records put
+// while walking may be missed.
+func (m *Memory[T]) Walk(fn func(T) error) error {
+	for _, record := range m.List() {
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes a record
+func (m *Memory[T]) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.records[id]; !ok {
+		return m.notFound
+	}
+	delete(m.records, id)
+	return nil
+}
+
+// DeleteFunc removes the records for which drop returns true
+func (m *Memory[T]) DeleteFunc(drop func(T) bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, record := range m.records {
+		if drop(record) {
+			delete(m.records, id)
+		}
+	}
+}
+
+// Dir persists records of one type as JSON files named by ID, so records
+// survive restarts and are shared by instances mounting the directory
+type Dir[T any] struct {
+	dir      string
+	noun     string
+	notFound error
+	mu       sync.Mutex
+}
+
+// NewDir creates a directory store, creating the directory if needed. noun
+// names the records in errors, and lookups of missing IDs return notFound.
+func NewDir[T any](dir, noun string, notFound error) (*Dir[T], error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s directory: %w", noun, err)
+	}
+	return &Dir[T]{dir: dir, noun: noun, notFound: notFound}, nil
+}
+
+// Put inserts or replaces a record
+func (d *Dir[T]) Put(id string, record T) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := WriteFile(d.path(id), record); err != nil {
+		return fmt.Errorf("failed to write %s: %w", d.noun, err)
+	}
+	return nil
+}
+
+// Get returns a record
+func (d *Dir[T]) Get(id string) (T, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.read(d.path(id))
+}
+
+// List returns all records
+func (d *Dir[T]) List() ([]T, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	files, err := d.files()
+	if err != nil {
+		return nil, err
+	}
+
+	var records []T
+	for _, file := range files {
+		record, err := d.read(file)
+		if errors.Is(err, d.notFound) {
+			// Removed by another instance since the directory was read
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Walk calls fn for each record until it returns an error. Records are
+// read one at a time, so unlike List it doesn't hold them all in memory,
+// and the store is only locked while a record is read. Records put while
+// walking may be missed.
+func (d *Dir[T]) Walk(fn func(T) error) error {
+	d.mu.Lock()
+	files, err := d.files()
+	d.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		d.mu.Lock()
+		record, err := d.read(file)
+		d.mu.Unlock()
+		if errors.Is(err, d.notFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// files returns the paths of the record files. The caller must hold the
+// lock.
+func (d *Dir[T]) files() ([]string, error) {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s directory: %w", d.noun, err)
+	}
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		files = append(files, filepath.Join(d.dir, entry.Name()))
+	}
+	return files, nil
+}
+
+// Delete removes a record
+func (d *Dir[T]) Delete(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := os.Remove(d.path(id)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return d.notFound
+		}
+		return fmt.Errorf("failed to delete %s: %w", d.noun, err)
+	}
+	return nil
+}
+
+// Clear removes all records
+func (d *Dir[T]) Clear() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(d.dir, "*.json"))
+	if err != nil {
+		return fmt.Errorf("failed to list %ss: %w", d.noun, err)
+	}
+	for _, file := range files {
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to delete %s: %w", d.noun, err)
+		}
+	}
+	return nil
+}
+
+// read decodes the record stored in a file
+func (d *Dir[T]) read(path string) (T, error) {
+	var record T
+	found, err := ReadFile(path, &record)
+	if err != nil {
+		return record, fmt.Errorf("failed to read %s: %w", d.noun, err)
+	}
+	if !found {
+		return record, d.notFound
+	}
+	return record, nil
+}
+
+// path returns the file path for an ID. IDs are sanitized so they can never
+// escape the directory.
+func (d *Dir[T]) path(id string) string {
+	return filepath.Join(d.dir, filepath.Base(filepath.Clean("/"+id))+".json")
+}
+
+// WriteFile encodes a value as JSON and replaces the file at path with it.
+// The value is written to a temporary file that is renamed over the path,
+// so readers and crashes never see a partial file.
+func WriteFile(path string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode: %w", err)
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ReadFile decodes the JSON file at path into value. It reports false
+// without an error when the file doesn't exist.
+func ReadFile(path string, value any) (bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return false, fmt.Errorf("failed to decode %s: %w", filepath.Base(path), err)
+	}
+	return true, nil
+}
@@ -0,0 +1,110 @@
+package jsonstore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+var errMissing = errors.New("missing")
+
+type record struct {
+	ID   string `json:"id"`
+	Size int    `json:"size"`
+}
+
+func TestDir(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDir[record](filepath.Join(dir, "records"), "record", errMissing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range []record{{"a", 1}, {"b", 2}, {"a", 3}} {
+		if err := store.Put(r.ID, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := store.Get("a")
+	if err != nil || got.Size != 3 {
+		t.Fatalf("expected the replaced record, got %+v, %v", got, err)
+	}
+	if _, err := store.Get("c"); !errors.Is(err, errMissing) {
+		t.Fatalf("expected the store's not found error, got %v", err)
+	}
+
+	// IDs can't escape the directory
+	if err := store.Put("../../escaped", record{ID: "escaped"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escaped.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("record was written outside the directory: %v", err)
+	}
+
+	all, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, r := range all {
+		ids = append(ids, r.ID)
+	}
+	slices.Sort(ids)
+	if !slices.Equal(ids, []string{"a", "b", "escaped"}) {
+		t.Fatalf("unexpected records: %v", ids)
+	}
+
+	if err := store.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("b"); !errors.Is(err, errMissing) {
+		t.Fatalf("expected the store's not found error, got %v", err)
+	}
+	if err := store.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if all, _ := store.List(); len(all) != 0 {
+		t.Fatalf("expected no records after clearing, got %v", all)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	store := NewMemory[record](errMissing)
+	store.Put("a", record{"a", 1})
+	store.Put("b", record{"b", 2})
+	if _, err := store.Get("c"); !errors.Is(err, errMissing) {
+		t.Fatalf("expected the store's not found error, got %v", err)
+	}
+	store.DeleteFunc(func(r record) bool { return r.Size > 1 })
+	if all := store.List(); len(all) != 1 || all[0].ID != "a" {
+		t.Fatalf("unexpected records: %v", all)
+	}
+	if err := store.Delete("b"); !errors.Is(err, errMissing) {
+		t.Fatalf("expected the store's not found error, got %v", err)
+	}
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "state.json")
+
+	var value map[string]int
+	found, err := ReadFile(path, &value)
+	if err != nil || found {
+		t.Fatalf("expected a missing file to be reported, got %v, %v", found, err)
+	}
+
+	if err := WriteFile(path, map[string]int{"a": 1}); err != nil {
+		t.Fatal(err)
+	}
+	found, err = ReadFile(path, &value)
+	if err != nil || !found || value["a"] != 1 {
+		t.Fatalf("unexpected state: %v, %v, %v", value, found, err)
+	}
+
+	files, _ := os.ReadDir(filepath.Dir(path))
+	if len(files) != 1 {
+		t.Fatalf("expected no temporary files to be left, got %d files", len(files))
+	}
+}
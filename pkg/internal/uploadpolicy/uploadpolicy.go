@@ -0,0 +1,36 @@
+// Package uploadpolicy validates the upload settings shared by intakes and
+// tenants: key prefixes and allowed MIME types
+package uploadpolicy
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// PrefixPattern restricts key prefixes to characters that are safe in
+// upload IDs, URLs and object keys
+var PrefixPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// typePattern matches MIME types and wildcards such as image/*
+var typePattern = regexp.MustCompile(`^([a-z0-9!#$&^_.+-]+|\*)/([a-z0-9!#$&^_.+-]+|\*)$`)
+
+// ValidPrefix reports whether a key prefix is safe to use
+func ValidPrefix(prefix string) bool {
+	return PrefixPattern.MatchString(prefix)
+}
+
+// NormalizeTypes returns a copy of allowed MIME types in canonical form, or
+// an error naming the first one that isn't a MIME type or wildcard
+func NormalizeTypes(types []string) ([]string, error) {
+	types = slices.Clone(types)
+	for i, fileType := range types {
+		fileType = strings.ToLower(strings.TrimSpace(fileType))
+		if !typePattern.MatchString(fileType) {
+			return nil, fmt.Errorf("%q is not a MIME type", fileType)
+		}
+		types[i] = fileType
+	}
+	return types, nil
+}
@@ -0,0 +1,35 @@
+package uploadpolicy
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestValidPrefix(t *testing.T) {
+	for prefix, want := range map[string]bool{
+		"media":     true,
+		"q1-2025_a": true,
+		"-media":    false,
+		"Media":     false,
+		"a/b":       false,
+		"":          false,
+	} {
+		if got := ValidPrefix(prefix); got != want {
+			t.Errorf("ValidPrefix(%q) = %v, want %v", prefix, got, want)
+		}
+	}
+}
+
+func TestNormalizeTypes(t *testing.T) {
+	allowed := []string{" Image/* ", "application/pdf"}
+	types, err := NormalizeTypes(allowed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(types, []string{"image/*", "application/pdf"}) || allowed[0] != " Image/* " {
+		t.Fatalf("NormalizeTypes = %v, input %v", types, allowed)
+	}
+	if _, err := NormalizeTypes([]string{"pdf"}); err == nil {
+		t.Fatal("expected an error for a type without subtype")
+	}
+}
@@ -0,0 +1,161 @@
+// Package inventory exports the upload inventory as CSV or NDJSON, so it
+// can be reconciled with external systems. Large inventories are written
+// to files by background jobs instead of being streamed.
+package inventory
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Export formats
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// ErrFormat is returned for formats other than CSV and NDJSON
+var ErrFormat = errors.New("unsupported export format")
+
+// Row is an upload in the inventory
+type Row struct {
+	UploadID     string    `json:"uploadId"`
+	Tenant       string    `json:"tenant,omitempty"`
+	Owner        string    `json:"owner,omitempty"`
+	Filename     string    `json:"filename,omitempty"`
+	Size         int64     `json:"size"` // -1 while the length is deferred
+	Offset       int64     `json:"offset"`
+	State        string    `json:"state,omitempty"`
+	StorageClass string    `json:"storageClass,omitempty"`
+	Tags         []string  `json:"tags"`
+	Collections  []string  `json:"collections"`
+	Downloads    int64     `json:"downloads"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+
+	// OriginIP and OriginCountry record where the upload was created from,
+	// when origins are recorded
+	OriginIP      string `json:"originIp,omitempty"`
+	OriginCountry string `json:"originCountry,omitempty"`
+}
+
+// csvHeader names the columns of CSV exports. Tags and collections are
+// separated by semicolons.
+var csvHeader = []string{"upload_id", "tenant", "owner", "filename", "size", "offset", "state", "storage_class", "tags", "collections", "downloads", "created_at", "updated_at", "origin_ip", "origin_country"}
+
+// Writer encodes rows in an export format
+type Writer interface {
+	Write(row Row) error
+
+	// Close flushes buffered rows; it doesn't close the underlying writer
+	Close() error
+}
+
+// NewWriter returns a writer encoding rows in the format
+func NewWriter(w io.Writer, format string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return &csvWriter{writer: csv.NewWriter(w)}, nil
+	case FormatNDJSON:
+		buffered := bufio.NewWriter(w)
+		return &ndjsonWriter{buffered: buffered, encoder: json.NewEncoder(buffered)}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrFormat, format)
+	}
+}
+
+// ValidFormat reports whether rows can be exported in the format
+func ValidFormat(format string) bool {
+	return format == FormatCSV || format == FormatNDJSON
+}
+
+// ContentType returns the media type of an export format
+func ContentType(format string) string {
+	if format == FormatNDJSON {
+		return "application/x-ndjson"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// csvWriter writes a header followed by one record per row
+type csvWriter struct {
+	writer *csv.Writer
+	header bool
+}
+
+func (w *csvWriter) Write(row Row) error {
+	if !w.header {
+		if err := w.writer.Write(csvHeader); err != nil {
+			return err
+		}
+		w.header = true
+	}
+	return w.writer.Write([]string{
+		csvText(row.UploadID),
+		csvText(row.Tenant),
+		csvText(row.Owner),
+		csvText(row.Filename),
+		strconv.FormatInt(row.Size, 10),
+		strconv.FormatInt(row.Offset, 10),
+		csvText(row.State),
+		csvText(row.StorageClass),
+		csvText(strings.Join(row.Tags, ";")),
+		csvText(strings.Join(row.Collections, ";")),
+		strconv.FormatInt(row.Downloads, 10),
+		formatTime(row.CreatedAt),
+		formatTime(row.UpdatedAt),
+		csvText(row.OriginIP),
+		csvText(row.OriginCountry),
+	})
+}
+
+// csvText guards a user-provided cell against formula injection.
+// Spreadsheets run cells starting with one of =+-@ as formulas, so such
+// values are prefixed with a quote to be shown as text.
+func csvText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func (w *csvWriter) Close() error {
+	// Empty exports still get a header
+	if !w.header {
+		if err := w.writer.Write(csvHeader); err != nil {
+			return err
+		}
+		w.header = true
+	}
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// ndjsonWriter writes one JSON object per line
+type ndjsonWriter struct {
+	buffered *bufio.Writer
+	encoder  *json.Encoder
+}
+
+func (w *ndjsonWriter) Write(row Row) error {
+	return w.encoder.Encode(row)
+}
+
+func (w *ndjsonWriter) Close() error {
+	return w.buffered.Flush()
+}
+
+// formatTime formats a time for CSV, leaving zero times empty
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,218 @@
+package inventory
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriters(t *testing.T) {
+	created := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	row := Row{
+		UploadID:    "acme-abc",
+		Tenant:      "acme",
+		Owner:       "user-1",
+		Filename:    "report, final.pdf",
+		Size:        100,
+		Offset:      40,
+		State:       "uploading",
+		Tags:        []string{"q1", "finance"},
+		Collections: []string{},
+		CreatedAt:   created,
+
+		OriginIP:      "203.0.113.7",
+		OriginCountry: "DE",
+	}
+
+	var out bytes.Buffer
+	writer, err := NewWriter(&out, FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Write(row); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join(csvHeader, ",") + "\n" +
+		`acme-abc,acme,user-1,"report, final.pdf",100,40,uploading,,q1;finance,,0,2025-01-01T12:00:00Z,,203.0.113.7,DE` + "\n"
+	if out.String() != want {
+		t.Fatalf("CSV = %q, want %q", out.String(), want)
+	}
+
+	out.Reset()
+	writer, _ = NewWriter(&out, FormatCSV)
+	if err := writer.Close(); err != nil || out.String() != strings.Join(csvHeader, ",")+"\n" {
+		t.Fatalf("empty CSV = %q, %v", out.String(), err)
+	}
+
+	out.Reset()
+	writer, _ = NewWriter(&out, FormatNDJSON)
+	_ = writer.Write(row)
+	_ = writer.Write(Row{UploadID: "acme-def"})
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], `{"uploadId":"acme-abc","tenant":"acme"`) {
+		t.Fatalf("NDJSON = %q", out.String())
+	}
+
+	if _, err := NewWriter(&out, "xml"); !errors.Is(err, ErrFormat) {
+		t.Fatalf("expected ErrFormat, got %v", err)
+	}
+}
+
+func TestCSVGuardsFormulas(t *testing.T) {
+	var out bytes.Buffer
+	writer, _ := NewWriter(&out, FormatCSV)
+	err := writer.Write(Row{
+		UploadID: "acme-abc",
+		Filename: "=HYPERLINK(\"http://evil\")",
+		Tags:     []string{"+1", "ok"},
+		Size:     -1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := `acme-abc,,,"'=HYPERLINK(""http://evil"")",-1,0,,,'+1;ok,,0,,,,` + "\n"
+	if !strings.HasSuffix(out.String(), want) {
+		t.Fatalf("CSV = %q, want a row %q", out.String(), want)
+	}
+}
+
+func TestJobsLimitAndSpawner(t *testing.T) {
+	var spawned []func(ctx context.Context)
+	spawn := func(run func(ctx context.Context)) bool {
+		if len(spawned) == 2 {
+			return false
+		}
+		spawned = append(spawned, run)
+		return true
+	}
+	jobs, err := NewJobs(t.TempDir(), time.Hour, 1, spawn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	export := func(ctx context.Context, w Writer) error { return ctx.Err() }
+
+	job, err := jobs.Start("", FormatCSV, export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jobs.Start("", FormatCSV, export); !errors.Is(err, ErrTooManyJobs) {
+		t.Fatalf("expected ErrTooManyJobs while a job runs, got %v", err)
+	}
+
+	spawned[0](context.Background())
+	if job, _ = jobs.Get(job.ID); job.Status != StatusCompleted {
+		t.Fatalf("unexpected job %+v", job)
+	}
+	second, err := jobs.Start("", FormatCSV, export)
+	if err != nil {
+		t.Fatalf("expected a job to start once the first finished, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	spawned[1](ctx)
+	if second, _ = jobs.Get(second.ID); second.Status != StatusFailed {
+		t.Fatalf("expected a canceled job to fail, got %+v", second)
+	}
+	if _, err := jobs.Start("", FormatCSV, export); !errors.Is(err, ErrJobsClosed) {
+		t.Fatalf("expected ErrJobsClosed when the spawner refuses, got %v", err)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, "export-old.csv")
+	if err := os.WriteFile(stale, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := NewJobs(dir, time.Hour, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatalf("expected stale export to be removed, got %v", err)
+	}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	jobs.now = func() time.Time { return now }
+
+	job, err := jobs.Start("user-1", FormatNDJSON, func(ctx context.Context, w Writer) error {
+		for _, id := range []string{"a", "b", "c"} {
+			if err := w.Write(Row{UploadID: id}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job = waitForJob(t, jobs, job.ID)
+	if job.Status != StatusCompleted || job.Rows != 3 || job.Owner != "user-1" {
+		t.Fatalf("unexpected job %+v", job)
+	}
+
+	file, _, err := jobs.Open(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(file)
+	file.Close()
+	if strings.Count(string(data), "\n") != 3 {
+		t.Fatalf("export = %q", data)
+	}
+
+	failed, _ := jobs.Start("", FormatCSV, func(ctx context.Context, w Writer) error {
+		return errors.New("catalog unavailable")
+	})
+	failed = waitForJob(t, jobs, failed.ID)
+	if failed.Status != StatusFailed || failed.Error != "catalog unavailable" {
+		t.Fatalf("unexpected job %+v", failed)
+	}
+	if _, _, err := jobs.Open(failed.ID); !errors.Is(err, ErrJobNotDone) {
+		t.Fatalf("expected ErrJobNotDone, got %v", err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, err := jobs.Get(job.ID); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("expected expired job to be gone, got %v", err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) != 0 {
+		t.Fatalf("expected exports to be removed, found %v", files)
+	}
+	if _, err := jobs.Start("", "xml", nil); !errors.Is(err, ErrFormat) {
+		t.Fatalf("expected ErrFormat, got %v", err)
+	}
+}
+
+// waitForJob waits until a job is no longer running
+func waitForJob(t *testing.T, jobs *Jobs, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := jobs.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status != StatusRunning {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return Job{}
+}
@@ -0,0 +1,273 @@
+package inventory
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// filePrefix starts the names of export files, so stale ones can be told
+// apart from other files in the directory
+const filePrefix = "export-"
+
+// Errors returned by export jobs
+var (
+	ErrJobNotFound = errors.New("export job not found")
+	ErrJobNotDone  = errors.New("export job has not completed")
+	ErrTooManyJobs = errors.New("too many export jobs are running")
+	ErrJobsClosed  = errors.New("export jobs are shutting down")
+)
+
+// Status is the progress of an export job
+type Status string
+
+const (
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+)
+
+// Job is an export written to a file in the background
+type Job struct {
+	ID          string     `json:"id"`
+	Owner       string     `json:"owner,omitempty"` // Who may see the job and download the export
+	Format      string     `json:"format"`
+	Status      Status     `json:"status"`
+	Rows        int        `json:"rows"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"` // When the export is deleted
+}
+
+// ExportFunc writes the rows of an export
+type ExportFunc func(ctx context.Context, w Writer) error
+
+// Spawner runs a job in the background and reports whether it was started.
+// The context passed to the job is canceled when it should stop.
+type Spawner func(run func(ctx context.Context)) bool
+
+// Jobs runs export jobs and keeps their files for the retention period.
+// Jobs are only tracked in memory; files left by a previous run are removed
+// on start.
+type Jobs struct {
+	dir        string
+	retention  time.Duration
+	maxRunning int
+	spawn      Spawner
+	now        func() time.Time
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+// NewJobs creates the export directory and removes stale exports from it.
+// At most maxRunning jobs run at once, unless it is 0, and they are started
+// with spawn, or in plain goroutines when it is nil.
+func NewJobs(dir string, retention time.Duration, maxRunning int, spawn Spawner) (*Jobs, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create export directory: %w", err)
+	}
+	stale, err := filepath.Glob(filepath.Join(dir, filePrefix+"*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range stale {
+		if err := os.Remove(path); err != nil {
+			slog.Warn("Failed to remove stale export", "path", path, "error", err)
+		}
+	}
+	if spawn == nil {
+		spawn = func(run func(ctx context.Context)) bool {
+			go run(context.Background())
+			return true
+		}
+	}
+	return &Jobs{
+		dir:        dir,
+		retention:  retention,
+		maxRunning: maxRunning,
+		spawn:      spawn,
+		now:        time.Now,
+		jobs:       make(map[string]*Job),
+	}, nil
+}
+
+// Start runs an export in the background and returns its job. The export
+// stops when the context the spawner passes it is canceled.
+func (j *Jobs) Start(owner, format string, export ExportFunc) (Job, error) {
+	if !ValidFormat(format) {
+		return Job{}, fmt.Errorf("%w: %q", ErrFormat, format)
+	}
+
+	j.mu.Lock()
+	j.prune()
+	if j.maxRunning > 0 && j.running() >= j.maxRunning {
+		j.mu.Unlock()
+		return Job{}, ErrTooManyJobs
+	}
+	job := &Job{
+		ID:        newID(),
+		Owner:     owner,
+		Format:    format,
+		Status:    StatusRunning,
+		CreatedAt: j.now(),
+	}
+	j.jobs[job.ID] = job
+	snapshot := *job
+	j.mu.Unlock()
+
+	started := j.spawn(func(ctx context.Context) {
+		j.run(ctx, snapshot.ID, format, export)
+	})
+	if !started {
+		j.mu.Lock()
+		delete(j.jobs, snapshot.ID)
+		j.mu.Unlock()
+		return Job{}, ErrJobsClosed
+	}
+	return snapshot, nil
+}
+
+// running counts the jobs that haven't finished. The caller must hold the
+// lock.
+func (j *Jobs) running() int {
+	count := 0
+	for _, job := range j.jobs {
+		if job.Status == StatusRunning {
+			count++
+		}
+	}
+	return count
+}
+
+// run writes an export to a temporary file, which is renamed once it is
+// complete so downloads never see a partial export
+func (j *Jobs) run(ctx context.Context, id, format string, export ExportFunc) {
+	rows, err := j.write(ctx, id, format, export)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job, ok := j.jobs[id]
+	if !ok {
+		return
+	}
+	now := j.now()
+	expires := now.Add(j.retention)
+	job.Rows = rows
+	job.CompletedAt = &now
+	job.ExpiresAt = &expires
+	if err != nil {
+		slog.Error("Export failed", "job", id, "error", err)
+		job.Status = StatusFailed
+		job.Error = err.Error()
+		return
+	}
+	job.Status = StatusCompleted
+	slog.Info("Export completed", "job", id, "rows", rows)
+}
+
+// write runs the export into the file of a job and returns the rows written
+func (j *Jobs) write(ctx context.Context, id, format string, export ExportFunc) (int, error) {
+	file, err := os.CreateTemp(j.dir, ".export-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(file.Name())
+
+	writer, err := NewWriter(file, format)
+	if err != nil {
+		file.Close()
+		return 0, err
+	}
+	counter := &countingWriter{Writer: writer}
+	if err := export(ctx, counter); err != nil {
+		file.Close()
+		return counter.rows, err
+	}
+	if err := writer.Close(); err != nil {
+		file.Close()
+		return counter.rows, err
+	}
+	if err := file.Close(); err != nil {
+		return counter.rows, err
+	}
+	return counter.rows, os.Rename(file.Name(), j.path(id, format))
+}
+
+// Get returns a job
+func (j *Jobs) Get(id string) (Job, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.prune()
+
+	job, ok := j.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	return *job, nil
+}
+
+// Open opens the export of a completed job
+func (j *Jobs) Open(id string) (*os.File, Job, error) {
+	job, err := j.Get(id)
+	if err != nil {
+		return nil, Job{}, err
+	}
+	if job.Status != StatusCompleted {
+		return nil, job, ErrJobNotDone
+	}
+	file, err := os.Open(j.path(job.ID, job.Format))
+	if err != nil {
+		return nil, job, err
+	}
+	return file, job, nil
+}
+
+// prune forgets expired jobs and deletes their exports. The caller must
+// hold the lock.
+func (j *Jobs) prune() {
+	now := j.now()
+	for id, job := range j.jobs {
+		if job.ExpiresAt == nil || now.Before(*job.ExpiresAt) {
+			continue
+		}
+		if err := os.Remove(j.path(id, job.Format)); err != nil && !os.IsNotExist(err) {
+			slog.Warn("Failed to remove expired export", "job", id, "error", err)
+		}
+		delete(j.jobs, id)
+	}
+}
+
+// path returns the file of a job's export
+func (j *Jobs) path(id, format string) string {
+	return filepath.Join(j.dir, filePrefix+id+"."+format)
+}
+
+// countingWriter counts the rows written
+type countingWriter struct {
+	Writer
+	rows int
+}
+
+func (w *countingWriter) Write(row Row) error {
+	if err := w.Writer.Write(row); err != nil {
+		return err
+	}
+	w.rows++
+	return nil
+}
+
+// newID generates a random job ID
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,376 @@
+// Package journal records chunk acknowledgements in a write-ahead log, so
+// the offsets clients were told can be reconciled against the storage
+// backend after a crash
+package journal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxEntrySize bounds a single encoded entry when reading the journal
+const maxEntrySize = 64 << 10
+
+// finishedRetention is how long acknowledgements of finished uploads are
+// ignored, since the last chunk may be journaled after the upload finished
+const finishedRetention = time.Hour
+
+// compactAfter is the number of entries appended per tracked upload after
+// which the journal file is rewritten
+const compactAfter = 64
+
+// ErrUploadFinished is returned by an OffsetFunc for uploads that completed
+// or no longer exist in the backend, e.g. because they expired
+var ErrUploadFinished = errors.New("upload finished")
+
+// Entry acknowledges a chunk, or ends the journal of an upload
+type Entry struct {
+	UploadID string `json:"uploadId"`
+
+	// Offset is the upload offset after the chunk, as told to the client
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+
+	// Checksum is the hex encoded SHA-256 digest of the chunk, if known
+	Checksum string    `json:"checksum,omitempty"`
+	Time     time.Time `json:"time"`
+
+	// Done marks an upload that completed or was terminated
+	Done bool `json:"done,omitempty"`
+}
+
+// Kinds of divergence between the journal and the backend
+const (
+	// DivergenceLost means the backend has less data than was acknowledged
+	DivergenceLost = "lost"
+
+	// DivergenceUnacknowledged means the backend has data the client was
+	// never told about, e.g. because the server died before responding
+	DivergenceUnacknowledged = "unacknowledged"
+)
+
+// Divergence is an upload whose stored offset differs from the journal
+type Divergence struct {
+	UploadID     string `json:"uploadId"`
+	Kind         string `json:"kind"`
+	Acknowledged int64  `json:"acknowledged"`
+	Stored       int64  `json:"stored"`
+
+	// LastChunk is the last acknowledged chunk
+	LastChunk  Entry     `json:"lastChunk"`
+	DetectedAt time.Time `json:"detectedAt"`
+}
+
+// OffsetFunc returns the offset of an upload as stored in the backend
+type OffsetFunc func(ctx context.Context, id string) (int64, error)
+
+// LockFunc locks an upload against concurrent requests until unlock is
+// called
+type LockFunc func(ctx context.Context, id string) (unlock func(), err error)
+
+// Journal appends acknowledgements to a file in a directory and keeps the
+// latest acknowledgement of every unfinished upload in memory
+type Journal struct {
+	path string
+	sync bool
+
+	mu       sync.Mutex
+	file     *os.File
+	latest   map[string]Entry
+	finished map[string]time.Time
+	appended int
+}
+
+// Open opens the journal in dir, creating the directory if needed. With
+// sync set, every entry is flushed to disk before it is acknowledged.
+func Open(dir string, sync bool) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create journal directory: %w", err)
+	}
+
+	j := &Journal{
+		path:     filepath.Join(dir, "journal.jsonl"),
+		sync:     sync,
+		latest:   make(map[string]Entry),
+		finished: make(map[string]time.Time),
+	}
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	if err := j.compact(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// Ack records an acknowledged chunk. It returns once the entry is written,
+// and flushed to disk if the journal syncs. Chunks of uploads that finished
+// are ignored.
+func (j *Journal) Ack(entry Entry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, ok := j.finished[entry.UploadID]; ok {
+		return nil
+	}
+	if err := j.append(entry); err != nil {
+		return err
+	}
+	j.latest[entry.UploadID] = entry
+	return nil
+}
+
+// Forget ends the journal of an upload that completed or was terminated
+func (j *Journal) Forget(id string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	for finishedID, at := range j.finished {
+		if now.Sub(at) > finishedRetention {
+			delete(j.finished, finishedID)
+		}
+	}
+	j.finished[id] = now
+
+	if _, ok := j.latest[id]; !ok {
+		return nil
+	}
+	if err := j.append(Entry{UploadID: id, Time: now, Done: true}); err != nil {
+		return err
+	}
+	delete(j.latest, id)
+	return nil
+}
+
+// Pending returns the latest acknowledgement of every unfinished upload,
+// ordered by upload ID
+func (j *Journal) Pending() []Entry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries := make([]Entry, 0, len(j.latest))
+	for _, entry := range j.latest {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(a, b int) bool { return entries[a].UploadID < entries[b].UploadID })
+	return entries
+}
+
+// Reconcile compares the acknowledged offset of every unfinished upload to
+// the offset stored in the backend, holding the upload's lock so chunks in
+// flight can't move either meanwhile. Finished uploads are forgotten.
+// Diverging uploads are rebased onto the stored offset, so they are only
+// reported once.
+func (j *Journal) Reconcile(ctx context.Context, lock LockFunc, stored OffsetFunc) ([]Divergence, error) {
+	var divergences []Divergence
+	for _, pending := range j.Pending() {
+		if err := ctx.Err(); err != nil {
+			return divergences, err
+		}
+
+		divergence, err := j.reconcileUpload(ctx, pending.UploadID, lock, stored)
+		if err != nil {
+			return divergences, err
+		}
+		if divergence != nil {
+			divergences = append(divergences, *divergence)
+		}
+	}
+	return divergences, nil
+}
+
+// reconcileUpload compares the acknowledged offset of an upload to the
+// stored one under the upload's lock. It returns nil if they match or the
+// upload can't be checked.
+func (j *Journal) reconcileUpload(ctx context.Context, id string, lock LockFunc, stored OffsetFunc) (*Divergence, error) {
+	unlock, err := lock(ctx, id)
+	if err != nil {
+		slog.Warn("Failed to lock upload to reconcile its journal", "id", id, "error", err)
+		return nil, nil
+	}
+	defer unlock()
+
+	// Chunks acknowledged while waiting for the lock moved the entry on
+	entry, ok := j.latestEntry(id)
+	if !ok {
+		return nil, nil
+	}
+
+	offset, err := stored(ctx, id)
+	if errors.Is(err, ErrUploadFinished) {
+		return nil, j.Forget(id)
+	}
+	if err != nil {
+		slog.Warn("Failed to reconcile upload journal", "id", id, "error", err)
+		return nil, nil
+	}
+	if offset == entry.Offset {
+		return nil, nil
+	}
+
+	// Uploads that finished meanwhile are no longer pending
+	if j.isFinished(id) {
+		return nil, nil
+	}
+
+	divergence := Divergence{
+		UploadID:     id,
+		Kind:         DivergenceUnacknowledged,
+		Acknowledged: entry.Offset,
+		Stored:       offset,
+		LastChunk:    entry,
+		DetectedAt:   time.Now(),
+	}
+	if offset < entry.Offset {
+		divergence.Kind = DivergenceLost
+	}
+	if err := j.Ack(Entry{UploadID: id, Offset: offset, Time: divergence.DetectedAt}); err != nil {
+		return &divergence, err
+	}
+	return &divergence, nil
+}
+
+// latestEntry returns the latest acknowledgement of an unfinished upload
+func (j *Journal) latestEntry(id string) (Entry, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entry, ok := j.latest[id]
+	return entry, ok
+}
+
+// isFinished reports whether an upload finished recently
+func (j *Journal) isFinished(id string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, ok := j.finished[id]
+	return ok
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// append writes an entry to the journal file, rewriting the file first once
+// it mostly holds superseded entries
+func (j *Journal) append(entry Entry) error {
+	if j.appended > compactAfter*(len(j.latest)+1) {
+		if err := j.compact(); err != nil {
+			return err
+		}
+	}
+	if j.file == nil {
+		return fmt.Errorf("journal is closed")
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode journal entry: %w", err)
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if j.sync {
+		if err := j.file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync journal: %w", err)
+		}
+	}
+	j.appended++
+	return nil
+}
+
+// load reads the latest entry of every unfinished upload. A line cut short
+// by a crash is skipped.
+func (j *Journal) load() error {
+	f, err := os.Open(j.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to open journal: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 4<<10), maxEntrySize)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			slog.Warn("Skipping malformed journal entry", "path", j.path, "error", err)
+			continue
+		}
+		if entry.Done {
+			delete(j.latest, entry.UploadID)
+		} else {
+			j.latest[entry.UploadID] = entry
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read journal: %w", err)
+	}
+	return nil
+}
+
+// compact rewrites the journal file with only the latest entries and
+// reopens it for appending
+func (j *Journal) compact() error {
+	if j.file != nil {
+		j.file.Close()
+		j.file = nil
+	}
+
+	// Write to a temporary file first so a crash never truncates the journal
+	tmp := j.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to compact journal: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, entry := range j.latest {
+		if err := enc.Encode(entry); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to compact journal: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to compact journal: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to compact journal: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to compact journal: %w", err)
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		return fmt.Errorf("failed to compact journal: %w", err)
+	}
+
+	file, err := os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open journal: %w", err)
+	}
+	j.file = file
+	j.appended = 0
+	return nil
+}
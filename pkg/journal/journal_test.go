@@ -0,0 +1,142 @@
+package journal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJournalSurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	j, err := Open(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range []Entry{
+		{UploadID: "a", Offset: 10, Length: 10, Checksum: "aa"},
+		{UploadID: "a", Offset: 20, Length: 10, Checksum: "bb"},
+		{UploadID: "b", Offset: 5, Length: 5},
+	} {
+		if err := j.Ack(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := j.Forget("b"); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	// A line cut short by a crash is skipped
+	f, _ := os.OpenFile(filepath.Join(dir, "journal.jsonl"), os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"uploadId":"a","off`)
+	f.Close()
+
+	reopened, err := Open(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+
+	pending := reopened.Pending()
+	if len(pending) != 1 || pending[0].UploadID != "a" || pending[0].Offset != 20 || pending[0].Checksum != "bb" {
+		t.Fatalf("pending = %+v", pending)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	j, err := Open(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	now := time.Now()
+	for id, offset := range map[string]int64{"ok": 10, "lost": 30, "ahead": 10, "gone": 10} {
+		j.Ack(Entry{UploadID: id, Offset: offset, Time: now})
+	}
+
+	stored := map[string]int64{"ok": 10, "lost": 20, "ahead": 15}
+	lookup := func(ctx context.Context, id string) (int64, error) {
+		offset, ok := stored[id]
+		if !ok {
+			return 0, ErrUploadFinished
+		}
+		return offset, nil
+	}
+
+	var locked []string
+	lock := func(ctx context.Context, id string) (func(), error) {
+		locked = append(locked, id)
+		return func() {}, nil
+	}
+
+	divergences, err := j.Reconcile(context.Background(), lock, lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(divergences) != 2 {
+		t.Fatalf("divergences = %+v", divergences)
+	}
+	kinds := map[string]string{}
+	for _, d := range divergences {
+		kinds[d.UploadID] = d.Kind
+	}
+	if kinds["lost"] != DivergenceLost || kinds["ahead"] != DivergenceUnacknowledged {
+		t.Fatalf("kinds = %v", kinds)
+	}
+
+	if len(j.Pending()) != 3 {
+		t.Fatalf("expected the gone upload to be forgotten, pending = %+v", j.Pending())
+	}
+	if strings.Join(locked, ",") != "ahead,gone,lost,ok" {
+		t.Fatalf("expected every upload to be locked while reconciled, got %v", locked)
+	}
+	if again, _ := j.Reconcile(context.Background(), lock, lookup); len(again) != 0 {
+		t.Fatalf("expected divergences to be reported once, got %+v", again)
+	}
+}
+
+func TestReconcileSeesChunksAcknowledgedWhileLocking(t *testing.T) {
+	j, err := Open(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	j.Ack(Entry{UploadID: "a", Offset: 10})
+	// A chunk in flight holds the lock and is acknowledged before it is
+	// released
+	lock := func(ctx context.Context, id string) (func(), error) {
+		j.Ack(Entry{UploadID: id, Offset: 20})
+		return func() {}, nil
+	}
+	stored := func(ctx context.Context, id string) (int64, error) { return 20, nil }
+
+	divergences, err := j.Reconcile(context.Background(), lock, stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(divergences) != 0 {
+		t.Fatalf("expected no divergence, got %+v", divergences)
+	}
+}
+
+func TestAckAfterForgetIsIgnored(t *testing.T) {
+	j, err := Open(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	j.Ack(Entry{UploadID: "a", Offset: 10})
+	j.Forget("a")
+	// The last chunk may be journaled after the completion was handled
+	j.Ack(Entry{UploadID: "a", Offset: 20})
+	if pending := j.Pending(); len(pending) != 0 {
+		t.Fatalf("pending = %+v", pending)
+	}
+}
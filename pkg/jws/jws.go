@@ -0,0 +1,210 @@
+// Package jws signs payloads with detached JSON Web Signatures (RFC 7515,
+// appendix F), so receivers can verify a payload came from the server with
+// its public key, published as a JSON Web Key Set
+package jws
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// Algorithms of the supported keys
+const (
+	EdDSA = "EdDSA"
+	ES256 = "ES256"
+)
+
+// Errors returned when loading keys or verifying signatures
+var (
+	ErrUnsupportedKey   = errors.New("unsupported signing key")
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+// header is the protected header of a signature
+type header struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// JWK is the public part of a signing key as a JSON Web Key
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Y         string `json:"y,omitempty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+}
+
+// Signer signs payloads with an Ed25519 or ECDSA P-256 private key
+type Signer struct {
+	key       crypto.Signer
+	algorithm string
+	jwk       JWK
+}
+
+// NewSigner creates a signer for an Ed25519 or ECDSA P-256 key. An empty
+// key ID is replaced by the key's JWK thumbprint (RFC 7638).
+func NewSigner(key crypto.Signer, keyID string) (*Signer, error) {
+	s := &Signer{key: key}
+	switch public := key.Public().(type) {
+	case ed25519.PublicKey:
+		s.algorithm = EdDSA
+		s.jwk = JWK{KeyType: "OKP", Curve: "Ed25519", X: encode(public)}
+	case *ecdsa.PublicKey:
+		if public.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("%w: ECDSA keys must use P-256", ErrUnsupportedKey)
+		}
+		s.algorithm = ES256
+		s.jwk = JWK{KeyType: "EC", Curve: "P-256", X: encode(public.X.FillBytes(make([]byte, 32))), Y: encode(public.Y.FillBytes(make([]byte, 32)))}
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, public)
+	}
+
+	if keyID == "" {
+		keyID = s.thumbprint()
+	}
+	s.jwk.KeyID = keyID
+	s.jwk.Algorithm = s.algorithm
+	s.jwk.Use = "sig"
+	return s, nil
+}
+
+// LoadSigner creates a signer from a PEM encoded PKCS #8 private key file
+func LoadSigner(path, keyID string) (*Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: %s is not PEM encoded", ErrUnsupportedKey, path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnsupportedKey, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, key)
+	}
+	return NewSigner(signer, keyID)
+}
+
+// JWK returns the public key to verify signatures with
+func (s *Signer) JWK() JWK {
+	return s.jwk
+}
+
+// Sign returns the detached signature of a payload, in the compact form
+// "<header>..<signature>" with the payload left out
+func (s *Signer) Sign(payload []byte) (string, error) {
+	protected, err := json.Marshal(header{Algorithm: s.algorithm, KeyID: s.jwk.KeyID})
+	if err != nil {
+		return "", err
+	}
+	input := encode(protected) + "." + encode(payload)
+
+	var signature []byte
+	switch key := s.key.(type) {
+	case *ecdsa.PrivateKey:
+		// JWS uses the fixed-size r || s encoding rather than ASN.1
+		digest := sha256.Sum256([]byte(input))
+		r, v, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			return "", fmt.Errorf("failed to sign payload: %w", err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), v.FillBytes(make([]byte, 32))...)
+	default:
+		if signature, err = s.key.Sign(rand.Reader, []byte(input), crypto.Hash(0)); err != nil {
+			return "", fmt.Errorf("failed to sign payload: %w", err)
+		}
+	}
+	return encode(protected) + ".." + encode(signature), nil
+}
+
+// Verify checks a detached signature of a payload against a public key
+func Verify(signature string, payload []byte, key JWK) error {
+	parts := strings.Split(signature, ".")
+	if len(parts) != 3 || parts[1] != "" {
+		return fmt.Errorf("%w: not a detached signature", ErrInvalidSignature)
+	}
+	data, err := decode(parts[0])
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+	var protected header
+	if err := json.Unmarshal(data, &protected); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+	if protected.Algorithm != key.Algorithm || protected.KeyID != key.KeyID {
+		return fmt.Errorf("%w: signed with %s key %q", ErrInvalidSignature, protected.Algorithm, protected.KeyID)
+	}
+	sig, err := decode(parts[2])
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+	input := []byte(parts[0] + "." + encode(payload))
+
+	switch key.Algorithm {
+	case EdDSA:
+		x, err := decode(key.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return fmt.Errorf("%w: malformed Ed25519 key", ErrUnsupportedKey)
+		}
+		if !ed25519.Verify(ed25519.PublicKey(x), input, sig) {
+			return ErrInvalidSignature
+		}
+	case ES256:
+		x, errX := decode(key.X)
+		y, errY := decode(key.Y)
+		if errX != nil || errY != nil {
+			return fmt.Errorf("%w: malformed P-256 key", ErrUnsupportedKey)
+		}
+		public := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		digest := sha256.Sum256(input)
+		if len(sig) != 64 || !ecdsa.Verify(public, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+			return ErrInvalidSignature
+		}
+	default:
+		return fmt.Errorf("%w: algorithm %q", ErrUnsupportedKey, key.Algorithm)
+	}
+	return nil
+}
+
+// thumbprint returns the RFC 7638 thumbprint of the public key, hashing its
+// required members in lexicographic order
+func (s *Signer) thumbprint() string {
+	var members string
+	if s.jwk.KeyType == "OKP" {
+		members = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q}`, s.jwk.Curve, s.jwk.KeyType, s.jwk.X)
+	} else {
+		members = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, s.jwk.Curve, s.jwk.KeyType, s.jwk.X, s.jwk.Y)
+	}
+	sum := sha256.Sum256([]byte(members))
+	return encode(sum[:])
+}
+
+// encode returns unpadded base64url, as JWS requires
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decode reverses encode
+func decode(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(value)
+}
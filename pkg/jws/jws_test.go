@@ -0,0 +1,111 @@
+package jws
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSignVerify(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := []byte(`{"id":"abc","checksum":{"algorithm":"sha256","value":"9f86d0"}}`)
+	for _, key := range []crypto.Signer{edKey, ecKey} {
+		signer, err := NewSigner(key, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		jwk := signer.JWK()
+		signature, err := signer.Sign(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parts := strings.Split(signature, "."); len(parts) != 3 || parts[1] != "" {
+			t.Fatalf("expected a detached signature, got %q", signature)
+		}
+		if err := Verify(signature, payload, jwk); err != nil {
+			t.Fatalf("%s: expected the signature to verify, got %v", jwk.Algorithm, err)
+		}
+		tampered := []byte(strings.Replace(string(payload), "9f86d0", "000000", 1))
+		if err := Verify(signature, tampered, jwk); !errors.Is(err, ErrInvalidSignature) {
+			t.Fatalf("%s: expected a tampered payload to be rejected, got %v", jwk.Algorithm, err)
+		}
+	}
+
+	// Signatures only verify with the key they name
+	signer, _ := NewSigner(edKey, "current")
+	signature, _ := signer.Sign(payload)
+	other, _ := NewSigner(ecKey, "previous")
+	if err := Verify(signature, payload, other.JWK()); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected a signature of another key to be rejected, got %v", err)
+	}
+
+	if _, err := NewSigner(mustECKey(t, elliptic.P384()), ""); !errors.Is(err, ErrUnsupportedKey) {
+		t.Fatalf("expected ErrUnsupportedKey for a P-384 key, got %v", err)
+	}
+}
+
+func TestThumbprint(t *testing.T) {
+	// The Ed25519 key of RFC 8037, appendix A
+	d, _ := base64.RawURLEncoding.DecodeString("nWGxne_9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A")
+	signer, err := NewSigner(ed25519.NewKeyFromSeed(d), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk := signer.JWK()
+	if jwk.X != "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo" || jwk.KeyID != "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k" {
+		t.Fatalf("unexpected JWK %+v", jwk)
+	}
+}
+
+func TestLoadSigner(t *testing.T) {
+	der, err := x509.MarshalPKCS8PrivateKey(mustECKey(t, elliptic.P256()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "callbacks.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := LoadSigner(path, "2024-05")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jwk := signer.JWK(); jwk.Algorithm != ES256 || jwk.KeyID != "2024-05" || jwk.Use != "sig" {
+		t.Fatalf("unexpected JWK %+v", jwk)
+	}
+
+	if err := os.WriteFile(path, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSigner(path, ""); !errors.Is(err, ErrUnsupportedKey) {
+		t.Fatalf("expected ErrUnsupportedKey, got %v", err)
+	}
+}
+
+// mustECKey generates an ECDSA key on the curve
+func mustECKey(t *testing.T, curve elliptic.Curve) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
@@ -0,0 +1,80 @@
+// Package logging configures the application logger from the logging
+// configuration and bridges third-party loggers into it.
+package logging
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/lmittmann/tint"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+)
+
+// Level is the level of the loggers created by New. It can be changed while
+// the server runs, e.g. to debug an upload without restarting the server.
+var Level = new(slog.LevelVar)
+
+// New creates a logger honoring the configured level and format. The text
+// format uses a human-friendly colored handler, json emits one object per line.
+// Debug mode always enables debug level logging.
+func New(w io.Writer, cfg config.LoggingConfig, debug bool) *slog.Logger {
+	Level.Set(ConfiguredLevel(cfg, debug))
+
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "json":
+		handler = slog.NewJSONHandler(w, &slog.HandlerOptions{
+			Level: Level,
+		})
+	default:
+		handler = tint.NewHandler(w, &tint.Options{
+			Level:      Level,
+			TimeFormat: time.DateTime,
+		})
+	}
+
+	return slog.New(handler)
+}
+
+// ConfiguredLevel returns the level the configuration asks for
+func ConfiguredLevel(cfg config.LoggingConfig, debug bool) slog.Level {
+	if debug {
+		return slog.LevelDebug
+	}
+	return ParseLevel(cfg.Level)
+}
+
+// ParseLevel converts a configured level name into a slog level, falling
+// back to info for unknown values
+func ParseLevel(level string) slog.Level {
+	parsed, ok := LookupLevel(level)
+	if !ok {
+		return slog.LevelInfo
+	}
+	return parsed
+}
+
+// LookupLevel converts a level name into a slog level and reports whether
+// the name is known
+func LookupLevel(level string) (slog.Level, bool) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, true
+	case "info":
+		return slog.LevelInfo, true
+	case "warn", "warning":
+		return slog.LevelWarn, true
+	case "error":
+		return slog.LevelError, true
+	default:
+		return slog.LevelInfo, false
+	}
+}
+
+// LevelName returns the name of a level as used in the configuration
+func LevelName(level slog.Level) string {
+	return strings.ToLower(level.String())
+}
@@ -0,0 +1,121 @@
+package logging
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+)
+
+// Redacted replaces values hidden from the request log
+const Redacted = "REDACTED"
+
+// RequestSubject describes a request for matching redaction rules. Tenant and
+// role are empty while unknown, e.g. before the request is authenticated.
+type RequestSubject struct {
+	Path   string
+	Tenant string
+	Role   string
+}
+
+// Redactor hides request details from the request log according to the
+// configured redaction rules
+type Redactor struct {
+	rules []config.RedactionRule
+}
+
+// NewRedactor creates a redactor applying the rules
+func NewRedactor(rules []config.RedactionRule) *Redactor {
+	return &Redactor{rules: rules}
+}
+
+// Redaction is what to hide from the log entry of one request
+type Redaction struct {
+	headers     map[string]bool
+	metadata    map[string]bool
+	allMetadata bool
+	query       map[string]bool
+}
+
+// Match returns what to hide for a request. Rules restricted to tenants or
+// roles also match requests whose tenant or role isn't known, so details are
+// hidden rather than leaked when in doubt.
+func (r *Redactor) Match(subject RequestSubject) Redaction {
+	redaction := Redaction{
+		headers:  map[string]bool{"Authorization": true},
+		metadata: map[string]bool{},
+		query:    map[string]bool{},
+	}
+	for _, rule := range r.rules {
+		if !strings.HasPrefix(subject.Path, rule.Path) ||
+			!matchesUnknown(rule.Tenants, subject.Tenant) ||
+			!matchesUnknown(rule.Roles, subject.Role) {
+			continue
+		}
+		for _, header := range rule.Headers {
+			redaction.headers[http.CanonicalHeaderKey(header)] = true
+		}
+		for _, key := range rule.Metadata {
+			if key == "*" {
+				redaction.allMetadata = true
+				continue
+			}
+			redaction.metadata[key] = true
+		}
+		for _, param := range rule.Query {
+			redaction.query[param] = true
+		}
+	}
+	return redaction
+}
+
+// matchesUnknown reports whether a value is one of the allowed values, with
+// empty values matching as they may be any of them
+func matchesUnknown(allowed []string, value string) bool {
+	return len(allowed) == 0 || value == "" || slices.Contains(allowed, value)
+}
+
+// Headers returns the request headers for logging, with hidden headers
+// replaced and hidden Upload-Metadata values removed
+func (r Redaction) Headers(header http.Header) map[string]string {
+	headers := make(map[string]string, len(header))
+	for name, values := range header {
+		switch {
+		case r.headers[http.CanonicalHeaderKey(name)]:
+			headers[name] = Redacted
+		case http.CanonicalHeaderKey(name) == "Upload-Metadata":
+			headers[name] = r.uploadMetadata(strings.Join(values, ","))
+		default:
+			headers[name] = strings.Join(values, ",")
+		}
+	}
+	return headers
+}
+
+// uploadMetadata replaces the values of hidden keys in an Upload-Metadata
+// header, which lists keys with optional base64-encoded values
+func (r Redaction) uploadMetadata(value string) string {
+	if !r.allMetadata && len(r.metadata) == 0 {
+		return value
+	}
+	pairs := strings.Split(value, ",")
+	for i, pair := range pairs {
+		key, encoded, ok := strings.Cut(strings.TrimSpace(pair), " ")
+		if ok && encoded != "" && (r.allMetadata || r.metadata[key]) {
+			pairs[i] = key + " " + Redacted
+		}
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Query replaces the values of hidden query parameters
+func (r Redaction) Query(query url.Values) url.Values {
+	for param := range r.query {
+		if query.Has(param) {
+			query.Set(param, Redacted)
+		}
+	}
+	return query
+}
@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+)
+
+func TestRedactorHidesMatchingDetails(t *testing.T) {
+	redactor := NewRedactor([]config.RedactionRule{
+		{Path: "/files/", Tenants: []string{"acme"}, Headers: []string{"x-forwarded-for"}, Metadata: []string{"email"}},
+		{Path: "/api/", Query: []string{"email"}},
+	})
+
+	header := http.Header{
+		"Authorization":   {"Bearer secret"},
+		"X-Forwarded-For": {"203.0.113.7"},
+		"Upload-Metadata": {"filename ZG9jLnBkZg==,email YUBleGFtcGxlLmNvbQ==,is_confidential"},
+	}
+	headers := redactor.Match(RequestSubject{Path: "/files/acme/1", Tenant: "acme"}).Headers(header)
+	expected := map[string]string{
+		"Authorization":   Redacted,
+		"X-Forwarded-For": Redacted,
+		"Upload-Metadata": "filename ZG9jLnBkZg==,email REDACTED,is_confidential",
+	}
+	for name, value := range expected {
+		if headers[name] != value {
+			t.Errorf("Expected %s to be %q, got %q", name, value, headers[name])
+		}
+	}
+
+	// Other tenants and routes only get the built-in redaction
+	headers = redactor.Match(RequestSubject{Path: "/files/globex/1", Tenant: "globex"}).Headers(header)
+	if headers["X-Forwarded-For"] != "203.0.113.7" || headers["Authorization"] != Redacted {
+		t.Errorf("Expected only Authorization to be redacted for other tenants, got %v", headers)
+	}
+	query := redactor.Match(RequestSubject{Path: "/files/acme/1"}).Query(url.Values{"email": {"a@example.com"}})
+	if query.Get("email") != "a@example.com" {
+		t.Errorf("Expected query of other routes to be kept, got %v", query)
+	}
+	query = redactor.Match(RequestSubject{Path: "/api/uploads"}).Query(url.Values{"email": {"a@example.com"}, "page": {"2"}})
+	if query.Get("email") != Redacted || query.Get("page") != "2" {
+		t.Errorf("Expected only email to be redacted, got %v", query)
+	}
+}
+
+func TestRedactorFailsClosedForUnknownSubjects(t *testing.T) {
+	redactor := NewRedactor([]config.RedactionRule{
+		{Tenants: []string{"acme"}, Roles: []string{"user"}, Metadata: []string{"*"}},
+	})
+	header := http.Header{"Upload-Metadata": {"filename ZG9jLnBkZg==,email YUBleGFtcGxlLmNvbQ=="}}
+
+	headers := redactor.Match(RequestSubject{Path: "/files/"}).Headers(header)
+	if headers["Upload-Metadata"] != "filename REDACTED,email REDACTED" {
+		t.Errorf("Expected metadata of unknown users to be redacted, got %q", headers["Upload-Metadata"])
+	}
+	headers = redactor.Match(RequestSubject{Path: "/files/", Tenant: "acme", Role: "admin"}).Headers(header)
+	if headers["Upload-Metadata"] != header.Get("Upload-Metadata") {
+		t.Errorf("Expected metadata of other roles to be kept, got %q", headers["Upload-Metadata"])
+	}
+}
@@ -0,0 +1,119 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	expslog "golang.org/x/exp/slog"
+)
+
+// clientAbortCodes are the tusd error codes of request bodies cut short by
+// the client, which the server logs itself as aborts
+var clientAbortCodes = []string{"ERR_UNEXPECTED_EOF", "ERR_CONNECTION_RESET", "ERR_READ_TIMEOUT"}
+
+// tusdAttrKeys maps attribute keys used by tusd to the keys used in our logs
+var tusdAttrKeys = map[string]string{
+	"requestId": "request_id",
+}
+
+// NewTusdLogger returns a logger for tusd.Config.Logger that forwards all
+// records to the given logger. tusd logs every request and chunk at info
+// level, which duplicates our request logging, so those records are
+// downgraded to debug, as are errors reading bodies that the client cut
+// short. Other warnings and errors keep their level.
+func NewTusdLogger(logger *slog.Logger) *expslog.Logger {
+	return expslog.New(&tusdHandler{
+		handler: logger.With("component", "tusd").Handler(),
+	})
+}
+
+// tusdHandler implements the golang.org/x/exp/slog handler interface used by
+// tusd on top of a log/slog handler
+type tusdHandler struct {
+	handler slog.Handler
+}
+
+// Enabled reports whether the underlying handler accepts the mapped level
+func (h *tusdHandler) Enabled(ctx context.Context, level expslog.Level) bool {
+	return h.handler.Enabled(ctx, tusdLevel(level))
+}
+
+// Handle converts the record and passes it to the underlying handler
+func (h *tusdHandler) Handle(ctx context.Context, r expslog.Record) error {
+	level := tusdLevel(r.Level)
+	if r.Message == "BodyReadError" && clientAborted(r) {
+		level = slog.LevelDebug
+		if !h.handler.Enabled(ctx, level) {
+			return nil
+		}
+	}
+
+	record := slog.NewRecord(r.Time, level, r.Message, r.PC)
+	r.Attrs(func(a expslog.Attr) bool {
+		record.AddAttrs(convertAttr(a))
+		return true
+	})
+	return h.handler.Handle(ctx, record)
+}
+
+// WithAttrs returns a handler with the converted attributes attached
+func (h *tusdHandler) WithAttrs(attrs []expslog.Attr) expslog.Handler {
+	converted := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		converted = append(converted, convertAttr(a))
+	}
+	return &tusdHandler{handler: h.handler.WithAttrs(converted)}
+}
+
+// WithGroup returns a handler that nests subsequent attributes in a group
+func (h *tusdHandler) WithGroup(name string) expslog.Handler {
+	return &tusdHandler{handler: h.handler.WithGroup(name)}
+}
+
+// tusdLevel maps a tusd log level to the level we log it at
+func tusdLevel(level expslog.Level) slog.Level {
+	if level < expslog.LevelWarn {
+		return slog.LevelDebug
+	}
+	return slog.Level(level)
+}
+
+// clientAborted reports whether the error of a record is one of a client
+// going away mid-request
+func clientAborted(r expslog.Record) bool {
+	aborted := false
+	r.Attrs(func(a expslog.Attr) bool {
+		if a.Key != "error" {
+			return true
+		}
+		message := a.Value.Resolve().String()
+		for _, code := range clientAbortCodes {
+			if strings.Contains(message, code) {
+				aborted = true
+			}
+		}
+		return false
+	})
+	return aborted
+}
+
+// convertAttr converts an x/exp/slog attribute, renaming well-known keys
+func convertAttr(a expslog.Attr) slog.Attr {
+	key := a.Key
+	if renamed, ok := tusdAttrKeys[key]; ok {
+		key = renamed
+	}
+
+	value := a.Value.Resolve()
+	if value.Kind() == expslog.KindGroup {
+		group := value.Group()
+		attrs := make([]any, 0, len(group))
+		for _, ga := range group {
+			attrs = append(attrs, convertAttr(ga))
+		}
+		return slog.Group(key, attrs...)
+	}
+
+	return slog.Any(key, value.Any())
+}
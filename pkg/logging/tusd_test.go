@@ -0,0 +1,94 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+)
+
+func TestTusdLoggerForwardsRecords(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	tusdLogger := NewTusdLogger(logger).With("requestId", "req-1")
+	tusdLogger.With("id", "upload-1").Error("InternalServerError", "message", "boom")
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Failed to decode log record: %v", err)
+	}
+
+	expected := map[string]string{
+		"level":      "ERROR",
+		"msg":        "InternalServerError",
+		"component":  "tusd",
+		"request_id": "req-1",
+		"id":         "upload-1",
+		"message":    "boom",
+	}
+	for key, want := range expected {
+		if got := record[key]; got != want {
+			t.Errorf("Expected %s=%q, got %v", key, want, got)
+		}
+	}
+}
+
+func TestTusdLoggerDowngradesInfo(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	NewTusdLogger(logger).Info("RequestIncoming")
+	if buf.Len() != 0 {
+		t.Errorf("Expected tusd info records to be filtered at info level, got %s", buf.String())
+	}
+
+	NewTusdLogger(logger).Warn("NetworkTimeoutError")
+	if buf.Len() == 0 {
+		t.Error("Expected tusd warnings to be logged at info level")
+	}
+}
+
+func TestTusdLoggerDowngradesClientAborts(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	NewTusdLogger(logger).Error("BodyReadError", "error", errors.New("ERR_UNEXPECTED_EOF: server expected to receive more bytes"))
+	if buf.Len() != 0 {
+		t.Errorf("Expected client aborts to be filtered at info level, got %s", buf.String())
+	}
+
+	NewTusdLogger(logger).Error("BodyReadError", "error", errors.New("disk full"))
+	if buf.Len() == 0 {
+		t.Error("Expected other body read errors to be logged")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := map[string]slog.Level{
+		"debug":   slog.LevelDebug,
+		"INFO":    slog.LevelInfo,
+		"warn":    slog.LevelWarn,
+		"error":   slog.LevelError,
+		"unknown": slog.LevelInfo,
+	}
+	for input, want := range tests {
+		if got := ParseLevel(input); got != want {
+			t.Errorf("ParseLevel(%q) = %v, want %v", input, got, want)
+		}
+	}
+}
+
+func TestLookupLevel(t *testing.T) {
+	if _, ok := LookupLevel("loud"); ok {
+		t.Error("LookupLevel accepted an unknown level")
+	}
+	level, ok := LookupLevel("Warning")
+	if !ok || level != slog.LevelWarn {
+		t.Errorf("LookupLevel(Warning) = %v, %v, want warn", level, ok)
+	}
+	if name := LevelName(level); name != "warn" {
+		t.Errorf("LevelName(%v) = %q, want warn", level, name)
+	}
+}
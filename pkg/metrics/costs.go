@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/devsnb/large-file-uploads/pkg/costs"
+)
+
+// Costs exposes the latest storage cost report by tenant and storage class
+type Costs struct {
+	report     func() *costs.Report
+	maxTenants int
+	bytes      *prometheus.Desc
+	cost       *prometheus.Desc
+}
+
+// NewCosts creates a collector reading the latest report, which is nil
+// until the first report was produced. The maxTenants tenants storing the
+// most bytes get their own label value, the rest are summed as
+// OtherTenants. A non-positive limit uses DefaultMaxTenants.
+func NewCosts(report func() *costs.Report, maxTenants int) *Costs {
+	if maxTenants <= 0 {
+		maxTenants = DefaultMaxTenants
+	}
+	return &Costs{
+		report:     report,
+		maxTenants: maxTenants,
+		bytes: prometheus.NewDesc(
+			"uploads_stored_bytes",
+			"Bytes stored by tenant and storage class, as of the latest cost report",
+			[]string{"tenant", "storage_class"}, nil,
+		),
+		cost: prometheus.NewDesc(
+			"uploads_storage_cost_estimate",
+			"Estimated monthly storage cost by tenant and storage class, in the configured currency. Classes without a price are left out.",
+			[]string{"tenant", "storage_class", "currency"}, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *Costs) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.bytes
+	ch <- c.cost
+}
+
+// Collect implements prometheus.Collector
+func (c *Costs) Collect(ch chan<- prometheus.Metric) {
+	report := c.report()
+	if report == nil {
+		return
+	}
+
+	labels := c.tenantLabels(report.Lines)
+	type series struct{ tenant, class string }
+	bytes := make(map[series]int64)
+	cost := make(map[series]float64)
+	for _, line := range report.Lines {
+		key := series{labels[line.Tenant], line.StorageClass}
+		bytes[key] += line.Bytes
+		if line.PricePerGiB != nil {
+			cost[key] += line.MonthlyCost
+		}
+	}
+	for key, value := range bytes {
+		ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.GaugeValue, float64(value), key.tenant, key.class)
+	}
+	for key, value := range cost {
+		ch <- prometheus.MustNewConstMetric(c.cost, prometheus.GaugeValue, value, key.tenant, key.class, report.Currency)
+	}
+}
+
+// tenantLabels returns the label value of every tenant in the report,
+// naming only the tenants storing the most bytes
+func (c *Costs) tenantLabels(lines []costs.Line) map[string]string {
+	stored := make(map[string]int64)
+	for _, line := range lines {
+		stored[line.Tenant] += line.Bytes
+	}
+	tenants := make([]string, 0, len(stored))
+	for tenant := range stored {
+		if tenant != "" {
+			tenants = append(tenants, tenant)
+		}
+	}
+	slices.SortFunc(tenants, func(a, b string) int {
+		return cmp.Or(cmp.Compare(stored[b], stored[a]), cmp.Compare(a, b))
+	})
+
+	labels := map[string]string{"": NoTenant}
+	for i, tenant := range tenants {
+		labels[tenant] = tenant
+		if i >= c.maxTenants {
+			labels[tenant] = OtherTenants
+		}
+	}
+	return labels
+}
@@ -0,0 +1,34 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Divergences counts uploads whose stored offset differed from the offset
+// acknowledged to the client, as found when reconciling the upload journal
+type Divergences struct {
+	counter *prometheus.CounterVec
+}
+
+// NewDivergences creates a divergence counter
+func NewDivergences() *Divergences {
+	return &Divergences{
+		counter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "uploads_journal_divergences_total",
+			Help: "Uploads whose stored offset differed from the acknowledged one after a restart, by kind (lost, unacknowledged)",
+		}, []string{"kind"}),
+	}
+}
+
+// Inc counts a diverging upload
+func (d *Divergences) Inc(kind string) {
+	d.counter.WithLabelValues(kind).Inc()
+}
+
+// Describe implements prometheus.Collector
+func (d *Divergences) Describe(ch chan<- *prometheus.Desc) {
+	d.counter.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (d *Divergences) Collect(ch chan<- prometheus.Metric) {
+	d.counter.Collect(ch)
+}
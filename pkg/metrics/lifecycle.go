@@ -0,0 +1,200 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultMaxTenants is how many tenants get their own label value unless
+// configured
+const DefaultMaxTenants = 20
+
+// Tenant label values that don't name a tenant
+const (
+	NoTenant     = "none"  // Uploads of anonymous users or users without a tenant
+	OtherTenants = "other" // Tenants seen after the label limit was reached
+)
+
+// lifecycleRetention is how long an upload is tracked without requests
+// before it is forgotten
+const lifecycleRetention = 7 * 24 * time.Hour
+
+// sizeClasses are the upper bounds of the size classes uploads are grouped
+// in, so SLOs can be set per class
+var sizeClasses = []struct {
+	limit int64
+	label string
+}{
+	{10 << 20, "under_10MiB"},
+	{100 << 20, "under_100MiB"},
+	{1 << 30, "under_1GiB"},
+	{10 << 30, "under_10GiB"},
+}
+
+// largestSizeClass holds the uploads beyond the last bound
+const largestSizeClass = "10GiB_and_over"
+
+// SizeClass returns the size class label of an upload size
+func SizeClass(size int64) string {
+	for _, class := range sizeClasses {
+		if size < class.limit {
+			return class.label
+		}
+	}
+	return largestSizeClass
+}
+
+// lifecycle is the progress of a tracked upload
+type lifecycle struct {
+	tenant    string
+	size      int64 // negative while deferred
+	startedAt time.Time
+	seenAt    time.Time
+	bytes     int64
+	chunks    int
+}
+
+// Lifecycles measures how long uploads take to complete, how many bytes
+// clients sent for them and in how many chunks, by tenant and size class.
+// Only uploads created by this instance are tracked.
+type Lifecycles struct {
+	mu         sync.Mutex
+	uploads    map[string]*lifecycle
+	tenants    map[string]bool
+	maxTenants int
+	lastPrune  time.Time
+	now        func() time.Time
+
+	duration *prometheus.HistogramVec
+	bytes    *prometheus.HistogramVec
+	chunks   *prometheus.HistogramVec
+}
+
+// NewLifecycles creates the upload lifecycle histograms. At most maxTenants
+// tenants get their own label value, the rest are reported as OtherTenants.
+// A non-positive limit uses DefaultMaxTenants.
+func NewLifecycles(maxTenants int) *Lifecycles {
+	if maxTenants <= 0 {
+		maxTenants = DefaultMaxTenants
+	}
+	labels := []string{"tenant", "size_class"}
+	return &Lifecycles{
+		uploads:    make(map[string]*lifecycle),
+		tenants:    make(map[string]bool),
+		maxTenants: maxTenants,
+		now:        time.Now,
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "uploads_time_to_complete_seconds",
+			Help:    "Time from creating to completing an upload, by tenant and size class",
+			Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600, 7200, 21600, 86400},
+		}, labels),
+		bytes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "uploads_transferred_bytes",
+			Help:    "Bytes clients sent for a completed upload, including re-sent data, by tenant and size class",
+			Buckets: prometheus.ExponentialBuckets(1<<20, 4, 10),
+		}, labels),
+		chunks: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "uploads_chunks",
+			Help:    "Requests carrying data for a completed upload, by tenant and size class",
+			Buckets: []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 5000},
+		}, labels),
+	}
+}
+
+// Start tracks a created upload. A negative size means it is deferred.
+func (l *Lifecycles) Start(id, tenant string, size int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+	l.uploads[id] = &lifecycle{tenant: l.tenantLabel(tenant), size: size, startedAt: now, seenAt: now}
+}
+
+// DeclareSize records the size of an upload created with a deferred size
+func (l *Lifecycles) DeclareSize(id string, size int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if upload, ok := l.uploads[id]; ok && upload.size < 0 {
+		upload.size = size
+	}
+}
+
+// Transfer records a request that sent n bytes of an upload, whose offset
+// is offset afterwards, and observes the upload once it completed
+func (l *Lifecycles) Transfer(id string, n, offset int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	upload, ok := l.uploads[id]
+	if !ok {
+		return
+	}
+	now := l.now()
+	upload.seenAt = now
+	upload.bytes += n
+	upload.chunks++
+	if upload.size < 0 || offset < upload.size {
+		return
+	}
+
+	delete(l.uploads, id)
+	class := SizeClass(upload.size)
+	l.duration.WithLabelValues(upload.tenant, class).Observe(now.Sub(upload.startedAt).Seconds())
+	l.bytes.WithLabelValues(upload.tenant, class).Observe(float64(upload.bytes))
+	l.chunks.WithLabelValues(upload.tenant, class).Observe(float64(upload.chunks))
+}
+
+// Forget stops tracking a terminated upload
+func (l *Lifecycles) Forget(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.uploads, id)
+}
+
+// tenantLabel returns the label value of a tenant, guarding the cardinality
+// of the histograms
+func (l *Lifecycles) tenantLabel(tenant string) string {
+	switch {
+	case tenant == "":
+		return NoTenant
+	case l.tenants[tenant]:
+		return tenant
+	case len(l.tenants) < l.maxTenants:
+		l.tenants[tenant] = true
+		return tenant
+	default:
+		return OtherTenants
+	}
+}
+
+// prune forgets uploads without requests for the retention period, at most
+// once an hour
+func (l *Lifecycles) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < time.Hour {
+		return
+	}
+	l.lastPrune = now
+	for id, upload := range l.uploads {
+		if now.Sub(upload.seenAt) > lifecycleRetention {
+			delete(l.uploads, id)
+		}
+	}
+}
+
+// Describe implements prometheus.Collector
+func (l *Lifecycles) Describe(ch chan<- *prometheus.Desc) {
+	l.duration.Describe(ch)
+	l.bytes.Describe(ch)
+	l.chunks.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (l *Lifecycles) Collect(ch chan<- prometheus.Metric) {
+	l.duration.Collect(ch)
+	l.bytes.Collect(ch)
+	l.chunks.Collect(ch)
+}
@@ -0,0 +1,152 @@
+// Package metrics exposes Prometheus gauges describing upload pipeline
+// backlogs, so operators can alert when post-processing, webhook
+// deliveries or clients fall behind
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/devsnb/large-file-uploads/pkg/deadletter"
+	"github.com/devsnb/large-file-uploads/pkg/uploadstate"
+)
+
+// DefaultStaleAfter is how long an incomplete upload may go without
+// progress before it counts as stale unless configured
+const DefaultStaleAfter = 24 * time.Hour
+
+// callbackKind is always reported so alerts see a zero rather than a gap
+const callbackKind = "callback"
+
+// collectTimeout bounds how long a scrape may spend reading the stores
+const collectTimeout = 10 * time.Second
+
+// StateLister lists upload state records
+type StateLister interface {
+	List(ctx context.Context) ([]uploadstate.Record, error)
+}
+
+// DeadLetterLister lists failed deliveries awaiting redelivery
+type DeadLetterLister interface {
+	List(ctx context.Context) ([]deadletter.Entry, error)
+}
+
+// Collector computes backlog gauges from the upload state machine and the
+// dead-letter queue on each scrape
+type Collector struct {
+	states      StateLister
+	deadLetters DeadLetterLister
+	staleAfter  time.Duration
+	now         func() time.Time
+
+	pendingJobs  *prometheus.Desc
+	retryQueue   *prometheus.Desc
+	staleUploads *prometheus.Desc
+	oldestUpload *prometheus.Desc
+	sourceUp     *prometheus.Desc
+}
+
+// NewCollector creates a collector. Incomplete uploads without progress for
+// staleAfter count as stale.
+func NewCollector(states StateLister, deadLetters DeadLetterLister, staleAfter time.Duration) *Collector {
+	if staleAfter <= 0 {
+		staleAfter = DefaultStaleAfter
+	}
+	return &Collector{
+		states:      states,
+		deadLetters: deadLetters,
+		staleAfter:  staleAfter,
+		now:         time.Now,
+		pendingJobs: prometheus.NewDesc("uploads_postprocessing_pending",
+			"Uploads waiting for or undergoing post-processing, by state",
+			[]string{"state"}, nil),
+		retryQueue: prometheus.NewDesc("uploads_webhook_retry_queue_depth",
+			"Deliveries in the dead-letter queue awaiting redelivery, by kind",
+			[]string{"kind"}, nil),
+		staleUploads: prometheus.NewDesc("uploads_stale",
+			"Incomplete uploads without progress for longer than the stale threshold",
+			nil, nil),
+		oldestUpload: prometheus.NewDesc("uploads_oldest_incomplete_age_seconds",
+			"Age of the oldest incomplete upload, 0 if there is none",
+			nil, nil),
+		sourceUp: prometheus.NewDesc("uploads_metrics_source_up",
+			"Whether the source of the backlog gauges could be read",
+			[]string{"source"}, nil),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.pendingJobs
+	ch <- c.retryQueue
+	ch <- c.staleUploads
+	ch <- c.oldestUpload
+	ch <- c.sourceUp
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+
+	c.collectStates(ctx, ch)
+	c.collectDeadLetters(ctx, ch)
+}
+
+// collectStates derives the post-processing, stale and age gauges from the
+// upload state records
+func (c *Collector) collectStates(ctx context.Context, ch chan<- prometheus.Metric) {
+	records, err := c.states.List(ctx)
+	if err != nil {
+		slog.Error("Failed to list upload states for metrics", "error", err)
+		ch <- prometheus.MustNewConstMetric(c.sourceUp, prometheus.GaugeValue, 0, "states")
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.sourceUp, prometheus.GaugeValue, 1, "states")
+
+	now := c.now()
+	var uploaded, processing, stale int
+	var oldest time.Duration
+	for _, record := range records {
+		switch {
+		case record.State == uploadstate.Uploaded:
+			uploaded++
+		case record.State == uploadstate.Processing:
+			processing++
+		case record.State.Incomplete():
+			if now.Sub(record.LastProgress()) > c.staleAfter {
+				stale++
+			}
+			if age := now.Sub(record.CreatedAt); age > oldest {
+				oldest = age
+			}
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.pendingJobs, prometheus.GaugeValue, float64(uploaded), string(uploadstate.Uploaded))
+	ch <- prometheus.MustNewConstMetric(c.pendingJobs, prometheus.GaugeValue, float64(processing), string(uploadstate.Processing))
+	ch <- prometheus.MustNewConstMetric(c.staleUploads, prometheus.GaugeValue, float64(stale))
+	ch <- prometheus.MustNewConstMetric(c.oldestUpload, prometheus.GaugeValue, oldest.Seconds())
+}
+
+// collectDeadLetters reports the depth of the webhook retry queue
+func (c *Collector) collectDeadLetters(ctx context.Context, ch chan<- prometheus.Metric) {
+	entries, err := c.deadLetters.List(ctx)
+	if err != nil {
+		slog.Error("Failed to list dead letters for metrics", "error", err)
+		ch <- prometheus.MustNewConstMetric(c.sourceUp, prometheus.GaugeValue, 0, "deadletters")
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.sourceUp, prometheus.GaugeValue, 1, "deadletters")
+
+	depth := map[string]int{callbackKind: 0}
+	for _, entry := range entries {
+		depth[entry.Kind]++
+	}
+	for kind, n := range depth {
+		ch <- prometheus.MustNewConstMetric(c.retryQueue, prometheus.GaugeValue, float64(n), kind)
+	}
+}
@@ -0,0 +1,163 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/devsnb/large-file-uploads/pkg/costs"
+	"github.com/devsnb/large-file-uploads/pkg/deadletter"
+	"github.com/devsnb/large-file-uploads/pkg/uploadstate"
+)
+
+type stateList []uploadstate.Record
+
+func (l stateList) List(context.Context) ([]uploadstate.Record, error) { return l, nil }
+
+type deadLetterList []deadletter.Entry
+
+func (l deadLetterList) List(context.Context) ([]deadletter.Entry, error) { return l, nil }
+
+func TestCollector(t *testing.T) {
+	now := time.Now()
+	states := stateList{
+		{ID: "a", State: uploadstate.Uploading, CreatedAt: now.Add(-3 * time.Hour), UpdatedAt: now, ProgressAt: now.Add(-2 * time.Hour)},
+		{ID: "b", State: uploadstate.Created, CreatedAt: now.Add(-time.Minute), UpdatedAt: now.Add(-time.Minute)},
+		{ID: "f", State: uploadstate.Uploading, CreatedAt: now.Add(-2 * time.Hour), UpdatedAt: now.Add(-2 * time.Hour), ProgressAt: now.Add(-time.Minute)},
+		{ID: "c", State: uploadstate.Uploaded, CreatedAt: now, UpdatedAt: now},
+		{ID: "d", State: uploadstate.Processing, CreatedAt: now, UpdatedAt: now},
+		{ID: "e", State: uploadstate.Ready, CreatedAt: now.Add(-48 * time.Hour), UpdatedAt: now},
+	}
+	deadLetters := deadLetterList{{Kind: "callback"}, {Kind: "callback"}}
+
+	collector := NewCollector(states, deadLetters, time.Hour)
+	collector.now = func() time.Time { return now }
+
+	expected := `
+# HELP uploads_oldest_incomplete_age_seconds Age of the oldest incomplete upload, 0 if there is none
+# TYPE uploads_oldest_incomplete_age_seconds gauge
+uploads_oldest_incomplete_age_seconds 10800
+# HELP uploads_postprocessing_pending Uploads waiting for or undergoing post-processing, by state
+# TYPE uploads_postprocessing_pending gauge
+uploads_postprocessing_pending{state="processing"} 1
+uploads_postprocessing_pending{state="uploaded"} 1
+# HELP uploads_stale Incomplete uploads without progress for longer than the stale threshold
+# TYPE uploads_stale gauge
+uploads_stale 1
+# HELP uploads_webhook_retry_queue_depth Deliveries in the dead-letter queue awaiting redelivery, by kind
+# TYPE uploads_webhook_retry_queue_depth gauge
+uploads_webhook_retry_queue_depth{kind="callback"} 2
+`
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		"uploads_oldest_incomplete_age_seconds",
+		"uploads_postprocessing_pending",
+		"uploads_stale",
+		"uploads_webhook_retry_queue_depth")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTraceID(t *testing.T) {
+	tests := map[string]string{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01":        "4bf92f3577b34da6a3ce929d0e0e4736",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00":        "", // not sampled
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01":        "",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01":        "",
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future": "4bf92f3577b34da6a3ce929d0e0e4736",
+		"garbage": "",
+	}
+	for header, want := range tests {
+		if got := TraceID(header); got != want {
+			t.Errorf("TraceID(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestLifecycles(t *testing.T) {
+	now := time.Now()
+	lifecycles := NewLifecycles(1)
+	lifecycles.now = func() time.Time { return now }
+
+	lifecycles.Start("a", "acme", 3<<20)
+	lifecycles.Start("b", "globex", -1)
+	lifecycles.Start("c", "", 10)
+
+	now = now.Add(90 * time.Second)
+	lifecycles.Transfer("a", 2<<20, 1<<20) // Failed chunk re-sent later
+	lifecycles.Transfer("a", 2<<20, 3<<20)
+	lifecycles.Transfer("b", 5, 5)
+	lifecycles.DeclareSize("b", 20<<30)
+	lifecycles.Transfer("b", 20<<30, 20<<30)
+	lifecycles.Forget("c")
+	lifecycles.Transfer("c", 10, 10)
+
+	if n := testutil.CollectAndCount(lifecycles, "uploads_time_to_complete_seconds"); n != 2 {
+		t.Fatalf("expected 2 series, got %d", n)
+	}
+	expected := `
+# HELP uploads_chunks Requests carrying data for a completed upload, by tenant and size class
+# TYPE uploads_chunks histogram
+uploads_chunks_bucket{size_class="10GiB_and_over",tenant="other",le="1"} 0
+uploads_chunks_bucket{size_class="10GiB_and_over",tenant="other",le="2"} 1
+uploads_chunks_bucket{size_class="10GiB_and_over",tenant="other",le="5"} 1
+uploads_chunks_bucket{size_class="10GiB_and_over",tenant="other",le="10"} 1
+uploads_chunks_bucket{size_class="10GiB_and_over",tenant="other",le="20"} 1
+uploads_chunks_bucket{size_class="10GiB_and_over",tenant="other",le="50"} 1
+uploads_chunks_bucket{size_class="10GiB_and_over",tenant="other",le="100"} 1
+uploads_chunks_bucket{size_class="10GiB_and_over",tenant="other",le="200"} 1
+uploads_chunks_bucket{size_class="10GiB_and_over",tenant="other",le="500"} 1
+uploads_chunks_bucket{size_class="10GiB_and_over",tenant="other",le="1000"} 1
+uploads_chunks_bucket{size_class="10GiB_and_over",tenant="other",le="5000"} 1
+uploads_chunks_bucket{size_class="10GiB_and_over",tenant="other",le="+Inf"} 1
+uploads_chunks_sum{size_class="10GiB_and_over",tenant="other"} 2
+uploads_chunks_count{size_class="10GiB_and_over",tenant="other"} 1
+uploads_chunks_bucket{size_class="under_10MiB",tenant="acme",le="1"} 0
+uploads_chunks_bucket{size_class="under_10MiB",tenant="acme",le="2"} 1
+uploads_chunks_bucket{size_class="under_10MiB",tenant="acme",le="5"} 1
+uploads_chunks_bucket{size_class="under_10MiB",tenant="acme",le="10"} 1
+uploads_chunks_bucket{size_class="under_10MiB",tenant="acme",le="20"} 1
+uploads_chunks_bucket{size_class="under_10MiB",tenant="acme",le="50"} 1
+uploads_chunks_bucket{size_class="under_10MiB",tenant="acme",le="100"} 1
+uploads_chunks_bucket{size_class="under_10MiB",tenant="acme",le="200"} 1
+uploads_chunks_bucket{size_class="under_10MiB",tenant="acme",le="500"} 1
+uploads_chunks_bucket{size_class="under_10MiB",tenant="acme",le="1000"} 1
+uploads_chunks_bucket{size_class="under_10MiB",tenant="acme",le="5000"} 1
+uploads_chunks_bucket{size_class="under_10MiB",tenant="acme",le="+Inf"} 1
+uploads_chunks_sum{size_class="under_10MiB",tenant="acme"} 2
+uploads_chunks_count{size_class="under_10MiB",tenant="acme"} 1
+`
+	if err := testutil.CollectAndCompare(lifecycles, strings.NewReader(expected), "uploads_chunks"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCostsLimitTenants(t *testing.T) {
+	price := 0.5
+	report := &costs.Report{Currency: "USD", Lines: []costs.Line{
+		{Tenant: "acme", StorageClass: "STANDARD", Bytes: 300, PricePerGiB: &price, MonthlyCost: 3},
+		{Tenant: "globex", StorageClass: "STANDARD", Bytes: 200, PricePerGiB: &price, MonthlyCost: 2},
+		{Tenant: "initech", StorageClass: "STANDARD", Bytes: 100, PricePerGiB: &price, MonthlyCost: 1},
+		{Tenant: "initech", StorageClass: "GLACIER", Bytes: 50},
+		{StorageClass: "STANDARD", Bytes: 10, PricePerGiB: &price, MonthlyCost: 0.1},
+	}}
+	collector := NewCosts(func() *costs.Report { return report }, 1)
+
+	expected := `
+# HELP uploads_stored_bytes Bytes stored by tenant and storage class, as of the latest cost report
+# TYPE uploads_stored_bytes gauge
+uploads_stored_bytes{storage_class="GLACIER",tenant="other"} 50
+uploads_stored_bytes{storage_class="STANDARD",tenant="acme"} 300
+uploads_stored_bytes{storage_class="STANDARD",tenant="none"} 10
+uploads_stored_bytes{storage_class="STANDARD",tenant="other"} 300
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "uploads_stored_bytes"); err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.CollectAndCount(collector, "uploads_storage_cost_estimate"); n != 3 {
+		t.Fatalf("expected costs of 3 priced series, got %d", n)
+	}
+}
@@ -0,0 +1,34 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Panics counts requests whose handler panicked
+type Panics struct {
+	counter *prometheus.CounterVec
+}
+
+// NewPanics creates a panic counter
+func NewPanics() *Panics {
+	return &Panics{
+		counter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "uploads_panics_total",
+			Help: "Requests whose handler panicked, by method and route",
+		}, []string{"method", "route"}),
+	}
+}
+
+// Inc counts a panic. Requests matching no route are counted with an empty
+// route.
+func (p *Panics) Inc(method, route string) {
+	p.counter.WithLabelValues(method, route).Inc()
+}
+
+// Describe implements prometheus.Collector
+func (p *Panics) Describe(ch chan<- *prometheus.Desc) {
+	p.counter.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (p *Panics) Collect(ch chan<- prometheus.Metric) {
+	p.counter.Collect(ch)
+}
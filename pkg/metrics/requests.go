@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TraceIDLabel is the exemplar label holding the trace ID
+const TraceIDLabel = "trace_id"
+
+// TraceParentHeader carries the W3C trace context of a request
+const TraceParentHeader = "traceparent"
+
+// Requests measures the latency of upload requests. Observations can carry
+// the trace ID of the request as an exemplar, linking latency spikes to
+// their traces.
+type Requests struct {
+	histogram *prometheus.HistogramVec
+}
+
+// NewRequests creates an upload request latency histogram
+func NewRequests() *Requests {
+	return &Requests{
+		histogram: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "uploads_http_request_duration_seconds",
+			Help:    "Latency of upload requests, by method and status code",
+			Buckets: prometheus.ExponentialBuckets(0.005, 4, 10),
+		}, []string{"method", "code"}),
+	}
+}
+
+// Observe records the duration of a request. A non-empty trace ID is
+// attached as an exemplar.
+func (r *Requests) Observe(method string, status int, duration time.Duration, traceID string) {
+	observer := r.histogram.WithLabelValues(method, strconv.Itoa(status))
+	if traceID != "" {
+		if exemplars, ok := observer.(prometheus.ExemplarObserver); ok {
+			exemplars.ObserveWithExemplar(duration.Seconds(), prometheus.Labels{TraceIDLabel: traceID})
+			return
+		}
+	}
+	observer.Observe(duration.Seconds())
+}
+
+// Describe implements prometheus.Collector
+func (r *Requests) Describe(ch chan<- *prometheus.Desc) {
+	r.histogram.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (r *Requests) Collect(ch chan<- prometheus.Metric) {
+	r.histogram.Collect(ch)
+}
+
+// TraceID returns the trace ID of a W3C traceparent header if the trace is
+// sampled, and an empty string otherwise. Unsampled traces are never
+// recorded, so linking to them would lead nowhere.
+func TraceID(traceparent string) string {
+	// version "-" trace-id "-" parent-id "-" trace-flags
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return ""
+	}
+	traceID, parentID, flags := parts[1], parts[2], parts[3]
+	if len(traceID) != 32 || len(parentID) != 16 || len(flags) != 2 ||
+		!isLowerHex(traceID) || !isLowerHex(parentID) || traceID == strings.Repeat("0", 32) {
+		return ""
+	}
+	sampled, err := strconv.ParseUint(flags, 16, 8)
+	if err != nil || sampled&1 == 0 {
+		return ""
+	}
+	return traceID
+}
+
+// isLowerHex reports whether s consists of lowercase hex digits only
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
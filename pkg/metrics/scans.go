@@ -0,0 +1,46 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Scans counts antivirus scans of completed uploads by engine and result,
+// and the uploads whose verdict was cached instead
+type Scans struct {
+	counter *prometheus.CounterVec
+	cached  *prometheus.CounterVec
+}
+
+// NewScans creates a scan counter
+func NewScans() *Scans {
+	return &Scans{
+		counter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "uploads_scans_total",
+			Help: "Antivirus scans of completed uploads, by engine and result (clean, infected, error)",
+		}, []string{"engine", "result"}),
+		cached: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "uploads_scans_cached_total",
+			Help: "Completed uploads given a cached antivirus verdict instead of a scan, by engine and result (clean, infected)",
+		}, []string{"engine", "result"}),
+	}
+}
+
+// Inc counts a scan
+func (s *Scans) Inc(engine, result string) {
+	s.counter.WithLabelValues(engine, result).Inc()
+}
+
+// IncCached counts an upload given a cached verdict
+func (s *Scans) IncCached(engine, result string) {
+	s.cached.WithLabelValues(engine, result).Inc()
+}
+
+// Describe implements prometheus.Collector
+func (s *Scans) Describe(ch chan<- *prometheus.Desc) {
+	s.counter.Describe(ch)
+	s.cached.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (s *Scans) Collect(ch chan<- prometheus.Metric) {
+	s.counter.Collect(ch)
+	s.cached.Collect(ch)
+}
@@ -0,0 +1,34 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Throttles counts storage operations refused by the backend because of
+// throttling or an exhausted quota
+type Throttles struct {
+	counter *prometheus.CounterVec
+}
+
+// NewThrottles creates a throttle counter
+func NewThrottles() *Throttles {
+	return &Throttles{
+		counter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "uploads_storage_throttled_total",
+			Help: "Storage operations refused by the backend, by kind (rate_limited, quota_exceeded) and operation",
+		}, []string{"kind", "operation"}),
+	}
+}
+
+// Inc counts a throttled operation
+func (t *Throttles) Inc(kind, operation string) {
+	t.counter.WithLabelValues(kind, operation).Inc()
+}
+
+// Describe implements prometheus.Collector
+func (t *Throttles) Describe(ch chan<- *prometheus.Desc) {
+	t.counter.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (t *Throttles) Collect(ch chan<- prometheus.Metric) {
+	t.counter.Collect(ch)
+}
@@ -0,0 +1,106 @@
+// Package milestone tracks the progress milestones uploads have reached, so
+// progress can be reported at a few percentages instead of on every chunk
+package milestone
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultPercentages are the milestones used when none are configured
+var DefaultPercentages = []int{25, 50, 75, 100}
+
+// Retention is how long an upload is tracked after its last progress
+const Retention = 24 * time.Hour
+
+// entry is the progress of one upload
+type entry struct {
+	reached int
+	updated time.Time
+}
+
+// Tracker remembers the highest milestone each upload has reached. It is
+// kept in memory, so milestones are reported again after a restart or when
+// an upload continues on another instance.
+type Tracker struct {
+	percentages []int
+
+	mu        sync.Mutex
+	uploads   map[string]entry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// New creates a tracker for the given percentages, which must be between 1
+// and 100
+func New(percentages []int) (*Tracker, error) {
+	if len(percentages) == 0 {
+		percentages = DefaultPercentages
+	}
+	sorted := slices.Clone(percentages)
+	slices.Sort(sorted)
+	sorted = slices.Compact(sorted)
+	for _, p := range sorted {
+		if p < 1 || p > 100 {
+			return nil, fmt.Errorf("progress milestone %d must be between 1 and 100", p)
+		}
+	}
+
+	return &Tracker{
+		percentages: sorted,
+		uploads:     make(map[string]entry),
+		now:         time.Now,
+	}, nil
+}
+
+// Reach records the progress of an upload and returns the milestones it
+// passed since the last call, in ascending order. Progress reported out of
+// order never yields a milestone twice.
+func (t *Tracker) Reach(id string, offset, size int64) []int {
+	if size < 0 {
+		return nil
+	}
+	percent := 100
+	if size > 0 {
+		percent = int(offset * 100 / size)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.sweep(now)
+
+	e := t.uploads[id]
+	var passed []int
+	for _, p := range t.percentages {
+		if p > e.reached && p <= percent {
+			passed = append(passed, p)
+		}
+	}
+	t.uploads[id] = entry{reached: max(e.reached, percent), updated: now}
+	return passed
+}
+
+// Forget stops tracking an upload, e.g. when it is terminated
+func (t *Tracker) Forget(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.uploads, id)
+}
+
+// sweep drops uploads without progress for longer than the retention, at
+// most once an hour
+func (t *Tracker) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < time.Hour {
+		return
+	}
+	t.lastSweep = now
+	for id, e := range t.uploads {
+		if now.Sub(e.updated) > Retention {
+			delete(t.uploads, id)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package milestone
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestReach(t *testing.T) {
+	tracker, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		offset int64
+		want   []int
+	}{
+		{10, nil},
+		{30, []int{25}},
+		{80, []int{50, 75}},
+		{60, nil}, // late progress event
+		{100, []int{100}},
+		{100, nil},
+	}
+	for _, step := range steps {
+		if got := tracker.Reach("a", step.offset, 100); !slices.Equal(got, step.want) {
+			t.Fatalf("Reach(%d) = %v, want %v", step.offset, got, step.want)
+		}
+	}
+
+	if got := tracker.Reach("empty", 0, 0); !slices.Equal(got, DefaultPercentages) {
+		t.Fatalf("empty upload reached %v", got)
+	}
+
+	tracker.Forget("a")
+	if got := tracker.Reach("a", 50, 100); !slices.Equal(got, []int{25, 50}) {
+		t.Fatalf("forgotten upload reached %v", got)
+	}
+}
+
+func TestNewValidatesPercentages(t *testing.T) {
+	tracker, err := New([]int{50, 10, 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tracker.Reach("a", 60, 100); !slices.Equal(got, []int{10, 50}) {
+		t.Fatalf("Reach = %v", got)
+	}
+
+	for _, invalid := range [][]int{{0}, {101}, {-5, 50}} {
+		if _, err := New(invalid); err == nil {
+			t.Errorf("New(%v) should fail", invalid)
+		}
+	}
+}
+
+func TestSweep(t *testing.T) {
+	tracker, _ := New(nil)
+	now := time.Now()
+	tracker.now = func() time.Time { return now }
+	tracker.Reach("stale", 30, 100)
+
+	now = now.Add(Retention + 2*time.Hour)
+	tracker.Reach("other", 0, 100)
+	if _, ok := tracker.uploads["stale"]; ok {
+		t.Fatal("expected the stale upload to be dropped")
+	}
+}
@@ -0,0 +1,155 @@
+// Package opa authorizes upload operations with policies evaluated by an
+// Open Policy Agent server
+package opa
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+)
+
+// maxResponseSize bounds the decisions read from OPA
+const maxResponseSize = 1 << 20
+
+// Input is the document a policy is evaluated against, available to it as
+// input
+type Input struct {
+	Action string `json:"action"`
+	User   *User  `json:"user"` // nil for anonymous requests
+	Upload Upload `json:"upload"`
+}
+
+// User holds the claims of the authenticated user
+type User struct {
+	ID       string `json:"id"`
+	Username string `json:"username,omitempty"`
+	Role     string `json:"role,omitempty"`
+	Tenant   string `json:"tenant,omitempty"`
+}
+
+// Upload describes the upload the action is performed on. It has no ID when
+// the upload is being created.
+type Upload struct {
+	ID       string            `json:"id,omitempty"`
+	Size     *int64            `json:"size,omitempty"` // nil when the size is deferred
+	Offset   int64             `json:"offset"`
+	MetaData map[string]string `json:"metadata"`
+}
+
+// Decision is the object form of a policy result. A policy may also return
+// a plain boolean.
+type Decision struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason,omitempty"` // Returned to the client when denied
+}
+
+// Authorizer queries a decision of a remote OPA server through its data
+// API for every upload operation
+type Authorizer struct {
+	url        string
+	httpClient *http.Client
+}
+
+// New creates an authorizer querying the decision at the URL of OPA's data
+// API, e.g. http://opa:8181/v1/data/uploads/allow
+func New(url string, timeout time.Duration) *Authorizer {
+	return &Authorizer{
+		url:        url,
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// Authorize evaluates the policy for the action. Undefined decisions deny
+// the action.
+func (a *Authorizer) Authorize(ctx context.Context, user *auth.User, action auth.Action, uploadID string) error {
+	decision, err := a.Decide(ctx, NewInput(ctx, user, action, uploadID))
+	if err != nil {
+		return err
+	}
+	if !decision.Allow {
+		if decision.Reason != "" {
+			return fmt.Errorf("%w: %s", auth.ErrForbidden, decision.Reason)
+		}
+		return auth.ErrForbidden
+	}
+	return nil
+}
+
+// NewInput builds the input of a policy from the request context
+func NewInput(ctx context.Context, user *auth.User, action auth.Action, uploadID string) Input {
+	input := Input{Action: string(action), Upload: Upload{ID: uploadID, MetaData: map[string]string{}}}
+	if user != nil {
+		input.User = &User{ID: user.ID, Username: user.Username, Role: user.Role, Tenant: user.Tenant}
+	}
+	if upload, ok := auth.UploadFromContext(ctx); ok {
+		if !upload.SizeIsDeferred {
+			input.Upload.Size = &upload.Size
+		}
+		input.Upload.Offset = upload.Offset
+		if upload.MetaData != nil {
+			input.Upload.MetaData = upload.MetaData
+		}
+	}
+	return input
+}
+
+// Decide queries the decision for an input
+func (a *Authorizer) Decide(ctx context.Context, input Input) (Decision, error) {
+	body, err := json.Marshal(map[string]Input{"input": input})
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to encode policy input: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to create policy request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to query policy: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to read policy decision: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Decision{}, fmt.Errorf("policy query failed with status %d: %s", resp.StatusCode, bytes.TrimSpace(data))
+	}
+
+	var result struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return Decision{}, fmt.Errorf("failed to decode policy decision: %w", err)
+	}
+	return parseDecision(result.Result)
+}
+
+// parseDecision accepts a boolean or a decision object. A missing result
+// means the policy is undefined for the input.
+func parseDecision(result json.RawMessage) (Decision, error) {
+	if len(result) == 0 || string(result) == "null" {
+		return Decision{Reason: "policy decision is undefined"}, nil
+	}
+
+	var allow bool
+	if err := json.Unmarshal(result, &allow); err == nil {
+		return Decision{Allow: allow}, nil
+	}
+
+	var decision Decision
+	if err := json.Unmarshal(result, &decision); err != nil {
+		return Decision{}, fmt.Errorf("policy decision must be a boolean or an object with allow: %w", err)
+	}
+	return decision, nil
+}
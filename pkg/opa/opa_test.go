@@ -0,0 +1,68 @@
+package opa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+)
+
+func TestAuthorize(t *testing.T) {
+	var inputs []Input
+	results := []string{
+		`{"result": true}`,
+		`{"result": {"allow": false, "reason": "uploads over 1 GiB need approval"}}`,
+		`{}`,
+	}
+	opa := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input Input `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, body.Input)
+		w.Write([]byte(results[len(inputs)-1]))
+	}))
+	defer opa.Close()
+
+	a := New(opa.URL, time.Second)
+	user := &auth.User{ID: "alice", Role: "user", Tenant: "acme"}
+	ctx := auth.WithUpload(context.Background(), auth.Upload{Size: 2 << 30, MetaData: map[string]string{"filename": "a.bin"}})
+
+	if err := a.Authorize(ctx, user, auth.ActionCreate, ""); err != nil {
+		t.Fatalf("expected the action to be allowed, got %v", err)
+	}
+	err := a.Authorize(ctx, user, auth.ActionCreate, "")
+	if !errors.Is(err, auth.ErrForbidden) || err.Error() != "action not allowed: uploads over 1 GiB need approval" {
+		t.Fatalf("expected a denial with the reason, got %v", err)
+	}
+	if err := a.Authorize(context.Background(), nil, auth.ActionRead, "u1"); !errors.Is(err, auth.ErrForbidden) {
+		t.Fatalf("expected undefined decisions to deny, got %v", err)
+	}
+
+	got := inputs[0]
+	if got.Action != "create" || got.User.Tenant != "acme" || *got.Upload.Size != 2<<30 || got.Upload.MetaData["filename"] != "a.bin" {
+		t.Errorf("unexpected input %+v", got)
+	}
+	if got := inputs[2]; got.User != nil || got.Upload.ID != "u1" || got.Upload.Size != nil {
+		t.Errorf("unexpected anonymous input %+v", got)
+	}
+}
+
+func TestAuthorizeFailure(t *testing.T) {
+	opa := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "policy error", http.StatusInternalServerError)
+	}))
+	defer opa.Close()
+
+	err := New(opa.URL, time.Second).Authorize(context.Background(), nil, auth.ActionRead, "u1")
+	if err == nil || errors.Is(err, auth.ErrForbidden) {
+		t.Fatalf("expected failures to be reported as errors, got %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+// Package origin resolves the address and country uploads are created from,
+// honoring the forwarding headers of trusted proxies only, for abuse
+// investigations and data-residency reporting
+package origin
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// countryPattern matches ISO 3166-1 alpha-2 country codes
+var countryPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// ErrInvalid is returned for malformed proxies or database entries
+var ErrInvalid = errors.New("invalid origin configuration")
+
+// Origin is where a request came from
+type Origin struct {
+	// IP is the client's address, empty if the request carried none
+	IP string `json:"ip,omitempty"`
+
+	// Country is the client's ISO country code, empty when unknown
+	Country string `json:"country,omitempty"`
+}
+
+// Resolver resolves the origin of requests
+type Resolver struct {
+	proxies       []netip.Prefix
+	countryHeader string
+	countries     *Database
+}
+
+// NewResolver creates a resolver. trustedProxies lists the addresses or
+// CIDRs whose X-Forwarded-For header and countryHeader are honored, e.g. a
+// CDN resolving countries into CloudFront-Viewer-Country. countries, which
+// may be nil, looks up clients without a country header.
+func NewResolver(trustedProxies []string, countryHeader string, countries *Database) (*Resolver, error) {
+	r := &Resolver{countryHeader: countryHeader, countries: countries}
+	for _, proxy := range trustedProxies {
+		prefix, err := parsePrefix(proxy)
+		if err != nil {
+			return nil, err
+		}
+		r.proxies = append(r.proxies, prefix)
+	}
+	return r, nil
+}
+
+// parsePrefix parses a CIDR or a single address
+func parsePrefix(value string) (netip.Prefix, error) {
+	value = strings.TrimSpace(value)
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("%w: trusted proxy %q: %w", ErrInvalid, value, err)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("%w: trusted proxy %q: %w", ErrInvalid, value, err)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// Resolve returns the origin of a request from its peer address and
+// headers. Forwarded addresses are followed from the nearest hop as long as
+// each hop is a trusted proxy, so clients can't spoof them.
+func (r *Resolver) Resolve(remoteAddr string, header http.Header) Origin {
+	peer, ok := parseAddr(remoteAddr)
+	if !ok {
+		return Origin{}
+	}
+
+	client := peer
+	if r.trusted(peer) {
+		hops := strings.Split(strings.Join(header.Values("X-Forwarded-For"), ","), ",")
+		for i := len(hops) - 1; i >= 0 && r.trusted(client); i-- {
+			hop, ok := parseAddr(strings.TrimSpace(hops[i]))
+			if !ok {
+				break
+			}
+			client = hop
+		}
+	}
+
+	o := Origin{IP: client.String()}
+	if r.countryHeader != "" && r.trusted(peer) {
+		if country := strings.ToUpper(strings.TrimSpace(header.Get(r.countryHeader))); countryPattern.MatchString(country) {
+			o.Country = country
+		}
+	}
+	if o.Country == "" && r.countries != nil {
+		o.Country = r.countries.Country(client)
+	}
+	return o
+}
+
+// trusted reports whether an address is a trusted proxy
+func (r *Resolver) trusted(addr netip.Addr) bool {
+	for _, prefix := range r.proxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAddr parses an address with or without a port
+func parseAddr(value string) (netip.Addr, bool) {
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap().WithZone(""), true
+}
+
+// ipRange maps the addresses from start to end to a country
+type ipRange struct {
+	start, end netip.Addr
+	country    string
+}
+
+// Database maps address ranges to countries
+type Database struct {
+	ranges []ipRange
+}
+
+// LoadDatabase reads a CSV database of start address, end address and
+// country code rows, such as DB-IP's free IP to Country Lite database.
+// Further columns are ignored.
+func LoadDatabase(path string) (*Database, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoIP database: %w", err)
+	}
+	defer f.Close()
+	return ReadDatabase(f)
+}
+
+// ReadDatabase reads a CSV database like LoadDatabase
+func ReadDatabase(r io.Reader) (*Database, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	db := &Database{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read GeoIP database: %w", err)
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("%w: line %d has %d columns, expected start, end and country", ErrInvalid, line, len(record))
+		}
+		start, errStart := netip.ParseAddr(record[0])
+		end, errEnd := netip.ParseAddr(record[1])
+		start, end = start.Unmap(), end.Unmap()
+		if errStart != nil || errEnd != nil || start.Is4() != end.Is4() || end.Less(start) {
+			if line == 1 {
+				// A header row
+				continue
+			}
+			return nil, fmt.Errorf("%w: line %d has an invalid range %s-%s", ErrInvalid, line, record[0], record[1])
+		}
+		country := strings.ToUpper(record[2])
+		if !countryPattern.MatchString(country) || country == "ZZ" {
+			// Unallocated and private ranges are marked ZZ or left empty
+			continue
+		}
+		db.ranges = append(db.ranges, ipRange{start: start, end: end, country: country})
+	}
+	sort.Slice(db.ranges, func(i, j int) bool { return db.ranges[i].start.Less(db.ranges[j].start) })
+	return db, nil
+}
+
+// Country returns the country of an address, or an empty string if no
+// range covers it
+func (db *Database) Country(addr netip.Addr) string {
+	addr = addr.Unmap()
+	// Find the last range starting at or before the address
+	i := sort.Search(len(db.ranges), func(i int) bool { return addr.Less(db.ranges[i].start) }) - 1
+	if i < 0 || db.ranges[i].end.Less(addr) {
+		return ""
+	}
+	return db.ranges[i].country
+}
+
+// Len returns the number of ranges in the database
+func (db *Database) Len() int {
+	return len(db.ranges)
+}
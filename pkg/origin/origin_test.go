@@ -0,0 +1,78 @@
+package origin
+
+import (
+	"errors"
+	"net/http"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+const database = `start,end,country
+1.0.0.0,1.0.0.255,AU
+203.0.113.0,203.0.113.255,de
+198.51.100.0,198.51.100.255,ZZ
+2001:db8::,2001:db8::ffff,FR
+`
+
+func TestResolve(t *testing.T) {
+	countries, err := ReadDatabase(strings.NewReader(database))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver, err := NewResolver([]string{"10.0.0.0/8", "192.0.2.1"}, "CloudFront-Viewer-Country", countries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       Origin
+	}{
+		{"direct", "203.0.113.7:5123", nil, Origin{IP: "203.0.113.7", Country: "DE"}},
+		{"spoofed forwarding from a client", "203.0.113.7:5123", map[string]string{"X-Forwarded-For": "1.0.0.1", "CloudFront-Viewer-Country": "US"}, Origin{IP: "203.0.113.7", Country: "DE"}},
+		{"through a trusted proxy", "192.0.2.1:443", map[string]string{"X-Forwarded-For": "1.0.0.1"}, Origin{IP: "1.0.0.1", Country: "AU"}},
+		{"through trusted proxies", "10.0.0.2:443", map[string]string{"X-Forwarded-For": "1.0.0.1, 10.1.2.3"}, Origin{IP: "1.0.0.1", Country: "AU"}},
+		{"client prepends a hop", "10.0.0.2:443", map[string]string{"X-Forwarded-For": "10.9.9.9, 203.0.113.7, 10.1.2.3"}, Origin{IP: "203.0.113.7", Country: "DE"}},
+		{"country header of a trusted proxy", "10.0.0.2:443", map[string]string{"X-Forwarded-For": "1.0.0.1", "CloudFront-Viewer-Country": "nz"}, Origin{IP: "1.0.0.1", Country: "NZ"}},
+		{"IPv6", "[2001:db8::1]:443", nil, Origin{IP: "2001:db8::1", Country: "FR"}},
+		{"IPv4-mapped", "[::ffff:203.0.113.7]:443", nil, Origin{IP: "203.0.113.7", Country: "DE"}},
+		{"unallocated", "198.51.100.1:443", nil, Origin{IP: "198.51.100.1"}},
+		{"no address", "", nil, Origin{}},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		for k, v := range tt.headers {
+			header.Set(k, v)
+		}
+		if got := resolver.Resolve(tt.remoteAddr, header); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDatabase(t *testing.T) {
+	countries, err := ReadDatabase(strings.NewReader(database))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if countries.Len() != 3 {
+		t.Fatalf("expected 3 ranges, got %d", countries.Len())
+	}
+	for addr, want := range map[string]string{"0.255.255.255": "", "1.0.0.0": "AU", "1.0.0.255": "AU", "1.0.1.0": "", "2001:db8::ffff": "FR", "2001:db9::": ""} {
+		if got := countries.Country(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("%s: got %q, want %q", addr, got, want)
+		}
+	}
+
+	for _, invalid := range []string{"1.0.0.0,1.0.0.255,AU\n1.0.1.255,1.0.1.0,AU\n", "1.0.0.0,1.0.0.255,AU\n1.0.1.0,AU\n", "1.0.0.0,1.0.0.255,AU\n1.0.1.0,2001:db8::,AU\n"} {
+		if _, err := ReadDatabase(strings.NewReader(invalid)); !errors.Is(err, ErrInvalid) {
+			t.Errorf("expected ErrInvalid for %q, got %v", invalid, err)
+		}
+	}
+	if _, err := NewResolver([]string{"10.0.0.0/33"}, "", nil); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected ErrInvalid for a malformed proxy, got %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+// Package ratelimit limits how fast and how many requests clients send,
+// and tells throttled clients when to retry
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Headers describing the client's rate limit, as in the IETF RateLimit
+// header fields draft. Reset is in seconds.
+const (
+	LimitHeader     = "RateLimit-Limit"
+	RemainingHeader = "RateLimit-Remaining"
+	ResetHeader     = "RateLimit-Reset"
+)
+
+// idleBuckets is how many buckets are kept before full ones are pruned
+const idleBuckets = 10000
+
+// Decision is the outcome of taking a token from a client's bucket
+type Decision struct {
+	Allowed bool
+
+	// Limit is the bucket size, i.e. the requests a client may burst
+	Limit int
+	// Remaining is the number of whole tokens left in the bucket
+	Remaining int
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is how long until the next token, zero if allowed
+	RetryAfter time.Duration
+}
+
+// bucket holds the tokens of one client at the time they were counted
+type bucket struct {
+	tokens float64
+	at     time.Time
+}
+
+// Limiter is a token bucket per client. Each bucket holds up to burst
+// tokens and refills at rate tokens per second; every request takes one.
+type Limiter struct {
+	rate  float64
+	burst int
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// NewLimiter creates a limiter refilling rate tokens per second into
+// buckets of burst tokens. A burst below 1 is raised to 1.
+func NewLimiter(rate float64, burst int) *Limiter {
+	return &Limiter{
+		rate:    rate,
+		burst:   max(burst, 1),
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from the client's bucket if there is one
+func (l *Limiter) Allow(key string) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= idleBuckets {
+			l.prune(now)
+		}
+		b = &bucket{tokens: float64(l.burst), at: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(l.burst), b.tokens+now.Sub(b.at).Seconds()*l.rate)
+	b.at = now
+
+	d := Decision{Limit: l.burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		d.Allowed = true
+	} else {
+		d.RetryAfter = l.refill(1 - b.tokens)
+	}
+	d.Remaining = int(b.tokens)
+	d.Reset = l.refill(float64(l.burst) - b.tokens)
+	return d
+}
+
+// refill returns how long it takes to refill the given number of tokens
+func (l *Limiter) refill(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+// prune drops the buckets that have refilled completely, as they are no
+// different from new ones
+func (l *Limiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.at).Seconds()*l.rate >= float64(l.burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Concurrency limits how many requests run at the same time
+type Concurrency struct {
+	slots chan struct{}
+}
+
+// NewConcurrency creates a limiter admitting up to limit requests at once
+func NewConcurrency(limit int) *Concurrency {
+	return &Concurrency{slots: make(chan struct{}, max(limit, 1))}
+}
+
+// TryAcquire takes a slot if one is free. The returned function releases it.
+func (c *Concurrency) TryAcquire() (release func(), ok bool) {
+	select {
+	case c.slots <- struct{}{}:
+		return func() { <-c.slots }, true
+	default:
+		return nil, false
+	}
+}
+
+// Limit returns the number of slots
+func (c *Concurrency) Limit() int {
+	return cap(c.slots)
+}
+
+// InUse returns the number of slots taken
+func (c *Concurrency) InUse() int {
+	return len(c.slots)
+}
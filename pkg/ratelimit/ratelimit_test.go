@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(2, 3)
+	now := time.Now()
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if d := l.Allow("a"); !d.Allowed || d.Remaining != 2-i {
+			t.Fatalf("request %d: %+v", i, d)
+		}
+	}
+
+	d := l.Allow("a")
+	if d.Allowed {
+		t.Fatal("expected the empty bucket to refuse the request")
+	}
+	if d.RetryAfter != 500*time.Millisecond || d.Reset != 1500*time.Millisecond {
+		t.Fatalf("retry after %v, reset %v, want 500ms and 1.5s", d.RetryAfter, d.Reset)
+	}
+	if d := l.Allow("b"); !d.Allowed {
+		t.Fatal("expected clients to have buckets of their own")
+	}
+
+	now = now.Add(d.RetryAfter)
+	if d := l.Allow("a"); !d.Allowed {
+		t.Fatalf("expected a token after the retry delay: %+v", d)
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	c := NewConcurrency(1)
+	release, ok := c.TryAcquire()
+	if !ok {
+		t.Fatal("expected a free slot")
+	}
+	if _, ok := c.TryAcquire(); ok {
+		t.Fatal("expected the limit to be enforced")
+	}
+	release()
+	if _, ok := c.TryAcquire(); !ok {
+		t.Fatal("expected the released slot to be free")
+	}
+}
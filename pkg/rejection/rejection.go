@@ -0,0 +1,236 @@
+// Package rejection describes why an upload request was refused in a
+// structured form, so client SDKs can show actionable messages instead of
+// opaque 4xx text
+package rejection
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+)
+
+// Documented rejection codes
+const (
+	// CodeUploadRejected is used for rejections without a more specific code
+	CodeUploadRejected = "ERR_UPLOAD_REJECTED"
+	// CodeUploadTooLarge means the declared upload size exceeds the limit
+	CodeUploadTooLarge = "ERR_UPLOAD_TOO_LARGE"
+	// CodeFileTypeNotAllowed means the upload's file type is not accepted
+	CodeFileTypeNotAllowed = "ERR_FILE_TYPE_NOT_ALLOWED"
+	// CodeInvalidStorageClass means the requested storage class is unsupported
+	CodeInvalidStorageClass = "ERR_INVALID_STORAGE_CLASS"
+	// CodeCallbackNotAllowed means the callback URL is malformed or not allowed
+	CodeCallbackNotAllowed = "ERR_CALLBACK_NOT_ALLOWED"
+	// CodeInvalidMetadata means the metadata does not satisfy the schema
+	CodeInvalidMetadata = "ERR_INVALID_METADATA"
+	// CodeInvalidTenant means the caller's tenant can't be used for storage
+	CodeInvalidTenant = "ERR_INVALID_TENANT"
+	// CodeInvalidIdempotencyKey means the Idempotency-Key header is malformed
+	CodeInvalidIdempotencyKey = "ERR_INVALID_IDEMPOTENCY_KEY"
+	// CodeIdempotencyKeyReused means the key was used for a different request
+	CodeIdempotencyKeyReused = "ERR_IDEMPOTENCY_KEY_REUSED"
+	// CodeRequestInProgress means a request with the same key is still running
+	CodeRequestInProgress = "ERR_REQUEST_IN_PROGRESS"
+	// CodeUnknownIntake means the upload names an intake that doesn't exist
+	CodeUnknownIntake = "ERR_UNKNOWN_INTAKE"
+	// CodeIntakeExpired means the intake no longer accepts uploads
+	CodeIntakeExpired = "ERR_INTAKE_EXPIRED"
+	// CodeInvalidChecksum means the Upload-Checksum header or trailer is
+	// malformed or uses an unsupported algorithm
+	CodeInvalidChecksum = "ERR_INVALID_CHECKSUM"
+	// CodeChecksumMismatch means the chunk doesn't match its checksum
+	CodeChecksumMismatch = "ERR_CHECKSUM_MISMATCH"
+	// CodeStorageThrottled means the storage backend is throttling requests
+	// and the request should be retried after the Retry-After delay
+	CodeStorageThrottled = "ERR_STORAGE_THROTTLED"
+	// CodeStorageQuotaExceeded means the storage backend ran out of space
+	CodeStorageQuotaExceeded = "ERR_STORAGE_QUOTA_EXCEEDED"
+	// CodeRestoreRequired means the upload is in an archive class and must
+	// be restored before it can be read
+	CodeRestoreRequired = "ERR_RESTORE_REQUIRED"
+	// CodeOutsideUploadWindow means uploads are not accepted at this time,
+	// e.g. outside the tenant's upload window or during a blackout
+	CodeOutsideUploadWindow = "ERR_OUTSIDE_UPLOAD_WINDOW"
+	// CodeUploadScheduled means the upload was queued and its data is not
+	// accepted before the scheduled time
+	CodeUploadScheduled = "ERR_UPLOAD_SCHEDULED"
+	// CodeUnknownReservation means the upload names a reservation that
+	// doesn't exist
+	CodeUnknownReservation = "ERR_UNKNOWN_RESERVATION"
+	// CodeReservationEnded means the reservation has ended or was cancelled
+	CodeReservationEnded = "ERR_RESERVATION_ENDED"
+	// CodeReservationExhausted means the upload doesn't fit in what is left
+	// of the reservation
+	CodeReservationExhausted = "ERR_RESERVATION_EXHAUSTED"
+	// CodeInvalidDeltaPlan means the upload names a delta plan that doesn't
+	// exist, is used by another upload or doesn't fit the upload
+	CodeInvalidDeltaPlan = "ERR_INVALID_DELTA_PLAN"
+	// CodeDeltaPlanExpired means the delta plan expired before an upload was
+	// created with it
+	CodeDeltaPlanExpired = "ERR_DELTA_PLAN_EXPIRED"
+	// CodeUnknownBatch means the upload names a batch that doesn't exist
+	CodeUnknownBatch = "ERR_UNKNOWN_BATCH"
+	// CodeBatchClosed means the batch no longer accepts uploads
+	CodeBatchClosed = "ERR_BATCH_CLOSED"
+	// CodeRateLimited means the client sent requests faster than its rate
+	// limit and should retry after the Retry-After delay
+	CodeRateLimited = "ERR_RATE_LIMITED"
+	// CodeTooManyUploads means the server is receiving as many uploads at
+	// once as it accepts and the request should be retried later
+	CodeTooManyUploads = "ERR_TOO_MANY_UPLOADS"
+	// CodeNotStampable means a download that must be stamped can't be,
+	// because the file is too large or its format can't carry a stamp
+	CodeNotStampable = "ERR_NOT_STAMPABLE"
+	// CodeUploadPendingDeletion means the upload was terminated and its data
+	// is deleted once the grace period ends, unless it is restored
+	CodeUploadPendingDeletion = "ERR_UPLOAD_PENDING_DELETION"
+	// CodeUploadInReview means the upload is pending review or was rejected,
+	// so only its owner and approvers can download it
+	CodeUploadInReview = "ERR_UPLOAD_IN_REVIEW"
+	// CodeUploadNotReady means the upload can't be downloaded before it is
+	// ready, e.g. while it is uploading or processing, or because it was
+	// quarantined or failed processing
+	CodeUploadNotReady = "ERR_UPLOAD_NOT_READY"
+	// CodeContentBanned means the content of the upload was banned after it
+	// became ready
+	CodeContentBanned = "ERR_CONTENT_BANNED"
+	// CodeTerminationDisabled means the intake of the upload doesn't allow
+	// terminations
+	CodeTerminationDisabled = "ERR_TERMINATION_DISABLED"
+	// CodeUnknownTenant means the caller's tenant isn't registered and
+	// unregistered tenants are refused
+	CodeUnknownTenant = "ERR_UNKNOWN_TENANT"
+	// CodeTenantDisabled means the caller's tenant was disabled
+	CodeTenantDisabled = "ERR_TENANT_DISABLED"
+	// CodeTenantQuotaExceeded means the upload would exceed a quota of the
+	// caller's tenant
+	CodeTenantQuotaExceeded = "ERR_TENANT_QUOTA_EXCEEDED"
+	// CodeInternalError means the server failed unexpectedly. The requestId
+	// detail identifies the failure in the server logs.
+	CodeInternalError = "ERR_INTERNAL_ERROR"
+)
+
+// Error is a structured rejection of an upload request
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Details map[string]any
+	Headers map[string]string
+}
+
+// New creates a rejection with the given HTTP status, code and message
+func New(status int, code, message string) *Error {
+	return &Error{
+		Status:  status,
+		Code:    code,
+		Message: message,
+	}
+}
+
+// WithDetail attaches a machine-readable detail, e.g. the size limit
+func (e *Error) WithDetail(key string, value any) *Error {
+	if e.Details == nil {
+		e.Details = make(map[string]any)
+	}
+	e.Details[key] = value
+	return e
+}
+
+// WithHeader sets a response header, e.g. Retry-After
+func (e *Error) WithHeader(name, value string) *Error {
+	if e.Headers == nil {
+		e.Headers = make(map[string]string)
+	}
+	e.Headers[name] = value
+	return e
+}
+
+// WithRetryAfter tells the client when to retry, in the Retry-After header
+// and the retryAfter detail. The delay is rounded up to whole seconds and
+// is at least one second, so clients never retry in a tight loop.
+func (e *Error) WithRetryAfter(delay time.Duration) *Error {
+	seconds := max(int(math.Ceil(delay.Seconds())), 1)
+	return e.WithDetail("retryAfter", seconds).
+		WithHeader("Retry-After", strconv.Itoa(seconds))
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// Body is the JSON response body of a rejected request
+type Body struct {
+	Error Reason `json:"error"`
+}
+
+// Reason describes a rejection in the response body
+type Reason struct {
+	Code    string         `json:"code"`
+	Message string         `json:"message"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// Renderer turns rejections into tus error responses with JSON bodies,
+// replacing messages with configured ones where present
+type Renderer struct {
+	messages map[string]string
+}
+
+// NewRenderer creates a renderer with per-code message overrides
+func NewRenderer(messages map[string]string) *Renderer {
+	return &Renderer{messages: messages}
+}
+
+// Render converts err into a tus error. Rejections and tus errors keep their
+// status and code; any other error becomes a 400 ERR_UPLOAD_REJECTED.
+func (r *Renderer) Render(err error) tusd.Error {
+	var rejection *Error
+	var tusErr tusd.Error
+	switch {
+	case errors.As(err, &rejection):
+	case errors.As(err, &tusErr):
+		rejection = New(tusErr.HTTPResponse.StatusCode, tusErr.ErrorCode, tusErr.Message)
+	default:
+		rejection = New(http.StatusBadRequest, CodeUploadRejected, err.Error())
+	}
+
+	reason := Reason{
+		Code:    rejection.Code,
+		Message: rejection.Message,
+		Details: rejection.Details,
+	}
+	if message, ok := r.messages[reason.Code]; ok && message != "" {
+		reason.Message = message
+	}
+
+	body, err := json.Marshal(Body{Error: reason})
+	if err != nil {
+		// Details are caller-provided; fall back to the bare reason
+		reason.Details = nil
+		body, _ = json.Marshal(Body{Error: reason})
+	}
+
+	header := tusd.HTTPHeader{
+		"Content-Type": "application/json",
+	}
+	for name, value := range rejection.Headers {
+		header[name] = value
+	}
+
+	return tusd.Error{
+		ErrorCode: reason.Code,
+		Message:   reason.Message,
+		HTTPResponse: tusd.HTTPResponse{
+			StatusCode: rejection.Status,
+			Body:       string(body) + "\n",
+			Header:     header,
+		},
+	}
+}
@@ -0,0 +1,78 @@
+package rejection
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func decode(t *testing.T, tusErr tusd.Error) Reason {
+	t.Helper()
+
+	var body Body
+	if err := json.Unmarshal([]byte(tusErr.HTTPResponse.Body), &body); err != nil {
+		t.Fatalf("invalid JSON body %q: %v", tusErr.HTTPResponse.Body, err)
+	}
+	return body.Error
+}
+
+func TestRenderRejection(t *testing.T) {
+	renderer := NewRenderer(map[string]string{
+		CodeUploadTooLarge: "Files may be at most 1 KB",
+	})
+
+	err := New(http.StatusRequestEntityTooLarge, CodeUploadTooLarge, "upload exceeds 1024 bytes").
+		WithDetail("maxSize", 1024)
+	tusErr := renderer.Render(err)
+
+	if tusErr.HTTPResponse.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d", tusErr.HTTPResponse.StatusCode)
+	}
+	if ct := tusErr.HTTPResponse.Header["Content-Type"]; ct != "application/json" {
+		t.Fatalf("content type = %q", ct)
+	}
+
+	reason := decode(t, tusErr)
+	if reason.Code != CodeUploadTooLarge || reason.Message != "Files may be at most 1 KB" {
+		t.Fatalf("unexpected reason: %+v", reason)
+	}
+	if reason.Details["maxSize"] != float64(1024) {
+		t.Fatalf("unexpected details: %+v", reason.Details)
+	}
+}
+
+func TestRenderOtherErrors(t *testing.T) {
+	renderer := NewRenderer(nil)
+
+	tusErr := renderer.Render(tusd.NewError("ERR_CUSTOM", "custom", http.StatusForbidden))
+	if tusErr.HTTPResponse.StatusCode != http.StatusForbidden {
+		t.Fatalf("status = %d", tusErr.HTTPResponse.StatusCode)
+	}
+	if reason := decode(t, tusErr); reason.Code != "ERR_CUSTOM" || reason.Message != "custom" {
+		t.Fatalf("unexpected reason: %+v", reason)
+	}
+
+	tusErr = renderer.Render(errors.New("quota exceeded"))
+	if tusErr.HTTPResponse.StatusCode != http.StatusBadRequest {
+		t.Fatalf("status = %d", tusErr.HTTPResponse.StatusCode)
+	}
+	if reason := decode(t, tusErr); reason.Code != CodeUploadRejected || reason.Message != "quota exceeded" {
+		t.Fatalf("unexpected reason: %+v", reason)
+	}
+}
+
+func TestRenderHeaders(t *testing.T) {
+	err := New(http.StatusServiceUnavailable, CodeStorageThrottled, "storage is busy").
+		WithHeader("Retry-After", "5")
+	tusErr := NewRenderer(nil).Render(err)
+
+	if got := tusErr.HTTPResponse.Header["Retry-After"]; got != "5" {
+		t.Fatalf("Retry-After = %q", got)
+	}
+	if ct := tusErr.HTTPResponse.Header["Content-Type"]; ct != "application/json" {
+		t.Fatalf("content type = %q", ct)
+	}
+}
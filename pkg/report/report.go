@@ -0,0 +1,250 @@
+// Package report collects what happened to storage over a period, such as
+// new uploads, failures, reclaimed space and quota breaches, for the
+// scheduled health reports posted to operators
+package report
+
+import (
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of failures counted by a collector
+const (
+	FailureProcessing  = "processing"
+	FailureQuarantined = "quarantined"
+	FailurePanic       = "panic"
+	FailureReplication = "replication"
+	FailureThrottled   = "storage_throttled"
+)
+
+// TenantUsage is what a tenant uploaded during a period
+type TenantUsage struct {
+	Tenant  string
+	Uploads int64
+	Bytes   int64
+}
+
+// Summary is the health of storage over a period
+type Summary struct {
+	// Instance names the server that kept the counts, as each one reports
+	// only what it handled
+	Instance string
+
+	From time.Time
+	To   time.Time
+
+	Created        int64
+	Completed      int64
+	CompletedBytes int64
+
+	// Failures counts failures by kind
+	Failures map[string]int64
+
+	// Reclaimed counts deleted uploads and the bytes they held
+	Reclaimed      int64
+	ReclaimedBytes int64
+
+	// QuotaBreaches counts refused uploads by tenant. Breaches of the
+	// storage backend's own quota are counted under an empty tenant.
+	QuotaBreaches map[string]int64
+
+	// TopTenants lists the tenants that uploaded the most bytes, most first
+	TopTenants []TenantUsage
+}
+
+// Text summarizes the report in a few lines, e.g. for chat webhooks
+func (s Summary) Text() string {
+	var b strings.Builder
+	b.WriteString("Storage health ")
+	if s.Instance != "" {
+		fmt.Fprintf(&b, "of %s ", s.Instance)
+	}
+	fmt.Fprintf(&b, "%s to %s\n", s.From.UTC().Format(time.RFC3339), s.To.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "Uploads: %d created, %d completed (%s)\n", s.Created, s.Completed, formatBytes(s.CompletedBytes))
+	fmt.Fprintf(&b, "Failures: %s\n", formatCounts(s.Failures, ""))
+	fmt.Fprintf(&b, "Reclaimed: %d uploads (%s)\n", s.Reclaimed, formatBytes(s.ReclaimedBytes))
+	fmt.Fprintf(&b, "Quota breaches: %s", formatCounts(s.QuotaBreaches, "storage"))
+	if len(s.TopTenants) > 0 {
+		tenants := make([]string, len(s.TopTenants))
+		for i, usage := range s.TopTenants {
+			tenants[i] = fmt.Sprintf("%s %s", usage.Tenant, formatBytes(usage.Bytes))
+		}
+		fmt.Fprintf(&b, "\nTop tenants: %s", strings.Join(tenants, ", "))
+	}
+	return b.String()
+}
+
+// formatCounts lists counts by key, largest first. Empty keys are shown as
+// the given name.
+func formatCounts(counts map[string]int64, empty string) string {
+	if len(counts) == 0 {
+		return "none"
+	}
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		name := key
+		if name == "" {
+			name = empty
+		}
+		parts[i] = fmt.Sprintf("%s %d", name, counts[key])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatBytes formats a byte count with a binary unit
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// Collector counts what happens to storage until the period is closed
+type Collector struct {
+	top int
+	now func() time.Time
+
+	mu             sync.Mutex
+	from           time.Time
+	created        int64
+	completed      int64
+	completedBytes int64
+	failures       map[string]int64
+	reclaimed      int64
+	reclaimedBytes int64
+	breaches       map[string]int64
+	tenants        map[string]*TenantUsage
+}
+
+// NewCollector starts a period. Summaries list the top tenants.
+func NewCollector(top int) *Collector {
+	c := &Collector{top: top, now: time.Now}
+	c.reset(c.now())
+	return c
+}
+
+// reset starts a new period. The caller must hold mu.
+func (c *Collector) reset(from time.Time) {
+	c.from = from
+	c.created, c.completed, c.completedBytes = 0, 0, 0
+	c.reclaimed, c.reclaimedBytes = 0, 0
+	c.failures = make(map[string]int64)
+	c.breaches = make(map[string]int64)
+	c.tenants = make(map[string]*TenantUsage)
+}
+
+// Created counts a new upload
+func (c *Collector) Created() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.created++
+}
+
+// Completed counts a completed upload of a tenant, empty if it has none
+func (c *Collector) Completed(tenant string, size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.completed++
+	c.completedBytes += size
+	if tenant == "" {
+		return
+	}
+	usage, ok := c.tenants[tenant]
+	if !ok {
+		usage = &TenantUsage{Tenant: tenant}
+		c.tenants[tenant] = usage
+	}
+	usage.Uploads++
+	usage.Bytes += size
+}
+
+// Failed counts a failure of a kind
+func (c *Collector) Failed(kind string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures[kind]++
+}
+
+// Reclaimed counts a deleted upload and the bytes it held
+func (c *Collector) Reclaimed(size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reclaimed++
+	c.reclaimedBytes += size
+}
+
+// QuotaBreached counts an upload refused by a quota of the tenant, or of
+// the storage backend if the tenant is empty
+func (c *Collector) QuotaBreached(tenant string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.breaches[tenant]++
+}
+
+// Summary returns the current period without closing it
+func (c *Collector) Summary() Summary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.summary(c.now())
+}
+
+// Close returns the current period and starts the next one
+func (c *Collector) Close() Summary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	summary := c.summary(now)
+	c.reset(now)
+	return summary
+}
+
+// summary builds the summary of the period up to now. The caller must
+// hold mu.
+func (c *Collector) summary(now time.Time) Summary {
+	tenants := make([]TenantUsage, 0, len(c.tenants))
+	for _, usage := range c.tenants {
+		tenants = append(tenants, *usage)
+	}
+	sort.Slice(tenants, func(i, j int) bool {
+		if tenants[i].Bytes != tenants[j].Bytes {
+			return tenants[i].Bytes > tenants[j].Bytes
+		}
+		return tenants[i].Tenant < tenants[j].Tenant
+	})
+	if len(tenants) > c.top {
+		tenants = tenants[:max(c.top, 0)]
+	}
+
+	return Summary{
+		From:           c.from,
+		To:             now,
+		Created:        c.created,
+		Completed:      c.completed,
+		CompletedBytes: c.completedBytes,
+		Failures:       maps.Clone(c.failures),
+		Reclaimed:      c.reclaimed,
+		ReclaimedBytes: c.reclaimedBytes,
+		QuotaBreaches:  maps.Clone(c.breaches),
+		TopTenants:     tenants,
+	}
+}
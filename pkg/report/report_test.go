@@ -0,0 +1,59 @@
+package report
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollector(t *testing.T) {
+	c := NewCollector(2)
+	start := c.from
+	now := start.Add(time.Hour)
+	c.now = func() time.Time { return now }
+
+	c.Created()
+	c.Created()
+	c.Completed("acme", 3<<20)
+	c.Completed("globex", 1<<20)
+	c.Completed("acme", 1<<20)
+	c.Completed("initech", 512)
+	c.Completed("", 100)
+	c.Failed(FailurePanic)
+	c.Failed(FailureReplication)
+	c.Failed(FailureReplication)
+	c.Reclaimed(2048)
+	c.QuotaBreached("acme")
+	c.QuotaBreached("")
+
+	summary := c.Close()
+	if !summary.From.Equal(start) || !summary.To.Equal(now) {
+		t.Fatalf("expected the period to run from %v to %v, got %v to %v", start, now, summary.From, summary.To)
+	}
+	if summary.Created != 2 || summary.Completed != 5 || summary.CompletedBytes != 5<<20+612 {
+		t.Fatalf("unexpected upload counts: %+v", summary)
+	}
+	if summary.Failures[FailureReplication] != 2 || summary.Reclaimed != 1 || summary.ReclaimedBytes != 2048 {
+		t.Fatalf("unexpected failures or reclaim: %+v", summary)
+	}
+	if len(summary.TopTenants) != 2 || summary.TopTenants[0] != (TenantUsage{"acme", 2, 4 << 20}) || summary.TopTenants[1].Tenant != "globex" {
+		t.Fatalf("expected the two largest tenants, got %+v", summary.TopTenants)
+	}
+
+	summary.Instance = "uploads-1"
+	text := summary.Text()
+	for _, want := range []string{"Storage health of uploads-1 ", "2 created, 5 completed (5.0 MiB)", "replication 2, panic 1", "1 uploads (2.0 KiB)", "storage 1, acme 1", "Top tenants: acme 4.0 MiB, globex 1.0 MiB"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected the text to contain %q:\n%s", want, text)
+		}
+	}
+
+	// Closing starts an empty period
+	next := c.Summary()
+	if !next.From.Equal(now) || next.Created != 0 || len(next.Failures) != 0 || len(next.TopTenants) != 0 {
+		t.Fatalf("expected an empty period, got %+v", next)
+	}
+	if text := next.Text(); !strings.Contains(text, "Failures: none") || strings.Contains(text, "Top tenants") {
+		t.Fatalf("unexpected text of an empty period:\n%s", text)
+	}
+}
@@ -0,0 +1,253 @@
+// Package reservation lets tenants reserve upload capacity ahead of a
+// scheduled bulk ingest, so operators can plan storage and bandwidth, and
+// admits the reserved uploads as they are created
+package reservation
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxNameLen limits reservation names
+const MaxNameLen = 128
+
+// Common errors returned by reservation operations
+var (
+	ErrNotFound  = errors.New("reservation not found")
+	ErrInvalid   = errors.New("invalid reservation")
+	ErrCapacity  = errors.New("not enough capacity left in the reservation window")
+	ErrExhausted = errors.New("reservation exhausted")
+	ErrEnded     = errors.New("reservation has ended")
+	ErrCancelled = errors.New("reservation cancelled")
+)
+
+// Reservation is capacity a tenant reserved for uploads created within a
+// window
+type Reservation struct {
+	ID        string    `json:"id"`
+	Tenant    string    `json:"tenant"`
+	Name      string    `json:"name"`
+	Bytes     int64     `json:"bytes"`   // Total size of the reserved uploads
+	Uploads   int       `json:"uploads"` // Number of reserved uploads
+	StartsAt  time.Time `json:"startsAt"`
+	EndsAt    time.Time `json:"endsAt"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Capacity taken by the uploads admitted so far
+	UsedBytes   int64 `json:"usedBytes"`
+	UsedUploads int   `json:"usedUploads"`
+
+	CancelledAt *time.Time `json:"cancelledAt,omitempty"`
+}
+
+// Active reports whether the reservation still holds capacity at now
+func (r Reservation) Active(now time.Time) bool {
+	return r.CancelledAt == nil && now.Before(r.EndsAt)
+}
+
+// overlaps reports whether the windows of two reservations overlap
+func (r Reservation) overlaps(other Reservation) bool {
+	return r.StartsAt.Before(other.EndsAt) && other.StartsAt.Before(r.EndsAt)
+}
+
+// Store persists reservations
+type Store interface {
+	Put(ctx context.Context, r Reservation) error
+	Get(ctx context.Context, id string) (Reservation, error)
+	List(ctx context.Context) ([]Reservation, error)
+}
+
+// Book takes reservations and admits uploads against them
+type Book struct {
+	store    Store
+	capacity int64
+	now      func() time.Time
+
+	// mu serializes updates, so concurrent admissions can't overdraw a
+	// reservation and concurrent reservations can't exceed the capacity
+	mu sync.Mutex
+}
+
+// NewBook creates a book backed by the store. Capacity limits the bytes
+// reserved by overlapping reservations, 0 for no limit.
+func NewBook(store Store, capacity int64) *Book {
+	return &Book{store: store, capacity: capacity, now: time.Now}
+}
+
+// Create takes a reservation for the tenant
+func (b *Book) Create(ctx context.Context, r Reservation) (Reservation, error) {
+	r.Name = strings.TrimSpace(r.Name)
+	if len(r.Name) > MaxNameLen {
+		return Reservation{}, fmt.Errorf("%w: name must be at most %d characters", ErrInvalid, MaxNameLen)
+	}
+	if r.Tenant == "" {
+		return Reservation{}, fmt.Errorf("%w: tenant is required", ErrInvalid)
+	}
+	if r.Bytes <= 0 || r.Uploads <= 0 {
+		return Reservation{}, fmt.Errorf("%w: bytes and uploads must be positive", ErrInvalid)
+	}
+
+	now := b.now()
+	if r.StartsAt.IsZero() {
+		r.StartsAt = now
+	}
+	if !r.EndsAt.After(r.StartsAt) || !r.EndsAt.After(now) {
+		return Reservation{}, fmt.Errorf("%w: endsAt must be in the future and after startsAt", ErrInvalid)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.capacity > 0 {
+		reserved, err := b.reserved(ctx, r, now)
+		if err != nil {
+			return Reservation{}, err
+		}
+		if reserved+r.Bytes > b.capacity {
+			return Reservation{}, fmt.Errorf("%w: %d of %d bytes are reserved already", ErrCapacity, reserved, b.capacity)
+		}
+	}
+
+	r.ID = newID()
+	r.CreatedAt = now
+	r.UsedBytes, r.UsedUploads, r.CancelledAt = 0, 0, nil
+	if err := b.store.Put(ctx, r); err != nil {
+		return Reservation{}, fmt.Errorf("failed to store reservation: %w", err)
+	}
+	return r, nil
+}
+
+// reserved returns the bytes reserved by active reservations overlapping r
+func (b *Book) reserved(ctx context.Context, r Reservation, now time.Time) (int64, error) {
+	all, err := b.store.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var reserved int64
+	for _, other := range all {
+		if other.Active(now) && other.overlaps(r) {
+			reserved += other.Bytes
+		}
+	}
+	return reserved, nil
+}
+
+// Get returns a reservation of the tenant
+func (b *Book) Get(ctx context.Context, tenant, id string) (Reservation, error) {
+	r, err := b.store.Get(ctx, id)
+	if err != nil {
+		return Reservation{}, err
+	}
+	if r.Tenant != tenant {
+		return Reservation{}, ErrNotFound
+	}
+	return r, nil
+}
+
+// List returns the reservations of the tenant, or of all tenants if tenant
+// is empty, in the order of their windows
+func (b *Book) List(ctx context.Context, tenant string) ([]Reservation, error) {
+	all, err := b.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reservations := make([]Reservation, 0, len(all))
+	for _, r := range all {
+		if tenant == "" || r.Tenant == tenant {
+			reservations = append(reservations, r)
+		}
+	}
+	sort.Slice(reservations, func(i, j int) bool {
+		if !reservations[i].StartsAt.Equal(reservations[j].StartsAt) {
+			return reservations[i].StartsAt.Before(reservations[j].StartsAt)
+		}
+		return reservations[i].ID < reservations[j].ID
+	})
+	return reservations, nil
+}
+
+// Cancel releases the capacity of a reservation. Cancelled reservations are
+// kept so they remain listed, but admit no more uploads.
+func (b *Book) Cancel(ctx context.Context, tenant, id string) (Reservation, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	r, err := b.Get(ctx, tenant, id)
+	if err != nil {
+		return Reservation{}, err
+	}
+	if r.CancelledAt != nil {
+		return r, nil
+	}
+	now := b.now()
+	r.CancelledAt = &now
+	if err := b.store.Put(ctx, r); err != nil {
+		return Reservation{}, fmt.Errorf("failed to store reservation: %w", err)
+	}
+	return r, nil
+}
+
+// Admit takes an upload of the given size out of a reservation of the
+// tenant. Uploads can be admitted before the window starts; the caller
+// queues them until then.
+func (b *Book) Admit(ctx context.Context, tenant, id string, size int64) (Reservation, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	r, err := b.Get(ctx, tenant, id)
+	if err != nil {
+		return Reservation{}, err
+	}
+	if r.CancelledAt != nil {
+		return r, ErrCancelled
+	}
+	if !b.now().Before(r.EndsAt) {
+		return r, ErrEnded
+	}
+	if r.UsedUploads+1 > r.Uploads || r.UsedBytes+size > r.Bytes {
+		return r, ErrExhausted
+	}
+
+	r.UsedUploads++
+	r.UsedBytes += size
+	if err := b.store.Put(ctx, r); err != nil {
+		return Reservation{}, fmt.Errorf("failed to store reservation: %w", err)
+	}
+	return r, nil
+}
+
+// Release returns the capacity of an admitted upload that was rejected or
+// terminated to its reservation
+func (b *Book) Release(ctx context.Context, id string, size int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	r, err := b.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !r.Active(b.now()) {
+		return nil
+	}
+	r.UsedUploads = max(r.UsedUploads-1, 0)
+	r.UsedBytes = max(r.UsedBytes-size, 0)
+	if err := b.store.Put(ctx, r); err != nil {
+		return fmt.Errorf("failed to store reservation: %w", err)
+	}
+	return nil
+}
+
+// newID generates a random reservation ID
+func newID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,71 @@
+package reservation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCapacity(t *testing.T) {
+	ctx := context.Background()
+	b := NewBook(NewMemoryStore(), 100)
+	now := time.Now()
+	b.now = func() time.Time { return now }
+
+	night := Reservation{Tenant: "acme", Bytes: 60, Uploads: 10, StartsAt: now.Add(time.Hour), EndsAt: now.Add(3 * time.Hour)}
+	if _, err := b.Create(ctx, night); err != nil {
+		t.Fatal(err)
+	}
+
+	overlapping := Reservation{Tenant: "globex", Bytes: 50, Uploads: 1, StartsAt: now.Add(2 * time.Hour), EndsAt: now.Add(4 * time.Hour)}
+	if _, err := b.Create(ctx, overlapping); !errors.Is(err, ErrCapacity) {
+		t.Fatalf("expected overlapping reservations to be limited by the capacity, got %v", err)
+	}
+
+	later := Reservation{Tenant: "globex", Bytes: 50, Uploads: 1, StartsAt: now.Add(3 * time.Hour), EndsAt: now.Add(4 * time.Hour)}
+	if _, err := b.Create(ctx, later); err != nil {
+		t.Fatalf("expected a reservation after the window to fit, got %v", err)
+	}
+}
+
+func TestAdmit(t *testing.T) {
+	ctx := context.Background()
+	b := NewBook(NewMemoryStore(), 0)
+	now := time.Now()
+	b.now = func() time.Time { return now }
+
+	r, err := b.Create(ctx, Reservation{Tenant: "acme", Bytes: 100, Uploads: 2, EndsAt: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.Admit(ctx, "globex", r.ID, 10); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected reservations of other tenants to be hidden, got %v", err)
+	}
+	if _, err := b.Admit(ctx, "acme", r.ID, 101); !errors.Is(err, ErrExhausted) {
+		t.Fatalf("expected uploads larger than the reservation to be refused, got %v", err)
+	}
+	if _, err := b.Admit(ctx, "acme", r.ID, 60); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Admit(ctx, "acme", r.ID, 60); !errors.Is(err, ErrExhausted) {
+		t.Fatalf("expected the remaining bytes to be enforced, got %v", err)
+	}
+
+	if err := b.Release(ctx, r.ID, 60); err != nil {
+		t.Fatal(err)
+	}
+	got, err := b.Admit(ctx, "acme", r.ID, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.UsedBytes != 100 || got.UsedUploads != 1 {
+		t.Fatalf("usage = %d bytes in %d uploads, want 100 in 1", got.UsedBytes, got.UsedUploads)
+	}
+
+	now = now.Add(time.Hour)
+	if _, err := b.Admit(ctx, "acme", r.ID, 0); !errors.Is(err, ErrEnded) {
+		t.Fatalf("expected ended reservations to be refused, got %v", err)
+	}
+}
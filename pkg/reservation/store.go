@@ -0,0 +1,62 @@
+package reservation
+
+import (
+	"context"
+
+	"github.com/devsnb/large-file-uploads/pkg/internal/jsonstore"
+)
+
+// MemoryStore keeps reservations in memory. They are lost on restart.
+type MemoryStore struct {
+	reservations *jsonstore.Memory[Reservation]
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{reservations: jsonstore.NewMemory[Reservation](ErrNotFound)}
+}
+
+// Put inserts or replaces a reservation
+func (s *MemoryStore) Put(ctx context.Context, r Reservation) error {
+	s.reservations.Put(r.ID, r)
+	return nil
+}
+
+// Get returns a reservation by ID
+func (s *MemoryStore) Get(ctx context.Context, id string) (Reservation, error) {
+	return s.reservations.Get(id)
+}
+
+// List returns all reservations
+func (s *MemoryStore) List(ctx context.Context) ([]Reservation, error) {
+	return s.reservations.List(), nil
+}
+
+// FileStore persists each reservation as a JSON file in a directory
+type FileStore struct {
+	reservations *jsonstore.Dir[Reservation]
+}
+
+// NewFileStore creates a file store, creating the directory if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	reservations, err := jsonstore.NewDir[Reservation](dir, "reservation", ErrNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{reservations: reservations}, nil
+}
+
+// Put inserts or replaces a reservation
+func (s *FileStore) Put(ctx context.Context, r Reservation) error {
+	return s.reservations.Put(r.ID, r)
+}
+
+// Get returns a reservation by ID
+func (s *FileStore) Get(ctx context.Context, id string) (Reservation, error) {
+	return s.reservations.Get(id)
+}
+
+// List returns all reservations
+func (s *FileStore) List(ctx context.Context) ([]Reservation, error) {
+	return s.reservations.List()
+}
@@ -0,0 +1,298 @@
+// Package schedule restricts when uploads may be created, e.g. to keep bulk
+// uploads of a tenant on a constrained link to the night or to pause
+// uploads during a maintenance blackout
+package schedule
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Action is what happens to uploads created while a rule is closed
+type Action string
+
+// Actions of a rule
+const (
+	// Reject refuses the creation, telling the client when to try again
+	Reject Action = "reject"
+
+	// Queue creates the upload but refuses its data until the rule opens
+	Queue Action = "queue"
+)
+
+// Reasons a rule is closed
+const (
+	ReasonOutsideWindow = "outside_window"
+	ReasonBlackout      = "blackout"
+)
+
+// weekdays maps day names to weekdays
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Clock is a time of day in minutes after midnight
+type Clock int
+
+// ParseClock parses a time of day such as "20:00"
+func ParseClock(value string) (Clock, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", value)
+	}
+	return Clock(t.Hour()*60 + t.Minute()), nil
+}
+
+// ParseDays parses day names such as "mon" or "Monday"
+func ParseDays(names []string) ([]time.Weekday, error) {
+	days := make([]time.Weekday, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		day, ok := weekdays[name]
+		if !ok && len(name) > 3 {
+			day, ok = weekdays[name[:3]]
+		}
+		if !ok {
+			return nil, fmt.Errorf("invalid day %q", name)
+		}
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+// Window is a recurring period in which uploads are accepted. A window
+// whose end is not after its start spans midnight, so 20:00 to 06:00 ends
+// the next morning and 00:00 to 00:00 covers the whole day.
+type Window struct {
+	// Days the window starts on, empty for every day
+	Days  []time.Weekday
+	Start Clock
+	End   Clock
+}
+
+// occurrence returns the period of the window starting on the given day,
+// and false if the window doesn't start on that day
+func (w Window) occurrence(day time.Time) (start, end time.Time, ok bool) {
+	if len(w.Days) > 0 && !slices.Contains(w.Days, day.Weekday()) {
+		return time.Time{}, time.Time{}, false
+	}
+	start = atClock(day, w.Start)
+	end = atClock(day, w.End)
+	if w.End <= w.Start {
+		end = atClock(day.AddDate(0, 0, 1), w.End)
+	}
+	return start, end, true
+}
+
+// Blackout is a one-off period in which uploads are not accepted
+type Blackout struct {
+	From   time.Time
+	To     time.Time
+	Reason string
+}
+
+// Rule restricts when uploads of some tenants and sizes may be created
+type Rule struct {
+	// Tenants the rule applies to, empty for all
+	Tenants []string
+
+	// MinSize is the size from which the rule applies, 0 for all uploads.
+	// Uploads with a deferred length always match.
+	MinSize int64
+
+	// Location the windows are given in, UTC when nil
+	Location *time.Location
+
+	// Windows uploads are accepted in, empty for any time outside blackouts
+	Windows   []Window
+	Blackouts []Blackout
+	Action    Action
+}
+
+// Validate checks that the rule is complete
+func (r Rule) Validate() error {
+	if r.Action != Reject && r.Action != Queue {
+		return fmt.Errorf("invalid schedule action %q, expected %q or %q", r.Action, Reject, Queue)
+	}
+	for _, blackout := range r.Blackouts {
+		if !blackout.To.After(blackout.From) {
+			return fmt.Errorf("blackout from %s must end after it starts", blackout.From.Format(time.RFC3339))
+		}
+	}
+	if len(r.Windows) == 0 && len(r.Blackouts) == 0 {
+		return fmt.Errorf("schedule rule needs windows or blackouts")
+	}
+	return nil
+}
+
+// matches reports whether the rule applies to an upload
+func (r Rule) matches(tenant string, size int64, sizeIsDeferred bool) bool {
+	if len(r.Tenants) > 0 && !slices.Contains(r.Tenants, tenant) {
+		return false
+	}
+	return sizeIsDeferred || size >= r.MinSize
+}
+
+// location returns the time zone of the windows
+func (r Rule) location() *time.Location {
+	if r.Location == nil {
+		return time.UTC
+	}
+	return r.Location
+}
+
+// inWindow reports whether t is within one of the windows
+func (r Rule) inWindow(t time.Time) bool {
+	if len(r.Windows) == 0 {
+		return true
+	}
+	t = t.In(r.location())
+	// A window spanning midnight may have started the day before
+	for _, day := range []time.Time{midnight(t).AddDate(0, 0, -1), midnight(t)} {
+		for _, window := range r.Windows {
+			if start, end, ok := window.occurrence(day); ok && !t.Before(start) && t.Before(end) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// blackout returns the blackout t falls into, if any
+func (r Rule) blackout(t time.Time) (Blackout, bool) {
+	for _, blackout := range r.Blackouts {
+		if !t.Before(blackout.From) && t.Before(blackout.To) {
+			return blackout, true
+		}
+	}
+	return Blackout{}, false
+}
+
+// open reports whether the rule accepts uploads at t
+func (r Rule) open(t time.Time) bool {
+	_, blackedOut := r.blackout(t)
+	return !blackedOut && r.inWindow(t)
+}
+
+// nextOpen returns the first time after now the rule accepts uploads, or
+// the zero time if it never does. Rules open either when a window starts or
+// when a blackout ends, so only those times are considered.
+func (r Rule) nextOpen(now time.Time) time.Time {
+	var candidates []time.Time
+	last := now
+	for _, blackout := range r.Blackouts {
+		if blackout.To.After(now) {
+			candidates = append(candidates, blackout.To)
+			last = later(last, blackout.To)
+		}
+	}
+	if len(r.Windows) > 0 {
+		// Windows repeat weekly, so a week past the last blackout suffices
+		loc := r.location()
+		end := midnight(last.In(loc)).AddDate(0, 0, 8)
+		for day := midnight(now.In(loc)); day.Before(end); day = day.AddDate(0, 0, 1) {
+			for _, window := range r.Windows {
+				if start, _, ok := window.occurrence(day); ok && start.After(now) {
+					candidates = append(candidates, start)
+				}
+			}
+		}
+	}
+
+	slices.SortFunc(candidates, func(a, b time.Time) int { return a.Compare(b) })
+	for _, candidate := range candidates {
+		if r.open(candidate) {
+			return candidate
+		}
+	}
+	return time.Time{}
+}
+
+// Closure describes why an upload can't be created right now
+type Closure struct {
+	Action Action
+	Reason string
+
+	// Message describes the blackout, if the rule is closed by one
+	Message string
+
+	// Opens is when uploads are accepted again, zero if never
+	Opens time.Time
+}
+
+// Schedule decides whether uploads may be created at a given time
+type Schedule struct {
+	rules []Rule
+}
+
+// New creates a schedule from rules, which are evaluated in order; the
+// first rule matching an upload decides
+func New(rules []Rule) (*Schedule, error) {
+	for i, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return nil, fmt.Errorf("schedule rule %d: %w", i+1, err)
+		}
+	}
+	return &Schedule{rules: rules}, nil
+}
+
+// Queues reports whether any rule queues uploads instead of rejecting them
+func (s *Schedule) Queues() bool {
+	for _, rule := range s.rules {
+		if rule.Action == Queue {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns why an upload of the tenant with the given size can't be
+// created at now, or nil if it can
+func (s *Schedule) Check(tenant string, size int64, sizeIsDeferred bool, now time.Time) *Closure {
+	for _, rule := range s.rules {
+		if !rule.matches(tenant, size, sizeIsDeferred) {
+			continue
+		}
+		if rule.open(now) {
+			return nil
+		}
+
+		closure := &Closure{
+			Action: rule.Action,
+			Reason: ReasonOutsideWindow,
+			Opens:  rule.nextOpen(now),
+		}
+		if blackout, ok := rule.blackout(now); ok {
+			closure.Reason = ReasonBlackout
+			closure.Message = blackout.Reason
+		}
+		return closure
+	}
+	return nil
+}
+
+// atClock returns the given time of day on the day starting at midnight
+func atClock(day time.Time, clock Clock) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), int(clock)/60, int(clock)%60, 0, 0, day.Location())
+}
+
+// midnight returns the start of the day t falls on in its location
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// later returns the later of two times
+func later(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
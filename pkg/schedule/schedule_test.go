@@ -0,0 +1,117 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func mustClock(t *testing.T, value string) Clock {
+	t.Helper()
+	clock, err := ParseClock(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clock
+}
+
+func TestCheckWindowSpanningMidnight(t *testing.T) {
+	nightly := Window{Start: mustClock(t, "20:00"), End: mustClock(t, "06:00")}
+	s, err := New([]Rule{{
+		Tenants: []string{"acme"},
+		MinSize: 1 << 30,
+		Windows: []Window{nightly},
+		Action:  Reject,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	noon := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	closure := s.Check("acme", 2<<30, false, noon)
+	if closure == nil {
+		t.Fatal("expected bulk upload at noon to be refused")
+	}
+	if want := time.Date(2024, 5, 1, 20, 0, 0, 0, time.UTC); !closure.Opens.Equal(want) || closure.Reason != ReasonOutsideWindow {
+		t.Fatalf("closure = %+v, want opening at %s", closure, want)
+	}
+
+	for _, allowed := range []struct {
+		tenant   string
+		size     int64
+		deferred bool
+		at       time.Time
+	}{
+		{"acme", 2 << 30, false, time.Date(2024, 5, 1, 23, 0, 0, 0, time.UTC)},
+		{"acme", 2 << 30, false, time.Date(2024, 5, 2, 5, 59, 0, 0, time.UTC)},
+		{"acme", 1 << 20, false, noon},
+		{"other", 2 << 30, false, noon},
+	} {
+		if closure := s.Check(allowed.tenant, allowed.size, allowed.deferred, allowed.at); closure != nil {
+			t.Errorf("Check(%s, %d, %s) = %+v, want nil", allowed.tenant, allowed.size, allowed.at, closure)
+		}
+	}
+
+	if s.Check("acme", 0, true, noon) == nil {
+		t.Error("expected uploads with a deferred length to match")
+	}
+}
+
+func TestCheckDays(t *testing.T) {
+	days, err := ParseDays([]string{"sat", "Sunday"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	weekend := Window{Days: days, Start: 0, End: 0}
+	s, _ := New([]Rule{{Windows: []Window{weekend}, Action: Queue}})
+
+	// Wednesday 1 May 2024
+	closure := s.Check("", 0, false, time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC))
+	if closure == nil || closure.Action != Queue {
+		t.Fatalf("closure = %+v, want queued", closure)
+	}
+	if want := time.Date(2024, 5, 4, 0, 0, 0, 0, time.UTC); !closure.Opens.Equal(want) {
+		t.Fatalf("opens at %s, want %s", closure.Opens, want)
+	}
+	if s.Check("", 0, false, time.Date(2024, 5, 5, 23, 0, 0, 0, time.UTC)) != nil {
+		t.Fatal("expected uploads on Sunday to be accepted")
+	}
+
+	if _, err := ParseDays([]string{"someday"}); err == nil {
+		t.Fatal("expected an invalid day to fail")
+	}
+}
+
+func TestCheckBlackout(t *testing.T) {
+	from := time.Date(2024, 12, 24, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 12, 27, 0, 0, 0, 0, time.UTC)
+	s, err := New([]Rule{{
+		Windows:   []Window{{Start: mustClock(t, "08:00"), End: mustClock(t, "18:00")}},
+		Blackouts: []Blackout{{From: from, To: to, Reason: "holiday freeze"}},
+		Action:    Reject,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closure := s.Check("", 0, false, from.Add(10*time.Hour))
+	if closure == nil || closure.Reason != ReasonBlackout || closure.Message != "holiday freeze" {
+		t.Fatalf("closure = %+v, want blackout", closure)
+	}
+	// The blackout ends at midnight, outside the window
+	if want := to.Add(8 * time.Hour); !closure.Opens.Equal(want) {
+		t.Fatalf("opens at %s, want %s", closure.Opens, want)
+	}
+}
+
+func TestNewValidatesRules(t *testing.T) {
+	now := time.Now()
+	for _, rule := range []Rule{
+		{Windows: []Window{{}}, Action: "later"},
+		{Action: Reject},
+		{Blackouts: []Blackout{{From: now, To: now}}, Action: Reject},
+	} {
+		if _, err := New([]Rule{rule}); err == nil {
+			t.Errorf("New(%+v) should fail", rule)
+		}
+	}
+}
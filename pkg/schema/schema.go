@@ -0,0 +1,267 @@
+// Package schema validates upload metadata against operator-provided JSON
+// Schemas. Metadata values are always strings, so only the subset of JSON
+// Schema that is meaningful for flat string maps is supported; schemas using
+// other keywords are rejected when loaded rather than silently ignored.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// uuidPattern matches RFC 4122 UUIDs in their canonical form
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Schema describes the metadata object of an upload
+type Schema struct {
+	SchemaURI            string               `json:"$schema"`
+	ID                   string               `json:"$id"`
+	Title                string               `json:"title"`
+	Description          string               `json:"description"`
+	Type                 string               `json:"type"`
+	Properties           map[string]*Property `json:"properties"`
+	Required             []string             `json:"required"`
+	AdditionalProperties *bool                `json:"additionalProperties"`
+}
+
+// Property describes a single metadata field
+type Property struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Type        string   `json:"type"`
+	Enum        []any    `json:"enum"`
+	Pattern     string   `json:"pattern"`
+	Format      string   `json:"format"`
+	MinLength   *int     `json:"minLength"`
+	MaxLength   *int     `json:"maxLength"`
+	Minimum     *float64 `json:"minimum"`
+	Maximum     *float64 `json:"maximum"`
+
+	pattern *regexp.Regexp
+}
+
+// Violation describes why a metadata field does not satisfy the schema
+type Violation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Parse decodes and checks a schema
+func Parse(data []byte) (*Schema, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var s Schema
+	if err := decoder.Decode(&s); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	if s.Type != "" && s.Type != "object" {
+		return nil, fmt.Errorf("invalid schema: metadata schemas must be of type object, got %q", s.Type)
+	}
+
+	for name, property := range s.Properties {
+		if property == nil {
+			return nil, fmt.Errorf("invalid schema: property %q is empty", name)
+		}
+		switch property.Type {
+		case "", "string", "integer", "number", "boolean":
+		default:
+			return nil, fmt.Errorf("invalid schema: property %q has unsupported type %q", name, property.Type)
+		}
+		switch property.Format {
+		case "", "email", "uri", "uuid", "date", "date-time":
+		default:
+			return nil, fmt.Errorf("invalid schema: property %q has unsupported format %q", name, property.Format)
+		}
+		if property.Pattern != "" {
+			pattern, err := regexp.Compile(property.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid schema: property %q has invalid pattern: %w", name, err)
+			}
+			property.pattern = pattern
+		}
+	}
+
+	return &s, nil
+}
+
+// Load reads and parses a schema file
+func Load(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema %s: %w", path, err)
+	}
+
+	s, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Validate returns all violations of the metadata, sorted by field
+func (s *Schema) Validate(metadata map[string]string) []Violation {
+	var violations []Violation
+
+	for _, field := range s.Required {
+		if _, ok := metadata[field]; !ok {
+			violations = append(violations, Violation{Field: field, Message: "is required"})
+		}
+	}
+
+	for field, value := range metadata {
+		property, ok := s.Properties[field]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				violations = append(violations, Violation{Field: field, Message: "is not allowed"})
+			}
+			continue
+		}
+		if message := property.check(value); message != "" {
+			violations = append(violations, Violation{Field: field, Message: message})
+		}
+	}
+
+	sort.Slice(violations, func(i, j int) bool {
+		return violations[i].Field < violations[j].Field
+	})
+	return violations
+}
+
+// check returns a description of the first constraint the value violates
+func (p *Property) check(value string) string {
+	var number float64
+	switch p.Type {
+	case "integer":
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return "must be an integer"
+		}
+		number = float64(i)
+	case "number":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return "must be a number"
+		}
+		number = f
+	case "boolean":
+		if value != "true" && value != "false" {
+			return "must be true or false"
+		}
+	}
+
+	if p.Type == "integer" || p.Type == "number" {
+		if p.Minimum != nil && number < *p.Minimum {
+			return fmt.Sprintf("must be at least %v", *p.Minimum)
+		}
+		if p.Maximum != nil && number > *p.Maximum {
+			return fmt.Sprintf("must be at most %v", *p.Maximum)
+		}
+	}
+
+	length := utf8.RuneCountInString(value)
+	if p.MinLength != nil && length < *p.MinLength {
+		return fmt.Sprintf("must be at least %d characters long", *p.MinLength)
+	}
+	if p.MaxLength != nil && length > *p.MaxLength {
+		return fmt.Sprintf("must be at most %d characters long", *p.MaxLength)
+	}
+
+	if p.pattern != nil && !p.pattern.MatchString(value) {
+		return fmt.Sprintf("must match pattern %s", p.Pattern)
+	}
+
+	if message := checkFormat(p.Format, value); message != "" {
+		return message
+	}
+
+	if len(p.Enum) > 0 {
+		for _, allowed := range p.Enum {
+			if fmt.Sprint(allowed) == value {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of %v", p.Enum)
+	}
+
+	return ""
+}
+
+// checkFormat validates the value against a format keyword
+func checkFormat(format, value string) string {
+	switch format {
+	case "email":
+		if address, err := mail.ParseAddress(value); err != nil || address.Address != value {
+			return "must be an email address"
+		}
+	case "uri":
+		if u, err := url.Parse(value); err != nil || u.Scheme == "" {
+			return "must be an absolute URI"
+		}
+	case "uuid":
+		if !uuidPattern.MatchString(value) {
+			return "must be a UUID"
+		}
+	case "date":
+		if _, err := time.Parse(time.DateOnly, value); err != nil {
+			return "must be a date (YYYY-MM-DD)"
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			return "must be an RFC 3339 date-time"
+		}
+	}
+	return ""
+}
+
+// Registry holds the schemas metadata is validated against per tenant
+type Registry struct {
+	defaultSchema *Schema
+	tenants       map[string]*Schema
+}
+
+// NewRegistry loads the default schema and per-tenant schemas from files.
+// Empty paths are skipped.
+func NewRegistry(defaultPath string, tenantPaths map[string]string) (*Registry, error) {
+	r := &Registry{tenants: make(map[string]*Schema, len(tenantPaths))}
+
+	if defaultPath != "" {
+		s, err := Load(defaultPath)
+		if err != nil {
+			return nil, err
+		}
+		r.defaultSchema = s
+	}
+
+	for tenant, path := range tenantPaths {
+		if path == "" {
+			continue
+		}
+		s, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		r.tenants[tenant] = s
+	}
+
+	return r, nil
+}
+
+// For returns the schema for the tenant, falling back to the default schema.
+// It returns nil if no schema applies.
+func (r *Registry) For(tenant string) *Schema {
+	if s, ok := r.tenants[tenant]; ok {
+		return s
+	}
+	return r.defaultSchema
+}
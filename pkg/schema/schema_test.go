@@ -0,0 +1,110 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"required": ["filename", "project"],
+	"additionalProperties": false,
+	"properties": {
+		"filename": {"type": "string", "minLength": 1, "maxLength": 20},
+		"filetype": {"type": "string", "pattern": "^[a-z]+/[a-z0-9.+-]+$"},
+		"project": {"type": "string", "enum": ["alpha", "beta"]},
+		"contact": {"type": "string", "format": "email"},
+		"priority": {"type": "integer", "minimum": 1, "maximum": 5}
+	}
+}`
+
+func TestValidate(t *testing.T) {
+	s, err := Parse([]byte(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := map[string]string{
+		"filename": "report.pdf",
+		"filetype": "application/pdf",
+		"project":  "alpha",
+		"contact":  "ops@example.com",
+		"priority": "3",
+	}
+	if violations := s.Validate(valid); len(violations) != 0 {
+		t.Fatalf("expected no violations, got %+v", violations)
+	}
+
+	invalid := map[string]string{
+		"filetype": "PDF",
+		"project":  "gamma",
+		"contact":  "not-an-email",
+		"priority": "9",
+		"extra":    "x",
+	}
+	want := []Violation{
+		{Field: "contact", Message: "must be an email address"},
+		{Field: "extra", Message: "is not allowed"},
+		{Field: "filename", Message: "is required"},
+		{Field: "filetype", Message: "must match pattern ^[a-z]+/[a-z0-9.+-]+$"},
+		{Field: "priority", Message: "must be at most 5"},
+		{Field: "project", Message: "must be one of [alpha beta]"},
+	}
+
+	violations := s.Validate(invalid)
+	if len(violations) != len(want) {
+		t.Fatalf("expected %d violations, got %+v", len(want), violations)
+	}
+	for i := range want {
+		if violations[i] != want[i] {
+			t.Errorf("violation %d = %+v, want %+v", i, violations[i], want[i])
+		}
+	}
+}
+
+func TestParseRejectsUnsupportedKeywords(t *testing.T) {
+	for name, doc := range map[string]string{
+		"unknown keyword": `{"properties": {"a": {"type": "string", "const": "x"}}}`,
+		"array type":      `{"properties": {"a": {"type": "array"}}}`,
+		"bad pattern":     `{"properties": {"a": {"pattern": "("}}}`,
+		"non-object":      `{"type": "string"}`,
+	} {
+		if _, err := Parse([]byte(doc)); err == nil {
+			t.Errorf("%s: expected parse error", name)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	dir := t.TempDir()
+	defaultPath := filepath.Join(dir, "default.json")
+	tenantPath := filepath.Join(dir, "acme.json")
+	if err := os.WriteFile(defaultPath, []byte(`{"required": ["filename"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(tenantPath, []byte(testSchema), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRegistry(defaultPath, map[string]string{"acme": tenantPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.For("acme").Required) != 2 {
+		t.Error("expected tenant schema for acme")
+	}
+	if len(r.For("globex").Required) != 1 {
+		t.Error("expected default schema for other tenants")
+	}
+
+	empty, err := NewRegistry("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty.For("acme") != nil {
+		t.Error("expected no schema without configuration")
+	}
+}
@@ -0,0 +1,82 @@
+package selftest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// ErrUnsupported is returned when a storage backend can't check its
+// permissions
+var ErrUnsupported = errors.New("storage backend does not support permission checks")
+
+// PermissionReport summarizes a permission check
+type PermissionReport struct {
+	Provider storage.Provider
+	Checks   []storage.PermissionCheck
+}
+
+// Passed reports whether every operation succeeded
+func (r PermissionReport) Passed() bool {
+	for _, check := range r.Checks {
+		if check.Err != nil {
+			return false
+		}
+	}
+	return len(r.Checks) > 0
+}
+
+// Missing returns the permissions the backend denied, each once
+func (r PermissionReport) Missing() []string {
+	var missing []string
+	seen := make(map[string]bool)
+	for _, check := range r.Checks {
+		if check.Denied && !seen[check.Permission] {
+			seen[check.Permission] = true
+			missing = append(missing, check.Permission)
+		}
+	}
+	return missing
+}
+
+// String formats the report for the terminal
+func (r PermissionReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Permission check against %s storage\n", r.Provider)
+	for _, check := range r.Checks {
+		status := "ok"
+		switch {
+		case check.Skipped:
+			status = "skipped"
+		case check.Unsupported:
+			status = "unsupported"
+		case check.Denied:
+			status = "DENIED"
+		case check.Err != nil:
+			status = "FAILED: " + check.Err.Error()
+		}
+		fmt.Fprintf(&b, "  %-23s %-28s %s\n", check.Operation, check.Permission, status)
+	}
+	if missing := r.Missing(); len(missing) > 0 {
+		fmt.Fprintf(&b, "Missing permissions: %s\n", strings.Join(missing, ", "))
+	}
+	if r.Passed() {
+		b.WriteString("Result: passed\n")
+	} else {
+		b.WriteString("Result: failed\n")
+	}
+	return b.String()
+}
+
+// CheckPermissions verifies the credentials of a storage backend allow
+// every operation the server performs
+func CheckPermissions(ctx context.Context, store storage.Storage) (PermissionReport, error) {
+	checker, ok := store.(storage.PermissionChecker)
+	if !ok {
+		return PermissionReport{}, fmt.Errorf("%w: %s", ErrUnsupported, store.GetProvider())
+	}
+	return PermissionReport{Provider: store.GetProvider(), Checks: checker.CheckPermissions(ctx)}, nil
+}
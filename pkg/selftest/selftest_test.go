@@ -0,0 +1,99 @@
+package selftest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/tus/tusd/v2/pkg/filestore"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// diskStorage adapts a tusd filestore to the storage interface
+type diskStorage struct {
+	composer *tusd.StoreComposer
+}
+
+func (d *diskStorage) Initialize(ctx context.Context, cfg *storage.Config) error { return nil }
+func (d *diskStorage) GetHandler(basePath string) (*tusd.Handler, error)         { return nil, nil }
+func (d *diskStorage) GetProvider() storage.Provider                             { return storage.Disk }
+func (d *diskStorage) GetStoreComposer() *tusd.StoreComposer                     { return d.composer }
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	composer := tusd.NewStoreComposer()
+	filestore.New(dir).UseIn(composer)
+
+	report := Run(context.Background(), &diskStorage{composer: composer})
+	if !report.Passed() {
+		t.Fatalf("self-test failed:\n%s", report)
+	}
+	if len(report.Steps) != 4 {
+		t.Fatalf("expected 4 steps, got %d", len(report.Steps))
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected the test upload to be deleted, found %d files", len(entries))
+	}
+}
+
+func TestRunFailsOnUnwritableStorage(t *testing.T) {
+	// A regular file in place of the upload directory makes every write fail
+	path := filepath.Join(t.TempDir(), "not-a-directory")
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	composer := tusd.NewStoreComposer()
+	filestore.New(path).UseIn(composer)
+
+	report := Run(context.Background(), &diskStorage{composer: composer})
+	if report.Passed() {
+		t.Fatal("expected self-test to fail")
+	}
+	if len(report.Steps) != 1 || report.Steps[0].Name != "create" {
+		t.Fatalf("expected to stop after create, got %+v", report.Steps)
+	}
+}
+
+// checkedStorage reports fixed permission checks
+type checkedStorage struct {
+	diskStorage
+	checks []storage.PermissionCheck
+}
+
+func (c *checkedStorage) CheckPermissions(ctx context.Context) []storage.PermissionCheck {
+	return c.checks
+}
+
+func TestCheckPermissions(t *testing.T) {
+	if _, err := CheckPermissions(context.Background(), &diskStorage{}); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("expected backends without checks to be unsupported, got %v", err)
+	}
+
+	denied := errors.New("access denied")
+	report, err := CheckPermissions(context.Background(), &checkedStorage{checks: []storage.PermissionCheck{
+		{Operation: "PutObject", Permission: "s3:PutObject"},
+		{Operation: "CreateMultipartUpload", Permission: "s3:PutObject"},
+		{Operation: "AbortMultipartUpload", Permission: "s3:AbortMultipartUpload", Err: denied, Denied: true},
+		{Operation: "DeleteObject", Permission: "s3:DeleteObject", Err: denied, Denied: true},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Passed() {
+		t.Fatal("expected the check to fail")
+	}
+	if missing := report.Missing(); !reflect.DeepEqual(missing, []string{"s3:AbortMultipartUpload", "s3:DeleteObject"}) {
+		t.Fatalf("unexpected missing permissions %v", missing)
+	}
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultNetworkTimeout is how long a request body may stall before its
+// connection is closed when app.timeout is not set
+const DefaultNetworkTimeout = 60 * time.Second
+
+// clientBodyKey is the gin context key of the watched body of a PATCH
+// request
+const clientBodyKey = "clientBody"
+
+// clientBody watches the body of a PATCH request for the client going away.
+// tusd extends the read deadline of the connection by its NetworkTimeout on
+// each read, so a client that stops sending without closing it, as mobile
+// clients do when they lose the network, times out with a deadline error.
+type clientBody struct {
+	io.ReadCloser
+	received atomic.Int64
+
+	mu  sync.Mutex
+	err error
+}
+
+func (b *clientBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.received.Add(int64(n))
+	// The server closes the body itself when it stops an upload
+	if err != nil && err != io.EOF && !errors.Is(err, http.ErrBodyReadAfterClose) {
+		b.mu.Lock()
+		if b.err == nil {
+			b.err = err
+		}
+		b.mu.Unlock()
+	}
+	return n, err
+}
+
+// abortErr returns the error the body ended with if the client went away
+func (b *clientBody) abortErr() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+// clientAbortMiddleware detects PATCH requests whose client goes away
+// mid-chunk. tusd keeps the part of the chunk it stored, so the upload is
+// left at its last committed offset, which the client resumes from after
+// its next HEAD. Aborts are logged at info level rather than as failures,
+// and answered with 408 or 400 instead of tusd's 500.
+func (s *Server) clientAbortMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := strings.Trim(c.Param("any"), "/")
+		if c.Request.Method != http.MethodPatch || id == "" || c.Request.Body == nil {
+			c.Next()
+			return
+		}
+
+		body := &clientBody{ReadCloser: c.Request.Body}
+		c.Request.Body = body
+		c.Set(clientBodyKey, body)
+		c.Writer = &abortStatusWriter{ResponseWriter: c.Writer, body: body}
+		c.Next()
+
+		err := body.abortErr()
+		if err == nil {
+			return
+		}
+		args := []any{"id", id, "offset", c.GetHeader("Upload-Offset"), "received", body.received.Load(), "reason", abortReason(err)}
+		if info, infoErr := s.uploadInfo(context.WithoutCancel(c.Request.Context()), id); infoErr == nil {
+			args = append(args, "committed", info.Offset)
+		}
+		slog.Info("Client aborted upload chunk", append(args, "error", err)...)
+	}
+}
+
+// clientAbort returns why the client of a PATCH request went away before
+// sending its whole body, or nil if it didn't
+func clientAbort(c *gin.Context) error {
+	if body, ok := c.Get(clientBodyKey); ok {
+		return body.(*clientBody).abortErr()
+	}
+	return nil
+}
+
+// abortStatusWriter answers requests whose client went away with a client
+// error, since the server didn't fail
+type abortStatusWriter struct {
+	gin.ResponseWriter
+	body *clientBody
+}
+
+// Unwrap lets tusd extend the read deadline of the connection
+func (w *abortStatusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// WriteHeader replaces tusd's server error for aborted bodies
+func (w *abortStatusWriter) WriteHeader(code int) {
+	if err := w.body.abortErr(); err != nil && code >= http.StatusInternalServerError {
+		code = http.StatusBadRequest
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			code = http.StatusRequestTimeout
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// abortReason describes how a client went away
+func abortReason(err error) string {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return "client stopped sending data"
+	}
+	return "client disconnected"
+}
+
+// networkTimeout returns how long a request body may stall
+func (s *Server) networkTimeout() time.Duration {
+	if s.cfg.App.Timeout > 0 {
+		return time.Duration(s.cfg.App.Timeout) * time.Second
+	}
+	return DefaultNetworkTimeout
+}
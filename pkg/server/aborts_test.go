@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/diagnostics"
+)
+
+func TestStalledChunkTimesOut(t *testing.T) {
+	// tusd logs through the default logger the server was created with
+	var logs syncBuffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	_, ts := newTestServer(t, func(cfg *config.Config) {
+		cfg.App.Timeout = 1
+		cfg.Diagnostics.Enabled = true
+		cfg.Diagnostics.Timeline = 5
+	})
+	resp, body := request(t, http.MethodPost, ts.URL+DefaultBasePath, map[string]string{"Upload-Length": "10"}, "")
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("creating upload: %d %s", resp.StatusCode, body)
+	}
+	location := resp.Header.Get("Location")
+	id := location[strings.LastIndex(location, "/")+1:]
+
+	// Send part of the chunk and go silent without closing the connection
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "PATCH %s%s HTTP/1.1\r\nHost: %s\r\nTus-Resumable: 1.0.0\r\nUpload-Offset: 0\r\n"+
+		"Content-Type: application/offset+octet-stream\r\nContent-Length: 10\r\n\r\nhel",
+		DefaultBasePath, id, ts.Listener.Addr())
+
+	// The server gives up on the body after the network timeout
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	answer, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("expected the server to end the stalled request, got %v", err)
+	}
+	if !strings.HasPrefix(string(answer), "HTTP/1.1 408 ") {
+		t.Fatalf("expected the stalled request to time out, got %q", answer)
+	}
+
+	var stats diagnostics.Stats
+	deadline := time.Now().Add(5 * time.Second)
+	for len(stats.Timeline) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		resp, body = request(t, http.MethodGet, ts.URL+"/api/uploads/"+id+"/diagnostics", nil, "")
+		if resp.StatusCode == http.StatusOK {
+			if err := json.Unmarshal([]byte(body), &stats); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if len(stats.Timeline) != 1 || !stats.Timeline[0].Aborted || stats.Timeline[0].Error != "client stopped sending data" {
+		t.Fatalf("expected the chunk to be recorded as stalled, got %+v", stats)
+	}
+
+	// The upload is left at the bytes received, from which it resumes
+	resp, body = request(t, http.MethodHead, ts.URL+DefaultBasePath+id, nil, "")
+	if offset := resp.Header.Get("Upload-Offset"); offset != "3" {
+		t.Fatalf("expected the received bytes to be committed, got offset %q", offset)
+	}
+	resume := map[string]string{"Upload-Offset": "3", "Content-Type": "application/offset+octet-stream"}
+	resp, body = request(t, http.MethodPatch, ts.URL+DefaultBasePath+id, resume, "lo worl")
+	if resp.StatusCode != http.StatusNoContent || resp.Header.Get("Upload-Offset") != "10" {
+		t.Fatalf("resuming: %d %s", resp.StatusCode, body)
+	}
+
+	if strings.Contains(logs.String(), `"level":"ERROR"`) {
+		t.Fatalf("expected the abort not to be logged as an error, got %s", logs.String())
+	}
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+	"github.com/devsnb/large-file-uploads/pkg/deadletter"
+)
+
+// adminAuthMiddleware only lets requests carrying the admin token through
+func adminAuthMiddleware(token string) gin.HandlerFunc {
+	middleware := auth.NewMiddleware(auth.NewStaticTokenVerifier(token, auth.User{
+		ID:       "admin",
+		Username: "admin",
+		Role:     "admin",
+	}))
+
+	return func(c *gin.Context) {
+		status, err := middleware.AuthenticateUploadRequest(c.Request)
+		if err != nil {
+			c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.Next()
+	}
+}
+
+// registerAdminRoutes mounts the operator API on the given group
+func (s *Server) registerAdminRoutes(admin *gin.RouterGroup) {
+	admin.GET("/deadletters", s.listDeadLetters)
+	admin.GET("/deadletters/:id", s.getDeadLetter)
+	admin.POST("/deadletters/:id/redeliver", s.redeliverDeadLetter)
+	admin.DELETE("/deadletters/:id", s.deleteDeadLetter)
+	admin.GET("/uploads/:id/state", s.adminGetUploadState)
+	admin.POST("/uploads/:id/state", s.adminSetUploadState)
+	admin.PUT("/uploads/:id/annotations/:key", s.adminAnnotateUpload)
+	admin.DELETE("/uploads/:id/annotations/:key", s.adminRemoveAnnotation)
+	if s.contents != nil {
+		admin.POST("/uploads/:id/verify", s.verifyContent)
+	}
+	admin.GET("/intakes", s.listIntakes)
+	admin.POST("/intakes", s.createIntake)
+	admin.GET("/intakes/:iid", s.getIntake)
+	admin.DELETE("/intakes/:iid", s.deleteIntake)
+	admin.GET("/tenants", s.listTenants)
+	admin.POST("/tenants", s.createTenant)
+	admin.GET("/tenants/:tid", s.getTenant)
+	admin.PUT("/tenants/:tid", s.updateTenant)
+	admin.POST("/tenants/:tid/disable", s.setTenantDisabled(true))
+	admin.POST("/tenants/:tid/enable", s.setTenantDisabled(false))
+	if s.eventLog != nil {
+		admin.GET("/events", s.listEvents)
+		admin.POST("/events/replay", s.replayEvents)
+		admin.GET("/events/replays/:rid", s.getReplayJob)
+	}
+	if s.journal != nil {
+		admin.GET("/journal", s.getJournal)
+	}
+	if s.reservations != nil {
+		admin.GET("/reservations", s.adminListReservations)
+	}
+	if s.bans != nil {
+		admin.GET("/banlist", s.listBans)
+		admin.POST("/banlist", s.addBan)
+		admin.DELETE("/banlist/:digest", s.removeBan)
+	}
+	if s.scanCache != nil {
+		admin.DELETE("/antivirus/cache", s.clearScanCache)
+	}
+	if s.cfg.Costs.Enabled {
+		admin.GET("/costs", s.getCosts)
+	}
+	if s.healthReports != nil {
+		admin.GET("/health-report", s.getHealthReport)
+	}
+	if s.deletions != nil {
+		admin.GET("/deletions", s.listDeletions)
+		admin.POST("/deletions/:id/restore", s.adminRestoreUpload)
+	}
+	if s.traffic != nil {
+		admin.GET("/traffic", s.adminGetTraffic)
+	}
+	if s.failover != nil {
+		admin.GET("/storage/failover", s.getFailover)
+		admin.POST("/storage/failover", s.failOver)
+		admin.POST("/storage/failback", s.failBack)
+		admin.POST("/storage/failover/reconcile", s.reconcileFailover)
+	}
+	if s.mirror != nil {
+		admin.GET("/storage/mirror", s.getMirror)
+		admin.POST("/storage/mirror/:id/retry", s.retryMirror)
+	}
+	if s.tiering != nil {
+		admin.GET("/storage/tiering", s.listTransitions)
+	}
+	if s.capabilities != nil {
+		admin.GET("/storage/capabilities", s.getCapabilities)
+	}
+	admin.GET("/features", s.listFeatures)
+	admin.GET("/features/:name", s.getFeature)
+	admin.PUT("/features/:name", s.setFeature)
+	admin.DELETE("/features/:name", s.resetFeature)
+	admin.PUT("/features/:name/tenants/:tenant", s.setFeature)
+	admin.DELETE("/features/:name/tenants/:tenant", s.resetFeature)
+	admin.GET("/log-level", s.getLogLevel)
+	admin.PUT("/log-level", s.setLogLevel)
+}
+
+// listDeadLetters returns all failed deliveries
+func (s *Server) listDeadLetters(c *gin.Context) {
+	entries, err := s.deadLetters.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deadLetters": entries})
+}
+
+// getDeadLetter returns a single failed delivery
+func (s *Server) getDeadLetter(c *gin.Context) {
+	entry, err := s.deadLetters.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(deadLetterStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+// redeliverDeadLetter retries a failed delivery
+func (s *Server) redeliverDeadLetter(c *gin.Context) {
+	if err := s.deadLetters.Redeliver(c.Request.Context(), c.Param("id")); err != nil {
+		c.JSON(deadLetterStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "delivered"})
+}
+
+// deleteDeadLetter discards a failed delivery
+func (s *Server) deleteDeadLetter(c *gin.Context) {
+	if err := s.deadLetters.Delete(c.Request.Context(), c.Param("id")); err != nil {
+		c.JSON(deadLetterStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// deadLetterStatus maps dead-letter errors to HTTP status codes
+func deadLetterStatus(err error) int {
+	switch {
+	case errors.Is(err, deadletter.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, deadletter.ErrUnknownDeliverer):
+		return http.StatusConflict
+	default:
+		return http.StatusBadGateway
+	}
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/antivirus"
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+	"github.com/devsnb/large-file-uploads/pkg/uploadstate"
+)
+
+// AntivirusAnnotation is the annotation key of scan verdicts
+const AntivirusAnnotation = "antivirus"
+
+// scanAnnotation is the verdict recorded on a scanned upload. Cached
+// verdicts were reached for an earlier upload with the same content.
+type scanAnnotation struct {
+	antivirus.Verdict
+	Cached    bool      `json:"cached,omitempty"`
+	ScannedAt time.Time `json:"scannedAt"`
+}
+
+// Results of antivirus scans, as counted in the metrics
+const (
+	scanClean    = "clean"
+	scanInfected = "infected"
+	scanError    = "error"
+)
+
+// scanUpload scans an upload being processed with the antivirus engine and
+// reports whether it was moved on. Infected uploads are quarantined and
+// uploads that couldn't be scanned fail.
+func (s *Server) scanUpload(ctx context.Context, info tusd.FileInfo) (bool, error) {
+	select {
+	case s.scanSlots <- struct{}{}:
+	case <-ctx.Done():
+		return true, nil
+	}
+	engine := s.scanner.Name()
+	verdict, cached, err := s.scan(ctx, info.ID)
+	<-s.scanSlots
+	if err != nil {
+		if ctx.Err() == nil {
+			s.scans.Inc(engine, scanError)
+		}
+		return true, s.failProcessing(ctx, info, "antivirus scan failed", err)
+	}
+
+	// The verdict is recorded before the state changes, so the state change
+	// event carries it
+	annotation := scanAnnotation{Verdict: verdict, Cached: cached, ScannedAt: time.Now()}
+	if _, err := s.AnnotateUpload(ctx, info.ID, AntivirusAnnotation, annotation); err != nil {
+		slog.Error("Failed to record scan verdict", "id", info.ID, "error", err)
+	}
+
+	result := scanClean
+	if verdict.Infected {
+		result = scanInfected
+	}
+	if cached {
+		s.scans.IncCached(engine, result)
+		slog.Info("Reused cached scan verdict", "id", info.ID, "engine", engine, "infected", verdict.Infected)
+	} else {
+		s.scans.Inc(engine, result)
+	}
+	if !verdict.Infected {
+		return false, nil
+	}
+
+	slog.Warn("Malware found in upload", "id", info.ID, "engine", engine, "signature", verdict.Signature, "cached", cached)
+	reason := "malware found"
+	if verdict.Signature != "" {
+		reason += ": " + verdict.Signature
+	}
+	_, err = s.transition(ctx, info, uploadstate.Quarantined, reason)
+	return true, err
+}
+
+// scan sends the data of an upload to the antivirus engine, unless the
+// verdict for its content is cached. It reports whether the verdict was.
+func (s *Server) scan(ctx context.Context, id string) (antivirus.Verdict, bool, error) {
+	if s.scanCache != nil {
+		// Hashing the upload is much faster than scanning it again
+		digest, err := s.uploadDigest(ctx, id)
+		if err != nil {
+			return antivirus.Verdict{}, false, err
+		}
+		return s.scanCache.Scan(ctx, digest, func() (io.ReadCloser, error) {
+			return s.openUpload(ctx, id)
+		})
+	}
+
+	reader, err := s.openUpload(ctx, id)
+	if err != nil {
+		return antivirus.Verdict{}, false, err
+	}
+	defer reader.Close()
+	verdict, err := s.scanner.Scan(ctx, reader)
+	return verdict, false, err
+}
+
+// clearScanCache drops all cached scan verdicts, e.g. after updating the
+// signatures of an engine that doesn't report their version
+func (s *Server) clearScanCache(c *gin.Context) {
+	if err := s.scanCache.Clear(c.Request.Context()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	slog.Info("Scan verdict cache cleared")
+	c.Status(http.StatusNoContent)
+}
+
+// openUpload returns a reader for the data of a finished upload. Uploads
+// that are content-addressed are read from their content key.
+func (s *Server) openUpload(ctx context.Context, id string) (io.ReadCloser, error) {
+	if tenant, ok := storage.TenantFromKey(id); ok {
+		ctx = storage.WithTenant(ctx, tenant)
+	}
+
+	ref, ok, err := s.contentReference(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		reader, _, err := s.contents.OpenContent(ctx, ref.Digest)
+		return reader, err
+	}
+
+	upload, err := s.composer.Core.GetUpload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return upload.GetReader(ctx)
+}
+
+// newScanner creates the antivirus engine uploads are scanned with, or
+// returns nil if scanning is disabled
+func newScanner(cfg config.AntivirusConfig) (antivirus.Engine, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	engine, err := antivirus.New(cfg.Engine, cfg.Address, time.Duration(cfg.Timeout)*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create antivirus engine: %w", err)
+	}
+	return engine, nil
+}
+
+// newScanCache creates the cache of scan verdicts, or returns nil if
+// scanning or caching is disabled
+func newScanCache(cfg config.AntivirusConfig, engine antivirus.Engine) (*antivirus.ScanCache, error) {
+	if engine == nil || !cfg.Cache.Enabled {
+		return nil, nil
+	}
+	if cfg.Cache.TTL <= 0 {
+		return nil, fmt.Errorf("antivirus cache ttl must be positive")
+	}
+	ttl := time.Duration(cfg.Cache.TTL) * time.Second
+
+	if cfg.Cache.Dir == "" {
+		return antivirus.NewScanCache(engine, antivirus.NewMemoryCache(), ttl), nil
+	}
+	cache, err := antivirus.NewFileCache(cfg.Cache.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scan cache: %w", err)
+	}
+	return antivirus.NewScanCache(engine, cache, ttl), nil
+}
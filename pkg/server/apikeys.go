@@ -0,0 +1,262 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devsnb/large-file-uploads/pkg/apikey"
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+	"github.com/devsnb/large-file-uploads/pkg/tenant"
+)
+
+// TenantAdminRole is the JWT role allowed to manage the API keys of its own
+// tenant. Admins manage the keys of any tenant.
+const TenantAdminRole = "tenant_admin"
+
+// apiKeyRole is the role of requests authenticated with an API key, which
+// can't manage keys themselves
+const apiKeyRole = "user"
+
+// apiKeyRequest is the body of an API key creation
+type apiKeyRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// apiKeyView is what tenant admins see of a key: never its secret
+type apiKeyView struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Tenant     string     `json:"tenant"`
+	Prefix     string     `json:"prefix"` // Start of the key, to recognize it
+	CreatedBy  string     `json:"createdBy,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	RotatedAt  *time.Time `json:"rotatedAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+}
+
+// newAPIKeyView hides the digests of a key
+func newAPIKeyView(key apikey.Key) apiKeyView {
+	return apiKeyView{
+		ID:         key.ID,
+		Name:       key.Name,
+		Tenant:     key.Tenant,
+		Prefix:     apikey.Prefix + key.ID,
+		CreatedBy:  key.CreatedBy,
+		CreatedAt:  key.CreatedAt,
+		RotatedAt:  key.RotatedAt,
+		LastUsedAt: key.LastUsedAt,
+		ExpiresAt:  key.ExpiresAt,
+		RevokedAt:  key.RevokedAt,
+	}
+}
+
+// apiKeyVerifier authenticates API keys and passes other tokens on to the
+// JWT verifier
+type apiKeyVerifier struct {
+	keys    *apikey.Registry
+	tenants *tenant.Registry
+	next    auth.TokenVerifier
+}
+
+// VerifyToken authenticates an API key as a user of its tenant. Uploads
+// created with a key are owned by the key, so rotating it keeps access to
+// them.
+func (v *apiKeyVerifier) VerifyToken(token string) (*auth.User, error) {
+	if !apikey.IsKey(token) {
+		return v.next.VerifyToken(token)
+	}
+
+	key, err := v.keys.Authenticate(context.Background(), token)
+	if err != nil {
+		if !errors.Is(err, apikey.ErrNotFound) && !errors.Is(err, apikey.ErrMalformed) &&
+			!errors.Is(err, apikey.ErrBadSecret) && !errors.Is(err, apikey.ErrRevoked) &&
+			!errors.Is(err, apikey.ErrExpired) {
+			slog.Error("Failed to authenticate api key", "error", err)
+		}
+		return nil, fmt.Errorf("%w: %v", auth.ErrInvalidToken, err)
+	}
+	t, err := v.tenants.Get(context.Background(), key.Tenant)
+	switch {
+	case errors.Is(err, tenant.ErrNotFound):
+	case err != nil:
+		// Fail closed rather than let keys of a disabled tenant through
+		slog.Error("Failed to load tenant of api key", "key", key.ID, "tenant", key.Tenant, "error", err)
+		return nil, fmt.Errorf("%w: failed to load tenant %q", auth.ErrInvalidToken, key.Tenant)
+	case t.Disabled:
+		return nil, fmt.Errorf("%w: tenant %q is disabled", auth.ErrInvalidToken, key.Tenant)
+	}
+
+	return &auth.User{
+		ID:       "apikey:" + key.ID,
+		Username: key.Name,
+		Role:     apiKeyRole,
+		Tenant:   key.Tenant,
+	}, nil
+}
+
+// tokenVerifier returns the verifier of bearer tokens: JWTs, and API keys
+// when enabled
+func (s *Server) tokenVerifier() auth.TokenVerifier {
+	jwt := auth.NewJWTVerifier(s.cfg.Auth.JWTSecret)
+	if s.apiKeys == nil {
+		return jwt
+	}
+	return &apiKeyVerifier{keys: s.apiKeys, tenants: s.tenants, next: jwt}
+}
+
+// managedTenant returns the tenant whose keys or reservations the caller
+// manages. Tenant admins manage their own tenant; admins pick one with the
+// tenant query parameter, which must be a valid tenant ID.
+func managedTenant(c *gin.Context, what string) (tenant string, user *auth.User, ok bool) {
+	user, err := auth.GetUserFromContext(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return "", nil, false
+	}
+
+	switch user.Role {
+	case "admin":
+		tenant = c.DefaultQuery("tenant", user.Tenant)
+	case TenantAdminRole:
+		tenant = user.Tenant
+	default:
+		c.JSON(http.StatusForbidden, gin.H{"error": "managing " + what + " requires the tenant_admin role"})
+		return "", nil, false
+	}
+	if tenant == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no tenant to manage " + what + " of"})
+		return "", nil, false
+	}
+	if !storage.ValidTenant(tenant) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid tenant %q", tenant)})
+		return "", nil, false
+	}
+	return tenant, user, true
+}
+
+// listAPIKeys returns the keys of the caller's tenant
+func (s *Server) listAPIKeys(c *gin.Context) {
+	tenant, _, ok := managedTenant(c, "api keys")
+	if !ok {
+		return
+	}
+
+	keys, err := s.apiKeys.List(c.Request.Context(), tenant)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	views := make([]apiKeyView, 0, len(keys))
+	for _, key := range keys {
+		views = append(views, newAPIKeyView(key))
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": views})
+}
+
+// createAPIKey issues a key for the caller's tenant. The secret is only
+// returned in this response.
+func (s *Server) createAPIKey(c *gin.Context) {
+	tenant, user, ok := managedTenant(c, "api keys")
+	if !ok {
+		return
+	}
+
+	var req apiKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	key, secret, err := s.apiKeys.Create(c.Request.Context(), apikey.Key{
+		Tenant:    tenant,
+		Name:      req.Name,
+		CreatedBy: user.ID,
+		ExpiresAt: req.ExpiresAt,
+	})
+	if err != nil {
+		respondAPIKeyError(c, err)
+		return
+	}
+
+	slog.Info("API key created", "key", key.ID, "tenant", tenant, "by", user.ID)
+	c.JSON(http.StatusCreated, gin.H{"key": newAPIKeyView(key), "secret": secret})
+}
+
+// rotateAPIKey replaces the secret of a key. The old secret keeps working
+// for apiKeys.rotationGrace seconds.
+func (s *Server) rotateAPIKey(c *gin.Context) {
+	tenant, user, ok := managedTenant(c, "api keys")
+	if !ok {
+		return
+	}
+
+	grace := time.Duration(s.cfg.APIKeys.RotationGrace) * time.Second
+	key, secret, err := s.apiKeys.Rotate(c.Request.Context(), tenant, c.Param("kid"), grace)
+	if err != nil {
+		respondAPIKeyError(c, err)
+		return
+	}
+
+	slog.Info("API key rotated", "key", key.ID, "tenant", tenant, "by", user.ID)
+	body := gin.H{"key": newAPIKeyView(key), "secret": secret}
+	if key.PreviousExpiresAt != nil {
+		body["previousSecretExpiresAt"] = key.PreviousExpiresAt
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+// revokeAPIKey disables a key immediately
+func (s *Server) revokeAPIKey(c *gin.Context) {
+	tenant, user, ok := managedTenant(c, "api keys")
+	if !ok {
+		return
+	}
+
+	key, err := s.apiKeys.Revoke(c.Request.Context(), tenant, c.Param("kid"))
+	if err != nil {
+		respondAPIKeyError(c, err)
+		return
+	}
+
+	slog.Info("API key revoked", "key", key.ID, "tenant", tenant, "by", user.ID)
+	c.JSON(http.StatusOK, gin.H{"key": newAPIKeyView(key)})
+}
+
+// respondAPIKeyError maps key errors to responses
+func respondAPIKeyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, apikey.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, apikey.ErrInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, apikey.ErrRevoked), errors.Is(err, apikey.ErrExpired):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// newAPIKeyStore creates the store for API keys
+func newAPIKeyStore(cfg config.APIKeysConfig) (apikey.Store, error) {
+	if cfg.Dir == "" {
+		return apikey.NewMemoryStore(), nil
+	}
+
+	store, err := apikey.NewFileStore(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create api key store: %w", err)
+	}
+	return store, nil
+}
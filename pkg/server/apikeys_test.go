@@ -0,0 +1,30 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+)
+
+func TestAdminAPIKeyTenantMustBeValid(t *testing.T) {
+	_, ts := newTestServer(t, func(cfg *config.Config) {
+		cfg.Auth.Enabled = true
+		cfg.Auth.JWTSecret = testSecret
+		cfg.APIKeys.Enabled = true
+	})
+	header := bearer(t, "root", "admin", "")
+	header["Content-Type"] = "application/json"
+
+	for _, tenant := range []string{"../acme", "ac me", "acme/x"} {
+		resp, body := request(t, http.MethodPost, ts.URL+"/api/keys?tenant="+url.QueryEscape(tenant), header, `{"name": "ci"}`)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected tenant %q to be refused, got %d %s", tenant, resp.StatusCode, body)
+		}
+	}
+	resp, body := request(t, http.MethodPost, ts.URL+"/api/keys?tenant=acme", header, `{"name": "ci"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected a key for a valid tenant, got %d %s", resp.StatusCode, body)
+	}
+}
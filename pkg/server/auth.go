@@ -0,0 +1,307 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/opa"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// Authorization errors
+var (
+	// errNotOwner is returned when a user accesses an upload they do not own
+	errNotOwner = errors.New("upload belongs to another user")
+	// errTokenMismatch is returned when a signed token was issued for another upload
+	errTokenMismatch = errors.New("token was issued for another upload")
+)
+
+// SetAuthorizer plugs in an authorizer consulted on every upload operation
+// after the built-in ownership rules, e.g. to enforce policies of an external
+// policy service. It replaces the one of auth.policyEngine and must be called
+// before the server starts handling requests.
+func (s *Server) SetAuthorizer(authorizer auth.Authorizer) {
+	s.authorizer = authorizer
+}
+
+// newAuthorizer creates the authorizer of the configured policy engine, or
+// returns nil if only the built-in ownership rules apply
+func newAuthorizer(cfg config.AuthConfig) (auth.Authorizer, error) {
+	switch cfg.PolicyEngine {
+	case "":
+		return nil, nil
+	case "opa":
+		if cfg.OPA.URL == "" {
+			return nil, fmt.Errorf("policy engine opa requires auth.opa.url to be set")
+		}
+		return opa.New(cfg.OPA.URL, time.Duration(cfg.OPA.Timeout)*time.Second), nil
+	default:
+		return nil, fmt.Errorf("unknown policy engine %q, expected %q", cfg.PolicyEngine, "opa")
+	}
+}
+
+// userAuthMiddleware authenticates API requests with a JWT or API key when
+// authentication is enabled
+func (s *Server) userAuthMiddleware() gin.HandlerFunc {
+	if !s.cfg.Auth.Enabled {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	middleware := auth.NewMiddleware(s.tokenVerifier())
+	return func(c *gin.Context) {
+		status, err := middleware.AuthenticateUploadRequest(c.Request)
+		if err != nil {
+			c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		if err := s.tenantAccess(c.Request); err != nil {
+			abortAPI(c, err)
+			return
+		}
+		c.Next()
+	}
+}
+
+// uploadAuthMiddleware authenticates tus requests when authentication is
+// enabled. Requests for an existing upload must come from its owner or an
+// admin, or carry a claim token, download token or share link issued for
+// that upload.
+func (s *Server) uploadAuthMiddleware() gin.HandlerFunc {
+	if !s.cfg.Auth.Enabled {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	middleware := auth.NewMiddleware(s.tokenVerifier())
+	return func(c *gin.Context) {
+		// CORS preflight requests never carry credentials
+		if c.Request.Method == http.MethodOptions {
+			c.Next()
+			return
+		}
+
+		id := strings.Trim(c.Param("any"), "/")
+
+		if token := c.GetHeader(ClaimHeader); token != "" && id != "" {
+			if err := s.verifyClaim(token, id); err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			if c.Request.Method != http.MethodHead && c.Request.Method != http.MethodPatch {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "claim tokens only allow resuming uploads"})
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if token := c.Query(ShareParam); token != "" && id != "" && s.shares != nil && c.Request.Method == http.MethodGet {
+			s.serveShare(c, id, token)
+			return
+		}
+
+		if token := c.Query(DownloadTokenParam); token != "" && id != "" && c.Request.Method == http.MethodGet {
+			user, err := s.verifyDownloadToken(token, id)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			// Tokens issued for stamped downloads carry the user requesting them
+			if user != nil {
+				c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), auth.UserKey{}, user))
+				if err := s.tenantAccess(c.Request); err != nil {
+					s.abortTus(c, err)
+					return
+				}
+			}
+			c.Next()
+			return
+		}
+
+		status, err := middleware.AuthenticateUploadRequest(c.Request)
+		if err != nil {
+			c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		if err := s.tenantAccess(c.Request); err != nil {
+			s.abortTus(c, err)
+			return
+		}
+
+		// Bind storage requests to the caller's tenant. Admins act on any
+		// tenant's uploads, so their requests use the upload's own tenant.
+		if user, err := auth.GetUserFromContext(c.Request.Context()); err == nil && user.Role != "admin" {
+			c.Request = c.Request.WithContext(storage.WithTenant(c.Request.Context(), user.Tenant))
+		}
+
+		// Creation requests have no upload ID yet
+		if id == "" {
+			c.Next()
+			return
+		}
+
+		if err := s.authorizeOwner(c.Request.Context(), id); err != nil {
+			if errors.Is(err, errNotOwner) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			// Let tusd answer requests for unknown uploads
+			if !errors.Is(err, tusd.ErrNotFound) {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// authorizeOwner checks that the authenticated user owns the upload or is an
+// admin. It always succeeds when authentication is disabled.
+func (s *Server) authorizeOwner(ctx context.Context, id string) error {
+	if !s.cfg.Auth.Enabled {
+		return nil
+	}
+
+	user, err := auth.GetUserFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	info, err := s.uploadInfo(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if user.Role == "admin" || info.MetaData[auth.OwnerMetadataKey] == user.ID {
+		return nil
+	}
+
+	return errNotOwner
+}
+
+// authorize checks that the caller may perform an action on an upload: it
+// must pass the built-in ownership rules and the authorizer, if one is set
+func (s *Server) authorize(ctx context.Context, action auth.Action, id string) error {
+	if err := s.authorizeOwner(ctx, id); err != nil {
+		return err
+	}
+	if s.authorizer == nil {
+		return nil
+	}
+
+	info, err := s.uploadInfo(ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.consultAuthorizer(ctx, action, authUpload(info))
+}
+
+// consultAuthorizer asks the authorizer whether the caller may perform an
+// action on an upload
+func (s *Server) consultAuthorizer(ctx context.Context, action auth.Action, upload auth.Upload) error {
+	// Requests authorized by a claim or download token have no user
+	user, _ := auth.GetUserFromContext(ctx)
+	if err := s.authorizer.Authorize(auth.WithUpload(ctx, upload), user, action, upload.ID); err != nil {
+		if !errors.Is(err, auth.ErrForbidden) {
+			slog.Error("Authorizer failed", "action", action, "id", upload.ID, "error", err)
+		}
+		return err
+	}
+	return nil
+}
+
+// authorizerMiddleware consults the authorizer on tus requests. It runs
+// after uploadAuthMiddleware, which applies the built-in ownership rules.
+func (s *Server) authorizerMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := strings.Trim(c.Param("any"), "/")
+		action, ok := uploadAction(c.Request.Method, id)
+		if s.authorizer == nil || !ok {
+			c.Next()
+			return
+		}
+
+		var upload auth.Upload
+		if action == auth.ActionCreate {
+			upload = declaredUpload(c.Request.Header)
+		} else {
+			// Let tusd answer requests for unknown uploads. Any other
+			// error denies the request, since the authorizer can't
+			// decide without the upload.
+			info, err := s.uploadInfo(c.Request.Context(), id)
+			if errors.Is(err, tusd.ErrNotFound) {
+				c.Next()
+				return
+			}
+			if err != nil {
+				slog.Error("Failed to read upload to authorize", "action", action, "id", id, "error", err)
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to authorize request"})
+				return
+			}
+			upload = authUpload(info)
+		}
+
+		if err := s.consultAuthorizer(c.Request.Context(), action, upload); err != nil {
+			if errors.Is(err, auth.ErrForbidden) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to authorize request"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// uploadAction returns the action a tus request performs on an upload
+func uploadAction(method, id string) (auth.Action, bool) {
+	if id == "" {
+		return auth.ActionCreate, method == http.MethodPost
+	}
+
+	switch method {
+	case http.MethodHead:
+		return auth.ActionRead, true
+	case http.MethodPatch:
+		return auth.ActionWrite, true
+	case http.MethodGet:
+		return auth.ActionDownload, true
+	case http.MethodDelete:
+		return auth.ActionDelete, true
+	default:
+		return "", false
+	}
+}
+
+// authUpload describes an existing upload to the authorizer
+func authUpload(info tusd.FileInfo) auth.Upload {
+	return auth.Upload{
+		ID:             info.ID,
+		Size:           info.Size,
+		SizeIsDeferred: info.SizeIsDeferred,
+		Offset:         info.Offset,
+		MetaData:       info.MetaData,
+	}
+}
+
+// declaredUpload describes the upload a creation request declares to the
+// authorizer
+func declaredUpload(header http.Header) auth.Upload {
+	upload := auth.Upload{
+		SizeIsDeferred: header.Get("Upload-Defer-Length") == "1",
+		MetaData:       tusd.ParseMetadataHeader(header.Get("Upload-Metadata")),
+	}
+	upload.Size, _ = strconv.ParseInt(header.Get("Upload-Length"), 10, 64)
+	return upload
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// flakyInfo is in-memory storage whose upload lookups fail while failing
+// is set
+type flakyInfo struct {
+	*storage.MemoryStorage
+	composer *tusd.StoreComposer
+	failing  atomic.Bool
+}
+
+func newFlakyInfo(t *testing.T) *flakyInfo {
+	t.Helper()
+	store := &flakyInfo{MemoryStorage: newMemoryStorage(t)}
+	composer := *store.MemoryStorage.GetStoreComposer()
+	composer.Core = flakyInfoStore{composer.Core, &store.failing}
+	store.composer = &composer
+	return store
+}
+
+func (s *flakyInfo) GetStoreComposer() *tusd.StoreComposer {
+	return s.composer
+}
+
+// flakyInfoStore is the data store of flakyInfo
+type flakyInfoStore struct {
+	tusd.DataStore
+	failing *atomic.Bool
+}
+
+func (s flakyInfoStore) GetUpload(ctx context.Context, id string) (tusd.Upload, error) {
+	if s.failing.Load() {
+		return nil, errors.New("storage unavailable")
+	}
+	return s.DataStore.GetUpload(ctx, id)
+}
+
+func TestAuthorizerMiddleware(t *testing.T) {
+	store := newFlakyInfo(t)
+	srv, ts := newTestServerOn(t, store, nil)
+	var consulted atomic.Int32
+	srv.SetAuthorizer(auth.AuthorizerFunc(func(ctx context.Context, user *auth.User, action auth.Action, id string) error {
+		consulted.Add(1)
+		if action == auth.ActionDelete {
+			return auth.ErrForbidden
+		}
+		return nil
+	}))
+	id := upload(t, ts, "hello", nil)
+	consulted.Store(0)
+
+	resp, body := request(t, http.MethodHead, ts.URL+DefaultBasePath+id, nil, "")
+	if resp.StatusCode != http.StatusOK || consulted.Load() != 1 {
+		t.Fatalf("HEAD: %d %s after %d decisions", resp.StatusCode, body, consulted.Load())
+	}
+	resp, body = request(t, http.MethodDelete, ts.URL+DefaultBasePath+id, nil, "")
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected the authorizer to deny DELETE, got %d %s", resp.StatusCode, body)
+	}
+
+	// tusd answers requests for unknown uploads
+	resp, _ = request(t, http.MethodHead, ts.URL+DefaultBasePath+"missing", nil, "")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown upload, got %d", resp.StatusCode)
+	}
+
+	// A storage error must not skip the authorizer
+	store.failing.Store(true)
+	consulted.Store(0)
+	resp, body = request(t, http.MethodDelete, ts.URL+DefaultBasePath+id, nil, "")
+	if resp.StatusCode != http.StatusInternalServerError || !strings.Contains(body, "failed to authorize request") || consulted.Load() != 0 {
+		t.Fatalf("expected a failed lookup to deny the request, got %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestAuthorizerSeesDeclaredUpload(t *testing.T) {
+	srv, ts := newTestServer(t, nil)
+	var declared auth.Upload
+	srv.SetAuthorizer(auth.AuthorizerFunc(func(ctx context.Context, user *auth.User, action auth.Action, id string) error {
+		if action != auth.ActionCreate {
+			return nil
+		}
+		declared, _ = auth.UploadFromContext(ctx)
+		if declared.Size > 5 {
+			return auth.ErrForbidden
+		}
+		return nil
+	}))
+
+	upload(t, ts, "hello", map[string]string{"Upload-Metadata": "filename ZG9jLnBkZg=="})
+	if declared.Size != 5 || declared.MetaData["filename"] != "doc.pdf" {
+		t.Fatalf("expected the authorizer to see the declared upload, got %+v", declared)
+	}
+
+	resp, body := request(t, http.MethodPost, ts.URL+DefaultBasePath, map[string]string{"Upload-Length": "6"}, "")
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected the authorizer to deny the creation, got %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestAuthorizerGuardsAPIRoutes(t *testing.T) {
+	srv, ts := newTestServer(t, nil)
+	id := upload(t, ts, "hello", nil)
+	var actions []auth.Action
+	srv.SetAuthorizer(auth.AuthorizerFunc(func(ctx context.Context, user *auth.User, action auth.Action, uploadID string) error {
+		actions = append(actions, action)
+		if upload, ok := auth.UploadFromContext(ctx); !ok || upload.ID != id || upload.Offset != 5 {
+			t.Errorf("expected the authorizer to see the stored upload, got %+v", upload)
+		}
+		return auth.ErrForbidden
+	}))
+
+	resp, body := request(t, http.MethodGet, ts.URL+"/api/uploads/"+id+"/state", nil, "")
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected the authorizer to deny reading the state, got %d %s", resp.StatusCode, body)
+	}
+	if len(actions) != 1 || actions[0] != auth.ActionRead {
+		t.Fatalf("expected one read decision, got %v", actions)
+	}
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+	"sync"
+)
+
+// backgroundJobs tracks goroutines started on behalf of requests and
+// events, so shutdown can wait for them to finish
+type backgroundJobs struct {
+	mu     sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// start runs fn in a goroutine unless the jobs are closed, and reports
+// whether it was started
+func (j *backgroundJobs) start(fn func()) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.closed {
+		return false
+	}
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		fn()
+	}()
+	return true
+}
+
+// close refuses new jobs and waits for the running ones
+func (j *backgroundJobs) close() {
+	j.mu.Lock()
+	j.closed = true
+	j.mu.Unlock()
+	j.wg.Wait()
+}
+
+// goBackground runs fn in a goroutine that shutdown waits for. Its context
+// is canceled when the server stops. Jobs started after that are dropped.
+func (s *Server) goBackground(fn func(ctx context.Context)) bool {
+	return s.jobs.start(func() {
+		fn(s.background)
+	})
+}
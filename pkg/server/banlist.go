@@ -0,0 +1,231 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/banlist"
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/events"
+	"github.com/devsnb/large-file-uploads/pkg/eventschema"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+	"github.com/devsnb/large-file-uploads/pkg/uploadstate"
+)
+
+// BanListAnnotation is the annotation key of ban list matches
+const BanListAnnotation = "banlist"
+
+// DigestAnnotation is the annotation key of the SHA-256 digest the ban
+// list check computed, which later bans are matched against on download
+const DigestAnnotation = "digest"
+
+// banAnnotation is recorded on an upload matching the ban list
+type banAnnotation struct {
+	banlist.Entry
+	MatchedAt time.Time `json:"matchedAt"`
+}
+
+// banRequest is the body of a ban list addition
+type banRequest struct {
+	Digest string `json:"digest" binding:"required"`
+	Reason string `json:"reason"`
+}
+
+// OnUploadBanned subscribes to completed uploads that matched the content
+// ban list and were quarantined. The ban list entry is in the banlist
+// annotation. Ban subscribers are always invoked asynchronously.
+func (s *Server) OnUploadBanned(handler events.Handler, opts ...events.SubscribeOption) {
+	opts = append(opts, events.WithMode(events.Async))
+	s.events.Subscribe(events.UploadBanned, handler, opts...)
+}
+
+// checkBanList quarantines an upload being processed if its digest is on
+// the ban list, and reports whether it was moved on
+func (s *Server) checkBanList(ctx context.Context, info tusd.FileInfo) (bool, error) {
+	digest, err := s.uploadDigest(ctx, info.ID)
+	if err != nil {
+		return true, s.failProcessing(ctx, info, "ban list check failed", err)
+	}
+	if _, err := s.AnnotateUpload(ctx, info.ID, DigestAnnotation, digest); err != nil {
+		slog.Error("Failed to record upload digest", "id", info.ID, "error", err)
+	}
+	entry, banned, err := s.bans.Match(ctx, digest)
+	if err != nil {
+		return true, s.failProcessing(ctx, info, "ban list check failed", err)
+	}
+	if !banned {
+		return false, nil
+	}
+	return true, s.ban(ctx, info, entry)
+}
+
+// ban quarantines an upload matching a ban list entry and emits an alert
+func (s *Server) ban(ctx context.Context, info tusd.FileInfo, entry banlist.Entry) error {
+	slog.Warn("Upload matches the content ban list", "id", info.ID, "digest", entry.Digest, "reason", entry.Reason)
+
+	now := time.Now()
+	if _, err := s.AnnotateUpload(ctx, info.ID, BanListAnnotation, banAnnotation{Entry: entry, MatchedAt: now}); err != nil {
+		slog.Error("Failed to record ban list match", "id", info.ID, "error", err)
+	}
+
+	reason := "banned content"
+	if entry.Reason != "" {
+		reason += ": " + entry.Reason
+	}
+	record, err := s.transition(ctx, info, uploadstate.Quarantined, reason)
+	if err != nil {
+		return err
+	}
+
+	s.events.Notify(ctx, events.Event{
+		Type:        events.UploadBanned,
+		Upload:      info,
+		State:       string(record.State),
+		Annotations: record.Annotations,
+		Time:        now,
+	})
+	return nil
+}
+
+// deliverBanAlert posts a ban to the configured alert URL
+func (s *Server) deliverBanAlert(ctx context.Context, event events.Event) error {
+	var match banAnnotation
+	if data, ok := event.Annotations[BanListAnnotation]; ok {
+		if err := json.Unmarshal(data, &match); err != nil {
+			return fmt.Errorf("failed to decode ban list match: %w", err)
+		}
+	}
+
+	alert := eventschema.BanAlert{
+		SchemaVersion: eventschema.Version,
+		Event:         string(event.Type),
+		UploadID:      event.Upload.ID,
+		Size:          event.Upload.Size,
+		MetaData:      event.Upload.MetaData,
+		Digest:        match.Digest,
+		Reason:        match.Reason,
+		Source:        match.Source,
+		DetectedAt:    event.Time,
+	}
+	if err := s.alerts.Post(ctx, s.cfg.BanList.AlertURL, alert); err != nil {
+		return fmt.Errorf("failed to deliver ban alert for upload %s: %w", event.Upload.ID, err)
+	}
+	return nil
+}
+
+// knownDigest returns the digest of an upload without reading it, which is
+// known for content-addressed uploads and uploads the ban list check ran
+// on, or an empty string
+func (s *Server) knownDigest(ctx context.Context, id string, record uploadstate.Record) string {
+	if digest := s.contentDigest(ctx, id); digest != "" {
+		return digest
+	}
+	var digest string
+	if data, ok := record.Annotations[DigestAnnotation]; ok {
+		if err := json.Unmarshal(data, &digest); err != nil {
+			slog.Warn("Failed to decode upload digest", "id", id, "error", err)
+		}
+	}
+	return digest
+}
+
+// uploadDigest returns the SHA-256 digest of a finished upload, which is
+// known already for content-addressed uploads
+func (s *Server) uploadDigest(ctx context.Context, id string) (string, error) {
+	if tenant, ok := storage.TenantFromKey(id); ok {
+		ctx = storage.WithTenant(ctx, tenant)
+	}
+	ref, ok, err := s.contentReference(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		return ref.Digest, nil
+	}
+	return storage.Checksum(ctx, s.store, id)
+}
+
+// listBans returns the ban list
+func (s *Server) listBans(c *gin.Context) {
+	entries, err := s.bans.Entries(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": entries})
+}
+
+// addBan bans a digest. Uploads completing afterwards are checked against
+// it; earlier uploads are not.
+func (s *Server) addBan(c *gin.Context) {
+	var req banRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entry, err := s.bans.Add(c.Request.Context(), req.Digest, req.Reason)
+	if err != nil {
+		c.JSON(banErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	slog.Info("Digest added to the ban list", "digest", entry.Digest, "reason", entry.Reason)
+	c.JSON(http.StatusCreated, entry)
+}
+
+// removeBan lifts the ban of a digest
+func (s *Server) removeBan(c *gin.Context) {
+	if err := s.bans.Remove(c.Request.Context(), c.Param("digest")); err != nil {
+		c.JSON(banErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	slog.Info("Digest removed from the ban list", "digest", c.Param("digest"))
+	c.Status(http.StatusNoContent)
+}
+
+// banErrorStatus maps ban list errors to HTTP status codes
+func banErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, banlist.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, banlist.ErrInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, banlist.ErrReadOnly):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// newBanList creates the content ban list, or returns nil if it is disabled
+func newBanList(cfg config.BanListConfig) (*banlist.List, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	var file []banlist.Entry
+	if cfg.File != "" {
+		entries, err := banlist.LoadFile(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		file = entries
+	}
+
+	if cfg.Dir == "" {
+		return banlist.New(banlist.NewMemoryStore(), file), nil
+	}
+	store, err := banlist.NewFileStore(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ban list store: %w", err)
+	}
+	return banlist.New(store, file), nil
+}
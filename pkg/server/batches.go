@@ -0,0 +1,355 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+	"github.com/devsnb/large-file-uploads/pkg/batch"
+	"github.com/devsnb/large-file-uploads/pkg/callback"
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/events"
+	"github.com/devsnb/large-file-uploads/pkg/rejection"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// BatchMetadataKey names the batch an upload joins. The manifest of a
+// complete batch carries it too.
+const BatchMetadataKey = "batch"
+
+// batchManifestMetadataKey marks the upload holding a batch manifest
+const batchManifestMetadataKey = "batch_manifest"
+
+// batchRequest is the body of a batch
+type batchRequest struct {
+	Name      string `json:"name"`
+	Expected  int    `json:"expected"`
+	NotifyURL string `json:"notifyUrl"`
+}
+
+// OnBatchComplete subscribes to batches whose uploads have all completed.
+// The event's Upload is the manifest of the batch. Batch subscribers are
+// always invoked asynchronously.
+func (s *Server) OnBatchComplete(handler events.Handler, opts ...events.SubscribeOption) {
+	opts = append(opts, events.WithMode(events.Async))
+	s.events.Subscribe(events.BatchCompleted, handler, opts...)
+}
+
+// checkBatch adds a new upload to the batch it names. Uploads that joined
+// must leave again if the creation fails afterwards.
+func (s *Server) checkBatch(hook tusd.HookEvent, id string) (joined bool, err error) {
+	batchID := hook.Upload.MetaData[BatchMetadataKey]
+	if s.batches == nil || batchID == "" || hook.Upload.IsPartial {
+		return false, nil
+	}
+
+	_, err = s.authorizeBatch(hook.Context, batchID)
+	if err == nil {
+		_, err = s.batches.Join(hook.Context, batchID, id)
+	}
+
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, batch.ErrNotFound):
+		return false, rejection.New(http.StatusBadRequest, rejection.CodeUnknownBatch,
+			fmt.Sprintf("batch %q does not exist", batchID))
+	case errors.Is(err, batch.ErrClosed), errors.Is(err, batch.ErrFull):
+		return false, rejection.New(http.StatusConflict, rejection.CodeBatchClosed,
+			fmt.Sprintf("batch %q does not accept more uploads: %v", batchID, err))
+	default:
+		slog.Error("Failed to add upload to batch", "batch", batchID, "error", err)
+		return false, rejection.New(http.StatusInternalServerError, rejection.CodeUploadRejected,
+			"failed to add upload to batch")
+	}
+}
+
+// renameBatchMember records a created upload in its batch under its final
+// ID. The batch was joined before creation, with the ID s3store completes
+// with the multipart upload ID.
+func (s *Server) renameBatchMember(ctx context.Context, info tusd.FileInfo) {
+	batchID := info.MetaData[BatchMetadataKey]
+	joinedID := storage.ObjectKey(info.ID)
+	if batchID == "" || info.IsPartial || joinedID == info.ID || info.MetaData[batchManifestMetadataKey] != "" {
+		return
+	}
+	if err := s.batches.Rename(ctx, batchID, joinedID, info.ID); err != nil {
+		slog.Error("Failed to record upload in batch", "batch", batchID, "id", info.ID, "error", err)
+	}
+}
+
+// completeBatchMember records a finished upload and completes its batch if
+// it was the last one
+func (s *Server) completeBatchMember(ctx context.Context, event events.Event) error {
+	batchID := event.Upload.MetaData[BatchMetadataKey]
+	if batchID == "" || event.Upload.MetaData[batchManifestMetadataKey] != "" {
+		return nil
+	}
+
+	b, finished, err := s.batches.Complete(ctx, batchID, event.Upload.ID)
+	if err != nil {
+		return fmt.Errorf("failed to record upload %s in batch %s: %w", event.Upload.ID, batchID, err)
+	}
+	if finished {
+		return s.finishBatch(ctx, b)
+	}
+	return nil
+}
+
+// leaveBatch removes a terminated upload from its batch, which completes
+// if the upload was the last one in progress
+func (s *Server) leaveBatch(ctx context.Context, event events.Event) error {
+	batchID := event.Upload.MetaData[BatchMetadataKey]
+	if batchID == "" || event.Upload.MetaData[batchManifestMetadataKey] != "" {
+		return nil
+	}
+
+	b, finished, err := s.batches.Leave(ctx, batchID, event.Upload.ID)
+	if err != nil && !errors.Is(err, batch.ErrNotFound) {
+		return fmt.Errorf("failed to remove upload %s from batch %s: %w", event.Upload.ID, batchID, err)
+	}
+	if finished {
+		return s.finishBatch(ctx, b)
+	}
+	return nil
+}
+
+// finishBatch stores the manifest of a batch whose uploads all finished
+// and emits the batch completion event. If the manifest can't be written,
+// closing the batch again retries it.
+func (s *Server) finishBatch(ctx context.Context, b batch.Batch) error {
+	info, err := s.writeBatchManifest(ctx, b)
+	if err != nil {
+		s.batches.Abandon(b.ID)
+		return fmt.Errorf("failed to write manifest of batch %s: %w", b.ID, err)
+	}
+
+	b, err = s.batches.Finish(ctx, b.ID, info.ID)
+	if err != nil {
+		return fmt.Errorf("failed to complete batch %s: %w", b.ID, err)
+	}
+
+	slog.Info("Batch complete", "batch", b.ID, "uploads", len(b.Uploads), "manifest", info.ID)
+	s.events.Notify(ctx, events.Event{
+		Type:   events.BatchCompleted,
+		Upload: info,
+		Batch:  b.ID,
+		Time:   *b.CompletedAt,
+	})
+	return nil
+}
+
+// writeBatchManifest stores the manifest of a batch as an upload owned by
+// the batch owner
+func (s *Server) writeBatchManifest(ctx context.Context, b batch.Batch) (tusd.FileInfo, error) {
+	manifest := batch.Manifest{
+		BatchID:     b.ID,
+		Name:        b.Name,
+		Owner:       b.Owner,
+		CreatedAt:   b.CreatedAt,
+		CompletedAt: time.Now().UTC(),
+		Files:       make([]batch.File, 0, len(b.Uploads)),
+	}
+	for _, m := range b.Uploads {
+		info, err := s.uploadInfo(ctx, m.UploadID)
+		if err != nil {
+			return tusd.FileInfo{}, fmt.Errorf("failed to load upload %s: %w", m.UploadID, err)
+		}
+		manifest.Files = append(manifest.Files, batch.File{
+			UploadID:    info.ID,
+			Size:        info.Size,
+			MetaData:    info.MetaData,
+			Storage:     info.Storage,
+			CompletedAt: *m.CompletedAt,
+		})
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return tusd.FileInfo{}, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	var tenant string
+	if tenantScoped(s.store) || s.cfg.UploadIDs.TenantPrefix {
+		tenant = b.Tenant
+	}
+	id, err := s.newUploadID(tenant, "")
+	if err != nil {
+		return tusd.FileInfo{}, err
+	}
+
+	info := tusd.FileInfo{
+		ID:   id,
+		Size: int64(len(data)),
+		MetaData: tusd.MetaData{
+			"filename":               "batch-" + b.ID + ".json",
+			"filetype":               "application/json",
+			BatchMetadataKey:         b.ID,
+			batchManifestMetadataKey: "true",
+		},
+	}
+	if b.Owner != "" {
+		info.MetaData[auth.OwnerMetadataKey] = b.Owner
+	}
+	if b.NotifyURL != "" {
+		info.MetaData[callback.MetadataKey] = b.NotifyURL
+	}
+
+	upload, err := s.composer.Core.NewUpload(ctx, info)
+	if err != nil {
+		return tusd.FileInfo{}, err
+	}
+	if _, err := upload.WriteChunk(ctx, 0, bytes.NewReader(data)); err != nil {
+		return tusd.FileInfo{}, err
+	}
+	if err := upload.FinishUpload(ctx); err != nil {
+		return tusd.FileInfo{}, err
+	}
+	return upload.GetInfo(ctx)
+}
+
+// listBatches lists the caller's batches
+func (s *Server) listBatches(c *gin.Context) {
+	ctx := c.Request.Context()
+	owner, all := s.catalogScope(ctx)
+
+	batches, err := s.batches.List(ctx, owner, all)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"batches": batches})
+}
+
+// createBatch opens a batch uploads can join
+func (s *Server) createBatch(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req batchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.NotifyURL != "" {
+		if s.callbacks == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "notifyUrl requires callbacks to be enabled"})
+			return
+		}
+		if err := s.callbacks.CheckURL(req.NotifyURL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	owner, _ := s.catalogScope(ctx)
+	var tenant string
+	if user, err := auth.GetUserFromContext(ctx); err == nil {
+		tenant = user.Tenant
+	}
+
+	b, err := s.batches.Open(ctx, batch.Batch{
+		Name:      req.Name,
+		Owner:     owner,
+		Tenant:    tenant,
+		Expected:  req.Expected,
+		NotifyURL: req.NotifyURL,
+	})
+	if err != nil {
+		c.JSON(batchErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	slog.Info("Batch opened", "batch", b.ID, "owner", owner, "expected", b.Expected)
+	c.JSON(http.StatusCreated, b)
+}
+
+// getBatch returns a batch and the progress of its uploads
+func (s *Server) getBatch(c *gin.Context) {
+	b, err := s.authorizeBatch(c.Request.Context(), c.Param("bid"))
+	if err != nil {
+		c.JSON(batchErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, b)
+}
+
+// closeBatch stops further uploads from joining a batch. The batch
+// completes once its uploads in progress finish.
+func (s *Server) closeBatch(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	b, err := s.authorizeBatch(ctx, c.Param("bid"))
+	if err != nil {
+		c.JSON(batchErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	b, finished, err := s.batches.Close(ctx, b.ID)
+	if err != nil {
+		c.JSON(batchErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if finished {
+		if err := s.finishBatch(ctx, b); err != nil {
+			slog.Error("Failed to complete batch", "batch", b.ID, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if b, err = s.batches.Get(ctx, b.ID); err != nil {
+			c.JSON(batchErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, b)
+}
+
+// authorizeBatch returns a batch of the caller
+func (s *Server) authorizeBatch(ctx context.Context, id string) (batch.Batch, error) {
+	b, err := s.batches.Get(ctx, id)
+	if err != nil {
+		return batch.Batch{}, err
+	}
+
+	owner, all := s.catalogScope(ctx)
+	if !all && b.Owner != owner {
+		// Don't reveal batches of other users
+		return batch.Batch{}, batch.ErrNotFound
+	}
+	return b, nil
+}
+
+// batchErrorStatus maps batch errors to HTTP status codes
+func batchErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, batch.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, batch.ErrInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, batch.ErrClosed), errors.Is(err, batch.ErrFull):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// newBatchStore creates the store for batches
+func newBatchStore(cfg config.BatchConfig) (batch.Store, error) {
+	if cfg.Dir == "" {
+		return batch.NewMemoryStore(), nil
+	}
+
+	store, err := batch.NewFileStore(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create batch store: %w", err)
+	}
+	return store, nil
+}
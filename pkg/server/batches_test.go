@@ -0,0 +1,49 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/devsnb/large-file-uploads/pkg/batch"
+	"github.com/devsnb/large-file-uploads/pkg/config"
+)
+
+func TestBatchWithMultipartIDs(t *testing.T) {
+	_, ts := newTestServerOn(t, newMultipartIDs(t), func(cfg *config.Config) {
+		cfg.Batches.Enabled = true
+	})
+	resp, body := request(t, http.MethodPost, ts.URL+"/api/batches", map[string]string{"Content-Type": "application/json"}, `{"expected": 1}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("opening a batch: %d %s", resp.StatusCode, body)
+	}
+	var b batch.Batch
+	if err := json.Unmarshal([]byte(body), &b); err != nil {
+		t.Fatal(err)
+	}
+
+	id := upload(t, ts, "hello", map[string]string{
+		"Upload-Metadata": BatchMetadataKey + " " + base64.StdEncoding.EncodeToString([]byte(b.ID)),
+	})
+
+	// The batch completes in the background
+	deadline := time.Now().Add(5 * time.Second)
+	for b.Status != batch.StatusComplete {
+		if time.Now().After(deadline) {
+			t.Fatalf("batch didn't complete: %+v", b)
+		}
+		time.Sleep(10 * time.Millisecond)
+		resp, body := request(t, http.MethodGet, ts.URL+"/api/batches/"+b.ID, nil, "")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("getting the batch: %d %s", resp.StatusCode, body)
+		}
+		if err := json.Unmarshal([]byte(body), &b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(b.Uploads) != 1 || b.Uploads[0].UploadID != id {
+		t.Fatalf("expected upload %s in the batch, got %+v", id, b.Uploads)
+	}
+}
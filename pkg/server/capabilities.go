@@ -0,0 +1,52 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// adaptToCapabilities turns off the features the probed capabilities of
+// the storage rule out, and keeps the capabilities for the operator API
+// with a warning for each feature turned off
+func (s *Server) adaptToCapabilities(store storage.Storage) {
+	reporter, ok := storage.Lookup[storage.CapabilityReporter](store)
+	if !ok {
+		return
+	}
+	caps := reporter.Capabilities()
+	caps.Warnings = slices.Clone(caps.Warnings)
+
+	var disabled []string
+	if caps.ObjectLock == storage.CapabilityEnabled {
+		if s.tiering != nil {
+			// Transitions rewrite objects in place, and the locked versions
+			// keep their storage class and space
+			s.tierer, s.tiering = nil, nil
+			disabled = append(disabled, "Object lock keeps the versions tiering would rewrite, tiering is disabled")
+		}
+		if s.deletions != nil && caps.Retention != "" {
+			// Deleted uploads stay restorable from their retained versions
+			s.deletions = nil
+			disabled = append(disabled, fmt.Sprintf("Object lock retains deleted uploads for %s, the termination grace period is disabled", caps.Retention))
+		}
+	}
+	for _, warning := range disabled {
+		slog.Warn(warning)
+	}
+	caps.Warnings = append(caps.Warnings, disabled...)
+	s.capabilities = &caps
+}
+
+// getCapabilities returns the probed capabilities of the storage backend
+func (s *Server) getCapabilities(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"provider":     s.store.GetProvider(),
+		"capabilities": s.capabilities,
+	})
+}
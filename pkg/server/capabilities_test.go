@@ -0,0 +1,51 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// lockedStorage is in-memory storage that reports object lock with a
+// default retention
+type lockedStorage struct {
+	*storage.MemoryStorage
+}
+
+func (lockedStorage) Capabilities() storage.Capabilities {
+	return storage.Capabilities{ObjectLock: storage.CapabilityEnabled, Retention: "30 days in compliance mode"}
+}
+
+func TestObjectLockDisablesGracePeriod(t *testing.T) {
+	srv, ts := newTestServerOn(t, lockedStorage{newMemoryStorage(t)}, func(cfg *config.Config) {
+		cfg.Termination.Enabled = true
+		cfg.Termination.GracePeriod = 3600
+		cfg.Admin.Enabled = true
+		cfg.Admin.Token = "admin-token"
+	})
+	if srv.deletions != nil {
+		t.Fatal("expected the grace period to be disabled with object lock retention")
+	}
+
+	resp, body := request(t, http.MethodGet, ts.URL+"/admin/storage/capabilities",
+		map[string]string{"Authorization": "Bearer admin-token"}, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.StatusCode, body)
+	}
+	var result struct {
+		Capabilities storage.Capabilities `json:"capabilities"`
+	}
+	if err := json.Unmarshal([]byte(body), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Capabilities.ObjectLock != storage.CapabilityEnabled {
+		t.Fatalf("expected object lock to be reported, got %+v", result.Capabilities)
+	}
+	if len(result.Capabilities.Warnings) != 1 || !strings.Contains(result.Capabilities.Warnings[0], "grace period is disabled") {
+		t.Fatalf("expected a warning for the disabled grace period, got %v", result.Capabilities.Warnings)
+	}
+}
@@ -0,0 +1,290 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+	"github.com/devsnb/large-file-uploads/pkg/catalog"
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/events"
+)
+
+// tagsRequest is the body of a tag update
+type tagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// collectionRequest is the body of a collection creation
+type collectionRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// catalogScope returns the owner whose uploads and collections the caller
+// may see, and whether they may see those of all owners
+func (s *Server) catalogScope(ctx context.Context) (string, bool) {
+	if !s.cfg.Auth.Enabled {
+		return "", true
+	}
+	user, err := auth.GetUserFromContext(ctx)
+	if err != nil {
+		return "", false
+	}
+	return user.ID, user.Role == "admin"
+}
+
+// registerUpload adds a created upload to the catalog
+func (s *Server) registerUpload(ctx context.Context, e events.Event) error {
+	return s.catalog.Register(ctx, e.Upload.ID, e.Upload.MetaData[auth.OwnerMetadataKey], e.Upload.MetaData["filename"])
+}
+
+// forgetUpload removes a terminated upload from the catalog
+func (s *Server) forgetUpload(ctx context.Context, e events.Event) error {
+	return s.catalog.Forget(ctx, e.Upload.ID)
+}
+
+// catalogEntry authorizes access to an upload and returns its catalog
+// entry, registering uploads created before they were cataloged
+func (s *Server) catalogEntry(ctx context.Context, action auth.Action, id string) (catalog.Entry, error) {
+	if err := s.authorize(ctx, action, id); err != nil {
+		return catalog.Entry{}, err
+	}
+
+	entry, err := s.catalog.Entry(ctx, id)
+	if !errors.Is(err, catalog.ErrNotFound) {
+		return entry, err
+	}
+
+	info, err := s.uploadInfo(ctx, id)
+	if err != nil {
+		return catalog.Entry{}, err
+	}
+	if err := s.catalog.Register(ctx, id, info.MetaData[auth.OwnerMetadataKey], info.MetaData["filename"]); err != nil {
+		return catalog.Entry{}, err
+	}
+	return s.catalog.Entry(ctx, id)
+}
+
+// authorizeCollection returns a collection the caller owns
+func (s *Server) authorizeCollection(ctx context.Context, id string) (catalog.Collection, error) {
+	collection, err := s.catalog.Collection(ctx, id)
+	if err != nil {
+		return catalog.Collection{}, err
+	}
+
+	owner, all := s.catalogScope(ctx)
+	if !all && collection.Owner != owner {
+		// Don't reveal collections of other users
+		return catalog.Collection{}, catalog.ErrCollectionMissing
+	}
+	return collection, nil
+}
+
+// listUploads lists the caller's uploads, optionally filtered by tags and
+// collection
+func (s *Server) listUploads(c *gin.Context) {
+	ctx := c.Request.Context()
+	owner, all := s.catalogScope(ctx)
+
+	filter := catalog.Filter{
+		Owner:      owner,
+		AllOwners:  all,
+		Tags:       c.QueryArray("tag"),
+		Collection: c.Query("collection"),
+	}
+	if filter.Collection != "" {
+		if _, err := s.authorizeCollection(ctx, filter.Collection); err != nil {
+			c.JSON(catalogErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	entries, err := s.catalog.List(ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"uploads": entries})
+}
+
+// getUploadTags returns the tags and collections of an upload
+func (s *Server) getUploadTags(c *gin.Context) {
+	entry, err := s.catalogEntry(c.Request.Context(), auth.ActionRead, c.Param("id"))
+	if err != nil {
+		c.JSON(catalogErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+// setUploadTags replaces the tags of an upload
+func (s *Server) setUploadTags(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	var req tagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entry, err := s.catalogEntry(ctx, auth.ActionUpdate, id)
+	if err != nil {
+		c.JSON(catalogErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	entry, err = s.catalog.SetTags(ctx, id, entry.Owner, req.Tags)
+	if err != nil {
+		c.JSON(catalogErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+// createCollection creates a collection owned by the caller
+func (s *Server) createCollection(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req collectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	owner, _ := s.catalogScope(ctx)
+	collection, err := s.catalog.CreateCollection(ctx, owner, req.Name)
+	if err != nil {
+		c.JSON(catalogErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, collection)
+}
+
+// listCollections lists the caller's collections
+func (s *Server) listCollections(c *gin.Context) {
+	ctx := c.Request.Context()
+	owner, all := s.catalogScope(ctx)
+
+	collections, err := s.catalog.Collections(ctx, owner, all)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"collections": collections})
+}
+
+// getCollection returns a collection and its uploads
+func (s *Server) getCollection(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	collection, err := s.authorizeCollection(ctx, c.Param("cid"))
+	if err != nil {
+		c.JSON(catalogErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	entries, err := s.catalog.List(ctx, catalog.Filter{AllOwners: true, Collection: collection.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"collection": collection, "uploads": entries})
+}
+
+// deleteCollection deletes a collection, keeping its uploads
+func (s *Server) deleteCollection(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	collection, err := s.authorizeCollection(ctx, c.Param("cid"))
+	if err != nil {
+		c.JSON(catalogErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.catalog.DeleteCollection(ctx, collection.ID); err != nil {
+		c.JSON(catalogErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// addToCollection adds an upload to a collection
+func (s *Server) addToCollection(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	collection, err := s.authorizeCollection(ctx, c.Param("cid"))
+	if err != nil {
+		c.JSON(catalogErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	entry, err := s.catalogEntry(ctx, auth.ActionUpdate, c.Param("id"))
+	if err != nil {
+		c.JSON(catalogErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	entry, err = s.catalog.AddToCollection(ctx, collection.ID, entry.UploadID, entry.Owner)
+	if err != nil {
+		c.JSON(catalogErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+// removeFromCollection removes an upload from a collection
+func (s *Server) removeFromCollection(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	collection, err := s.authorizeCollection(ctx, c.Param("cid"))
+	if err != nil {
+		c.JSON(catalogErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	entry, err := s.catalogEntry(ctx, auth.ActionUpdate, c.Param("id"))
+	if err != nil {
+		c.JSON(catalogErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := s.catalog.RemoveFromCollection(ctx, collection.ID, entry.UploadID); err != nil {
+		c.JSON(catalogErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// catalogErrorStatus maps catalog and upload errors to HTTP status codes
+func catalogErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, catalog.ErrNotFound), errors.Is(err, catalog.ErrCollectionMissing):
+		return http.StatusNotFound
+	case errors.Is(err, catalog.ErrInvalidTag), errors.Is(err, catalog.ErrTooManyTags),
+		errors.Is(err, catalog.ErrInvalidName):
+		return http.StatusBadRequest
+	case errors.Is(err, catalog.ErrDuplicateName):
+		return http.StatusConflict
+	default:
+		return uploadErrorStatus(err)
+	}
+}
+
+// newCatalogStore creates a file-backed catalog store when a directory is
+// configured and an in-memory one otherwise
+func newCatalogStore(cfg config.CatalogConfig) (catalog.Store, error) {
+	if cfg.Dir == "" {
+		return catalog.NewMemoryStore(), nil
+	}
+
+	store, err := catalog.NewFileStore(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create catalog store: %w", err)
+	}
+	return store, nil
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/cdn"
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// CacheControlMetadataKey is the metadata field clients may request a
+// Cache-Control header for CDN downloads with
+const CacheControlMetadataKey = "cache_control"
+
+// cacheControlPattern restricts client supplied Cache-Control values to
+// plain directives, so they can't inject other headers
+var cacheControlPattern = regexp.MustCompile(`^[A-Za-z0-9 ,=_-]{1,256}$`)
+
+// newCDNSigner creates the signer for the configured CDN, or nil if CDN URLs
+// are disabled
+func newCDNSigner(cfg config.CDNConfig, store storage.Storage) (cdn.Signer, error) {
+	if cfg.Provider == "" {
+		return nil, nil
+	}
+	// The CDN origin is the configured bucket or container
+	if routed, ok := store.(storage.BucketRouted); ok && routed.RoutesBuckets() {
+		return nil, fmt.Errorf("CDN URLs can't be combined with a bucket or container template: %w", cdn.ErrInvalidConfig)
+	}
+
+	switch cfg.Provider {
+	case cdn.CloudFront:
+		key, err := os.ReadFile(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CloudFront private key: %w", err)
+		}
+		return cdn.NewCloudFront(cfg.BaseURL, cfg.KeyPairID, key)
+	case cdn.Azure:
+		sas, ok := storage.Lookup[storage.SASSigner](store)
+		if !ok {
+			return nil, fmt.Errorf("azure CDN URLs require azure storage, not %s: %w", store.GetProvider(), cdn.ErrInvalidConfig)
+		}
+		return cdn.NewAzure(cfg.BaseURL, sas)
+	default:
+		return nil, fmt.Errorf("unsupported CDN provider %q: %w", cfg.Provider, cdn.ErrInvalidConfig)
+	}
+}
+
+// cacheControl returns the Cache-Control header for CDN downloads of an
+// upload: the client's choice if allowed, otherwise the first rule matching
+// its type, otherwise the default
+func (s *Server) cacheControl(info tusd.FileInfo) string {
+	cfg := s.cfg.CDN.CacheControl
+
+	if requested := info.MetaData[CacheControlMetadataKey]; requested != "" && cfg.AllowClientOverride {
+		if cacheControlPattern.MatchString(requested) {
+			return requested
+		}
+		slog.Debug("Ignoring invalid Cache-Control metadata", "id", info.ID, "value", requested)
+	}
+
+	fileType := uploadFileType(info)
+	for _, rule := range cfg.Rules {
+		if typeAllowed(fileType, rule.Types) {
+			return rule.Value
+		}
+	}
+	return cfg.Default
+}
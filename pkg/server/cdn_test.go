@@ -0,0 +1,28 @@
+package server
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/devsnb/large-file-uploads/pkg/cdn"
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// routedStorage is in-memory storage that reports a bucket template
+type routedStorage struct {
+	*storage.MemoryStorage
+}
+
+func (routedStorage) RoutesBuckets() bool {
+	return true
+}
+
+func TestCDNRefusesBucketTemplates(t *testing.T) {
+	t.Chdir(t.TempDir())
+	cfg := &config.Config{}
+	cfg.CDN.Provider = cdn.CloudFront
+	if _, err := New(cfg, routedStorage{newMemoryStorage(t)}); !errors.Is(err, cdn.ErrInvalidConfig) {
+		t.Fatalf("expected CDN URLs with a bucket template to be refused, got %v", err)
+	}
+}
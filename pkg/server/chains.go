@@ -0,0 +1,247 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware chains embedders can add middleware to
+const (
+	GlobalChain = "global"  // Runs for every request
+	UploadChain = "uploads" // Runs for tus requests under /files
+)
+
+// namedMiddleware is a middleware with the name chains are ordered by
+type namedMiddleware struct {
+	name    string
+	handler gin.HandlerFunc // nil when the middleware is disabled
+}
+
+// Position places a middleware added by an embedder relative to another
+// middleware of its chain
+type Position struct {
+	before string
+	after  string
+}
+
+// Before places a middleware right before the named one
+func Before(name string) Position {
+	return Position{before: name}
+}
+
+// After places a middleware right after the named one
+func After(name string) Position {
+	return Position{after: name}
+}
+
+// customMiddleware is a middleware added by an embedder
+type customMiddleware struct {
+	namedMiddleware
+	position Position
+}
+
+// UseMiddleware adds a middleware to a chain at the given position, or at
+// its end for the zero Position. Names of added middleware can be used in
+// the positions of middleware added later. It must be called before the
+// server starts handling requests.
+func (s *Server) UseMiddleware(chain, name string, handler gin.HandlerFunc, position Position) error {
+	if chain != GlobalChain && chain != UploadChain {
+		return fmt.Errorf("unknown middleware chain %q, expected %q or %q", chain, GlobalChain, UploadChain)
+	}
+	if name == "" || handler == nil {
+		return fmt.Errorf("middleware requires a name and a handler")
+	}
+
+	if s.custom == nil {
+		s.custom = make(map[string][]customMiddleware)
+	}
+	previous := s.custom[chain]
+	s.custom[chain] = append(slices.Clone(previous), customMiddleware{namedMiddleware{name, handler}, position})
+
+	router, err := s.setupRouter()
+	if err != nil {
+		s.custom[chain] = previous
+		return err
+	}
+	s.router = router
+	return nil
+}
+
+// globalMiddleware returns the built-in middleware running for every
+// request, in their default order
+func (s *Server) globalMiddleware() []namedMiddleware {
+	chain := []namedMiddleware{
+		// Log requests and their responses
+		{"logging", requestLoggerMiddleware(s.cfg.Logging, s.clientIP)},
+		// Recover from panics, logging them with the upload and user
+		{"recovery", s.recoveryMiddleware()},
+		// Count the bytes each tenant and user transfer when enabled
+		{"traffic", nil},
+		// Add security and custom response headers
+		{"headers", headersMiddleware(s.cfg.Headers)},
+		// Configure CORS for the API and tus endpoints
+		{"cors", s.cors},
+	}
+	if s.traffic != nil {
+		chain[slices.IndexFunc(chain, func(m namedMiddleware) bool { return m.name == "traffic" })].handler = s.trafficMiddleware()
+	}
+	return chain
+}
+
+// uploadMiddleware returns the built-in middleware of tus requests, in their
+// default order
+func (s *Server) uploadMiddleware() []namedMiddleware {
+	chain := []namedMiddleware{
+		// Measure upload request latency, including rejected requests
+		{"metrics", nil},
+		// Require signed upload URLs when enabled
+		{"signedUrls", nil},
+		// Authenticate upload requests when enabled
+		{"auth", s.uploadAuthMiddleware()},
+		// Consult the authorizer plugged in by the embedding application
+		{"authorizer", s.authorizerMiddleware()},
+		// Keep terminated uploads for the grace period when configured
+		{"deletionGrace", nil},
+		// Refuse downloads of uploads that aren't ready
+		{"downloadGate", s.downloadGateMiddleware()},
+		// Measure how uploads progress to completion by tenant and size class
+		{"lifecycleMetrics", nil},
+		// Throttle clients and limit concurrent chunks when configured
+		{"rateLimit", nil},
+		// Replay creation responses for retried requests when enabled
+		{"idempotency", nil},
+		// Track chunk retries and errors when enabled
+		{"diagnostics", nil},
+		// Measure the load upload hints are scaled by
+		{"load", nil},
+		// Hold back chunks of queued uploads until their scheduled time
+		{"schedule", nil},
+		// Advise clients a chunk size from their measured throughput, after
+		// the scheduler so time chunks are held back isn't counted
+		{"chunkAdvice", nil},
+		// Fill in unchanged ranges of delta uploads from their previous upload
+		{"delta", nil},
+		// Journal chunk acknowledgements before they are sent
+		{"journal", nil},
+		// Verify chunks against their checksum header or trailer
+		{"checksums", nil},
+		// Count downloads for the status API
+		{"downloadTracking", s.downloadTrackingMiddleware()},
+		// Serve uploads without a declared type with their detected type
+		{"contentType", nil},
+		// Stamp downloaded PDFs and images with the user they are served to
+		{"stamps", nil},
+		// Serve content-addressed uploads from their content key
+		{"contentDownload", nil},
+	}
+
+	enable := func(name string, handler func() gin.HandlerFunc) {
+		i := slices.IndexFunc(chain, func(m namedMiddleware) bool { return m.name == name })
+		chain[i].handler = handler()
+	}
+	if s.cfg.Metrics.Enabled {
+		enable("metrics", s.requestMetricsMiddleware)
+		enable("lifecycleMetrics", s.lifecycleMetricsMiddleware)
+	}
+	if s.cfg.SignedURLs.Enabled {
+		enable("signedUrls", s.signedURLMiddleware)
+	}
+	if s.deletions != nil {
+		enable("deletionGrace", s.deletionGraceMiddleware)
+	}
+	if s.limiter != nil || s.concurrency != nil {
+		enable("rateLimit", s.rateLimitMiddleware)
+	}
+	if s.idempotency != nil {
+		enable("idempotency", func() gin.HandlerFunc { return s.idempotencyMiddleware(s.abortTus) })
+	}
+	if s.diagnostics != nil {
+		enable("diagnostics", s.diagnosticsMiddleware)
+	}
+	if s.cfg.UploadHints.Capacity > 0 {
+		enable("load", s.loadMiddleware)
+	}
+	if s.chunkAdvice != nil {
+		enable("chunkAdvice", s.chunkAdviceMiddleware)
+	}
+	if (s.schedule != nil && s.schedule.Queues()) || s.reservations != nil {
+		enable("schedule", s.scheduleMiddleware)
+	}
+	if s.deltas != nil {
+		enable("delta", s.deltaMiddleware)
+	}
+	if s.journal != nil {
+		enable("journal", s.journalMiddleware)
+	}
+	if s.cfg.Checksums.Enabled {
+		enable("checksums", s.checksumMiddleware)
+	}
+	if s.cfg.ContentTypes.Detect {
+		enable("contentType", s.contentTypeMiddleware)
+	}
+	if s.stamps != nil {
+		enable("stamps", s.stampMiddleware)
+	}
+	if s.contents != nil {
+		enable("contentDownload", s.contentDownloadMiddleware)
+	}
+	return chain
+}
+
+// buildChain orders the built-in middleware of a chain as configured and
+// places the middleware added by embedders. A configured order is partial:
+// built-in middleware it doesn't name, such as middleware added in a later
+// release, keep their default place right after the built-in middleware
+// they follow by default.
+func buildChain(chain string, builtin []namedMiddleware, order []string, custom []customMiddleware) ([]gin.HandlerFunc, error) {
+	ordered := make([]namedMiddleware, 0, len(builtin))
+	for _, name := range order {
+		i := slices.IndexFunc(builtin, func(m namedMiddleware) bool { return m.name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown middleware %q in the %s chain", name, chain)
+		}
+		if slices.ContainsFunc(ordered, func(m namedMiddleware) bool { return m.name == name }) {
+			return nil, fmt.Errorf("middleware %q is listed twice in the %s chain", name, chain)
+		}
+		ordered = append(ordered, builtin[i])
+	}
+	for k, m := range builtin {
+		if slices.Contains(order, m.name) {
+			continue
+		}
+		// Middleware before it in the default order are placed already
+		i := 0
+		if k > 0 {
+			i = slices.IndexFunc(ordered, func(o namedMiddleware) bool { return o.name == builtin[k-1].name }) + 1
+		}
+		ordered = slices.Insert(ordered, i, m)
+	}
+
+	for _, m := range custom {
+		if slices.ContainsFunc(ordered, func(o namedMiddleware) bool { return o.name == m.name }) {
+			return nil, fmt.Errorf("middleware %q already exists in the %s chain", m.name, chain)
+		}
+
+		i := len(ordered)
+		if anchor := m.position.before + m.position.after; anchor != "" {
+			i = slices.IndexFunc(ordered, func(o namedMiddleware) bool { return o.name == anchor })
+			if i < 0 {
+				return nil, fmt.Errorf("middleware %q can't be placed relative to unknown middleware %q", m.name, anchor)
+			}
+			if m.position.after != "" {
+				i++
+			}
+		}
+		ordered = slices.Insert(ordered, i, m.namedMiddleware)
+	}
+
+	handlers := make([]gin.HandlerFunc, 0, len(ordered))
+	for _, m := range ordered {
+		if m.handler != nil {
+			handlers = append(handlers, m.handler)
+		}
+	}
+	return handlers, nil
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// runChain runs the handlers of a chain and returns the names of the
+// middleware that ran, in order
+func runChain(t *testing.T, handlers []gin.HandlerFunc) string {
+	t.Helper()
+	var ran []string
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Set("ran", &ran)
+	for _, handler := range handlers {
+		handler(c)
+	}
+	return strings.Join(ran, ",")
+}
+
+// recording returns middleware recording its name when it runs
+func recording(names ...string) []namedMiddleware {
+	chain := make([]namedMiddleware, 0, len(names))
+	for _, name := range names {
+		chain = append(chain, namedMiddleware{name, func(c *gin.Context) {
+			ran := c.MustGet("ran").(*[]string)
+			*ran = append(*ran, name)
+		}})
+	}
+	return chain
+}
+
+func TestBuildChain(t *testing.T) {
+	builtin := recording("logging", "recovery", "traffic", "headers", "cors")
+	custom := []customMiddleware{{recording("audit")[0], After("headers")}}
+
+	tests := []struct {
+		name   string
+		order  []string
+		custom []customMiddleware
+		want   string
+	}{
+		{"default order", nil, nil, "logging,recovery,traffic,headers,cors"},
+		{"full order", []string{"cors", "headers", "traffic", "recovery", "logging"}, nil, "cors,headers,traffic,recovery,logging"},
+		{"unlisted follow their default predecessor", []string{"recovery", "logging"}, nil, "recovery,traffic,headers,cors,logging"},
+		{"unlisted first stays first", []string{"cors", "recovery"}, nil, "logging,cors,recovery,traffic,headers"},
+		{"custom placed in the ordered chain", []string{"headers", "logging"}, custom, "headers,audit,cors,logging,recovery,traffic"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handlers, err := buildChain(GlobalChain, builtin, tt.order, tt.custom)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := runChain(t, handlers); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildChainErrors(t *testing.T) {
+	builtin := recording("logging", "recovery")
+	tests := []struct {
+		name   string
+		order  []string
+		custom []customMiddleware
+		want   string
+	}{
+		{"unknown", []string{"gzip"}, nil, `unknown middleware "gzip"`},
+		{"duplicate", []string{"logging", "logging"}, nil, "listed twice"},
+		{"custom name taken", nil, []customMiddleware{{recording("logging")[0], Position{}}}, "already exists"},
+		{"unknown anchor", nil, []customMiddleware{{recording("audit")[0], Before("gzip")}}, `unknown middleware "gzip"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := buildChain(GlobalChain, builtin, tt.order, tt.custom)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestBuildChainSkipsDisabled(t *testing.T) {
+	builtin := recording("logging", "traffic", "cors")
+	builtin[1].handler = nil
+	handlers, err := buildChain(GlobalChain, builtin, []string{"cors"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := runChain(t, handlers); got != "logging,cors" || len(handlers) != 2 {
+		t.Fatalf("got %s from %d handlers", got, len(handlers))
+	}
+}
+
+func TestChunkAdviceRunsAfterSchedule(t *testing.T) {
+	srv, _ := newTestServer(t, nil)
+	var names []string
+	for _, m := range srv.uploadMiddleware() {
+		names = append(names, m.name)
+	}
+	// Time the scheduler holds chunks back must not count as transfer time
+	if slices.Index(names, "schedule") > slices.Index(names, "chunkAdvice") {
+		t.Fatalf("expected schedule to run before chunkAdvice, got %v", names)
+	}
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devsnb/large-file-uploads/pkg/checksum"
+	"github.com/devsnb/large-file-uploads/pkg/rejection"
+)
+
+// DefaultMaxChecksumChunk bounds chunks spooled for checksum verification
+// when no limit is configured
+const DefaultMaxChecksumChunk = 1 << 30
+
+// checksumMiddleware verifies PATCH requests carrying an Upload-Checksum
+// header or trailer before tusd writes the chunk. Such chunks are spooled to
+// a temporary file first, since a trailer only arrives after the body, and
+// rejected with 460 if they don't match.
+func (s *Server) checksumMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodOptions:
+			c.Header(checksum.AlgorithmHeader, strings.Join(checksum.Algorithms, ","))
+			c.Writer = &extensionAdvertisingWriter{ResponseWriter: c.Writer, extension: "checksum"}
+			c.Next()
+			return
+		case http.MethodPatch:
+		default:
+			c.Next()
+			return
+		}
+
+		declared := c.GetHeader(checksum.Header)
+		_, trailed := c.Request.Trailer[checksum.Header]
+		if declared == "" && !trailed {
+			c.Next()
+			return
+		}
+
+		// A checksum sent as header is known upfront, so only its algorithm
+		// is computed and unsupported ones fail before the body is read
+		var expected checksum.Checksum
+		if declared != "" {
+			parsed, err := checksum.Parse(declared)
+			if err != nil {
+				s.abortTus(c, invalidChecksum(err))
+				return
+			}
+			expected = parsed
+		}
+
+		chunk, hasher, err := s.spoolChunk(c.Request, expected.Algorithm)
+		if chunk != nil {
+			defer func() {
+				chunk.Close()
+				os.Remove(chunk.Name())
+			}()
+		}
+		if err != nil {
+			var rejected *rejection.Error
+			if errors.As(err, &rejected) {
+				s.abortTus(c, rejected)
+				return
+			}
+			// Clients going away mid-chunk are logged as aborts
+			if clientAbort(c) == nil {
+				slog.Error("Failed to spool chunk for checksum verification", "path", c.Request.URL.Path, "error", err)
+			}
+			s.abortTus(c, rejection.New(http.StatusBadRequest, rejection.CodeUploadRejected, "failed to read chunk"))
+			return
+		}
+
+		if declared == "" {
+			parsed, err := checksum.Parse(c.Request.Trailer.Get(checksum.Header))
+			if err != nil {
+				s.abortTus(c, invalidChecksum(err))
+				return
+			}
+			expected = parsed
+		}
+
+		ok, err := hasher.Verify(expected)
+		if err != nil {
+			s.abortTus(c, invalidChecksum(err))
+			return
+		}
+		if !ok {
+			slog.Warn("Chunk checksum mismatch",
+				"path", c.Request.URL.Path,
+				"offset", c.GetHeader("Upload-Offset"),
+				"algorithm", expected.Algorithm)
+			s.abortTus(c, rejection.New(checksum.StatusMismatch, rejection.CodeChecksumMismatch,
+				"chunk does not match its checksum").
+				WithDetail("algorithm", expected.Algorithm))
+			return
+		}
+
+		// Hand the verified chunk to tusd with a known length
+		size, err := chunk.Seek(0, io.SeekCurrent)
+		if err == nil {
+			_, err = chunk.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			slog.Error("Failed to rewind verified chunk", "error", err)
+			s.abortTus(c, rejection.New(http.StatusInternalServerError, rejection.CodeUploadRejected, "failed to store chunk"))
+			return
+		}
+		c.Request.Body = io.NopCloser(chunk)
+		c.Request.ContentLength = size
+		c.Request.Header.Set("Content-Length", strconv.FormatInt(size, 10))
+		c.Request.TransferEncoding = nil
+		c.Next()
+	}
+}
+
+// spoolChunk copies the request body to a temporary file, hashing it on the
+// way. The caller removes the file, which is returned even on errors.
+func (s *Server) spoolChunk(r *http.Request, algorithm string) (*os.File, *checksum.Hasher, error) {
+	hasher, err := checksum.NewHasher(algorithm)
+	if err != nil {
+		return nil, nil, invalidChecksum(err)
+	}
+
+	limit := s.maxChecksumChunk()
+	if r.ContentLength > limit {
+		return nil, nil, checksumChunkTooLarge(limit)
+	}
+
+	chunk, err := os.CreateTemp(s.cfg.Checksums.SpoolDir, "chunk-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create spool file: %w", err)
+	}
+
+	n, err := io.Copy(io.MultiWriter(chunk, hasher), io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return chunk, nil, fmt.Errorf("failed to read chunk: %w", err)
+	}
+	if n > limit {
+		return chunk, nil, checksumChunkTooLarge(limit)
+	}
+	return chunk, hasher, nil
+}
+
+// maxChecksumChunk returns the largest chunk spooled for verification
+func (s *Server) maxChecksumChunk() int64 {
+	if s.cfg.Checksums.MaxChunkSize > 0 {
+		return s.cfg.Checksums.MaxChunkSize
+	}
+	return DefaultMaxChecksumChunk
+}
+
+// invalidChecksum rejects a malformed or unsupported checksum
+func invalidChecksum(err error) *rejection.Error {
+	return rejection.New(http.StatusBadRequest, rejection.CodeInvalidChecksum, err.Error()).
+		WithDetail("algorithms", checksum.Algorithms)
+}
+
+// checksumChunkTooLarge rejects chunks too large to verify
+func checksumChunkTooLarge(limit int64) *rejection.Error {
+	return rejection.New(http.StatusRequestEntityTooLarge, rejection.CodeUploadTooLarge,
+		fmt.Sprintf("chunks with checksums must not exceed %d bytes", limit)).
+		WithDetail("maxChunkSize", limit)
+}
+
+// extensionAdvertisingWriter adds an extension to the Tus-Extension header
+// tusd sets on OPTIONS responses
+type extensionAdvertisingWriter struct {
+	gin.ResponseWriter
+	extension string
+}
+
+// Unwrap lets tusd extend the read deadline of the connection
+func (w *extensionAdvertisingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// WriteHeader appends the extension and writes the status code
+func (w *extensionAdvertisingWriter) WriteHeader(code int) {
+	if extensions := w.Header().Get("Tus-Extension"); extensions != "" {
+		w.Header().Set("Tus-Extension", extensions+","+w.extension)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
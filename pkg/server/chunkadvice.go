@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devsnb/large-file-uploads/pkg/chunkadvice"
+	"github.com/devsnb/large-file-uploads/pkg/events"
+)
+
+// chunkAdviceMiddleware measures how fast each upload's chunks arrive and
+// advises its client a chunk size in the Upload-Chunk-Size-Hint header of
+// PATCH and HEAD responses
+func (s *Server) chunkAdviceMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := strings.Trim(c.Param("any"), "/")
+		if id == "" || (c.Request.Method != http.MethodPatch && c.Request.Method != http.MethodHead) {
+			c.Next()
+			return
+		}
+
+		writer := &chunkAdviceWriter{ResponseWriter: c.Writer, advisor: s.chunkAdvice, id: id, started: time.Now()}
+		if c.Request.Method == http.MethodPatch {
+			writer.body = &countingReader{ReadCloser: c.Request.Body}
+			c.Request.Body = writer.body
+		}
+		c.Writer = writer
+		c.Next()
+	}
+}
+
+// chunkAdviceWriter measures a chunk once it is acknowledged and adds the
+// advised chunk size to the response
+type chunkAdviceWriter struct {
+	gin.ResponseWriter
+	advisor *chunkadvice.Advisor
+	id      string
+	started time.Time
+	body    *countingReader // nil for HEAD requests
+}
+
+// Unwrap lets tusd extend the read deadline of the connection
+func (w *chunkAdviceWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// WriteHeader measures the chunk, adds the advice and writes the status code
+func (w *chunkAdviceWriter) WriteHeader(code int) {
+	if w.body != nil && code == http.StatusNoContent {
+		w.advisor.Observe(w.id, w.body.n, time.Since(w.started))
+	}
+	if code < http.StatusBadRequest {
+		if size, ok := w.advisor.Advise(w.id); ok {
+			w.Header().Set(chunkadvice.Header, strconv.FormatInt(size, 10))
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// forgetChunkAdvice drops the measurements of finished uploads
+func (s *Server) forgetChunkAdvice(_ context.Context, e events.Event) error {
+	s.chunkAdvice.Forget(e.Upload.ID)
+	return nil
+}
+
+// newChunkAdvisor creates the advisor of per-upload chunk sizes within the
+// limits of the upload hints, or returns nil if chunk sizes aren't advised
+func (s *Server) newChunkAdvisor() *chunkadvice.Advisor {
+	cfg := s.cfg.UploadHints
+	if cfg.ChunkDuration <= 0 {
+		return nil
+	}
+	hints := s.uploadHints()
+	return chunkadvice.NewAdvisor(time.Duration(cfg.ChunkDuration)*time.Second, cfg.SampleChunks, chunkadvice.Limits{
+		Min:      hints.MinChunkSize,
+		Max:      hints.MaxChunkSize,
+		Multiple: hints.MinChunkSize,
+	})
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+	"github.com/devsnb/large-file-uploads/pkg/signing"
+)
+
+// ClaimHeader carries a claim token on tus requests from the claiming device
+const ClaimHeader = "Upload-Claim"
+
+// DefaultClaimTTL is how long claim links stay valid unless configured
+const DefaultClaimTTL = 15 * time.Minute
+
+// claimScope binds signed tokens to the claim use case
+const claimScope = "claim"
+
+// claimResponse is returned when a claim link is created
+type claimResponse struct {
+	Token     string    `json:"token"`
+	ClaimURL  string    `json:"claimUrl"`
+	UploadURL string    `json:"uploadUrl"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// redeemResponse tells the claiming device where and from which offset to
+// continue the upload
+type redeemResponse struct {
+	UploadID    string    `json:"uploadId"`
+	UploadURL   string    `json:"uploadUrl"`
+	Offset      int64     `json:"offset"`
+	Size        int64     `json:"size"`
+	ClaimHeader string    `json:"claimHeader"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// createClaim mints a short-lived claim link for an in-progress upload
+func (s *Server) createClaim(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	if err := s.authorize(ctx, auth.ActionWrite, id); err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	info, err := s.uploadInfo(ctx, id)
+	if err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if !info.SizeIsDeferred && info.Offset >= info.Size {
+		c.JSON(http.StatusConflict, gin.H{"error": "upload is already complete"})
+		return
+	}
+	if record, err := s.states.Get(ctx, id); err == nil && !record.State.Incomplete() {
+		c.JSON(http.StatusConflict, gin.H{"error": "upload is " + string(record.State)})
+		return
+	}
+
+	expiresAt := time.Now().Add(s.claimTTL()).Truncate(time.Second)
+	token := s.signer.Sign(claimScope, id, expiresAt)
+
+	c.JSON(http.StatusCreated, claimResponse{
+		Token:     token,
+		ClaimURL:  "/api/claims/" + token,
+		UploadURL: DefaultBasePath + id,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// redeemClaim resolves a claim link into the upload URL and current offset
+func (s *Server) redeemClaim(c *gin.Context) {
+	token := c.Param("token")
+
+	id, expiresAt, err := s.signer.Verify(token, claimScope)
+	if err != nil {
+		status := http.StatusUnauthorized
+		if errors.Is(err, signing.ErrExpiredToken) {
+			status = http.StatusGone
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	info, err := s.uploadInfo(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, redeemResponse{
+		UploadID:    id,
+		UploadURL:   DefaultBasePath + id,
+		Offset:      info.Offset,
+		Size:        info.Size,
+		ClaimHeader: ClaimHeader,
+		ExpiresAt:   expiresAt,
+	})
+}
+
+// verifyClaim checks that a claim token was issued for the upload
+func (s *Server) verifyClaim(token, id string) error {
+	claimed, _, err := s.signer.Verify(token, claimScope)
+	if err != nil {
+		return err
+	}
+	if claimed != id {
+		return errTokenMismatch
+	}
+	return nil
+}
+
+// claimTTL returns the configured claim link lifetime
+func (s *Server) claimTTL() time.Duration {
+	if s.cfg.Claims.TTL > 0 {
+		return time.Duration(s.cfg.Claims.TTL) * time.Second
+	}
+	return DefaultClaimTTL
+}
+
+// uploadErrorStatus maps errors from upload lookups to HTTP status codes
+func uploadErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, tusd.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errNotOwner), errors.Is(err, auth.ErrForbidden):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,261 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/content"
+	"github.com/devsnb/large-file-uploads/pkg/events"
+	"github.com/devsnb/large-file-uploads/pkg/features"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// verifyResponse is the result of re-hashing stored content
+type verifyResponse struct {
+	UploadID string `json:"uploadId"`
+	Digest   string `json:"digest"`
+	Actual   string `json:"actual"`
+	Verified bool   `json:"verified"`
+}
+
+// addressContent moves a finished upload to the key of its digest and
+// records the reference. Concurrent calls for the same upload, such as the
+// completion subscriber and a callback delivery, share one computation.
+func (s *Server) addressContent(ctx context.Context, id string) (content.Reference, error) {
+	result, err, _ := s.contentFlight.Do(id, func() (any, error) {
+		if ref, err := s.contentRefs.Get(ctx, id); err == nil {
+			return ref, nil
+		}
+
+		info, err := s.uploadInfo(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		digest, err := storage.Checksum(ctx, s.store, id)
+		if err != nil {
+			return nil, err
+		}
+
+		// Moves and removals are serialized, so content is never deleted
+		// while another upload is being pointed at it
+		s.contentMu.Lock()
+		defer s.contentMu.Unlock()
+
+		deduplicated, err := s.contents.MoveToContent(ctx, id, digest)
+		if err != nil {
+			return nil, err
+		}
+
+		ref := content.Reference{
+			UploadID:     id,
+			Digest:       digest,
+			Size:         info.Size,
+			Deduplicated: deduplicated,
+		}
+		if err := s.contentRefs.Add(ctx, ref); err != nil {
+			return nil, fmt.Errorf("failed to record content reference: %w", err)
+		}
+
+		slog.Info("Upload stored by content", "id", id, "digest", digest, "deduplicated", deduplicated)
+		return ref, nil
+	})
+	if err != nil {
+		return content.Reference{}, err
+	}
+	return result.(content.Reference), nil
+}
+
+// deduplicates reports whether the dedup flag is on for the tenant of an
+// upload
+func (s *Server) deduplicates(ctx context.Context, id string) bool {
+	tenant, _ := storage.TenantFromKey(id)
+	return s.features.Enabled(ctx, features.Dedup, tenant)
+}
+
+// contentReference returns the reference of a finished upload stored by
+// content, addressing it first if its tenant deduplicates. ok is false for
+// uploads kept under their own key.
+func (s *Server) contentReference(ctx context.Context, id string) (ref content.Reference, ok bool, err error) {
+	if s.contents == nil {
+		return content.Reference{}, false, nil
+	}
+	if s.deduplicates(ctx, id) {
+		ref, err := s.addressContent(ctx, id)
+		return ref, err == nil, err
+	}
+
+	// Uploads addressed before the flag was switched off stay addressed
+	ref, err = s.contentRefs.Get(ctx, id)
+	if errors.Is(err, content.ErrNotFound) {
+		return content.Reference{}, false, nil
+	}
+	return ref, err == nil, err
+}
+
+// storeContent addresses uploads by content once they are complete, unless
+// their tenant doesn't deduplicate
+func (s *Server) storeContent(ctx context.Context, e events.Event) error {
+	if !s.deduplicates(ctx, e.Upload.ID) {
+		return nil
+	}
+	_, err := s.addressContent(ctx, e.Upload.ID)
+	return err
+}
+
+// contentChecksum returns the digest of an upload for callback payloads
+func (s *Server) contentChecksum(ctx context.Context, id string) (string, error) {
+	ref, ok, err := s.contentReference(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return storage.Checksum(ctx, s.store, id)
+	}
+	return ref.Digest, nil
+}
+
+// releaseContent drops the reference of a terminated upload and deletes its
+// content once nothing references it anymore
+func (s *Server) releaseContent(ctx context.Context, e events.Event) error {
+	s.contentMu.Lock()
+	defer s.contentMu.Unlock()
+
+	ref, last, err := s.contentRefs.Remove(ctx, e.Upload.ID)
+	if err != nil {
+		if errors.Is(err, content.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if last {
+		return s.contents.DeleteContent(ctx, ref.Digest)
+	}
+	return nil
+}
+
+// contentDownloadMiddleware serves downloads of content-addressed uploads
+// from their content key, as the upload's own object no longer exists
+func (s *Server) contentDownloadMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := strings.Trim(c.Param("any"), "/")
+		if c.Request.Method != http.MethodGet || id == "" {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		ref, err := s.contentRefs.Get(ctx, id)
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		reader, size, err := s.contents.OpenContent(ctx, ref.Digest)
+		if err != nil {
+			slog.Error("Failed to open content", "id", id, "digest", ref.Digest, "error", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		defer reader.Close()
+
+		raw, _ := hex.DecodeString(ref.Digest)
+		header := c.Writer.Header()
+		header.Set("Content-Type", "application/octet-stream")
+		header.Set("Content-Length", strconv.FormatInt(size, 10))
+		header.Set("ETag", `"`+ref.Digest+`"`)
+		header.Set("Repr-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(raw)+":")
+		if info, err := s.uploadInfo(ctx, id); err == nil && info.MetaData["filename"] != "" {
+			header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": info.MetaData["filename"]}))
+		}
+
+		c.Status(http.StatusOK)
+		if _, err := io.Copy(c.Writer, reader); err != nil {
+			slog.Warn("Content download interrupted", "id", id, "error", err)
+		}
+		c.Abort()
+	}
+}
+
+// verifyContent re-hashes the stored content of an upload to detect
+// tampering
+func (s *Server) verifyContent(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	ref, err := s.contentRefs.Get(ctx, id)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, content.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	reader, _, err := s.contents.OpenContent(ctx, ref.Digest)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer reader.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if actual != ref.Digest {
+		slog.Error("Stored content does not match its digest", "id", id, "digest", ref.Digest, "actual", actual)
+	}
+
+	c.JSON(http.StatusOK, verifyResponse{
+		UploadID: id,
+		Digest:   ref.Digest,
+		Actual:   actual,
+		Verified: actual == ref.Digest,
+	})
+}
+
+// contentDigest returns the digest of a content-addressed upload, or an
+// empty string
+func (s *Server) contentDigest(ctx context.Context, id string) string {
+	if s.contentRefs == nil {
+		return ""
+	}
+	ref, err := s.contentRefs.Get(ctx, id)
+	if err != nil {
+		return ""
+	}
+	return ref.Digest
+}
+
+// newContentStore creates a file-backed content reference store when a
+// directory is configured and an in-memory one otherwise
+func newContentStore(cfg config.ContentConfig) (content.Store, error) {
+	if cfg.Dir == "" {
+		return content.NewMemoryStore(), nil
+	}
+
+	store, err := content.NewFileStore(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create content reference store: %w", err)
+	}
+	return store, nil
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+)
+
+// ContentTypeAnnotation is the annotation key of content types detected
+// for uploads that declared none
+const ContentTypeAnnotation = "contenttype"
+
+// sniffLength is how many leading bytes content types are detected from
+const sniffLength = 512
+
+// defaultContentType is the type downloads are served with when the upload's
+// type is unknown
+const defaultContentType = "application/octet-stream"
+
+// typeAnnotation is the content type detected for an upload
+type typeAnnotation struct {
+	Type       string    `json:"type"`
+	DetectedAt time.Time `json:"detectedAt"`
+}
+
+// detectContentType records the content type of a completed upload without
+// filetype metadata, detected from its first bytes. Failures are only
+// logged, as the upload is usable without it.
+func (s *Server) detectContentType(ctx context.Context, info tusd.FileInfo) {
+	if uploadFileType(info) != "" || info.Size == 0 {
+		return
+	}
+
+	contentType, err := s.sniffUpload(ctx, info.ID)
+	if err != nil {
+		slog.Warn("Failed to detect content type", "id", info.ID, "error", err)
+		return
+	}
+	if _, err := s.AnnotateUpload(ctx, info.ID, ContentTypeAnnotation, typeAnnotation{Type: contentType, DetectedAt: time.Now()}); err != nil {
+		slog.Error("Failed to record content type", "id", info.ID, "error", err)
+		return
+	}
+	slog.Debug("Detected content type", "id", info.ID, "type", contentType)
+}
+
+// sniffUpload detects the content type of an upload from its first bytes
+func (s *Server) sniffUpload(ctx context.Context, id string) (string, error) {
+	reader, err := s.openUpload(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(reader, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+	return http.DetectContentType(head[:n]), nil
+}
+
+// detectedType returns the content type detected for an upload, or an
+// empty string
+func (s *Server) detectedType(ctx context.Context, id string) string {
+	record, err := s.states.Get(ctx, id)
+	if err != nil {
+		return ""
+	}
+	raw, ok := record.Annotations[ContentTypeAnnotation]
+	if !ok {
+		return ""
+	}
+	var annotation typeAnnotation
+	if err := json.Unmarshal(raw, &annotation); err != nil {
+		return ""
+	}
+	return annotation.Type
+}
+
+// contentTypeMiddleware serves downloads of uploads without filetype
+// metadata with their detected content type instead of the default
+func (s *Server) contentTypeMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := strings.Trim(c.Param("any"), "/")
+		if c.Request.Method != http.MethodGet || id == "" {
+			c.Next()
+			return
+		}
+
+		if contentType := s.detectedType(c.Request.Context(), id); contentType != "" {
+			c.Writer = &contentTypeWriter{ResponseWriter: c.Writer, contentType: contentType}
+		}
+		c.Next()
+	}
+}
+
+// contentTypeWriter replaces the default content type of successful
+// download responses
+type contentTypeWriter struct {
+	gin.ResponseWriter
+	contentType string
+}
+
+// Unwrap lets tusd extend the read deadline of the connection
+func (w *contentTypeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// WriteHeader sets the content type and writes the status code
+func (w *contentTypeWriter) WriteHeader(code int) {
+	if (code == http.StatusOK || code == http.StatusPartialContent) && w.Header().Get("Content-Type") == defaultContentType {
+		w.Header().Set("Content-Type", w.contentType)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
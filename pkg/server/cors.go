@@ -0,0 +1,112 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/checksum"
+	"github.com/devsnb/large-file-uploads/pkg/chunkadvice"
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/diagnostics"
+	"github.com/devsnb/large-file-uploads/pkg/georoute"
+	"github.com/devsnb/large-file-uploads/pkg/idempotency"
+	"github.com/devsnb/large-file-uploads/pkg/metrics"
+	"github.com/devsnb/large-file-uploads/pkg/ratelimit"
+)
+
+// tusCors disables tusd's own CORS handling. The CORS middleware answers
+// for the tus endpoints as well, so every response carries one consistent
+// set of CORS headers.
+var tusCors = &tusd.CorsConfig{Disable: true}
+
+// corsMiddleware creates the CORS middleware of all routes from the cors
+// config block. The methods and headers the API and tus endpoints need are
+// always allowed and exposed; the configured ones are added to them.
+func corsMiddleware(cfg *config.Config) (gin.HandlerFunc, error) {
+	regionHeader := georoute.DefaultRegionHeader
+	if cfg.Downloads.Replicas.RegionHeader != "" {
+		regionHeader = cfg.Downloads.Replicas.RegionHeader
+	}
+
+	methods := []string{
+		http.MethodGet,
+		http.MethodPost,
+		http.MethodPut,
+		http.MethodPatch,
+		http.MethodDelete,
+		http.MethodHead,
+		http.MethodOptions,
+	}
+	headers := append(splitHeaders(tusd.DefaultCorsConfig.AllowHeaders),
+		"Content-Length",
+		ClaimHeader,
+		idempotency.Header,
+		checksum.Header,
+		ScheduledAtHeader,
+		regionHeader,
+		metrics.TraceParentHeader,
+	)
+	exposed := append(splitHeaders(tusd.DefaultCorsConfig.ExposeHeaders),
+		"Content-Type",
+		diagnostics.Header,
+		chunkadvice.Header,
+		idempotency.ReplayedHeader,
+		checksum.AlgorithmHeader,
+		ScheduledAtHeader,
+		"Retry-After",
+		ratelimit.LimitHeader,
+		ratelimit.RemainingHeader,
+		ratelimit.ResetHeader,
+	)
+
+	corsCfg := cors.Config{
+		AllowOrigins:     cfg.CORS.AllowedOrigins,
+		AllowMethods:     mergeCORS(methods, cfg.CORS.AllowedMethods, strings.ToUpper),
+		AllowHeaders:     mergeCORS(headers, cfg.CORS.AllowedHeaders, http.CanonicalHeaderKey),
+		ExposeHeaders:    mergeCORS(exposed, cfg.CORS.ExposedHeaders, http.CanonicalHeaderKey),
+		AllowCredentials: cfg.CORS.AllowCredentials,
+		AllowWildcard:    true,
+		MaxAge:           time.Duration(cfg.CORS.MaxAge) * time.Second,
+	}
+
+	// Config.Validate refuses "*" together with credentials
+	if len(corsCfg.AllowOrigins) == 0 || slices.Contains(corsCfg.AllowOrigins, "*") {
+		corsCfg.AllowOrigins = nil
+		corsCfg.AllowAllOrigins = true
+	}
+
+	if err := corsCfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid CORS configuration: %w", err)
+	}
+	return cors.New(corsCfg), nil
+}
+
+// splitHeaders splits a comma-separated header list
+func splitHeaders(list string) []string {
+	var headers []string
+	for _, header := range strings.Split(list, ",") {
+		if header = strings.TrimSpace(header); header != "" {
+			headers = append(headers, header)
+		}
+	}
+	return headers
+}
+
+// mergeCORS adds the configured values to the required ones, skipping
+// duplicates after normalizing them
+func mergeCORS(required, configured []string, normalize func(string) string) []string {
+	var values []string
+	for _, value := range slices.Concat(required, configured) {
+		if value = normalize(strings.TrimSpace(value)); value != "" && !slices.Contains(values, value) {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/catalog"
+	"github.com/devsnb/large-file-uploads/pkg/costs"
+	"github.com/devsnb/large-file-uploads/pkg/events"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// costReports holds the latest storage cost report
+type costReports struct {
+	mu     sync.RWMutex
+	latest *costs.Report
+
+	// usage remembers what completed uploads store, which only changes
+	// when they move to another class, so later reports don't read their
+	// info again. reportMu serializes the reports using it.
+	reportMu sync.Mutex
+	usage    map[string]costs.Usage
+
+	// moved lists uploads moved to another class since the last report
+	movedMu sync.Mutex
+	moved   map[string]bool
+}
+
+// forgetCostUsage makes the next cost report read an upload moved to
+// another storage class again
+func (s *Server) forgetCostUsage(ctx context.Context, e events.Event) error {
+	s.costReports.movedMu.Lock()
+	defer s.costReports.movedMu.Unlock()
+	if s.costReports.moved == nil {
+		s.costReports.moved = make(map[string]bool)
+	}
+	s.costReports.moved[e.Upload.ID] = true
+	return nil
+}
+
+// latestCosts returns the latest storage cost report, or nil before the
+// first one
+func (s *Server) latestCosts() *costs.Report {
+	s.costReports.mu.RLock()
+	defer s.costReports.mu.RUnlock()
+	return s.costReports.latest
+}
+
+// runCostReports estimates storage costs right away and then every
+// interval until the context is canceled
+func (s *Server) runCostReports(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(max(s.cfg.Costs.Interval, 60)) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		if err := s.reportCosts(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			slog.Error("Failed to estimate storage costs", "error", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reportCosts estimates the storage costs of every tenant from the uploads
+// in the catalog, publishes the report and writes it to the CSV file if
+// configured. The info of completed uploads is read once and remembered
+// until they move to another class or leave the catalog.
+func (s *Server) reportCosts(ctx context.Context) error {
+	s.costReports.reportMu.Lock()
+	defer s.costReports.reportMu.Unlock()
+
+	entries, err := s.catalog.List(ctx, catalog.Filter{AllOwners: true})
+	if err != nil {
+		return fmt.Errorf("failed to list uploads: %w", err)
+	}
+
+	s.costReports.movedMu.Lock()
+	moved := s.costReports.moved
+	s.costReports.moved = nil
+	s.costReports.movedMu.Unlock()
+
+	known := make(map[string]costs.Usage, len(entries))
+	usage := make([]costs.Usage, 0, len(entries))
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if stored, ok := s.costReports.usage[entry.UploadID]; ok && !moved[entry.UploadID] {
+			known[entry.UploadID] = stored
+			usage = append(usage, stored)
+			continue
+		}
+
+		info, err := s.uploadInfo(ctx, entry.UploadID)
+		if err != nil {
+			// Terminated uploads may linger in the catalog for a moment
+			if !errors.Is(err, tusd.ErrNotFound) {
+				slog.Warn("Failed to read upload for the cost report", "id", entry.UploadID, "error", err)
+			}
+			continue
+		}
+		tenant, _ := storage.TenantFromKey(info.ID)
+		stored := costs.Usage{
+			Tenant:       tenant,
+			StorageClass: info.MetaData[storage.StorageClassMetadataKey],
+			Bytes:        info.Offset,
+		}
+		if !info.SizeIsDeferred && info.Offset == info.Size {
+			known[entry.UploadID] = stored
+		}
+		usage = append(usage, stored)
+	}
+	s.costReports.usage = known
+
+	report := costs.Estimate(usage, costs.Pricing{
+		Currency:     s.cfg.Costs.Currency,
+		DefaultClass: s.cfg.Costs.DefaultClass,
+		Prices:       s.cfg.Costs.Prices,
+	}, time.Now())
+	if len(report.Unpriced) > 0 {
+		slog.Warn("Storage classes lack a price, their uploads are reported without costs", "classes", report.Unpriced)
+	}
+
+	s.costReports.mu.Lock()
+	s.costReports.latest = &report
+	s.costReports.mu.Unlock()
+
+	if s.cfg.Costs.File != "" {
+		if err := writeCostFile(s.cfg.Costs.File, report); err != nil {
+			return fmt.Errorf("failed to write cost report: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeCostFile replaces the CSV file with the report, so readers never see
+// a partial report
+func writeCostFile(path string, report costs.Report) error {
+	file, err := os.CreateTemp(filepath.Dir(path), ".costs-*.csv")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if err := report.WriteCSV(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// getCosts returns the latest storage cost report as JSON, or as CSV with
+// format=csv
+func (s *Server) getCosts(c *gin.Context) {
+	report := s.latestCosts()
+	if report == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "no cost report has been produced yet"})
+		return
+	}
+
+	if c.Query("format") != "csv" {
+		c.JSON(http.StatusOK, report)
+		return
+	}
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="storage-costs-%s.csv"`, report.GeneratedAt.UTC().Format("2006-01-02")))
+	c.Status(http.StatusOK)
+	if err := report.WriteCSV(c.Writer); err != nil {
+		slog.Warn("Failed to send cost report", "error", err)
+	}
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/events"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// classedMemory is in-memory storage whose uploads can be moved to another
+// storage class
+type classedMemory struct {
+	*storage.MemoryStorage
+	composer *tusd.StoreComposer
+
+	mu      sync.Mutex
+	classes map[string]string
+}
+
+func newClassedMemory(t *testing.T) *classedMemory {
+	t.Helper()
+	store := &classedMemory{MemoryStorage: newMemoryStorage(t), classes: map[string]string{}}
+	composer := *store.MemoryStorage.GetStoreComposer()
+	composer.Core = classedStore{composer.Core, store}
+	store.composer = &composer
+	return store
+}
+
+func (s *classedMemory) GetStoreComposer() *tusd.StoreComposer {
+	return s.composer
+}
+
+func (s *classedMemory) move(id, class string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.classes[id] = class
+}
+
+func (s *classedMemory) class(id string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.classes[id]
+}
+
+// classedStore is the data store of classedMemory
+type classedStore struct {
+	tusd.DataStore
+	store *classedMemory
+}
+
+func (s classedStore) GetUpload(ctx context.Context, id string) (tusd.Upload, error) {
+	upload, err := s.DataStore.GetUpload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return classedUpload{upload, s.store.class(id)}, nil
+}
+
+// classedUpload is an upload whose info carries its storage class
+type classedUpload struct {
+	tusd.Upload
+	class string
+}
+
+func (u classedUpload) GetInfo(ctx context.Context) (tusd.FileInfo, error) {
+	info, err := u.Upload.GetInfo(ctx)
+	if err != nil || u.class == "" {
+		return info, err
+	}
+	metadata := make(tusd.MetaData, len(info.MetaData)+1)
+	for key, value := range info.MetaData {
+		metadata[key] = value
+	}
+	metadata[storage.StorageClassMetadataKey] = u.class
+	info.MetaData = metadata
+	return info, nil
+}
+
+// costLines reads the storage class, upload count and bytes of each line
+// of a cost report file
+func costLines(t *testing.T, path string) [][]string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := make([][]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		lines = append(lines, record[1:4])
+	}
+	return lines
+}
+
+func TestCostReportRemembersCompletedUploads(t *testing.T) {
+	store := newClassedMemory(t)
+	path := filepath.Join(t.TempDir(), "costs.csv")
+	srv, ts := newTestServerOn(t, store, func(cfg *config.Config) {
+		cfg.Costs = config.CostConfig{Enabled: true, Interval: 3600, Currency: "USD", DefaultClass: "STANDARD", File: path}
+	})
+	complete := upload(t, ts, "hello", nil)
+	incomplete := upload(t, ts, "", map[string]string{"Upload-Length": "10"})
+
+	ctx := context.Background()
+	report := func() [][]string {
+		t.Helper()
+		if err := srv.reportCosts(ctx); err != nil {
+			t.Fatal(err)
+		}
+		return costLines(t, path)
+	}
+	if lines := report(); len(lines) != 1 || lines[0][0] != "STANDARD" || lines[0][1] != "2" || lines[0][2] != "5" {
+		t.Fatalf("expected both uploads in the default class, got %v", lines)
+	}
+
+	// Completed uploads are remembered, uploads in progress are read again
+	store.move(complete, "GLACIER")
+	store.move(incomplete, "GLACIER")
+	if lines := report(); len(lines) != 2 || lines[0][0] != "GLACIER" || lines[0][2] != "0" || lines[1][0] != "STANDARD" || lines[1][2] != "5" {
+		t.Fatalf("expected only the upload in progress to be read again, got %v", lines)
+	}
+
+	// A moved upload is read again by the next report
+	srv.forgetCostUsage(ctx, events.Event{Upload: tusd.FileInfo{ID: complete}})
+	if lines := report(); len(lines) != 1 || lines[0][0] != "GLACIER" || lines[0][1] != "2" || lines[0][2] != "5" {
+		t.Fatalf("expected the moved upload to be read again, got %v", lines)
+	}
+}
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/deletion"
+	"github.com/devsnb/large-file-uploads/pkg/events"
+	"github.com/devsnb/large-file-uploads/pkg/rejection"
+	"github.com/devsnb/large-file-uploads/pkg/uploadstate"
+)
+
+// deletionGraceMiddleware keeps terminated uploads for the grace period.
+// Terminations are recorded and answered like tusd would, and the upload
+// is hidden from tus requests until it is deleted or restored.
+func (s *Server) deletionGraceMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := strings.Trim(c.Param("any"), "/")
+		if id == "" || c.Request.Method == http.MethodOptions {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		pending, err := s.deletions.Get(ctx, id)
+		switch {
+		case err == nil:
+			if c.Request.Method == http.MethodDelete {
+				c.Header("Tus-Resumable", "1.0.0")
+				c.AbortWithStatus(http.StatusNoContent)
+				return
+			}
+			s.abortTus(c, rejection.New(http.StatusNotFound, rejection.CodeUploadPendingDeletion,
+				"upload was terminated and is pending deletion").
+				WithDetail("deleteAt", pending.DeleteAt))
+			return
+		case !errors.Is(err, deletion.ErrNotFound):
+			slog.Error("Failed to look up pending deletion", "id", id, "error", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		if c.Request.Method != http.MethodDelete {
+			c.Next()
+			return
+		}
+
+		// Unknown uploads are left to tusd
+		info, err := s.uploadInfo(ctx, id)
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		// The termination policy and synchronous subscribers can still
+		// refuse the termination
+		hook := tusd.HookEvent{
+			Context: ctx,
+			Upload:  info,
+			HTTPRequest: tusd.HTTPRequest{
+				Method:     c.Request.Method,
+				URI:        c.Request.RequestURI,
+				RemoteAddr: c.Request.RemoteAddr,
+				Header:     c.Request.Header,
+			},
+		}
+		if err := s.allowTermination(hook); err != nil {
+			var rejected *rejection.Error
+			if !errors.As(err, &rejected) {
+				rejected = rejection.New(http.StatusBadRequest, rejection.CodeUploadRejected, err.Error())
+			}
+			s.abortTus(c, rejected)
+			return
+		}
+
+		var requestedBy string
+		if user, err := auth.GetUserFromContext(ctx); err == nil {
+			requestedBy = user.ID
+		}
+		pending, err = s.deletions.Schedule(ctx, id, requestedBy)
+		if err != nil {
+			slog.Error("Failed to schedule upload deletion", "id", id, "error", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		slog.Info("Upload terminated, deleting it after the grace period", "id", id, "deleteAt", pending.DeleteAt)
+		c.Header("Tus-Resumable", "1.0.0")
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// runDeletions deletes terminated uploads whose grace period has ended
+// until the context is canceled
+func (s *Server) runDeletions(ctx context.Context) {
+	ticker := time.NewTicker(min(s.deletions.Grace(), time.Minute))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		due, err := s.deletions.Due(ctx)
+		if err != nil {
+			slog.Error("Failed to list pending deletions", "error", err)
+			continue
+		}
+		for _, pending := range due {
+			if err := s.deleteTerminated(ctx, pending.UploadID); err != nil {
+				if errors.Is(err, context.Canceled) {
+					return
+				}
+				slog.Error("Failed to delete terminated upload", "id", pending.UploadID, "error", err)
+			}
+		}
+	}
+}
+
+// deleteTerminated deletes the data of a terminated upload and notifies
+// the termination subscribers
+func (s *Server) deleteTerminated(ctx context.Context, id string) error {
+	unlock, err := s.lockUpload(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	upload, err := s.composer.Core.GetUpload(ctx, id)
+	if errors.Is(err, tusd.ErrNotFound) {
+		// Deleted behind our back, nothing is left to do
+		return s.deletions.Done(ctx, id)
+	}
+	if err != nil {
+		return err
+	}
+	info, err := upload.GetInfo(ctx)
+	if err != nil {
+		return err
+	}
+	if err := s.composer.Terminater.AsTerminatableUpload(upload).Terminate(ctx); err != nil {
+		return err
+	}
+	if err := s.deletions.Done(ctx, id); err != nil {
+		return err
+	}
+
+	slog.Info("Terminated upload deleted", "id", id)
+	hook := tusd.HookEvent{Context: ctx, Upload: info}
+	s.advanceState(ctx, hook, uploadstate.Deleted)
+	s.events.Notify(ctx, newEvent(events.UploadTerminated, hook))
+	return nil
+}
+
+// restoreUpload cancels the pending deletion of an upload the caller
+// terminated
+func (s *Server) restoreUpload(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	if err := s.authorize(ctx, auth.ActionDelete, id); err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	s.restore(c, id)
+}
+
+// listDeletions returns the terminated uploads pending deletion, the next
+// one first
+func (s *Server) listDeletions(c *gin.Context) {
+	pending, err := s.deletions.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deletions": pending})
+}
+
+// adminRestoreUpload cancels the pending deletion of any upload
+func (s *Server) adminRestoreUpload(c *gin.Context) {
+	s.restore(c, c.Param("id"))
+}
+
+// restore cancels a pending deletion and returns what it was
+func (s *Server) restore(c *gin.Context, id string) {
+	pending, err := s.deletions.Restore(c.Request.Context(), id)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, deletion.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	slog.Info("Terminated upload restored", "id", id)
+	s.resumeProcessing(c.Request.Context(), id)
+	c.JSON(http.StatusOK, gin.H{"restored": pending})
+}
+
+// resumeProcessing restarts the post-processing of a restored upload that
+// was canceled by its termination
+func (s *Server) resumeProcessing(ctx context.Context, id string) {
+	if !s.processing.resume(id) {
+		return
+	}
+	info, err := s.uploadInfo(ctx, id)
+	if err != nil {
+		return
+	}
+	if _, err := s.transition(ctx, info, uploadstate.Failed, "post-processing was canceled by a termination"); err != nil {
+		slog.Error("Failed to update upload state", "id", id, "state", uploadstate.Failed, "error", err)
+		return
+	}
+	s.goBackground(func(ctx context.Context) {
+		if err := s.processUpload(ctx, events.Event{Type: events.UploadCompleted, Upload: info}); err != nil {
+			slog.Error("Failed to post-process restored upload", "id", id, "error", err)
+		}
+	})
+}
+
+// newDeletionQueue creates the queue of terminated uploads, or returns nil
+// if terminated uploads are deleted at once
+func newDeletionQueue(cfg config.TerminationConfig) (*deletion.Queue, error) {
+	if cfg.GracePeriod <= 0 {
+		return nil, nil
+	}
+	grace := time.Duration(cfg.GracePeriod) * time.Second
+	if cfg.Dir == "" {
+		return deletion.NewQueue(deletion.NewMemoryStore(), grace), nil
+	}
+
+	store, err := deletion.NewFileStore(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create deletion store: %w", err)
+	}
+	return deletion.NewQueue(store, grace), nil
+}
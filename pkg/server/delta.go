@@ -0,0 +1,238 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/delta"
+	"github.com/devsnb/large-file-uploads/pkg/events"
+	"github.com/devsnb/large-file-uploads/pkg/rejection"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// DeltaPlanMetadataKey names the delta plan an upload is created with
+const DeltaPlanMetadataKey = "delta_plan"
+
+// createDeltaPlan compares the block manifest of a changed file with a
+// completed upload and returns the ranges that need to be uploaded
+func (s *Server) createDeltaPlan(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	if err := s.authorize(ctx, auth.ActionRead, id); err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	info, err := s.uploadInfo(ctx, id)
+	if err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if info.SizeIsDeferred || info.Offset < info.Size {
+		c.JSON(http.StatusConflict, gin.H{"error": "only completed uploads can be compared"})
+		return
+	}
+
+	var manifest delta.Manifest
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, delta.MaxManifestSize)
+	if err := c.ShouldBindJSON(&manifest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := manifest.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reader, err := s.openUpload(ctx, id)
+	if err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	defer reader.Close()
+	changed, err := delta.Compare(reader, manifest)
+	if err != nil {
+		slog.Error("Failed to compare block manifest", "id", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	plan := delta.Plan{BaseID: id, Size: manifest.Size, BlockSize: manifest.BlockSize, Changed: changed}
+	if user, err := auth.GetUserFromContext(ctx); err == nil {
+		plan.Owner = user.ID
+	}
+	plan, err = s.deltas.Create(ctx, plan)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	slog.Info("Delta plan created", "plan", plan.ID, "base", id, "size", plan.Size, "changedBytes", plan.ChangedBytes)
+	c.JSON(http.StatusCreated, plan)
+}
+
+// checkDeltaPlan hands the delta plan named by a new upload to it. The
+// upload must have the size of the changed file and be created without data,
+// since its unchanged ranges are filled in from the previous upload.
+func (s *Server) checkDeltaPlan(hook tusd.HookEvent, id string) (claimed bool, err error) {
+	planID := hook.Upload.MetaData[DeltaPlanMetadataKey]
+	if s.deltas == nil || planID == "" {
+		return false, nil
+	}
+
+	plan, err := s.deltas.Get(hook.Context, planID)
+	switch {
+	case errors.Is(err, delta.ErrNotFound):
+		return false, rejection.New(http.StatusBadRequest, rejection.CodeInvalidDeltaPlan,
+			fmt.Sprintf("delta plan %q does not exist", planID))
+	case errors.Is(err, delta.ErrExpired):
+		return false, rejection.New(http.StatusGone, rejection.CodeDeltaPlanExpired,
+			fmt.Sprintf("delta plan %q has expired, create a new one", planID))
+	case err != nil:
+		slog.Error("Failed to load delta plan", "plan", planID, "error", err)
+		return false, rejection.New(http.StatusInternalServerError, rejection.CodeUploadRejected, "failed to load delta plan")
+	}
+
+	if user, err := auth.GetUserFromContext(hook.Context); err == nil && user.ID != plan.Owner {
+		return false, rejection.New(http.StatusBadRequest, rejection.CodeInvalidDeltaPlan,
+			fmt.Sprintf("delta plan %q does not exist", planID))
+	}
+	if hook.Upload.SizeIsDeferred || hook.Upload.Size != plan.Size {
+		return false, rejection.New(http.StatusBadRequest, rejection.CodeInvalidDeltaPlan,
+			fmt.Sprintf("upload length must be %d bytes, the size of the file the plan was made for", plan.Size)).
+			WithDetail("size", plan.Size)
+	}
+	if strings.HasPrefix(hook.HTTPRequest.Header.Get("Content-Type"), "application/offset+octet-stream") {
+		return false, rejection.New(http.StatusBadRequest, rejection.CodeInvalidDeltaPlan,
+			"uploads with a delta plan must be created without data")
+	}
+
+	if _, err := s.deltas.Claim(hook.Context, planID, id); err != nil {
+		if errors.Is(err, delta.ErrClaimed) {
+			return false, rejection.New(http.StatusBadRequest, rejection.CodeInvalidDeltaPlan,
+				fmt.Sprintf("delta plan %q is used by another upload", planID))
+		}
+		slog.Error("Failed to claim delta plan", "plan", planID, "error", err)
+		return false, rejection.New(http.StatusInternalServerError, rejection.CodeUploadRejected, "failed to claim delta plan")
+	}
+	return true, nil
+}
+
+// deltaMiddleware fills in the unchanged range at the current offset of an
+// upload with a delta plan before HEAD and PATCH requests, so the offset
+// moves on to the next range the client has to send
+func (s *Server) deltaMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := strings.Trim(c.Param("any"), "/")
+		if (c.Request.Method != http.MethodHead && c.Request.Method != http.MethodPatch) || id == "" {
+			c.Next()
+			return
+		}
+
+		// Errors are left to tusd, which reports them properly
+		info, err := s.uploadInfo(c.Request.Context(), id)
+		if err != nil || info.MetaData[DeltaPlanMetadataKey] == "" {
+			c.Next()
+			return
+		}
+
+		if err := s.fillUnchanged(c.Request.Context(), id); err != nil {
+			slog.Error("Failed to fill in unchanged range", "id", id, "error", err)
+			s.abortTus(c, rejection.New(http.StatusInternalServerError, rejection.CodeUploadRejected,
+				"failed to copy unchanged data from the previous upload"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// fillUnchanged copies the unchanged range at the current offset of an
+// upload from the previous upload its delta plan was made against
+func (s *Server) fillUnchanged(ctx context.Context, id string) error {
+	unlock, err := s.lockUpload(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	upload, err := s.composer.Core.GetUpload(ctx, id)
+	if err != nil {
+		return err
+	}
+	info, err := upload.GetInfo(ctx)
+	if err != nil {
+		return err
+	}
+	plan, err := s.deltas.Get(ctx, info.MetaData[DeltaPlanMetadataKey])
+	if err != nil {
+		return fmt.Errorf("failed to load delta plan: %w", err)
+	}
+	// The plan was claimed with the ID chosen before creation, which
+	// s3store completes with the multipart upload ID
+	if storage.ObjectKey(plan.UploadID) != storage.ObjectKey(id) {
+		return fmt.Errorf("delta plan %s was claimed by upload %s", plan.ID, plan.UploadID)
+	}
+	unchanged, ok := plan.Unchanged(info.Offset)
+	if !ok {
+		return nil
+	}
+
+	base, err := s.openUpload(ctx, plan.BaseID)
+	if err != nil {
+		return fmt.Errorf("failed to open previous upload %s: %w", plan.BaseID, err)
+	}
+	defer base.Close()
+	if seeker, ok := base.(io.Seeker); ok {
+		_, err = seeker.Seek(unchanged.Offset, io.SeekStart)
+	} else {
+		_, err = io.CopyN(io.Discard, base, unchanged.Offset)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to skip to offset %d of previous upload: %w", unchanged.Offset, err)
+	}
+
+	n, err := upload.WriteChunk(ctx, unchanged.Offset, io.LimitReader(base, unchanged.Length))
+	if err != nil {
+		return err
+	}
+	if n != unchanged.Length {
+		return fmt.Errorf("previous upload %s ended after %d of %d unchanged bytes", plan.BaseID, n, unchanged.Length)
+	}
+	slog.Debug("Filled in unchanged range", "id", id, "offset", unchanged.Offset, "length", unchanged.Length)
+	return nil
+}
+
+// forgetDeltaPlan removes the delta plan of a completed or terminated upload
+func (s *Server) forgetDeltaPlan(ctx context.Context, event events.Event) error {
+	planID := event.Upload.MetaData[DeltaPlanMetadataKey]
+	if planID == "" {
+		return nil
+	}
+	if err := s.deltas.Delete(ctx, planID); err != nil && !errors.Is(err, delta.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// newDeltaStore creates the store for delta plans
+func newDeltaStore(cfg config.DeltaConfig) (delta.Store, error) {
+	if cfg.Dir == "" {
+		return delta.NewMemoryStore(), nil
+	}
+
+	store, err := delta.NewFileStore(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create delta plan store: %w", err)
+	}
+	return store, nil
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/delta"
+)
+
+func TestDeltaUploadWithMultipartIDs(t *testing.T) {
+	_, ts := newTestServerOn(t, newMultipartIDs(t), func(cfg *config.Config) {
+		cfg.DeltaUploads.Enabled = true
+		cfg.DeltaUploads.TTL = 3600
+	})
+	blockSize := int(delta.MinBlockSize)
+	unchanged, previous, changed := strings.Repeat("a", blockSize), strings.Repeat("b", blockSize), strings.Repeat("c", blockSize)
+	base := upload(t, ts, unchanged+previous, nil)
+	if !strings.HasSuffix(base, "+multipart") {
+		t.Fatalf("expected an s3store style upload ID, got %s", base)
+	}
+
+	var blocks []string
+	for _, block := range []string{unchanged, changed} {
+		sum := sha256.Sum256([]byte(block))
+		blocks = append(blocks, hex.EncodeToString(sum[:]))
+	}
+	manifest, err := json.Marshal(delta.Manifest{Size: int64(2 * blockSize), BlockSize: int64(blockSize), Blocks: blocks})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, body := request(t, http.MethodPost, ts.URL+"/api/uploads/"+base+"/delta", map[string]string{"Content-Type": "application/json"}, string(manifest))
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("creating a delta plan: %d %s", resp.StatusCode, body)
+	}
+	var plan delta.Plan
+	if err := json.Unmarshal([]byte(body), &plan); err != nil {
+		t.Fatal(err)
+	}
+
+	// The unchanged block is filled in from the previous upload, so only
+	// the changed one is sent
+	id := upload(t, ts, "", map[string]string{
+		"Upload-Length":   strconv.Itoa(2 * blockSize),
+		"Upload-Metadata": DeltaPlanMetadataKey + " " + base64.StdEncoding.EncodeToString([]byte(plan.ID)),
+	})
+	resp, body = request(t, http.MethodHead, ts.URL+DefaultBasePath+id, nil, "")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Upload-Offset") != strconv.Itoa(blockSize) {
+		t.Fatalf("HEAD of the delta upload: %d offset %q %s", resp.StatusCode, resp.Header.Get("Upload-Offset"), body)
+	}
+	patch := map[string]string{"Upload-Offset": strconv.Itoa(blockSize), "Content-Type": "application/offset+octet-stream"}
+	if resp, body := request(t, http.MethodPatch, ts.URL+DefaultBasePath+id, patch, changed); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("uploading the changed block: %d %s", resp.StatusCode, body)
+	}
+	if resp, body := request(t, http.MethodGet, ts.URL+DefaultBasePath+id, nil, ""); resp.StatusCode != http.StatusOK || body != unchanged+changed {
+		t.Fatalf("downloading the delta upload: %d, %d bytes", resp.StatusCode, len(body))
+	}
+}
@@ -0,0 +1,18 @@
+package server
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// demoPage is a minimal tus-js-client page for verifying a deployment
+//
+//go:embed demo/index.html
+var demoPage []byte
+
+// serveDemo serves the upload demo page
+func serveDemo(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", demoPage)
+}
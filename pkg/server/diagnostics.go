@@ -0,0 +1,179 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/diagnostics"
+	"github.com/devsnb/large-file-uploads/pkg/events"
+)
+
+// errorBodyLimit bounds how much of an error response body is captured
+const errorBodyLimit = 512
+
+// diagnosticsMiddleware records PATCH outcomes per upload and returns the
+// statistics in the Upload-Diagnostics header of HEAD responses. With a
+// timeline, each PATCH request is also logged at debug level.
+func (s *Server) diagnosticsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := strings.Trim(c.Param("any"), "/")
+		if id == "" {
+			c.Next()
+			return
+		}
+
+		switch c.Request.Method {
+		case http.MethodHead:
+			if stats, err := s.diagnostics.Get(c.Request.Context(), id); err == nil {
+				c.Header(diagnostics.Header, stats.String())
+			} else if !errors.Is(err, diagnostics.ErrNotFound) {
+				slog.Error("Failed to load diagnostics", "id", id, "error", err)
+			}
+			c.Next()
+
+		case http.MethodPatch:
+			offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+			if err != nil {
+				c.Next()
+				return
+			}
+
+			writer := &errorCapturingWriter{ResponseWriter: c.Writer}
+			c.Writer = writer
+			started := time.Now()
+			c.Next()
+
+			abortErr := clientAbort(c)
+			patch := diagnostics.Patch{
+				Start:    offset,
+				Duration: time.Since(started),
+				Status:   writer.Status(),
+				Error:    patchError(c.Request.Context(), writer),
+				Aborted:  abortErr != nil || errors.Is(c.Request.Context().Err(), context.Canceled),
+			}
+			if patch.Aborted {
+				patch.Error = abortReason(abortErr)
+			}
+			// The response of an aborted request doesn't report the part of
+			// the chunk that was stored
+			end, err := strconv.ParseInt(writer.Header().Get("Upload-Offset"), 10, 64)
+			if err != nil || patch.Aborted {
+				end = s.patchEnd(c.Request.Context(), id, offset, patch)
+			}
+			patch.End = end
+			chunk, err := s.diagnostics.RecordPatch(context.WithoutCancel(c.Request.Context()), id, patch)
+			if err != nil {
+				slog.Error("Failed to record diagnostics", "id", id, "error", err)
+			} else if s.diagnostics.Timeline() {
+				slog.Debug("Chunk received", "id", id, "index", chunk.Index, "start", chunk.Start, "end", chunk.End,
+					"durationMs", chunk.DurationMS, "retry", chunk.Retry, "aborted", chunk.Aborted, "status", chunk.Status, "error", chunk.Error)
+			}
+
+		default:
+			c.Next()
+		}
+	}
+}
+
+// patchEnd returns the offset of an upload after a PATCH request that was
+// aborted or failed on the server, which may have stored part of its data.
+// Requests refused up front, and any without a timeline, end where they
+// started.
+func (s *Server) patchEnd(ctx context.Context, id string, start int64, patch diagnostics.Patch) int64 {
+	if !s.diagnostics.Timeline() || (patch.Status < http.StatusInternalServerError && !patch.Aborted) {
+		return start
+	}
+	info, err := s.uploadInfo(context.WithoutCancel(ctx), id)
+	if err != nil {
+		return start
+	}
+	return info.Offset
+}
+
+// getDiagnostics returns the transfer statistics of an upload, with its
+// timeline if enabled
+func (s *Server) getDiagnostics(c *gin.Context) {
+	id := c.Param("id")
+
+	if err := s.authorize(c.Request.Context(), auth.ActionRead, id); err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	stats, err := s.diagnostics.Get(c.Request.Context(), id)
+	if errors.Is(err, diagnostics.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to load diagnostics", "id", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load diagnostics"})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// forgetDiagnostics drops the statistics of terminated uploads
+func (s *Server) forgetDiagnostics(ctx context.Context, e events.Event) error {
+	return s.diagnostics.Forget(ctx, e.Upload.ID)
+}
+
+// newDiagnosticsStore creates the store of transfer statistics, in memory if
+// no directory is configured
+func newDiagnosticsStore(cfg config.DiagnosticsConfig) (diagnostics.Store, error) {
+	if cfg.Dir == "" {
+		return diagnostics.NewMemoryStore(), nil
+	}
+
+	store, err := diagnostics.NewFileStore(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create diagnostics store: %w", err)
+	}
+	return store, nil
+}
+
+// patchError describes why a PATCH request failed, or returns an empty
+// string if it succeeded
+func patchError(ctx context.Context, w *errorCapturingWriter) string {
+	if w.Status() >= http.StatusBadRequest {
+		if msg := strings.TrimSpace(w.body.String()); msg != "" {
+			return msg
+		}
+		return http.StatusText(w.Status())
+	}
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return "client disconnected"
+	}
+	return ""
+}
+
+// errorCapturingWriter keeps the start of error response bodies
+type errorCapturingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// Unwrap lets tusd extend the read deadline of the connection
+func (w *errorCapturingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Write captures the body of error responses before passing it on
+func (w *errorCapturingWriter) Write(data []byte) (int, error) {
+	if w.Status() >= http.StatusBadRequest && w.body.Len() < errorBodyLimit {
+		remaining := errorBodyLimit - w.body.Len()
+		w.body.Write(data[:min(len(data), remaining)])
+	}
+	return w.ResponseWriter.Write(data)
+}
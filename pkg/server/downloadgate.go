@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+	"github.com/devsnb/large-file-uploads/pkg/deletion"
+	"github.com/devsnb/large-file-uploads/pkg/rejection"
+	"github.com/devsnb/large-file-uploads/pkg/uploadstate"
+)
+
+// downloadGate checks that an upload may be downloaded and returns the
+// rejection to answer the request with otherwise. It guards every way of
+// downloading an upload: tus GET requests, download tokens and URLs, CDN
+// URLs and share links.
+//
+// Uploads must be ready, so uploads still uploading or processing, failed,
+// quarantined or in review are refused, and so are uploads pending
+// deletion and uploads whose content was banned after they became ready.
+// Uploads without a state record predate state tracking and are served.
+// Features that hold uploads back require a persistent state store, so
+// they can't lose the state of held uploads. Owners and approvers may download
+// uploads in review, but not through a download token or share link, which
+// delegate the download.
+func (s *Server) downloadGate(ctx context.Context, id string, delegated bool) *rejection.Error {
+	if s.deletions != nil {
+		pending, err := s.deletions.Get(ctx, id)
+		switch {
+		case err == nil:
+			return rejection.New(http.StatusNotFound, rejection.CodeUploadPendingDeletion,
+				"upload was terminated and is pending deletion").
+				WithDetail("deleteAt", pending.DeleteAt)
+		case !errors.Is(err, deletion.ErrNotFound):
+			return s.gateFailed(id, "failed to look up pending deletion", err)
+		}
+	}
+
+	record, err := s.states.Get(ctx, id)
+	switch {
+	case errors.Is(err, uploadstate.ErrNotFound), err == nil && record.State == uploadstate.Ready:
+	case err != nil:
+		return s.gateFailed(id, "failed to look up upload state", err)
+	case record.State.InReview():
+		if !delegated && s.mayReview(ctx, id) {
+			break
+		}
+		return rejection.New(http.StatusNotFound, rejection.CodeUploadInReview, "upload is "+string(record.State)).
+			WithDetail("state", record.State)
+	default:
+		return rejection.New(http.StatusConflict, rejection.CodeUploadNotReady, "upload is "+string(record.State)).
+			WithDetail("state", record.State)
+	}
+
+	if s.bans != nil {
+		if digest := s.knownDigest(ctx, id, record); digest != "" {
+			_, banned, err := s.bans.Match(ctx, digest)
+			if err != nil {
+				return s.gateFailed(id, "failed to check the ban list", err)
+			}
+			if banned {
+				return rejection.New(http.StatusUnavailableForLegalReasons, rejection.CodeContentBanned, "upload content is banned")
+			}
+		}
+	}
+	return nil
+}
+
+// gateFailed logs a download gate failure and refuses the download
+func (s *Server) gateFailed(id, message string, err error) *rejection.Error {
+	slog.Error("Download gate failed", "id", id, "error", err)
+	return rejection.New(http.StatusInternalServerError, rejection.CodeInternalError, message)
+}
+
+// mayReview reports whether the caller is an approver or the owner of an
+// upload
+func (s *Server) mayReview(ctx context.Context, id string) bool {
+	user, err := auth.GetUserFromContext(ctx)
+	return err == nil && (s.approver(user) || s.owns(ctx, user, id))
+}
+
+// downloadGateMiddleware refuses tus GET requests for uploads that can't
+// be downloaded
+func (s *Server) downloadGateMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := strings.Trim(c.Param("any"), "/")
+		if c.Request.Method != http.MethodGet || id == "" {
+			c.Next()
+			return
+		}
+
+		delegated := c.Query(DownloadTokenParam) != "" || c.Query(ShareParam) != ""
+		if rejected := s.downloadGate(c.Request.Context(), id, delegated); rejected != nil {
+			s.abortTus(c, rejected)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/rejection"
+	"github.com/devsnb/large-file-uploads/pkg/uploadstate"
+)
+
+func TestDownloadGate(t *testing.T) {
+	srv, ts := newTestServer(t, func(cfg *config.Config) {
+		cfg.States.Processing = true
+	})
+	id := upload(t, ts, "hello", nil)
+	ctx := context.Background()
+
+	for _, state := range []uploadstate.State{uploadstate.Uploaded, uploadstate.Processing, uploadstate.Quarantined} {
+		if state != uploadstate.Uploaded {
+			if _, err := srv.SetUploadState(ctx, id, state, ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if resp, body := request(t, http.MethodGet, ts.URL+DefaultBasePath+id, nil, ""); resp.StatusCode != http.StatusConflict {
+			t.Fatalf("downloading a %s upload: %d %s", state, resp.StatusCode, body)
+		}
+		if resp, body := request(t, http.MethodPost, ts.URL+"/api/uploads/"+id+"/download-tokens", nil, ""); resp.StatusCode != http.StatusConflict {
+			t.Fatalf("issuing a download token for a %s upload: %d %s", state, resp.StatusCode, body)
+		}
+	}
+
+	if _, err := srv.SetUploadState(ctx, id, uploadstate.Ready, ""); err != nil {
+		t.Fatal(err)
+	}
+	if resp, body := request(t, http.MethodGet, ts.URL+DefaultBasePath+id, nil, ""); resp.StatusCode != http.StatusOK || body != "hello" {
+		t.Fatalf("downloading a ready upload: %d %s", resp.StatusCode, body)
+	}
+	if resp, body := request(t, http.MethodPost, ts.URL+"/api/uploads/"+id+"/download-tokens", nil, ""); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("issuing a download token for a ready upload: %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestDownloadGateReview(t *testing.T) {
+	_, ts := newTestServer(t, func(cfg *config.Config) {
+		cfg.Auth.Enabled = true
+		cfg.Auth.JWTSecret = testSecret
+		cfg.Review.Enabled = true
+		cfg.States.Dir = t.TempDir()
+		cfg.Review.ApproverRole = "reviewer"
+		cfg.Shares.Enabled = true
+		cfg.Shares.TTL = 3600
+	})
+	owner := bearer(t, "alice", "user", "acme")
+	id := upload(t, ts, "hello", owner)
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   int
+	}{
+		{"owner", owner, http.StatusOK},
+		{"admin", bearer(t, "carol", "admin", "acme"), http.StatusOK},
+		{"anonymous", nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if resp, body := request(t, http.MethodGet, ts.URL+DefaultBasePath+id, tt.header, ""); resp.StatusCode != tt.want {
+			t.Errorf("%s downloading an upload pending review: got %d %s, want %d", tt.name, resp.StatusCode, body, tt.want)
+		}
+	}
+
+	// Download tokens and share links delegate the download, so even
+	// owners don't get one
+	for _, path := range []string{"/download-tokens", "/shares"} {
+		if resp, body := request(t, http.MethodPost, ts.URL+"/api/uploads/"+id+path, owner, ""); resp.StatusCode != http.StatusNotFound || !strings.Contains(body, rejection.CodeUploadInReview) {
+			t.Fatalf("POST %s for an upload pending review: %d %s", path, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestDownloadGatePendingDeletion(t *testing.T) {
+	_, ts := newTestServer(t, func(cfg *config.Config) {
+		cfg.Termination.Enabled = true
+		cfg.Termination.GracePeriod = 3600
+	})
+	id := upload(t, ts, "hello", nil)
+
+	resp, body := request(t, http.MethodPost, ts.URL+"/api/uploads/"+id+"/download-tokens", nil, "")
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("issuing a download token: %d %s", resp.StatusCode, body)
+	}
+	var issued struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal([]byte(body), &issued); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp, body := request(t, http.MethodDelete, ts.URL+DefaultBasePath+id, nil, ""); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("terminating: %d %s", resp.StatusCode, body)
+	}
+
+	// Tokens issued before the termination no longer download the upload
+	tests := []struct {
+		name   string
+		method string
+		url    string
+	}{
+		{"downloading", http.MethodGet, ts.URL + DefaultBasePath + id},
+		{"downloading with a token", http.MethodGet, ts.URL + DefaultBasePath + id + "?" + DownloadTokenParam + "=" + issued.Token},
+		{"issuing a download token", http.MethodPost, ts.URL + "/api/uploads/" + id + "/download-tokens"},
+	}
+	for _, tt := range tests {
+		if resp, body := request(t, tt.method, tt.url, nil, ""); resp.StatusCode != http.StatusNotFound || !strings.Contains(body, rejection.CodeUploadPendingDeletion) {
+			t.Errorf("%s an upload pending deletion: %d %s", tt.name, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestDownloadGateBannedContent(t *testing.T) {
+	srv, ts := newTestServer(t, func(cfg *config.Config) {
+		cfg.BanList.Enabled = true
+		cfg.States.Dir = t.TempDir()
+	})
+	id := upload(t, ts, "hello", nil)
+	ctx := context.Background()
+
+	// The ban list check runs in the background
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		record, err := srv.UploadState(ctx, id)
+		if err == nil && record.State == uploadstate.Ready {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("upload didn't become ready: %+v %v", record, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if resp, body := request(t, http.MethodGet, ts.URL+DefaultBasePath+id, nil, ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("downloading a ready upload: %d %s", resp.StatusCode, body)
+	}
+
+	sum := sha256.Sum256([]byte("hello"))
+	if _, err := srv.bans.Add(ctx, hex.EncodeToString(sum[:]), "reported abuse"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct{ method, path string }{
+		{http.MethodGet, DefaultBasePath + id},
+		{http.MethodPost, "/api/uploads/" + id + "/download-tokens"},
+	} {
+		if resp, body := request(t, tt.method, ts.URL+tt.path, nil, ""); resp.StatusCode != http.StatusUnavailableForLegalReasons || !strings.Contains(body, rejection.CodeContentBanned) {
+			t.Errorf("%s %s after banning the content: %d %s", tt.method, tt.path, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestHeldUploadsRequirePersistentStates(t *testing.T) {
+	t.Chdir(t.TempDir())
+	for name, configure := range map[string]func(cfg *config.Config){
+		"antivirus": func(cfg *config.Config) { cfg.Antivirus.Enabled = true },
+		"ban list":  func(cfg *config.Config) { cfg.BanList.Enabled = true },
+		"review": func(cfg *config.Config) {
+			cfg.Auth.Enabled = true
+			cfg.Auth.JWTSecret = testSecret
+			cfg.Review.Enabled = true
+		},
+	} {
+		cfg := &config.Config{}
+		configure(cfg)
+		if _, err := New(cfg, newMemoryStorage(t)); err == nil || !strings.Contains(err.Error(), "states.dir") {
+			t.Errorf("expected %s with in-memory upload states to be refused, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/devsnb/large-file-uploads/pkg/access"
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+	"github.com/devsnb/large-file-uploads/pkg/catalog"
+	"github.com/devsnb/large-file-uploads/pkg/cdn"
+	"github.com/devsnb/large-file-uploads/pkg/events"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// DownloadTokenParam is the query parameter carrying a download token
+const DownloadTokenParam = "token"
+
+// DefaultDownloadTTL is how long download tokens stay valid unless configured
+const DefaultDownloadTTL = 5 * time.Minute
+
+// DefaultDownloadBatch is how many uploads a batch of download URLs may be
+// requested for unless configured
+const DefaultDownloadBatch = 100
+
+// downloadURLConcurrency is how many uploads of a batch are signed at once
+const downloadURLConcurrency = 8
+
+// downloadScope binds signed tokens to downloads
+const downloadScope = "download"
+
+// downloadTokenResponse is returned when a download token is issued
+type downloadTokenResponse struct {
+	Token       string    `json:"token"`
+	DownloadURL string    `json:"downloadUrl"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// downloadURLResponse is returned when a signed download URL is issued
+type downloadURLResponse struct {
+	URL       string    `json:"url"`
+	Region    string    `json:"region,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// downloadURLsRequest is the body of a batch of download URLs
+type downloadURLsRequest struct {
+	IDs []string `json:"ids" binding:"required"`
+}
+
+// downloadURLResult is the download URL of one upload of a batch, or why
+// it has none
+type downloadURLResult struct {
+	ID     string `json:"id"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+	*downloadURLResponse
+}
+
+// createDownloadToken issues a short-lived token allowing downloads of a
+// single upload without an Authorization header, e.g. from <video> tags
+func (s *Server) createDownloadToken(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	if err := s.authorize(ctx, auth.ActionDownload, id); err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := s.uploadInfo(ctx, id); err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if rejected := s.downloadGate(ctx, id, true); rejected != nil {
+		abortAPI(c, rejected)
+		return
+	}
+
+	expiresAt := time.Now().Add(s.downloadTTL()).Truncate(time.Second)
+	token := s.downloadSigner.Sign(downloadScope, s.downloadSubject(ctx, id), expiresAt)
+
+	query := url.Values{DownloadTokenParam: {token}}
+	c.JSON(http.StatusCreated, downloadTokenResponse{
+		Token:       token,
+		DownloadURL: DefaultBasePath + id + "?" + query.Encode(),
+		ExpiresAt:   expiresAt,
+	})
+}
+
+// createDownloadURL returns a signed CDN URL for an upload if a CDN is
+// configured, otherwise a presigned URL downloading it directly from the
+// replica closest to the client
+func (s *Server) createDownloadURL(c *gin.Context) {
+	resp, status, err := s.downloadURL(c, c.Param("id"))
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, resp)
+}
+
+// createDownloadURLs returns download URLs for a batch of uploads, e.g. the
+// thumbnails of a gallery, in one call. Uploads that can't be downloaded
+// are answered with their error instead of failing the batch.
+func (s *Server) createDownloadURLs(c *gin.Context) {
+	var req downloadURLsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Listings may name an upload twice, which is answered once
+	ids := make([]string, 0, len(req.IDs))
+	seen := make(map[string]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if limit := s.downloadBatchLimit(); len(ids) > limit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d uploads per batch", limit)})
+		return
+	}
+
+	// Each upload is looked up in storage, so a few are signed at once
+	results := make([]downloadURLResult, len(ids))
+	var group errgroup.Group
+	group.SetLimit(downloadURLConcurrency)
+	for i, id := range ids {
+		group.Go(func() error {
+			resp, status, err := s.downloadURL(c, id)
+			if err != nil {
+				results[i] = downloadURLResult{ID: id, Status: status, Error: err.Error()}
+				return nil
+			}
+			results[i] = downloadURLResult{ID: id, Status: http.StatusCreated, downloadURLResponse: &resp}
+			return nil
+		})
+	}
+	group.Wait()
+	c.JSON(http.StatusOK, gin.H{"urls": results})
+}
+
+// downloadURL signs a download URL for an upload. On failure, it returns
+// the status the upload is answered with.
+func (s *Server) downloadURL(c *gin.Context, id string) (downloadURLResponse, int, error) {
+	ctx := c.Request.Context()
+
+	if err := s.authorize(ctx, auth.ActionDownload, id); err != nil {
+		return downloadURLResponse{}, uploadErrorStatus(err), err
+	}
+
+	info, err := s.uploadInfo(ctx, id)
+	if err != nil {
+		return downloadURLResponse{}, uploadErrorStatus(err), err
+	}
+	if info.SizeIsDeferred || info.Offset < info.Size {
+		return downloadURLResponse{}, http.StatusConflict, errors.New("upload is not complete")
+	}
+	if rejected := s.downloadGate(ctx, id, true); rejected != nil {
+		return downloadURLResponse{}, rejected.Status, errors.New(rejected.Message)
+	}
+	// Stamped downloads must go through the server
+	if s.stamps != nil {
+		format, err := s.stampFormat(ctx, id)
+		if err != nil {
+			return downloadURLResponse{}, http.StatusInternalServerError, err
+		}
+		if format != "" {
+			return downloadURLResponse{}, http.StatusConflict, errors.New("downloads of this upload are stamped, use a download token instead")
+		}
+	}
+
+	key := storage.ObjectKey(id)
+	if digest := s.contentDigest(ctx, id); digest != "" {
+		key = storage.ContentKey(digest)
+	}
+
+	ttl := s.downloadTTL()
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+
+	var downloadURL, region string
+	if s.cdn != nil {
+		downloadURL, err = s.cdn.SignURL(key, cdn.Options{
+			Expires:      expiresAt,
+			CacheControl: s.cacheControl(info),
+			Filename:     info.MetaData["filename"],
+		})
+	} else {
+		downloadURL, region, err = s.presigner.PresignDownload(ctx, key, storage.PresignOptions{
+			Region:   s.regions.Select(c.Request, s.presigner.Regions()),
+			Filename: info.MetaData["filename"],
+			TTL:      ttl,
+		})
+	}
+	if err != nil {
+		return downloadURLResponse{}, http.StatusInternalServerError, err
+	}
+
+	return downloadURLResponse{
+		URL:       downloadURL,
+		Region:    region,
+		ExpiresAt: expiresAt,
+	}, 0, nil
+}
+
+// downloadSubject returns the subject download tokens are signed for. With
+// download stamps enabled, it carries the user requesting the token, so
+// downloads with the token are stamped with their identity.
+func (s *Server) downloadSubject(ctx context.Context, id string) string {
+	if s.stamps == nil {
+		return id
+	}
+	user, err := auth.GetUserFromContext(ctx)
+	if err != nil {
+		return id
+	}
+	return id + "?" + url.Values{"sub": {user.ID}, "name": {user.Username}, "tenant": {user.Tenant}}.Encode()
+}
+
+// verifyDownloadToken checks that a download token was issued for the upload
+// and returns the user it was issued to, if it carries one
+func (s *Server) verifyDownloadToken(token, id string) (*auth.User, error) {
+	subject, _, err := s.downloadSigner.Verify(token, downloadScope)
+	if err != nil {
+		return nil, err
+	}
+	subject, rawUser, _ := strings.Cut(subject, "?")
+	if subject != id {
+		return nil, errTokenMismatch
+	}
+	if rawUser == "" {
+		return nil, nil
+	}
+	values, err := url.ParseQuery(rawUser)
+	if err != nil {
+		return nil, err
+	}
+	return &auth.User{ID: values.Get("sub"), Username: values.Get("name"), Tenant: values.Get("tenant")}, nil
+}
+
+// downloadBatchLimit returns how many uploads a batch of download URLs may
+// be requested for
+func (s *Server) downloadBatchLimit() int {
+	if s.cfg.Downloads.MaxBatch > 0 {
+		return s.cfg.Downloads.MaxBatch
+	}
+	return DefaultDownloadBatch
+}
+
+// downloadTTL returns the configured download token lifetime
+func (s *Server) downloadTTL() time.Duration {
+	if s.cfg.Downloads.TTL > 0 {
+		return time.Duration(s.cfg.Downloads.TTL) * time.Second
+	}
+	return DefaultDownloadTTL
+}
+
+// downloadTrackingMiddleware counts successful downloads of each upload
+func (s *Server) downloadTrackingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		id := strings.Trim(c.Param("any"), "/")
+		if c.Request.Method != http.MethodGet || id == "" {
+			return
+		}
+		if status := c.Writer.Status(); status == http.StatusOK || status == http.StatusPartialContent {
+			s.access.Record(id, time.Now())
+		}
+	}
+}
+
+// flushDownloads adds a batch of download counts to an upload's catalog
+// entry, cataloging uploads created before the catalog existed
+func (s *Server) flushDownloads(ctx context.Context, id string, hit access.Hit) error {
+	_, err := s.catalog.RecordDownloads(ctx, id, hit.Count, hit.LastAccess)
+	if !errors.Is(err, catalog.ErrNotFound) {
+		return err
+	}
+
+	info, err := s.uploadInfo(ctx, id)
+	if err != nil {
+		// The upload was deleted since it was downloaded
+		return nil
+	}
+	if err := s.catalog.Register(ctx, id, info.MetaData[auth.OwnerMetadataKey], info.MetaData["filename"]); err != nil {
+		return err
+	}
+	_, err = s.catalog.RecordDownloads(ctx, id, hit.Count, hit.LastAccess)
+	return err
+}
+
+// forgetDownloads drops unwritten download counts of terminated uploads
+func (s *Server) forgetDownloads(_ context.Context, e events.Event) error {
+	s.access.Forget(e.Upload.ID)
+	return nil
+}
+
+// downloadStats returns the download count and last access of an upload,
+// including counts not yet written to the catalog
+func (s *Server) downloadStats(ctx context.Context, id string) (int64, *time.Time) {
+	var downloads int64
+	var lastAccess *time.Time
+	if entry, err := s.catalog.Entry(ctx, id); err == nil {
+		downloads, lastAccess = entry.Downloads, entry.LastAccessedAt
+	}
+
+	if pending := s.access.Pending(id); pending.Count > 0 {
+		downloads += pending.Count
+		if lastAccess == nil || pending.LastAccess.After(*lastAccess) {
+			lastAccess = &pending.LastAccess
+		}
+	}
+	return downloads, lastAccess
+}
+
+// statsInterval returns how often download counts are written
+func (s *Server) statsInterval() time.Duration {
+	if s.cfg.Downloads.StatsInterval > 0 {
+		return time.Duration(s.cfg.Downloads.StatsInterval) * time.Second
+	}
+	return access.DefaultFlushInterval
+}
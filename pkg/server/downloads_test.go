@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// presignedStorage is in-memory storage that signs download URLs, and
+// records how many it signed at once
+type presignedStorage struct {
+	*storage.MemoryStorage
+	inflight atomic.Int32
+	peak     atomic.Int32
+}
+
+func (s *presignedStorage) Regions() []string {
+	return []string{"eu-west-1"}
+}
+
+func (s *presignedStorage) PresignDownload(ctx context.Context, key string, opts storage.PresignOptions) (string, string, error) {
+	n := s.inflight.Add(1)
+	defer s.inflight.Add(-1)
+	for peak := s.peak.Load(); n > peak && !s.peak.CompareAndSwap(peak, n); peak = s.peak.Load() {
+	}
+	time.Sleep(20 * time.Millisecond)
+	region := opts.Region
+	if region == "" {
+		region = s.Regions()[0]
+	}
+	return "https://bucket.example.com/" + key, region, nil
+}
+
+func TestCreateDownloadURLs(t *testing.T) {
+	store := &presignedStorage{MemoryStorage: newMemoryStorage(t)}
+	_, ts := newTestServerOn(t, store, nil)
+	var complete []string
+	for range 2 * downloadURLConcurrency {
+		complete = append(complete, upload(t, ts, "hello", nil))
+	}
+	resp, answer := request(t, http.MethodPost, ts.URL+DefaultBasePath, map[string]string{"Upload-Length": "5"}, "")
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("creating upload: %d %s", resp.StatusCode, answer)
+	}
+	location := resp.Header.Get("Location")
+	incomplete := location[strings.LastIndex(location, "/")+1:]
+
+	ids := append([]string{incomplete, "missing", complete[0]}, complete...)
+	body, err := json.Marshal(downloadURLsRequest{IDs: ids})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, answer = request(t, http.MethodPost, ts.URL+"/api/download-urls", map[string]string{"Content-Type": "application/json"}, string(body))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("requesting download URLs: %d %s", resp.StatusCode, answer)
+	}
+	var batch struct {
+		URLs []struct {
+			ID     string `json:"id"`
+			Status int    `json:"status"`
+			URL    string `json:"url"`
+			Region string `json:"region"`
+		} `json:"urls"`
+	}
+	if err := json.Unmarshal([]byte(answer), &batch); err != nil {
+		t.Fatal(err)
+	}
+
+	// Results keep the order of the request, naming each upload once
+	if len(batch.URLs) != len(complete)+2 {
+		t.Fatalf("expected duplicates to be answered once, got %d results", len(batch.URLs))
+	}
+	if r := batch.URLs[0]; r.ID != incomplete || r.Status != http.StatusConflict || r.URL != "" {
+		t.Errorf("expected the incomplete upload to conflict, got %+v", r)
+	}
+	if r := batch.URLs[1]; r.ID != "missing" || r.Status != http.StatusNotFound {
+		t.Errorf("expected the unknown upload not to be found, got %+v", r)
+	}
+	for i, id := range complete {
+		r := batch.URLs[i+2]
+		if r.ID != id || r.Status != http.StatusCreated ||
+			!strings.HasSuffix(r.URL, storage.ObjectKey(id)) || r.Region != "eu-west-1" {
+			t.Errorf("expected a download URL for %s, got %+v", id, r)
+		}
+	}
+
+	if peak := store.peak.Load(); peak < 2 || peak > downloadURLConcurrency {
+		t.Errorf("expected up to %d URLs to be signed at once, got %d", downloadURLConcurrency, peak)
+	}
+}
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devsnb/large-file-uploads/pkg/callback"
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/eventlog"
+	"github.com/devsnb/large-file-uploads/pkg/events"
+	"github.com/devsnb/large-file-uploads/pkg/webhook"
+)
+
+// DefaultEventQueryLimit bounds the records returned by an event query
+// without a limit
+const DefaultEventQueryLimit = 1000
+
+// replayRequest is the body of an event replay
+type replayRequest struct {
+	URL      string        `json:"url" binding:"required"`
+	UploadID string        `json:"uploadId"`
+	From     *time.Time    `json:"from"`
+	To       *time.Time    `json:"to"`
+	Types    []events.Type `json:"types"`
+}
+
+// listEvents returns the recorded events matching the query parameters
+// uploadId, from, to (RFC 3339), type and limit
+func (s *Server) listEvents(c *gin.Context) {
+	filter := eventlog.Filter{
+		UploadID: c.Query("uploadId"),
+		Limit:    DefaultEventQueryLimit,
+	}
+	for _, bound := range []struct {
+		param string
+		value *time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		raw := c.Query(bound.param)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s must be an RFC 3339 time", bound.param)})
+			return
+		}
+		*bound.value = t
+	}
+	for _, raw := range c.QueryArray("type") {
+		for _, eventType := range strings.Split(raw, ",") {
+			filter.Types = append(filter.Types, events.Type(strings.TrimSpace(eventType)))
+		}
+	}
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	records, err := s.eventLog.Query(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": records})
+}
+
+// Replay job states
+const (
+	ReplayRunning   = "running"
+	ReplayCompleted = "completed"
+	ReplayFailed    = "failed"
+)
+
+// maxReplayJobs bounds the replay jobs kept for status queries, oldest
+// finished ones are dropped first
+const maxReplayJobs = 100
+
+// replayJob is an event replay running in the background
+type replayJob struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	URL        string     `json:"url"`
+	Replayed   int        `json:"replayed"`
+	Error      string     `json:"error,omitempty"`
+	FailedSeq  int64      `json:"failedSeq,omitempty"`
+	FailedAt   *time.Time `json:"failedAt,omitempty"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// replayJobs holds the event replays started since the server started
+type replayJobs struct {
+	mu    sync.Mutex
+	jobs  map[string]*replayJob
+	order []string
+}
+
+// add records a started job, dropping the oldest finished ones beyond
+// maxReplayJobs
+func (r *replayJobs) add(job *replayJob) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.jobs == nil {
+		r.jobs = make(map[string]*replayJob)
+	}
+	r.jobs[job.ID] = job
+	r.order = append(r.order, job.ID)
+	for i := 0; len(r.jobs) > maxReplayJobs && i < len(r.order); {
+		if r.jobs[r.order[i]].Status == ReplayRunning {
+			i++
+			continue
+		}
+		delete(r.jobs, r.order[i])
+		r.order = append(r.order[:i], r.order[i+1:]...)
+	}
+}
+
+// get returns a copy of a job
+func (r *replayJobs) get(id string) (replayJob, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[id]
+	if !ok {
+		return replayJob{}, false
+	}
+	return *job, true
+}
+
+// finish records the outcome of a job
+func (r *replayJobs) finish(id string, sent int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job := r.jobs[id]
+	now := time.Now()
+	job.Replayed, job.FinishedAt, job.Status = sent, &now, ReplayCompleted
+	if err == nil {
+		return
+	}
+	job.Status, job.Error = ReplayFailed, err.Error()
+	var replayErr *eventlog.ReplayError
+	if errors.As(err, &replayErr) {
+		job.FailedSeq, job.FailedAt = replayErr.Record.Seq, &replayErr.Record.Time
+	}
+}
+
+// replayEvents starts posting the recorded events matching the request to
+// a webhook, oldest first, and responds with the replay job. A failed
+// replay reports where it stopped, so it can be resumed from there.
+func (s *Server) replayEvents(c *gin.Context) {
+	var req replayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.checkReplayURL(req.URL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter := eventlog.Filter{UploadID: req.UploadID, Types: req.Types}
+	if req.From != nil {
+		filter.From = *req.From
+	}
+	if req.To != nil {
+		filter.To = *req.To
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	job := &replayJob{ID: hex.EncodeToString(id), Status: ReplayRunning, URL: req.URL, StartedAt: time.Now()}
+	s.replays.add(job)
+	sink := eventlog.NewWebhookSink(webhook.NewClient(callback.DefaultTimeout, callback.DefaultMaxRetries), req.URL)
+	started := s.goBackground(func(ctx context.Context) {
+		sent, err := s.eventLog.Replay(ctx, filter, sink)
+		if err != nil {
+			slog.Warn("Event replay failed", "job", job.ID, "url", req.URL, "replayed", sent, "error", err)
+		} else {
+			slog.Info("Event replay completed", "job", job.ID, "url", req.URL, "replayed", sent)
+		}
+		s.replays.finish(job.ID, sent, err)
+	})
+	if !started {
+		s.replays.finish(job.ID, 0, errors.New("server is shutting down"))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "server is shutting down"})
+		return
+	}
+
+	snapshot, _ := s.replays.get(job.ID)
+	c.Header("Location", "/admin/events/replays/"+job.ID)
+	c.JSON(http.StatusAccepted, snapshot)
+}
+
+// getReplayJob returns an event replay job
+func (s *Server) getReplayJob(c *gin.Context) {
+	job, ok := s.replays.get(c.Param("rid"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "replay job not found"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// checkReplayURL requires an http(s) URL, on the callback allowlist when
+// callbacks are enabled
+func (s *Server) checkReplayURL(rawURL string) error {
+	if s.callbacks != nil {
+		return s.callbacks.CheckURL(rawURL)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// newEventLogStore creates a file-backed event log store when a directory
+// is configured and an in-memory one otherwise
+func newEventLogStore(cfg config.EventLogConfig) (eventlog.Store, error) {
+	if cfg.Dir == "" {
+		return eventlog.NewMemoryStore(), nil
+	}
+
+	store, err := eventlog.NewFileStore(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create event log store: %w", err)
+	}
+	return store, nil
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+)
+
+func TestReplayEventsRunsInBackground(t *testing.T) {
+	var received atomic.Int32
+	consumer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		received.Add(1)
+	}))
+	t.Cleanup(consumer.Close)
+
+	srv, ts := newTestServer(t, func(cfg *config.Config) {
+		cfg.Admin.Enabled = true
+		cfg.Admin.Token = "admin-token"
+		cfg.EventLog.Enabled = true
+	})
+	upload(t, ts, "hello", nil)
+
+	admin := map[string]string{"Authorization": "Bearer admin-token", "Content-Type": "application/json"}
+	resp, body := request(t, http.MethodPost, ts.URL+"/admin/events/replay", admin, `{"url": "`+consumer.URL+`"}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected the replay to be accepted, got %d %s", resp.StatusCode, body)
+	}
+
+	var job replayJob
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status != ReplayCompleted && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		resp, body = request(t, http.MethodGet, ts.URL+resp.Header.Get("Location"), admin, "")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected the replay job, got %d %s", resp.StatusCode, body)
+		}
+		if err := json.Unmarshal([]byte(body), &job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if job.Status != ReplayCompleted || job.Replayed != 2 || received.Load() != 2 {
+		t.Fatalf("expected the created and completed events replayed, got %+v and %d received", job, received.Load())
+	}
+
+	// Replays started after shutdown are refused
+	if err := srv.stop(); err != nil {
+		t.Fatal(err)
+	}
+	resp, body = request(t, http.MethodPost, ts.URL+"/admin/events/replay", admin, `{"url": "`+consumer.URL+`"}`)
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected replays to be refused after shutdown, got %d %s", resp.StatusCode, body)
+	}
+}
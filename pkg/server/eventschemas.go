@@ -0,0 +1,33 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devsnb/large-file-uploads/pkg/eventschema"
+	"github.com/devsnb/large-file-uploads/pkg/jws"
+)
+
+// listEventSchemas lists the schemas of the payloads posted to consumers
+func listEventSchemas(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"version": eventschema.Version, "schemas": eventschema.Names()})
+}
+
+// getEventSchema returns the JSON Schema of a payload in the current
+// version
+func getEventSchema(c *gin.Context) {
+	schema, err := eventschema.Schema(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "application/schema+json", schema)
+}
+
+// getJWKS returns the public key callback payloads are signed with as a
+// JSON Web Key Set
+func (s *Server) getJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": []jws.JWK{s.callbackSigner.JWK()}})
+}
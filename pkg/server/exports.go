@@ -0,0 +1,341 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/devsnb/large-file-uploads/pkg/catalog"
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/inventory"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+	"github.com/devsnb/large-file-uploads/pkg/uploadstate"
+)
+
+// exportQuery selects the uploads of an inventory export
+type exportQuery struct {
+	filter        catalog.Filter
+	states        []uploadstate.State
+	createdAfter  time.Time
+	createdBefore time.Time
+}
+
+// createdIn reports whether an upload created at the time is selected
+func (q exportQuery) createdIn(created time.Time) bool {
+	if !q.createdAfter.IsZero() && created.Before(q.createdAfter) {
+		return false
+	}
+	return q.createdBefore.IsZero() || created.Before(q.createdBefore)
+}
+
+// inState reports whether an upload in the state is selected
+func (q exportQuery) inState(state uploadstate.State) bool {
+	return len(q.states) == 0 || slices.Contains(q.states, state)
+}
+
+// exportLookups is how many uploads an export reads from storage at once
+const exportLookups = 16
+
+// exportUploads streams the caller's upload inventory as CSV or NDJSON
+func (s *Server) exportUploads(c *gin.Context) {
+	ctx := c.Request.Context()
+	format, query, ok := s.parseExport(c)
+	if !ok {
+		return
+	}
+
+	writer, _ := inventory.NewWriter(c.Writer, format)
+	c.Header("Content-Type", inventory.ContentType(format))
+	c.Header("Content-Disposition", exportDisposition(time.Now(), format))
+	c.Status(http.StatusOK)
+	if err := s.writeInventory(ctx, query, writer); err != nil {
+		// The response has started, so the client sees a truncated export
+		slog.Warn("Failed to send upload inventory", "error", err)
+		return
+	}
+	if err := writer.Close(); err != nil {
+		slog.Warn("Failed to send upload inventory", "error", err)
+	}
+}
+
+// startExport runs an inventory export in the background and responds with
+// its job
+func (s *Server) startExport(c *gin.Context) {
+	format, query, ok := s.parseExport(c)
+	if !ok {
+		return
+	}
+
+	job, err := s.exports.Start(query.filter.Owner, format, func(ctx context.Context, w inventory.Writer) error {
+		return s.writeInventory(ctx, query, w)
+	})
+	if err != nil {
+		c.JSON(exportErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	slog.Info("Export started", "job", job.ID, "format", format, "owner", job.Owner)
+	c.Header("Location", "/api/exports/jobs/"+job.ID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// parseExport reads the format and filters of an export and checks the
+// caller may see the collection it selects. It responds with an error and
+// returns false if they are invalid.
+func (s *Server) parseExport(c *gin.Context) (string, exportQuery, bool) {
+	ctx := c.Request.Context()
+	owner, all := s.catalogScope(ctx)
+
+	format := c.DefaultQuery("format", inventory.FormatCSV)
+	if !inventory.ValidFormat(format) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("format must be %s or %s", inventory.FormatCSV, inventory.FormatNDJSON)})
+		return "", exportQuery{}, false
+	}
+	query, err := parseExportQuery(c, owner, all)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", exportQuery{}, false
+	}
+	if query.filter.Collection != "" {
+		if _, err := s.authorizeCollection(ctx, query.filter.Collection); err != nil {
+			c.JSON(catalogErrorStatus(err), gin.H{"error": err.Error()})
+			return "", exportQuery{}, false
+		}
+	}
+	return format, query, true
+}
+
+// writeInventory writes a row for each selected upload. The catalog is
+// walked instead of listed, so the inventory is never held in memory; rows
+// are in no particular order. Uploads are filtered by creation time and
+// state before their info is read from storage, and the remaining reads
+// run exportLookups at a time. Uploads terminated since they were listed
+// are skipped.
+func (s *Server) writeInventory(ctx context.Context, query exportQuery, w inventory.Writer) error {
+	var batch []exportRow
+	err := s.catalog.Walk(ctx, query.filter, func(entry catalog.Entry) error {
+		if !query.createdIn(entry.CreatedAt) {
+			return nil
+		}
+		record, err := s.states.Get(ctx, entry.UploadID)
+		if err != nil && !errors.Is(err, uploadstate.ErrNotFound) {
+			return fmt.Errorf("failed to read state of upload %s: %w", entry.UploadID, err)
+		}
+		if !query.inState(record.State) {
+			return nil
+		}
+
+		batch = append(batch, exportRow{entry: entry, state: record.State})
+		if len(batch) < exportLookups {
+			return nil
+		}
+		err = s.writeExportRows(ctx, batch, w)
+		batch = batch[:0]
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return s.writeExportRows(ctx, batch, w)
+}
+
+// exportRow is an upload selected for an export whose info is yet to be
+// read
+type exportRow struct {
+	entry catalog.Entry
+	state uploadstate.State
+	info  tusd.FileInfo
+	gone  bool
+}
+
+// writeExportRows reads the info of the uploads in a batch concurrently
+// and writes their rows in order
+func (s *Server) writeExportRows(ctx context.Context, batch []exportRow, w inventory.Writer) error {
+	group, groupCtx := errgroup.WithContext(ctx)
+	for i := range batch {
+		group.Go(func() error {
+			info, err := s.uploadInfo(groupCtx, batch[i].entry.UploadID)
+			if errors.Is(err, tusd.ErrNotFound) {
+				batch[i].gone = true
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read upload %s: %w", batch[i].entry.UploadID, err)
+			}
+			batch[i].info = info
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return err
+	}
+
+	for _, row := range batch {
+		if row.gone {
+			continue
+		}
+		if err := w.Write(inventoryRow(row)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inventoryRow builds the row of an upload
+func inventoryRow(row exportRow) inventory.Row {
+	size := row.info.Size
+	if row.info.SizeIsDeferred {
+		size = -1
+	}
+	tenant, _ := storage.TenantFromKey(row.info.ID)
+	return inventory.Row{
+		UploadID:     row.entry.UploadID,
+		Tenant:       tenant,
+		Owner:        row.entry.Owner,
+		Filename:     row.entry.Filename,
+		Size:         size,
+		Offset:       row.info.Offset,
+		State:        string(row.state),
+		StorageClass: row.info.MetaData[storage.StorageClassMetadataKey],
+		Tags:         row.entry.Tags,
+		Collections:  row.entry.Collections,
+		Downloads:    row.entry.Downloads,
+		CreatedAt:    row.entry.CreatedAt,
+		UpdatedAt:    row.entry.UpdatedAt,
+
+		OriginIP:      row.info.MetaData[OriginIPMetadataKey],
+		OriginCountry: row.info.MetaData[OriginCountryMetadataKey],
+	}
+}
+
+// getExportJob returns an export job of the caller
+func (s *Server) getExportJob(c *gin.Context) {
+	job, err := s.exports.Get(c.Param("jid"))
+	if err == nil && !s.ownsExport(c.Request.Context(), job) {
+		err = inventory.ErrJobNotFound
+	}
+	if err != nil {
+		c.JSON(exportErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// downloadExport sends the file of a completed export job
+func (s *Server) downloadExport(c *gin.Context) {
+	job, err := s.exports.Get(c.Param("jid"))
+	if err == nil && !s.ownsExport(c.Request.Context(), job) {
+		err = inventory.ErrJobNotFound
+	}
+	if err != nil {
+		c.JSON(exportErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	file, job, err := s.exports.Open(job.ID)
+	if err != nil {
+		c.JSON(exportErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", exportDisposition(job.CreatedAt, job.Format))
+	c.DataFromReader(http.StatusOK, stat.Size(), inventory.ContentType(job.Format), file, nil)
+}
+
+// ownsExport reports whether the caller may see an export job. Admins see
+// every job.
+func (s *Server) ownsExport(ctx context.Context, job inventory.Job) bool {
+	owner, all := s.catalogScope(ctx)
+	return all || job.Owner == owner
+}
+
+// parseExportQuery reads the filters of an export from the query string
+func parseExportQuery(c *gin.Context, owner string, all bool) (exportQuery, error) {
+	query := exportQuery{
+		filter: catalog.Filter{
+			Owner:      owner,
+			AllOwners:  all,
+			Tags:       c.QueryArray("tag"),
+			Collection: c.Query("collection"),
+		},
+	}
+	for _, state := range c.QueryArray("state") {
+		if !uploadstate.State(state).Valid() {
+			return exportQuery{}, fmt.Errorf("unknown state %q", state)
+		}
+		query.states = append(query.states, uploadstate.State(state))
+	}
+
+	var err error
+	if query.createdAfter, err = parseExportTime(c, "createdAfter"); err != nil {
+		return exportQuery{}, err
+	}
+	if query.createdBefore, err = parseExportTime(c, "createdBefore"); err != nil {
+		return exportQuery{}, err
+	}
+	return query, nil
+}
+
+// parseExportTime parses an RFC 3339 time parameter, which may be absent
+func parseExportTime(c *gin.Context, name string) (time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 time", name)
+	}
+	return t, nil
+}
+
+// exportDisposition names the file an export is saved as
+func exportDisposition(at time.Time, format string) string {
+	return fmt.Sprintf(`attachment; filename="uploads-%s.%s"`, at.UTC().Format("2006-01-02"), format)
+}
+
+// exportErrorStatus maps export errors to HTTP status codes
+func exportErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, inventory.ErrJobNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, inventory.ErrJobNotDone):
+		return http.StatusConflict
+	case errors.Is(err, inventory.ErrFormat):
+		return http.StatusBadRequest
+	case errors.Is(err, inventory.ErrTooManyJobs):
+		return http.StatusTooManyRequests
+	case errors.Is(err, inventory.ErrJobsClosed):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// newExportJobs creates the export jobs, or returns nil if they are
+// disabled. Jobs run as background work of the server, so shutdown stops
+// and waits for them.
+func (s *Server) newExportJobs(cfg config.ExportConfig) (*inventory.Jobs, error) {
+	if cfg.Dir == "" {
+		return nil, nil
+	}
+	jobs, err := inventory.NewJobs(cfg.Dir, time.Duration(cfg.Retention)*time.Second, cfg.MaxJobs, s.goBackground)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create export jobs: %w", err)
+	}
+	return jobs, nil
+}
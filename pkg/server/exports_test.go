@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/inventory"
+)
+
+func TestExportUploads(t *testing.T) {
+	_, ts := newTestServer(t, nil)
+	formula := map[string]string{"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("=cmd|' /C calc'!A0"))}
+	id := upload(t, ts, "hello", formula)
+	upload(t, ts, "world", nil)
+
+	resp, body := request(t, http.MethodGet, ts.URL+"/api/exports/uploads", nil, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("exporting: %d %s", resp.StatusCode, body)
+	}
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header and two rows, got %q", body)
+	}
+	if !strings.Contains(body, id+`,,,'=cmd|' /C calc'!A0,5,5,`) {
+		t.Fatalf("expected the formula filename to be quoted, got %q", body)
+	}
+
+	resp, body = request(t, http.MethodGet, ts.URL+"/api/exports/uploads?format=ndjson&state=failed", nil, "")
+	if resp.StatusCode != http.StatusOK || body != "" {
+		t.Fatalf("expected no uploads in the failed state, got %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestExportJobs(t *testing.T) {
+	srv, ts := newTestServer(t, func(cfg *config.Config) {
+		cfg.Exports.Dir = "exports"
+		cfg.Exports.Retention = 60
+		cfg.Exports.MaxJobs = 1
+	})
+	upload(t, ts, "hello", nil)
+
+	// Starting a job is not a side effect of a GET
+	resp, body := request(t, http.MethodGet, ts.URL+"/api/exports/uploads?async=true", nil, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("exporting: %d %s", resp.StatusCode, body)
+	}
+
+	resp, body = request(t, http.MethodPost, ts.URL+"/api/exports?format=ndjson", nil, "")
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("starting an export: %d %s", resp.StatusCode, body)
+	}
+	var job inventory.Job
+	if err := json.Unmarshal([]byte(body), &job); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Header.Get("Location") != "/api/exports/jobs/"+job.ID {
+		t.Fatalf("unexpected location %q", resp.Header.Get("Location"))
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status == inventory.StatusRunning && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		_, body = request(t, http.MethodGet, ts.URL+"/api/exports/jobs/"+job.ID, nil, "")
+		if err := json.Unmarshal([]byte(body), &job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if job.Status != inventory.StatusCompleted || job.Rows != 1 {
+		t.Fatalf("unexpected job %+v", job)
+	}
+	resp, body = request(t, http.MethodGet, ts.URL+"/api/exports/jobs/"+job.ID+"/download", nil, "")
+	if resp.StatusCode != http.StatusOK || strings.Count(body, "\n") != 1 {
+		t.Fatalf("downloading the export: %d %q", resp.StatusCode, body)
+	}
+
+	if err := srv.stop(); err != nil {
+		t.Fatal(err)
+	}
+	resp, body = request(t, http.MethodPost, ts.URL+"/api/exports", nil, "")
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected exports to be refused once stopped, got %d %s", resp.StatusCode, body)
+	}
+}
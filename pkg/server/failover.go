@@ -0,0 +1,71 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// failoverRequest is the body of a manual failover
+type failoverRequest struct {
+	Reason string `json:"reason"`
+}
+
+// getFailover returns which storage backend new uploads are created on
+func (s *Server) getFailover(c *gin.Context) {
+	c.JSON(http.StatusOK, s.failover.FailoverStatus())
+}
+
+// failOver directs new uploads to the secondary backend, for example ahead
+// of primary maintenance
+func (s *Server) failOver(c *gin.Context) {
+	var req failoverRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Reason == "" {
+		req.Reason = "manual failover"
+	}
+
+	if err := s.failover.FailOver(req.Reason); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, s.failover.FailoverStatus())
+}
+
+// failBack directs new uploads to the primary backend again
+func (s *Server) failBack(c *gin.Context) {
+	if err := s.failover.FailBack(); err != nil {
+		c.JSON(failoverErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, s.failover.FailoverStatus())
+}
+
+// reconcileFailover moves completed uploads from the secondary backend to
+// the primary one
+func (s *Server) reconcileFailover(c *gin.Context) {
+	report, err := s.failover.ReconcileFailover(c.Request.Context(), s.lockUpload)
+	if err != nil {
+		c.JSON(failoverErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// failoverErrorStatus maps failover errors to HTTP status codes
+func failoverErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrFailedOver), errors.Is(err, storage.ErrNotFailedOver):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
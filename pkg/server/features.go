@@ -0,0 +1,159 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/features"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// draftInteropHeader marks requests of the IETF resumable uploads draft
+const draftInteropHeader = "Upload-Draft-Interop-Version"
+
+// builtinFeatures are the flags of the subsystems the server gates, with
+// their state when they aren't configured
+var builtinFeatures = []features.Definition{
+	{Name: features.TusV2, Description: "IETF resumable uploads draft alongside tus v1"},
+	{Name: features.Dedup, Description: "Content-addressed storage of completed uploads, with contentAddressing.enabled", Enabled: true},
+}
+
+// featureRequest sets the runtime state of a flag
+type featureRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// newFeatures creates the registry of the built-in flags and the ones the
+// config file adds, which embedders can check through Features
+func newFeatures(cfg *config.Config) (*features.Registry, error) {
+	definitions := make([]features.Definition, 0, len(builtinFeatures)+len(cfg.Features.Flags))
+	for _, flag := range builtinFeatures {
+		if configured, ok := cfg.Features.Flags[flag.Name]; ok {
+			flag.Enabled = configured.Enabled
+			flag.Environments = configured.Environments
+			flag.Tenants = configured.Tenants
+		}
+		definitions = append(definitions, flag)
+	}
+	for name, configured := range cfg.Features.Flags {
+		if name == features.TusV2 || name == features.Dedup {
+			continue
+		}
+		definitions = append(definitions, features.Definition{
+			Name:         name,
+			Enabled:      configured.Enabled,
+			Environments: configured.Environments,
+			Tenants:      configured.Tenants,
+		})
+	}
+
+	var store features.Store = features.NewMemoryStore()
+	if cfg.Features.Dir != "" {
+		fileStore, err := features.NewFileStore(cfg.Features.Dir)
+		if err != nil {
+			return nil, err
+		}
+		store = fileStore
+	}
+	registry, err := features.New(cfg.App.Environment, definitions, store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure feature flags: %w", err)
+	}
+	return registry, nil
+}
+
+// Features returns the feature flags, so embedding applications can gate
+// their own subsystems by environment and tenant
+func (s *Server) Features() *features.Registry {
+	return s.features
+}
+
+// tusV2Gate hides IETF resumable uploads draft requests from the tus
+// handler unless the flag is on for the caller's tenant, so they are
+// answered like any request lacking the tus v1 headers
+func (s *Server) tusV2Gate(c *gin.Context) {
+	if c.Request.Header.Get(draftInteropHeader) == "" {
+		c.Next()
+		return
+	}
+
+	tenant, ok := storage.TenantFromContext(c.Request.Context())
+	if !ok {
+		tenant, _ = storage.TenantFromKey(strings.Trim(c.Param("any"), "/"))
+	}
+	if !s.features.Enabled(c.Request.Context(), features.TusV2, tenant) {
+		c.Request.Header.Del(draftInteropHeader)
+	}
+	c.Next()
+}
+
+// listFeatures returns the state of all flags
+func (s *Server) listFeatures(c *gin.Context) {
+	statuses, err := s.features.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"environment": s.cfg.App.Environment, "features": statuses})
+}
+
+// getFeature returns the state of a flag
+func (s *Server) getFeature(c *gin.Context) {
+	status, err := s.features.Get(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		c.JSON(featureErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// setFeature switches a flag on or off at runtime, for everyone or, with a
+// tenant in the path, for one tenant
+func (s *Server) setFeature(c *gin.Context) {
+	var req featureRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Enabled == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "enabled is required"})
+		return
+	}
+
+	override, err := s.features.Set(c.Request.Context(), c.Param("name"), c.Param("tenant"), *req.Enabled)
+	if err != nil {
+		c.JSON(featureErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	slog.Info("Feature flag overridden", "flag", override.Flag, "tenant", override.Tenant, "enabled", override.Enabled)
+	c.JSON(http.StatusOK, override)
+}
+
+// resetFeature removes a runtime override, returning a flag to its
+// configured state
+func (s *Server) resetFeature(c *gin.Context) {
+	if err := s.features.Reset(c.Request.Context(), c.Param("name"), c.Param("tenant")); err != nil {
+		c.JSON(featureErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	slog.Info("Feature flag override removed", "flag", c.Param("name"), "tenant", c.Param("tenant"))
+	c.Status(http.StatusNoContent)
+}
+
+// featureErrorStatus maps feature flag errors to HTTP status codes
+func featureErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, features.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, features.ErrInvalid):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
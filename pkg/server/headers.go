@@ -0,0 +1,70 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+)
+
+// uiPaths are the path prefixes the Content-Security-Policy is sent on
+var uiPaths = []string{"/demo", "/admin"}
+
+// headersMiddleware adds the configured security headers and the custom
+// headers of matching routes to every response
+func headersMiddleware(cfg config.HeaderConfig) gin.HandlerFunc {
+	hsts := hstsValue(cfg.HSTS)
+
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+
+		if hsts != "" {
+			c.Header("Strict-Transport-Security", hsts)
+		}
+		if cfg.ContentTypeOptions {
+			c.Header("X-Content-Type-Options", "nosniff")
+		}
+		if cfg.ContentSecurityPolicy != "" && hasAnyPrefix(path, uiPaths) {
+			c.Header("Content-Security-Policy", cfg.ContentSecurityPolicy)
+		}
+
+		for _, route := range cfg.Custom {
+			if !strings.HasPrefix(path, route.Path) {
+				continue
+			}
+			for name, value := range route.Headers {
+				c.Header(name, value)
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// hstsValue formats the Strict-Transport-Security header, or returns an
+// empty string if it is disabled
+func hstsValue(cfg config.HSTSConfig) string {
+	if !cfg.Enabled {
+		return ""
+	}
+	value := "max-age=" + strconv.Itoa(cfg.MaxAge)
+	if cfg.IncludeSubDomains {
+		value += "; includeSubDomains"
+	}
+	if cfg.Preload {
+		value += "; preload"
+	}
+	return value
+}
+
+// hasAnyPrefix reports whether the path starts with one of the prefixes
+func hasAnyPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
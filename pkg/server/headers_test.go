@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+)
+
+func TestHeadersMiddleware(t *testing.T) {
+	_, ts := newTestServer(t, func(cfg *config.Config) {
+		cfg.Admin.Enabled = true
+		cfg.Admin.Token = "admin-token"
+		cfg.Headers = config.HeaderConfig{
+			HSTS:                  config.HSTSConfig{Enabled: true, MaxAge: 600, IncludeSubDomains: true},
+			ContentTypeOptions:    true,
+			ContentSecurityPolicy: "default-src 'self'",
+			Custom: []config.RouteHeaderConfig{
+				{Path: DefaultBasePath, Headers: map[string]string{"Cache-Control": "no-store"}},
+			},
+		}
+	})
+
+	resp, _ := request(t, http.MethodOptions, ts.URL+DefaultBasePath, nil, "")
+	if got := resp.Header.Get("Strict-Transport-Security"); got != "max-age=600; includeSubDomains" {
+		t.Errorf("unexpected Strict-Transport-Security %q", got)
+	}
+	if got := resp.Header.Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("unexpected X-Content-Type-Options %q", got)
+	}
+	if got := resp.Header.Get("Cache-Control"); got != "no-store" {
+		t.Errorf("expected the custom header on tus routes, got %q", got)
+	}
+	// The policy only guards the pages served to browsers
+	if got := resp.Header.Get("Content-Security-Policy"); got != "" {
+		t.Errorf("expected no Content-Security-Policy on tus routes, got %q", got)
+	}
+
+	resp, _ = request(t, http.MethodGet, ts.URL+"/admin/intakes", map[string]string{"Authorization": "Bearer admin-token"}, "")
+	if got := resp.Header.Get("Content-Security-Policy"); got != "default-src 'self'" {
+		t.Errorf("expected the Content-Security-Policy on the admin API, got %q", got)
+	}
+	if got := resp.Header.Get("Cache-Control"); got == "no-store" {
+		t.Errorf("expected the custom header only on matching routes")
+	}
+}
+
+func TestHSTSValue(t *testing.T) {
+	tests := []struct {
+		cfg  config.HSTSConfig
+		want string
+	}{
+		{config.HSTSConfig{MaxAge: 600}, ""},
+		{config.HSTSConfig{Enabled: true, MaxAge: 600}, "max-age=600"},
+		{config.HSTSConfig{Enabled: true, MaxAge: 31536000, IncludeSubDomains: true, Preload: true}, "max-age=31536000; includeSubDomains; preload"},
+	}
+	for _, tt := range tests {
+		if got := hstsValue(tt.cfg); got != tt.want {
+			t.Errorf("hstsValue(%+v) = %q, want %q", tt.cfg, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"math"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// DefaultChunkSize is recommended when neither the configuration nor the
+// storage backend prefer a chunk size
+const DefaultChunkSize = 16 << 20
+
+// uploadHints is the response of the upload hints endpoint
+type uploadHints struct {
+	ChunkSize    int64   `json:"chunkSize"`
+	MinChunkSize int64   `json:"minChunkSize,omitempty"`
+	MaxChunkSize int64   `json:"maxChunkSize,omitempty"`
+	Parallelism  int     `json:"parallelism"`
+	MaxSize      int64   `json:"maxSize,omitempty"` // Omitted without a limit
+	Load         float64 `json:"load"`              // Share of the configured capacity in use
+}
+
+// getUploadHints recommends a chunk size, parallelism and maximum size, so
+// clients can tune uploads to the storage backend and the current load
+func (s *Server) getUploadHints(c *gin.Context) {
+	c.JSON(http.StatusOK, s.uploadHints())
+}
+
+// uploadHints computes the upload recommendations for the storage backend
+// and the current load
+func (s *Server) uploadHints() uploadHints {
+	var backend storage.ChunkHints
+	if hinter, ok := storage.Lookup[storage.ChunkHinter](s.store); ok {
+		backend = hinter.ChunkHints()
+	}
+
+	hints := uploadHints{
+		MinChunkSize: backend.MinChunkSize,
+		MaxChunkSize: backend.MaxChunkSize,
+		MaxSize:      minLimit(s.cfg.Policy.MaxSize, backend.MaxUploadSize),
+		Parallelism:  1,
+	}
+
+	// Chunks with a checksum are spooled before they are written
+	if s.cfg.Checksums.Enabled {
+		maxChecksumChunk := s.cfg.Checksums.MaxChunkSize
+		if maxChecksumChunk <= 0 {
+			maxChecksumChunk = DefaultMaxChecksumChunk
+		}
+		hints.MaxChunkSize = minLimit(hints.MaxChunkSize, maxChecksumChunk)
+	}
+
+	hints.ChunkSize = DefaultChunkSize
+	switch {
+	case s.cfg.UploadHints.ChunkSize > 0:
+		hints.ChunkSize = s.cfg.UploadHints.ChunkSize
+	case backend.PreferredChunkSize > 0:
+		hints.ChunkSize = backend.PreferredChunkSize
+	}
+	hints.ChunkSize = max(hints.ChunkSize, hints.MinChunkSize)
+	if hints.MaxChunkSize > 0 {
+		hints.ChunkSize = min(hints.ChunkSize, hints.MaxChunkSize)
+	}
+
+	// Parallel uploads of one file are concatenated afterwards, and fewer
+	// are recommended as the server gets busier
+	if capacity := s.cfg.UploadHints.Capacity; capacity > 0 {
+		hints.Load = min(float64(s.inflightChunks.Load())/float64(capacity), 1)
+	}
+	if s.composer.UsesConcater && s.cfg.UploadHints.MaxParallelism > 1 {
+		scaled := math.Round(float64(s.cfg.UploadHints.MaxParallelism) * (1 - hints.Load))
+		hints.Parallelism = max(int(scaled), 1)
+	}
+	return hints
+}
+
+// loadMiddleware counts the chunk writes in flight, the load the upload
+// hints are scaled by
+func (s *Server) loadMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodPatch {
+			c.Next()
+			return
+		}
+		s.inflightChunks.Add(1)
+		defer s.inflightChunks.Add(-1)
+		c.Next()
+	}
+}
+
+// minLimit returns the smaller of two limits, where zero means no limit
+func minLimit(a, b int64) int64 {
+	switch {
+	case a <= 0:
+		return b
+	case b <= 0:
+		return a
+	default:
+		return min(a, b)
+	}
+}
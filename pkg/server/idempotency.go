@@ -0,0 +1,222 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+	"github.com/devsnb/large-file-uploads/pkg/idempotency"
+	"github.com/devsnb/large-file-uploads/pkg/rejection"
+)
+
+// idempotentBodyLimit bounds the JSON request and response bodies that are
+// hashed and remembered for idempotent requests
+const idempotentBodyLimit = 64 << 10
+
+// fingerprintHeaders are the request headers that, besides method, path and
+// JSON body, identify a request for idempotency
+var fingerprintHeaders = []string{
+	"Upload-Length",
+	"Upload-Defer-Length",
+	"Upload-Metadata",
+	"Upload-Concat",
+}
+
+// idempotencyMiddleware replays the original response to POST requests
+// repeating an Idempotency-Key within the configured window. Only successful
+// responses are remembered, so failed requests can be retried.
+func (s *Server) idempotencyMiddleware(abort func(*gin.Context, *rejection.Error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotency.Header)
+		if key == "" || c.Request.Method != http.MethodPost {
+			c.Next()
+			return
+		}
+
+		if len(key) > idempotency.MaxKeyLength {
+			abort(c, rejection.New(http.StatusBadRequest, rejection.CodeInvalidIdempotencyKey,
+				"Idempotency-Key must be at most 255 characters"))
+			return
+		}
+
+		fingerprint, err := requestFingerprint(c.Request)
+		if err != nil {
+			abort(c, rejection.New(http.StatusBadRequest, rejection.CodeUploadRejected, err.Error()))
+			return
+		}
+
+		// Keys are scoped to the caller so users can't replay each other's
+		// responses. User IDs are only unique within a tenant.
+		scopedKey := key
+		if user, err := auth.GetUserFromContext(c.Request.Context()); err == nil {
+			scopedKey = user.Tenant + "\x00" + user.ID + "\x00" + key
+		}
+
+		cached, err := s.idempotency.Begin(scopedKey, fingerprint)
+		switch {
+		case errors.Is(err, idempotency.ErrKeyReused):
+			abort(c, rejection.New(http.StatusUnprocessableEntity, rejection.CodeIdempotencyKeyReused, err.Error()))
+			return
+		case errors.Is(err, idempotency.ErrInProgress):
+			abort(c, rejection.New(http.StatusConflict, rejection.CodeRequestInProgress, err.Error()))
+			return
+		case cached != nil:
+			replay(c, cached)
+			return
+		}
+
+		writer := &responseRecordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		// Release the key if the handler panics, so the client can retry
+		completed := false
+		defer func() {
+			if !completed {
+				s.idempotency.Release(scopedKey)
+			}
+		}()
+
+		c.Next()
+
+		response, ok := writer.response()
+		if ok && response.Status >= http.StatusOK && response.Status < http.StatusMultipleChoices {
+			s.idempotency.Complete(scopedKey, response)
+			completed = true
+		}
+	}
+}
+
+// replay writes a remembered response
+func replay(c *gin.Context, response *idempotency.Response) {
+	for name, values := range response.Header {
+		c.Writer.Header()[name] = append([]string(nil), values...)
+	}
+	c.Header(idempotency.ReplayedHeader, "true")
+	c.Writer.WriteHeader(response.Status)
+	c.Writer.Write(response.Body)
+	c.Abort()
+}
+
+// abortTus rejects a tus request with a structured JSON body
+func (s *Server) abortTus(c *gin.Context, err *rejection.Error) {
+	tusErr := s.rejections.Render(err)
+	for name, value := range tusErr.HTTPResponse.Header {
+		c.Header(name, value)
+	}
+	c.Header("Tus-Resumable", "1.0.0")
+	c.Writer.WriteHeader(tusErr.HTTPResponse.StatusCode)
+	c.Writer.WriteString(tusErr.HTTPResponse.Body)
+	c.Abort()
+}
+
+// abortAPI rejects a REST API request
+func abortAPI(c *gin.Context, err *rejection.Error) {
+	c.AbortWithStatusJSON(err.Status, gin.H{"error": err.Message, "code": err.Code})
+}
+
+// requestFingerprint identifies a request by its method, path, upload
+// headers and, for JSON requests, a hash of the body
+func requestFingerprint(r *http.Request) (string, error) {
+	var b strings.Builder
+	b.WriteString(r.Method + " " + r.URL.Path)
+	for _, name := range fingerprintHeaders {
+		b.WriteString("\n" + name + ": " + r.Header.Get(name))
+	}
+
+	if r.Body != nil && strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		body, err := io.ReadAll(io.LimitReader(r.Body, idempotentBodyLimit+1))
+		if err != nil {
+			return "", err
+		}
+		if len(body) > idempotentBodyLimit {
+			return "", errors.New("request body is too large for an idempotent request")
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.Sum256(body)
+		b.WriteString("\n" + hex.EncodeToString(sum[:]))
+	}
+
+	return b.String(), nil
+}
+
+// idempotencyWindow returns the configured replay window
+func (s *Server) idempotencyWindow() time.Duration {
+	if s.cfg.Idempotency.Window <= 0 {
+		return idempotency.DefaultWindow
+	}
+	return time.Duration(s.cfg.Idempotency.Window) * time.Second
+}
+
+// responseRecordingWriter records a response so it can be replayed. Headers
+// are captured when the status is written, before outer writers such as
+// the Location signer rewrite them.
+type responseRecordingWriter struct {
+	gin.ResponseWriter
+	header    http.Header
+	body      bytes.Buffer
+	truncated bool
+}
+
+// Unwrap lets tusd extend the read deadline of the connection
+func (w *responseRecordingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// WriteHeader captures the headers and writes the status code
+func (w *responseRecordingWriter) WriteHeader(code int) {
+	if w.header == nil {
+		w.header = w.Header().Clone()
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write captures the body before passing it on
+func (w *responseRecordingWriter) Write(data []byte) (int, error) {
+	if w.header == nil {
+		w.header = w.Header().Clone()
+	}
+	if w.body.Len()+len(data) > idempotentBodyLimit {
+		w.truncated = true
+	} else {
+		w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString captures the body before passing it on
+func (w *responseRecordingWriter) WriteString(data string) (int, error) {
+	return w.Write([]byte(data))
+}
+
+// response returns the recorded response, or false if it can't be replayed
+func (w *responseRecordingWriter) response() (idempotency.Response, bool) {
+	if w.truncated || w.header == nil {
+		return idempotency.Response{}, false
+	}
+
+	header := w.header
+	for _, name := range []string{"Date", "Content-Length", idempotency.ReplayedHeader} {
+		header.Del(name)
+	}
+	// CORS headers are set per request by the CORS middleware
+	for name := range header {
+		if strings.HasPrefix(name, "Access-Control-") {
+			header.Del(name)
+		}
+	}
+
+	return idempotency.Response{
+		Status: w.Status(),
+		Header: header,
+		Body:   w.body.Bytes(),
+	}, true
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/idempotency"
+)
+
+func TestIdempotencyKeysAreScopedToTenants(t *testing.T) {
+	_, ts := newTestServer(t, func(cfg *config.Config) {
+		cfg.Auth.Enabled = true
+		cfg.Auth.JWTSecret = testSecret
+		cfg.Idempotency.Enabled = true
+		cfg.Idempotency.Window = 3600
+	})
+
+	create := func(tenant string) string {
+		t.Helper()
+		header := bearer(t, "alice", "user", tenant)
+		header["Upload-Length"] = "5"
+		header[idempotency.Header] = "retry-1"
+		resp, body := request(t, http.MethodPost, ts.URL+DefaultBasePath, header, "")
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("creating upload for %s: %d %s", tenant, resp.StatusCode, body)
+		}
+		return resp.Header.Get("Location")
+	}
+
+	acme := create("acme")
+	if retried := create("acme"); retried != acme {
+		t.Fatalf("expected a retry to replay %s, got %s", acme, retried)
+	}
+	// The same user ID in another tenant is another user
+	if globex := create("globex"); globex == acme {
+		t.Fatalf("expected another tenant to get its own upload, got %s", globex)
+	}
+}
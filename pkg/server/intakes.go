@@ -0,0 +1,209 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/intake"
+	"github.com/devsnb/large-file-uploads/pkg/rejection"
+)
+
+// IntakeMetadataKey is the metadata field clients create uploads against an
+// intake with
+const IntakeMetadataKey = "intake"
+
+// intakeRequest is the body of an intake creation
+type intakeRequest struct {
+	Name         string     `json:"name" binding:"required"`
+	AllowedTypes []string   `json:"allowedTypes"`
+	MaxSize      int64      `json:"maxSize"`
+	Prefix       string     `json:"prefix"`
+	NotifyURL    string     `json:"notifyUrl"`
+	ExpiresAt    *time.Time `json:"expiresAt"`
+
+	DisableTermination bool `json:"disableTermination"`
+}
+
+// intakeView is what clients may see of an intake: its limits, but not
+// where notifications go
+type intakeView struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	AllowedTypes []string   `json:"allowedTypes,omitempty"`
+	MaxSize      int64      `json:"maxSize,omitempty"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+
+	DisableTermination bool `json:"disableTermination,omitempty"`
+}
+
+// checkIntake resolves the intake an upload is created against, if any, and
+// enforces its limits. Intakes with a size limit require the upload length
+// to be declared at creation.
+func (s *Server) checkIntake(ctx context.Context, info tusd.FileInfo) (*intake.Intake, error) {
+	id := info.MetaData[IntakeMetadataKey]
+	if id == "" {
+		return nil, nil
+	}
+
+	in, err := s.intakes.Resolve(ctx, id)
+	switch {
+	case errors.Is(err, intake.ErrNotFound):
+		return nil, rejection.New(http.StatusBadRequest, rejection.CodeUnknownIntake,
+			fmt.Sprintf("intake %q does not exist", id))
+	case errors.Is(err, intake.ErrExpired):
+		return nil, rejection.New(http.StatusGone, rejection.CodeIntakeExpired,
+			fmt.Sprintf("intake %q has expired", id)).
+			WithDetail("expiresAt", in.ExpiresAt)
+	case err != nil:
+		slog.Error("Failed to load intake", "intake", id, "error", err)
+		return nil, rejection.New(http.StatusInternalServerError, rejection.CodeUploadRejected, "failed to load intake")
+	}
+
+	if in.MaxSize > 0 {
+		if info.SizeIsDeferred {
+			return nil, rejection.New(http.StatusBadRequest, rejection.CodeUploadRejected,
+				"uploads to this intake must declare their length at creation").
+				WithDetail("maxSize", in.MaxSize)
+		}
+		if info.Size > in.MaxSize {
+			return nil, rejection.New(http.StatusRequestEntityTooLarge, rejection.CodeUploadTooLarge,
+				fmt.Sprintf("upload size %d exceeds the maximum of %d bytes", info.Size, in.MaxSize)).
+				WithDetail("size", info.Size).
+				WithDetail("maxSize", in.MaxSize)
+		}
+	}
+
+	if len(in.AllowedTypes) > 0 {
+		fileType := uploadFileType(info)
+		if !typeAllowed(fileType, in.AllowedTypes) {
+			return nil, rejection.New(http.StatusUnsupportedMediaType, rejection.CodeFileTypeNotAllowed,
+				fmt.Sprintf("file type %q is not allowed", fileType)).
+				WithDetail("type", fileType).
+				WithDetail("allowedTypes", in.AllowedTypes)
+		}
+	}
+
+	return &in, nil
+}
+
+// createIntake defines a new intake
+func (s *Server) createIntake(c *gin.Context) {
+	var req intakeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.NotifyURL != "" {
+		if s.callbacks == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "notifyUrl requires callbacks to be enabled"})
+			return
+		}
+		if err := s.callbacks.CheckURL(req.NotifyURL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	created, err := s.intakes.Create(c.Request.Context(), intake.Intake{
+		Name:         req.Name,
+		AllowedTypes: req.AllowedTypes,
+		MaxSize:      req.MaxSize,
+		Prefix:       req.Prefix,
+		NotifyURL:    req.NotifyURL,
+		ExpiresAt:    req.ExpiresAt,
+
+		DisableTermination: req.DisableTermination,
+	})
+	if err != nil {
+		c.JSON(intakeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	slog.Info("Intake created", "intake", created.ID, "name", created.Name)
+	c.JSON(http.StatusCreated, created)
+}
+
+// listIntakes returns all intakes, including expired ones
+func (s *Server) listIntakes(c *gin.Context) {
+	intakes, err := s.intakes.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"intakes": intakes})
+}
+
+// getIntake returns a single intake
+func (s *Server) getIntake(c *gin.Context) {
+	in, err := s.intakes.Get(c.Request.Context(), c.Param("iid"))
+	if err != nil {
+		c.JSON(intakeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, in)
+}
+
+// deleteIntake removes an intake, keeping the uploads created against it
+func (s *Server) deleteIntake(c *gin.Context) {
+	if err := s.intakes.Delete(c.Request.Context(), c.Param("iid")); err != nil {
+		c.JSON(intakeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// getIntakeLimits returns the limits of an open intake, so clients can check
+// files before uploading them
+func (s *Server) getIntakeLimits(c *gin.Context) {
+	in, err := s.intakes.Resolve(c.Request.Context(), c.Param("iid"))
+	if err != nil {
+		c.JSON(intakeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, intakeView{
+		ID:           in.ID,
+		Name:         in.Name,
+		AllowedTypes: in.AllowedTypes,
+		MaxSize:      in.MaxSize,
+		ExpiresAt:    in.ExpiresAt,
+
+		DisableTermination: in.DisableTermination,
+	})
+}
+
+// intakeErrorStatus maps intake errors to HTTP status codes
+func intakeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, intake.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, intake.ErrExpired):
+		return http.StatusGone
+	case errors.Is(err, intake.ErrInvalid):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// newIntakeStore creates a file-backed intake store when a directory is
+// configured and an in-memory one otherwise
+func newIntakeStore(cfg config.IntakeConfig) (intake.Store, error) {
+	if cfg.Dir == "" {
+		return intake.NewMemoryStore(), nil
+	}
+
+	store, err := intake.NewFileStore(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create intake store: %w", err)
+	}
+	return store, nil
+}
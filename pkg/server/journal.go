@@ -0,0 +1,215 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/events"
+	"github.com/devsnb/large-file-uploads/pkg/journal"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// journalReport is the outcome of the last reconciliation of the journal
+type journalReport struct {
+	mu           sync.Mutex
+	reconciledAt time.Time
+	divergences  []journal.Divergence
+}
+
+// journalMiddleware records every acknowledged chunk in the journal before
+// the acknowledgement is sent, together with the SHA-256 digest of the chunk
+func (s *Server) journalMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := strings.Trim(c.Param("any"), "/")
+		if c.Request.Method != http.MethodPatch || id == "" {
+			c.Next()
+			return
+		}
+		offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		body := &hashingBody{ReadCloser: c.Request.Body, hash: sha256.New()}
+		c.Request.Body = body
+		c.Writer = &journalingWriter{
+			ResponseWriter: c.Writer,
+			journal:        s.journal,
+			id:             id,
+			offset:         offset,
+			body:           body,
+		}
+		c.Next()
+	}
+}
+
+// hashingBody hashes a request body as it is read
+type hashingBody struct {
+	io.ReadCloser
+	hash hash.Hash
+	read int64
+}
+
+func (b *hashingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.hash.Write(p[:n])
+	b.read += int64(n)
+	return n, err
+}
+
+// journalingWriter journals a successful PATCH when its status is written,
+// before the response reaches the client
+type journalingWriter struct {
+	gin.ResponseWriter
+	journal   *journal.Journal
+	id        string
+	offset    int64
+	body      *hashingBody
+	journaled bool
+}
+
+// Unwrap lets tusd extend the read deadline of the connection
+func (w *journalingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *journalingWriter) WriteHeader(code int) {
+	if code == http.StatusNoContent && !w.journaled {
+		w.journaled = true
+		w.ack()
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// ack journals the chunk. The digest is only recorded if exactly the bytes
+// of the chunk were read from the body.
+func (w *journalingWriter) ack() {
+	newOffset, err := strconv.ParseInt(w.Header().Get("Upload-Offset"), 10, 64)
+	if err != nil || newOffset < w.offset {
+		return
+	}
+
+	entry := journal.Entry{
+		UploadID: w.id,
+		Offset:   newOffset,
+		Length:   newOffset - w.offset,
+		Time:     time.Now(),
+	}
+	if w.body.read == entry.Length {
+		entry.Checksum = hex.EncodeToString(w.body.hash.Sum(nil))
+	}
+
+	// The chunk is stored already, so a failure to journal it doesn't fail
+	// the request
+	if err := w.journal.Ack(entry); err != nil {
+		slog.Error("Failed to journal chunk acknowledgement", "id", w.id, "offset", newOffset, "error", err)
+	}
+}
+
+// reconcileJournal compares the journal to the backend after a restart and
+// reports uploads whose stored offset differs from the acknowledged one
+func (s *Server) reconcileJournal(ctx context.Context) {
+	pending := len(s.journal.Pending())
+	if pending == 0 {
+		return
+	}
+	slog.Info("Reconciling upload journal", "uploads", pending)
+
+	divergences, err := s.journal.Reconcile(ctx, s.lockUpload, s.storedOffset)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		slog.Error("Failed to reconcile upload journal", "error", err)
+	}
+
+	for _, divergence := range divergences {
+		s.divergences.Inc(divergence.Kind)
+		attrs := []any{
+			"id", divergence.UploadID,
+			"acknowledged", divergence.Acknowledged,
+			"stored", divergence.Stored,
+			"lastChunkChecksum", divergence.LastChunk.Checksum,
+		}
+		if divergence.Kind == journal.DivergenceLost {
+			slog.Error("Acknowledged upload data is missing from storage, the client has to resend it", attrs...)
+		} else {
+			slog.Warn("Storage holds upload data that was never acknowledged", attrs...)
+		}
+	}
+
+	s.journalReport.mu.Lock()
+	s.journalReport.reconciledAt = time.Now()
+	s.journalReport.divergences = divergences
+	s.journalReport.mu.Unlock()
+}
+
+// storedOffset returns the offset of an upload in the backend
+func (s *Server) storedOffset(ctx context.Context, id string) (int64, error) {
+	if tenant, ok := storage.TenantFromKey(id); ok {
+		ctx = storage.WithTenant(ctx, tenant)
+	}
+
+	info, err := s.uploadInfo(ctx, id)
+	if errors.Is(err, tusd.ErrNotFound) {
+		return 0, journal.ErrUploadFinished
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !info.SizeIsDeferred && info.Offset == info.Size {
+		return 0, journal.ErrUploadFinished
+	}
+	return info.Offset, nil
+}
+
+// forgetJournal ends the journal of a completed or terminated upload
+func (s *Server) forgetJournal(ctx context.Context, event events.Event) error {
+	return s.journal.Forget(event.Upload.ID)
+}
+
+// getJournal returns the uploads being journaled and the divergences found
+// by the last reconciliation
+func (s *Server) getJournal(c *gin.Context) {
+	s.journalReport.mu.Lock()
+	defer s.journalReport.mu.Unlock()
+
+	body := gin.H{
+		"pending":     len(s.journal.Pending()),
+		"divergences": append([]journal.Divergence{}, s.journalReport.divergences...),
+	}
+	if !s.journalReport.reconciledAt.IsZero() {
+		body["reconciledAt"] = s.journalReport.reconciledAt
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+// newJournal opens the journal of chunk acknowledgements, or returns nil if
+// journaling is disabled
+func newJournal(cfg config.JournalConfig) (*journal.Journal, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("the upload journal requires a directory")
+	}
+
+	j, err := journal.Open(cfg.Dir, cfg.Sync)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload journal: %w", err)
+	}
+	return j, nil
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultShutdownTimeout bounds draining and stopping when no shutdown
+// timeout is configured
+const DefaultShutdownTimeout = 30 * time.Second
+
+// Hook is called at a lifecycle phase of the server. Embedding applications
+// use hooks to open, drain and close their own resources together with the
+// upload server.
+type Hook func(ctx context.Context) error
+
+// lifecycle holds the hooks registered for each phase
+type lifecycle struct {
+	mu    sync.Mutex
+	start []Hook
+	ready []Hook
+	drain []Hook
+	stop  []Hook
+}
+
+// OnStart registers a hook that runs before the server listens. An error
+// aborts the start; the stop hooks still run to release what was acquired.
+func (s *Server) OnStart(hook Hook) {
+	s.hooks.mu.Lock()
+	defer s.hooks.mu.Unlock()
+	s.hooks.start = append(s.hooks.start, hook)
+}
+
+// OnReady registers a hook that runs once the server accepts connections.
+// An error shuts the server down again.
+func (s *Server) OnReady(hook Hook) {
+	s.hooks.mu.Lock()
+	defer s.hooks.mu.Unlock()
+	s.hooks.ready = append(s.hooks.ready, hook)
+}
+
+// OnDrain registers a hook that runs when shutdown begins, while in-flight
+// requests still complete. The health check reports the server as draining
+// from then on.
+func (s *Server) OnDrain(hook Hook) {
+	s.hooks.mu.Lock()
+	defer s.hooks.mu.Unlock()
+	s.hooks.drain = append(s.hooks.drain, hook)
+}
+
+// OnStop registers a hook that runs after all requests have completed and
+// pending download statistics are written. Stop hooks run in reverse order
+// of registration, so resources are released in the opposite order they
+// were acquired in.
+func (s *Server) OnStop(hook Hook) {
+	s.hooks.mu.Lock()
+	defer s.hooks.mu.Unlock()
+	s.hooks.stop = append(s.hooks.stop, hook)
+}
+
+// Serve runs the server on the given address until the context is canceled,
+// then shuts it down gracefully
+func (s *Server) Serve(ctx context.Context, addr string) error {
+	s.hooks.mu.Lock()
+	start := slices.Clone(s.hooks.start)
+	ready := slices.Clone(s.hooks.ready)
+	s.hooks.mu.Unlock()
+
+	if err := runHooks(ctx, "start", start); err != nil {
+		return errors.Join(err, s.stop())
+	}
+	if err := s.checkRequiredReadiness(); err != nil {
+		return errors.Join(err, s.stop())
+	}
+	if s.repairsStorage {
+		slog.Info("Repairing uploads in storage before serving")
+		select {
+		case <-s.reconciled:
+		case <-ctx.Done():
+			return errors.Join(ctx.Err(), s.stop())
+		}
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to listen on %s: %w", addr, err), s.stop())
+	}
+
+	httpServer := &http.Server{Handler: s.router, TLSConfig: s.tlsConfig}
+	served := make(chan error, 1)
+	go func() {
+		if s.tlsConfig != nil {
+			served <- httpServer.ServeTLS(listener, "", "")
+			return
+		}
+		served <- httpServer.Serve(listener)
+	}()
+	slog.Info("Server listening", "addr", listener.Addr().String(), "tls", s.tlsConfig != nil)
+
+	var serveErr error
+	if err := runHooks(ctx, "ready", ready); err != nil {
+		serveErr = err
+	} else {
+		select {
+		case <-ctx.Done():
+		case err := <-served:
+			if !errors.Is(err, http.ErrServerClosed) {
+				serveErr = fmt.Errorf("server failed: %w", err)
+			}
+		}
+	}
+
+	return errors.Join(serveErr, s.shutdown(httpServer))
+}
+
+// shutdown drains the server, waits for in-flight requests and runs the stop
+// hooks, all within the shutdown timeout
+func (s *Server) shutdown(httpServer *http.Server) error {
+	slog.Info("Server shutting down")
+	s.draining.Store(true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout())
+	defer cancel()
+
+	s.hooks.mu.Lock()
+	drain := slices.Clone(s.hooks.drain)
+	s.hooks.mu.Unlock()
+
+	var errs []error
+	if err := runHooks(ctx, "drain", drain); err != nil {
+		errs = append(errs, err)
+	}
+	if err := httpServer.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to drain requests: %w", err))
+	}
+	errs = append(errs, s.stopWithin(ctx))
+	return errors.Join(errs...)
+}
+
+// stop stops the background work and runs the stop hooks
+func (s *Server) stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout())
+	defer cancel()
+	return s.stopWithin(ctx)
+}
+
+// stopWithin writes pending download statistics, closes the upload journal
+// and runs the stop hooks in reverse order. All stop hooks run, even if some fail.
+func (s *Server) stopWithin(ctx context.Context) error {
+	s.stopBackground()
+	select {
+	case <-s.backgroundDone:
+	case <-ctx.Done():
+		slog.Warn("Timed out writing download statistics")
+	}
+
+	if s.journal != nil {
+		if err := s.journal.Close(); err != nil {
+			slog.Error("Failed to close upload journal", "error", err)
+		}
+	}
+
+	s.hooks.mu.Lock()
+	stop := slices.Clone(s.hooks.stop)
+	s.hooks.mu.Unlock()
+
+	var errs []error
+	for i := len(stop) - 1; i >= 0; i-- {
+		if err := stop[i](ctx); err != nil {
+			slog.Error("Stop hook failed", "error", err)
+			errs = append(errs, fmt.Errorf("stop hook failed: %w", err))
+		}
+	}
+	slog.Info("Server stopped")
+	return errors.Join(errs...)
+}
+
+// runHooks runs hooks in order, stopping at the first error
+func runHooks(ctx context.Context, phase string, hooks []Hook) error {
+	for _, hook := range hooks {
+		if err := hook(ctx); err != nil {
+			slog.Error("Lifecycle hook failed", "phase", phase, "error", err)
+			return fmt.Errorf("%s hook failed: %w", phase, err)
+		}
+	}
+	return nil
+}
+
+// shutdownTimeout returns how long draining and stopping may take
+func (s *Server) shutdownTimeout() time.Duration {
+	if s.cfg.App.ShutdownTimeout > 0 {
+		return time.Duration(s.cfg.App.ShutdownTimeout) * time.Second
+	}
+	return DefaultShutdownTimeout
+}
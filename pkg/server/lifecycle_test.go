@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// phases records the lifecycle hooks that ran, in order
+type phases struct {
+	mu  sync.Mutex
+	ran []string
+}
+
+func (p *phases) hook(name string, err error) Hook {
+	return func(ctx context.Context) error {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.ran = append(p.ran, name)
+		return err
+	}
+}
+
+func (p *phases) String() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return strings.Join(p.ran, ",")
+}
+
+func TestServeRunsLifecycleHooks(t *testing.T) {
+	srv, _ := newTestServer(t, nil)
+	var p phases
+	srv.OnStart(p.hook("start", nil))
+	srv.OnStop(p.hook("stop1", nil))
+	srv.OnStop(p.hook("stop2", nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ready := make(chan struct{})
+	srv.OnReady(func(ctx context.Context) error {
+		close(ready)
+		return p.hook("ready", nil)(ctx)
+	})
+
+	// The health check reports the server as draining from the first
+	// drain hook on
+	var health int
+	srv.OnDrain(func(ctx context.Context) error {
+		rec := httptest.NewRecorder()
+		srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		health = rec.Code
+		return p.hook("drain", nil)(ctx)
+	})
+
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ctx, "127.0.0.1:0") }()
+	select {
+	case <-ready:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the server to become ready")
+	}
+	cancel()
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+
+	if got := p.String(); got != "start,ready,drain,stop2,stop1" {
+		t.Fatalf("expected hooks in lifecycle order with stop hooks reversed, got %s", got)
+	}
+	if health != http.StatusServiceUnavailable {
+		t.Fatalf("expected the health check to report draining, got %d", health)
+	}
+}
+
+func TestServeStopsWhenStartHookFails(t *testing.T) {
+	srv, _ := newTestServer(t, nil)
+	var p phases
+	failed := errors.New("database unavailable")
+	srv.OnStart(p.hook("start1", nil))
+	srv.OnStart(p.hook("start2", failed))
+	srv.OnStart(p.hook("start3", nil))
+	srv.OnReady(p.hook("ready", nil))
+	srv.OnStop(p.hook("stop", nil))
+
+	err := srv.Serve(context.Background(), "127.0.0.1:0")
+	if !errors.Is(err, failed) {
+		t.Fatalf("expected the start hook error, got %v", err)
+	}
+	// Stop hooks still release what the earlier start hooks acquired
+	if got := p.String(); got != "start1,start2,stop" {
+		t.Fatalf("expected the start to be aborted, got %s", got)
+	}
+}
+
+func TestServeShutsDownWhenReadyHookFails(t *testing.T) {
+	srv, _ := newTestServer(t, nil)
+	var p phases
+	failed := errors.New("registration failed")
+	srv.OnReady(p.hook("ready", failed))
+	srv.OnDrain(p.hook("drain", nil))
+	srv.OnStop(p.hook("stop", nil))
+
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(context.Background(), "127.0.0.1:0") }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, failed) {
+			t.Fatalf("expected the ready hook error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a failed ready hook to shut the server down")
+	}
+	if got := p.String(); got != "ready,drain,stop" {
+		t.Fatalf("expected the server to drain and stop, got %s", got)
+	}
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devsnb/large-file-uploads/pkg/logging"
+)
+
+// logLevelState tracks a temporary change of the log level. Every change
+// bumps the generation, so a restore whose timer already fired when a later
+// change stopped it does nothing.
+type logLevelState struct {
+	mu         sync.Mutex
+	generation uint64
+	reset      *time.Timer
+	resetAt    time.Time
+	previous   slog.Level
+}
+
+// logLevelRequest is the body of a log level change
+type logLevelRequest struct {
+	Level    string `json:"level" binding:"required"`
+	Duration int    `json:"duration"` // seconds until the previous level is restored, 0 to keep the level
+}
+
+// SetLogLevel changes the level of the loggers created by logging.New
+// while the server runs. With a positive duration, the previous level is
+// restored afterwards. A change cancels the restore of an earlier one.
+func (s *Server) SetLogLevel(level slog.Level, duration time.Duration) {
+	s.logLevel.mu.Lock()
+	defer s.logLevel.mu.Unlock()
+
+	previous := logging.Level.Level()
+	if s.logLevel.reset != nil {
+		s.logLevel.reset.Stop()
+		s.logLevel.reset, s.logLevel.resetAt = nil, time.Time{}
+		previous = s.logLevel.previous
+	}
+
+	s.logLevel.generation++
+	logging.Level.Set(level)
+	slog.Warn("Log level changed", "level", logging.LevelName(level), "duration", duration)
+
+	if duration > 0 {
+		generation := s.logLevel.generation
+		s.logLevel.previous = previous
+		s.logLevel.resetAt = time.Now().Add(duration)
+		s.logLevel.reset = time.AfterFunc(duration, func() {
+			s.logLevel.mu.Lock()
+			defer s.logLevel.mu.Unlock()
+			if s.logLevel.generation != generation {
+				// Superseded by a later change while waiting for the lock
+				return
+			}
+			logging.Level.Set(previous)
+			s.logLevel.reset, s.logLevel.resetAt = nil, time.Time{}
+			slog.Warn("Log level restored", "level", logging.LevelName(previous))
+		})
+	}
+}
+
+// getLogLevel returns the current log level and when a temporary change
+// ends
+func (s *Server) getLogLevel(c *gin.Context) {
+	s.logLevel.mu.Lock()
+	defer s.logLevel.mu.Unlock()
+
+	resp := gin.H{"level": logging.LevelName(logging.Level.Level())}
+	if s.logLevel.reset != nil {
+		resp["resetAt"] = s.logLevel.resetAt
+		resp["resetTo"] = logging.LevelName(s.logLevel.previous)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// setLogLevel changes the log level, optionally for a limited time
+func (s *Server) setLogLevel(c *gin.Context) {
+	var req logLevelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	level, ok := logging.LookupLevel(req.Level)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "level must be debug, info, warn or error"})
+		return
+	}
+	if req.Duration < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "duration must not be negative"})
+		return
+	}
+
+	s.SetLogLevel(level, time.Duration(req.Duration)*time.Second)
+	s.getLogLevel(c)
+}
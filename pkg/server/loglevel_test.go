@@ -0,0 +1,40 @@
+package server
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/devsnb/large-file-uploads/pkg/logging"
+)
+
+func TestSupersededLogLevelRestoreIsIgnored(t *testing.T) {
+	srv, _ := newTestServer(t, nil)
+	initial := logging.Level.Level()
+	t.Cleanup(func() { logging.Level.Set(initial) })
+
+	srv.SetLogLevel(slog.LevelDebug, time.Millisecond)
+
+	// The restore fires while a later change holds the lock, too late for
+	// the change to stop its timer
+	srv.logLevel.mu.Lock()
+	time.Sleep(50 * time.Millisecond)
+	srv.logLevel.generation++
+	logging.Level.Set(slog.LevelWarn)
+	srv.logLevel.reset, srv.logLevel.resetAt = nil, time.Time{}
+	srv.logLevel.mu.Unlock()
+
+	time.Sleep(50 * time.Millisecond)
+	if level := logging.Level.Level(); level != slog.LevelWarn {
+		t.Fatalf("expected the later level to stay, got %s", logging.LevelName(level))
+	}
+
+	srv.SetLogLevel(slog.LevelError, time.Millisecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for logging.Level.Level() != slog.LevelWarn && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if level := logging.Level.Level(); level != slog.LevelWarn {
+		t.Fatalf("expected the level to be restored, got %s", logging.LevelName(level))
+	}
+}
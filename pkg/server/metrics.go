@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/tus/tusd/v2/pkg/prometheuscollector"
+
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+	"github.com/devsnb/large-file-uploads/pkg/events"
+	"github.com/devsnb/large-file-uploads/pkg/metrics"
+)
+
+// metricsHandler serves the tus request metrics, the upload request latency
+// and lifecycle histograms, the upload backlog gauges, the storage throttle,
+// panic, journal divergence and antivirus scan counters and the Go runtime
+// metrics. Each server uses its own registry so several can be embedded in
+// one process.
+func (s *Server) metricsHandler() http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		prometheuscollector.New(s.tusHandler.Metrics),
+		metrics.NewCollector(s.states, s.deadLetters, time.Duration(s.cfg.Metrics.StaleAfter)*time.Second),
+		s.throttles,
+		s.panics,
+		s.divergences,
+		s.scans,
+		s.requests,
+		s.lifecycles,
+	)
+	if s.cfg.Costs.Enabled {
+		registry.MustRegister(metrics.NewCosts(s.latestCosts, s.cfg.Metrics.MaxTenants))
+	}
+	if s.tusdHooks != nil {
+		registry.MustRegister(s.tusdHooks.metrics)
+	}
+
+	// Exemplars are only exposed in the OpenMetrics format
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{EnableOpenMetrics: s.cfg.Metrics.Exemplars})
+}
+
+// requestMetricsMiddleware measures the latency of upload requests. With
+// exemplars enabled, the trace ID of the request's traceparent header is
+// attached, so a latency spike leads to the traces behind it.
+func (s *Server) requestMetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		var traceID string
+		if s.cfg.Metrics.Exemplars {
+			traceID = metrics.TraceID(c.GetHeader(metrics.TraceParentHeader))
+		}
+		s.requests.Observe(c.Request.Method, c.Writer.Status(), time.Since(start), traceID)
+	}
+}
+
+// lifecycleMetricsMiddleware tracks the uploads this instance creates and
+// the data clients send for them, and observes the lifecycle histograms
+// once an upload completes
+func (s *Server) lifecycleMetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := strings.Trim(c.Param("any"), "/")
+		creation := c.Request.Method == http.MethodPost && id == ""
+		if !creation && c.Request.Method != http.MethodPatch {
+			c.Next()
+			return
+		}
+
+		body := &countingReader{ReadCloser: c.Request.Body}
+		c.Request.Body = body
+		c.Next()
+
+		if creation {
+			if c.Writer.Status() != http.StatusCreated {
+				return
+			}
+			id = path.Base(c.Writer.Header().Get("Location"))
+			size := int64(-1)
+			if c.GetHeader("Upload-Defer-Length") != "1" {
+				size, _ = strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+			}
+			s.lifecycles.Start(id, lifecycleTenant(c.Request.Context()), size)
+			if c.Writer.Header().Get("Upload-Offset") == "" {
+				return
+			}
+		} else if length := c.GetHeader("Upload-Length"); length != "" {
+			if size, err := strconv.ParseInt(length, 10, 64); err == nil {
+				s.lifecycles.DeclareSize(id, size)
+			}
+		}
+
+		// Failed requests count as chunks too, as their data was sent
+		offset, err := strconv.ParseInt(c.Writer.Header().Get("Upload-Offset"), 10, 64)
+		if err != nil {
+			offset = -1
+		}
+		s.lifecycles.Transfer(id, body.n, offset)
+	}
+}
+
+// lifecycleTenant returns the tenant lifecycle histograms label an upload
+// created by the caller with
+func lifecycleTenant(ctx context.Context) string {
+	if user, err := auth.GetUserFromContext(ctx); err == nil {
+		return user.Tenant
+	}
+	return ""
+}
+
+// forgetLifecycle stops tracking terminated uploads
+func (s *Server) forgetLifecycle(_ context.Context, e events.Event) error {
+	s.lifecycles.Forget(e.Upload.ID)
+	return nil
+}
+
+// countingReader counts the bytes read from a request body
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+// Read implements io.Reader
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
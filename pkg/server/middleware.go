@@ -0,0 +1,139 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/logging"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// requestLoggerMiddleware returns a gin middleware for logging HTTP requests
+// and responses, hiding the request details the redaction rules ask for.
+// Headers and query parameters are logged once the request was handled, so
+// the rules see who made it. clientIP returns the address logged for a
+// request.
+func requestLoggerMiddleware(cfg config.LoggingConfig, clientIP func(*gin.Context) string) gin.HandlerFunc {
+	redactor := newRedactor(cfg)
+	return func(c *gin.Context) {
+		// Start timer
+		start := time.Now()
+		path := c.Request.URL.Path
+
+		// Log request
+		slog.Info("Request received",
+			"method", c.Request.Method,
+			"path", path,
+			"client_ip", clientIP(c),
+			"user_agent", c.Request.UserAgent(),
+		)
+
+		// Process request
+		c.Next()
+
+		// Hide sensitive headers and parameters, now that the request is
+		// authenticated
+		redaction := redactor.Match(redactionSubject(c))
+		query := redactQuery(redaction.Query(c.Request.URL.Query()))
+		headers := redaction.Headers(c.Request.Header)
+
+		// Calculate request duration
+		duration := time.Since(start)
+
+		// Get response status
+		statusCode := c.Writer.Status()
+		statusClass := statusCode / 100
+
+		// Log level based on status code. Clients going away mid-chunk are
+		// expected, so their requests are not logged as failures.
+		aborted := clientAbort(c) != nil
+		var logFn func(msg string, args ...any)
+		switch {
+		case aborted:
+			logFn = slog.Info
+		case statusClass == 5: // 5xx
+			logFn = slog.Error
+		case statusClass == 4: // 4xx
+			// Filter common errors that we don't want to spam logs with
+			if strings.Contains(c.Errors.String(), "feature not supported") {
+				logFn = slog.Debug // Downgrade to debug level
+			} else {
+				logFn = slog.Warn
+			}
+		default: // 2xx, 3xx
+			logFn = slog.Info
+		}
+
+		// Log response
+		args := []any{
+			"method", c.Request.Method,
+			"path", path,
+			"query", query,
+			"headers", fmt.Sprintf("%v", headers),
+			"status", statusCode,
+			"duration_ms", duration.Milliseconds(),
+			"content_length", c.Writer.Size(),
+			"errors", c.Errors.String(),
+		}
+		if aborted {
+			args = append(args, "aborted", true)
+		}
+		logFn("Request completed", args...)
+	}
+}
+
+// newRedactor creates the redactor of the configured rules. Share link
+// passwords are hidden like the Authorization header.
+func newRedactor(cfg config.LoggingConfig) *logging.Redactor {
+	rules := append([]config.RedactionRule{{Headers: []string{SharePasswordHeader}}}, cfg.Redact...)
+	return logging.NewRedactor(rules)
+}
+
+// redactedRequest returns the URI and headers of a handled request with
+// the details the redaction rules ask for hidden
+func redactedRequest(c *gin.Context, redactor *logging.Redactor) (string, http.Header) {
+	redaction := redactor.Match(redactionSubject(c))
+	uri := c.Request.URL.Path
+	if query := redactQuery(redaction.Query(c.Request.URL.Query())); query != "" {
+		uri += "?" + query
+	}
+	header := make(http.Header, len(c.Request.Header))
+	for name, value := range redaction.Headers(c.Request.Header) {
+		header[name] = []string{value}
+	}
+	return uri, header
+}
+
+// redactionSubject describes a handled request for the redaction rules.
+// Requests that weren't authenticated only tell the tenant of the upload a
+// tus request targets.
+func redactionSubject(c *gin.Context) logging.RequestSubject {
+	subject := logging.RequestSubject{Path: c.Request.URL.Path}
+	if user, err := auth.GetUserFromContext(c.Request.Context()); err == nil {
+		subject.Tenant = user.Tenant
+		subject.Role = user.Role
+		return subject
+	}
+	if strings.HasPrefix(c.Request.URL.Path, DefaultBasePath) {
+		subject.Tenant, _ = storage.TenantFromKey(strings.Trim(c.Param("any"), "/"))
+	}
+	return subject
+}
+
+// redactQuery encodes query parameters with signed tokens masked
+func redactQuery(query url.Values) string {
+	for _, param := range []string{DownloadTokenParam, SignatureParam, ShareParam} {
+		if query.Has(param) {
+			query.Set(param, "REDACTED")
+		}
+	}
+	return query.Encode()
+}
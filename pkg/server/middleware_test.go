@@ -0,0 +1,70 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+)
+
+// syncBuffer collects log lines written from handler goroutines
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.String()
+}
+
+func TestRedactionMatchesAuthenticatedTenant(t *testing.T) {
+	_, ts := newTestServer(t, func(cfg *config.Config) {
+		cfg.Auth.Enabled = true
+		cfg.Auth.JWTSecret = testSecret
+		cfg.Logging.Redact = []config.RedactionRule{{Tenants: []string{"acme"}, Headers: []string{"X-Secret"}}}
+	})
+
+	var logs syncBuffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	for _, tenant := range []string{"acme", "globex"} {
+		header := bearer(t, "alice", "", tenant)
+		header["X-Secret"] = "secret-of-" + tenant
+		header["Upload-Length"] = "5"
+		request(t, http.MethodPost, ts.URL+DefaultBasePath, header, "")
+	}
+
+	var acme, globex bool
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var entry struct {
+			Msg     string `json:"msg"`
+			Headers string `json:"headers"`
+		}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil || entry.Msg != "Request completed" {
+			continue
+		}
+		if strings.Contains(entry.Headers, "Bearer") {
+			t.Errorf("expected the authorization to be hidden, got %s", entry.Headers)
+		}
+		acme = acme || strings.Contains(entry.Headers, "X-Secret:REDACTED")
+		globex = globex || strings.Contains(entry.Headers, "X-Secret:secret-of-globex")
+	}
+	if !acme || !globex {
+		t.Fatalf("expected the rule to hide the header for acme only, got:\n%s", logs.String())
+	}
+}
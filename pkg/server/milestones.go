@@ -0,0 +1,42 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/events"
+)
+
+// OnUploadMilestone subscribes to uploads passing a progress milestone.
+// Milestone subscribers are always invoked asynchronously.
+func (s *Server) OnUploadMilestone(handler events.Handler, opts ...events.SubscribeOption) {
+	opts = append(opts, events.WithMode(events.Async), events.Ordered())
+	s.events.Subscribe(events.UploadMilestone, handler, opts...)
+}
+
+// notifyMilestones emits a milestone event for every progress percentage the
+// upload passed since its last progress notification. Uploads with a deferred
+// length have no percentage until their size is declared.
+func (s *Server) notifyMilestones(ctx context.Context, hook tusd.HookEvent) {
+	if s.milestones == nil || hook.Upload.SizeIsDeferred {
+		return
+	}
+
+	for _, milestone := range s.milestones.Reach(hook.Upload.ID, hook.Upload.Offset, hook.Upload.Size) {
+		s.events.Notify(ctx, events.Event{
+			Type:        events.UploadMilestone,
+			Upload:      hook.Upload,
+			HTTPRequest: hook.HTTPRequest,
+			Milestone:   milestone,
+			Time:        time.Now(),
+		})
+	}
+}
+
+// forgetMilestones stops tracking the milestones of a terminated upload
+func (s *Server) forgetMilestones(ctx context.Context, event events.Event) error {
+	s.milestones.Forget(event.Upload.ID)
+	return nil
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devsnb/large-file-uploads/pkg/events"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// OnUploadReplicated subscribes to uploads copied to a storage mirror.
+// Replication subscribers are always invoked asynchronously.
+func (s *Server) OnUploadReplicated(handler events.Handler, opts ...events.SubscribeOption) {
+	opts = append(opts, events.WithMode(events.Async))
+	s.events.Subscribe(events.UploadReplicated, handler, opts...)
+}
+
+// OnUploadReplicationFailed subscribes to uploads that could not be copied to
+// a storage mirror after all attempts. The event's Reason is the last error.
+func (s *Server) OnUploadReplicationFailed(handler events.Handler, opts ...events.SubscribeOption) {
+	opts = append(opts, events.WithMode(events.Async))
+	s.events.Subscribe(events.UploadReplicationFailed, handler, opts...)
+}
+
+// replicateUpload queues completed uploads for copying to the mirrors.
+// Partial uploads are only replicated as part of their final upload.
+func (s *Server) replicateUpload(ctx context.Context, e events.Event) error {
+	if e.Upload.IsPartial {
+		return nil
+	}
+	if err := s.mirror.Replicate(e.Upload.ID); err != nil {
+		return fmt.Errorf("failed to queue upload for replication: %w", err)
+	}
+	return nil
+}
+
+// reportReplication turns replication results into events
+func (s *Server) reportReplication(result storage.MirrorResult) {
+	event := events.Event{
+		Type:   events.UploadReplicated,
+		Upload: result.Upload,
+		Mirror: string(result.Mirror),
+	}
+	if result.Err != nil {
+		event.Type = events.UploadReplicationFailed
+		event.Reason = result.Err.Error()
+	}
+	s.events.Notify(context.Background(), event)
+}
+
+// getMirror returns the replication queue with the uploads replication gave
+// up on
+func (s *Server) getMirror(c *gin.Context) {
+	c.JSON(http.StatusOK, s.mirror.MirrorStatus())
+}
+
+// retryMirror retries replicating an upload right away
+func (s *Server) retryMirror(c *gin.Context) {
+	if err := s.mirror.RetryReplication(c.Param("id")); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, storage.ErrNotReplicating) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, s.mirror.MirrorStatus())
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/origin"
+)
+
+// Metadata fields recording where an upload was created from. The server
+// sets them, replacing any values the client sent.
+const (
+	OriginIPMetadataKey      = "origin_ip"
+	OriginCountryMetadataKey = "origin_country"
+)
+
+// newClients creates the resolver of client addresses, which honors
+// X-Forwarded-For from the trusted proxies only. Rate limits, the request log
+// and upload origins all take the client's address from it.
+func newClients(cfg config.OriginConfig) (*origin.Resolver, error) {
+	resolver, err := origin.NewResolver(cfg.TrustedProxies, "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure trusted proxies: %w", err)
+	}
+	return resolver, nil
+}
+
+// clientIP returns the address of the client sending a request
+func (s *Server) clientIP(c *gin.Context) string {
+	return s.clients.Resolve(c.Request.RemoteAddr, c.Request.Header).IP
+}
+
+// newOrigins creates the resolver of upload origins, or returns nil if
+// recording them is disabled
+func newOrigins(cfg config.OriginConfig) (*origin.Resolver, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	var countries *origin.Database
+	if cfg.GeoIPDatabase != "" {
+		db, err := origin.LoadDatabase(cfg.GeoIPDatabase)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("GeoIP database loaded", "path", cfg.GeoIPDatabase, "ranges", db.Len())
+		countries = db
+	}
+
+	resolver, err := origin.NewResolver(cfg.TrustedProxies, cfg.CountryHeader, countries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure upload origins: %w", err)
+	}
+	return resolver, nil
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+	"github.com/devsnb/large-file-uploads/pkg/rejection"
+)
+
+// fileTypeMetadataKeys are the metadata fields clients use for the MIME type,
+// in order of preference
+var fileTypeMetadataKeys = []string{"filetype", "type"}
+
+// checkPolicy rejects uploads that violate the configured size or file type
+// limits. Uploads with a deferred length are only checked for their type.
+func (s *Server) checkPolicy(info tusd.FileInfo) error {
+	policy := s.cfg.Policy
+
+	if policy.MaxSize > 0 && !info.SizeIsDeferred && info.Size > policy.MaxSize {
+		return rejection.New(http.StatusRequestEntityTooLarge, rejection.CodeUploadTooLarge,
+			fmt.Sprintf("upload size %d exceeds the maximum of %d bytes", info.Size, policy.MaxSize)).
+			WithDetail("size", info.Size).
+			WithDetail("maxSize", policy.MaxSize)
+	}
+
+	if len(policy.AllowedTypes) > 0 {
+		fileType := uploadFileType(info)
+		if !typeAllowed(fileType, policy.AllowedTypes) {
+			return rejection.New(http.StatusUnsupportedMediaType, rejection.CodeFileTypeNotAllowed,
+				fmt.Sprintf("file type %q is not allowed", fileType)).
+				WithDetail("type", fileType).
+				WithDetail("allowedTypes", policy.AllowedTypes)
+		}
+	}
+
+	return nil
+}
+
+// checkMetadataSchema validates the client-provided metadata against the
+// schema registered for the caller's tenant, if any
+func (s *Server) checkMetadataSchema(hook tusd.HookEvent) error {
+	var tenant string
+	if user, err := auth.GetUserFromContext(hook.Context); err == nil {
+		tenant = user.Tenant
+	}
+
+	metadataSchema := s.schemas.For(tenant)
+	if metadataSchema == nil {
+		return nil
+	}
+
+	violations := metadataSchema.Validate(hook.Upload.MetaData)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	messages := make([]string, len(violations))
+	for i, violation := range violations {
+		messages[i] = violation.Field + " " + violation.Message
+	}
+	return rejection.New(http.StatusBadRequest, rejection.CodeInvalidMetadata,
+		"metadata does not match the schema: "+strings.Join(messages, "; ")).
+		WithDetail("violations", violations)
+}
+
+// uploadFileType returns the MIME type declared in the upload metadata
+func uploadFileType(info tusd.FileInfo) string {
+	for _, key := range fileTypeMetadataKeys {
+		if value := info.MetaData[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// typeAllowed matches a MIME type against patterns such as "image/png" or
+// "image/*"
+func typeAllowed(fileType string, patterns []string) bool {
+	fileType = strings.ToLower(strings.TrimSpace(fileType))
+	if i := strings.IndexByte(fileType, ';'); i >= 0 {
+		fileType = strings.TrimSpace(fileType[:i])
+	}
+	if fileType == "" {
+		return false
+	}
+
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "*/*" || pattern == fileType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(fileType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
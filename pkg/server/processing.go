@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/events"
+	"github.com/devsnb/large-file-uploads/pkg/uploadstate"
+)
+
+// postProcessing reports whether completed uploads go through the built-in
+// post-processors before they become ready
+func (s *Server) postProcessing() bool {
+	return s.bans != nil || s.scanner != nil
+}
+
+// processingJobs cancels the post-processing of terminated uploads, and
+// remembers which ones it canceled until they are deleted
+type processingJobs struct {
+	mu       sync.Mutex
+	cancels  map[string]context.CancelFunc
+	canceled map[string]bool
+}
+
+// start registers the post-processing of an upload
+func (j *processingJobs) start(id string, cancel context.CancelFunc) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.cancels == nil {
+		j.cancels = make(map[string]context.CancelFunc)
+	}
+	j.cancels[id] = cancel
+}
+
+// done unregisters the post-processing of an upload
+func (j *processingJobs) done(id string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	delete(j.cancels, id)
+}
+
+// cancel stops the post-processing of an upload, if it is queued or running
+func (j *processingJobs) cancel(id string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if cancel, ok := j.cancels[id]; ok {
+		slog.Info("Canceling post-processing of terminated upload", "id", id)
+		cancel()
+		if j.canceled == nil {
+			j.canceled = make(map[string]bool)
+		}
+		j.canceled[id] = true
+	}
+}
+
+// resume reports whether the post-processing of an upload was canceled,
+// forgetting that it was
+func (j *processingJobs) resume(id string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	canceled := j.canceled[id]
+	delete(j.canceled, id)
+	return canceled
+}
+
+// forgetProcessing forgets the canceled post-processing of deleted uploads
+func (s *Server) forgetProcessing(_ context.Context, e events.Event) error {
+	s.processing.resume(e.Upload.ID)
+	return nil
+}
+
+// processUpload runs the built-in post-processors on a completed upload in
+// order: the ban list check, then the antivirus scan. The first one that
+// withholds the upload ends processing. Uploads that pass become ready,
+// unless other post-processors move them on. Processing stops when the
+// upload is terminated.
+func (s *Server) processUpload(ctx context.Context, event events.Event) error {
+	info := event.Upload
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s.processing.start(info.ID, cancel)
+	defer s.processing.done(info.ID)
+
+	select {
+	case s.processSlots <- struct{}{}:
+		defer func() { <-s.processSlots }()
+	case <-ctx.Done():
+		return nil
+	}
+
+	if _, err := s.transition(ctx, info, uploadstate.Processing, "post-processing"); err != nil {
+		// The upload may have been terminated meanwhile
+		if errors.Is(err, uploadstate.ErrInvalidTransition) {
+			return nil
+		}
+		return err
+	}
+
+	if s.bans != nil {
+		if done, err := s.checkBanList(ctx, info); done || err != nil {
+			return err
+		}
+	}
+	if s.scanner != nil {
+		if done, err := s.scanUpload(ctx, info); done || err != nil {
+			return err
+		}
+	}
+
+	if s.cfg.States.Processing || ctx.Err() != nil {
+		return nil
+	}
+	_, err := s.transition(ctx, info, uploadstate.Ready, "")
+	return err
+}
+
+// failProcessing moves an upload a post-processor failed on to the failed
+// state, from which operators can retry it
+func (s *Server) failProcessing(ctx context.Context, info tusd.FileInfo, reason string, err error) error {
+	// Terminated uploads are left to the termination
+	if ctx.Err() != nil {
+		return nil
+	}
+	slog.Error("Failed to post-process upload", "id", info.ID, "reason", reason, "error", err)
+	_, err = s.transition(ctx, info, uploadstate.Failed, reason)
+	return err
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/ratelimit"
+	"github.com/devsnb/large-file-uploads/pkg/rejection"
+)
+
+// DefaultConcurrencyRetryAfter is the Retry-After delay of uploads refused
+// by the concurrency limit unless configured
+const DefaultConcurrencyRetryAfter = 2 * time.Second
+
+// rateLimitMiddleware throttles upload requests per client with a token
+// bucket and limits how many chunks are received at once. Refused requests
+// are answered with 503 rather than 429, since tus clients only retry 5xx
+// responses, and carry the delay until the client may retry.
+func (s *Server) rateLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodOptions {
+			c.Next()
+			return
+		}
+
+		if s.limiter != nil {
+			decision := s.limiter.Allow(s.rateLimitKey(c))
+			c.Header(ratelimit.LimitHeader, strconv.Itoa(decision.Limit))
+			c.Header(ratelimit.RemainingHeader, strconv.Itoa(decision.Remaining))
+			c.Header(ratelimit.ResetHeader, strconv.Itoa(int(math.Ceil(decision.Reset.Seconds()))))
+			if !decision.Allowed {
+				s.abortTus(c, rejection.New(http.StatusServiceUnavailable, rejection.CodeRateLimited,
+					"too many requests, retry later").
+					WithRetryAfter(decision.RetryAfter))
+				return
+			}
+		}
+
+		if s.concurrency != nil && c.Request.Method == http.MethodPatch {
+			release, ok := s.concurrency.TryAcquire()
+			if !ok {
+				s.abortTus(c, rejection.New(http.StatusServiceUnavailable, rejection.CodeTooManyUploads,
+					"the server is receiving too many uploads, retry later").
+					WithDetail("limit", s.concurrency.Limit()).
+					WithRetryAfter(s.retryAfter(s.cfg.RateLimit.RetryAfter, DefaultConcurrencyRetryAfter)))
+				return
+			}
+			defer release()
+		}
+
+		c.Next()
+	}
+}
+
+// rateLimitKey identifies the client a request is counted against: the
+// authenticated user, or else the client IP
+func (s *Server) rateLimitKey(c *gin.Context) string {
+	if user, err := auth.GetUserFromContext(c.Request.Context()); err == nil && user.ID != "" {
+		return "user:" + user.ID
+	}
+	return "ip:" + s.clientIP(c)
+}
+
+// newRateLimits creates the request rate and concurrency limiters, each nil
+// if not configured
+func newRateLimits(cfg config.RateLimitConfig) (*ratelimit.Limiter, *ratelimit.Concurrency) {
+	var limiter *ratelimit.Limiter
+	if cfg.RequestsPerSecond > 0 {
+		limiter = ratelimit.NewLimiter(cfg.RequestsPerSecond, cfg.Burst)
+	}
+	var concurrency *ratelimit.Concurrency
+	if cfg.MaxConcurrentUploads > 0 {
+		concurrency = ratelimit.NewConcurrency(cfg.MaxConcurrentUploads)
+	}
+	return limiter, concurrency
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+)
+
+func TestRateLimitTrustsConfiguredProxiesOnly(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		proxies []string
+		// status of a second client's first request behind the same peer
+		want int
+	}{
+		{"untrusted peer", nil, http.StatusServiceUnavailable},
+		{"trusted proxy", []string{"127.0.0.1"}, http.StatusNotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, ts := newTestServer(t, func(cfg *config.Config) {
+				cfg.RateLimit.RequestsPerSecond = 0.001
+				cfg.RateLimit.Burst = 1
+				cfg.Origins.TrustedProxies = tc.proxies
+			})
+			first := map[string]string{"X-Forwarded-For": "203.0.113.1"}
+			if resp, body := request(t, http.MethodHead, ts.URL+"/files/missing", first, ""); resp.StatusCode != http.StatusNotFound {
+				t.Fatalf("first request: %d %s", resp.StatusCode, body)
+			}
+			second := map[string]string{"X-Forwarded-For": "203.0.113.2"}
+			if resp, body := request(t, http.MethodHead, ts.URL+"/files/missing", second, ""); resp.StatusCode != tc.want {
+				t.Fatalf("expected %d for a second client, got %d %s", tc.want, resp.StatusCode, body)
+			}
+		})
+	}
+}
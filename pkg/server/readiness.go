@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// StorageCheck is the name of the built-in readiness check of the storage
+// backend, which is always required
+const StorageCheck = "storage"
+
+// DefaultReadinessTimeout bounds each readiness check when no timeout is
+// configured
+const DefaultReadinessTimeout = 5 * time.Second
+
+// readinessProbeID is the upload looked up to check that storage answers
+const readinessProbeID = "readiness-probe"
+
+// ReadinessCheck reports whether a dependency of the server is available
+type ReadinessCheck func(ctx context.Context) error
+
+// readiness holds the registered readiness checks in registration order
+type readiness struct {
+	mu     sync.Mutex
+	names  []string
+	checks map[string]ReadinessCheck
+}
+
+// checkResult is the outcome of a readiness check
+type checkResult struct {
+	Status   string `json:"status"`
+	Required bool   `json:"required"`
+	Error    string `json:"error,omitempty"`
+}
+
+// AddReadinessCheck registers a check of a dependency, such as a lock
+// service, a database or an event broker, that /readyz reports. A failing
+// check only takes the server out of rotation if its name is listed in
+// readiness.required. A check named storage replaces the built-in probe of
+// the storage backend, which is always required. Checks must be added
+// before the server listens, at the latest by a start hook.
+func (s *Server) AddReadinessCheck(name string, check ReadinessCheck) {
+	s.readiness.mu.Lock()
+	defer s.readiness.mu.Unlock()
+	if s.readiness.checks == nil {
+		s.readiness.checks = make(map[string]ReadinessCheck)
+	}
+	if _, ok := s.readiness.checks[name]; !ok {
+		s.readiness.names = append(s.readiness.names, name)
+	}
+	s.readiness.checks[name] = check
+}
+
+// checkRequiredReadiness verifies that every required readiness check is
+// registered, so a typo doesn't silently make a dependency optional
+func (s *Server) checkRequiredReadiness() error {
+	s.readiness.mu.Lock()
+	defer s.readiness.mu.Unlock()
+	for _, name := range s.cfg.Readiness.Required {
+		if _, ok := s.readiness.checks[name]; !ok {
+			return fmt.Errorf("required readiness check %q is not registered", name)
+		}
+	}
+	return nil
+}
+
+// checkStorage checks that the storage backend answers a lookup of an
+// upload that doesn't exist
+func (s *Server) checkStorage(ctx context.Context) error {
+	_, err := s.store.GetStoreComposer().Core.GetUpload(ctx, readinessProbeID)
+	// Backends with per-tenant credentials can't be reached without a tenant
+	if err == nil || errors.Is(err, tusd.ErrNotFound) || errors.Is(err, storage.ErrNoTenant) {
+		return nil
+	}
+	return err
+}
+
+// getReadiness runs all readiness checks concurrently and answers 503 if
+// the server is draining or a required check failed
+func (s *Server) getReadiness(c *gin.Context) {
+	s.readiness.mu.Lock()
+	names := slices.Clone(s.readiness.names)
+	checks := make([]ReadinessCheck, len(names))
+	for i, name := range names {
+		checks[i] = s.readiness.checks[name]
+	}
+	s.readiness.mu.Unlock()
+	if !slices.Contains(names, StorageCheck) {
+		names = append([]string{StorageCheck}, names...)
+		checks = append([]ReadinessCheck{s.checkStorage}, checks...)
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), s.readinessTimeout())
+	defer cancel()
+
+	results := make(map[string]checkResult, len(names))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := checkResult{Status: "ok", Required: name == StorageCheck || slices.Contains(s.cfg.Readiness.Required, name)}
+			if err := checks[i](ctx); err != nil {
+				result.Status, result.Error = "failing", err.Error()
+			}
+			mu.Lock()
+			results[name] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	status, code := "ready", http.StatusOK
+	for _, result := range results {
+		if result.Required && result.Status != "ok" {
+			status, code = "not_ready", http.StatusServiceUnavailable
+		}
+	}
+	if s.draining.Load() {
+		status, code = "draining", http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{"status": status, "checks": results})
+}
+
+// readinessTimeout returns how long each readiness check may take
+func (s *Server) readinessTimeout() time.Duration {
+	if s.cfg.Readiness.Timeout > 0 {
+		return time.Duration(s.cfg.Readiness.Timeout) * time.Second
+	}
+	return DefaultReadinessTimeout
+}
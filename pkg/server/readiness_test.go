@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+)
+
+// readinessAnswer is the body of /readyz
+type readinessAnswer struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+func getReadyz(t *testing.T, url string) (int, readinessAnswer) {
+	t.Helper()
+	resp, body := request(t, http.MethodGet, url+"/readyz", nil, "")
+	var answer readinessAnswer
+	if err := json.Unmarshal([]byte(body), &answer); err != nil {
+		t.Fatalf("decoding %s: %v", body, err)
+	}
+	return resp.StatusCode, answer
+}
+
+func TestReadinessChecks(t *testing.T) {
+	srv, ts := newTestServer(t, func(cfg *config.Config) {
+		cfg.Readiness.Required = []string{"database"}
+		cfg.Readiness.Timeout = 1
+	})
+	srv.AddReadinessCheck("database", func(ctx context.Context) error { return errors.New("connection refused") })
+	srv.AddReadinessCheck("broker", func(ctx context.Context) error { return errors.New("broker unavailable") })
+	// Checks that outlast the timeout fail
+	srv.AddReadinessCheck("cache", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	code, answer := getReadyz(t, ts.URL)
+	if code != http.StatusServiceUnavailable || answer.Status != "not_ready" {
+		t.Fatalf("expected a failing required check to fail readiness, got %d %+v", code, answer)
+	}
+	expected := map[string]checkResult{
+		StorageCheck: {Status: "ok", Required: true},
+		"database":   {Status: "failing", Required: true, Error: "connection refused"},
+		"broker":     {Status: "failing", Error: "broker unavailable"},
+		"cache":      {Status: "failing", Error: context.DeadlineExceeded.Error()},
+	}
+	for name, result := range expected {
+		if answer.Checks[name] != result {
+			t.Errorf("expected check %s to be %+v, got %+v", name, result, answer.Checks[name])
+		}
+	}
+
+	// Optional checks are reported without taking the server out of rotation
+	srv.AddReadinessCheck("database", func(ctx context.Context) error { return nil })
+	srv.AddReadinessCheck("cache", func(ctx context.Context) error { return nil })
+	code, answer = getReadyz(t, ts.URL)
+	if code != http.StatusOK || answer.Status != "ready" || answer.Checks["broker"].Status != "failing" {
+		t.Fatalf("expected the server to be ready, got %d %+v", code, answer)
+	}
+
+	srv.draining.Store(true)
+	if code, answer = getReadyz(t, ts.URL); code != http.StatusServiceUnavailable || answer.Status != "draining" {
+		t.Fatalf("expected a draining server not to be ready, got %d %+v", code, answer)
+	}
+}
+
+func TestReadinessStorageCheckCanBeReplaced(t *testing.T) {
+	srv, ts := newTestServer(t, nil)
+	srv.AddReadinessCheck(StorageCheck, func(ctx context.Context) error { return errors.New("bucket unreachable") })
+
+	code, answer := getReadyz(t, ts.URL)
+	if code != http.StatusServiceUnavailable || answer.Checks[StorageCheck].Error != "bucket unreachable" {
+		t.Fatalf("expected the replaced storage check to be required, got %d %+v", code, answer)
+	}
+}
+
+func TestServeRequiresRegisteredReadinessChecks(t *testing.T) {
+	srv, _ := newTestServer(t, func(cfg *config.Config) {
+		cfg.Readiness.Required = []string{"databse"}
+	})
+	srv.AddReadinessCheck("database", func(ctx context.Context) error { return nil })
+
+	err := srv.Serve(context.Background(), "127.0.0.1:0")
+	if err == nil || !strings.Contains(err.Error(), `"databse" is not registered`) {
+		t.Fatalf("expected an unregistered required check to stop the server, got %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/events"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+	"github.com/devsnb/large-file-uploads/pkg/uploadstate"
+)
+
+// lockUpload takes the tusd lock of an upload, so requests for it wait
+// until unlock is called
+func (s *Server) lockUpload(ctx context.Context, id string) (func(), error) {
+	if !s.composer.UsesLocker {
+		return func() {}, nil
+	}
+	lock, err := s.composer.Locker.NewLock(id)
+	if err != nil {
+		return nil, err
+	}
+	lockCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	if err := lock.Lock(lockCtx, func() {}); err != nil {
+		return nil, err
+	}
+	return func() { lock.Unlock() }, nil
+}
+
+// reconcileStorage lets the storage backend check unfinished uploads after
+// a restart and logs what it repaired. Uploads it finished get the
+// completion notifications they missed.
+func (s *Server) reconcileStorage(ctx context.Context, reconciler storage.UploadReconciler) {
+	repairs, err := reconciler.ReconcileUploads(ctx, s.lockUpload)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		slog.Error("Failed to reconcile uploads with storage", "error", err)
+	}
+
+	for _, repair := range repairs {
+		attrs := []any{"id", repair.UploadID, "problem", repair.Problem, "action", repair.Action, "offset", repair.Offset}
+		if repair.Action == storage.RepairNone {
+			slog.Warn("Upload in storage is inconsistent, clients may fail to resume it", attrs...)
+			continue
+		}
+		slog.Warn("Repaired inconsistent upload in storage", attrs...)
+
+		switch repair.Action {
+		case storage.RepairCommitted:
+			info, err := s.uploadInfo(ctx, repair.UploadID)
+			if err != nil {
+				slog.Error("Failed to load repaired upload", "id", repair.UploadID, "error", err)
+				continue
+			}
+			hook := tusd.HookEvent{Context: ctx, Upload: info}
+			s.advanceState(ctx, hook, uploadstate.Uploaded)
+			s.events.Notify(ctx, s.withAnnotations(ctx, newEvent(events.UploadCompleted, hook)))
+		case storage.RepairExpired:
+			// Subscribers such as reservations need the metadata of the
+			// deleted upload
+			info := repair.Upload
+			info.ID = repair.UploadID
+			hook := tusd.HookEvent{Context: ctx, Upload: info}
+			s.advanceState(ctx, hook, uploadstate.Deleted)
+			s.events.Notify(ctx, newEvent(events.UploadTerminated, hook))
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// repairingStorage is in-memory storage whose startup repair waits until
+// released
+type repairingStorage struct {
+	*storage.MemoryStorage
+	release chan struct{}
+}
+
+func (s repairingStorage) ReconcileUploads(ctx context.Context, lock storage.LockFunc) ([]storage.UploadRepair, error) {
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+	}
+	return nil, nil
+}
+
+func (s repairingStorage) RepairsUploads() bool {
+	return true
+}
+
+func TestServeWaitsForStorageRepair(t *testing.T) {
+	store := repairingStorage{newMemoryStorage(t), make(chan struct{})}
+	srv, _ := newTestServerOn(t, store, nil)
+
+	ready := make(chan struct{})
+	srv.OnReady(func(ctx context.Context) error {
+		close(ready)
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ctx, "127.0.0.1:0") }()
+
+	select {
+	case <-ready:
+		t.Fatal("expected the server not to accept requests while storage is repaired")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(store.release)
+	select {
+	case <-ready:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the server to accept requests once storage is repaired")
+	}
+
+	cancel()
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+}
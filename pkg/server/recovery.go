@@ -0,0 +1,151 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+	"github.com/devsnb/large-file-uploads/pkg/events"
+	"github.com/devsnb/large-file-uploads/pkg/rejection"
+)
+
+// RequestIDHeader carries the ID of a request set by a proxy in front of the
+// server, and the ID of failed requests in responses
+const RequestIDHeader = "X-Request-Id"
+
+// OnPanic subscribes to requests whose handler panicked. Panic subscribers
+// are always invoked asynchronously.
+func (s *Server) OnPanic(handler events.Handler, opts ...events.SubscribeOption) {
+	opts = append(opts, events.WithMode(events.Async))
+	s.events.Subscribe(events.RequestPanicked, handler, opts...)
+}
+
+// recoveryMiddleware recovers from panics in later handlers. The panic is
+// logged with the upload, user and request it happened in, counted and
+// emitted as an event, and the client gets a JSON error carrying the
+// request ID to quote.
+func (s *Server) recoveryMiddleware() gin.HandlerFunc {
+	// Subscribers may forward the event, so it gets no more of the request
+	// than the request log
+	redactor := newRedactor(s.cfg.Logging)
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+
+			// The client went away, so there is no one to answer
+			if brokenConnection(recovered) {
+				slog.Debug("Connection closed during request", "method", c.Request.Method, "path", c.Request.URL.Path, "error", recovered)
+				c.Abort()
+				return
+			}
+
+			requestID := requestIDOf(c)
+			uploadID := uploadIDOf(c)
+			attrs := []any{
+				"panic", fmt.Sprint(recovered),
+				"method", c.Request.Method,
+				"path", c.Request.URL.Path,
+				"requestId", requestID,
+				"stack", string(debug.Stack()),
+			}
+			if uploadID != "" {
+				attrs = append(attrs, "id", uploadID)
+			}
+			// Auth middleware later in the chain replaces the request with
+			// one carrying the user
+			if user, err := auth.GetUserFromContext(c.Request.Context()); err == nil {
+				attrs = append(attrs, "user", user.ID)
+			}
+			slog.Error("Recovered from panic", attrs...)
+
+			s.panics.Inc(c.Request.Method, c.FullPath())
+			uri, header := redactedRequest(c, redactor)
+			s.events.Notify(c.Request.Context(), events.Event{
+				Type:   events.RequestPanicked,
+				Upload: tusd.FileInfo{ID: uploadID},
+				HTTPRequest: tusd.HTTPRequest{
+					Method:     c.Request.Method,
+					URI:        uri,
+					RemoteAddr: c.Request.RemoteAddr,
+					Header:     header,
+				},
+				Panic:     fmt.Sprint(recovered),
+				RequestID: requestID,
+				Time:      time.Now(),
+			})
+
+			if c.Writer.Written() {
+				// Part of the response is out, so the connection can only
+				// be closed
+				c.Abort()
+				return
+			}
+			c.Header(RequestIDHeader, requestID)
+			err := rejection.New(http.StatusInternalServerError, rejection.CodeInternalError, "internal server error").
+				WithDetail("requestId", requestID)
+			if strings.HasPrefix(c.Request.URL.Path, DefaultBasePath) {
+				s.abortTus(c, err)
+				return
+			}
+			c.AbortWithStatusJSON(err.Status, gin.H{"error": err.Message, "code": err.Code, "requestId": requestID})
+		}()
+		c.Next()
+	}
+}
+
+// brokenConnection reports whether a panic was caused by the client
+// closing the connection, as gin.Recovery does
+func brokenConnection(recovered any) bool {
+	err, ok := recovered.(error)
+	if !ok {
+		return false
+	}
+	if errors.Is(err, http.ErrAbortHandler) {
+		return true
+	}
+	var opErr *net.OpError
+	var syscallErr *os.SyscallError
+	if errors.As(err, &opErr) && errors.As(opErr.Err, &syscallErr) {
+		return errors.Is(syscallErr.Err, syscall.EPIPE) || errors.Is(syscallErr.Err, syscall.ECONNRESET)
+	}
+	return false
+}
+
+// requestIDOf returns the ID a proxy assigned to the request, or a new
+// random one
+func requestIDOf(c *gin.Context) string {
+	if id := strings.TrimSpace(c.GetHeader(RequestIDHeader)); id != "" && len(id) <= 128 {
+		return id
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// uploadIDOf returns the ID of the upload a tus or API request is about,
+// or an empty string
+func uploadIDOf(c *gin.Context) string {
+	if id := c.Param("id"); id != "" {
+		return id
+	}
+	if strings.HasPrefix(c.Request.URL.Path, DefaultBasePath) {
+		return strings.Trim(c.Param("any"), "/")
+	}
+	return ""
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devsnb/large-file-uploads/pkg/events"
+	"github.com/devsnb/large-file-uploads/pkg/logging"
+)
+
+func TestPanicEventRedactsRequest(t *testing.T) {
+	srv, _ := newTestServer(t, nil)
+	if err := srv.UseMiddleware(GlobalChain, "boom", func(c *gin.Context) { panic("boom") }, Position{}); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv.Router())
+	defer ts.Close()
+
+	panicked := make(chan events.Event, 1)
+	srv.OnPanic(func(ctx context.Context, event events.Event) error {
+		panicked <- event
+		return nil
+	})
+
+	resp, body := request(t, http.MethodGet, ts.URL+"/api/uploads/abc/state?token=secret", map[string]string{
+		"Authorization":     "Bearer secret",
+		SharePasswordHeader: "secret",
+		RequestIDHeader:     "req-1",
+	}, "")
+	if resp.StatusCode != http.StatusInternalServerError || resp.Header.Get(RequestIDHeader) != "req-1" {
+		t.Fatalf("expected an internal error quoting the request ID, got %d %v", resp.StatusCode, resp.Header)
+	}
+	var answer struct {
+		Code      string `json:"code"`
+		RequestID string `json:"requestId"`
+	}
+	if err := json.Unmarshal([]byte(body), &answer); err != nil {
+		t.Fatal(err)
+	}
+	if answer.Code != "ERR_INTERNAL_ERROR" || answer.RequestID != "req-1" {
+		t.Fatalf("unexpected error body %s", body)
+	}
+
+	var event events.Event
+	select {
+	case event = <-panicked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a panic event")
+	}
+	if event.Panic != "boom" || event.RequestID != "req-1" {
+		t.Fatalf("unexpected panic event %+v", event)
+	}
+	if strings.Contains(event.HTTPRequest.URI, "secret") || !strings.HasPrefix(event.HTTPRequest.URI, "/api/uploads/abc/state?") {
+		t.Errorf("expected the query token to be redacted, got %s", event.HTTPRequest.URI)
+	}
+	for _, name := range []string{"Authorization", SharePasswordHeader} {
+		if got := event.HTTPRequest.Header.Get(name); got != logging.Redacted {
+			t.Errorf("expected %s to be redacted, got %q", name, got)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devsnb/large-file-uploads/pkg/events"
+	"github.com/devsnb/large-file-uploads/pkg/eventschema"
+	"github.com/devsnb/large-file-uploads/pkg/report"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+	"github.com/devsnb/large-file-uploads/pkg/uploadstate"
+)
+
+// subscribeHealthReports counts the events health reports summarize
+func (s *Server) subscribeHealthReports() {
+	s.OnUploadCreated(func(ctx context.Context, e events.Event) error {
+		if !e.Upload.IsPartial {
+			s.healthReports.Created()
+		}
+		return nil
+	})
+	s.OnUploadComplete(func(ctx context.Context, e events.Event) error {
+		if !e.Upload.IsPartial {
+			tenant, _ := storage.TenantFromKey(e.Upload.ID)
+			s.healthReports.Completed(tenant, e.Upload.Size)
+		}
+		return nil
+	})
+	s.OnUploadTerminated(func(ctx context.Context, e events.Event) error {
+		s.healthReports.Reclaimed(e.Upload.Offset)
+		return nil
+	})
+	s.OnUploadStateChanged(func(ctx context.Context, e events.Event) error {
+		switch uploadstate.State(e.State) {
+		case uploadstate.Failed:
+			s.healthReports.Failed(report.FailureProcessing)
+		case uploadstate.Quarantined:
+			s.healthReports.Failed(report.FailureQuarantined)
+		}
+		return nil
+	})
+	s.OnPanic(func(ctx context.Context, e events.Event) error {
+		s.healthReports.Failed(report.FailurePanic)
+		return nil
+	})
+	s.OnUploadReplicationFailed(func(ctx context.Context, e events.Event) error {
+		s.healthReports.Failed(report.FailureReplication)
+		return nil
+	})
+}
+
+// runHealthReports posts a health report at the end of every period until
+// the context is canceled. Reports that can't be delivered are dropped.
+func (s *Server) runHealthReports(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(max(s.cfg.Reports.Interval, 60)) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		summary := s.healthReports.Close()
+		if err := s.alerts.Post(ctx, s.cfg.Reports.URL, s.newHealthReport(summary)); err != nil {
+			if !errors.Is(err, context.Canceled) {
+				slog.Error("Failed to deliver health report", "from", summary.From, "to", summary.To, "error", err)
+			}
+			continue
+		}
+		slog.Info("Health report delivered", "from", summary.From, "to", summary.To,
+			"created", summary.Created, "completed", summary.Completed)
+	}
+}
+
+// getHealthReport returns the report of the current period so far
+func (s *Server) getHealthReport(c *gin.Context) {
+	c.JSON(http.StatusOK, s.newHealthReport(s.healthReports.Summary()))
+}
+
+// countQuotaBreach counts an upload refused by a quota of the tenant, or of
+// the storage backend if the tenant is empty
+func (s *Server) countQuotaBreach(tenant string) {
+	if s.healthReports != nil {
+		s.healthReports.QuotaBreached(tenant)
+	}
+}
+
+// countFailure counts a failure for the health reports
+func (s *Server) countFailure(kind string) {
+	if s.healthReports != nil {
+		s.healthReports.Failed(kind)
+	}
+}
+
+// newHealthReport builds the payload of a report, labeled with the
+// instance that kept its counts
+func (s *Server) newHealthReport(summary report.Summary) eventschema.HealthReport {
+	summary.Instance = s.cfg.Reports.Instance
+	if summary.Instance == "" {
+		summary.Instance, _ = os.Hostname()
+	}
+	payload := eventschema.HealthReport{
+		SchemaVersion:  eventschema.Version,
+		Instance:       summary.Instance,
+		Text:           summary.Text(),
+		From:           summary.From,
+		To:             summary.To,
+		Created:        summary.Created,
+		Completed:      summary.Completed,
+		CompletedBytes: summary.CompletedBytes,
+		Failures:       summary.Failures,
+		Reclaimed:      summary.Reclaimed,
+		ReclaimedBytes: summary.ReclaimedBytes,
+		QuotaBreaches:  make(map[string]int64, len(summary.QuotaBreaches)),
+		TopTenants:     make([]eventschema.TenantUsage, 0, len(summary.TopTenants)),
+	}
+	for tenant, count := range summary.QuotaBreaches {
+		if tenant == "" {
+			payload.StorageQuotaBreaches = count
+			continue
+		}
+		payload.QuotaBreaches[tenant] = count
+	}
+	for _, usage := range summary.TopTenants {
+		payload.TopTenants = append(payload.TopTenants, eventschema.TenantUsage(usage))
+	}
+	return payload
+}
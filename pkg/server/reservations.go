@@ -0,0 +1,243 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/events"
+	"github.com/devsnb/large-file-uploads/pkg/rejection"
+	"github.com/devsnb/large-file-uploads/pkg/reservation"
+	"github.com/devsnb/large-file-uploads/pkg/schedule"
+)
+
+// ReservationMetadataKey names the reservation an upload is admitted against
+const ReservationMetadataKey = "reservation"
+
+// reservationRequest is the body of a reservation
+type reservationRequest struct {
+	Name     string    `json:"name"`
+	Bytes    int64     `json:"bytes" binding:"required"`
+	Uploads  int       `json:"uploads" binding:"required"`
+	StartsAt time.Time `json:"startsAt"`
+	EndsAt   time.Time `json:"endsAt" binding:"required"`
+}
+
+// checkReservation admits an upload naming a reservation against it and
+// returns the time the reservation window starts if that is still ahead,
+// until which the upload is queued. Admitted uploads must be released if
+// the creation fails afterwards.
+func (s *Server) checkReservation(hook tusd.HookEvent) (admitted bool, startsAt time.Time, err error) {
+	id := hook.Upload.MetaData[ReservationMetadataKey]
+	if s.reservations == nil || id == "" || hook.Upload.IsFinal {
+		return false, time.Time{}, nil
+	}
+	if hook.Upload.SizeIsDeferred {
+		return false, time.Time{}, rejection.New(http.StatusBadRequest, rejection.CodeUploadRejected,
+			"uploads against a reservation must declare their length at creation")
+	}
+
+	var tenant string
+	if user, err := auth.GetUserFromContext(hook.Context); err == nil {
+		tenant = user.Tenant
+	}
+
+	r, err := s.reservations.Admit(hook.Context, tenant, id, hook.Upload.Size)
+	if err != nil {
+		return false, time.Time{}, reservationRejection(id, hook.Upload.Size, r, err)
+	}
+	if !time.Now().Before(r.StartsAt) {
+		return true, time.Time{}, nil
+	}
+
+	// Data sent with the creation couldn't be accepted before the window
+	if strings.HasPrefix(hook.HTTPRequest.Header.Get("Content-Type"), "application/offset+octet-stream") {
+		s.releaseReservation(hook.Context, hook.Upload)
+		return false, time.Time{}, scheduleRejection(http.StatusServiceUnavailable, rejection.CodeOutsideUploadWindow,
+			&schedule.Closure{Opens: r.StartsAt}, "the reservation starts at %s, create the upload without data")
+	}
+	return true, r.StartsAt.UTC(), nil
+}
+
+// reservationRejection describes why an upload wasn't admitted against a
+// reservation
+func reservationRejection(id string, size int64, r reservation.Reservation, err error) error {
+	switch {
+	case errors.Is(err, reservation.ErrNotFound):
+		return rejection.New(http.StatusBadRequest, rejection.CodeUnknownReservation,
+			fmt.Sprintf("reservation %q does not exist", id))
+	case errors.Is(err, reservation.ErrEnded), errors.Is(err, reservation.ErrCancelled):
+		return rejection.New(http.StatusGone, rejection.CodeReservationEnded,
+			fmt.Sprintf("reservation %q no longer admits uploads: %v", id, err)).
+			WithDetail("endsAt", r.EndsAt)
+	case errors.Is(err, reservation.ErrExhausted):
+		return rejection.New(http.StatusForbidden, rejection.CodeReservationExhausted,
+			fmt.Sprintf("upload of %d bytes exceeds what is left of reservation %q", size, id)).
+			WithDetail("remainingBytes", r.Bytes-r.UsedBytes).
+			WithDetail("remainingUploads", r.Uploads-r.UsedUploads)
+	default:
+		slog.Error("Failed to admit upload against reservation", "reservation", id, "error", err)
+		return rejection.New(http.StatusInternalServerError, rejection.CodeUploadRejected,
+			"failed to admit upload against reservation")
+	}
+}
+
+// releaseReservation returns the capacity an upload took to its reservation
+func (s *Server) releaseReservation(ctx context.Context, info tusd.FileInfo) {
+	id := info.MetaData[ReservationMetadataKey]
+	if err := s.reservations.Release(ctx, id, info.Size); err != nil && !errors.Is(err, reservation.ErrNotFound) {
+		slog.Error("Failed to release reservation", "reservation", id, "upload", info.ID, "error", err)
+	}
+}
+
+// releaseTerminated releases the capacity of uploads terminated or expired
+// before they completed. Completed uploads keep it, since their data was
+// transferred.
+func (s *Server) releaseTerminated(ctx context.Context, event events.Event) error {
+	info := event.Upload
+	if info.MetaData[ReservationMetadataKey] == "" || info.SizeIsDeferred || info.Offset >= info.Size {
+		return nil
+	}
+	s.releaseReservation(ctx, info)
+	return nil
+}
+
+// listReservations returns the reservations of the caller's tenant
+func (s *Server) listReservations(c *gin.Context) {
+	tenant, _, ok := managedTenant(c, "reservations")
+	if !ok {
+		return
+	}
+
+	reservations, err := s.reservations.List(c.Request.Context(), tenant)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"reservations": reservations})
+}
+
+// createReservation reserves capacity for the caller's tenant
+func (s *Server) createReservation(c *gin.Context) {
+	tenant, user, ok := managedTenant(c, "reservations")
+	if !ok {
+		return
+	}
+
+	var req reservationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	r, err := s.reservations.Create(c.Request.Context(), reservation.Reservation{
+		Tenant:    tenant,
+		Name:      req.Name,
+		Bytes:     req.Bytes,
+		Uploads:   req.Uploads,
+		StartsAt:  req.StartsAt,
+		EndsAt:    req.EndsAt,
+		CreatedBy: user.ID,
+	})
+	if err != nil {
+		respondReservationError(c, err)
+		return
+	}
+
+	slog.Info("Capacity reserved", "reservation", r.ID, "tenant", tenant, "bytes", r.Bytes, "uploads", r.Uploads,
+		"startsAt", r.StartsAt, "endsAt", r.EndsAt, "by", user.ID)
+	c.JSON(http.StatusCreated, r)
+}
+
+// getReservation returns a reservation of the caller's tenant with its usage
+func (s *Server) getReservation(c *gin.Context) {
+	tenant, _, ok := managedTenant(c, "reservations")
+	if !ok {
+		return
+	}
+
+	r, err := s.reservations.Get(c.Request.Context(), tenant, c.Param("rid"))
+	if err != nil {
+		respondReservationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+// cancelReservation releases the capacity of a reservation
+func (s *Server) cancelReservation(c *gin.Context) {
+	tenant, user, ok := managedTenant(c, "reservations")
+	if !ok {
+		return
+	}
+
+	r, err := s.reservations.Cancel(c.Request.Context(), tenant, c.Param("rid"))
+	if err != nil {
+		respondReservationError(c, err)
+		return
+	}
+
+	slog.Info("Reservation cancelled", "reservation", r.ID, "tenant", tenant, "by", user.ID)
+	c.JSON(http.StatusOK, r)
+}
+
+// adminListReservations returns the reservations of all tenants with the
+// bytes reserved by the active ones, for capacity planning
+func (s *Server) adminListReservations(c *gin.Context) {
+	reservations, err := s.reservations.List(c.Request.Context(), c.Query("tenant"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	var reserved, used int64
+	for _, r := range reservations {
+		if r.Active(now) {
+			reserved += r.Bytes
+			used += r.UsedBytes
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"reservations":  reservations,
+		"capacity":      s.cfg.Reservations.Capacity,
+		"reservedBytes": reserved,
+		"usedBytes":     used,
+	})
+}
+
+// respondReservationError maps reservation errors to responses
+func respondReservationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, reservation.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, reservation.ErrInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, reservation.ErrCapacity):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// newReservationStore creates the store for reservations
+func newReservationStore(cfg config.ReservationConfig) (reservation.Store, error) {
+	if cfg.Dir == "" {
+		return reservation.NewMemoryStore(), nil
+	}
+
+	store, err := reservation.NewFileStore(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reservation store: %w", err)
+	}
+	return store, nil
+}
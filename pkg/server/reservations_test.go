@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/reservation"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// expiringReconciler reports the given uploads as expired
+type expiringReconciler struct {
+	repairs []storage.UploadRepair
+}
+
+func (r expiringReconciler) ReconcileUploads(ctx context.Context, lock storage.LockFunc) ([]storage.UploadRepair, error) {
+	return r.repairs, nil
+}
+
+func newReservationServer(t *testing.T) (*Server, *httptest.Server) {
+	return newTestServer(t, func(cfg *config.Config) {
+		cfg.Auth.Enabled = true
+		cfg.Auth.JWTSecret = testSecret
+		cfg.Reservations.Enabled = true
+		cfg.Reservations.Dir = t.TempDir()
+		cfg.Termination.Enabled = true
+	})
+}
+
+// reservedUpload creates an upload of 10 bytes against a new reservation
+// and sends half of its data
+func reservedUpload(t *testing.T, srv *Server, ts *httptest.Server) (reservation.Reservation, string) {
+	t.Helper()
+	r, err := srv.reservations.Create(context.Background(), reservation.Reservation{
+		Tenant: "acme", Bytes: 100, Uploads: 5, EndsAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := bearer(t, "alice", "user", "acme")
+	header["Upload-Length"] = "10"
+	header["Upload-Metadata"] = ReservationMetadataKey + " " + base64.StdEncoding.EncodeToString([]byte(r.ID))
+	resp, body := request(t, http.MethodPost, ts.URL+DefaultBasePath, header, "")
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("creating upload: %d %s", resp.StatusCode, body)
+	}
+	location := resp.Header.Get("Location")
+	id := location[strings.LastIndex(location, "/")+1:]
+
+	patch := bearer(t, "alice", "user", "acme")
+	patch["Upload-Offset"] = "0"
+	patch["Content-Type"] = "application/offset+octet-stream"
+	resp, body = request(t, http.MethodPatch, ts.URL+DefaultBasePath+id, patch, "hello")
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("uploading: %d %s", resp.StatusCode, body)
+	}
+
+	if r, err = srv.reservations.Get(context.Background(), "acme", r.ID); err != nil || r.UsedUploads != 1 || r.UsedBytes != 10 {
+		t.Fatalf("expected the upload to be admitted, got %+v %v", r, err)
+	}
+	return r, id
+}
+
+// waitForRelease waits until the reservation holds no uploads
+func waitForRelease(t *testing.T, srv *Server, id string) {
+	t.Helper()
+	var r reservation.Reservation
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		var err error
+		if r, err = srv.reservations.Get(context.Background(), "acme", id); err != nil {
+			t.Fatal(err)
+		}
+		if r.UsedUploads == 0 && r.UsedBytes == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected the capacity of the upload to be released, got %+v", r)
+}
+
+func TestReservationReleasedOnTermination(t *testing.T) {
+	srv, ts := newReservationServer(t)
+	r, id := reservedUpload(t, srv, ts)
+
+	resp, body := request(t, http.MethodDelete, ts.URL+DefaultBasePath+id, bearer(t, "alice", "user", "acme"), "")
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("terminating: %d %s", resp.StatusCode, body)
+	}
+	waitForRelease(t, srv, r.ID)
+}
+
+func TestReservationReleasedOnExpiry(t *testing.T) {
+	srv, ts := newReservationServer(t)
+	r, id := reservedUpload(t, srv, ts)
+
+	info, err := srv.uploadInfo(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.reconcileStorage(context.Background(), expiringReconciler{[]storage.UploadRepair{
+		{UploadID: id, Problem: "blocks were lost", Action: storage.RepairExpired, Upload: info},
+	}})
+	waitForRelease(t, srv, r.ID)
+}
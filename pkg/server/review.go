@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+	"github.com/devsnb/large-file-uploads/pkg/events"
+	"github.com/devsnb/large-file-uploads/pkg/uploadstate"
+)
+
+// Review decisions
+const (
+	reviewApprove = "approve"
+	reviewReject  = "reject"
+)
+
+// reviewRequest is the body of a review decision
+type reviewRequest struct {
+	Decision string `json:"decision" binding:"required"`
+	Reason   string `json:"reason"`
+}
+
+// pendingReview is an upload waiting for an approver
+type pendingReview struct {
+	uploadstate.Record
+	Size     int64             `json:"size"`
+	MetaData map[string]string `json:"metadata"`
+}
+
+// OnUploadReview subscribes to the review workflow: uploads entering
+// pending_review, and uploads approved or rejected by an approver. Review
+// subscribers are always invoked asynchronously.
+func (s *Server) OnUploadReview(handler events.Handler, opts ...events.SubscribeOption) {
+	opts = append(opts, events.WithMode(events.Async))
+	for _, eventType := range []events.Type{events.UploadReviewRequested, events.UploadApproved, events.UploadRejected} {
+		s.events.Subscribe(eventType, handler, opts...)
+	}
+}
+
+// approver reports whether a user may review uploads
+func (s *Server) approver(user *auth.User) bool {
+	return user.Role == "admin" || (s.cfg.Review.ApproverRole != "" && user.Role == s.cfg.Review.ApproverRole)
+}
+
+// owns reports whether a user created an upload
+func (s *Server) owns(ctx context.Context, user *auth.User, id string) bool {
+	info, err := s.uploadInfo(ctx, id)
+	return err == nil && info.MetaData[auth.OwnerMetadataKey] == user.ID
+}
+
+// reviewer returns the caller if it may review uploads, answering the
+// request otherwise
+func (s *Server) reviewer(c *gin.Context) (*auth.User, bool) {
+	user, err := auth.GetUserFromContext(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return nil, false
+	}
+	if !s.approver(user) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "reviewing uploads requires the " + s.cfg.Review.ApproverRole + " role"})
+		return nil, false
+	}
+	return user, true
+}
+
+// listReviews returns the uploads pending review, the longest waiting first
+func (s *Server) listReviews(c *gin.Context) {
+	if _, ok := s.reviewer(c); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	records, err := s.states.List(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	pending := make([]pendingReview, 0)
+	for _, record := range records {
+		if record.State != uploadstate.PendingReview {
+			continue
+		}
+		info, err := s.uploadInfo(ctx, record.ID)
+		if err != nil {
+			continue
+		}
+		pending = append(pending, pendingReview{Record: record, Size: info.Size, MetaData: info.MetaData})
+	}
+	slices.SortFunc(pending, func(a, b pendingReview) int { return a.UpdatedAt.Compare(b.UpdatedAt) })
+	c.JSON(http.StatusOK, gin.H{"reviews": pending})
+}
+
+// reviewUpload approves or rejects an upload pending review. Approvers
+// can't review their own uploads.
+func (s *Server) reviewUpload(c *gin.Context) {
+	user, ok := s.reviewer(c)
+	if !ok {
+		return
+	}
+
+	var req reviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	state, eventType := uploadstate.Ready, events.UploadApproved
+	switch req.Decision {
+	case reviewApprove:
+	case reviewReject:
+		state, eventType = uploadstate.Rejected, events.UploadRejected
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "decision must be approve or reject"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	info, err := s.uploadInfo(ctx, id)
+	if err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if info.MetaData[auth.OwnerMetadataKey] == user.ID && user.Role != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "approvers can't review their own uploads"})
+		return
+	}
+
+	record, err := s.changeState(ctx, info, uploadstate.PendingReview, state, req.Reason)
+	if err != nil {
+		if errors.Is(err, uploadstate.ErrInvalidTransition) {
+			c.JSON(http.StatusConflict, gin.H{"error": "upload is not pending review"})
+			return
+		}
+		c.JSON(stateErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	slog.Info("Upload reviewed", "id", id, "decision", req.Decision, "reviewer", user.ID)
+	s.events.Notify(ctx, events.Event{
+		Type:        eventType,
+		Upload:      info,
+		State:       string(record.State),
+		Annotations: record.Annotations,
+		Reviewer:    user.ID,
+		Reason:      req.Reason,
+		Time:        time.Now(),
+	})
+	c.JSON(http.StatusOK, record)
+}
+
+// requestReview notifies review subscribers of an upload that entered the
+// pending_review state
+func (s *Server) requestReview(ctx context.Context, info tusd.FileInfo, record uploadstate.Record) {
+	s.events.Notify(ctx, events.Event{
+		Type:        events.UploadReviewRequested,
+		Upload:      info,
+		State:       string(record.State),
+		Annotations: record.Annotations,
+		Time:        time.Now(),
+	})
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/rejection"
+	"github.com/devsnb/large-file-uploads/pkg/schedule"
+)
+
+// ScheduledAtHeader tells the client when a queued upload accepts data
+const ScheduledAtHeader = "Upload-Scheduled-At"
+
+// ScheduledAtMetadataKey records when a queued upload accepts data
+const ScheduledAtMetadataKey = "scheduled_at"
+
+// checkSchedule refuses creations outside the upload windows of the first
+// matching schedule rule. Rules that queue uploads return the time the
+// upload accepts data instead; creations carrying data are refused then.
+func (s *Server) checkSchedule(hook tusd.HookEvent) (time.Time, error) {
+	if s.schedule == nil || hook.Upload.IsFinal {
+		return time.Time{}, nil
+	}
+
+	var tenant string
+	if user, err := auth.GetUserFromContext(hook.Context); err == nil {
+		tenant = user.Tenant
+	}
+
+	closure := s.schedule.Check(tenant, hook.Upload.Size, hook.Upload.SizeIsDeferred, time.Now())
+	if closure == nil {
+		return time.Time{}, nil
+	}
+
+	if closure.Action == schedule.Queue && !closure.Opens.IsZero() {
+		if !strings.HasPrefix(hook.HTTPRequest.Header.Get("Content-Type"), "application/offset+octet-stream") {
+			return closure.Opens.UTC(), nil
+		}
+		return time.Time{}, scheduleRejection(http.StatusServiceUnavailable, rejection.CodeOutsideUploadWindow, closure,
+			"uploads are queued until %s, create the upload without data")
+	}
+	return time.Time{}, scheduleRejection(http.StatusForbidden, rejection.CodeOutsideUploadWindow, closure,
+		"uploads are not accepted until %s")
+}
+
+// scheduleMiddleware refuses chunks of queued uploads before their scheduled
+// time with 503 and a Retry-After header
+func (s *Server) scheduleMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := strings.Trim(c.Param("any"), "/")
+		if c.Request.Method != http.MethodPatch || id == "" {
+			c.Next()
+			return
+		}
+
+		// Errors are left to tusd, which reports them properly
+		info, err := s.uploadInfo(c.Request.Context(), id)
+		if err != nil {
+			c.Next()
+			return
+		}
+		scheduledAt, err := time.Parse(time.RFC3339, info.MetaData[ScheduledAtMetadataKey])
+		if err != nil || !time.Now().Before(scheduledAt) {
+			c.Next()
+			return
+		}
+
+		s.abortTus(c, scheduleRejection(http.StatusServiceUnavailable, rejection.CodeUploadScheduled,
+			&schedule.Closure{Opens: scheduledAt}, "upload is scheduled for %s"))
+	}
+}
+
+// scheduleRejection describes a closure, formatting the opening time into the
+// message and the Retry-After header
+func scheduleRejection(status int, code string, closure *schedule.Closure, format string) *rejection.Error {
+	if closure.Opens.IsZero() {
+		return rejection.New(status, code, "uploads are not accepted").
+			WithDetail("reason", closure.Reason)
+	}
+
+	opens := closure.Opens.UTC().Format(time.RFC3339)
+	message := fmt.Sprintf(format, opens)
+	if closure.Message != "" {
+		message += ": " + closure.Message
+	}
+	rejected := rejection.New(status, code, message).
+		WithDetail("opensAt", opens).
+		WithRetryAfter(time.Until(closure.Opens))
+	if closure.Reason != "" {
+		rejected.WithDetail("reason", closure.Reason)
+	}
+	return rejected
+}
+
+// newSchedule converts the schedule configuration into a schedule, or nil if
+// no rules are configured
+func newSchedule(cfg config.ScheduleConfig) (*schedule.Schedule, error) {
+	if len(cfg.Rules) == 0 {
+		return nil, nil
+	}
+
+	rules := make([]schedule.Rule, 0, len(cfg.Rules))
+	for i, ruleCfg := range cfg.Rules {
+		rule := schedule.Rule{
+			Tenants: ruleCfg.Tenants,
+			MinSize: ruleCfg.MinSize,
+			Action:  schedule.Action(strings.ToLower(ruleCfg.Action)),
+		}
+		if ruleCfg.Timezone != "" {
+			loc, err := time.LoadLocation(ruleCfg.Timezone)
+			if err != nil {
+				return nil, fmt.Errorf("schedule rule %d: invalid timezone: %w", i+1, err)
+			}
+			rule.Location = loc
+		}
+
+		for _, windowCfg := range ruleCfg.Windows {
+			days, err := schedule.ParseDays(windowCfg.Days)
+			if err != nil {
+				return nil, fmt.Errorf("schedule rule %d: %w", i+1, err)
+			}
+			start, err := schedule.ParseClock(windowCfg.Start)
+			if err != nil {
+				return nil, fmt.Errorf("schedule rule %d: %w", i+1, err)
+			}
+			end, err := schedule.ParseClock(windowCfg.End)
+			if err != nil {
+				return nil, fmt.Errorf("schedule rule %d: %w", i+1, err)
+			}
+			rule.Windows = append(rule.Windows, schedule.Window{Days: days, Start: start, End: end})
+		}
+
+		for _, blackoutCfg := range ruleCfg.Blackouts {
+			from, err := time.Parse(time.RFC3339, blackoutCfg.From)
+			if err != nil {
+				return nil, fmt.Errorf("schedule rule %d: invalid blackout start: %w", i+1, err)
+			}
+			to, err := time.Parse(time.RFC3339, blackoutCfg.To)
+			if err != nil {
+				return nil, fmt.Errorf("schedule rule %d: invalid blackout end: %w", i+1, err)
+			}
+			rule.Blackouts = append(rule.Blackouts, schedule.Blackout{From: from, To: to, Reason: blackoutCfg.Reason})
+		}
+
+		rules = append(rules, rule)
+	}
+	return schedule.New(rules)
+}
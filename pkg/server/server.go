@@ -0,0 +1,1257 @@
+// Package server wires the storage backend, the tus handler and the HTTP
+// router together and exposes hooks for applications embedding the service.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/hooks"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/devsnb/large-file-uploads/pkg/access"
+	"github.com/devsnb/large-file-uploads/pkg/antivirus"
+	"github.com/devsnb/large-file-uploads/pkg/apikey"
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+	"github.com/devsnb/large-file-uploads/pkg/banlist"
+	"github.com/devsnb/large-file-uploads/pkg/batch"
+	"github.com/devsnb/large-file-uploads/pkg/callback"
+	"github.com/devsnb/large-file-uploads/pkg/catalog"
+	"github.com/devsnb/large-file-uploads/pkg/cdn"
+	"github.com/devsnb/large-file-uploads/pkg/chunkadvice"
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/content"
+	"github.com/devsnb/large-file-uploads/pkg/deadletter"
+	"github.com/devsnb/large-file-uploads/pkg/deletion"
+	"github.com/devsnb/large-file-uploads/pkg/delta"
+	"github.com/devsnb/large-file-uploads/pkg/diagnostics"
+	"github.com/devsnb/large-file-uploads/pkg/eventlog"
+	"github.com/devsnb/large-file-uploads/pkg/events"
+	"github.com/devsnb/large-file-uploads/pkg/features"
+	"github.com/devsnb/large-file-uploads/pkg/georoute"
+	"github.com/devsnb/large-file-uploads/pkg/idempotency"
+	"github.com/devsnb/large-file-uploads/pkg/intake"
+	"github.com/devsnb/large-file-uploads/pkg/inventory"
+	"github.com/devsnb/large-file-uploads/pkg/journal"
+	"github.com/devsnb/large-file-uploads/pkg/jws"
+	"github.com/devsnb/large-file-uploads/pkg/logging"
+	"github.com/devsnb/large-file-uploads/pkg/metrics"
+	"github.com/devsnb/large-file-uploads/pkg/milestone"
+	"github.com/devsnb/large-file-uploads/pkg/origin"
+	"github.com/devsnb/large-file-uploads/pkg/ratelimit"
+	"github.com/devsnb/large-file-uploads/pkg/rejection"
+	"github.com/devsnb/large-file-uploads/pkg/report"
+	"github.com/devsnb/large-file-uploads/pkg/reservation"
+	"github.com/devsnb/large-file-uploads/pkg/schedule"
+	"github.com/devsnb/large-file-uploads/pkg/schema"
+	"github.com/devsnb/large-file-uploads/pkg/share"
+	"github.com/devsnb/large-file-uploads/pkg/signing"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+	"github.com/devsnb/large-file-uploads/pkg/tenant"
+	"github.com/devsnb/large-file-uploads/pkg/tiering"
+	"github.com/devsnb/large-file-uploads/pkg/traffic"
+	"github.com/devsnb/large-file-uploads/pkg/uploadid"
+	"github.com/devsnb/large-file-uploads/pkg/uploadstate"
+	"github.com/devsnb/large-file-uploads/pkg/webhook"
+)
+
+// DefaultBasePath is the URL path the tus endpoints are mounted on
+const DefaultBasePath = "/files/"
+
+// Server is the upload server
+type Server struct {
+	cfg            *config.Config
+	store          storage.Storage
+	composer       *tusd.StoreComposer
+	events         *events.Bus
+	deadLetters    *deadletter.Queue
+	classPolicy    storage.ClassPolicy
+	signer         *signing.Signer
+	downloadSigner *signing.Signer
+	locationSigner *signing.Signer
+	diagnostics    *diagnostics.Tracker
+	chunkAdvice    *chunkadvice.Advisor
+	rejections     *rejection.Renderer
+	schemas        *schema.Registry
+	states         *uploadstate.Machine
+	idempotency    *idempotency.Cache
+	catalog        *catalog.Catalog
+	access         *access.Recorder
+	contents       storage.ContentStore
+	presigner      storage.Presigner
+	failover       storage.Failover
+	mirror         storage.Mirror
+	cdn            cdn.Signer
+	intakes        *intake.Registry
+	tenants        *tenant.Registry
+	apiKeys        *apikey.Registry
+	shares         *share.Registry
+	reservations   *reservation.Book
+	deltas         *delta.Plans
+	batches        *batch.Registry
+	exports        *inventory.Jobs
+	scanner        antivirus.Engine
+	scanCache      *antivirus.ScanCache
+	scans          *metrics.Scans
+	bans           *banlist.List
+	origins        *origin.Resolver
+	clients        *origin.Resolver
+	features       *features.Registry
+	stamps         *stamps
+	tusdHooks      *tusdHooks
+	deletions      *deletion.Queue
+	tiering        *tiering.Queue
+	tierer         storage.Tierer
+	traffic        *traffic.Meter
+	costReports    costReports
+	alerts         *webhook.Client
+	healthReports  *report.Collector
+	processSlots   chan struct{}
+	scanSlots      chan struct{}
+	processing     processingJobs
+	callbacks      *callback.Notifier
+	callbackSigner *jws.Signer
+	eventLog       *eventlog.Log
+	replays        replayJobs
+	milestones     *milestone.Tracker
+	schedule       *schedule.Schedule
+	ids            uploadid.Generator
+	authorizer     auth.Authorizer
+	custom         map[string][]customMiddleware
+	logLevel       logLevelState
+	throttles      *metrics.Throttles
+	panics         *metrics.Panics
+	requests       *metrics.Requests
+	lifecycles     *metrics.Lifecycles
+	limiter        *ratelimit.Limiter
+	concurrency    *ratelimit.Concurrency
+	journal        *journal.Journal
+	journalReport  journalReport
+	divergences    *metrics.Divergences
+	regions        *georoute.Policy
+	contentRefs    *content.Table
+	contentFlight  singleflight.Group
+	contentMu      sync.Mutex
+	tusHandler     *tusd.Handler
+	cors           gin.HandlerFunc
+	tlsConfig      *tls.Config
+	router         *gin.Engine
+	hooks          lifecycle
+	readiness      readiness
+	draining       atomic.Bool
+	inflightChunks atomic.Int64
+	background     context.Context // canceled when the server stops
+	stopBackground context.CancelFunc
+	backgroundDone chan struct{}
+	jobs           backgroundJobs
+	repairsStorage bool
+	reconciled     chan struct{} // closed once startup reconciliation is done
+	capabilities   *storage.Capabilities
+}
+
+// New creates a new upload server for the given configuration and
+// initialized storage backend
+func New(cfg *config.Config, store storage.Storage) (*Server, error) {
+	s := &Server{
+		cfg:    cfg,
+		store:  store,
+		events: events.NewBus(),
+	}
+
+	if cfg.Admin.Enabled && cfg.Admin.Token == "" {
+		return nil, fmt.Errorf("admin API requires a token to be set")
+	}
+
+	if cfg.Auth.Enabled && cfg.Auth.JWTSecret == "" {
+		return nil, fmt.Errorf("authentication requires a JWT secret to be set")
+	}
+
+	if cfg.Review.Enabled && !cfg.Auth.Enabled {
+		return nil, fmt.Errorf("upload review requires authentication to be enabled")
+	}
+
+	if tenantScoped(store) && !cfg.Auth.Enabled {
+		return nil, fmt.Errorf("per-tenant storage credentials and buckets require authentication to be enabled")
+	}
+
+	// The backend is created before the server, so a configured key it
+	// wasn't given would otherwise leave objects unencrypted unnoticed
+	if cfg.Storage.S3.SSEKMSKeyID != "" {
+		if e, ok := store.(storage.Encrypter); !ok || e.SSEKMSKeyID() == "" {
+			return nil, fmt.Errorf("storage.s3.sseKmsKeyId is set but the storage backend does not encrypt with it, create it with Factory.SetSSEKMSKeyID")
+		}
+	}
+
+	s.signer = signing.NewSigner(cfg.Claims.Secret)
+	s.downloadSigner = signing.NewSigner(cfg.Downloads.Secret)
+	s.locationSigner = signing.NewSigner(cfg.SignedURLs.Secret)
+	s.rejections = rejection.NewRenderer(cfg.Rejections.Messages)
+
+	if cfg.Idempotency.Enabled {
+		s.idempotency = idempotency.NewCache(s.idempotencyWindow())
+	}
+
+	if cfg.Diagnostics.Enabled {
+		diagnosticsStore, err := newDiagnosticsStore(cfg.Diagnostics)
+		if err != nil {
+			return nil, err
+		}
+		s.diagnostics = diagnostics.NewTracker(diagnosticsStore, time.Duration(cfg.Diagnostics.Retention)*time.Second, cfg.Diagnostics.Timeline)
+	}
+
+	schemas, err := schema.NewRegistry(cfg.Schemas.Default, cfg.Schemas.Tenants)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load metadata schemas: %w", err)
+	}
+	s.schemas = schemas
+
+	s.classPolicy = newClassPolicy(cfg.Storage.StorageClass)
+	if err := s.classPolicy.Validate(store.GetProvider()); err != nil {
+		return nil, err
+	}
+	if s.classPolicy.Configured() && !storage.SupportsStorageClasses(store.GetProvider()) {
+		slog.Warn("Storage classes are not supported and are ignored", "provider", store.GetProvider())
+	}
+
+	uploadSchedule, err := newSchedule(cfg.Schedule)
+	if err != nil {
+		return nil, err
+	}
+	s.schedule = uploadSchedule
+
+	deadLetterStore, err := newDeadLetterStore(cfg.DeadLetters)
+	if err != nil {
+		return nil, err
+	}
+	s.deadLetters = deadletter.NewQueue(deadLetterStore)
+
+	// Quarantined uploads and uploads in review are only held back by their
+	// state, which in-memory stores forget on restart
+	if cfg.States.Dir == "" && (cfg.Antivirus.Enabled || cfg.BanList.Enabled || cfg.Review.Enabled) {
+		return nil, errors.New("antivirus, the ban list and review require states.dir to keep upload states across restarts")
+	}
+	stateStore, err := newStateStore(cfg.States)
+	if err != nil {
+		return nil, err
+	}
+	s.states = uploadstate.NewMachine(stateStore)
+
+	catalogStore, err := newCatalogStore(cfg.Catalog)
+	if err != nil {
+		return nil, err
+	}
+	s.catalog = catalog.New(catalogStore)
+
+	intakeStore, err := newIntakeStore(cfg.Intakes)
+	if err != nil {
+		return nil, err
+	}
+	s.intakes = intake.NewRegistry(intakeStore)
+
+	tenantStore, err := newTenantStore(cfg.Tenants)
+	if err != nil {
+		return nil, err
+	}
+	s.tenants = tenant.NewRegistry(tenantStore)
+
+	if cfg.APIKeys.Enabled {
+		if !cfg.Auth.Enabled {
+			return nil, fmt.Errorf("api keys require authentication to be enabled")
+		}
+		apiKeyStore, err := newAPIKeyStore(cfg.APIKeys)
+		if err != nil {
+			return nil, err
+		}
+		s.apiKeys = apikey.NewRegistry(apiKeyStore)
+	}
+	if cfg.Shares.Enabled {
+		if !cfg.Auth.Enabled {
+			return nil, fmt.Errorf("share links require authentication to be enabled")
+		}
+		shareStore, err := newShareStore(cfg.Shares)
+		if err != nil {
+			return nil, err
+		}
+		s.shares = share.NewRegistry(shareStore)
+	}
+	if cfg.Reservations.Enabled {
+		if !cfg.Auth.Enabled {
+			return nil, fmt.Errorf("reservations require authentication to be enabled")
+		}
+		reservationStore, err := newReservationStore(cfg.Reservations)
+		if err != nil {
+			return nil, err
+		}
+		s.reservations = reservation.NewBook(reservationStore, cfg.Reservations.Capacity)
+	}
+	if cfg.DeltaUploads.Enabled {
+		deltaStore, err := newDeltaStore(cfg.DeltaUploads)
+		if err != nil {
+			return nil, err
+		}
+		s.deltas = delta.NewPlans(deltaStore, time.Duration(cfg.DeltaUploads.TTL)*time.Second)
+	}
+	if cfg.Batches.Enabled {
+		batchStore, err := newBatchStore(cfg.Batches)
+		if err != nil {
+			return nil, err
+		}
+		s.batches = batch.NewRegistry(batchStore)
+	}
+	exports, err := s.newExportJobs(cfg.Exports)
+	if err != nil {
+		return nil, err
+	}
+	s.exports = exports
+	s.access = access.NewRecorder(s.statsInterval(), s.flushDownloads)
+
+	if presigner, ok := storage.Lookup[storage.Presigner](store); ok {
+		replicas := cfg.Downloads.Replicas
+		s.presigner = presigner
+		s.regions = georoute.NewPolicy(replicas.RegionHeader, replicas.CountryHeader, replicas.Regions)
+	}
+	if failover, ok := store.(storage.Failover); ok {
+		// Content keys, storage classes and CDN origins belong to one backend
+		if cfg.Content.Enabled || cfg.Storage.Tiering.Enabled || cfg.CDN.Provider != "" {
+			return nil, errors.New("content-addressable storage, tiering and CDN URLs can't be combined with failover storage")
+		}
+		s.failover = failover
+	}
+	if mirror, ok := store.(storage.Mirror); ok {
+		// Content keys aren't replicated, only the uploads' own objects
+		if cfg.Content.Enabled {
+			return nil, errors.New("content-addressable storage can't be combined with storage mirrors")
+		}
+		s.mirror = mirror
+	}
+
+	tlsConfig, err := newTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	s.tlsConfig = tlsConfig
+
+	cdnSigner, err := newCDNSigner(cfg.CDN, store)
+	if err != nil {
+		return nil, err
+	}
+	s.cdn = cdnSigner
+
+	if cfg.Content.Enabled {
+		contents, ok := storage.Lookup[storage.ContentStore](store)
+		if !ok {
+			return nil, fmt.Errorf("content-addressable storage is not supported by %s storage", store.GetProvider())
+		}
+		refStore, err := newContentStore(cfg.Content)
+		if err != nil {
+			return nil, err
+		}
+		s.contents = contents
+		s.contentRefs = content.NewTable(refStore)
+	}
+
+	if cfg.Storage.Tiering.Enabled {
+		tierer, ok := storage.Lookup[storage.Tierer](store)
+		if !ok {
+			return nil, fmt.Errorf("tiering is not supported by %s storage", store.GetProvider())
+		}
+		if s.contents != nil {
+			return nil, fmt.Errorf("tiering can't be combined with content-addressable storage")
+		}
+		queue, err := newTieringQueue(cfg.Storage.Tiering, store.GetProvider())
+		if err != nil {
+			return nil, err
+		}
+		s.tierer = tierer
+		s.tiering = queue
+	}
+
+	if cfg.EventLog.Enabled {
+		eventLogStore, err := newEventLogStore(cfg.EventLog)
+		if err != nil {
+			return nil, err
+		}
+		eventLog, err := eventlog.New(context.Background(), eventLogStore, time.Duration(cfg.EventLog.Retention)*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		s.eventLog = eventLog
+	}
+
+	if cfg.Milestones.Enabled {
+		milestones, err := milestone.New(cfg.Milestones.Percentages)
+		if err != nil {
+			return nil, err
+		}
+		s.milestones = milestones
+	}
+
+	ids, err := uploadid.New(uploadid.Scheme(cfg.UploadIDs.Scheme))
+	if err != nil {
+		return nil, err
+	}
+	s.ids = ids
+
+	authorizer, err := newAuthorizer(cfg.Auth)
+	if err != nil {
+		return nil, err
+	}
+	s.authorizer = authorizer
+
+	uploadJournal, err := newJournal(cfg.Journal)
+	if err != nil {
+		return nil, err
+	}
+	s.journal = uploadJournal
+	s.divergences = metrics.NewDivergences()
+
+	scanner, err := newScanner(cfg.Antivirus)
+	if err != nil {
+		return nil, err
+	}
+	s.scanner = scanner
+	s.scans = metrics.NewScans()
+
+	scanCache, err := newScanCache(cfg.Antivirus, scanner)
+	if err != nil {
+		return nil, err
+	}
+	s.scanCache = scanCache
+
+	bans, err := newBanList(cfg.BanList)
+	if err != nil {
+		return nil, err
+	}
+	s.bans = bans
+
+	clients, err := newClients(cfg.Origins)
+	if err != nil {
+		return nil, err
+	}
+	s.clients = clients
+
+	origins, err := newOrigins(cfg.Origins)
+	if err != nil {
+		return nil, err
+	}
+	s.origins = origins
+
+	flags, err := newFeatures(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s.features = flags
+
+	stamps, err := newStamps(cfg.Stamps)
+	if err != nil {
+		return nil, err
+	}
+	s.stamps = stamps
+
+	tusdHooks, err := newTusdHooks(cfg.TusdHooks)
+	if err != nil {
+		return nil, err
+	}
+	s.tusdHooks = tusdHooks
+
+	deletions, err := newDeletionQueue(cfg.Termination)
+	if err != nil {
+		return nil, err
+	}
+	s.deletions = deletions
+
+	meter, err := newTrafficMeter(cfg.Traffic)
+	if err != nil {
+		return nil, err
+	}
+	s.traffic = meter
+	s.processSlots = make(chan struct{}, max(cfg.States.ProcessingConcurrency, 1))
+	s.scanSlots = make(chan struct{}, max(cfg.Antivirus.Concurrency, 1))
+
+	s.throttles = metrics.NewThrottles()
+	s.panics = metrics.NewPanics()
+	s.requests = metrics.NewRequests()
+	s.lifecycles = metrics.NewLifecycles(cfg.Metrics.MaxTenants)
+	s.limiter, s.concurrency = newRateLimits(cfg.RateLimit)
+	composer, err := newComposer(cfg, store, s.storageThrottled)
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.Termination.Enabled {
+		// Neither advertise nor accept the termination extension. The
+		// composer is copied, as it may be shared with the storage.
+		if s.deletions != nil {
+			return nil, fmt.Errorf("termination grace period requires termination to be enabled")
+		}
+		withoutTermination := *composer
+		withoutTermination.UsesTerminater = false
+		composer = &withoutTermination
+	}
+	s.composer = composer
+	if s.deletions != nil && !composer.UsesTerminater {
+		return nil, fmt.Errorf("termination grace period requires a storage backend that supports termination")
+	}
+	s.adaptToCapabilities(store)
+	s.chunkAdvice = s.newChunkAdvisor()
+
+	tusHandler, err := tusd.NewHandler(tusd.Config{
+		BasePath:                   DefaultBasePath,
+		StoreComposer:              composer,
+		NotifyCreatedUploads:       true,
+		NotifyUploadProgress:       true,
+		NotifyCompleteUploads:      true,
+		NotifyTerminatedUploads:    true,
+		DisableDownload:            false,
+		Cors:                       tusCors,
+		PreUploadCreateCallback:    s.preUploadCreate,
+		PreFinishResponseCallback:  s.preFinishResponse,
+		PreUploadTerminateCallback: s.preUploadTerminate,
+		NetworkTimeout:             s.networkTimeout(),
+		Logger:                     logging.NewTusdLogger(slog.Default()),
+
+		// Draft requests only reach the handler if the tusV2 flag is on
+		EnableExperimentalProtocol: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tus handler: %w", err)
+	}
+	s.tusHandler = tusHandler
+
+	background, stopBackground := context.WithCancel(context.Background())
+	s.background, s.stopBackground = background, stopBackground
+	s.backgroundDone = make(chan struct{})
+	go func() {
+		defer close(s.backgroundDone)
+		var wg sync.WaitGroup
+		if s.traffic != nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.traffic.Run(background)
+			}()
+		}
+		if s.failover != nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.failover.RunHealthChecks(background)
+			}()
+		}
+		if s.mirror != nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.mirror.RunReplication(background, s.lockUpload, s.reportReplication)
+			}()
+		}
+		s.access.Run(background)
+		wg.Wait()
+		s.jobs.close()
+		s.events.Close()
+	}()
+	s.goBackground(s.forwardNotifications)
+	if s.mirror != nil {
+		s.OnUploadComplete(s.replicateUpload)
+	}
+	if s.journal != nil {
+		s.OnUploadComplete(s.forgetJournal)
+		s.OnUploadTerminated(s.forgetJournal)
+	}
+	if cfg.Costs.Enabled {
+		s.OnUploadTransitioned(s.forgetCostUsage)
+		s.goBackground(s.runCostReports)
+	}
+	if s.deletions != nil {
+		s.goBackground(s.runDeletions)
+	}
+	if s.tiering != nil {
+		s.OnUploadComplete(s.scheduleTransition)
+		s.OnUploadTerminated(s.forgetTransition)
+		s.goBackground(s.runTiering)
+	}
+	if s.eventLog != nil {
+		s.goBackground(s.eventLog.Run)
+		for _, eventType := range eventlog.Types {
+			s.events.Subscribe(eventType, s.eventLog.Record)
+		}
+	}
+
+	if cfg.Callbacks.Enabled {
+		notifier := callback.NewNotifier(cfg.Callbacks, store, s.deadLetters)
+		if s.contents != nil {
+			notifier.UseChecksum(s.contentChecksum)
+		}
+		notifier.UseAnnotations(s.uploadAnnotations)
+		s.OnUploadCreated(notifier.Validate, events.WithMode(events.Sync))
+		s.OnUploadComplete(notifier.Deliver)
+		if s.batches != nil {
+			s.OnBatchComplete(notifier.Deliver)
+		}
+		if s.milestones != nil {
+			s.OnUploadMilestone(notifier.DeliverMilestone)
+		}
+		if s.postProcessing() {
+			s.OnUploadStateChanged(notifier.DeliverProcessed)
+		}
+		if cfg.Callbacks.Signing.KeyFile != "" {
+			signer, err := jws.LoadSigner(cfg.Callbacks.Signing.KeyFile, cfg.Callbacks.Signing.KeyID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load callback signing key: %w", err)
+			}
+			notifier.UseSigner(signer)
+			s.callbackSigner = signer
+		}
+		s.callbacks = notifier
+	}
+
+	if s.contents != nil {
+		s.OnUploadComplete(s.storeContent)
+		s.OnUploadTerminated(s.releaseContent)
+	}
+
+	if s.postProcessing() {
+		s.OnUploadComplete(s.processUpload)
+		s.OnUploadTerminated(s.forgetProcessing)
+	}
+	if s.bans != nil && cfg.BanList.AlertURL != "" {
+		s.alerts = webhook.NewClient(callback.DefaultTimeout, callback.DefaultMaxRetries)
+		s.OnUploadBanned(s.deliverBanAlert)
+	}
+	if cfg.Reports.Enabled {
+		s.healthReports = report.NewCollector(cfg.Reports.TopTenants)
+		if s.alerts == nil {
+			s.alerts = webhook.NewClient(callback.DefaultTimeout, callback.DefaultMaxRetries)
+		}
+		s.subscribeHealthReports()
+		s.goBackground(s.runHealthReports)
+	}
+
+	s.OnUploadCreated(s.registerUpload)
+	s.OnUploadTerminated(s.forgetUpload)
+	s.OnUploadTerminated(s.forgetDownloads)
+	if s.shares != nil {
+		s.OnUploadTerminated(s.forgetShares)
+	}
+
+	if s.diagnostics != nil {
+		s.OnUploadTerminated(s.forgetDiagnostics)
+	}
+
+	if s.chunkAdvice != nil {
+		s.OnUploadComplete(s.forgetChunkAdvice, events.WithMode(events.Async))
+		s.OnUploadTerminated(s.forgetChunkAdvice, events.WithMode(events.Async))
+	}
+
+	if cfg.Metrics.Enabled {
+		s.OnUploadTerminated(s.forgetLifecycle)
+	}
+
+	if s.milestones != nil {
+		s.OnUploadTerminated(s.forgetMilestones)
+	}
+
+	if s.reservations != nil {
+		s.OnUploadTerminated(s.releaseTerminated)
+	}
+
+	if s.deltas != nil {
+		s.OnUploadComplete(s.forgetDeltaPlan)
+		s.OnUploadTerminated(s.forgetDeltaPlan)
+	}
+
+	if s.batches != nil {
+		s.OnUploadComplete(s.completeBatchMember)
+		s.OnUploadTerminated(s.leaveBatch)
+	}
+
+	cors, err := corsMiddleware(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s.cors = cors
+	router, err := s.setupRouter()
+	if err != nil {
+		return nil, err
+	}
+	s.router = router
+
+	// Reconciliation runs once every subscriber is registered, since it may
+	// send the notifications of repaired uploads. Storage is repaired before
+	// the journal is compared to it.
+	// Repairs are finished before Serve accepts requests.
+	s.reconciled = make(chan struct{})
+	reconciler, reconciles := store.(storage.UploadReconciler)
+	if repairer, ok := store.(storage.UploadRepairer); ok && reconciles {
+		s.repairsStorage = repairer.RepairsUploads()
+	}
+	go func() {
+		defer close(s.reconciled)
+		if reconciles {
+			s.reconcileStorage(background, reconciler)
+		}
+		if s.journal != nil {
+			s.reconcileJournal(background)
+		}
+	}()
+
+	return s, nil
+}
+
+// OnUploadCreated subscribes to upload creation. Synchronous subscribers run
+// before the upload is created and can reject it; the upload ID is not yet
+// assigned at that point.
+func (s *Server) OnUploadCreated(handler events.Handler, opts ...events.SubscribeOption) {
+	s.events.Subscribe(events.UploadCreated, handler, opts...)
+}
+
+// OnUploadProgress subscribes to upload progress notifications. Progress
+// subscribers are always invoked asynchronously.
+func (s *Server) OnUploadProgress(handler events.Handler, opts ...events.SubscribeOption) {
+	opts = append(opts, events.WithMode(events.Async))
+	s.events.Subscribe(events.UploadProgress, handler, opts...)
+}
+
+// OnUploadComplete subscribes to upload completion. Synchronous subscribers
+// run before the final PATCH is acknowledged and can reject it.
+func (s *Server) OnUploadComplete(handler events.Handler, opts ...events.SubscribeOption) {
+	s.events.Subscribe(events.UploadCompleted, handler, opts...)
+}
+
+// OnUploadTerminated subscribes to upload termination. Synchronous subscribers
+// run before the upload is deleted and can reject the termination.
+func (s *Server) OnUploadTerminated(handler events.Handler, opts ...events.SubscribeOption) {
+	s.events.Subscribe(events.UploadTerminated, handler, opts...)
+}
+
+// Events returns the event bus used by the server
+func (s *Server) Events() *events.Bus {
+	return s.events
+}
+
+// DeadLetters returns the dead-letter queue of failed event deliveries
+func (s *Server) DeadLetters() *deadletter.Queue {
+	return s.deadLetters
+}
+
+// Router returns the underlying HTTP router
+func (s *Server) Router() *gin.Engine {
+	return s.router
+}
+
+// Run starts the HTTP server on the given address and serves until it fails
+func (s *Server) Run(addr string) error {
+	return s.Serve(context.Background(), addr)
+}
+
+// setupRouter creates the gin router with middleware and routes
+func (s *Server) setupRouter() (*gin.Engine, error) {
+	if !s.cfg.App.Debug {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	r := gin.New() // Use New() instead of Default() to avoid using the default logger
+
+	// c.ClientIP trusts the same proxies as the client resolver
+	r.RemoteIPHeaders = []string{"X-Forwarded-For"}
+	if err := r.SetTrustedProxies(s.cfg.Origins.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("failed to configure trusted proxies: %w", err)
+	}
+
+	// Add the middleware of every request in the configured order
+	global, err := buildChain(GlobalChain, s.globalMiddleware(), s.cfg.Middleware.Global, s.custom[GlobalChain])
+	if err != nil {
+		return nil, err
+	}
+	r.Use(global...)
+
+	// Health check
+	r.GET("/health", func(c *gin.Context) {
+		if s.draining.Load() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"status":  "draining",
+				"storage": string(s.store.GetProvider()),
+			})
+			return
+		}
+		c.JSON(200, gin.H{
+			"status":  "ok",
+			"storage": string(s.store.GetProvider()),
+		})
+	})
+
+	// Readiness of the server and its dependencies
+	r.GET("/readyz", s.getReadiness)
+
+	// Schemas of the payloads posted to consumers
+	r.GET("/schemas/events", listEventSchemas)
+	r.GET("/schemas/events/:name", getEventSchema)
+
+	// Public key of callback signatures
+	if s.callbackSigner != nil {
+		r.GET("/.well-known/jwks.json", s.getJWKS)
+	}
+
+	// Prometheus metrics
+	if s.cfg.Metrics.Enabled {
+		r.GET("/metrics", gin.WrapH(s.metricsHandler()))
+	}
+
+	// Upload demo page
+	if s.cfg.Demo.Enabled {
+		r.GET("/demo", serveDemo)
+	}
+
+	// Operator API
+	if s.cfg.Admin.Enabled {
+		admin := r.Group("/admin", adminAuthMiddleware(s.cfg.Admin.Token))
+		if s.idempotency != nil {
+			admin.Use(s.idempotencyMiddleware(abortAPI))
+		}
+		s.registerAdminRoutes(admin)
+	}
+
+	// Upload API
+	api := r.Group("/api")
+	api.GET("/claims/:token", s.redeemClaim)
+	authed := api.Group("", s.userAuthMiddleware())
+	if s.idempotency != nil {
+		authed.Use(s.idempotencyMiddleware(abortAPI))
+	}
+	authed.POST("/uploads/:id/claims", s.createClaim)
+	authed.POST("/uploads/:id/download-tokens", s.createDownloadToken)
+	if s.presigner != nil || s.cdn != nil {
+		authed.POST("/uploads/:id/download-url", s.createDownloadURL)
+		authed.POST("/download-urls", s.createDownloadURLs)
+	}
+	if s.shares != nil {
+		authed.GET("/uploads/:id/shares", s.listShares)
+		authed.POST("/uploads/:id/shares", s.createShare)
+		authed.DELETE("/uploads/:id/shares/:sid", s.revokeShare)
+	}
+	authed.GET("/uploads", s.listUploads)
+	authed.GET("/uploads/:id/state", s.getUploadState)
+	if s.deletions != nil {
+		authed.POST("/uploads/:id/restore", s.restoreUpload)
+	}
+	authed.GET("/uploads/:id/tags", s.getUploadTags)
+	authed.PUT("/uploads/:id/tags", s.setUploadTags)
+	authed.GET("/collections", s.listCollections)
+	authed.POST("/collections", s.createCollection)
+	authed.GET("/collections/:cid", s.getCollection)
+	authed.DELETE("/collections/:cid", s.deleteCollection)
+	authed.PUT("/collections/:cid/uploads/:id", s.addToCollection)
+	authed.DELETE("/collections/:cid/uploads/:id", s.removeFromCollection)
+	authed.GET("/intakes/:iid", s.getIntakeLimits)
+	authed.GET("/upload-hints", s.getUploadHints)
+	if s.traffic != nil {
+		authed.GET("/traffic", s.getTraffic)
+	}
+	if s.cfg.Review.Enabled {
+		authed.GET("/reviews", s.listReviews)
+		authed.POST("/uploads/:id/review", s.reviewUpload)
+	}
+	if s.apiKeys != nil {
+		authed.GET("/keys", s.listAPIKeys)
+		authed.POST("/keys", s.createAPIKey)
+		authed.POST("/keys/:kid/rotate", s.rotateAPIKey)
+		authed.DELETE("/keys/:kid", s.revokeAPIKey)
+	}
+	if s.reservations != nil {
+		authed.GET("/reservations", s.listReservations)
+		authed.POST("/reservations", s.createReservation)
+		authed.GET("/reservations/:rid", s.getReservation)
+		authed.DELETE("/reservations/:rid", s.cancelReservation)
+	}
+	if s.deltas != nil {
+		authed.POST("/uploads/:id/delta", s.createDeltaPlan)
+	}
+	if s.batches != nil {
+		authed.GET("/batches", s.listBatches)
+		authed.POST("/batches", s.createBatch)
+		authed.GET("/batches/:bid", s.getBatch)
+		authed.POST("/batches/:bid/close", s.closeBatch)
+	}
+	if s.diagnostics != nil {
+		authed.GET("/uploads/:id/diagnostics", s.getDiagnostics)
+	}
+	authed.GET("/exports/uploads", s.exportUploads)
+	if s.exports != nil {
+		authed.POST("/exports", s.startExport)
+		authed.GET("/exports/jobs/:jid", s.getExportJob)
+		authed.GET("/exports/jobs/:jid/download", s.downloadExport)
+	}
+
+	// Define routes with middleware
+	uploads, err := buildChain(UploadChain, s.uploadMiddleware(), s.cfg.Middleware.Uploads, s.custom[UploadChain])
+	if err != nil {
+		return nil, err
+	}
+	// Client aborts are detected ahead of the configurable chain, so every
+	// middleware reading or measuring the body sees them
+	tusGroup := r.Group("/files", append([]gin.HandlerFunc{s.clientAbortMiddleware()}, uploads...)...)
+
+	// Handle all TUS protocol methods using the simplified StripPrefix approach
+	tusGroup.Any("/*any", s.tusV2Gate, gin.WrapH(http.StripPrefix(DefaultBasePath, s.tusHandler)))
+
+	return r, nil
+}
+
+// preUploadCreate enforces the upload policy, schedule, intake, tenant and reservation, records
+// the origin and owner, resolves the storage class, claims the delta plan, joins the batch and
+// runs synchronous creation subscribers
+func (s *Server) preUploadCreate(hook tusd.HookEvent) (tusd.HTTPResponse, tusd.FileInfoChanges, error) {
+	var changes tusd.FileInfoChanges
+
+	// The pre-create hook may replace the client metadata, which the checks
+	// below then apply to, but not the fields the server sets
+	hookResp, err := s.preCreateHook(hook)
+	if err != nil {
+		return tusd.HTTPResponse{}, changes, s.reject(err)
+	}
+	if hookResp.ChangeFileInfo.MetaData != nil {
+		changes.MetaData = maps.Clone(hookResp.ChangeFileInfo.MetaData)
+		hook.Upload.MetaData = changes.MetaData
+	}
+	changes.Storage = hookResp.ChangeFileInfo.Storage
+
+	if err := s.checkPolicy(hook.Upload); err != nil {
+		return tusd.HTTPResponse{}, changes, s.reject(err)
+	}
+
+	scheduledAt, err := s.checkSchedule(hook)
+	if err != nil {
+		return tusd.HTTPResponse{}, changes, s.reject(err)
+	}
+
+	if err := s.checkMetadataSchema(hook); err != nil {
+		return tusd.HTTPResponse{}, changes, s.reject(err)
+	}
+
+	in, err := s.checkIntake(hook.Context, hook.Upload)
+	if err != nil {
+		return tusd.HTTPResponse{}, changes, s.reject(err)
+	}
+
+	registered, err := s.checkTenant(hook.Context, hook.Upload)
+	if err != nil {
+		return tusd.HTTPResponse{}, changes, s.reject(err)
+	}
+
+	// setMetadata overrides a metadata field on a copy of the client metadata
+	setMetadata := func(key, value string) {
+		if changes.MetaData == nil {
+			changes.MetaData = make(tusd.MetaData, len(hook.Upload.MetaData)+1)
+			for k, v := range hook.Upload.MetaData {
+				changes.MetaData[k] = v
+			}
+			hook.Upload.MetaData = changes.MetaData
+		}
+		changes.MetaData[key] = value
+	}
+
+	// Record where the upload was created from, over any values the client sent
+	if s.origins != nil {
+		o := s.origins.Resolve(hook.HTTPRequest.RemoteAddr, hook.HTTPRequest.Header)
+		setMetadata(OriginIPMetadataKey, o.IP)
+		setMetadata(OriginCountryMetadataKey, o.Country)
+	}
+
+	var tenant string
+	if s.cfg.Auth.Enabled {
+		if user, err := auth.GetUserFromContext(hook.Context); err == nil {
+			setMetadata(auth.OwnerMetadataKey, user.ID)
+
+			// Place the upload under the tenant's key prefix
+			if tenantScoped(s.store) || s.cfg.UploadIDs.TenantPrefix {
+				if !storage.ValidTenant(user.Tenant) {
+					return tusd.HTTPResponse{}, changes, s.reject(rejection.New(http.StatusForbidden, rejection.CodeInvalidTenant,
+						fmt.Sprintf("invalid tenant %q", user.Tenant)))
+				}
+				tenant = user.Tenant
+			}
+		}
+	}
+
+	// Uploads of a registered tenant are placed under its key prefix, then
+	// under the key prefix of their intake, which is notified
+	var prefix string
+	if registered != nil {
+		prefix = registered.Prefix
+	}
+	if in != nil {
+		if in.Prefix != "" && prefix != "" {
+			prefix += storage.KeyPrefixSeparator
+		}
+		prefix += in.Prefix
+		if in.NotifyURL != "" {
+			setMetadata(callback.MetadataKey, in.NotifyURL)
+		}
+	}
+
+	id, err := s.newUploadID(tenant, prefix)
+	if err != nil {
+		return tusd.HTTPResponse{}, changes, s.reject(err)
+	}
+	if hookResp.ChangeFileInfo.ID != "" {
+		// Hook-assigned IDs are still placed under the tenant and intake prefix
+		id = storage.FormatUploadID(tenant, prefix, hookResp.ChangeFileInfo.ID)
+	}
+	changes.ID = id
+
+	class, err := s.classPolicy.Resolve(s.store.GetProvider(), hook.Upload)
+	if err != nil {
+		return tusd.HTTPResponse{}, changes, s.reject(rejection.New(http.StatusBadRequest, rejection.CodeInvalidStorageClass, err.Error()))
+	}
+	if class != "" {
+		setMetadata(storage.StorageClassMetadataKey, class)
+	}
+
+	// Uploads against a reservation are queued until its window starts
+	reserved, startsAt, err := s.checkReservation(hook)
+	if err != nil {
+		return tusd.HTTPResponse{}, changes, s.reject(err)
+	}
+	if startsAt.After(scheduledAt) {
+		scheduledAt = startsAt
+	}
+
+	// Uploads with a delta plan receive its unchanged ranges from the previous upload
+	claimed, err := s.checkDeltaPlan(hook, id)
+	if err != nil {
+		if reserved {
+			s.releaseReservation(hook.Context, hook.Upload)
+		}
+		return tusd.HTTPResponse{}, changes, s.reject(err)
+	}
+
+	// Uploads naming a batch complete together with the other uploads in it
+	joined, err := s.checkBatch(hook, id)
+	if err != nil {
+		if reserved {
+			s.releaseReservation(hook.Context, hook.Upload)
+		}
+		if claimed {
+			_ = s.deltas.Delete(hook.Context, hook.Upload.MetaData[DeltaPlanMetadataKey])
+		}
+		return tusd.HTTPResponse{}, changes, s.reject(err)
+	}
+
+	// Queued uploads accept data from their scheduled time
+	resp := hookResp.HTTPResponse
+	if !scheduledAt.IsZero() {
+		setMetadata(ScheduledAtMetadataKey, scheduledAt.Format(time.RFC3339))
+		resp = resp.MergeWith(tusd.HTTPResponse{Header: tusd.HTTPHeader{ScheduledAtHeader: scheduledAt.Format(time.RFC3339)}})
+	}
+
+	if err := s.events.Emit(hook.Context, newEvent(events.UploadCreated, hook)); err != nil {
+		if reserved {
+			s.releaseReservation(hook.Context, hook.Upload)
+		}
+		if claimed {
+			_ = s.deltas.Delete(hook.Context, hook.Upload.MetaData[DeltaPlanMetadataKey])
+		}
+		if joined {
+			_, _, _ = s.batches.Leave(hook.Context, hook.Upload.MetaData[BatchMetadataKey], id)
+		}
+		return tusd.HTTPResponse{}, changes, s.reject(err)
+	}
+	return resp, changes, nil
+}
+
+// preFinishResponse detects the content type of uploads that declared none
+// and the format stamps are drawn in, runs synchronous completion
+// subscribers, which see them annotated, and the pre-finish hook
+func (s *Server) preFinishResponse(hook tusd.HookEvent) (tusd.HTTPResponse, error) {
+	if s.cfg.ContentTypes.Detect {
+		s.detectContentType(hook.Context, hook.Upload)
+	}
+	if s.stamps != nil {
+		if _, err := s.detectStampFormat(hook.Context, hook.Upload.ID); err != nil {
+			slog.Warn("Failed to detect stamp format", "id", hook.Upload.ID, "error", err)
+		}
+	}
+	if err := s.events.Emit(hook.Context, s.withAnnotations(hook.Context, newEvent(events.UploadCompleted, hook))); err != nil {
+		return tusd.HTTPResponse{}, s.reject(err)
+	}
+	resp, err := s.preFinishHook(hook)
+	if err != nil {
+		return tusd.HTTPResponse{}, s.reject(err)
+	}
+	return resp, nil
+}
+
+// preUploadTerminate checks the termination policy and runs synchronous
+// termination subscribers
+func (s *Server) preUploadTerminate(hook tusd.HookEvent) (tusd.HTTPResponse, error) {
+	if err := s.allowTermination(hook); err != nil {
+		return tusd.HTTPResponse{}, s.reject(err)
+	}
+	return tusd.HTTPResponse{}, nil
+}
+
+// allowTermination checks that an upload may be terminated and runs the
+// pre-terminate hook and synchronous termination subscribers, which can
+// refuse it. Once it is accepted, post-processing of the upload is canceled.
+func (s *Server) allowTermination(hook tusd.HookEvent) error {
+	if err := s.checkTermination(hook.Context, hook.Upload); err != nil {
+		return err
+	}
+	if err := s.preTerminateHook(hook); err != nil {
+		return err
+	}
+	if err := s.events.Emit(hook.Context, newEvent(events.UploadTerminated, hook)); err != nil {
+		return err
+	}
+	s.processing.cancel(hook.Upload.ID)
+	return nil
+}
+
+// forwardNotifications drains the tusd notification channels, advances the
+// upload state machine and hands the events to asynchronous subscribers and
+// post-* hooks until the server stops. Requests are finished by then, so no
+// notifications are left.
+func (s *Server) forwardNotifications(stop context.Context) {
+	// Deliveries are waited for on shutdown rather than canceled
+	ctx := context.Background()
+	for {
+		select {
+		case <-stop.Done():
+			return
+		case hook := <-s.tusHandler.CreatedUploads:
+			// Completions are only received after this, so they find the
+			// upload in its batch
+			if s.batches != nil {
+				s.renameBatchMember(ctx, hook.Upload)
+			}
+			s.advanceState(ctx, hook, uploadstate.Created)
+			s.events.Notify(ctx, newEvent(events.UploadCreated, hook))
+			s.notifyHook(hooks.HookPostCreate, hook)
+		case hook := <-s.tusHandler.UploadProgress:
+			s.advanceState(ctx, hook, uploadstate.Uploading)
+			if err := s.states.Progress(ctx, hook.Upload.ID, hook.Upload.Offset); err != nil && !errors.Is(err, uploadstate.ErrNotFound) {
+				slog.Error("Failed to record upload progress", "id", hook.Upload.ID, "error", err)
+			}
+			s.events.Notify(ctx, newEvent(events.UploadProgress, hook))
+			s.notifyMilestones(ctx, hook)
+			s.notifyHook(hooks.HookPostReceive, hook)
+		case hook := <-s.tusHandler.CompleteUploads:
+			s.advanceState(ctx, hook, uploadstate.Uploaded)
+			s.events.Notify(ctx, s.withAnnotations(ctx, newEvent(events.UploadCompleted, hook)))
+			s.notifyMilestones(ctx, hook)
+			s.notifyHook(hooks.HookPostFinish, hook)
+		case hook := <-s.tusHandler.TerminatedUploads:
+			s.advanceState(ctx, hook, uploadstate.Deleted)
+			s.events.Notify(ctx, newEvent(events.UploadTerminated, hook))
+			s.notifyHook(hooks.HookPostTerminate, hook)
+		}
+	}
+}
+
+// newEvent converts a tusd hook event into a typed event
+func newEvent(eventType events.Type, hook tusd.HookEvent) events.Event {
+	return events.Event{
+		Type:        eventType,
+		Upload:      hook.Upload,
+		HTTPRequest: hook.HTTPRequest,
+		Time:        time.Now(),
+	}
+}
+
+// uploadInfo loads the current state of an upload from the storage backend
+func (s *Server) uploadInfo(ctx context.Context, id string) (tusd.FileInfo, error) {
+	upload, err := s.composer.Core.GetUpload(ctx, id)
+	if err != nil {
+		return tusd.FileInfo{}, err
+	}
+	return upload.GetInfo(ctx)
+}
+
+// tenantScoped reports whether the storage backend isolates tenants by
+// upload ID prefix
+func tenantScoped(store storage.Storage) bool {
+	scoped, ok := store.(storage.TenantScoped)
+	return ok && scoped.TenantScoped()
+}
+
+// newComposer returns the store composer uploads go through. Throttling
+// errors of the backend are passed to the handler, and storage faults are
+// injected when configured outside of production.
+func newComposer(cfg *config.Config, store storage.Storage, throttled storage.ThrottleHandler) (*tusd.StoreComposer, error) {
+	composer := storage.GuardThrottling(store.GetStoreComposer(), throttled)
+	if !cfg.Faults.Enabled {
+		return composer, nil
+	}
+	if strings.EqualFold(cfg.App.Environment, "production") {
+		return nil, errors.New("fault injection must not be enabled in production")
+	}
+
+	operations := cfg.Faults.Operations
+	for _, op := range operations {
+		if !slices.Contains(storage.Operations, op) {
+			return nil, fmt.Errorf("unknown fault injection operation %q", op)
+		}
+	}
+
+	faults := storage.NewFaultInjector(storage.FaultConfig{
+		Seed:             int64(cfg.Faults.Seed),
+		ErrorRate:        cfg.Faults.ErrorRate,
+		LatencyRate:      cfg.Faults.LatencyRate,
+		Latency:          time.Duration(cfg.Faults.Latency) * time.Millisecond,
+		PartialWriteRate: cfg.Faults.PartialWriteRate,
+		Operations:       operations,
+	})
+	slog.Warn("Injecting storage faults",
+		"seed", faults.Seed(),
+		"errorRate", cfg.Faults.ErrorRate,
+		"latencyRate", cfg.Faults.LatencyRate,
+		"partialWriteRate", cfg.Faults.PartialWriteRate,
+		"operations", operations)
+	return faults.Wrap(composer), nil
+}
+
+// newClassPolicy converts the storage class configuration into a policy
+func newClassPolicy(cfg config.StorageClassConfig) storage.ClassPolicy {
+	policy := storage.ClassPolicy{
+		Default:             cfg.Default,
+		AllowClientOverride: cfg.AllowClientOverride,
+	}
+	for _, rule := range cfg.Rules {
+		policy.Rules = append(policy.Rules, storage.ClassRule{
+			MinSize: rule.MinSize,
+			Class:   rule.Class,
+		})
+	}
+	return policy
+}
+
+// newDeadLetterStore creates a file-backed dead-letter store when a directory
+// is configured and an in-memory one otherwise
+func newDeadLetterStore(cfg config.DeadLetterConfig) (deadletter.Store, error) {
+	if cfg.Dir == "" {
+		return deadletter.NewMemoryStore(), nil
+	}
+
+	store, err := deadletter.NewFileStore(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dead-letter store: %w", err)
+	}
+	return store, nil
+}
+
+// reject converts a policy or subscriber error into a tus error response
+// with a structured JSON body
+func (s *Server) reject(err error) error {
+	slog.Debug("Upload operation rejected", "error", err)
+	return s.rejections.Render(err)
+}
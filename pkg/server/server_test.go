@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// newTestServer creates a server on in-memory storage with the zero
+// configuration, changed by configure. Stores with a default directory
+// write to a temporary working directory.
+func newTestServer(t *testing.T, configure func(*config.Config)) (*Server, *httptest.Server) {
+	t.Helper()
+	return newTestServerOn(t, newMemoryStorage(t), configure)
+}
+
+// newTestServerOn creates a server like newTestServer on the storage
+func newTestServerOn(t *testing.T, store storage.Storage, configure func(*config.Config)) (*Server, *httptest.Server) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+
+	cfg := &config.Config{}
+	if configure != nil {
+		configure(cfg)
+	}
+	srv, err := New(cfg, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv.Router())
+	t.Cleanup(ts.Close)
+	return srv, ts
+}
+
+// newMemoryStorage returns initialized in-memory storage
+func newMemoryStorage(t *testing.T) *storage.MemoryStorage {
+	t.Helper()
+	store := storage.NewMemoryStorage()
+	if err := store.Initialize(context.Background(), &storage.Config{Provider: storage.Memory}); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// multipartIDs is in-memory storage that appends a multipart ID to the IDs
+// of new uploads like s3store, so upload IDs differ from the ID the
+// pre-create hook chose
+type multipartIDs struct {
+	*storage.MemoryStorage
+	composer *tusd.StoreComposer
+}
+
+func newMultipartIDs(t *testing.T) *multipartIDs {
+	t.Helper()
+	store := &multipartIDs{MemoryStorage: newMemoryStorage(t)}
+	composer := *store.MemoryStorage.GetStoreComposer()
+	composer.Core = multipartIDStore{composer.Core}
+	store.composer = &composer
+	return store
+}
+
+func (s *multipartIDs) GetStoreComposer() *tusd.StoreComposer {
+	return s.composer
+}
+
+// multipartIDStore is the data store of multipartIDs
+type multipartIDStore struct {
+	tusd.DataStore
+}
+
+func (s multipartIDStore) NewUpload(ctx context.Context, info tusd.FileInfo) (tusd.Upload, error) {
+	if info.ID == "" {
+		info.ID = "upload"
+	}
+	info.ID += "+multipart"
+	return s.DataStore.NewUpload(ctx, info)
+}
+
+// request sends a request with the tus version header and returns the
+// response with its body read
+func request(t *testing.T, method, url string, header map[string]string, body string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(data)
+}
+
+// upload creates an upload of the data with tus and returns its ID. The
+// header is sent on creation, and its Authorization with the data too.
+func upload(t *testing.T, ts *httptest.Server, data string, header map[string]string) string {
+	t.Helper()
+	create := map[string]string{"Upload-Length": strconv.Itoa(len(data))}
+	for name, value := range header {
+		create[name] = value
+	}
+	resp, body := request(t, http.MethodPost, ts.URL+DefaultBasePath, create, "")
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("creating upload: %d %s", resp.StatusCode, body)
+	}
+	location := resp.Header.Get("Location")
+	id := location[strings.LastIndex(location, "/")+1:]
+
+	if data != "" {
+		patch := map[string]string{"Upload-Offset": "0", "Content-Type": "application/offset+octet-stream"}
+		if authorization, ok := header["Authorization"]; ok {
+			patch["Authorization"] = authorization
+		}
+		resp, body = request(t, http.MethodPatch, ts.URL+DefaultBasePath+id, patch, data)
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("uploading: %d %s", resp.StatusCode, body)
+		}
+	}
+	return id
+}
+
+// testSecret signs the JWTs of test users
+const testSecret = "test-secret"
+
+// bearer returns the Authorization header of a user with the role and
+// tenant, signed with testSecret
+func bearer(t *testing.T, subject, role, tenant string) map[string]string {
+	t.Helper()
+	claims, err := json.Marshal(map[string]string{"sub": subject, "role": role, "tenant": tenant})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString(claims)
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write([]byte(unsigned))
+	return map[string]string{"Authorization": "Bearer " + unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))}
+}
@@ -0,0 +1,313 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/events"
+	"github.com/devsnb/large-file-uploads/pkg/share"
+)
+
+// ShareParam is the query parameter carrying a share link token
+const ShareParam = "share"
+
+// SharePasswordHeader carries the password of a protected share link.
+// Browsers can send it as the password of HTTP basic authentication instead.
+const SharePasswordHeader = "Share-Password"
+
+// shareRequest is the body of a share link creation
+type shareRequest struct {
+	ExpiresAt    *time.Time `json:"expiresAt"`
+	Password     string     `json:"password"`
+	MaxDownloads int64      `json:"maxDownloads"`
+}
+
+// shareView is what owners see of a link: never its secret or password
+type shareView struct {
+	ID             string     `json:"id"`
+	UploadID       string     `json:"uploadId"`
+	Protected      bool       `json:"protected"`
+	MaxDownloads   int64      `json:"maxDownloads,omitempty"`
+	Downloads      int64      `json:"downloads"`
+	CreatedBy      string     `json:"createdBy,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	ExpiresAt      time.Time  `json:"expiresAt"`
+	LastDownloadAt *time.Time `json:"lastDownloadAt,omitempty"`
+	RevokedAt      *time.Time `json:"revokedAt,omitempty"`
+}
+
+// newShareView hides the digests of a link
+func newShareView(link share.Link) shareView {
+	return shareView{
+		ID:             link.ID,
+		UploadID:       link.UploadID,
+		Protected:      link.Protected(),
+		MaxDownloads:   link.MaxDownloads,
+		Downloads:      link.Downloads,
+		CreatedBy:      link.CreatedBy,
+		CreatedAt:      link.CreatedAt,
+		ExpiresAt:      link.ExpiresAt,
+		LastDownloadAt: link.LastDownloadAt,
+		RevokedAt:      link.RevokedAt,
+	}
+}
+
+// createShare issues a public link to a completed upload. The token is only
+// returned in this response.
+func (s *Server) createShare(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	if err := s.authorize(ctx, auth.ActionDownload, id); err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	// All settings are optional, so the body may be empty
+	var req shareRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	info, err := s.uploadInfo(ctx, id)
+	if err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if info.SizeIsDeferred || info.Offset < info.Size {
+		c.JSON(http.StatusConflict, gin.H{"error": "upload is not complete"})
+		return
+	}
+	if rejected := s.downloadGate(ctx, id, true); rejected != nil {
+		abortAPI(c, rejected)
+		return
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(time.Duration(s.cfg.Shares.TTL) * time.Second)
+	if req.ExpiresAt != nil {
+		expiresAt = *req.ExpiresAt
+	}
+	if maxTTL := time.Duration(s.cfg.Shares.MaxTTL) * time.Second; maxTTL > 0 && expiresAt.After(now.Add(maxTTL)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("share links may be valid for at most %s", maxTTL)})
+		return
+	}
+
+	link := share.Link{
+		UploadID:     id,
+		MaxDownloads: req.MaxDownloads,
+		ExpiresAt:    expiresAt.Truncate(time.Second),
+	}
+	if user, err := auth.GetUserFromContext(ctx); err == nil {
+		link.Tenant, link.CreatedBy = user.Tenant, user.ID
+	}
+	link, token, err := s.shares.Create(ctx, link, req.Password)
+	if err != nil {
+		respondShareError(c, err)
+		return
+	}
+
+	slog.Info("Share link created", "id", id, "share", link.ID, "by", link.CreatedBy,
+		"expiresAt", link.ExpiresAt, "protected", link.Protected(), "maxDownloads", link.MaxDownloads)
+	query := url.Values{ShareParam: {token}}
+	c.JSON(http.StatusCreated, gin.H{
+		"share": newShareView(link),
+		"token": token,
+		"url":   DefaultBasePath + id + "?" + query.Encode(),
+	})
+}
+
+// listShares returns the links to an upload with their downloads
+func (s *Server) listShares(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	if err := s.authorize(ctx, auth.ActionDownload, id); err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	links, err := s.shares.List(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	views := make([]shareView, 0, len(links))
+	for _, link := range links {
+		views = append(views, newShareView(link))
+	}
+	c.JSON(http.StatusOK, gin.H{"shares": views})
+}
+
+// revokeShare disables a link immediately
+func (s *Server) revokeShare(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	if err := s.authorize(ctx, auth.ActionDownload, id); err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	link, err := s.shares.Revoke(ctx, id, c.Param("sid"))
+	if err != nil {
+		respondShareError(c, err)
+		return
+	}
+
+	slog.Info("Share link revoked", "id", id, "share", link.ID)
+	c.JSON(http.StatusOK, gin.H{"share": newShareView(link)})
+}
+
+// serveShare authorizes a download with a share link and counts it once it
+// succeeds. Range requests that resume a download aren't counted again,
+// unless they are answered with the whole upload.
+// Protected links answer 401 with a basic authentication challenge, so
+// browsers prompt for the password.
+func (s *Server) serveShare(c *gin.Context, id, token string) {
+	ctx := c.Request.Context()
+
+	password := sharePassword(c.Request)
+	counted := !s.resumesDownload(ctx, c.Request, id)
+	redeem := s.shares.Authorize
+	if counted {
+		redeem = s.shares.Redeem
+	}
+	link, err := redeem(ctx, token, id, password)
+	if err != nil {
+		abortShare(c, id, err)
+		return
+	}
+
+	// Stamped downloads carry the link they were shared with
+	if s.stamps != nil {
+		user := &auth.User{ID: "share:" + link.ID, Username: "share " + link.ID, Tenant: link.Tenant}
+		c.Request = c.Request.WithContext(context.WithValue(ctx, auth.UserKey{}, user))
+	}
+	c.Next()
+
+	status := c.Writer.Status()
+	if counted && status != http.StatusOK && status != http.StatusPartialContent {
+		if err := s.shares.Refund(context.WithoutCancel(ctx), link.ID); err != nil {
+			slog.Warn("Failed to refund share link download", "id", id, "share", link.ID, "error", err)
+		}
+	}
+	// Ranges that don't apply, e.g. with a stale If-Range, get the whole
+	// upload
+	if !counted && status == http.StatusOK {
+		if _, err := s.shares.Redeem(context.WithoutCancel(ctx), token, id, password); err != nil {
+			slog.Warn("Failed to count share link download", "id", id, "share", link.ID, "error", err)
+		}
+	}
+}
+
+// resumesDownload reports whether a request resumes a download with a range
+// past the first byte. Only stamped downloads honor ranges, tusd answers
+// range requests for other uploads with the whole upload.
+func (s *Server) resumesDownload(ctx context.Context, r *http.Request, id string) bool {
+	ranges := r.Header.Get("Range")
+	if ranges == "" || strings.HasPrefix(ranges, "bytes=0-") || s.stamps == nil {
+		return false
+	}
+	format, err := s.stampFormat(ctx, id)
+	return err == nil && format != ""
+}
+
+// abortShare refuses a download with a share link. Protected links answer
+// 401 with a basic authentication challenge.
+func abortShare(c *gin.Context, id string, err error) {
+	if errors.Is(err, share.ErrPasswordRequired) || errors.Is(err, share.ErrBadPassword) {
+		c.Header("WWW-Authenticate", `Basic realm="share", charset="UTF-8"`)
+	}
+	status := shareErrorStatus(err)
+	if status == http.StatusInternalServerError {
+		slog.Error("Failed to redeem share link", "id", id, "error", err)
+	}
+	c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+}
+
+// sharePassword returns the password a request sends for a share link, in
+// the Share-Password header or with basic authentication
+func sharePassword(r *http.Request) string {
+	password := r.Header.Get(SharePasswordHeader)
+	if _, basic, ok := r.BasicAuth(); ok && password == "" {
+		password = basic
+	}
+	return password
+}
+
+// verifyShare checks that a share link grants the request access to the
+// upload, including its password and remaining downloads, without counting
+// a download
+func (s *Server) verifyShare(r *http.Request, token, id string) error {
+	if s.shares == nil {
+		return share.ErrNotFound
+	}
+	ctx := r.Context()
+	// Only resumed downloads may use a link that ran out of downloads
+	if !s.resumesDownload(ctx, r, id) {
+		if _, err := s.shares.Verify(ctx, token, id); err != nil {
+			return err
+		}
+	}
+	_, err := s.shares.Authorize(ctx, token, id, sharePassword(r))
+	return err
+}
+
+// forgetShares deletes the links to terminated uploads
+func (s *Server) forgetShares(ctx context.Context, e events.Event) error {
+	if err := s.shares.Forget(ctx, e.Upload.ID); err != nil {
+		slog.Warn("Failed to delete share links", "id", e.Upload.ID, "error", err)
+	}
+	return nil
+}
+
+// shareErrorStatus maps link errors to HTTP status codes
+func shareErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, share.ErrInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, share.ErrNotFound), errors.Is(err, share.ErrMalformed), errors.Is(err, share.ErrBadSecret),
+		errors.Is(err, share.ErrPasswordRequired), errors.Is(err, share.ErrBadPassword):
+		return http.StatusUnauthorized
+	case errors.Is(err, share.ErrRevoked), errors.Is(err, share.ErrExpired), errors.Is(err, share.ErrExhausted):
+		return http.StatusGone
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// respondShareError maps link errors of the management API to responses
+func respondShareError(c *gin.Context, err error) {
+	status := shareErrorStatus(err)
+	if errors.Is(err, share.ErrNotFound) {
+		status = http.StatusNotFound
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
+
+// newShareStore creates the store for share links
+func newShareStore(cfg config.SharesConfig) (share.Store, error) {
+	if cfg.Dir == "" {
+		return share.NewMemoryStore(), nil
+	}
+
+	store, err := share.NewFileStore(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create share link store: %w", err)
+	}
+	return store, nil
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+)
+
+// newShareLink uploads a file and shares it with a link allowing the given
+// number of downloads
+func newShareLink(t *testing.T, maxDownloads int) (*httptest.Server, string) {
+	t.Helper()
+	_, ts := newTestServer(t, func(cfg *config.Config) {
+		cfg.Auth.Enabled = true
+		cfg.Auth.JWTSecret = testSecret
+		cfg.Shares.Enabled = true
+		cfg.Shares.TTL = 3600
+	})
+	owner := bearer(t, "alice", "user", "acme")
+	id := upload(t, ts, "hello world", owner)
+
+	resp, body := request(t, http.MethodPost, ts.URL+"/api/uploads/"+id+"/shares", owner, fmt.Sprintf(`{"maxDownloads": %d}`, maxDownloads))
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("creating a share link: %d %s", resp.StatusCode, body)
+	}
+	var created struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal([]byte(body), &created); err != nil {
+		t.Fatal(err)
+	}
+	return ts, created.URL
+}
+
+// downloadShare downloads a shared upload with an optional range
+func downloadShare(t *testing.T, ts *httptest.Server, link, ranges string) (*http.Response, string) {
+	t.Helper()
+	var header map[string]string
+	if ranges != "" {
+		header = map[string]string{"Range": ranges}
+	}
+	return request(t, http.MethodGet, ts.URL+link, header, "")
+}
+
+func TestShareCountsDownloadsFromTheStart(t *testing.T) {
+	ts, link := newShareLink(t, 1)
+
+	tests := []struct {
+		ranges string
+		want   int
+	}{
+		{"bytes=0-4", http.StatusOK},
+		{"", http.StatusGone},
+		{"bytes=0-", http.StatusGone},
+	}
+	for _, tt := range tests {
+		resp, body := downloadShare(t, ts, link, tt.ranges)
+		if got := resp.StatusCode; got != tt.want {
+			t.Errorf("GET with range %q: got %d %s, want %d", tt.ranges, got, body, tt.want)
+		}
+	}
+}
+
+func TestShareCountsRangesAnsweredWithTheWholeUpload(t *testing.T) {
+	ts, link := newShareLink(t, 1)
+
+	// tusd ignores ranges, so the range doesn't resume anything
+	resp, body := downloadShare(t, ts, link, "bytes=1-")
+	if resp.StatusCode != http.StatusOK || body != "hello world" {
+		t.Fatalf("expected the whole upload, got %d %s", resp.StatusCode, body)
+	}
+	resp, body = downloadShare(t, ts, link, "bytes=1-")
+	if resp.StatusCode != http.StatusGone {
+		t.Fatalf("expected the second download to be refused, got %d %s", resp.StatusCode, body)
+	}
+}
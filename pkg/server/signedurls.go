@@ -0,0 +1,137 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SignatureParam is the query parameter carrying an upload URL signature
+const SignatureParam = "sig"
+
+// DefaultSignedURLTTL is how long signed upload URLs stay valid unless
+// configured
+const DefaultSignedURLTTL = 24 * time.Hour
+
+// locationScope binds signed tokens to upload URLs
+const locationScope = "location"
+
+// signedURLMiddleware signs the Location of newly created uploads and
+// rejects requests for existing uploads without a valid signature, so upload
+// URLs can't be probed or appended to by guessing IDs
+func (s *Server) signedURLMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// CORS preflight requests never carry the query string
+		if c.Request.Method == http.MethodOptions {
+			c.Next()
+			return
+		}
+
+		id := strings.Trim(c.Param("any"), "/")
+
+		if id == "" {
+			if c.Request.Method == http.MethodPost {
+				c.Writer = &locationSigningWriter{ResponseWriter: c.Writer, sign: s.signLocation}
+			}
+			c.Next()
+			return
+		}
+
+		// Claim links, download tokens and share links are already bound
+		// to the upload
+		if token := c.Query(ShareParam); token != "" && s.shares != nil && c.Request.Method == http.MethodGet {
+			if err := s.verifyShare(c.Request, token, id); err != nil {
+				abortShare(c, id, err)
+				return
+			}
+			c.Next()
+			return
+		}
+		if s.hasScopedToken(c, id) {
+			c.Next()
+			return
+		}
+
+		if err := s.verifyLocation(c.Query(SignatureParam), id); err != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "invalid upload URL signature: " + err.Error()})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// signLocation appends a signature for the upload to its URL
+func (s *Server) signLocation(location string) string {
+	u, err := url.Parse(location)
+	if err != nil {
+		return location
+	}
+
+	query := u.Query()
+	if query.Has(SignatureParam) {
+		return location
+	}
+
+	id := strings.TrimPrefix(u.Path, DefaultBasePath)
+	expiresAt := time.Now().Add(s.signedURLTTL())
+	query.Set(SignatureParam, s.locationSigner.Sign(locationScope, id, expiresAt))
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// verifyLocation checks that a signature was issued for the upload
+func (s *Server) verifyLocation(signature, id string) error {
+	subject, _, err := s.locationSigner.Verify(signature, locationScope)
+	if err != nil {
+		return err
+	}
+	if subject != id {
+		return errTokenMismatch
+	}
+	return nil
+}
+
+// hasScopedToken reports whether the request carries a valid claim token or
+// download token for the upload
+func (s *Server) hasScopedToken(c *gin.Context, id string) bool {
+	if token := c.GetHeader(ClaimHeader); token != "" {
+		return s.verifyClaim(token, id) == nil
+	}
+	if token := c.Query(DownloadTokenParam); token != "" && c.Request.Method == http.MethodGet {
+		_, err := s.verifyDownloadToken(token, id)
+		return err == nil
+	}
+	return false
+}
+
+// signedURLTTL returns the configured upload URL signature lifetime
+func (s *Server) signedURLTTL() time.Duration {
+	if s.cfg.SignedURLs.TTL > 0 {
+		return time.Duration(s.cfg.SignedURLs.TTL) * time.Second
+	}
+	return DefaultSignedURLTTL
+}
+
+// locationSigningWriter signs the Location header before it is sent
+type locationSigningWriter struct {
+	gin.ResponseWriter
+	sign func(string) string
+}
+
+// Unwrap lets tusd extend the read deadline of the connection
+func (w *locationSigningWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// WriteHeader signs the Location header, if any, and writes the status code
+func (w *locationSigningWriter) WriteHeader(code int) {
+	if location := w.Header().Get("Location"); location != "" {
+		w.Header().Set("Location", w.sign(location))
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
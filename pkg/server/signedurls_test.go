@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+)
+
+// signedUpload creates an upload of 5 bytes and returns its ID and signed
+// Location
+func signedUpload(t *testing.T, ts string, header map[string]string) (string, string) {
+	t.Helper()
+	create := map[string]string{"Upload-Length": "5"}
+	for name, value := range header {
+		create[name] = value
+	}
+	resp, body := request(t, http.MethodPost, ts+DefaultBasePath, create, "")
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("creating upload: %d %s", resp.StatusCode, body)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Query().Get(SignatureParam) == "" {
+		t.Fatalf("expected the Location to be signed, got %s", location)
+	}
+	return strings.TrimPrefix(location.Path, DefaultBasePath), location.String()
+}
+
+func TestSignedLocationURLs(t *testing.T) {
+	srv, ts := newTestServer(t, func(cfg *config.Config) {
+		cfg.SignedURLs.Enabled = true
+	})
+	id, location := signedUpload(t, ts.URL, nil)
+	unsigned := ts.URL + DefaultBasePath + id
+	patch := map[string]string{"Upload-Offset": "0", "Content-Type": "application/offset+octet-stream"}
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		want   int
+	}{
+		{"unsigned HEAD", http.MethodHead, unsigned, http.StatusForbidden},
+		{"unsigned PATCH", http.MethodPatch, unsigned, http.StatusForbidden},
+		{"expired signature", http.MethodHead, unsigned + "?" + SignatureParam + "=" + srv.locationSigner.Sign(locationScope, id, time.Now().Add(-time.Minute)), http.StatusForbidden},
+		{"signature of another upload", http.MethodHead, unsigned + "?" + SignatureParam + "=" + srv.locationSigner.Sign(locationScope, "other", time.Now().Add(time.Hour)), http.StatusForbidden},
+		{"signed HEAD", http.MethodHead, location, http.StatusOK},
+		{"signed PATCH", http.MethodPatch, location, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		var header map[string]string
+		if tt.method == http.MethodPatch {
+			header = patch
+		}
+		if resp, body := request(t, tt.method, tt.url, header, "hello"); resp.StatusCode != tt.want {
+			t.Errorf("%s: got %d %s, want %d", tt.name, resp.StatusCode, body, tt.want)
+		}
+	}
+}
+
+func TestSignedURLsShareLinks(t *testing.T) {
+	_, ts := newTestServer(t, func(cfg *config.Config) {
+		cfg.Auth.Enabled = true
+		cfg.Auth.JWTSecret = testSecret
+		cfg.Shares.Enabled = true
+		cfg.Shares.TTL = 3600
+		cfg.SignedURLs.Enabled = true
+	})
+	owner := bearer(t, "alice", "user", "acme")
+	id, location := signedUpload(t, ts.URL, owner)
+	patch := bearer(t, "alice", "user", "acme")
+	patch["Upload-Offset"] = "0"
+	patch["Content-Type"] = "application/offset+octet-stream"
+	if resp, body := request(t, http.MethodPatch, location, patch, "hello"); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("uploading: %d %s", resp.StatusCode, body)
+	}
+
+	resp, body := request(t, http.MethodPost, ts.URL+"/api/uploads/"+id+"/shares", owner, `{"maxDownloads": 1, "password": "open sesame"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("creating a share link: %d %s", resp.StatusCode, body)
+	}
+	var created struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal([]byte(body), &created); err != nil {
+		t.Fatal(err)
+	}
+
+	// Share links stand in for the signature, but only with their password
+	// and while downloads remain
+	resp, body = request(t, http.MethodGet, ts.URL+created.URL, nil, "")
+	if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+		t.Fatalf("expected a password challenge, got %d %s", resp.StatusCode, body)
+	}
+	password := map[string]string{SharePasswordHeader: "open sesame"}
+	if resp, body = request(t, http.MethodGet, ts.URL+created.URL, password, ""); resp.StatusCode != http.StatusOK || body != "hello" {
+		t.Fatalf("expected the shared upload, got %d %s", resp.StatusCode, body)
+	}
+	if resp, body = request(t, http.MethodGet, ts.URL+created.URL, password, ""); resp.StatusCode != http.StatusGone {
+		t.Fatalf("expected the exhausted link to be refused, got %d %s", resp.StatusCode, body)
+	}
+	if resp, body = request(t, http.MethodHead, ts.URL+created.URL, password, ""); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected share links not to allow HEAD requests, got %d %s", resp.StatusCode, body)
+	}
+}
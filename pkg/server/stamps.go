@@ -0,0 +1,275 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/rejection"
+	"github.com/devsnb/large-file-uploads/pkg/stamp"
+)
+
+// StampFormatAnnotation is the annotation key of the format detected for
+// completed uploads while download stamps are enabled
+const StampFormatAnnotation = "stampformat"
+
+// formatAnnotation is the stamp format detected for an upload, empty if it
+// is in none of the formats stamps can be drawn in
+type formatAnnotation struct {
+	Format     stamp.Format `json:"format"`
+	DetectedAt time.Time    `json:"detectedAt"`
+}
+
+// stamps holds what downloads are stamped with
+type stamps struct {
+	template *stamp.Template
+	stampers map[stamp.Format]stamp.Stamper
+	maxSize  int64
+	tempDir  string
+}
+
+// SetStamper replaces the stamper of an enabled format, e.g. with one
+// drawing a visible watermark. It must be called before the server starts
+// handling requests.
+func (s *Server) SetStamper(format stamp.Format, stamper stamp.Stamper) error {
+	if s.stamps == nil {
+		return fmt.Errorf("download stamps are disabled")
+	}
+	if _, ok := s.stamps.stampers[format]; !ok {
+		return fmt.Errorf("stamp format %q is not enabled", format)
+	}
+	s.stamps.stampers[format] = stamper
+	return nil
+}
+
+// stampMiddleware serves downloads of PDFs and images stamped with the
+// identity of the user downloading them. Stamped copies are written to
+// temporary files first, so a download that can't be stamped fails before
+// any data is sent.
+func (s *Server) stampMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := strings.Trim(c.Param("any"), "/")
+		if c.Request.Method != http.MethodGet || id == "" {
+			c.Next()
+			return
+		}
+
+		// Uploads detected at completion not to be stampable are passed on
+		// without reading storage
+		ctx := c.Request.Context()
+		format, detected := s.annotatedStampFormat(ctx, id)
+		if detected && !s.stampable(format) {
+			c.Next()
+			return
+		}
+
+		// Unknown and unfinished uploads are left to tusd
+		info, err := s.uploadInfo(ctx, id)
+		if err != nil || info.SizeIsDeferred || info.Offset < info.Size {
+			c.Next()
+			return
+		}
+
+		format, err = s.stampFormat(ctx, id)
+		if err != nil {
+			slog.Error("Failed to detect the format of a download", "id", id, "error", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if format == "" {
+			c.Next()
+			return
+		}
+		if info.Size > s.stamps.maxSize {
+			s.abortTus(c, rejection.New(http.StatusUnprocessableEntity, rejection.CodeNotStampable,
+				fmt.Sprintf("upload size %d exceeds the maximum of %d bytes for stamped downloads", info.Size, s.stamps.maxSize)).
+				WithDetail("size", info.Size).WithDetail("maxSize", s.stamps.maxSize))
+			return
+		}
+
+		text, err := s.stamps.template.Render(stampFields(ctx, info))
+		if err != nil {
+			slog.Error("Failed to render stamp", "id", id, "error", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		if err := s.serveStamped(c, info, format, text); err != nil {
+			if errors.Is(err, stamp.ErrUnsupported) {
+				s.abortTus(c, rejection.New(http.StatusUnprocessableEntity, rejection.CodeNotStampable, err.Error()))
+				return
+			}
+			slog.Error("Failed to stamp download", "id", id, "format", format, "error", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.Abort()
+	}
+}
+
+// stampFormat returns the format of a completed upload if downloads of it
+// are stamped, or an empty format. Uploads completed before stamps were
+// enabled have no recorded format and are detected once.
+func (s *Server) stampFormat(ctx context.Context, id string) (stamp.Format, error) {
+	format, ok := s.annotatedStampFormat(ctx, id)
+	if !ok {
+		var err error
+		if format, err = s.detectStampFormat(ctx, id); err != nil {
+			return "", err
+		}
+	}
+	if !s.stampable(format) {
+		return "", nil
+	}
+	return format, nil
+}
+
+// stampable reports whether downloads in a format are stamped
+func (s *Server) stampable(format stamp.Format) bool {
+	_, enabled := s.stamps.stampers[format]
+	return format != "" && enabled
+}
+
+// detectStampFormat detects the format of a completed upload from its
+// first bytes and records it, so downloads don't need to read it again.
+// Failures to record it are only logged.
+func (s *Server) detectStampFormat(ctx context.Context, id string) (stamp.Format, error) {
+	reader, err := s.openUpload(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	header := make([]byte, 8)
+	n, err := io.ReadFull(reader, header)
+	reader.Close()
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	format, _ := stamp.Detect(header[:n])
+	if _, err := s.AnnotateUpload(ctx, id, StampFormatAnnotation, formatAnnotation{Format: format, DetectedAt: time.Now()}); err != nil {
+		slog.Error("Failed to record stamp format", "id", id, "error", err)
+	}
+	return format, nil
+}
+
+// annotatedStampFormat returns the stamp format recorded for an upload,
+// and whether one was recorded
+func (s *Server) annotatedStampFormat(ctx context.Context, id string) (stamp.Format, bool) {
+	record, err := s.states.Get(ctx, id)
+	if err != nil {
+		return "", false
+	}
+	raw, ok := record.Annotations[StampFormatAnnotation]
+	if !ok {
+		return "", false
+	}
+	var annotation formatAnnotation
+	if err := json.Unmarshal(raw, &annotation); err != nil {
+		return "", false
+	}
+	return annotation.Format, true
+}
+
+// stampFields returns the values of the stamp template for a download
+func stampFields(ctx context.Context, info tusd.FileInfo) stamp.Fields {
+	fields := stamp.Fields{
+		UploadID: info.ID,
+		Filename: info.MetaData["filename"],
+		Time:     time.Now().UTC().Format(time.RFC3339),
+	}
+	if user, err := auth.GetUserFromContext(ctx); err == nil {
+		fields.User, fields.UserID, fields.Tenant = user.Username, user.ID, user.Tenant
+		if fields.User == "" {
+			fields.User = user.ID
+		}
+	}
+	return fields
+}
+
+// serveStamped copies an upload to a temporary file, stamps it into
+// another and serves that, honoring range requests
+func (s *Server) serveStamped(c *gin.Context, info tusd.FileInfo, format stamp.Format, text string) error {
+	ctx := c.Request.Context()
+
+	src, err := os.CreateTemp(s.stamps.tempDir, "upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(src.Name())
+	defer src.Close()
+
+	reader, err := s.openUpload(ctx, info.ID)
+	if err != nil {
+		return err
+	}
+	size, err := io.Copy(src, reader)
+	reader.Close()
+	if err != nil {
+		return fmt.Errorf("failed to copy upload: %w", err)
+	}
+
+	stamped, err := os.CreateTemp(s.stamps.tempDir, "stamped-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(stamped.Name())
+	defer stamped.Close()
+
+	if err := s.stamps.stampers[format].Stamp(stamped, src, size, text); err != nil {
+		return err
+	}
+	if _, err := stamped.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	// Stamped copies differ per user and must not be cached by proxies
+	header := c.Writer.Header()
+	header.Set("Content-Type", format.ContentType())
+	header.Set("Cache-Control", "private, no-store")
+	if filename := info.MetaData["filename"]; filename != "" {
+		header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	}
+	http.ServeContent(c.Writer, c.Request, "", time.Time{}, stamped)
+	return nil
+}
+
+// newStamps creates what downloads are stamped with, or returns nil if
+// stamping is disabled
+func newStamps(cfg config.StampConfig) (*stamps, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	template, err := stamp.NewTemplate(cfg.Template)
+	if err != nil {
+		return nil, err
+	}
+	stampers := make(map[stamp.Format]stamp.Stamper)
+	for _, name := range cfg.Formats {
+		format, err := stamp.ParseFormat(name)
+		if err != nil {
+			return nil, err
+		}
+		stampers[format], _ = stamp.Builtin(format)
+	}
+	if len(stampers) == 0 {
+		return nil, fmt.Errorf("download stamps require at least one format")
+	}
+	if cfg.MaxSize <= 0 {
+		return nil, fmt.Errorf("stamps.maxSize must be positive")
+	}
+	return &stamps{template: template, stampers: stampers, maxSize: cfg.MaxSize, tempDir: cfg.TempDir}, nil
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/stamp"
+)
+
+func TestStampFormatDetectedAtCompletion(t *testing.T) {
+	srv, ts := newTestServer(t, func(cfg *config.Config) {
+		cfg.Stamps = config.StampConfig{Enabled: true, Formats: []string{"png"}, MaxSize: 1 << 20, TempDir: t.TempDir()}
+	})
+
+	var src bytes.Buffer
+	if err := png.Encode(&src, image.NewGray(image.Rect(0, 0, 100, 40))); err != nil {
+		t.Fatal(err)
+	}
+	picture := upload(t, ts, src.String(), nil)
+	text := upload(t, ts, "hello", nil)
+
+	ctx := context.Background()
+	if format, ok := srv.annotatedStampFormat(ctx, picture); !ok || format != stamp.PNG {
+		t.Fatalf("expected the image to be recorded as png, got %q %v", format, ok)
+	}
+	if format, ok := srv.annotatedStampFormat(ctx, text); !ok || format != "" {
+		t.Fatalf("expected the text to be recorded as not stampable, got %q %v", format, ok)
+	}
+
+	resp, body := request(t, http.MethodGet, ts.URL+DefaultBasePath+picture, nil, "")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "iTXtComment") {
+		t.Fatalf("expected a stamped image, got %d", resp.StatusCode)
+	}
+	resp, body = request(t, http.MethodGet, ts.URL+DefaultBasePath+text, nil, "")
+	if resp.StatusCode != http.StatusOK || body != "hello" {
+		t.Fatalf("expected the text unchanged, got %d %q", resp.StatusCode, body)
+	}
+}
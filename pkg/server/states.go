@@ -0,0 +1,251 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/events"
+	"github.com/devsnb/large-file-uploads/pkg/uploadstate"
+)
+
+// uploadStatus is the lifecycle state of an upload along with its download
+// activity
+type uploadStatus struct {
+	uploadstate.Record
+	Digest         string     `json:"digest,omitempty"`
+	Downloads      int64      `json:"downloads"`
+	LastAccessedAt *time.Time `json:"lastAccessedAt,omitempty"`
+}
+
+// stateRequest is the body of an admin state change
+type stateRequest struct {
+	State  uploadstate.State `json:"state" binding:"required"`
+	Reason string            `json:"reason"`
+}
+
+// SetUploadState moves an upload to a new lifecycle state, e.g. from a
+// post-processor marking it ready or quarantined. Subscribers of
+// OnUploadStateChanged are notified.
+func (s *Server) SetUploadState(ctx context.Context, id string, state uploadstate.State, reason string) (uploadstate.Record, error) {
+	info, err := s.uploadInfo(ctx, id)
+	if err != nil {
+		// The upload may already be gone from storage, e.g. when deleted
+		info = tusd.FileInfo{ID: id}
+	}
+	return s.transition(ctx, info, state, reason)
+}
+
+// AnnotateUpload attaches a post-processing result, such as a detected MIME
+// type or image dimensions, to the state record of an upload under the key.
+// The value is encoded as JSON; nil removes the annotation. Annotations are
+// returned by the status API and included in later completion and state
+// change events.
+func (s *Server) AnnotateUpload(ctx context.Context, id, key string, value any) (uploadstate.Record, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return uploadstate.Record{}, fmt.Errorf("%w: %v", uploadstate.ErrInvalidAnnotation, err)
+	}
+	return s.states.Annotate(ctx, id, key, data)
+}
+
+// withAnnotations adds the annotations of an upload to an event
+func (s *Server) withAnnotations(ctx context.Context, event events.Event) events.Event {
+	if record, err := s.states.Get(ctx, event.Upload.ID); err == nil {
+		event.Annotations = record.Annotations
+	}
+	return event
+}
+
+// uploadAnnotations returns the current annotations of an upload
+func (s *Server) uploadAnnotations(ctx context.Context, id string) (map[string]json.RawMessage, error) {
+	record, err := s.states.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return record.Annotations, nil
+}
+
+// UploadState returns the lifecycle state of an upload
+func (s *Server) UploadState(ctx context.Context, id string) (uploadstate.Record, error) {
+	return s.states.Get(ctx, id)
+}
+
+// OnUploadStateChanged subscribes to lifecycle state changes. State change
+// subscribers are always invoked asynchronously.
+func (s *Server) OnUploadStateChanged(handler events.Handler, opts ...events.SubscribeOption) {
+	opts = append(opts, events.WithMode(events.Async))
+	s.events.Subscribe(events.UploadStateChanged, handler, opts...)
+}
+
+// transition applies a state change and notifies subscribers. With review
+// enabled, uploads becoming ready wait for an approver in pending_review
+// instead.
+func (s *Server) transition(ctx context.Context, info tusd.FileInfo, state uploadstate.State, reason string) (uploadstate.Record, error) {
+	if state == uploadstate.Ready && s.cfg.Review.Enabled {
+		state = uploadstate.PendingReview
+	}
+	return s.changeState(ctx, info, "", state, reason)
+}
+
+// changeState applies a state change, only from the given state unless it
+// is empty, and notifies subscribers
+func (s *Server) changeState(ctx context.Context, info tusd.FileInfo, from, state uploadstate.State, reason string) (uploadstate.Record, error) {
+	var record uploadstate.Record
+	var err error
+	if from != "" {
+		record, from, err = s.states.TransitionFrom(ctx, info.ID, from, state, reason)
+	} else {
+		record, from, err = s.states.Transition(ctx, info.ID, state, reason)
+	}
+	if err != nil {
+		return record, err
+	}
+
+	s.events.Notify(ctx, events.Event{
+		Type:          events.UploadStateChanged,
+		Upload:        info,
+		State:         string(record.State),
+		PreviousState: string(from),
+		Annotations:   record.Annotations,
+	})
+	if record.State == uploadstate.PendingReview {
+		s.requestReview(ctx, info, record)
+	}
+	return record, nil
+}
+
+// advanceState drives the state machine from tus notifications. Transitions
+// that arrive out of order, such as progress after completion, are ignored.
+func (s *Server) advanceState(ctx context.Context, hook tusd.HookEvent, state uploadstate.State) {
+	_, err := s.transition(ctx, hook.Upload, state, "")
+	if err != nil {
+		if errors.Is(err, uploadstate.ErrInvalidTransition) {
+			slog.Debug("Ignoring stale upload state change", "id", hook.Upload.ID, "error", err)
+			return
+		}
+		slog.Error("Failed to update upload state", "id", hook.Upload.ID, "state", state, "error", err)
+		return
+	}
+
+	// Uploads going through the built-in post-processors become ready once
+	// they pass
+	if state == uploadstate.Uploaded && !s.cfg.States.Processing && !s.postProcessing() {
+		if _, err := s.transition(ctx, hook.Upload, uploadstate.Ready, ""); err != nil {
+			slog.Error("Failed to update upload state", "id", hook.Upload.ID, "state", uploadstate.Ready, "error", err)
+		}
+	}
+}
+
+// getUploadState returns the lifecycle state of an upload to its owner
+func (s *Server) getUploadState(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	if err := s.authorize(ctx, auth.ActionRead, id); err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	record, err := s.states.Get(ctx, id)
+	if err != nil {
+		c.JSON(stateErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	status := uploadStatus{Record: record, Digest: s.contentDigest(ctx, id)}
+	status.Downloads, status.LastAccessedAt = s.downloadStats(ctx, id)
+	c.JSON(http.StatusOK, status)
+}
+
+// adminGetUploadState returns the lifecycle state of any upload, including
+// deleted ones
+func (s *Server) adminGetUploadState(c *gin.Context) {
+	record, err := s.states.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(stateErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, record)
+}
+
+// adminSetUploadState moves an upload to a new lifecycle state
+func (s *Server) adminSetUploadState(c *gin.Context) {
+	var req stateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	record, err := s.SetUploadState(c.Request.Context(), c.Param("id"), req.State, req.Reason)
+	if err != nil {
+		c.JSON(stateErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, record)
+}
+
+// adminAnnotateUpload attaches the JSON request body to an upload as an
+// annotation
+func (s *Server) adminAnnotateUpload(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, uploadstate.MaxAnnotationSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	record, err := s.states.Annotate(c.Request.Context(), c.Param("id"), c.Param("key"), body)
+	if err != nil {
+		c.JSON(stateErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, record)
+}
+
+// adminRemoveAnnotation removes an annotation from an upload
+func (s *Server) adminRemoveAnnotation(c *gin.Context) {
+	record, err := s.states.Annotate(c.Request.Context(), c.Param("id"), c.Param("key"), json.RawMessage("null"))
+	if err != nil {
+		c.JSON(stateErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, record)
+}
+
+// stateErrorStatus maps upload state errors to HTTP status codes
+func stateErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, uploadstate.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, uploadstate.ErrUnknownState), errors.Is(err, uploadstate.ErrInvalidAnnotation):
+		return http.StatusBadRequest
+	case errors.Is(err, uploadstate.ErrInvalidTransition):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// newStateStore creates a file-backed upload state store when a directory is
+// configured and an in-memory one otherwise
+func newStateStore(cfg config.StateConfig) (uploadstate.Store, error) {
+	if cfg.Dir == "" {
+		return uploadstate.NewMemoryStore(), nil
+	}
+
+	store, err := uploadstate.NewFileStore(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload state store: %w", err)
+	}
+	return store, nil
+}
@@ -0,0 +1,321 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/apikey"
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/rejection"
+	"github.com/devsnb/large-file-uploads/pkg/tenant"
+	"github.com/devsnb/large-file-uploads/pkg/traffic"
+)
+
+// tenantRequest is the body of a tenant creation or update
+type tenantRequest struct {
+	ID           string        `json:"id"`
+	Name         string        `json:"name" binding:"required"`
+	Prefix       string        `json:"prefix"`
+	Quotas       tenant.Quotas `json:"quotas"`
+	AllowedTypes []string      `json:"allowedTypes"`
+
+	// Keys names the API keys issued to a new tenant
+	Keys []string `json:"keys"`
+}
+
+// issuedKey is an API key issued to a new tenant with its secret
+type issuedKey struct {
+	Key    apiKeyView `json:"key"`
+	Secret string     `json:"secret"`
+}
+
+// checkTenant enforces the settings of the caller's tenant on a new upload
+// and returns the tenant, or nil if the caller has none or it isn't
+// registered
+func (s *Server) checkTenant(ctx context.Context, info tusd.FileInfo) (*tenant.Tenant, error) {
+	user, err := auth.GetUserFromContext(ctx)
+	if err != nil || user.Tenant == "" {
+		return nil, nil
+	}
+
+	t, err := s.tenants.Get(ctx, user.Tenant)
+	switch {
+	case errors.Is(err, tenant.ErrNotFound):
+		if s.cfg.Tenants.RequireRegistered {
+			return nil, rejection.New(http.StatusForbidden, rejection.CodeUnknownTenant,
+				fmt.Sprintf("tenant %q is not registered", user.Tenant))
+		}
+		return nil, nil
+	case err != nil:
+		slog.Error("Failed to load tenant", "tenant", user.Tenant, "error", err)
+		return nil, rejection.New(http.StatusInternalServerError, rejection.CodeUploadRejected, "failed to load tenant")
+	}
+
+	if t.Disabled {
+		return nil, rejection.New(http.StatusForbidden, rejection.CodeTenantDisabled,
+			fmt.Sprintf("tenant %q is disabled", t.ID))
+	}
+
+	if limit := t.Quotas.MaxUploadSize; limit > 0 {
+		if info.SizeIsDeferred {
+			return nil, rejection.New(http.StatusBadRequest, rejection.CodeUploadRejected,
+				"uploads of this tenant must declare their length at creation").
+				WithDetail("maxSize", limit)
+		}
+		if info.Size > limit {
+			s.countQuotaBreach(t.ID)
+			return nil, rejection.New(http.StatusRequestEntityTooLarge, rejection.CodeUploadTooLarge,
+				fmt.Sprintf("upload size %d exceeds the maximum of %d bytes", info.Size, limit)).
+				WithDetail("size", info.Size).
+				WithDetail("maxSize", limit)
+		}
+	}
+
+	if len(t.AllowedTypes) > 0 {
+		fileType := uploadFileType(info)
+		if !typeAllowed(fileType, t.AllowedTypes) {
+			return nil, rejection.New(http.StatusUnsupportedMediaType, rejection.CodeFileTypeNotAllowed,
+				fmt.Sprintf("file type %q is not allowed", fileType)).
+				WithDetail("type", fileType).
+				WithDetail("allowedTypes", t.AllowedTypes)
+		}
+	}
+
+	if limit := t.Quotas.MaxIngress; limit > 0 && s.traffic != nil {
+		used, err := s.tenantIngress(ctx, t.ID)
+		if err != nil {
+			slog.Error("Failed to load tenant traffic", "tenant", t.ID, "error", err)
+			return nil, rejection.New(http.StatusInternalServerError, rejection.CodeUploadRejected, "failed to load tenant traffic")
+		}
+		if used >= limit || (!info.SizeIsDeferred && used+info.Size > limit) {
+			s.countQuotaBreach(t.ID)
+			return nil, rejection.New(http.StatusForbidden, rejection.CodeTenantQuotaExceeded,
+				fmt.Sprintf("tenant %q may upload %d bytes in total, %d are used", t.ID, limit, used)).
+				WithDetail("maxIngress", limit).
+				WithDetail("used", used)
+		}
+	}
+
+	return &t, nil
+}
+
+// tenantAccess refuses requests of users whose tenant is disabled, so
+// disabling a tenant cuts off its tokens and API keys on every endpoint.
+// Chunks of a tenant that used up its ingress quota are refused too, since
+// uploads created before can otherwise grow past it. Users without a
+// tenant, and of tenants that aren't registered, are let through; checkTenant
+// decides whether they may create uploads.
+func (s *Server) tenantAccess(r *http.Request) *rejection.Error {
+	ctx := r.Context()
+	user, err := auth.GetUserFromContext(ctx)
+	if err != nil || user.Tenant == "" {
+		return nil
+	}
+
+	t, err := s.tenants.Get(ctx, user.Tenant)
+	switch {
+	case errors.Is(err, tenant.ErrNotFound):
+		return nil
+	case err != nil:
+		slog.Error("Failed to load tenant", "tenant", user.Tenant, "error", err)
+		return rejection.New(http.StatusInternalServerError, rejection.CodeUploadRejected, "failed to load tenant")
+	}
+	if t.Disabled {
+		return rejection.New(http.StatusForbidden, rejection.CodeTenantDisabled,
+			fmt.Sprintf("tenant %q is disabled", t.ID))
+	}
+
+	if limit := t.Quotas.MaxIngress; limit > 0 && s.traffic != nil && r.Method == http.MethodPatch {
+		used, err := s.tenantIngress(ctx, t.ID)
+		if err != nil {
+			slog.Error("Failed to load tenant traffic", "tenant", t.ID, "error", err)
+			return rejection.New(http.StatusInternalServerError, rejection.CodeUploadRejected, "failed to load tenant traffic")
+		}
+		if used >= limit || (r.ContentLength > 0 && used+r.ContentLength > limit) {
+			s.countQuotaBreach(t.ID)
+			return rejection.New(http.StatusForbidden, rejection.CodeTenantQuotaExceeded,
+				fmt.Sprintf("tenant %q may upload %d bytes in total, %d are used", t.ID, limit, used)).
+				WithDetail("maxIngress", limit).
+				WithDetail("used", used)
+		}
+	}
+	return nil
+}
+
+// tenantIngress returns the bytes received from a tenant so far
+func (s *Server) tenantIngress(ctx context.Context, id string) (int64, error) {
+	users, err := s.traffic.Users(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	if tenants := traffic.Tenants(users); len(tenants) > 0 {
+		return tenants[0].Ingress, nil
+	}
+	return 0, nil
+}
+
+// createTenant registers a tenant and issues the requested API keys, whose
+// secrets are only returned in this response
+func (s *Server) createTenant(c *gin.Context) {
+	var req tenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !s.checkTenantRequest(c, req) {
+		return
+	}
+	if len(req.Keys) > 0 && s.apiKeys == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "keys require api keys to be enabled"})
+		return
+	}
+	for _, name := range req.Keys {
+		if name = strings.TrimSpace(name); name == "" || len(name) > apikey.MaxNameLen {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("key names must be 1 to %d characters", apikey.MaxNameLen)})
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	created, err := s.tenants.Create(ctx, tenant.Tenant{
+		ID:           req.ID,
+		Name:         req.Name,
+		Prefix:       req.Prefix,
+		Quotas:       req.Quotas,
+		AllowedTypes: req.AllowedTypes,
+	})
+	if err != nil {
+		c.JSON(tenantErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	slog.Info("Tenant created", "tenant", created.ID, "name", created.Name)
+
+	keys := make([]issuedKey, 0, len(req.Keys))
+	for _, name := range req.Keys {
+		key, secret, err := s.apiKeys.Create(ctx, apikey.Key{
+			Tenant:    created.ID,
+			Name:      name,
+			CreatedBy: "admin",
+		})
+		if err != nil {
+			// The tenant exists; the remaining keys can be issued by its admins
+			slog.Error("Failed to issue api key to new tenant", "tenant", created.ID, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"tenant": created, "keys": keys, "error": err.Error()})
+			return
+		}
+		slog.Info("API key created", "key", key.ID, "tenant", created.ID, "by", "admin")
+		keys = append(keys, issuedKey{Key: newAPIKeyView(key), Secret: secret})
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"tenant": created, "keys": keys})
+}
+
+// updateTenant replaces the settings of a tenant, which apply to uploads
+// created from then on
+func (s *Server) updateTenant(c *gin.Context) {
+	var req tenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !s.checkTenantRequest(c, req) {
+		return
+	}
+	if len(req.Keys) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "keys are only issued when a tenant is created"})
+		return
+	}
+
+	updated, err := s.tenants.Update(c.Request.Context(), tenant.Tenant{
+		ID:           c.Param("tid"),
+		Name:         req.Name,
+		Prefix:       req.Prefix,
+		Quotas:       req.Quotas,
+		AllowedTypes: req.AllowedTypes,
+	})
+	if err != nil {
+		c.JSON(tenantErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	slog.Info("Tenant updated", "tenant", updated.ID)
+	c.JSON(http.StatusOK, updated)
+}
+
+// checkTenantRequest refuses settings that can't be enforced
+func (s *Server) checkTenantRequest(c *gin.Context, req tenantRequest) bool {
+	if req.Quotas.MaxIngress > 0 && s.traffic == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "maxIngress requires traffic accounting to be enabled"})
+		return false
+	}
+	return true
+}
+
+// setTenantDisabled returns a handler disabling or re-enabling a tenant
+func (s *Server) setTenantDisabled(disabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		t, err := s.tenants.SetDisabled(c.Request.Context(), c.Param("tid"), disabled)
+		if err != nil {
+			c.JSON(tenantErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		slog.Info("Tenant access changed", "tenant", t.ID, "disabled", t.Disabled)
+		c.JSON(http.StatusOK, t)
+	}
+}
+
+// listTenants returns all tenants, including disabled ones
+func (s *Server) listTenants(c *gin.Context) {
+	tenants, err := s.tenants.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tenants": tenants})
+}
+
+// getTenant returns a single tenant
+func (s *Server) getTenant(c *gin.Context) {
+	t, err := s.tenants.Get(c.Request.Context(), c.Param("tid"))
+	if err != nil {
+		c.JSON(tenantErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+// tenantErrorStatus maps tenant errors to HTTP status codes
+func tenantErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, tenant.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, tenant.ErrExists):
+		return http.StatusConflict
+	case errors.Is(err, tenant.ErrInvalid):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// newTenantStore creates a file-backed tenant store when a directory is
+// configured and an in-memory one otherwise
+func newTenantStore(cfg config.TenantConfig) (tenant.Store, error) {
+	if cfg.Dir == "" {
+		return tenant.NewMemoryStore(), nil
+	}
+
+	store, err := tenant.NewFileStore(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tenant store: %w", err)
+	}
+	return store, nil
+}
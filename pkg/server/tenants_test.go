@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/devsnb/large-file-uploads/pkg/apikey"
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/tenant"
+)
+
+// newTenantServer returns a test server with authentication, traffic
+// accounting and the tenant acme, which may upload 8 bytes in total
+func newTenantServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	_, ts := newTestServer(t, func(cfg *config.Config) {
+		cfg.Auth.Enabled = true
+		cfg.Auth.JWTSecret = testSecret
+		cfg.Admin.Enabled = true
+		cfg.Admin.Token = "admin-token"
+		cfg.Traffic.Enabled = true
+	})
+	admin := map[string]string{"Authorization": "Bearer admin-token", "Content-Type": "application/json"}
+	resp, body := request(t, http.MethodPost, ts.URL+"/admin/tenants", admin, `{"id": "acme", "name": "Acme", "quotas": {"maxIngress": 8}}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("creating tenant: %d %s", resp.StatusCode, body)
+	}
+	return ts
+}
+
+// createUpload creates an upload of the length and returns its URL
+func createUpload(t *testing.T, base string, length int, header map[string]string) string {
+	t.Helper()
+	create := map[string]string{"Upload-Length": strconv.Itoa(length)}
+	for name, value := range header {
+		create[name] = value
+	}
+	resp, body := request(t, http.MethodPost, base+DefaultBasePath, create, "")
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("creating upload: %d %s", resp.StatusCode, body)
+	}
+	return base + DefaultBasePath + resp.Header.Get("Location")[strings.LastIndex(resp.Header.Get("Location"), "/")+1:]
+}
+
+func TestDisabledTenantIsRefusedEverywhere(t *testing.T) {
+	ts := newTenantServer(t)
+	base := ts.URL
+	alice := bearer(t, "alice", "user", "acme")
+	admin := map[string]string{"Authorization": "Bearer admin-token"}
+	id := upload(t, ts, "hello", alice)
+
+	resp, body := request(t, http.MethodPost, base+"/admin/tenants/acme/disable", admin, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("disabling tenant: %d %s", resp.StatusCode, body)
+	}
+	for _, tt := range []struct{ method, url string }{
+		{http.MethodHead, base + DefaultBasePath + id},
+		{http.MethodGet, base + DefaultBasePath + id},
+		{http.MethodGet, base + "/api/uploads"},
+		{http.MethodGet, base + "/api/uploads/" + id + "/state"},
+	} {
+		resp, body := request(t, tt.method, tt.url, alice, "")
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("%s %s: got %d %s, want 403", tt.method, tt.url, resp.StatusCode, body)
+		}
+	}
+
+	request(t, http.MethodPost, base+"/admin/tenants/acme/enable", admin, "")
+	if resp, body := request(t, http.MethodHead, base+DefaultBasePath+id, alice, ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected access once re-enabled, got %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestTenantIngressCheckedOnChunks(t *testing.T) {
+	base := newTenantServer(t).URL
+	alice := bearer(t, "alice", "user", "acme")
+
+	// Both fit the quota when they are created
+	first := createUpload(t, base, 6, alice)
+	second := createUpload(t, base, 6, alice)
+
+	patch := map[string]string{
+		"Authorization": alice["Authorization"],
+		"Upload-Offset": "0",
+		"Content-Type":  "application/offset+octet-stream",
+	}
+	if resp, body := request(t, http.MethodPatch, first, patch, "123456"); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("uploading within the quota: %d %s", resp.StatusCode, body)
+	}
+	resp, body := request(t, http.MethodPatch, second, patch, "123456")
+	if resp.StatusCode != http.StatusForbidden || !strings.Contains(body, "ERR_TENANT_QUOTA_EXCEEDED") {
+		t.Fatalf("expected the chunk past the quota to be refused, got %d %s", resp.StatusCode, body)
+	}
+}
+
+// brokenTenants is a tenant store that can't be read
+type brokenTenants struct {
+	tenant.Store
+}
+
+func (brokenTenants) Get(ctx context.Context, id string) (tenant.Tenant, error) {
+	return tenant.Tenant{}, errors.New("disk unavailable")
+}
+
+func TestAPIKeyVerifierFailsClosed(t *testing.T) {
+	keys := apikey.NewRegistry(apikey.NewMemoryStore())
+	_, secret, err := keys.Create(context.Background(), apikey.Key{Tenant: "acme", Name: "ingest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := &apiKeyVerifier{keys: keys, tenants: tenant.NewRegistry(tenant.NewMemoryStore())}
+	if user, err := verifier.VerifyToken(secret); err != nil || user.Tenant != "acme" {
+		t.Fatalf("expected a key of an unregistered tenant to authenticate, got %v, %v", user, err)
+	}
+
+	verifier.tenants = tenant.NewRegistry(brokenTenants{})
+	if _, err := verifier.VerifyToken(secret); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Fatalf("expected a tenant lookup failure to refuse the key, got %v", err)
+	}
+}
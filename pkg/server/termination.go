@@ -0,0 +1,35 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/intake"
+	"github.com/devsnb/large-file-uploads/pkg/rejection"
+)
+
+// checkTermination refuses terminations of uploads whose intake doesn't
+// allow them. Uploads of intakes deleted since are terminated as usual.
+func (s *Server) checkTermination(ctx context.Context, info tusd.FileInfo) error {
+	id := info.MetaData[IntakeMetadataKey]
+	if id == "" {
+		return nil
+	}
+	in, err := s.intakes.Get(ctx, id)
+	switch {
+	case errors.Is(err, intake.ErrNotFound):
+		return nil
+	case err != nil:
+		slog.Error("Failed to load intake", "intake", id, "error", err)
+		return rejection.New(http.StatusInternalServerError, rejection.CodeUploadRejected, "failed to load intake")
+	case in.DisableTermination:
+		return rejection.New(http.StatusForbidden, rejection.CodeTerminationDisabled,
+			"uploads to this intake can't be terminated").
+			WithDetail("intake", id)
+	}
+	return nil
+}
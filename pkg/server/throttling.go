@@ -0,0 +1,59 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/devsnb/large-file-uploads/pkg/rejection"
+	"github.com/devsnb/large-file-uploads/pkg/report"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// Retry-After delays used when the backend doesn't give one and none is
+// configured
+const (
+	DefaultThrottleRetryAfter = 5 * time.Second
+	DefaultQuotaRetryAfter    = 5 * time.Minute
+)
+
+// storageThrottled counts a throttled storage operation and reports it to
+// the client as a retryable error. tus clients retry 5xx responses, so
+// throttling is answered with 503 rather than 429, and an exhausted quota
+// with 507.
+func (s *Server) storageThrottled(op string, throttle *storage.ThrottleError) error {
+	s.throttles.Inc(throttle.Kind, op)
+	if throttle.Kind != storage.ThrottleQuotaExceeded {
+		s.countFailure(report.FailureThrottled)
+	}
+
+	status, code, message := http.StatusServiceUnavailable, rejection.CodeStorageThrottled,
+		"storage is throttling requests, retry later"
+	delay := s.retryAfter(s.cfg.Storage.Throttling.RetryAfter, DefaultThrottleRetryAfter)
+	if throttle.Kind == storage.ThrottleQuotaExceeded {
+		s.countQuotaBreach("")
+		status, code, message = http.StatusInsufficientStorage, rejection.CodeStorageQuotaExceeded,
+			"storage quota exceeded, retry later"
+		delay = s.retryAfter(s.cfg.Storage.Throttling.QuotaRetryAfter, DefaultQuotaRetryAfter)
+	}
+	if throttle.RetryAfter > 0 {
+		delay = throttle.RetryAfter
+	}
+	rejected := rejection.New(status, code, message).WithRetryAfter(delay)
+
+	slog.Warn("Storage backend throttled request",
+		"operation", op,
+		"kind", throttle.Kind,
+		"retryAfter", rejected.Headers["Retry-After"],
+		"error", throttle.Err)
+
+	return s.rejections.Render(rejected)
+}
+
+// retryAfter returns the configured delay in seconds, or the fallback
+func (s *Server) retryAfter(seconds int, fallback time.Duration) time.Duration {
+	if seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return fallback
+}
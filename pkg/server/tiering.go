@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/events"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+	"github.com/devsnb/large-file-uploads/pkg/tiering"
+)
+
+// OnUploadTransitioned subscribes to uploads moved to another storage class
+// by a tiering rule. The event's upload carries the new storage_class
+// metadata. Tiering subscribers are always invoked asynchronously.
+func (s *Server) OnUploadTransitioned(handler events.Handler, opts ...events.SubscribeOption) {
+	opts = append(opts, events.WithMode(events.Async))
+	s.events.Subscribe(events.UploadTransitioned, handler, opts...)
+}
+
+// scheduleTransition schedules the transition of a completed upload by the
+// first tiering rule it matches. Partial uploads are only moved as part of
+// their final upload.
+func (s *Server) scheduleTransition(ctx context.Context, e events.Event) error {
+	if e.Upload.IsPartial {
+		return nil
+	}
+	transition, scheduled, err := s.tiering.Schedule(ctx, e.Upload.ID, e.Upload.Size, e.Upload.MetaData,
+		e.Upload.MetaData[storage.StorageClassMetadataKey])
+	if err != nil {
+		return fmt.Errorf("failed to schedule storage class transition: %w", err)
+	}
+	if scheduled {
+		slog.Debug("Storage class transition scheduled", "id", e.Upload.ID, "class", transition.Class, "dueAt", transition.DueAt)
+	}
+	return nil
+}
+
+// forgetTransition drops the scheduled transition of a terminated upload
+func (s *Server) forgetTransition(ctx context.Context, e events.Event) error {
+	return s.tiering.Done(ctx, e.Upload.ID)
+}
+
+// runTiering moves uploads whose transition is due every interval until the
+// context is canceled
+func (s *Server) runTiering(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(max(s.cfg.Storage.Tiering.Interval, 1)) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		due, err := s.tiering.Due(ctx)
+		if err != nil {
+			slog.Error("Failed to list due storage class transitions", "error", err)
+			continue
+		}
+		for _, transition := range due {
+			err := s.transitionUpload(ctx, transition)
+			if err == nil {
+				continue
+			}
+			if errors.Is(err, context.Canceled) {
+				return
+			}
+			gaveUp, retryErr := s.tiering.Failed(ctx, transition, err)
+			if retryErr != nil {
+				slog.Error("Failed to reschedule storage class transition", "id", transition.UploadID, "error", retryErr)
+			}
+			if gaveUp {
+				slog.Error("Gave up moving upload to storage class", "id", transition.UploadID, "class", transition.Class, "error", err)
+				continue
+			}
+			slog.Warn("Failed to move upload to storage class, retrying", "id", transition.UploadID, "class", transition.Class, "error", err)
+		}
+	}
+}
+
+// transitionUpload moves an upload to the class of its transition, holding
+// the upload's lock, and notifies the subscribers
+func (s *Server) transitionUpload(ctx context.Context, transition tiering.Transition) error {
+	unlock, err := s.lockUpload(ctx, transition.UploadID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := s.tierer.TransitionUpload(ctx, transition.UploadID, transition.Class); err != nil {
+		if errors.Is(err, tusd.ErrNotFound) {
+			// Deleted behind our back, nothing is left to move
+			return s.tiering.Done(ctx, transition.UploadID)
+		}
+		return err
+	}
+	if err := s.tiering.Done(ctx, transition.UploadID); err != nil {
+		return err
+	}
+
+	slog.Info("Upload moved to storage class", "id", transition.UploadID, "class", transition.Class)
+	info, err := s.uploadInfo(ctx, transition.UploadID)
+	if err != nil {
+		return nil
+	}
+	s.events.Notify(ctx, events.Event{Type: events.UploadTransitioned, Upload: info})
+	return nil
+}
+
+// listTransitions returns the scheduled storage class transitions, the next
+// one first
+func (s *Server) listTransitions(c *gin.Context) {
+	transitions, err := s.tiering.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"transitions": transitions})
+}
+
+// newTieringQueue creates the queue of storage class transitions, or returns
+// nil if tiering is disabled. Rule classes must be classes of the provider.
+func newTieringQueue(cfg config.TieringConfig, provider storage.Provider) (*tiering.Queue, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	rules := make([]tiering.Rule, 0, len(cfg.Rules))
+	for i, rule := range cfg.Rules {
+		class, ok := storage.NormalizeStorageClass(provider, rule.Class)
+		if !ok {
+			return nil, fmt.Errorf("tiering rule %d: unsupported storage class %q for provider %s", i, rule.Class, provider)
+		}
+		rules = append(rules, tiering.Rule{
+			Class:    class,
+			MinAge:   time.Duration(rule.MinAge) * time.Second,
+			MinSize:  rule.MinSize,
+			Metadata: rule.Metadata,
+		})
+	}
+
+	retry := time.Duration(max(cfg.Interval, 1)) * time.Second
+	if cfg.Dir == "" {
+		return tiering.NewQueue(tiering.NewMemoryStore(), rules, retry), nil
+	}
+	store, err := tiering.NewFileStore(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tiering store: %w", err)
+	}
+	return tiering.NewQueue(store, rules, retry), nil
+}
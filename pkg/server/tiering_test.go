@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/rejection"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+	"github.com/devsnb/large-file-uploads/pkg/tiering"
+)
+
+// tieredMemory is in-memory storage posing as S3, which records the uploads
+// it is asked to move and refuses to read them afterwards, as S3 does for
+// objects in Glacier
+type tieredMemory struct {
+	*storage.MemoryStorage
+	composer *tusd.StoreComposer
+
+	mu    sync.Mutex
+	moved map[string]string
+}
+
+func newTieredMemory(t *testing.T) *tieredMemory {
+	t.Helper()
+	store := &tieredMemory{MemoryStorage: newMemoryStorage(t), moved: map[string]string{}}
+	composer := *store.MemoryStorage.GetStoreComposer()
+	composer.Core = archivingStore{composer.Core, store}
+	store.composer = &composer
+	return store
+}
+
+func (s *tieredMemory) GetProvider() storage.Provider {
+	return storage.S3
+}
+
+func (s *tieredMemory) GetStoreComposer() *tusd.StoreComposer {
+	return s.composer
+}
+
+func (s *tieredMemory) TransitionUpload(ctx context.Context, uploadID, class string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.moved[uploadID] = class
+	return nil
+}
+
+func (s *tieredMemory) class(uploadID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.moved[uploadID]
+}
+
+// archivingStore is the data store of tieredMemory
+type archivingStore struct {
+	tusd.DataStore
+	store *tieredMemory
+}
+
+func (s archivingStore) GetUpload(ctx context.Context, id string) (tusd.Upload, error) {
+	upload, err := s.DataStore.GetUpload(ctx, id)
+	if err != nil || s.store.class(id) != "GLACIER" {
+		return upload, err
+	}
+	return archivedUpload{upload}, nil
+}
+
+// archivedUpload is an upload in Glacier
+type archivedUpload struct {
+	tusd.Upload
+}
+
+func (u archivedUpload) GetReader(ctx context.Context) (io.ReadCloser, error) {
+	return nil, &smithy.GenericAPIError{Code: "InvalidObjectState", Message: "The operation is not valid for the object's storage class"}
+}
+
+func TestTieringSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	configure := func(cfg *config.Config) {
+		cfg.Storage.Tiering = config.TieringConfig{
+			Enabled:  true,
+			Dir:      dir,
+			Interval: 3600,
+			Rules:    []config.TieringRule{{Class: "glacier", MinAge: 30 * 24 * 3600}},
+		}
+	}
+	store := newTieredMemory(t)
+	srv, ts := newTestServerOn(t, store, configure)
+	id := upload(t, ts, "hello", nil)
+
+	var transitions []tiering.Transition
+	deadline := time.Now().Add(5 * time.Second)
+	for len(transitions) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		var err error
+		if transitions, err = srv.tiering.List(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(transitions) != 1 || transitions[0].UploadID != id || transitions[0].Class != "GLACIER" {
+		t.Fatalf("expected a transition of %s to GLACIER, got %+v", id, transitions)
+	}
+	if err := srv.stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The transition is still scheduled after a restart, a month before it
+	// is due
+	restarted, ts := newTestServerOn(t, store, configure)
+	transitions, err := restarted.tiering.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transitions) != 1 || transitions[0].UploadID != id {
+		t.Fatalf("expected the transition to survive a restart, got %+v", transitions)
+	}
+
+	if err := restarted.transitionUpload(context.Background(), transitions[0]); err != nil {
+		t.Fatal(err)
+	}
+	if class := store.class(id); class != "GLACIER" {
+		t.Fatalf("expected the upload to be moved to GLACIER, got %q", class)
+	}
+	if transitions, err = restarted.tiering.List(context.Background()); err != nil || len(transitions) != 0 {
+		t.Fatalf("expected no transitions left, got %+v %v", transitions, err)
+	}
+
+	resp, body := request(t, http.MethodGet, ts.URL+"/files/"+id, nil, "")
+	if resp.StatusCode != http.StatusConflict || !strings.Contains(body, rejection.CodeRestoreRequired) {
+		t.Fatalf("expected downloads of archived uploads to require a restore, got %d %s", resp.StatusCode, body)
+	}
+}
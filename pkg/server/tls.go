@@ -0,0 +1,116 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+)
+
+// tlsVersions are the minimum TLS versions that can be configured
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// clientAuthPolicies are the client certificate policies that can be
+// configured
+var clientAuthPolicies = map[string]tls.ClientAuthType{
+	"none":               tls.NoClientCert,
+	"request":            tls.RequestClientCert,
+	"require":            tls.RequireAnyClientCert,
+	"verify_if_given":    tls.VerifyClientCertIfGiven,
+	"require_and_verify": tls.RequireAndVerifyClientCert,
+}
+
+// newTLSConfig creates the TLS configuration the server listens with, or
+// returns nil if TLS is terminated elsewhere
+func newTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if cfg.MinVersion != "" {
+		version, ok := tlsVersions[cfg.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported minimum TLS version %q, use 1.2 or 1.3", cfg.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if len(cfg.CipherSuites) > 0 {
+		// Go doesn't allow configuring TLS 1.3 suites, which are all secure
+		if tlsConfig.MinVersion == tls.VersionTLS13 {
+			return nil, fmt.Errorf("cipher suites can't be configured with a minimum TLS version of 1.3")
+		}
+		suites, err := cipherSuites(cfg.CipherSuites)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.CipherSuites = suites
+	}
+
+	if cfg.ClientAuth != "" {
+		policy, ok := clientAuthPolicies[cfg.ClientAuth]
+		if !ok {
+			return nil, fmt.Errorf("unsupported TLS client auth policy %q", cfg.ClientAuth)
+		}
+		tlsConfig.ClientAuth = policy
+	}
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS client CAs: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+	}
+	if tlsConfig.ClientCAs == nil && (tlsConfig.ClientAuth == tls.VerifyClientCertIfGiven || tlsConfig.ClientAuth == tls.RequireAndVerifyClientCert) {
+		return nil, fmt.Errorf("TLS client auth policy %q requires clientCaFile to be set", cfg.ClientAuth)
+	}
+
+	return tlsConfig, nil
+}
+
+// cipherSuites resolves TLS 1.2 cipher suite names to their IDs. Suites Go
+// considers insecure are refused.
+func cipherSuites(names []string) ([]uint16, error) {
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		if slices.Contains(suite.SupportedVersions, tls.VersionTLS12) {
+			known[suite.Name] = suite.ID
+		}
+	}
+	insecure := make(map[string]bool)
+	for _, suite := range tls.InsecureCipherSuites() {
+		insecure[suite.Name] = true
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		if insecure[name] {
+			return nil, fmt.Errorf("cipher suite %s is insecure", name)
+		}
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS 1.2 cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+)
+
+// writeCertificate writes a self-signed certificate and its key to a
+// temporary directory and returns their paths
+func writeCertificate(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	certFile, keyFile := writeCertificate(t)
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(empty, []byte("no certificates"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tlsConfig, err := newTLSConfig(config.TLSConfig{})
+	if tlsConfig != nil || err != nil {
+		t.Fatalf("expected no TLS configuration while TLS is disabled, got %v %v", tlsConfig, err)
+	}
+
+	tlsConfig, err = newTLSConfig(config.TLSConfig{
+		Enabled:      true,
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+		ClientAuth:   "require_and_verify",
+		ClientCAFile: certFile,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig.MinVersion != tls.VersionTLS12 || len(tlsConfig.Certificates) != 1 {
+		t.Errorf("expected TLS 1.2 with the certificate, got %+v", tlsConfig)
+	}
+	if len(tlsConfig.CipherSuites) != 1 || tlsConfig.CipherSuites[0] != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("unexpected cipher suites %v", tlsConfig.CipherSuites)
+	}
+	if tlsConfig.ClientAuth != tls.RequireAndVerifyClientCert || tlsConfig.ClientCAs == nil {
+		t.Errorf("expected client certificates to be verified, got %v", tlsConfig.ClientAuth)
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(cfg *config.TLSConfig)
+		expected string
+	}{
+		{"missing certificate", func(cfg *config.TLSConfig) { cfg.CertFile = filepath.Join(t.TempDir(), "missing.pem") }, "failed to load TLS certificate"},
+		{"unsupported version", func(cfg *config.TLSConfig) { cfg.MinVersion = "1.1" }, "unsupported minimum TLS version"},
+		{"suites with TLS 1.3", func(cfg *config.TLSConfig) {
+			cfg.MinVersion = "1.3"
+			cfg.CipherSuites = []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}
+		}, "can't be configured"},
+		{"insecure suite", func(cfg *config.TLSConfig) { cfg.CipherSuites = []string{"TLS_RSA_WITH_RC4_128_SHA"} }, "is insecure"},
+		{"unknown suite", func(cfg *config.TLSConfig) { cfg.CipherSuites = []string{"TLS_AES_128_GCM_SHA256"} }, "unknown TLS 1.2 cipher suite"},
+		{"unknown client auth", func(cfg *config.TLSConfig) { cfg.ClientAuth = "always" }, "unsupported TLS client auth policy"},
+		{"verification without CAs", func(cfg *config.TLSConfig) { cfg.ClientAuth = "verify_if_given" }, "requires clientCaFile"},
+		{"CA file without certificates", func(cfg *config.TLSConfig) { cfg.ClientCAFile = empty }, "no certificates found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.TLSConfig{Enabled: true, CertFile: certFile, KeyFile: keyFile}
+			tt.modify(&cfg)
+			_, err := newTLSConfig(cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Fatalf("expected an error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/devsnb/large-file-uploads/pkg/auth"
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+	"github.com/devsnb/large-file-uploads/pkg/traffic"
+)
+
+// trafficMiddleware counts the request and response body bytes of every
+// request by the tenant and user it came from
+func (s *Server) trafficMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := &countingReader{ReadCloser: c.Request.Body}
+		if c.Request.Body != nil && c.Request.Body != http.NoBody {
+			c.Request.Body = body
+		}
+		c.Next()
+
+		// Authentication later in the chain adds the user to the request
+		s.traffic.Record(trafficKey(c), body.n, int64(c.Writer.Size()), time.Now())
+	}
+}
+
+// trafficKey returns whose traffic a request is. Requests without a user,
+// e.g. with authentication disabled, count for the tenant their upload
+// belongs to, if any.
+func trafficKey(c *gin.Context) traffic.Key {
+	if user, err := auth.GetUserFromContext(c.Request.Context()); err == nil {
+		return traffic.Key{Tenant: user.Tenant, User: user.ID}
+	}
+	if strings.HasPrefix(c.Request.URL.Path, DefaultBasePath) {
+		if tenant, ok := storage.TenantFromKey(strings.Trim(c.Param("any"), "/")); ok {
+			return traffic.Key{Tenant: tenant}
+		}
+	}
+	return traffic.Key{}
+}
+
+// getTraffic returns the traffic of the caller's tenant and its users
+func (s *Server) getTraffic(c *gin.Context) {
+	tenant, _, ok := managedTenant(c, "traffic")
+	if !ok {
+		return
+	}
+
+	users, err := s.traffic.Users(c.Request.Context(), tenant)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	total := traffic.Usage{Key: traffic.Key{Tenant: tenant}}
+	if tenants := traffic.Tenants(users); len(tenants) > 0 {
+		total = tenants[0]
+	}
+	c.JSON(http.StatusOK, gin.H{"total": total, "users": users})
+}
+
+// adminGetTraffic returns the traffic of every tenant and user, or of one
+// tenant with the tenant query parameter
+func (s *Server) adminGetTraffic(c *gin.Context) {
+	users, err := s.traffic.Users(c.Request.Context(), c.Query("tenant"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tenants": traffic.Tenants(users), "users": users})
+}
+
+// newTrafficMeter creates the traffic meter, or returns nil if traffic is
+// not accounted
+func newTrafficMeter(cfg config.TrafficConfig) (*traffic.Meter, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	interval := time.Duration(cfg.FlushInterval) * time.Second
+	if cfg.Dir == "" {
+		return traffic.NewMeter(traffic.NewMemoryStore(), interval), nil
+	}
+
+	store, err := traffic.NewFileStore(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create traffic store: %w", err)
+	}
+	return traffic.NewMeter(store, interval), nil
+}
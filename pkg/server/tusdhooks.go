@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/hooks"
+	"github.com/tus/tusd/v2/pkg/hooks/file"
+	grpchooks "github.com/tus/tusd/v2/pkg/hooks/grpc"
+	"github.com/tus/tusd/v2/pkg/hooks/plugin"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/metrics"
+	"github.com/devsnb/large-file-uploads/pkg/rejection"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// tusdHooks invokes hooks written for tusd's file, gRPC or plugin hook
+// systems with tusd's request and response format
+type tusdHooks struct {
+	handler hooks.HookHandler
+	enabled map[hooks.HookType]bool
+	metrics *metrics.Hooks
+}
+
+// newTusdHooks sets up the configured hook system, or returns nil if hooks
+// are disabled
+func newTusdHooks(cfg config.TusdHooksConfig) (*tusdHooks, error) {
+	var handler hooks.HookHandler
+	switch cfg.Type {
+	case "":
+		return nil, nil
+	case "file":
+		handler = &file.FileHook{Directory: cfg.Dir}
+	case "grpc":
+		handler = &grpchooks.GrpcHook{
+			Endpoint:                        cfg.GRPC.Endpoint,
+			MaxRetries:                      cfg.GRPC.MaxRetries,
+			Backoff:                         time.Duration(cfg.GRPC.Backoff) * time.Second,
+			Secure:                          cfg.GRPC.Secure,
+			ServerTLSCertificateFilePath:    cfg.GRPC.ServerCertFile,
+			ClientTLSCertificateFilePath:    cfg.GRPC.ClientCertFile,
+			ClientTLSCertificateKeyFilePath: cfg.GRPC.ClientKeyFile,
+			ForwardHeaders:                  cfg.GRPC.ForwardHeaders,
+		}
+	case "plugin":
+		handler = &plugin.PluginHook{Path: cfg.Plugin}
+	default:
+		return nil, fmt.Errorf("unsupported hook type: %s", cfg.Type)
+	}
+
+	enabled := make(map[hooks.HookType]bool, len(cfg.Enabled))
+	for _, name := range cfg.Enabled {
+		hookType := hooks.HookType(name)
+		if !slices.Contains(hooks.AvailableHooks, hookType) {
+			return nil, fmt.Errorf("unknown hook %q", name)
+		}
+		enabled[hookType] = true
+	}
+
+	if err := handler.Setup(); err != nil {
+		return nil, fmt.Errorf("failed to set up %s hooks: %w", cfg.Type, err)
+	}
+	return &tusdHooks{handler: handler, enabled: enabled, metrics: metrics.NewHooks()}, nil
+}
+
+// invoke runs a hook if it is enabled. Disabled hooks answer an empty
+// response.
+func (h *tusdHooks) invoke(hookType hooks.HookType, hook tusd.HookEvent) (hooks.HookResponse, error) {
+	if !h.enabled[hookType] {
+		return hooks.HookResponse{}, nil
+	}
+
+	resp, err := h.handler.InvokeHook(hooks.HookRequest{Type: hookType, Event: hook})
+	h.metrics.Inc(string(hookType), err != nil)
+	if err != nil {
+		slog.Error("Hook failed", "type", hookType, "id", hook.Upload.ID, "error", err)
+		return hooks.HookResponse{}, err
+	}
+	return resp, nil
+}
+
+// preCreateHook runs the pre-create hook, which can reject the upload or
+// change its ID and metadata
+func (s *Server) preCreateHook(hook tusd.HookEvent) (hooks.HookResponse, error) {
+	if s.tusdHooks == nil {
+		return hooks.HookResponse{}, nil
+	}
+	resp, err := s.tusdHooks.invoke(hooks.HookPreCreate, hook)
+	if err != nil {
+		return resp, hookFailed(hooks.HookPreCreate)
+	}
+	if resp.RejectUpload {
+		return resp, hookRejection(tusd.ErrUploadRejectedByServer, resp.HTTPResponse)
+	}
+	// The ID ends up in object keys and file paths, so separators and
+	// path elements are refused
+	if id := resp.ChangeFileInfo.ID; id != "" && !storage.ValidUploadID(id) {
+		slog.Error("Hook assigned an invalid upload ID", "type", hooks.HookPreCreate, "id", id)
+		return resp, hookFailed(hooks.HookPreCreate)
+	}
+	return resp, nil
+}
+
+// preFinishHook runs the pre-finish hook and returns the response it adds
+// to the final PATCH request of the upload
+func (s *Server) preFinishHook(hook tusd.HookEvent) (tusd.HTTPResponse, error) {
+	if s.tusdHooks == nil {
+		return tusd.HTTPResponse{}, nil
+	}
+	resp, err := s.tusdHooks.invoke(hooks.HookPreFinish, hook)
+	if err != nil {
+		return tusd.HTTPResponse{}, hookFailed(hooks.HookPreFinish)
+	}
+	return resp.HTTPResponse, nil
+}
+
+// preTerminateHook runs the pre-terminate hook, which can refuse the
+// termination
+func (s *Server) preTerminateHook(hook tusd.HookEvent) error {
+	if s.tusdHooks == nil {
+		return nil
+	}
+	resp, err := s.tusdHooks.invoke(hooks.HookPreTerminate, hook)
+	if err != nil {
+		return hookFailed(hooks.HookPreTerminate)
+	}
+	if resp.RejectTermination {
+		return hookRejection(tusd.ErrUploadTerminationRejected, resp.HTTPResponse)
+	}
+	return nil
+}
+
+// notifyHook runs a post-* hook in the background. A post-receive hook can
+// stop the upload.
+func (s *Server) notifyHook(hookType hooks.HookType, hook tusd.HookEvent) {
+	if s.tusdHooks == nil || !s.tusdHooks.enabled[hookType] {
+		return
+	}
+	started := s.goBackground(func(context.Context) {
+		resp, err := s.tusdHooks.invoke(hookType, hook)
+		if err == nil && hookType == hooks.HookPostReceive && resp.StopUpload {
+			slog.Info("Upload stopped by hook", "id", hook.Upload.ID)
+			hook.Upload.StopUpload(resp.HTTPResponse)
+		}
+	})
+	if !started {
+		slog.Warn("Hook dropped during shutdown", "type", hookType, "id", hook.Upload.ID)
+	}
+}
+
+// hookRejection converts the refusal of a hook into a rejection carrying
+// the status code and headers the hook responded with, and its body as the
+// message
+func hookRejection(refusal tusd.Error, resp tusd.HTTPResponse) *rejection.Error {
+	status := refusal.HTTPResponse.StatusCode
+	if resp.StatusCode != 0 {
+		status = resp.StatusCode
+	}
+	message := refusal.Message
+	if body := strings.TrimSpace(resp.Body); body != "" {
+		message = body
+	}
+
+	rejected := rejection.New(status, refusal.ErrorCode, message)
+	for name, value := range resp.Header {
+		// The rejection is rendered as JSON whatever the hook answered
+		if http.CanonicalHeaderKey(name) != "Content-Type" {
+			rejected.WithHeader(name, value)
+		}
+	}
+	return rejected
+}
+
+// hookFailed is the rejection of a request whose hook could not be run
+func hookFailed(hookType hooks.HookType) *rejection.Error {
+	return rejection.New(http.StatusInternalServerError, rejection.CodeInternalError,
+		fmt.Sprintf("%s hook failed", hookType))
+}
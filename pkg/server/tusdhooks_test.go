@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+)
+
+// writeHook writes an executable file hook answering with the response
+func writeHook(t *testing.T, dir, hookType, script string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, hookType), []byte("#!/bin/sh\ncat > /dev/null\n"+script+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newHookServer starts a server invoking the file hooks in dir
+func newHookServer(t *testing.T, dir string, enabled ...string) (*Server, *httptest.Server) {
+	t.Helper()
+	return newTestServerOn(t, newMemoryStorage(t), func(cfg *config.Config) {
+		cfg.TusdHooks = config.TusdHooksConfig{Type: "file", Dir: dir, Enabled: enabled}
+	})
+}
+
+func TestPreCreateHook(t *testing.T) {
+	dir := t.TempDir()
+	_, ts := newHookServer(t, dir, "pre-create")
+	url := ts.URL
+
+	writeHook(t, dir, "pre-create", `echo '{"ChangeFileInfo":{"ID":"assigned-by-hook"}}'`)
+	resp, body := request(t, http.MethodPost, url+DefaultBasePath, map[string]string{"Upload-Length": "5"}, "")
+	if resp.StatusCode != http.StatusCreated || !strings.HasSuffix(resp.Header.Get("Location"), "/assigned-by-hook") {
+		t.Fatalf("expected the upload to get the hook's ID, got %d %s at %q", resp.StatusCode, body, resp.Header.Get("Location"))
+	}
+
+	// IDs that would escape the tenant, key prefix or directory are refused
+	for _, id := range []string{"../escape", "other~tenant", "a+b", "a/b"} {
+		writeHook(t, dir, "pre-create", `echo '{"ChangeFileInfo":{"ID":"`+id+`"}}'`)
+		resp, body := request(t, http.MethodPost, url+DefaultBasePath, map[string]string{"Upload-Length": "5"}, "")
+		if resp.StatusCode != http.StatusInternalServerError {
+			t.Fatalf("expected the hook's ID %q to be refused, got %d %s", id, resp.StatusCode, body)
+		}
+	}
+
+	writeHook(t, dir, "pre-create", `echo '{"RejectUpload":true,"HTTPResponse":{"StatusCode":422,"Body":"no thanks"}}'`)
+	resp, body = request(t, http.MethodPost, url+DefaultBasePath, map[string]string{"Upload-Length": "5"}, "")
+	if resp.StatusCode != http.StatusUnprocessableEntity || !strings.Contains(body, "no thanks") {
+		t.Fatalf("expected the hook's rejection, got %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestNotifyHooksJoinedOnStop(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "finished")
+	writeHook(t, dir, "post-finish", "sleep 0.2\ntouch "+marker)
+	srv, ts := newHookServer(t, dir, "post-finish")
+
+	upload(t, ts, "hello", nil)
+	if err := srv.stop(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Fatalf("expected the post-finish hook to complete before the server stopped: %v", err)
+	}
+}
+
+func TestTusdHooksConfig(t *testing.T) {
+	if hooks, err := newTusdHooks(config.TusdHooksConfig{}); hooks != nil || err != nil {
+		t.Fatalf("expected hooks to be disabled without a type, got %v, %v", hooks, err)
+	}
+	if _, err := newTusdHooks(config.TusdHooksConfig{Type: "carrier-pigeon"}); err == nil {
+		t.Fatal("expected an unknown hook type to be refused")
+	}
+	if _, err := newTusdHooks(config.TusdHooksConfig{Type: "file", Dir: t.TempDir(), Enabled: []string{"pre-lunch"}}); err == nil {
+		t.Fatal("expected an unknown hook to be refused")
+	}
+}
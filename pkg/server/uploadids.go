@@ -0,0 +1,31 @@
+package server
+
+import (
+	"time"
+
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+	"github.com/devsnb/large-file-uploads/pkg/uploadid"
+)
+
+// uploadIDDateLayout is the layout of the date prefix of upload IDs
+const uploadIDDateLayout = "20060102"
+
+// SetUploadIDGenerator replaces the generator of the unique part of upload
+// IDs. The tenant, key and date prefixes are still added around it. It must
+// be called before the server starts handling requests.
+func (s *Server) SetUploadIDGenerator(generator uploadid.Generator) {
+	s.ids = generator
+}
+
+// newUploadID generates an upload ID of the form
+// [<tenant>~][<prefix>-][<date>-]<id>
+func (s *Server) newUploadID(tenant, prefix string) (string, error) {
+	id, err := s.ids.NewID()
+	if err != nil {
+		return "", err
+	}
+	if s.cfg.UploadIDs.DatePrefix {
+		id = time.Now().UTC().Format(uploadIDDateLayout) + storage.KeyPrefixSeparator + id
+	}
+	return storage.FormatUploadID(tenant, prefix, id), nil
+}
@@ -0,0 +1,404 @@
+// Package share manages public links to completed uploads, which owners
+// hand out to people without an account. Links expire, may require a
+// password and may only allow a number of downloads.
+package share
+
+import (
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxPasswordLen limits link passwords
+const MaxPasswordLen = 256
+
+// ResumeWindow is how long after its last counted download a link that ran
+// out of downloads still serves range requests resuming that download
+const ResumeWindow = time.Hour
+
+// passwordIterations is the PBKDF2 work factor of stored password digests
+const passwordIterations = 600_000
+
+// Common errors returned by link operations
+var (
+	ErrNotFound         = errors.New("share link not found")
+	ErrInvalid          = errors.New("invalid share link")
+	ErrRevoked          = errors.New("share link revoked")
+	ErrExpired          = errors.New("share link expired")
+	ErrExhausted        = errors.New("share link download limit reached")
+	ErrBadSecret        = errors.New("share link secret mismatch")
+	ErrMalformed        = errors.New("malformed share link")
+	ErrPasswordRequired = errors.New("share link requires a password")
+	ErrBadPassword      = errors.New("share link password mismatch")
+)
+
+// Link is a public link to an upload. Only digests of its secret and
+// password are stored.
+type Link struct {
+	ID        string `json:"id"`
+	UploadID  string `json:"uploadId"`
+	Tenant    string `json:"tenant,omitempty"`
+	CreatedBy string `json:"createdBy,omitempty"`
+	Hash      string `json:"hash"` // Hex encoded SHA-256 digest of the secret
+
+	// PasswordHash is a PBKDF2 digest of the password, empty for links
+	// without one
+	PasswordHash string `json:"passwordHash,omitempty"`
+
+	// MaxDownloads is how many downloads the link allows, 0 for no limit
+	MaxDownloads int64 `json:"maxDownloads,omitempty"`
+	Downloads    int64 `json:"downloads"`
+
+	CreatedAt      time.Time  `json:"createdAt"`
+	ExpiresAt      time.Time  `json:"expiresAt"`
+	LastDownloadAt *time.Time `json:"lastDownloadAt,omitempty"`
+	RevokedAt      *time.Time `json:"revokedAt,omitempty"`
+}
+
+// Protected reports whether the link requires a password
+func (l Link) Protected() bool {
+	return l.PasswordHash != ""
+}
+
+// Expired reports whether the link can no longer be used
+func (l Link) Expired(now time.Time) bool {
+	return !now.Before(l.ExpiresAt)
+}
+
+// Exhausted reports whether the link allowed all its downloads
+func (l Link) Exhausted() bool {
+	return l.MaxDownloads > 0 && l.Downloads >= l.MaxDownloads
+}
+
+// Store persists links
+type Store interface {
+	Put(ctx context.Context, link Link) error
+	Get(ctx context.Context, id string) (Link, error)
+	List(ctx context.Context) ([]Link, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// Registry creates, revokes and redeems links
+type Registry struct {
+	store Store
+	now   func() time.Time
+
+	// mu serializes updates, so concurrent downloads never exceed a limit
+	// and counting a download never undoes a revocation
+	mu sync.Mutex
+}
+
+// NewRegistry creates a registry backed by the store
+func NewRegistry(store Store) *Registry {
+	return &Registry{store: store, now: time.Now}
+}
+
+// Create issues a link protected by the password, if not empty, and returns
+// it with its token, which can't be retrieved afterwards
+func (r *Registry) Create(ctx context.Context, link Link, password string) (Link, string, error) {
+	if link.UploadID == "" {
+		return Link{}, "", fmt.Errorf("%w: upload is required", ErrInvalid)
+	}
+	now := r.now()
+	if !link.ExpiresAt.After(now) {
+		return Link{}, "", fmt.Errorf("%w: expiresAt must be in the future", ErrInvalid)
+	}
+	if link.MaxDownloads < 0 {
+		return Link{}, "", fmt.Errorf("%w: maxDownloads must not be negative", ErrInvalid)
+	}
+	if len(password) > MaxPasswordLen {
+		return Link{}, "", fmt.Errorf("%w: password must be at most %d characters", ErrInvalid, MaxPasswordLen)
+	}
+
+	link.PasswordHash = ""
+	if password != "" {
+		hash, err := hashPassword(password)
+		if err != nil {
+			return Link{}, "", err
+		}
+		link.PasswordHash = hash
+	}
+	secret := newSecret()
+	link.ID = newID()
+	link.Hash = digest(secret)
+	link.Downloads = 0
+	link.CreatedAt = now
+	link.LastDownloadAt, link.RevokedAt = nil, nil
+	if err := r.store.Put(ctx, link); err != nil {
+		return Link{}, "", fmt.Errorf("failed to store share link: %w", err)
+	}
+	return link, token(link.ID, secret), nil
+}
+
+// Get returns a link to the upload
+func (r *Registry) Get(ctx context.Context, uploadID, id string) (Link, error) {
+	link, err := r.store.Get(ctx, id)
+	if err != nil {
+		return Link{}, err
+	}
+	if link.UploadID != uploadID {
+		return Link{}, ErrNotFound
+	}
+	return link, nil
+}
+
+// List returns the links to the upload, newest first, including revoked and
+// expired ones
+func (r *Registry) List(ctx context.Context, uploadID string) ([]Link, error) {
+	all, err := r.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	links := make([]Link, 0, len(all))
+	for _, link := range all {
+		if link.UploadID == uploadID {
+			links = append(links, link)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].CreatedAt.After(links[j].CreatedAt)
+	})
+	return links, nil
+}
+
+// Revoke disables a link for good. Revoked links are kept so they remain
+// listed with their downloads.
+func (r *Registry) Revoke(ctx context.Context, uploadID, id string) (Link, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	link, err := r.Get(ctx, uploadID, id)
+	if err != nil {
+		return Link{}, err
+	}
+	if link.RevokedAt != nil {
+		return link, nil
+	}
+	now := r.now()
+	link.RevokedAt = &now
+	if err := r.store.Put(ctx, link); err != nil {
+		return Link{}, fmt.Errorf("failed to store share link: %w", err)
+	}
+	return link, nil
+}
+
+// Forget deletes the links to an upload, e.g. once it is terminated
+func (r *Registry) Forget(ctx context.Context, uploadID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	links, err := r.List(ctx, uploadID)
+	if err != nil {
+		return err
+	}
+	for _, link := range links {
+		if err := r.store.Delete(ctx, link.ID); err != nil {
+			return fmt.Errorf("failed to delete share link: %w", err)
+		}
+	}
+	return nil
+}
+
+// Verify returns the link a token belongs to if it grants access to the
+// upload, without checking its password or counting a download
+func (r *Registry) Verify(ctx context.Context, token, uploadID string) (Link, error) {
+	return r.verify(ctx, token, uploadID, false)
+}
+
+// verify checks a token for Verify, letting links that ran out of downloads
+// resume their last one within ResumeWindow
+func (r *Registry) verify(ctx context.Context, token, uploadID string, resuming bool) (Link, error) {
+	id, secret, ok := parseToken(token)
+	if !ok {
+		return Link{}, ErrMalformed
+	}
+	link, err := r.store.Get(ctx, id)
+	if err != nil {
+		return Link{}, err
+	}
+	if !matches(secret, link.Hash) || link.UploadID != uploadID {
+		return Link{}, ErrBadSecret
+	}
+	if link.RevokedAt != nil {
+		return Link{}, ErrRevoked
+	}
+	if link.Expired(r.now()) {
+		return Link{}, ErrExpired
+	}
+	if link.Exhausted() && !(resuming && link.LastDownloadAt != nil && r.now().Sub(*link.LastDownloadAt) < ResumeWindow) {
+		return Link{}, ErrExhausted
+	}
+	return link, nil
+}
+
+// Authorize checks the token and password of a request resuming a download
+// of the upload, such as a range request, without counting it
+func (r *Registry) Authorize(ctx context.Context, token, uploadID, password string) (Link, error) {
+	link, err := r.verify(ctx, token, uploadID, true)
+	if err != nil {
+		return Link{}, err
+	}
+	if err := link.checkPassword(password); err != nil {
+		return Link{}, err
+	}
+	return link, nil
+}
+
+// checkPassword checks the password of a download with the link
+func (l Link) checkPassword(password string) error {
+	if !l.Protected() {
+		return nil
+	}
+	if password == "" {
+		return ErrPasswordRequired
+	}
+	if !checkPassword(password, l.PasswordHash) {
+		return ErrBadPassword
+	}
+	return nil
+}
+
+// Redeem checks the token and password of a download of the upload and
+// counts it. Downloads that fail are given back with Refund.
+func (r *Registry) Redeem(ctx context.Context, token, uploadID, password string) (Link, error) {
+	link, err := r.Verify(ctx, token, uploadID)
+	if err != nil {
+		return Link{}, err
+	}
+	if err := link.checkPassword(password); err != nil {
+		return Link{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// The link may have changed while the password was checked
+	link, err = r.store.Get(ctx, link.ID)
+	if err != nil {
+		return Link{}, err
+	}
+	now := r.now()
+	switch {
+	case link.RevokedAt != nil:
+		return Link{}, ErrRevoked
+	case link.Expired(now):
+		return Link{}, ErrExpired
+	case link.Exhausted():
+		return Link{}, ErrExhausted
+	}
+	link.Downloads++
+	link.LastDownloadAt = &now
+	if err := r.store.Put(ctx, link); err != nil {
+		return Link{}, fmt.Errorf("failed to record share link download: %w", err)
+	}
+	return link, nil
+}
+
+// Refund gives back a download counted by Redeem that didn't succeed
+func (r *Registry) Refund(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	link, err := r.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if link.Downloads == 0 {
+		return nil
+	}
+	link.Downloads--
+	if err := r.store.Put(ctx, link); err != nil {
+		return fmt.Errorf("failed to refund share link download: %w", err)
+	}
+	return nil
+}
+
+// token formats the token handed out in links
+func token(id, secret string) string {
+	return id + "_" + secret
+}
+
+// parseToken splits a token into its ID and secret. IDs are hex, so the
+// first underscore ends the ID.
+func parseToken(token string) (id, secret string, ok bool) {
+	id, secret, ok = strings.Cut(token, "_")
+	if !ok || id == "" || secret == "" {
+		return "", "", false
+	}
+	if _, err := hex.DecodeString(id); err != nil {
+		return "", "", false
+	}
+	return id, secret, true
+}
+
+// matches compares a secret to a stored digest in constant time
+func matches(secret, hash string) bool {
+	return hash != "" && subtle.ConstantTimeCompare([]byte(digest(secret)), []byte(hash)) == 1
+}
+
+// digest returns the hex encoded SHA-256 digest of a secret
+func digest(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// hashPassword derives a salted digest of a password, formatted as
+// pbkdf2-sha256$<iterations>$<salt>$<key>. Unlike link secrets, passwords
+// are chosen by people and need a slow digest.
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	_, _ = rand.Read(salt)
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordIterations, sha256.Size)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash share link password: %w", err)
+	}
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", passwordIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// checkPassword compares a password to a digest from hashPassword
+func checkPassword(password, hash string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(want))
+	return err == nil && subtle.ConstantTimeCompare(key, want) == 1
+}
+
+// newID generates a random link ID
+func newID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// newSecret generates a random link secret
+func newSecret() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
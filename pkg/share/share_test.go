@@ -0,0 +1,192 @@
+package share
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRedeemEnforcesLimit(t *testing.T) {
+	ctx := context.Background()
+	r := NewRegistry(NewMemoryStore())
+
+	link, token, err := r.Create(ctx, Link{UploadID: "u1", ExpiresAt: time.Now().Add(time.Hour), MaxDownloads: 2}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Hash == "" || link.Hash == token {
+		t.Fatalf("expected only a digest of the secret to be stored, got %q", link.Hash)
+	}
+
+	for _, bad := range []string{token + "x", link.ID, "zz_abc", ""} {
+		if _, err := r.Redeem(ctx, bad, "u1", ""); err == nil {
+			t.Errorf("expected %q to be refused", bad)
+		}
+	}
+	if _, err := r.Redeem(ctx, token, "u2", ""); !errors.Is(err, ErrBadSecret) {
+		t.Fatalf("expected links to be bound to their upload, got %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := r.Redeem(ctx, token, "u1", ""); err != nil {
+			t.Fatalf("download %d: %v", i+1, err)
+		}
+	}
+	if _, err := r.Redeem(ctx, token, "u1", ""); !errors.Is(err, ErrExhausted) {
+		t.Fatalf("expected the limit to be enforced, got %v", err)
+	}
+
+	// Failed downloads are given back
+	if err := r.Refund(ctx, link.ID); err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.Redeem(ctx, token, "u1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Downloads != 2 || got.LastDownloadAt == nil {
+		t.Fatalf("redeemed link = %+v", got)
+	}
+}
+
+func TestRedeemChecksPassword(t *testing.T) {
+	ctx := context.Background()
+	r := NewRegistry(NewMemoryStore())
+
+	link, token, err := r.Create(ctx, Link{UploadID: "u1", ExpiresAt: time.Now().Add(time.Hour)}, "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !link.Protected() || link.PasswordHash == "hunter2" {
+		t.Fatalf("expected a digest of the password to be stored, got %q", link.PasswordHash)
+	}
+
+	if _, err := r.Redeem(ctx, token, "u1", ""); !errors.Is(err, ErrPasswordRequired) {
+		t.Fatalf("expected a password to be required, got %v", err)
+	}
+	if _, err := r.Redeem(ctx, token, "u1", "hunter3"); !errors.Is(err, ErrBadPassword) {
+		t.Fatalf("expected a wrong password to be refused, got %v", err)
+	}
+	if _, err := r.Redeem(ctx, token, "u1", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	// Checking a link without downloading doesn't need the password
+	if _, err := r.Verify(ctx, token, "u1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuthorizeResumesWithoutCounting(t *testing.T) {
+	ctx := context.Background()
+	r := NewRegistry(NewMemoryStore())
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	link, token, err := r.Create(ctx, Link{UploadID: "u1", ExpiresAt: now.Add(24 * time.Hour), MaxDownloads: 1}, "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Authorize(ctx, token, "u1", ""); !errors.Is(err, ErrPasswordRequired) {
+		t.Fatalf("expected a password to be required, got %v", err)
+	}
+	if _, err := r.Redeem(ctx, token, "u1", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The last allowed download can be resumed for a while
+	for i := 0; i < 3; i++ {
+		got, err := r.Authorize(ctx, token, "u1", "hunter2")
+		if err != nil {
+			t.Fatalf("resuming the last download: %v", err)
+		}
+		if got.Downloads != 1 {
+			t.Fatalf("expected resumed downloads not to be counted, got %d", got.Downloads)
+		}
+	}
+	if _, err := r.Redeem(ctx, token, "u1", "hunter2"); !errors.Is(err, ErrExhausted) {
+		t.Fatalf("expected the limit to be enforced, got %v", err)
+	}
+
+	now = now.Add(ResumeWindow)
+	if _, err := r.Authorize(ctx, token, "u1", "hunter2"); !errors.Is(err, ErrExhausted) {
+		t.Fatalf("expected resuming after the window to be refused, got %v", err)
+	}
+	if _, err := r.Revoke(ctx, "u1", link.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExpiryAndRevocation(t *testing.T) {
+	ctx := context.Background()
+	r := NewRegistry(NewMemoryStore())
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	if _, _, err := r.Create(ctx, Link{UploadID: "u1", ExpiresAt: now}, ""); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected links expiring now to be refused, got %v", err)
+	}
+
+	expiring, expiringToken, _ := r.Create(ctx, Link{UploadID: "u1", ExpiresAt: now.Add(time.Hour)}, "")
+	now = now.Add(time.Minute)
+	revoked, revokedToken, _ := r.Create(ctx, Link{UploadID: "u1", ExpiresAt: now.Add(2 * time.Hour)}, "")
+
+	if _, err := r.Revoke(ctx, "u2", revoked.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected links of other uploads to be hidden, got %v", err)
+	}
+	if _, err := r.Revoke(ctx, "u1", revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Redeem(ctx, revokedToken, "u1", ""); !errors.Is(err, ErrRevoked) {
+		t.Fatalf("expected revoked links to be refused, got %v", err)
+	}
+
+	now = now.Add(time.Hour)
+	if _, err := r.Redeem(ctx, expiringToken, "u1", ""); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expected expired links to be refused, got %v", err)
+	}
+
+	links, err := r.List(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 2 || links[0].ID != revoked.ID || links[1].ID != expiring.ID {
+		t.Fatalf("expected both links newest first, got %+v", links)
+	}
+
+	if err := r.Forget(ctx, "u1"); err != nil {
+		t.Fatal(err)
+	}
+	if links, _ := r.List(ctx, "u1"); len(links) != 0 {
+		t.Fatalf("expected links of forgotten uploads to be deleted, got %+v", links)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRegistry(store)
+
+	link, token, err := r.Create(ctx, Link{UploadID: "u1", ExpiresAt: time.Now().Add(time.Hour), MaxDownloads: 1}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Redeem(ctx, token, "u1", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new registry on the same directory sees the download
+	r = NewRegistry(store)
+	if _, err := r.Redeem(ctx, token, "u1", ""); !errors.Is(err, ErrExhausted) {
+		t.Fatalf("expected the download to be persisted, got %v", err)
+	}
+	if err := store.Delete(ctx, link.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, link.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected the link to be deleted, got %v", err)
+	}
+}
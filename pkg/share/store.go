@@ -0,0 +1,79 @@
+package share
+
+import (
+	"context"
+	"errors"
+
+	"github.com/devsnb/large-file-uploads/pkg/internal/jsonstore"
+)
+
+// MemoryStore keeps share links in memory. They are lost on restart.
+type MemoryStore struct {
+	links *jsonstore.Memory[Link]
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{links: jsonstore.NewMemory[Link](ErrNotFound)}
+}
+
+// Put inserts or replaces a share link
+func (s *MemoryStore) Put(ctx context.Context, link Link) error {
+	s.links.Put(link.ID, link)
+	return nil
+}
+
+// Get returns a share link by ID
+func (s *MemoryStore) Get(ctx context.Context, id string) (Link, error) {
+	return s.links.Get(id)
+}
+
+// List returns all share links
+func (s *MemoryStore) List(ctx context.Context) ([]Link, error) {
+	return s.links.List(), nil
+}
+
+// Delete removes a share link
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	if err := s.links.Delete(id); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// FileStore persists each share link as a JSON file in a directory
+type FileStore struct {
+	links *jsonstore.Dir[Link]
+}
+
+// NewFileStore creates a file store, creating the directory if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	links, err := jsonstore.NewDir[Link](dir, "share link", ErrNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{links: links}, nil
+}
+
+// Put inserts or replaces a share link
+func (s *FileStore) Put(ctx context.Context, link Link) error {
+	return s.links.Put(link.ID, link)
+}
+
+// Get returns a share link by ID
+func (s *FileStore) Get(ctx context.Context, id string) (Link, error) {
+	return s.links.Get(id)
+}
+
+// List returns all share links
+func (s *FileStore) List(ctx context.Context) ([]Link, error) {
+	return s.links.List()
+}
+
+// Delete removes a share link
+func (s *FileStore) Delete(ctx context.Context, id string) error {
+	if err := s.links.Delete(id); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package signing
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	signer := NewSigner("secret")
+	now := time.Unix(1000, 0)
+	signer.now = func() time.Time { return now }
+
+	token := signer.Sign("claim", "upload+123", now.Add(time.Minute))
+
+	subject, expiresAt, err := signer.Verify(token, "claim")
+	if err != nil {
+		t.Fatalf("Expected valid token, got %v", err)
+	}
+	if subject != "upload+123" {
+		t.Errorf("Expected subject 'upload+123', got %q", subject)
+	}
+	if !expiresAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("Unexpected expiry %v", expiresAt)
+	}
+
+	if _, _, err := signer.Verify(token, "download"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected token to be rejected for another scope, got %v", err)
+	}
+
+	if _, _, err := NewSigner("other").Verify(token, "claim"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected token to be rejected with another secret, got %v", err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, _, err := signer.Verify(token, "claim"); !errors.Is(err, ErrExpiredToken) {
+		t.Errorf("Expected expired token error, got %v", err)
+	}
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	signer := NewSigner("secret")
+	for _, token := range []string{"", "abc", "abc.def", "."} {
+		if _, _, err := signer.Verify(token, "claim"); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Expected %q to be invalid, got %v", token, err)
+		}
+	}
+}
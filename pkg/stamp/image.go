@@ -0,0 +1,165 @@
+package stamp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// maxImagePixels limits the images that are decoded to be stamped
+const maxImagePixels = 100 << 20
+
+// jpegQuality is the quality stamped JPEGs are encoded with
+const jpegQuality = 90
+
+// bandColor is the light band the text is drawn on, so it stays legible on
+// dark images
+var bandColor = color.NRGBA{R: 255, G: 255, B: 255, A: 180}
+
+// pngSignature starts every PNG file
+var pngSignature = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1A, '\n'}
+
+// pngKeyword is the keyword of the iTXt chunk carrying the stamp, one of
+// the keywords image viewers and exiftool show
+const pngKeyword = "Comment"
+
+// stampPNG draws the text onto a PNG and embeds it in an iTXt chunk
+func stampPNG(dst io.Writer, src io.ReaderAt, size int64, text string) error {
+	drawn, err := drawImageStamp(src, size, text, png.Decode, png.Encode)
+	if err != nil {
+		return err
+	}
+	return embedPNG(dst, bytes.NewReader(drawn), int64(len(drawn)), text)
+}
+
+// stampJPEG draws the text onto a JPEG and embeds it in a COM segment
+func stampJPEG(dst io.Writer, src io.ReaderAt, size int64, text string) error {
+	encode := func(w io.Writer, img image.Image) error {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+	}
+	drawn, err := drawImageStamp(src, size, text, jpeg.Decode, encode)
+	if err != nil {
+		return err
+	}
+	return embedJPEG(dst, bytes.NewReader(drawn), int64(len(drawn)), text)
+}
+
+// drawImageStamp decodes an image, draws the text on a light band along
+// its bottom edge and encodes the result. Glyph cells scale with the image,
+// and lines wrap to its width.
+func drawImageStamp(src io.ReaderAt, size int64, text string,
+	decode func(io.Reader) (image.Image, error), encode func(io.Writer, image.Image) error) ([]byte, error) {
+	// Check the dimensions before decoding allocates the pixels
+	config, _, err := image.DecodeConfig(io.NewSectionReader(src, 0, size))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, fmt.Errorf("%w: image of %dx%d pixels is too large", ErrUnsupported, config.Width, config.Height)
+	}
+	decoded, err := decode(io.NewSectionReader(src, 0, size))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+
+	bounds := decoded.Bounds()
+	img := image.NewNRGBA(bounds)
+	draw.Draw(img, bounds, decoded, bounds.Min, draw.Src)
+
+	cell := max(1, min(bounds.Dx(), bounds.Dy())/250)
+	block := layoutText(text, (bounds.Dx()/cell-1)/cellAdvance)
+	_, height := block.size()
+	top := bounds.Max.Y - height*cell
+	band := image.Rect(bounds.Min.X, top, bounds.Max.X, bounds.Max.Y)
+	draw.Draw(img, band, image.NewUniform(bandColor), image.Point{}, draw.Over)
+	for _, r := range block.runs() {
+		x, y := bounds.Min.X+r.x*cell, top+r.y*cell
+		draw.Draw(img, image.Rect(x, y, x+r.width*cell, y+cell), image.Black, image.Point{}, draw.Src)
+	}
+
+	var out bytes.Buffer
+	if err := encode(&out, img); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// embedPNG inserts an iTXt chunk right after the IHDR chunk, which the
+// PNG specification requires to come first
+func embedPNG(dst io.Writer, src io.ReaderAt, size int64, text string) error {
+	// Signature, then the IHDR chunk: length, type, 13 bytes of data, CRC
+	const headerSize = 8 + 4 + 4 + 13 + 4
+	header := make([]byte, headerSize)
+	if _, err := src.ReadAt(header, 0); err != nil {
+		return fmt.Errorf("%w: truncated PNG", ErrUnsupported)
+	}
+	if !bytes.HasPrefix(header, pngSignature) || string(header[12:16]) != "IHDR" || binary.BigEndian.Uint32(header[8:12]) != 13 {
+		return fmt.Errorf("%w: invalid PNG header", ErrUnsupported)
+	}
+
+	// Keyword, null separator, no compression, no language tag and no
+	// translated keyword, then the UTF-8 text
+	var data bytes.Buffer
+	data.WriteString(pngKeyword)
+	data.Write([]byte{0, 0, 0, 0, 0})
+	data.WriteString(text)
+
+	chunk := make([]byte, 0, 12+data.Len())
+	chunk = binary.BigEndian.AppendUint32(chunk, uint32(data.Len()))
+	chunk = append(chunk, "iTXt"...)
+	chunk = append(chunk, data.Bytes()...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	if _, err := dst.Write(header); err != nil {
+		return err
+	}
+	if _, err := dst.Write(chunk); err != nil {
+		return err
+	}
+	_, err := io.Copy(dst, io.NewSectionReader(src, headerSize, size-headerSize))
+	return err
+}
+
+// embedJPEG inserts a COM segment after the APPn segments following the
+// start of image marker, as JFIF and Exif readers expect theirs first
+func embedJPEG(dst io.Writer, src io.ReaderAt, size int64, text string) error {
+	offset := int64(2)
+	marker := make([]byte, 4)
+	for {
+		if _, err := src.ReadAt(marker, offset); err != nil {
+			return fmt.Errorf("%w: truncated JPEG", ErrUnsupported)
+		}
+		if marker[0] != 0xFF {
+			return fmt.Errorf("%w: invalid JPEG marker at offset %d", ErrUnsupported, offset)
+		}
+		if marker[1] < 0xE0 || marker[1] > 0xEF {
+			break
+		}
+		offset += 2 + int64(binary.BigEndian.Uint16(marker[2:]))
+	}
+
+	// The segment length includes its two length bytes
+	comment := []byte(text)
+	if len(comment) > 0xFFFF-2 {
+		comment = comment[:0xFFFF-2]
+	}
+	segment := []byte{0xFF, 0xFE}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(comment)+2))
+	segment = append(segment, comment...)
+
+	if _, err := io.Copy(dst, io.NewSectionReader(src, 0, offset)); err != nil {
+		return err
+	}
+	if _, err := dst.Write(segment); err != nil {
+		return err
+	}
+	_, err := io.Copy(dst, io.NewSectionReader(src, offset, size-offset))
+	return err
+}
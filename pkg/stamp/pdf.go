@@ -0,0 +1,292 @@
+package stamp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+)
+
+// pdfTailSize is how much of the end of a PDF is searched for the offset of
+// its last cross-reference section
+const pdfTailSize = 1 << 20
+
+// pdfCharsPerLine is roughly how many characters fit across a page, which
+// sets the size of the glyph cells
+const pdfCharsPerLine = 100
+
+var startXRefPattern = regexp.MustCompile(`startxref\s+(\d+)`)
+
+// defaultMediaBox is US Letter, for pages that don't set their size
+var defaultMediaBox = [4]float64{0, 0, 612, 792}
+
+// pdfPage is a page object and the area it displays
+type pdfPage struct {
+	ref      pdfRef
+	dict     pdfDict
+	mediaBox [4]float64
+}
+
+// stampPDF appends an incremental update to a PDF that draws the text on a
+// light band along the bottom of every page, and adds an object carrying
+// the text under the /Stamp key of the trailer. Glyphs are drawn as filled
+// rectangles, so no font is embedded, and the original content streams are
+// left as they are.
+func stampPDF(dst io.Writer, src io.ReaderAt, size int64, text string) error {
+	r, err := openPDF(src, size)
+	if err != nil {
+		return err
+	}
+	if _, ok := r.trailer["/Encrypt"]; ok {
+		return fmt.Errorf("%w: encrypted PDF", ErrUnsupported)
+	}
+	root, ok := r.trailer["/Root"].(pdfRef)
+	if !ok {
+		return fmt.Errorf("%w: PDF trailer lacks /Root", ErrUnsupported)
+	}
+	pages, err := r.pages(root)
+	if err != nil {
+		return err
+	}
+
+	next := int64(0)
+	if n, ok := pdfNumber(r.trailer["/Size"]); ok {
+		next = int64(n)
+	}
+	for num := range r.xref {
+		next = max(next, num+1)
+	}
+	newObject := func() pdfRef {
+		next++
+		return pdfRef{num: next - 1}
+	}
+
+	// The first stream saves the graphics state, and each page's stamp
+	// restores it first, so whatever the page's own content leaves set
+	// doesn't affect the stamp
+	objects := map[pdfRef][]byte{}
+	save := newObject()
+	objects[save] = pdfStream("q\n")
+	for _, page := range pages {
+		stamp := newObject()
+		objects[stamp] = pdfStream(pdfStampContent(page.mediaBox, text))
+
+		contents := pdfArray{save}
+		existing, err := r.resolve(page.dict["/Contents"])
+		if err != nil {
+			return err
+		}
+		if array, ok := existing.(pdfArray); ok {
+			contents = append(contents, array...)
+		} else if existing != nil {
+			contents = append(contents, page.dict["/Contents"])
+		}
+		contents = append(contents, stamp)
+
+		dict := pdfDict{}
+		for key, v := range page.dict {
+			dict[key] = v
+		}
+		dict["/Contents"] = contents
+		var b bytes.Buffer
+		writePDFValue(&b, dict)
+		objects[page.ref] = b.Bytes()
+	}
+	info := newObject()
+	objects[info] = fmt.Appendf(nil, "<< /Type /Stamp /Text %s >>", pdfText(text))
+
+	if _, err := io.Copy(dst, io.NewSectionReader(src, 0, size)); err != nil {
+		return err
+	}
+
+	var update bytes.Buffer
+	last := make([]byte, 1)
+	if _, err := src.ReadAt(last, size-1); err == nil && last[0] != '\n' && last[0] != '\r' {
+		update.WriteByte('\n')
+	}
+	refs := make([]pdfRef, 0, len(objects))
+	for ref := range objects {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].num < refs[j].num })
+	offsets := make([]int64, len(refs))
+	for i, ref := range refs {
+		offsets[i] = size + int64(update.Len())
+		fmt.Fprintf(&update, "%d %d obj\n%s\nendobj\n", ref.num, ref.gen, objects[ref])
+	}
+
+	// Each run of consecutive object numbers is a subsection of the table
+	xref := size + int64(update.Len())
+	update.WriteString("xref\n")
+	for start := 0; start < len(refs); {
+		end := start + 1
+		for end < len(refs) && refs[end].num == refs[end-1].num+1 {
+			end++
+		}
+		fmt.Fprintf(&update, "%d %d\n", refs[start].num, end-start)
+		for i := start; i < end; i++ {
+			fmt.Fprintf(&update, "%010d %05d n \n", offsets[i], refs[i].gen)
+		}
+		start = end
+	}
+
+	fmt.Fprintf(&update, "trailer\n<< /Size %d /Root ", next)
+	writePDFValue(&update, root)
+	for _, key := range []pdfName{"/Info", "/ID"} {
+		if v, ok := r.trailer[key]; ok {
+			fmt.Fprintf(&update, " %s ", key)
+			writePDFValue(&update, v)
+		}
+	}
+	fmt.Fprintf(&update, " /Prev %d /Stamp %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", r.start, info.num, xref)
+
+	_, err = dst.Write(update.Bytes())
+	return err
+}
+
+// openPDF checks the header of a PDF and reads its cross-reference
+// sections, starting from the one startxref points at
+func openPDF(src io.ReaderAt, size int64) (*pdfReader, error) {
+	header := make([]byte, 5)
+	if _, err := src.ReadAt(header, 0); err != nil || string(header) != "%PDF-" {
+		return nil, fmt.Errorf("%w: invalid PDF header", ErrUnsupported)
+	}
+
+	start := max(size-pdfTailSize, 0)
+	tail := make([]byte, size-start)
+	if _, err := src.ReadAt(tail, start); err != nil && err != io.EOF {
+		return nil, err
+	}
+	matches := startXRefPattern.FindAllSubmatch(tail, -1)
+	if matches == nil {
+		return nil, fmt.Errorf("%w: PDF lacks startxref", ErrUnsupported)
+	}
+	offset, err := strconv.ParseInt(string(matches[len(matches)-1][1]), 10, 64)
+	if err != nil || offset >= size {
+		return nil, fmt.Errorf("%w: invalid PDF startxref", ErrUnsupported)
+	}
+
+	r, err := newPDFReader(src, size, offset)
+	if err != nil {
+		return nil, err
+	}
+	if r.trailer == nil {
+		return nil, fmt.Errorf("%w: PDF lacks a trailer", ErrUnsupported)
+	}
+	r.start = offset
+	return r, nil
+}
+
+// pages walks the page tree from the catalog, returning the pages in order
+// with the media box they set or inherit
+func (r *pdfReader) pages(root pdfRef) ([]pdfPage, error) {
+	catalog, err := r.resolve(root)
+	if err != nil {
+		return nil, err
+	}
+	catalogDict, ok := catalog.(pdfDict)
+	if !ok {
+		return nil, fmt.Errorf("%w: PDF catalog is not a dictionary", ErrUnsupported)
+	}
+	tree, ok := catalogDict["/Pages"].(pdfRef)
+	if !ok {
+		return nil, fmt.Errorf("%w: PDF catalog lacks /Pages", ErrUnsupported)
+	}
+
+	var pages []pdfPage
+	visited := map[pdfRef]bool{}
+	var walk func(ref pdfRef, mediaBox [4]float64, depth int) error
+	walk = func(ref pdfRef, mediaBox [4]float64, depth int) error {
+		if visited[ref] || depth > pdfMaxDepth || len(pages) >= pdfMaxPages {
+			return fmt.Errorf("%w: invalid or oversized PDF page tree", ErrUnsupported)
+		}
+		visited[ref] = true
+		v, err := r.object(ref.num)
+		if err != nil {
+			return err
+		}
+		node, ok := v.(pdfDict)
+		if !ok {
+			return fmt.Errorf("%w: PDF page %d is not a dictionary", ErrUnsupported, ref.num)
+		}
+		if box, err := r.resolve(node["/MediaBox"]); err == nil {
+			if array, ok := box.(pdfArray); ok && len(array) == 4 {
+				for i, corner := range array {
+					mediaBox[i], _ = pdfNumber(corner)
+				}
+			}
+		}
+
+		if node["/Type"] != pdfName("/Pages") {
+			pages = append(pages, pdfPage{ref: ref, dict: node, mediaBox: mediaBox})
+			return nil
+		}
+		kids, err := r.resolve(node["/Kids"])
+		if err != nil {
+			return err
+		}
+		list, _ := kids.(pdfArray)
+		for _, kid := range list {
+			kidRef, ok := kid.(pdfRef)
+			if !ok {
+				return fmt.Errorf("%w: PDF page is not an indirect object", ErrUnsupported)
+			}
+			if err := walk(kidRef, mediaBox, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(tree, defaultMediaBox, 0); err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+// pdfStampContent returns the content stream drawing the text on a page.
+// The band is opaque, as transparency would need an extended graphics
+// state in the page's resources.
+func pdfStampContent(mediaBox [4]float64, text string) string {
+	left, bottom := min(mediaBox[0], mediaBox[2]), min(mediaBox[1], mediaBox[3])
+	width := max(mediaBox[2], mediaBox[0]) - left
+	cell := min(max(width/(pdfCharsPerLine*cellAdvance), 0.6), 3)
+	block := layoutText(text, int((width/cell-1)/cellAdvance))
+	_, height := block.size()
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Q q 0.93 g %s %s %s %s re f 0 g\n",
+		pdfFloat(left), pdfFloat(bottom), pdfFloat(width), pdfFloat(float64(height)*cell))
+	for _, run := range block.runs() {
+		// PDF coordinates grow upwards, runs count rows from the top
+		y := bottom + float64(height-run.y-1)*cell
+		fmt.Fprintf(&b, "%s %s %s %s re\n",
+			pdfFloat(left+float64(run.x)*cell), pdfFloat(y), pdfFloat(float64(run.width)*cell), pdfFloat(cell))
+	}
+	b.WriteString("f Q\n")
+	return b.String()
+}
+
+// pdfStream returns an uncompressed stream object holding content
+func pdfStream(content string) []byte {
+	return fmt.Appendf(nil, "<< /Length %d >>\nstream\n%s\nendstream", len(content), content)
+}
+
+// pdfFloat formats a coordinate with at most three decimals
+func pdfFloat(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1000)/1000, 'f', -1, 64)
+}
+
+// pdfText encodes text as a PDF text string: UTF-16BE with a byte order
+// mark, written in hex so no character needs escaping
+func pdfText(text string) string {
+	encoded := []byte{0xFE, 0xFF}
+	for _, unit := range utf16.Encode([]rune(text)) {
+		encoded = append(encoded, byte(unit>>8), byte(unit))
+	}
+	return "<" + hex.EncodeToString(encoded) + ">"
+}
@@ -0,0 +1,699 @@
+package stamp
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// Limits of what is read from a PDF to stamp it
+const (
+	pdfWindowSize = 64 << 10 // bytes read to parse an object or xref section
+	pdfStreamSize = 16 << 20 // decoded size of a stream
+	pdfMaxPages   = 10000
+	pdfMaxDepth   = 32 // page tree levels and nested values
+)
+
+// pdfRef is an indirect reference to an object
+type pdfRef struct {
+	num, gen int64
+}
+
+// pdfName is a name, including its slash
+type pdfName string
+
+// pdfRaw is a token written back as it was read: a number, string,
+// boolean or null
+type pdfRaw string
+
+type (
+	pdfDict  map[pdfName]any
+	pdfArray []any
+)
+
+// pdfLexer parses PDF values from a buffer
+type pdfLexer struct {
+	data  []byte
+	pos   int
+	depth int
+
+	// offsets locates the objects of a decoded object stream
+	offsets []int
+}
+
+func isPDFSpace(b byte) bool {
+	return b == 0 || b == '\t' || b == '\n' || b == '\f' || b == '\r' || b == ' '
+}
+
+func isPDFDelimiter(b byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), b) >= 0
+}
+
+// skip moves past whitespace and comments
+func (l *pdfLexer) skip() {
+	for l.pos < len(l.data) {
+		switch b := l.data[l.pos]; {
+		case isPDFSpace(b):
+			l.pos++
+		case b == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// token returns the next run of regular characters, such as a number or a
+// keyword
+func (l *pdfLexer) token() string {
+	l.skip()
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+// integer returns the next token as an integer
+func (l *pdfLexer) integer() (int64, error) {
+	token := l.token()
+	n, err := strconv.ParseInt(token, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: expected an integer in PDF, got %q", ErrUnsupported, token)
+	}
+	return n, nil
+}
+
+// keyword consumes the next token, which must be keyword
+func (l *pdfLexer) keyword(keyword string) error {
+	if token := l.token(); token != keyword {
+		return fmt.Errorf("%w: expected %s in PDF, got %q", ErrUnsupported, keyword, token)
+	}
+	return nil
+}
+
+// value parses the next value
+func (l *pdfLexer) value() (any, error) {
+	l.skip()
+	if l.pos >= len(l.data) {
+		return nil, fmt.Errorf("%w: truncated PDF object", ErrUnsupported)
+	}
+	if l.depth++; l.depth > pdfMaxDepth {
+		return nil, fmt.Errorf("%w: PDF values nested too deeply", ErrUnsupported)
+	}
+	defer func() { l.depth-- }()
+
+	start := l.pos
+	switch {
+	case l.data[l.pos] == '/':
+		l.pos++
+		l.token()
+		return pdfName(l.data[start:l.pos]), nil
+	case l.data[l.pos] == '(':
+		return l.literalString()
+	case bytes.HasPrefix(l.data[l.pos:], []byte("<<")):
+		return l.dict()
+	case l.data[l.pos] == '<':
+		end := bytes.IndexByte(l.data[l.pos:], '>')
+		if end < 0 {
+			return nil, fmt.Errorf("%w: truncated PDF string", ErrUnsupported)
+		}
+		l.pos += end + 1
+		return pdfRaw(l.data[start:l.pos]), nil
+	case l.data[l.pos] == '[':
+		l.pos++
+		var array pdfArray
+		for {
+			l.skip()
+			if l.pos < len(l.data) && l.data[l.pos] == ']' {
+				l.pos++
+				return array, nil
+			}
+			v, err := l.value()
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, v)
+		}
+	}
+
+	token := l.token()
+	if token == "" {
+		return nil, fmt.Errorf("%w: unexpected %q in PDF", ErrUnsupported, l.data[l.pos])
+	}
+	num, err := strconv.ParseInt(token, 10, 64)
+	if err != nil {
+		return pdfRaw(token), nil
+	}
+
+	// Two integers followed by R are a reference
+	after := l.pos
+	if gen, err := l.integer(); err == nil && l.token() == "R" {
+		return pdfRef{num, gen}, nil
+	}
+	l.pos = after
+	return pdfRaw(token), nil
+}
+
+// literalString parses a string in parentheses, which may hold balanced
+// or escaped parentheses
+func (l *pdfLexer) literalString() (any, error) {
+	start, depth := l.pos, 0
+	for ; l.pos < len(l.data); l.pos++ {
+		switch l.data[l.pos] {
+		case '\\':
+			l.pos++
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				l.pos++
+				return pdfRaw(l.data[start:l.pos]), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: truncated PDF string", ErrUnsupported)
+}
+
+// dict parses a dictionary
+func (l *pdfLexer) dict() (any, error) {
+	l.pos += 2
+	dict := pdfDict{}
+	for {
+		l.skip()
+		if bytes.HasPrefix(l.data[l.pos:], []byte(">>")) {
+			l.pos += 2
+			return dict, nil
+		}
+		key, err := l.value()
+		if err != nil {
+			return nil, err
+		}
+		name, ok := key.(pdfName)
+		if !ok {
+			return nil, fmt.Errorf("%w: PDF dictionary key is not a name", ErrUnsupported)
+		}
+		v, err := l.value()
+		if err != nil {
+			return nil, err
+		}
+		dict[name] = v
+	}
+}
+
+// writePDFValue writes a value in PDF syntax. Dictionary keys are sorted.
+func writePDFValue(b *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case pdfName:
+		b.WriteString(string(v))
+	case pdfRaw:
+		b.WriteString(string(v))
+	case pdfRef:
+		fmt.Fprintf(b, "%d %d R", v.num, v.gen)
+	case pdfArray:
+		b.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			writePDFValue(b, item)
+		}
+		b.WriteByte(']')
+	case pdfDict:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, string(key))
+		}
+		sort.Strings(keys)
+		b.WriteString("<<")
+		for _, key := range keys {
+			b.WriteString(" " + key + " ")
+			writePDFValue(b, v[pdfName(key)])
+		}
+		b.WriteString(" >>")
+	}
+}
+
+// pdfNumber returns a value as a number
+func pdfNumber(v any) (float64, bool) {
+	raw, ok := v.(pdfRaw)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(string(raw), 64)
+	return n, err == nil
+}
+
+// xrefEntry locates an object: at an offset, or inside an object stream
+type xrefEntry struct {
+	offset     int64
+	gen        int64
+	stream     int64
+	index      int
+	compressed bool
+	free       bool
+}
+
+// pdfReader reads the objects of a PDF through its cross-reference
+// sections
+type pdfReader struct {
+	src     io.ReaderAt
+	size    int64
+	xref    map[int64]xrefEntry
+	streams map[int64]*pdfLexer // decoded object streams
+	trailer pdfDict
+	start   int64 // offset of the last cross-reference section
+}
+
+// newPDFReader reads the cross-reference sections of a PDF, starting from
+// the last one
+func newPDFReader(src io.ReaderAt, size int64, start int64) (*pdfReader, error) {
+	r := &pdfReader{src: src, size: size, xref: map[int64]xrefEntry{}, streams: map[int64]*pdfLexer{}}
+	visited := map[int64]bool{}
+	pending := []int64{start}
+	for len(pending) > 0 {
+		offset := pending[0]
+		pending = pending[1:]
+		if visited[offset] || offset < 0 || offset >= size {
+			continue
+		}
+		visited[offset] = true
+
+		trailer, err := r.readXRef(offset)
+		if err != nil {
+			return nil, err
+		}
+		if r.trailer == nil {
+			r.trailer = trailer
+		}
+		// Hybrid files list objects in a stream besides the table
+		if stream, ok := pdfNumber(trailer["/XRefStm"]); ok {
+			pending = append([]int64{int64(stream)}, pending...)
+		}
+		if prev, ok := pdfNumber(trailer["/Prev"]); ok {
+			pending = append(pending, int64(prev))
+		}
+	}
+	return r, nil
+}
+
+// window returns a lexer over the bytes from offset on
+func (r *pdfReader) window(offset int64, length int64) (*pdfLexer, error) {
+	data := make([]byte, min(length, r.size-offset))
+	if _, err := r.src.ReadAt(data, offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return &pdfLexer{data: data}, nil
+}
+
+// add records an entry unless a newer section already listed the object
+func (r *pdfReader) add(num int64, entry xrefEntry) {
+	if _, ok := r.xref[num]; !ok {
+		r.xref[num] = entry
+	}
+}
+
+// readXRef reads the cross-reference section at offset, a classic table or
+// a stream, and returns its trailer
+func (r *pdfReader) readXRef(offset int64) (pdfDict, error) {
+	l, err := r.window(offset, pdfWindowSize)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(l.data, []byte("xref")) {
+		return r.readXRefStream(offset)
+	}
+
+	l.pos = len("xref")
+	for {
+		after := l.pos
+		if l.token() == "trailer" {
+			break
+		}
+		l.pos = after
+		first, err := l.integer()
+		if err != nil {
+			return nil, err
+		}
+		count, err := l.integer()
+		if err != nil || count < 0 || count > 1<<24 {
+			return nil, fmt.Errorf("%w: invalid PDF xref subsection", ErrUnsupported)
+		}
+		l.skip()
+
+		// Entries are 20 bytes each: offset, generation and type
+		start := offset + int64(l.pos)
+		entries := make([]byte, 20*count)
+		if _, err := r.src.ReadAt(entries, start); err != nil {
+			return nil, fmt.Errorf("%w: truncated PDF xref table", ErrUnsupported)
+		}
+		for i := range count {
+			entry := entries[20*i : 20*i+20]
+			at, err1 := strconv.ParseInt(string(entry[0:10]), 10, 64)
+			gen, err2 := strconv.ParseInt(string(entry[11:16]), 10, 64)
+			if err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("%w: invalid PDF xref entry", ErrUnsupported)
+			}
+			r.add(first+i, xrefEntry{offset: at, gen: gen, free: entry[17] != 'n'})
+		}
+
+		offset = start + 20*count
+		if l, err = r.window(offset, pdfWindowSize); err != nil {
+			return nil, err
+		}
+	}
+
+	v, err := l.value()
+	if err != nil {
+		return nil, err
+	}
+	trailer, ok := v.(pdfDict)
+	if !ok {
+		return nil, fmt.Errorf("%w: PDF trailer is not a dictionary", ErrUnsupported)
+	}
+	return trailer, nil
+}
+
+// readXRefStream reads a cross-reference stream, whose dictionary is the
+// trailer
+func (r *pdfReader) readXRefStream(offset int64) (pdfDict, error) {
+	_, v, data, err := r.readObjectAt(offset)
+	if err != nil {
+		return nil, err
+	}
+	dict, _ := v.(pdfDict)
+	if dict == nil || dict["/Type"] != pdfName("/XRef") || data == nil {
+		return nil, fmt.Errorf("%w: PDF cross-reference section not found", ErrUnsupported)
+	}
+	decoded, err := r.decodeStream(dict, data)
+	if err != nil {
+		return nil, err
+	}
+
+	widths, _ := dict["/W"].(pdfArray)
+	if len(widths) != 3 {
+		return nil, fmt.Errorf("%w: invalid PDF xref stream widths", ErrUnsupported)
+	}
+	var w [3]int
+	for i, width := range widths {
+		n, ok := pdfNumber(width)
+		if !ok || n < 0 || n > 8 {
+			return nil, fmt.Errorf("%w: invalid PDF xref stream widths", ErrUnsupported)
+		}
+		w[i] = int(n)
+	}
+	index, _ := dict["/Index"].(pdfArray)
+	if index == nil {
+		index = pdfArray{pdfRaw("0"), dict["/Size"]}
+	}
+
+	field := func(row []byte, width int) int64 {
+		var n int64
+		for _, b := range row[:width] {
+			n = n<<8 | int64(b)
+		}
+		return n
+	}
+	rowSize := w[0] + w[1] + w[2]
+	pos := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		first, ok1 := pdfNumber(index[i])
+		count, ok2 := pdfNumber(index[i+1])
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("%w: invalid PDF xref stream index", ErrUnsupported)
+		}
+		for j := range int64(count) {
+			if pos+rowSize > len(decoded) {
+				return nil, fmt.Errorf("%w: truncated PDF xref stream", ErrUnsupported)
+			}
+			row := decoded[pos : pos+rowSize]
+			pos += rowSize
+			kind := int64(1)
+			if w[0] > 0 {
+				kind = field(row, w[0])
+			}
+			second, third := field(row[w[0]:], w[1]), field(row[w[0]+w[1]:], w[2])
+			switch kind {
+			case 1:
+				r.add(int64(first)+j, xrefEntry{offset: second, gen: third})
+			case 2:
+				r.add(int64(first)+j, xrefEntry{stream: second, index: int(third), compressed: true})
+			default:
+				r.add(int64(first)+j, xrefEntry{free: true})
+			}
+		}
+	}
+	return dict, nil
+}
+
+// readObjectAt reads the object at offset, returning its number, its value
+// and the raw data of its stream, if it is one
+func (r *pdfReader) readObjectAt(offset int64) (int64, any, []byte, error) {
+	l, err := r.window(offset, pdfWindowSize)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	num, err := l.integer()
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	if _, err := l.integer(); err != nil {
+		return 0, nil, nil, err
+	}
+	if err := l.keyword("obj"); err != nil {
+		return 0, nil, nil, err
+	}
+	v, err := l.value()
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	dict, ok := v.(pdfDict)
+	after := l.pos
+	if !ok || l.token() != "stream" {
+		l.pos = after
+		return num, v, nil, nil
+	}
+	if bytes.HasPrefix(l.data[l.pos:], []byte("\r\n")) {
+		l.pos += 2
+	} else if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+		l.pos++
+	}
+	length, err := r.resolve(dict["/Length"])
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	n, ok := pdfNumber(length)
+	start := offset + int64(l.pos)
+	if !ok || n < 0 || start+int64(n) > r.size {
+		return 0, nil, nil, fmt.Errorf("%w: invalid PDF stream length", ErrUnsupported)
+	}
+	data := make([]byte, int64(n))
+	if _, err := r.src.ReadAt(data, start); err != nil && err != io.EOF {
+		return 0, nil, nil, err
+	}
+	return num, v, data, nil
+}
+
+// decodeStream decodes the data of a stream. Only Flate compression, with
+// or without PNG predictors, is supported.
+func (r *pdfReader) decodeStream(dict pdfDict, data []byte) ([]byte, error) {
+	filter, err := r.resolve(dict["/Filter"])
+	if err != nil {
+		return nil, err
+	}
+	if filters, ok := filter.(pdfArray); ok && len(filters) == 1 {
+		filter = filters[0]
+	}
+	switch filter {
+	case nil:
+		return data, nil
+	case pdfName("/FlateDecode"):
+	default:
+		return nil, fmt.Errorf("%w: unsupported PDF stream filter", ErrUnsupported)
+	}
+
+	z, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	decoded, err := io.ReadAll(io.LimitReader(z, pdfStreamSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	if len(decoded) > pdfStreamSize {
+		return nil, fmt.Errorf("%w: PDF stream too large", ErrUnsupported)
+	}
+
+	params, _ := r.resolve(dict["/DecodeParms"])
+	if list, ok := params.(pdfArray); ok && len(list) == 1 {
+		params, _ = r.resolve(list[0])
+	}
+	paramDict, _ := params.(pdfDict)
+	predictor, _ := pdfNumber(paramDict["/Predictor"])
+	if predictor < 10 {
+		if predictor > 1 {
+			return nil, fmt.Errorf("%w: unsupported PDF predictor", ErrUnsupported)
+		}
+		return decoded, nil
+	}
+	columns := 1.0
+	if n, ok := pdfNumber(paramDict["/Columns"]); ok {
+		columns = n
+	}
+	return unpredictPNG(decoded, int(columns))
+}
+
+// unpredictPNG reverses the PNG row filters of a stream with one byte per
+// column, as cross-reference streams use
+func unpredictPNG(data []byte, columns int) ([]byte, error) {
+	if columns <= 0 {
+		return nil, fmt.Errorf("%w: invalid PDF predictor columns", ErrUnsupported)
+	}
+	stride := columns + 1
+	out := make([]byte, 0, len(data)/stride*columns)
+	prev := make([]byte, columns)
+	for i := 0; i+stride <= len(data); i += stride {
+		row := append([]byte(nil), data[i+1:i+stride]...)
+		for j := range row {
+			var left, upLeft byte
+			if j > 0 {
+				left, upLeft = row[j-1], prev[j-1]
+			}
+			switch data[i] {
+			case 0:
+			case 1:
+				row[j] += left
+			case 2:
+				row[j] += prev[j]
+			case 3:
+				row[j] += byte((int(left) + int(prev[j])) / 2)
+			case 4:
+				row[j] += paeth(left, prev[j], upLeft)
+			default:
+				return nil, fmt.Errorf("%w: invalid PNG predictor", ErrUnsupported)
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+// paeth is the PNG Paeth predictor
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	default:
+		return c
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// object returns the value of an object
+func (r *pdfReader) object(num int64) (any, error) {
+	entry, ok := r.xref[num]
+	if !ok || entry.free {
+		return nil, nil
+	}
+	if !entry.compressed {
+		found, v, _, err := r.readObjectAt(entry.offset)
+		if err != nil {
+			return nil, err
+		}
+		if found != num {
+			return nil, fmt.Errorf("%w: PDF xref entry of object %d points at object %d", ErrUnsupported, num, found)
+		}
+		return v, nil
+	}
+
+	l, err := r.objectStream(entry.stream)
+	if err != nil {
+		return nil, err
+	}
+	return l.objectAt(entry.index)
+}
+
+// objectStream returns a lexer over a decoded object stream
+func (r *pdfReader) objectStream(num int64) (*pdfLexer, error) {
+	if l, ok := r.streams[num]; ok {
+		return l, nil
+	}
+	entry, ok := r.xref[num]
+	if !ok || entry.free || entry.compressed {
+		return nil, fmt.Errorf("%w: PDF object stream %d not found", ErrUnsupported, num)
+	}
+	_, v, data, err := r.readObjectAt(entry.offset)
+	if err != nil {
+		return nil, err
+	}
+	dict, _ := v.(pdfDict)
+	if dict["/Type"] != pdfName("/ObjStm") || data == nil {
+		return nil, fmt.Errorf("%w: PDF object %d is not an object stream", ErrUnsupported, num)
+	}
+	decoded, err := r.decodeStream(dict, data)
+	if err != nil {
+		return nil, err
+	}
+	first, ok1 := pdfNumber(dict["/First"])
+	count, ok2 := pdfNumber(dict["/N"])
+	if !ok1 || !ok2 || int(first) > len(decoded) {
+		return nil, fmt.Errorf("%w: invalid PDF object stream", ErrUnsupported)
+	}
+
+	l := &pdfLexer{data: decoded}
+	offsets := make([]int, int(count))
+	for i := range offsets {
+		if _, err := l.integer(); err != nil {
+			return nil, err
+		}
+		offset, err := l.integer()
+		if err != nil {
+			return nil, err
+		}
+		offsets[i] = int(first) + int(offset)
+	}
+	l.offsets = offsets
+	r.streams[num] = l
+	return l, nil
+}
+
+// objectAt parses the object at index in a decoded object stream
+func (l *pdfLexer) objectAt(index int) (any, error) {
+	if index < 0 || index >= len(l.offsets) || l.offsets[index] > len(l.data) {
+		return nil, fmt.Errorf("%w: invalid PDF object stream index", ErrUnsupported)
+	}
+	l.pos = l.offsets[index]
+	return l.value()
+}
+
+// resolve follows references to the value they point at
+func (r *pdfReader) resolve(v any) (any, error) {
+	for range pdfMaxDepth {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v, nil
+		}
+		var err error
+		if v, err = r.object(ref.num); err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("%w: PDF references nested too deeply", ErrUnsupported)
+}
@@ -0,0 +1,154 @@
+// Package stamp draws identifying text, such as the user and tenant a
+// download was served to, on PDF, PNG and JPEG files and embeds it in their
+// metadata, so leaked copies of licensed content can be traced back to
+// their recipient
+package stamp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Formats files can be stamped in
+const (
+	PDF  Format = "pdf"
+	PNG  Format = "png"
+	JPEG Format = "jpeg"
+)
+
+// MaxTextLength limits the stamp text in bytes
+const MaxTextLength = 1024
+
+// DefaultTemplate is the stamp text unless configured
+const DefaultTemplate = "Licensed to {{.User}}{{if .Tenant}} ({{.Tenant}}){{end}} on {{.Time}}, upload {{.UploadID}}"
+
+// ErrUnsupported is returned for files that can't be stamped, e.g.
+// encrypted PDFs
+var ErrUnsupported = errors.New("file can't be stamped")
+
+// Format is the type of a file that can be stamped
+type Format string
+
+// ContentType returns the MIME type of the format
+func (f Format) ContentType() string {
+	switch f {
+	case PDF:
+		return "application/pdf"
+	case PNG:
+		return "image/png"
+	case JPEG:
+		return "image/jpeg"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// Stamper writes a copy of a file with text drawn on or embedded in it
+type Stamper interface {
+	Stamp(dst io.Writer, src io.ReaderAt, size int64, text string) error
+}
+
+// StamperFunc adapts a function to the Stamper interface
+type StamperFunc func(dst io.Writer, src io.ReaderAt, size int64, text string) error
+
+// Stamp calls f
+func (f StamperFunc) Stamp(dst io.Writer, src io.ReaderAt, size int64, text string) error {
+	return f(dst, src, size, text)
+}
+
+// Builtin returns the built-in stamper of a format. They draw the text on a
+// band along the bottom of the image or of every page, and embed it as
+// metadata: an iTXt chunk in PNGs, a COM segment in JPEGs and the trailer
+// of an incremental update in PDFs.
+func Builtin(format Format) (Stamper, bool) {
+	switch format {
+	case PDF:
+		return StamperFunc(stampPDF), true
+	case PNG:
+		return StamperFunc(stampPNG), true
+	case JPEG:
+		return StamperFunc(stampJPEG), true
+	default:
+		return nil, false
+	}
+}
+
+// ParseFormat converts a configured format name, accepting jpg for JPEG
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case PDF, PNG, JPEG:
+		return f, nil
+	case "jpg":
+		return JPEG, nil
+	default:
+		return "", fmt.Errorf("unknown stamp format %q, expected %q, %q or %q", name, PDF, PNG, JPEG)
+	}
+}
+
+// Detect returns the format of a file from its first bytes
+func Detect(header []byte) (Format, bool) {
+	switch {
+	case bytes.HasPrefix(header, []byte("%PDF-")):
+		return PDF, true
+	case bytes.HasPrefix(header, pngSignature):
+		return PNG, true
+	case bytes.HasPrefix(header, []byte{0xFF, 0xD8, 0xFF}):
+		return JPEG, true
+	default:
+		return "", false
+	}
+}
+
+// Fields are the values a stamp template can use
+type Fields struct {
+	User     string // Username, or the user ID if the token has no name
+	UserID   string
+	Tenant   string
+	UploadID string
+	Filename string
+	Time     string // RFC 3339 time of the download
+}
+
+// Template renders the stamp text of a download
+type Template struct {
+	tmpl *template.Template
+}
+
+// NewTemplate parses a text/template, or DefaultTemplate if text is empty
+func NewTemplate(text string) (*Template, error) {
+	if text == "" {
+		text = DefaultTemplate
+	}
+	tmpl, err := template.New("stamp").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stamp template: %w", err)
+	}
+	return &Template{tmpl: tmpl}, nil
+}
+
+// Render returns the stamp text for the fields, with control characters
+// removed and cut to MaxTextLength
+func (t *Template) Render(fields Fields) (string, error) {
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, fields); err != nil {
+		return "", fmt.Errorf("failed to render stamp: %w", err)
+	}
+
+	text := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, b.String())
+	for len(text) > MaxTextLength {
+		_, size := utf8.DecodeLastRuneInString(text)
+		text = text[:len(text)-size]
+	}
+	return strings.TrimSpace(text), nil
+}
@@ -0,0 +1,276 @@
+package stamp
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// stamp runs the built-in stamper of a format on data
+func stamp(t *testing.T, format Format, data []byte, text string) ([]byte, error) {
+	t.Helper()
+	stamper, ok := Builtin(format)
+	if !ok {
+		t.Fatalf("no built-in stamper for %s", format)
+	}
+	var out bytes.Buffer
+	err := stamper.Stamp(&out, bytes.NewReader(data), int64(len(data)), text)
+	return out.Bytes(), err
+}
+
+func TestStampPNG(t *testing.T) {
+	var src bytes.Buffer
+	if err := png.Encode(&src, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := stamp(t, PNG, src.Bytes(), "Licensed to alice")
+	if err != nil {
+		t.Fatalf("Stamp: %v", err)
+	}
+	if !bytes.Contains(out, []byte("iTXtComment\x00\x00\x00\x00\x00Licensed to alice")) {
+		t.Error("stamped PNG lacks the iTXt chunk")
+	}
+	if _, err := png.Decode(bytes.NewReader(out)); err != nil {
+		t.Errorf("stamped PNG doesn't decode: %v", err)
+	}
+	if format, _ := Detect(out); format != PNG {
+		t.Errorf("Detect = %q, want png", format)
+	}
+}
+
+func TestStampPNGDrawsText(t *testing.T) {
+	var src bytes.Buffer
+	if err := png.Encode(&src, image.NewGray(image.Rect(0, 0, 300, 60))); err != nil {
+		t.Fatal(err)
+	}
+	out, err := stamp(t, PNG, src.Bytes(), "Licensed to alice")
+	if err != nil {
+		t.Fatalf("Stamp: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The black image gets a light band along its bottom with black glyphs
+	// on it, and stays black above
+	light, dark := 0, 0
+	for x := range 300 {
+		for y := 60 - lineAdvance; y < 60; y++ {
+			if r, _, _, _ := img.At(x, y).RGBA(); r > 0x8000 {
+				light++
+			} else {
+				dark++
+			}
+		}
+	}
+	if light == 0 || dark == 0 {
+		t.Errorf("expected text on a light band, got %d light and %d dark pixels", light, dark)
+	}
+	if r, _, _, _ := img.At(0, 60-lineAdvance-1).RGBA(); r != 0 {
+		t.Error("expected the image above the band untouched")
+	}
+}
+
+func TestStampJPEG(t *testing.T) {
+	var src bytes.Buffer
+	if err := jpeg.Encode(&src, image.NewGray(image.Rect(0, 0, 4, 4)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := stamp(t, JPEG, src.Bytes(), "Licensed to alice")
+	if err != nil {
+		t.Fatalf("Stamp: %v", err)
+	}
+	if !bytes.Contains(out, []byte("\xFF\xFE\x00\x13Licensed to alice")) {
+		t.Error("stamped JPEG lacks the COM segment")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+		t.Errorf("stamped JPEG doesn't decode: %v", err)
+	}
+}
+
+// minimalPDF returns a one-page PDF with a classic cross-reference table
+func minimalPDF() []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>",
+	}
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R /ID [<01><02>] >>\nstartxref\n%d\n%%%%EOF", len(objects)+1, xref)
+	return b.Bytes()
+}
+
+// xrefStreamPDF returns a one-page A4 PDF whose page tree is in a
+// compressed object stream, listed by a cross-reference stream with a PNG
+// predictor
+func xrefStreamPDF(t *testing.T) []byte {
+	t.Helper()
+	pages := "<< /Type /Pages /Kids [3 0 R] /Count 1 /MediaBox [0 0 595 842] >>"
+	page := "<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>"
+	objects := fmt.Sprintf("2 0 3 %d ", len(pages)+1)
+	var packed bytes.Buffer
+	z := zlib.NewWriter(&packed)
+	z.Write([]byte(objects + pages + " " + page))
+	z.Close()
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.5\n")
+	offsets := map[int]int{}
+	offsets[1] = b.Len()
+	b.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	offsets[4] = b.Len()
+	b.WriteString("4 0 obj\n<< /Length 12 >>\nstream\n0 0 10 10 re\nendstream\nendobj\n")
+	offsets[5] = b.Len()
+	fmt.Fprintf(&b, "5 0 obj\n<< /Type /ObjStm /N 2 /First %d /Filter /FlateDecode /Length %d >>\nstream\n", len(objects), packed.Len())
+	b.Write(packed.Bytes())
+	b.WriteString("\nendstream\nendobj\n")
+	offsets[6] = b.Len()
+
+	// Rows of type, offset or stream and index or generation, each stored
+	// as its difference from the row above
+	rows := [][4]byte{{0, 0, 0, 0}, {1, 0, 0, 0}, {2, 0, 5, 0}, {2, 0, 5, 1}, {1, 0, 0, 0}, {1, 0, 0, 0}, {1, 0, 0, 0}}
+	for num, offset := range offsets {
+		rows[num][1], rows[num][2] = byte(offset>>8), byte(offset)
+	}
+	var table bytes.Buffer
+	z = zlib.NewWriter(&table)
+	prev := [4]byte{}
+	for _, row := range rows {
+		z.Write([]byte{2, row[0] - prev[0], row[1] - prev[1], row[2] - prev[2], row[3] - prev[3]})
+		prev = row
+	}
+	z.Close()
+	fmt.Fprintf(&b, "6 0 obj\n<< /Type /XRef /Size 7 /W [1 2 1] /Root 1 0 R /Filter /FlateDecode /DecodeParms << /Predictor 12 /Columns 4 >> /Length %d >>\nstream\n", table.Len())
+	b.Write(table.Bytes())
+	fmt.Fprintf(&b, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", offsets[6])
+	return b.Bytes()
+}
+
+// stampedPage stamps a PDF and returns the update, the reader of the
+// stamped file and the dictionary of its first page
+func stampedPage(t *testing.T, src []byte) (string, *pdfReader, pdfDict) {
+	t.Helper()
+	out, err := stamp(t, PDF, src, "Licensed to alice")
+	if err != nil {
+		t.Fatalf("Stamp: %v", err)
+	}
+	if !bytes.HasPrefix(out, src) {
+		t.Fatal("stamped PDF doesn't start with the original")
+	}
+
+	r, err := openPDF(bytes.NewReader(out), int64(len(out)))
+	if err != nil {
+		t.Fatalf("reading the stamped PDF: %v", err)
+	}
+	pages, err := r.pages(r.trailer["/Root"].(pdfRef))
+	if err != nil || len(pages) != 1 {
+		t.Fatalf("expected one page in the stamped PDF, got %d %v", len(pages), err)
+	}
+	return string(out[len(src):]), r, pages[0].dict
+}
+
+// streamData returns the data of a stream object
+func streamData(t *testing.T, r *pdfReader, ref any) string {
+	t.Helper()
+	_, _, data, err := r.readObjectAt(r.xref[ref.(pdfRef).num].offset)
+	if err != nil || data == nil {
+		t.Fatalf("expected object %v to be a stream, got %v", ref, err)
+	}
+	return string(data)
+}
+
+func TestStampPDF(t *testing.T) {
+	update, r, page := stampedPage(t, minimalPDF())
+	for _, want := range []string{"xref\n3 4\n", "/Size 7 /Root 1 0 R", "/ID [<01> <02>]", "/Stamp 6 0 R", pdfText("Licensed to alice")} {
+		if !strings.Contains(update, want) {
+			t.Errorf("update lacks %q:\n%s", want, update)
+		}
+	}
+	if _, ok := r.trailer["/Prev"]; !ok {
+		t.Error("stamped trailer lacks /Prev")
+	}
+
+	// The page without content gets the stream saving the graphics state
+	// and the stamp drawn on the full width of the page
+	contents, _ := page["/Contents"].(pdfArray)
+	if len(contents) != 2 {
+		t.Fatalf("expected the page contents to be two streams, got %v", page["/Contents"])
+	}
+	if data := streamData(t, r, contents[0]); data != "q\n" {
+		t.Errorf("expected the first stream to save the graphics state, got %q", data)
+	}
+	drawn := streamData(t, r, contents[1])
+	if !strings.HasPrefix(drawn, "Q q 0.93 g 0 0 612 ") || strings.Count(drawn, " re\n") < 20 {
+		t.Errorf("expected the stamp to draw a band and glyphs, got %q", drawn)
+	}
+	stampInfo, err := r.resolve(r.trailer["/Stamp"])
+	if err != nil || stampInfo.(pdfDict)["/Text"] != pdfRaw(pdfText("Licensed to alice")) {
+		t.Errorf("expected the stamp object to carry the text, got %v %v", stampInfo, err)
+	}
+}
+
+func TestStampPDFWithXRefStream(t *testing.T) {
+	_, r, page := stampedPage(t, xrefStreamPDF(t))
+
+	// The original content stays between the two added streams
+	contents, _ := page["/Contents"].(pdfArray)
+	if len(contents) != 3 || contents[1] != (pdfRef{4, 0}) {
+		t.Fatalf("expected the original contents wrapped by the stamp, got %v", page["/Contents"])
+	}
+	if data := streamData(t, r, contents[1]); data != "0 0 10 10 re" {
+		t.Errorf("expected the original content unchanged, got %q", data)
+	}
+	if drawn := streamData(t, r, contents[2]); !strings.HasPrefix(drawn, "Q q 0.93 g 0 0 595 ") {
+		t.Errorf("expected the stamp to span the inherited A4 media box, got %q", drawn)
+	}
+}
+
+func TestStampPDFRejectsEncrypted(t *testing.T) {
+	src := bytes.Replace(minimalPDF(), []byte("/Root 1 0 R"), []byte("/Root 1 0 R /Encrypt 9 0 R"), 1)
+	if _, err := stamp(t, PDF, src, "x"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("err = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	tmpl, err := NewTemplate("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := tmpl.Render(Fields{User: "alice\n", Tenant: "acme", UploadID: "abc", Time: "2024-05-01T00:00:00Z"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Licensed to alice  (acme) on 2024-05-01T00:00:00Z, upload abc"; text != want {
+		t.Errorf("Render = %q, want %q", text, want)
+	}
+
+	if _, err := NewTemplate("{{.Missing"); err == nil {
+		t.Error("NewTemplate accepted an invalid template")
+	}
+	if tmpl, _ := NewTemplate("{{.Nope}}"); tmpl != nil {
+		if _, err := tmpl.Render(Fields{}); err == nil {
+			t.Error("Render accepted an unknown field")
+		}
+	}
+}
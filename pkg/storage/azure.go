@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log/slog"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
 	"github.com/tus/tusd/v2/pkg/azurestore"
 	tusd "github.com/tus/tusd/v2/pkg/handler"
 	"github.com/tus/tusd/v2/pkg/memorylocker"
@@ -18,14 +19,30 @@ type AzureConfig struct {
 	Endpoint            string `json:"endpoint"` // Optional, used for Azurite testing
 	BlobAccessTier      string `json:"blobAccessTier"`
 	ContainerAccessType string `json:"containerAccessType"`
+	BlockSize           int64  `json:"blockSize"`   // Stage chunks as blocks of this many bytes, 0 stages each chunk as one block
+	Concurrency         int    `json:"concurrency"` // Blocks staged in parallel when BlockSize is set
+
+	// Provisioning controls what happens when the container does not exist
+	Provisioning Provisioning `json:"provisioning"`
+
+	// ContainerTemplate routes each tenant's uploads to a container of its
+	// own, named by replacing {tenant}, e.g. "uploads-{tenant}". Containers
+	// are provisioned on first use.
+	ContainerTemplate string `json:"containerTemplate"`
+
+	// Reconcile controls what happens to uploads with inconsistent blocks
+	// at startup
+	Reconcile ReconcileMode `json:"reconcile"`
 }
 
 // AzureStorage implements Storage interface for Azure Blob Storage
 type AzureStorage struct {
-	config      AzureConfig
-	service     azurestore.AzService
-	composer    *tusd.StoreComposer
-	initialized bool
+	config           AzureConfig
+	service          azurestore.AzService
+	container        *container.Client
+	tenantContainers *bucketRouter[*container.Client]
+	composer         *tusd.StoreComposer
+	initialized      bool
 }
 
 // NewAzureStorage creates a new Azure Blob Storage instance
@@ -36,41 +53,162 @@ func NewAzureStorage() *AzureStorage {
 	}
 }
 
-// Initialize sets up the Azure Blob Storage service and configures the storage
-func (s *AzureStorage) Initialize(ctx context.Context, cfg *Config) error {
-	// Default values
-	azureCfg := AzureConfig{
+// AzureOption configures an AzureStorage created with NewAzure
+type AzureOption func(*AzureConfig)
+
+// WithAzureAccount sets the storage account and its shared key
+func WithAzureAccount(name, key string) AzureOption {
+	return func(c *AzureConfig) {
+		c.AccountName = name
+		c.AccountKey = key
+	}
+}
+
+// WithContainer sets the container uploads are stored in
+func WithContainer(name string) AzureOption {
+	return func(c *AzureConfig) {
+		c.ContainerName = name
+	}
+}
+
+// WithAzureEndpoint sets a custom service endpoint, e.g. for Azurite
+func WithAzureEndpoint(endpoint string) AzureOption {
+	return func(c *AzureConfig) {
+		c.Endpoint = endpoint
+	}
+}
+
+// WithBlobAccessTier sets the access tier of new blobs
+func WithBlobAccessTier(tier string) AzureOption {
+	return func(c *AzureConfig) {
+		c.BlobAccessTier = tier
+	}
+}
+
+// WithContainerAccessType sets the public access of created containers
+func WithContainerAccessType(accessType string) AzureOption {
+	return func(c *AzureConfig) {
+		c.ContainerAccessType = accessType
+	}
+}
+
+// WithBlockStaging stages chunks as blocks of blockSize bytes, concurrency
+// at a time
+func WithBlockStaging(blockSize int64, concurrency int) AzureOption {
+	return func(c *AzureConfig) {
+		c.BlockSize = blockSize
+		c.Concurrency = concurrency
+	}
+}
+
+// WithContainerTemplate routes each tenant's uploads to a container of its
+// own, see AzureConfig.ContainerTemplate
+func WithContainerTemplate(template string) AzureOption {
+	return func(c *AzureConfig) {
+		c.ContainerTemplate = template
+	}
+}
+
+// WithAzureProvisioning sets what happens when the container does not exist
+func WithAzureProvisioning(mode Provisioning) AzureOption {
+	return func(c *AzureConfig) {
+		c.Provisioning = mode
+	}
+}
+
+// WithReconcile sets what happens to uploads with inconsistent blocks at
+// startup
+func WithReconcile(mode ReconcileMode) AzureOption {
+	return func(c *AzureConfig) {
+		c.Reconcile = mode
+	}
+}
+
+// defaultAzureConfig returns the configuration used when no overrides are
+// given
+func defaultAzureConfig() AzureConfig {
+	return AzureConfig{
 		ContainerName:       "uploads",
 		ContainerAccessType: "private",
+		Provisioning:        ProvisionCreate,
+		Reconcile:           ReconcileReport,
 	}
+}
 
-	// Override with provided configuration if any
-	if cfg.Properties != nil {
-		if accountName, ok := cfg.Properties["accountName"].(string); ok && accountName != "" {
-			azureCfg.AccountName = accountName
-		}
+// NewAzure creates and initializes an Azure Blob Storage from options.
+// WithAzureAccount is required.
+func NewAzure(ctx context.Context, opts ...AzureOption) (*AzureStorage, error) {
+	azureCfg := defaultAzureConfig()
+	for _, opt := range opts {
+		opt(&azureCfg)
+	}
 
-		if accountKey, ok := cfg.Properties["accountKey"].(string); ok && accountKey != "" {
-			azureCfg.AccountKey = accountKey
-		}
+	s := NewAzureStorage()
+	if err := s.setup(ctx, azureCfg); err != nil {
+		return nil, err
+	}
 
-		if containerName, ok := cfg.Properties["containerName"].(string); ok && containerName != "" {
-			azureCfg.ContainerName = containerName
-		}
+	return s, nil
+}
 
-		if endpoint, ok := cfg.Properties["endpoint"].(string); ok && endpoint != "" {
-			azureCfg.Endpoint = endpoint
-		}
+// Initialize sets up the Azure Blob Storage service and configures the storage
+func (s *AzureStorage) Initialize(ctx context.Context, cfg *Config) error {
+	azureCfg := defaultAzureConfig()
+	azureCfg.applyProperties(cfg.Properties)
 
-		if blobAccessTier, ok := cfg.Properties["blobAccessTier"].(string); ok && blobAccessTier != "" {
-			azureCfg.BlobAccessTier = blobAccessTier
-		}
+	return s.setup(ctx, azureCfg)
+}
 
-		if containerAccessType, ok := cfg.Properties["containerAccessType"].(string); ok && containerAccessType != "" {
-			azureCfg.ContainerAccessType = containerAccessType
-		}
+// applyProperties overrides the configuration with the given properties
+func (c *AzureConfig) applyProperties(props map[string]interface{}) {
+	if accountName, ok := props["accountName"].(string); ok && accountName != "" {
+		c.AccountName = accountName
 	}
 
+	if accountKey, ok := props["accountKey"].(string); ok && accountKey != "" {
+		c.AccountKey = accountKey
+	}
+
+	if containerName, ok := props["containerName"].(string); ok && containerName != "" {
+		c.ContainerName = containerName
+	}
+
+	if endpoint, ok := props["endpoint"].(string); ok && endpoint != "" {
+		c.Endpoint = endpoint
+	}
+
+	if blobAccessTier, ok := props["blobAccessTier"].(string); ok && blobAccessTier != "" {
+		c.BlobAccessTier = blobAccessTier
+	}
+
+	if containerAccessType, ok := props["containerAccessType"].(string); ok && containerAccessType != "" {
+		c.ContainerAccessType = containerAccessType
+	}
+
+	if blockSize, ok := props["blockSize"].(int64); ok {
+		c.BlockSize = blockSize
+	}
+
+	if concurrency, ok := props["concurrency"].(int); ok {
+		c.Concurrency = concurrency
+	}
+
+	if provisioning, ok := props["provisioning"].(Provisioning); ok && provisioning != "" {
+		c.Provisioning = provisioning
+	}
+
+	if template, ok := props["containerTemplate"].(string); ok {
+		c.ContainerTemplate = template
+	}
+
+	if reconcile, ok := props["reconcile"].(ReconcileMode); ok && reconcile != "" {
+		c.Reconcile = reconcile
+	}
+}
+
+// setup creates the Azure service and tusd store from a resolved
+// configuration
+func (s *AzureStorage) setup(ctx context.Context, azureCfg AzureConfig) error {
 	// Validate required Azure configuration
 	if azureCfg.AccountName == "" {
 		return fmt.Errorf("azure account name is required: %w", ErrInvalidConfig)
@@ -80,6 +218,36 @@ func (s *AzureStorage) Initialize(ctx context.Context, cfg *Config) error {
 		return fmt.Errorf("azure account key is required: %w", ErrInvalidConfig)
 	}
 
+	if azureCfg.BlockSize < 0 || azureCfg.BlockSize > azurestore.MaxBlockBlobChunkSize {
+		return fmt.Errorf("azure block size must be between 0 and %d bytes: %w", azurestore.MaxBlockBlobChunkSize, ErrInvalidConfig)
+	}
+
+	if azureCfg.Concurrency < 0 {
+		return fmt.Errorf("azure upload concurrency must not be negative: %w", ErrInvalidConfig)
+	}
+
+	if azureCfg.Concurrency == 0 {
+		azureCfg.Concurrency = DefaultAzureUploadConcurrency
+	}
+
+	if azureCfg.ContainerTemplate != "" {
+		if err := ValidateBucketTemplate(azureCfg.ContainerTemplate); err != nil {
+			return err
+		}
+	}
+
+	provisioning, err := ParseProvisioning(string(azureCfg.Provisioning))
+	if err != nil {
+		return err
+	}
+	azureCfg.Provisioning = provisioning
+
+	reconcile, err := ParseReconcileMode(string(azureCfg.Reconcile))
+	if err != nil {
+		return err
+	}
+	azureCfg.Reconcile = reconcile
+
 	// Store the configuration
 	s.config = azureCfg
 
@@ -102,15 +270,45 @@ func (s *AzureStorage) Initialize(ctx context.Context, cfg *Config) error {
 	slog.Info("Setting up Azure Blob Storage",
 		"account", azureCfg.AccountName,
 		"container", azureCfg.ContainerName,
+		"containerTemplate", azureCfg.ContainerTemplate,
 		"customEndpoint", azureCfg.Endpoint != "",
 	)
 
-	// Create Azure service
-	service, err := azurestore.NewAzureService(&azConfig)
+	// Create Azure service. The azurestore service always creates the
+	// container, so it is only used when that is allowed.
+	var service azurestore.AzService
+	if azureCfg.Provisioning == ProvisionCreate {
+		service, err = azurestore.NewAzureService(&azConfig)
+	} else {
+		service, err = newExistingContainerService(ctx, azConfig, azureCfg.Provisioning)
+	}
 	if err != nil {
 		return fmt.Errorf("error creating Azure service: %w", err)
 	}
 
+	// Startup reconciliation lists and repairs blobs outside the service
+	containerClient, err := newContainerClient(azConfig)
+	if err != nil {
+		return fmt.Errorf("error creating Azure container client: %w", err)
+	}
+
+	// Send each tenant's blobs to its own container when routing is enabled
+	if azureCfg.ContainerTemplate != "" {
+		service = newContainerRoutingService(azConfig, azureCfg.ContainerTemplate, azureCfg.Provisioning, service)
+	}
+
+	// Split chunks into fixed-size blocks staged in parallel, if configured
+	if azureCfg.BlockSize > 0 {
+		service = blockTuningService{
+			AzService:   service,
+			blockSize:   azureCfg.BlockSize,
+			concurrency: azureCfg.Concurrency,
+		}
+		slog.Info("Using tuned Azure block staging",
+			"blockSize", azureCfg.BlockSize,
+			"concurrency", azureCfg.Concurrency)
+	}
+
 	// Create Azure store for tusd
 	store := azurestore.New(service)
 
@@ -124,6 +322,9 @@ func (s *AzureStorage) Initialize(ctx context.Context, cfg *Config) error {
 	locker.UseIn(s.composer) // For file locking
 	store.UseIn(s.composer)  // For data storage
 
+	// Apply access tiers selected per upload when the block list is committed
+	s.composer.UseCore(tieredAzureStore{store})
+
 	// Extra debug logging
 	slog.Debug("Azure store configured",
 		"provider", "Azure",
@@ -131,6 +332,10 @@ func (s *AzureStorage) Initialize(ctx context.Context, cfg *Config) error {
 
 	// Store the service reference
 	s.service = service
+	s.container = containerClient
+	if azureCfg.ContainerTemplate != "" {
+		s.tenantContainers = s.newTenantContainers(azConfig)
+	}
 	s.initialized = true
 
 	return nil
@@ -166,6 +371,17 @@ func (s *AzureStorage) GetProvider() Provider {
 	return Azure
 }
 
+// TenantScoped reports whether uploads are isolated per tenant in
+// containers of their own
+func (s *AzureStorage) TenantScoped() bool {
+	return s.config.ContainerTemplate != ""
+}
+
+// RoutesBuckets reports whether tenants have containers of their own
+func (s *AzureStorage) RoutesBuckets() bool {
+	return s.config.ContainerTemplate != ""
+}
+
 // GetStoreComposer returns the tusd store composer
 func (s *AzureStorage) GetStoreComposer() *tusd.StoreComposer {
 	return s.composer
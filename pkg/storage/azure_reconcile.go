@@ -0,0 +1,293 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/tus/tusd/v2/pkg/azurestore"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+)
+
+// azureBlock is a block staged for a blob
+type azureBlock struct {
+	ID   string
+	Size int64
+}
+
+// blockRepair is how the block list of an inconsistent upload is repaired
+type blockRepair struct {
+	Problem string
+	Action  RepairAction
+	Keep    []int // Block indexes to commit, in order
+	Offset  int64 // Offset once the kept blocks are committed
+}
+
+// RepairsUploads reports whether ReconcileUploads changes inconsistent
+// uploads
+func (s *AzureStorage) RepairsUploads() bool {
+	return s.config.Reconcile == ReconcileRepair
+}
+
+// ReconcileUploads checks the staged blocks of every unfinished upload in
+// the container, and in the containers of tenants when they have their
+// own. An unclean shutdown can leave blocks behind that the upload's offset
+// must not include, such as blocks staged after a gap by an interrupted
+// parallel stage, which are counted as soon as the client resumes and
+// fills the gap, so its next request fails with 409. Such blocks are
+// discarded by committing the blocks before them, complete uploads that
+// were never committed are committed, and uploads that can't be repaired
+// are deleted.
+func (s *AzureStorage) ReconcileUploads(ctx context.Context, lock LockFunc) ([]UploadRepair, error) {
+	if !s.initialized {
+		return nil, ErrStorageNotConfigured
+	}
+	if s.config.Reconcile == ReconcileOff {
+		return nil, nil
+	}
+
+	containers, err := s.listContainers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var repairs []UploadRepair
+	var errs []error
+	for _, client := range containers {
+		pager := client.NewListBlobsFlatPager(nil)
+		for pager.More() {
+			page, err := pager.NextPage(ctx)
+			if err != nil {
+				return repairs, fmt.Errorf("failed to list uploads: %w", err)
+			}
+			for _, item := range page.Segment.BlobItems {
+				id, ok := strings.CutSuffix(*item.Name, azurestore.InfoBlobSuffix)
+				if !ok {
+					continue
+				}
+				repair, err := s.reconcileUpload(ctx, id, lock)
+				if err != nil {
+					if ctx.Err() != nil {
+						return repairs, ctx.Err()
+					}
+					errs = append(errs, fmt.Errorf("upload %s: %w", id, err))
+					continue
+				}
+				if repair != nil {
+					repairs = append(repairs, *repair)
+				}
+			}
+		}
+	}
+	return repairs, errors.Join(errs...)
+}
+
+// reconcileUpload checks and repairs one upload, returning nil if it is
+// consistent
+func (s *AzureStorage) reconcileUpload(ctx context.Context, id string, lock LockFunc) (*UploadRepair, error) {
+	unlock, err := lock(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	info, err := s.readInfo(ctx, id)
+	if errors.Is(err, tusd.ErrNotFound) {
+		// Terminated since it was listed
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := s.containerFor(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	data := client.NewBlockBlobClient(id)
+	list, err := data.GetBlockList(ctx, blockblob.BlockListTypeAll, nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			// Nothing was staged yet
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read block list: %w", err)
+	}
+
+	plan, ok := planBlockRepair(info, azureBlocks(list.CommittedBlocks), azureBlocks(list.UncommittedBlocks))
+	if !ok {
+		return nil, nil
+	}
+	repair := &UploadRepair{UploadID: id, Problem: plan.Problem, Action: plan.Action, Offset: plan.Offset, Upload: info}
+	if s.config.Reconcile == ReconcileReport {
+		repair.Action = RepairNone
+		return repair, nil
+	}
+
+	switch plan.Action {
+	case RepairExpired:
+		repair.Offset = 0
+		err = s.expireUpload(ctx, id)
+	case RepairCommitted:
+		// The tier only applies to finished uploads, as archived blobs
+		// can't take further blocks
+		tier := parseAccessTier(s.config.BlobAccessTier)
+		if class := info.MetaData[StorageClassMetadataKey]; class != "" {
+			classTier := blob.AccessTier(class)
+			tier = &classTier
+		}
+		err = commitBlocks(ctx, data, plan.Keep, tier)
+	default:
+		err = commitBlocks(ctx, data, plan.Keep, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return repair, nil
+}
+
+// readInfo loads the info blob of an upload
+func (s *AzureStorage) readInfo(ctx context.Context, id string) (tusd.FileInfo, error) {
+	client, err := s.containerFor(ctx, id)
+	if err != nil {
+		return tusd.FileInfo{}, err
+	}
+	resp, err := client.NewBlockBlobClient(id+azurestore.InfoBlobSuffix).DownloadStream(ctx, nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return tusd.FileInfo{}, tusd.ErrNotFound
+		}
+		return tusd.FileInfo{}, fmt.Errorf("failed to read upload info: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var info tusd.FileInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return tusd.FileInfo{}, fmt.Errorf("failed to decode upload info: %w", err)
+	}
+	return info, nil
+}
+
+// expireUpload deletes the info and data blobs of an upload, like a
+// termination would
+func (s *AzureStorage) expireUpload(ctx context.Context, id string) error {
+	client, err := s.containerFor(ctx, id)
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{id + azurestore.InfoBlobSuffix, id} {
+		_, err := client.NewBlobClient(name).Delete(ctx, nil)
+		if err != nil && !bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return fmt.Errorf("failed to delete %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// commitBlocks commits the blocks with the given indexes, discarding every
+// other uncommitted block
+func commitBlocks(ctx context.Context, data *blockblob.Client, indexes []int, tier *blob.AccessTier) error {
+	ids := make([]string, len(indexes))
+	for i, index := range indexes {
+		ids[i] = encodeBlockID(index)
+	}
+	if _, err := data.CommitBlockList(ctx, ids, &blockblob.CommitBlockListOptions{Tier: tier}); err != nil {
+		return fmt.Errorf("failed to commit block list: %w", err)
+	}
+	return nil
+}
+
+// azureBlocks converts blocks returned by the SDK
+func azureBlocks(blocks []*blockblob.Block) []azureBlock {
+	converted := make([]azureBlock, 0, len(blocks))
+	for _, block := range blocks {
+		converted = append(converted, azureBlock{ID: *block.Name, Size: *block.Size})
+	}
+	return converted
+}
+
+// planBlockRepair compares the blocks of an upload to its info and returns
+// how to repair them, or false if they are consistent. The offset is the
+// size of the contiguous blocks from index zero, the same as the tuned
+// block blobs report.
+func planBlockRepair(info tusd.FileInfo, committed, uncommitted []azureBlock) (blockRepair, bool) {
+	// Finished uploads and uploads without data have nothing staged
+	if len(uncommitted) == 0 {
+		return blockRepair{}, false
+	}
+
+	// Uncommitted blocks take precedence, like in the committed block list
+	sizes := make(map[int]int64)
+	for _, block := range append(committed, uncommitted...) {
+		index := decodeBlockID(block.ID)
+		if index < 0 {
+			return blockRepair{
+				Problem: fmt.Sprintf("block ID %q was not staged by the server", block.ID),
+				Action:  RepairExpired,
+			}, true
+		}
+		sizes[index] = block.Size
+	}
+
+	indexes := make([]int, 0, len(sizes))
+	for index := range sizes {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	var offset int64
+	contiguous := make([]int, 0, len(indexes))
+	for i, index := range indexes {
+		if index != i {
+			break
+		}
+		offset += sizes[index]
+		contiguous = append(contiguous, index)
+	}
+
+	switch {
+	case !info.SizeIsDeferred && offset > info.Size:
+		// Keep the blocks adding up to the upload size, if any do
+		var size int64
+		for i, index := range contiguous {
+			size += sizes[index]
+			if size == info.Size {
+				return blockRepair{
+					Problem: fmt.Sprintf("blocks hold %d bytes, more than the upload size of %d", offset, info.Size),
+					Action:  RepairCommitted,
+					Keep:    contiguous[:i+1],
+					Offset:  size,
+				}, true
+			}
+			if size > info.Size {
+				break
+			}
+		}
+		return blockRepair{
+			Problem: fmt.Sprintf("blocks hold %d bytes, more than the upload size of %d", offset, info.Size),
+			Action:  RepairExpired,
+		}, true
+	case !info.SizeIsDeferred && offset == info.Size:
+		return blockRepair{
+			Problem: "upload is complete but its blocks were never committed",
+			Action:  RepairCommitted,
+			Keep:    contiguous,
+			Offset:  offset,
+		}, true
+	case len(contiguous) < len(indexes):
+		return blockRepair{
+			Problem: fmt.Sprintf("%d blocks were staged after a gap at block %d", len(indexes)-len(contiguous), len(contiguous)),
+			Action:  RepairTruncated,
+			Keep:    contiguous,
+			Offset:  offset,
+		}, true
+	default:
+		return blockRepair{}, false
+	}
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestPlanBlockRepair(t *testing.T) {
+	blocks := func(indexes ...int) []azureBlock {
+		list := make([]azureBlock, len(indexes))
+		for i, index := range indexes {
+			list[i] = azureBlock{ID: encodeBlockID(index), Size: 10}
+		}
+		return list
+	}
+	upload := tusd.FileInfo{Size: 50}
+
+	tests := []struct {
+		name         string
+		info         tusd.FileInfo
+		committed    []azureBlock
+		uncommitted  []azureBlock
+		want         blockRepair
+		inconsistent bool
+	}{
+		{name: "nothing staged", info: upload},
+		{name: "finished", info: upload, committed: blocks(0, 1, 2, 3, 4)},
+		{name: "in progress", info: upload, uncommitted: blocks(2, 0, 1)},
+		{name: "in progress after a repair", info: upload, committed: blocks(0, 1), uncommitted: blocks(2)},
+		{name: "deferred size", info: tusd.FileInfo{SizeIsDeferred: true}, uncommitted: blocks(0, 1, 2, 3, 4, 5, 6)},
+		{
+			name: "blocks after a gap", info: upload, uncommitted: blocks(0, 1, 3, 4),
+			want:         blockRepair{Action: RepairTruncated, Keep: []int{0, 1}, Offset: 20},
+			inconsistent: true,
+		},
+		{
+			name: "complete but not committed", info: upload, uncommitted: blocks(0, 1, 2, 3, 4),
+			want:         blockRepair{Action: RepairCommitted, Keep: []int{0, 1, 2, 3, 4}, Offset: 50},
+			inconsistent: true,
+		},
+		{
+			name: "blocks past the size", info: upload, uncommitted: blocks(0, 1, 2, 3, 4, 5),
+			want:         blockRepair{Action: RepairCommitted, Keep: []int{0, 1, 2, 3, 4}, Offset: 50},
+			inconsistent: true,
+		},
+		{
+			name: "blocks straddling the size", info: tusd.FileInfo{Size: 45}, uncommitted: blocks(0, 1, 2, 3, 4),
+			want:         blockRepair{Action: RepairExpired},
+			inconsistent: true,
+		},
+		{
+			name: "foreign block ID", info: upload, uncommitted: append(blocks(0), azureBlock{ID: "YmxvY2stMDAwMDE=", Size: 10}),
+			want:         blockRepair{Action: RepairExpired},
+			inconsistent: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, inconsistent := planBlockRepair(tt.info, tt.committed, tt.uncommitted)
+			if inconsistent != tt.inconsistent {
+				t.Fatalf("inconsistent = %v, want %v (%+v)", inconsistent, tt.inconsistent, got)
+			}
+			if !inconsistent {
+				return
+			}
+			if got.Problem == "" {
+				t.Error("repair lacks a problem description")
+			}
+			if got.Action != tt.want.Action || !slices.Equal(got.Keep, tt.want.Keep) || got.Offset != tt.want.Offset {
+				t.Errorf("planBlockRepair = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewAzureRequiresAccount(t *testing.T) {
+	if _, err := NewAzure(context.Background(), WithContainer("uploads")); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expected ErrInvalidConfig without an account, got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+	"github.com/tus/tusd/v2/pkg/azurestore"
+)
+
+// containerRoutingService hands out the blobs of each tenant from a
+// container of its own, provisioned on first use like the configured
+// container
+type containerRoutingService struct {
+	containers *bucketRouter[azurestore.AzService]
+}
+
+// newContainerRoutingService creates a service routing blobs to the
+// containers the template names, falling back to the service of the
+// configured container
+func newContainerRoutingService(cfg azurestore.AzConfig, template string, mode Provisioning, fallback azurestore.AzService) containerRoutingService {
+	return containerRoutingService{
+		containers: newBucketRouter(template, fallback, func(ctx context.Context, name string) (azurestore.AzService, error) {
+			tenantCfg := cfg
+			tenantCfg.ContainerName = name
+			if mode == ProvisionCreate {
+				return azurestore.NewAzureService(&tenantCfg)
+			}
+			return newExistingContainerService(ctx, tenantCfg, mode)
+		}),
+	}
+}
+
+// NewBlob returns the info or data blob for the name from the container of
+// the tenant owning it
+func (s containerRoutingService) NewBlob(ctx context.Context, name string) (azurestore.AzBlob, error) {
+	service, err := s.containers.route(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return service.NewBlob(ctx, name)
+}
+
+// containerName returns the container holding a blob
+func (s *AzureStorage) containerName(name string) string {
+	if tenant, ok := TenantFromKey(name); ok && s.config.ContainerTemplate != "" {
+		return BucketName(s.config.ContainerTemplate, tenant)
+	}
+	return s.config.ContainerName
+}
+
+// containerFor returns a client for the container holding a blob
+func (s *AzureStorage) containerFor(ctx context.Context, name string) (*container.Client, error) {
+	if s.config.ContainerTemplate == "" {
+		return s.container, nil
+	}
+	return s.tenantContainers.route(ctx, name)
+}
+
+// newTenantContainers creates the router returning clients for the
+// containers of tenants, which it leaves to the service to create
+func (s *AzureStorage) newTenantContainers(cfg azurestore.AzConfig) *bucketRouter[*container.Client] {
+	return newBucketRouter(s.config.ContainerTemplate, s.container, func(ctx context.Context, name string) (*container.Client, error) {
+		tenantCfg := cfg
+		tenantCfg.ContainerName = name
+		return newContainerClient(tenantCfg)
+	})
+}
+
+// listContainers returns clients for the configured container and, when
+// tenants have containers of their own, for all the tenant containers
+func (s *AzureStorage) listContainers(ctx context.Context) ([]*container.Client, error) {
+	clients := []*container.Client{s.container}
+	if s.config.ContainerTemplate == "" {
+		return clients, nil
+	}
+
+	credential, err := azblob.NewSharedKeyCredential(s.config.AccountName, s.config.AccountKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid azure account key: %w", err)
+	}
+	client, err := service.NewClientWithSharedKeyCredential(s.config.Endpoint, credential, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating Azure service client: %w", err)
+	}
+
+	prefix, _, _ := strings.Cut(s.config.ContainerTemplate, TenantPlaceholder)
+	pattern := bucketTemplatePattern(s.config.ContainerTemplate)
+	pager := client.NewListContainersPager(&service.ListContainersOptions{Prefix: &prefix})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list containers: %w", err)
+		}
+		for _, item := range page.ContainerItems {
+			name := *item.Name
+			if name == s.config.ContainerName || !pattern.MatchString(name) {
+				continue
+			}
+			client, err := newContainerClient(azurestore.AzConfig{
+				AccountName:   s.config.AccountName,
+				AccountKey:    s.config.AccountKey,
+				Endpoint:      s.config.Endpoint,
+				ContainerName: name,
+			})
+			if err != nil {
+				return nil, err
+			}
+			clients = append(clients, client)
+		}
+	}
+	return clients, nil
+}
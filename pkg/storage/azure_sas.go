@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+)
+
+// SASOptions configures a read-only shared access signature
+type SASOptions struct {
+	Expires time.Time
+
+	// CacheControl and ContentDisposition override the response headers
+	CacheControl       string
+	ContentDisposition string
+}
+
+// SASSigner is implemented by backends that can sign read-only shared
+// access signatures for single objects, e.g. to serve them through a CDN
+// in front of the storage account
+type SASSigner interface {
+	// SignSAS returns the encoded query string authorizing reads of key
+	SignSAS(key string, opts SASOptions) (string, error)
+}
+
+// SignSAS returns a read-only service SAS for a blob in the container
+// holding it, signed with the account key
+func (s *AzureStorage) SignSAS(key string, opts SASOptions) (string, error) {
+	if !s.initialized {
+		return "", ErrStorageNotConfigured
+	}
+
+	credential, err := azblob.NewSharedKeyCredential(s.config.AccountName, s.config.AccountKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid azure account key: %w", err)
+	}
+
+	values := sas.BlobSignatureValues{
+		Protocol:           sas.ProtocolHTTPS,
+		ExpiryTime:         opts.Expires.UTC(),
+		Permissions:        (&sas.BlobPermissions{Read: true}).String(),
+		ContainerName:      s.containerName(key),
+		BlobName:           key,
+		CacheControl:       opts.CacheControl,
+		ContentDisposition: opts.ContentDisposition,
+	}
+
+	params, err := values.SignWithSharedKey(credential)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign SAS: %w", err)
+	}
+	return params.Encode(), nil
+}
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/tus/tusd/v2/pkg/azurestore"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+)
+
+// TransitionUpload sets the access tier of the blob of a finished upload.
+// Blobs in the Archive tier must be rehydrated before they can be
+// downloaded again.
+func (s *AzureStorage) TransitionUpload(ctx context.Context, uploadID, class string) error {
+	client, err := s.containerFor(ctx, uploadID)
+	if err != nil {
+		return err
+	}
+	if _, err := client.NewBlobClient(uploadID).SetTier(ctx, blob.AccessTier(class), nil); err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return fmt.Errorf("upload %s has no blob: %w", uploadID, tusd.ErrNotFound)
+		}
+		return fmt.Errorf("failed to move upload %s to %s: %w", uploadID, class, err)
+	}
+
+	// The info blob records the tier for inventories and cost estimates
+	info, err := s.readInfo(ctx, uploadID)
+	if err != nil {
+		return err
+	}
+	if info.MetaData == nil {
+		info.MetaData = make(tusd.MetaData)
+	}
+	info.MetaData[StorageClassMetadataKey] = class
+	data, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("failed to encode upload info: %w", err)
+	}
+	if _, err := client.NewBlockBlobClient(uploadID+azurestore.InfoBlobSuffix).UploadBuffer(ctx, data, nil); err != nil {
+		return fmt.Errorf("failed to write upload info: %w", err)
+	}
+	slog.Debug("Upload moved to access tier", "id", uploadID, "tier", class)
+	return nil
+}
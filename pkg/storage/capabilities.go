@@ -0,0 +1,43 @@
+package storage
+
+// Capability is whether a storage backend offers an optional feature
+type Capability string
+
+// States of a capability
+const (
+	CapabilityEnabled  Capability = "enabled"
+	CapabilityDisabled Capability = "disabled"
+	CapabilityUnknown  Capability = "unknown" // The probe failed, e.g. for lack of permission
+)
+
+// Capabilities are the optional features of a storage backend, probed when
+// it is initialized
+type Capabilities struct {
+	// Tagging is whether objects can be tagged
+	Tagging Capability `json:"tagging"`
+
+	// Versioning is whether overwritten and deleted objects are kept as
+	// noncurrent versions
+	Versioning Capability `json:"versioning"`
+
+	// ObjectLock is whether objects can be protected from deletion, and
+	// Retention describes the default retention of new objects, if any
+	ObjectLock Capability `json:"objectLock"`
+	Retention  string     `json:"retention,omitempty"`
+
+	// Multipart limits of the backend. Zero values mean no limit.
+	MaxParts      int64 `json:"maxParts,omitempty"`
+	MinPartSize   int64 `json:"minPartSize,omitempty"`
+	MaxPartSize   int64 `json:"maxPartSize,omitempty"`
+	MaxObjectSize int64 `json:"maxObjectSize,omitempty"`
+
+	// Warnings explain features that were disabled or behave differently
+	// because of the capabilities
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// CapabilityReporter is implemented by storage backends that probe their
+// capabilities when initialized
+type CapabilityReporter interface {
+	Capabilities() Capabilities
+}
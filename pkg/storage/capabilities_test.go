@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProbeCapabilities(t *testing.T) {
+	var checksummed bool
+	// The bucket has versioning and object lock with a default retention,
+	// and the service doesn't implement object tagging
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch {
+		case r.Method == http.MethodHead:
+		case query.Has("tagging"):
+			w.WriteHeader(http.StatusNotImplemented)
+			w.Write([]byte(`<Error><Code>NotImplemented</Code><Message>not implemented</Message></Error>`))
+		case query.Has("versioning"):
+			w.Write([]byte(`<VersioningConfiguration><Status>Enabled</Status></VersioningConfiguration>`))
+		case query.Has("object-lock"):
+			w.Write([]byte(`<ObjectLockConfiguration><ObjectLockEnabled>Enabled</ObjectLockEnabled>` +
+				`<Rule><DefaultRetention><Mode>GOVERNANCE</Mode><Days>30</Days></DefaultRetention></Rule></ObjectLockConfiguration>`))
+		case query.Get("list-type") == "2":
+			w.Write([]byte(`<ListBucketResult><Name>uploads</Name><KeyCount>0</KeyCount></ListBucketResult>`))
+		case strings.HasPrefix(r.URL.Path, "/uploads/"+permissionProbePrefix):
+			// Requests of the permission check
+			if r.Method == http.MethodPut && (r.Header.Get("X-Amz-Checksum-Crc32") != "" || r.Header.Get("X-Amz-Trailer") != "") {
+				checksummed = true
+			}
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+	}))
+	defer server.Close()
+
+	store, err := NewMinIO(context.Background(), WithEndpoint(server.URL), WithChecksumCompat(true), WithUniformParts(), WithPartSize(minPartSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	caps := store.Capabilities()
+	if caps.Tagging != CapabilityDisabled || caps.Versioning != CapabilityEnabled || caps.ObjectLock != CapabilityEnabled {
+		t.Fatalf("unexpected capabilities %+v", caps)
+	}
+	if caps.Retention != "30 days (GOVERNANCE)" || caps.MaxParts != 10000 || caps.MaxObjectSize != minPartSize*10000 {
+		t.Fatalf("unexpected retention or multipart limits %+v", caps)
+	}
+	if store.config.ChecksumCompat {
+		t.Fatal("expected checksum compatibility to be disabled for object lock")
+	}
+	warnings := strings.Join(caps.Warnings, "\n")
+	for _, want := range []string{"tagging is not supported", "noncurrent versions", "retained for 30 days", "checksum compatibility is disabled", "Uploads are limited"} {
+		if !strings.Contains(warnings, want) {
+			t.Errorf("expected a warning containing %q, got:\n%s", want, warnings)
+		}
+	}
+
+	// The permission check leaves out the missing feature
+	operations := map[string]bool{}
+	for _, check := range store.CheckPermissions(context.Background()) {
+		operations[check.Operation] = true
+		if strings.HasSuffix(check.Operation, "ObjectTagging") && (!check.Unsupported || check.Err != nil) {
+			t.Fatalf("expected tagging to be reported as unsupported, got %+v", check)
+		}
+	}
+	for _, want := range []string{"HeadObject", "GetObjectTagging", "CompleteMultipartUpload", "AbortMultipartUpload", "ListObjectsV2", "CopyObject"} {
+		if !operations[want] {
+			t.Errorf("expected the permission check to try %s", want)
+		}
+	}
+	if !checksummed {
+		t.Fatal("expected writes to carry a checksum")
+	}
+}
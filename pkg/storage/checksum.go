@@ -0,0 +1,31 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// Checksum computes the hex encoded SHA-256 digest of an upload's content by
+// streaming it from the storage backend
+func Checksum(ctx context.Context, s Storage, id string) (string, error) {
+	upload, err := s.GetStoreComposer().Core.GetUpload(ctx, id)
+	if err != nil {
+		return "", fmt.Errorf("failed to get upload %s: %w", id, err)
+	}
+
+	reader, err := upload.GetReader(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to read upload %s: %w", id, err)
+	}
+	defer reader.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return "", fmt.Errorf("failed to hash upload %s: %w", id, err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
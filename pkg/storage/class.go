@@ -0,0 +1,234 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/tus/tusd/v2/pkg/azurestore"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/s3store"
+)
+
+// StorageClassMetadataKey is the upload metadata field holding the storage
+// class (S3) or access tier (Azure) the finished object is stored in
+const StorageClassMetadataKey = "storage_class"
+
+// ErrRestoreRequired is reported for reads of uploads moved to an archive
+// class, such as S3 Glacier or the Azure Archive tier, which can only be
+// read once they are restored
+var ErrRestoreRequired = tusd.NewError("ERR_RESTORE_REQUIRED",
+	"upload is archived and must be restored before it can be read", http.StatusConflict)
+
+// IsArchived reports whether a backend error refuses to read an object
+// because it is in an archive class: S3 InvalidObjectState or Azure
+// BlobArchived
+func IsArchived(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidObjectState" {
+		return true
+	}
+	var azErr *azcore.ResponseError
+	return errors.As(err, &azErr) && azErr.ErrorCode == "BlobArchived"
+}
+
+// s3StorageClasses lists the storage classes of S3 and compatible services
+var s3StorageClasses = []string{
+	string(types.StorageClassStandard),
+	string(types.StorageClassStandardIa),
+	string(types.StorageClassOnezoneIa),
+	string(types.StorageClassIntelligentTiering),
+	string(types.StorageClassGlacierIr),
+	string(types.StorageClassGlacier),
+	string(types.StorageClassDeepArchive),
+	string(types.StorageClassReducedRedundancy),
+}
+
+// storageClasses lists the classes each provider accepts. Providers without
+// an entry have no classes and store every upload alike.
+var storageClasses = map[Provider][]string{
+	MinIO: s3StorageClasses,
+	S3:    s3StorageClasses,
+	Azure: {
+		string(blob.AccessTierHot),
+		string(blob.AccessTierCool),
+		string(blob.AccessTierCold),
+		string(blob.AccessTierArchive),
+	},
+}
+
+// ClassRule selects a storage class for uploads of at least MinSize bytes
+type ClassRule struct {
+	MinSize int64
+	Class   string
+}
+
+// ClassPolicy decides which storage class a new upload is stored in
+type ClassPolicy struct {
+	// Default is used when neither the client nor a rule selects a class.
+	// Empty leaves the provider default.
+	Default string
+
+	// AllowClientOverride lets clients pick a class via upload metadata
+	AllowClientOverride bool
+
+	// Rules are evaluated in order, the first matching rule wins
+	Rules []ClassRule
+}
+
+// Resolve returns the storage class for the upload, or an empty string for
+// the provider default. Unknown classes requested by the client are rejected.
+// Providers without classes always get the default.
+func (p ClassPolicy) Resolve(provider Provider, info tusd.FileInfo) (string, error) {
+	if !SupportsStorageClasses(provider) {
+		return "", nil
+	}
+	if requested, ok := info.MetaData[StorageClassMetadataKey]; ok && requested != "" {
+		if !p.AllowClientOverride {
+			return "", fmt.Errorf("choosing a storage class is not allowed")
+		}
+		class, ok := NormalizeStorageClass(provider, requested)
+		if !ok {
+			return "", fmt.Errorf("unsupported storage class %q for provider %s", requested, provider)
+		}
+		return class, nil
+	}
+
+	if !info.SizeIsDeferred {
+		for _, rule := range p.Rules {
+			if info.Size >= rule.MinSize {
+				return p.normalize(provider, rule.Class), nil
+			}
+		}
+	}
+
+	return p.normalize(provider, p.Default), nil
+}
+
+// Validate checks that all configured classes are valid for the provider.
+// The classes are not checked for providers without classes, which ignore
+// them.
+func (p ClassPolicy) Validate(provider Provider) error {
+	if !SupportsStorageClasses(provider) {
+		return nil
+	}
+	classes := []string{p.Default}
+	for _, rule := range p.Rules {
+		classes = append(classes, rule.Class)
+	}
+
+	for _, class := range classes {
+		if class == "" {
+			continue
+		}
+		if _, ok := NormalizeStorageClass(provider, class); !ok {
+			return fmt.Errorf("unsupported storage class %q for provider %s: %w", class, provider, ErrInvalidConfig)
+		}
+	}
+
+	return nil
+}
+
+// normalize converts a configured class to its canonical form, assuming it
+// has been validated
+func (p ClassPolicy) normalize(provider Provider, class string) string {
+	normalized, _ := NormalizeStorageClass(provider, class)
+	return normalized
+}
+
+// Configured reports whether the policy selects any class
+func (p ClassPolicy) Configured() bool {
+	return p.Default != "" || p.AllowClientOverride || len(p.Rules) > 0
+}
+
+// SupportsStorageClasses reports whether uploads on the provider can be
+// stored in different storage classes
+func SupportsStorageClasses(provider Provider) bool {
+	_, ok := storageClasses[provider]
+	return ok
+}
+
+// NormalizeStorageClass returns the canonical spelling of a storage class and
+// whether the provider supports it
+func NormalizeStorageClass(provider Provider, class string) (string, bool) {
+	for _, supported := range storageClasses[provider] {
+		if strings.EqualFold(supported, class) {
+			return supported, true
+		}
+	}
+	return "", false
+}
+
+// Tierer is implemented by backends that can move the data of finished
+// uploads to another storage class or access tier
+type Tierer interface {
+	// TransitionUpload moves the data of a finished upload to a class of
+	// the provider and records it in the upload's storage_class metadata
+	TransitionUpload(ctx context.Context, uploadID, class string) error
+}
+
+// storageClassS3API sets the storage class of new multipart uploads from the
+// upload metadata
+type storageClassS3API struct {
+	s3store.S3API
+}
+
+// CreateMultipartUpload applies the storage class stored in the metadata
+func (api storageClassS3API) CreateMultipartUpload(ctx context.Context, input *s3.CreateMultipartUploadInput, opts ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	if class, ok := input.Metadata[StorageClassMetadataKey]; ok && class != "" {
+		input.StorageClass = types.StorageClass(class)
+	}
+	return api.S3API.CreateMultipartUpload(ctx, input, opts...)
+}
+
+// tieredAzureStore sets the access tier the block list is committed with
+// from the upload metadata. Only the core is wrapped so the concrete upload
+// type expected by the terminater and length deferrer is preserved.
+type tieredAzureStore struct {
+	*azurestore.AzureStore
+}
+
+// NewUpload creates the upload and applies its access tier
+func (store tieredAzureStore) NewUpload(ctx context.Context, info tusd.FileInfo) (tusd.Upload, error) {
+	upload, err := store.AzureStore.NewUpload(ctx, info)
+	if err != nil {
+		return nil, err
+	}
+	applyAccessTier(upload)
+	return upload, nil
+}
+
+// GetUpload loads the upload and applies its access tier
+func (store tieredAzureStore) GetUpload(ctx context.Context, id string) (tusd.Upload, error) {
+	upload, err := store.AzureStore.GetUpload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	applyAccessTier(upload)
+	return upload, nil
+}
+
+// applyAccessTier overrides the block blob tier when the metadata selects one
+func applyAccessTier(upload tusd.Upload) {
+	azUpload, ok := upload.(*azurestore.AzUpload)
+	if !ok || azUpload.InfoHandler == nil {
+		return
+	}
+
+	class := azUpload.InfoHandler.MetaData[StorageClassMetadataKey]
+	if class == "" {
+		return
+	}
+
+	if blockBlob, ok := underlyingBlockBlob(azUpload.BlockBlob); ok {
+		tier := blob.AccessTier(class)
+		blockBlob.BlobAccessTier = &tier
+	}
+}
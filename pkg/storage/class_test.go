@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"testing"
+
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestClassPolicyResolve(t *testing.T) {
+	policy := ClassPolicy{
+		Default:             "standard",
+		AllowClientOverride: true,
+		Rules: []ClassRule{
+			{MinSize: 1 << 30, Class: "glacier_ir"},
+			{MinSize: 1 << 20, Class: "STANDARD_IA"},
+		},
+	}
+
+	tests := []struct {
+		name string
+		info tusd.FileInfo
+		want string
+	}{
+		{"default", tusd.FileInfo{Size: 10}, "STANDARD"},
+		{"first matching rule", tusd.FileInfo{Size: 2 << 30}, "GLACIER_IR"},
+		{"second rule", tusd.FileInfo{Size: 2 << 20}, "STANDARD_IA"},
+		{"deferred size skips rules", tusd.FileInfo{Size: 2 << 30, SizeIsDeferred: true}, "STANDARD"},
+		{"client override", tusd.FileInfo{
+			Size:     2 << 30,
+			MetaData: tusd.MetaData{StorageClassMetadataKey: "deep_archive"},
+		}, "DEEP_ARCHIVE"},
+	}
+
+	for _, tt := range tests {
+		got, err := policy.Resolve(MinIO, tt.info)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClassPolicyRejectsInvalidClientClass(t *testing.T) {
+	info := tusd.FileInfo{MetaData: tusd.MetaData{StorageClassMetadataKey: "cool"}}
+
+	if _, err := (ClassPolicy{AllowClientOverride: true}).Resolve(MinIO, info); err == nil {
+		t.Error("Expected Azure tier to be rejected for MinIO")
+	}
+	if got, err := (ClassPolicy{AllowClientOverride: true}).Resolve(Azure, info); err != nil || got != "Cool" {
+		t.Errorf("Expected Azure tier 'Cool', got %q (%v)", got, err)
+	}
+	if _, err := (ClassPolicy{}).Resolve(Azure, info); err == nil {
+		t.Error("Expected client class to be rejected when overrides are disabled")
+	}
+}
+
+func TestClassPolicyValidate(t *testing.T) {
+	if err := (ClassPolicy{Default: "archive"}).Validate(Azure); err != nil {
+		t.Errorf("Expected valid policy, got %v", err)
+	}
+	if err := (ClassPolicy{Rules: []ClassRule{{Class: "nope"}}}).Validate(Azure); err == nil {
+		t.Error("Expected invalid rule class to fail validation")
+	}
+}
+
+func TestClassPolicyIgnoredWithoutClasses(t *testing.T) {
+	policy := ClassPolicy{Default: "STANDARD_IA", AllowClientOverride: true}
+	if err := policy.Validate(Disk); err != nil {
+		t.Errorf("Expected classes to be ignored for disk storage, got %v", err)
+	}
+
+	info := tusd.FileInfo{MetaData: tusd.MetaData{StorageClassMetadataKey: "GLACIER"}}
+	if got, err := policy.Resolve(S3Compat, info); err != nil || got != "" {
+		t.Errorf("Expected the provider default for S3-compatible storage, got %q (%v)", got, err)
+	}
+}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"regexp"
+)
+
+// ContentKeyPrefix is the key prefix of content-addressed objects
+const ContentKeyPrefix = "sha256/"
+
+// ErrContentNotFound is returned when no object exists for a digest
+var ErrContentNotFound = errors.New("content not found")
+
+// digestPattern matches hex encoded SHA-256 digests
+var digestPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ContentStore is implemented by backends that can keep finished uploads
+// under keys derived from their SHA-256 digest, so identical content is
+// stored once
+type ContentStore interface {
+	// MoveToContent moves the data of a finished upload to the key of its
+	// digest. If that content is already stored, the upload's copy is
+	// dropped and deduplicated is true.
+	MoveToContent(ctx context.Context, uploadID, digest string) (deduplicated bool, err error)
+
+	// OpenContent returns a reader for the content and its size
+	OpenContent(ctx context.Context, digest string) (io.ReadCloser, int64, error)
+
+	// DeleteContent deletes the content once no upload references it
+	DeleteContent(ctx context.Context, digest string) error
+}
+
+// ContentKey returns the object key of the content with the given digest
+func ContentKey(digest string) string {
+	return ContentKeyPrefix + digest
+}
+
+// ValidDigest reports whether s is a hex encoded SHA-256 digest
+func ValidDigest(s string) bool {
+	return digestPattern.MatchString(s)
+}
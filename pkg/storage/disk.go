@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/tus/tusd/v2/pkg/filelocker"
+	"github.com/tus/tusd/v2/pkg/filestore"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+)
+
+// DefaultDiskRootDir is where uploads are stored on disk unless configured
+const DefaultDiskRootDir = "./uploads"
+
+// DiskConfig holds configuration specific to local disk storage
+type DiskConfig struct {
+	RootDir string `json:"rootDir"`
+
+	// Provisioning controls what happens when the root directory does not
+	// exist
+	Provisioning Provisioning `json:"provisioning"`
+}
+
+// DiskStorage implements Storage interface for a local directory, so the
+// server can run without an object store. Each upload is stored as a data
+// file and a .info file, and locked with a .lock file, so instances sharing
+// the directory over a network file system coordinate their uploads.
+type DiskStorage struct {
+	config      DiskConfig
+	composer    *tusd.StoreComposer
+	initialized bool
+}
+
+// NewDiskStorage creates a new local disk storage instance
+func NewDiskStorage() *DiskStorage {
+	return &DiskStorage{
+		composer:    tusd.NewStoreComposer(),
+		initialized: false,
+	}
+}
+
+// DiskOption configures a DiskStorage created with NewDisk
+type DiskOption func(*DiskConfig)
+
+// WithRootDir sets the directory uploads are stored in
+func WithRootDir(dir string) DiskOption {
+	return func(c *DiskConfig) {
+		c.RootDir = dir
+	}
+}
+
+// WithDiskProvisioning sets what happens when the root directory does not
+// exist
+func WithDiskProvisioning(mode Provisioning) DiskOption {
+	return func(c *DiskConfig) {
+		c.Provisioning = mode
+	}
+}
+
+// defaultDiskConfig returns the configuration used when no overrides are
+// given
+func defaultDiskConfig() DiskConfig {
+	return DiskConfig{
+		RootDir:      DefaultDiskRootDir,
+		Provisioning: ProvisionCreate,
+	}
+}
+
+// NewDisk creates and initializes a local disk storage from options
+func NewDisk(ctx context.Context, opts ...DiskOption) (*DiskStorage, error) {
+	diskCfg := defaultDiskConfig()
+	for _, opt := range opts {
+		opt(&diskCfg)
+	}
+
+	s := NewDiskStorage()
+	if err := s.setup(diskCfg); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Initialize sets up the root directory and configures the storage
+func (s *DiskStorage) Initialize(ctx context.Context, cfg *Config) error {
+	diskCfg := defaultDiskConfig()
+
+	if rootDir, ok := cfg.Properties["rootDir"].(string); ok && rootDir != "" {
+		diskCfg.RootDir = rootDir
+	}
+
+	if provisioning, ok := cfg.Properties["provisioning"].(Provisioning); ok && provisioning != "" {
+		diskCfg.Provisioning = provisioning
+	}
+
+	return s.setup(diskCfg)
+}
+
+// setup provisions the root directory and creates the tusd store from a
+// resolved configuration
+func (s *DiskStorage) setup(diskCfg DiskConfig) error {
+	provisioning, err := ParseProvisioning(string(diskCfg.Provisioning))
+	if err != nil {
+		return err
+	}
+	diskCfg.Provisioning = provisioning
+
+	if err := provisionDirectory(diskCfg); err != nil {
+		return err
+	}
+
+	slog.Info("Setting up local disk storage", "rootDir", diskCfg.RootDir)
+
+	store := filestore.New(diskCfg.RootDir)
+	locker := filelocker.New(diskCfg.RootDir)
+
+	s.composer = tusd.NewStoreComposer()
+	locker.UseIn(s.composer)
+	store.UseIn(s.composer)
+
+	s.config = diskCfg
+	s.initialized = true
+
+	return nil
+}
+
+// provisionDirectory makes sure the root directory exists, creating it if
+// the provisioning mode allows
+func provisionDirectory(cfg DiskConfig) error {
+	stat, err := os.Stat(cfg.RootDir)
+	if err == nil {
+		if !stat.IsDir() {
+			return fmt.Errorf("disk storage root %s is not a directory: %w", cfg.RootDir, ErrInvalidConfig)
+		}
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error checking disk storage root: %w", err)
+	}
+
+	switch cfg.Provisioning {
+	case ProvisionFail:
+		return fmt.Errorf("disk storage root %s: %w", cfg.RootDir, ErrBucketNotFound)
+	case ProvisionWarn:
+		slog.Warn("Disk storage root does not exist, uploads will fail until it is created", "rootDir", cfg.RootDir)
+		return nil
+	}
+
+	slog.Info("Disk storage root does not exist. Creating...", "rootDir", cfg.RootDir)
+	if err := os.MkdirAll(cfg.RootDir, 0o755); err != nil {
+		return fmt.Errorf("error creating disk storage root: %w", err)
+	}
+	return nil
+}
+
+// GetHandler returns a configured tusd handler for local disk storage
+func (s *DiskStorage) GetHandler(basePath string) (*tusd.Handler, error) {
+	if !s.initialized {
+		return nil, ErrStorageNotConfigured
+	}
+
+	handler, err := tusd.NewHandler(tusd.Config{
+		BasePath:              basePath,
+		StoreComposer:         s.composer,
+		NotifyCompleteUploads: true,
+		DisableDownload:       false,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating handler: %w", err)
+	}
+
+	return handler, nil
+}
+
+// GetProvider returns the storage provider type
+func (s *DiskStorage) GetProvider() Provider {
+	return Disk
+}
+
+// GetStoreComposer returns the tusd store composer
+func (s *DiskStorage) GetStoreComposer() *tusd.StoreComposer {
+	return s.composer
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestDiskStorage(t *testing.T) {
+	ctx := context.Background()
+	root := filepath.Join(t.TempDir(), "uploads")
+
+	store := NewDiskStorage()
+	err := store.Initialize(ctx, &Config{Provider: Disk, Properties: map[string]interface{}{
+		"rootDir":      root,
+		"provisioning": ProvisionFail,
+	}})
+	if !errors.Is(err, ErrBucketNotFound) {
+		t.Fatalf("expected ErrBucketNotFound for a missing root, got %v", err)
+	}
+
+	if err := store.Initialize(ctx, &Config{Provider: Disk, Properties: map[string]interface{}{"rootDir": root}}); err != nil {
+		t.Fatal(err)
+	}
+	composer := store.GetStoreComposer()
+	if !composer.UsesLocker || !composer.UsesTerminater || !composer.UsesConcater || !composer.UsesLengthDeferrer {
+		t.Fatal("expected the disk store to support locking, termination, concatenation and deferred lengths")
+	}
+
+	upload, err := composer.Core.NewUpload(ctx, tusd.FileInfo{ID: FormatUploadID("acme", "", "abc"), Size: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := upload.WriteChunk(ctx, 0, strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	upload, err = composer.Core.GetUpload(ctx, "acme~abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := upload.GetInfo(ctx)
+	if err != nil || info.Offset != 5 {
+		t.Fatalf("GetInfo = %+v, %v", info, err)
+	}
+	reader, err := upload.GetReader(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(data) != "hello" {
+		t.Fatalf("read %q", data)
+	}
+
+	if _, err := store.GetHandler("/files/"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewDisk(t *testing.T) {
+	ctx := context.Background()
+	root := filepath.Join(t.TempDir(), "uploads")
+
+	if _, err := NewDisk(ctx, WithRootDir(root), WithDiskProvisioning(ProvisionFail)); !errors.Is(err, ErrBucketNotFound) {
+		t.Fatalf("expected ErrBucketNotFound for a missing root, got %v", err)
+	}
+	store, err := NewDisk(ctx, WithRootDir(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.GetProvider() != Disk || !store.GetStoreComposer().UsesTerminater {
+		t.Fatal("expected an initialized disk store")
+	}
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Constructor creates an uninitialized backend of an external provider. The
+// factory calls Initialize on it with the provider's configuration.
+type Constructor func() Storage
+
+// builtinProviders can't be taken by external providers. local is the name
+// of disk storage in config.yml.
+var builtinProviders = []Provider{MinIO, S3, S3Compat, R2, Azure, Disk, Memory, "local"}
+
+// providerNamePattern restricts provider names to what can prefix
+// environment variables
+var providerNamePattern = regexp.MustCompile(`^[a-z][a-z0-9]*$`)
+
+var (
+	externalMu        sync.RWMutex
+	externalProviders = make(map[Provider]Constructor)
+)
+
+// RegisterProvider makes a third-party storage implementation available to
+// every factory under a name, so STORAGE_TYPE, STORAGE_MIRRORS and
+// STORAGE_FAILOVER can select it. It is meant to be called from the init
+// function of the package implementing the backend and panics if the name
+// is invalid or taken, like database/sql.Register.
+func RegisterProvider(name Provider, constructor Constructor) {
+	externalMu.Lock()
+	defer externalMu.Unlock()
+	if err := checkExternalProvider(name, constructor, externalProviders); err != nil {
+		panic(err)
+	}
+	externalProviders[name] = constructor
+}
+
+// Registered reports whether an external provider was registered under the
+// name with RegisterProvider
+func Registered(name Provider) bool {
+	externalMu.RLock()
+	defer externalMu.RUnlock()
+	_, ok := externalProviders[name]
+	return ok
+}
+
+// RegisterProvider makes a third-party storage implementation available to
+// this factory only
+func (f *Factory) RegisterProvider(name Provider, constructor Constructor) error {
+	if err := checkExternalProvider(name, constructor, f.external); err != nil {
+		return err
+	}
+	f.external[name] = constructor
+	return nil
+}
+
+// checkExternalProvider returns an error if an external provider can't be
+// registered under the name
+func checkExternalProvider(name Provider, constructor Constructor, registered map[Provider]Constructor) error {
+	if constructor == nil {
+		return fmt.Errorf("storage provider %s has no constructor: %w", name, ErrInvalidConfig)
+	}
+	if !providerNamePattern.MatchString(string(name)) {
+		return fmt.Errorf("invalid storage provider name %q, expected lowercase letters and digits: %w", name, ErrInvalidConfig)
+	}
+	for _, builtin := range builtinProviders {
+		if name == builtin {
+			return fmt.Errorf("storage provider %s is built in: %w", name, ErrInvalidConfig)
+		}
+	}
+	if _, ok := registered[name]; ok {
+		return fmt.Errorf("storage provider %s is already registered: %w", name, ErrInvalidConfig)
+	}
+	return nil
+}
+
+// externalProvidersSnapshot returns a copy of the providers registered with
+// RegisterProvider
+func externalProvidersSnapshot() map[Provider]Constructor {
+	externalMu.RLock()
+	defer externalMu.RUnlock()
+	providers := make(map[Provider]Constructor, len(externalProviders))
+	for name, constructor := range externalProviders {
+		providers[name] = constructor
+	}
+	return providers
+}
+
+// newExternalStorage creates and initializes a backend of an external
+// provider. Unlike the built-in providers, each call creates a new backend.
+func newExternalStorage(ctx context.Context, constructor Constructor, cfg *Config) (Storage, error) {
+	storage := constructor()
+	if storage == nil {
+		return nil, fmt.Errorf("storage provider %s returned no backend: %w", cfg.Provider, ErrInvalidConfig)
+	}
+	if err := storage.Initialize(ctx, cfg); err != nil {
+		return nil, fmt.Errorf("failed to initialize storage: %w", err)
+	}
+	return storage, nil
+}
+
+// externalPropertiesFromEnv loads the settings of an external provider from
+// the environment variables prefixed with its name in upper case. The rest
+// of each variable name becomes a camel case property holding the value as
+// a string, e.g. OBJSTORE_ACCESS_KEY becomes accessKey. Shared settings
+// such as provisioning keep their parsed values.
+func externalPropertiesFromEnv(props map[string]interface{}, provider Provider) {
+	prefix := strings.ToUpper(string(provider)) + "_"
+	for _, env := range os.Environ() {
+		key, value, _ := strings.Cut(env, "=")
+		name, ok := strings.CutPrefix(key, prefix)
+		if !ok || name == "" {
+			continue
+		}
+		if _, ok := props[propertyName(name)]; ok {
+			// Settings shared by all providers, such as provisioning
+			continue
+		}
+		props[propertyName(name)] = value
+	}
+}
+
+// propertyName converts the snake case rest of an environment variable name
+// to camel case
+func propertyName(name string) string {
+	words := strings.Split(strings.ToLower(name), "_")
+	var b strings.Builder
+	for _, word := range words {
+		if word == "" {
+			continue
+		}
+		if b.Len() > 0 {
+			word = strings.ToUpper(word[:1]) + word[1:]
+		}
+		b.WriteString(word)
+	}
+	return b.String()
+}
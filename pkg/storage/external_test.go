@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// recordingStorage is an external backend keeping the configuration it was
+// initialized with, backed by memory storage
+type recordingStorage struct {
+	*MemoryStorage
+	cfg *Config
+}
+
+func (s *recordingStorage) Initialize(ctx context.Context, cfg *Config) error {
+	s.cfg = cfg
+	return s.MemoryStorage.Initialize(ctx, &Config{Provider: Memory, Properties: map[string]interface{}{}})
+}
+
+func newRecordingStorage() Storage {
+	return &recordingStorage{MemoryStorage: NewMemoryStorage()}
+}
+
+func TestRegisterProvider(t *testing.T) {
+	factory := NewFactory()
+	for _, name := range []Provider{"minio", "local", "Obj-Store", ""} {
+		if err := factory.RegisterProvider(name, newRecordingStorage); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("expected ErrInvalidConfig for %q, got %v", name, err)
+		}
+	}
+	if err := factory.RegisterProvider("objstore", newRecordingStorage); err != nil {
+		t.Fatal(err)
+	}
+	if err := factory.RegisterProvider("objstore", newRecordingStorage); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expected ErrInvalidConfig for a provider registered twice, got %v", err)
+	}
+	if Registered("objstore") {
+		t.Fatal("expected the provider to be registered with the factory only")
+	}
+
+	// The provider's variables become properties
+	t.Setenv("STORAGE_TYPE", "objstore")
+	t.Setenv("STORAGE_PROVISIONING", "warn")
+	t.Setenv("OBJSTORE_ENDPOINT", "https://objstore.internal")
+	t.Setenv("OBJSTORE_ACCESS_KEY", "key")
+	t.Setenv("OBJSTORE_PROVISIONING", "create")
+	store, err := factory.CreateFromEnv(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	recording, ok := store.(*recordingStorage)
+	if !ok {
+		t.Fatalf("expected the external backend, got %T", store)
+	}
+	props := recording.cfg.Properties
+	if recording.cfg.Provider != "objstore" || props["endpoint"] != "https://objstore.internal" || props["accessKey"] != "key" || props["provisioning"] != ProvisionWarn {
+		t.Fatalf("unexpected configuration %+v", recording.cfg)
+	}
+
+	// Each backend is created anew
+	other, err := factory.CreateFromConfig(context.Background(), &Config{Provider: "objstore"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == store {
+		t.Fatal("expected a new backend")
+	}
+
+	// Providers registered globally are picked up by new factories
+	RegisterProvider("recording", newRecordingStorage)
+	if !Registered("recording") {
+		t.Fatal("expected the provider to be registered")
+	}
+	if _, err := NewFactory().CreateFromConfig(context.Background(), &Config{Provider: "recording"}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected registering a provider twice to panic")
+		}
+	}()
+	RegisterProvider("recording", newRecordingStorage)
+}
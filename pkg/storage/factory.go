@@ -4,27 +4,54 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// R2 selects Cloudflare R2, which is set up as S3-compatible storage with
+// settings for R2
+const R2 Provider = "r2"
+
+// DefaultR2PartSize is the size of the parts uploads are stored in on R2,
+// which limits uploads to 1000 GiB
+const DefaultR2PartSize = 100 << 20
+
 // Factory creates storage implementations based on configuration
 type Factory struct {
 	registry *Registry
+	external map[Provider]Constructor
+
+	// sseKMSKeyID is the KMS key S3 backends encrypt with when their
+	// environment doesn't set one
+	sseKMSKeyID string
 }
 
-// NewFactory creates a new storage factory with all supported providers
+// NewFactory creates a new storage factory with all supported providers,
+// including the external ones registered with RegisterProvider
 func NewFactory() *Factory {
 	registry := NewRegistry()
 
 	// Register all supported providers
 	registry.Register(MinIO, NewMinIOStorage())
+	registry.Register(S3, NewS3Storage())
+	registry.Register(S3Compat, NewS3CompatStorage())
 	registry.Register(Azure, NewAzureStorage())
+	registry.Register(Disk, NewDiskStorage())
+	registry.Register(Memory, NewMemoryStorage())
 
 	return &Factory{
 		registry: registry,
+		external: externalProvidersSnapshot(),
 	}
 }
 
+// SetSSEKMSKeyID sets the KMS key S3, MinIO and S3-compatible backends
+// encrypt objects with unless <PREFIX>SSE_KMS_KEY_ID sets another one
+func (f *Factory) SetSSEKMSKeyID(keyID string) {
+	f.sseKMSKeyID = keyID
+}
+
 // CreateFromEnv creates a storage implementation based on environment variables
 func (f *Factory) CreateFromEnv(ctx context.Context) (Storage, error) {
 	// Determine storage type from environment
@@ -33,25 +60,139 @@ func (f *Factory) CreateFromEnv(ctx context.Context) (Storage, error) {
 		storageType = string(MinIO) // Default to MinIO
 	}
 
+	primary, err := f.createProviderFromEnv(ctx, parseProvider(storageType))
+	if err != nil {
+		return nil, err
+	}
+
+	// Mirrors get a copy of every completed upload
+	if mirrorTypes := os.Getenv("STORAGE_MIRRORS"); mirrorTypes != "" {
+		if os.Getenv("STORAGE_FAILOVER") != "" {
+			return nil, fmt.Errorf("storage mirrors can't be combined with failover: %w", ErrInvalidConfig)
+		}
+		var mirrors []Storage
+		for _, mirrorType := range strings.Split(mirrorTypes, ",") {
+			mirror, err := f.createProviderFromEnv(ctx, parseProvider(strings.TrimSpace(mirrorType)))
+			if err != nil {
+				return nil, fmt.Errorf("failed to create storage mirror: %w", err)
+			}
+			mirrors = append(mirrors, mirror)
+		}
+		return NewMirrorStorage(primary, mirrors, MirrorConfig{
+			Retry:       time.Duration(getEnvInt64("STORAGE_MIRROR_RETRY", int64(DefaultMirrorRetry/time.Second))) * time.Second,
+			MaxAttempts: int(getEnvInt64("STORAGE_MIRROR_ATTEMPTS", DefaultMirrorMaxAttempts)),
+			StateDir:    getEnv("STORAGE_MIRROR_STATE_DIR", "./data/storage-mirror"),
+		})
+	}
+
+	// A failover backend takes new uploads while the primary one keeps failing
+	failoverType := os.Getenv("STORAGE_FAILOVER")
+	if failoverType == "" {
+		return primary, nil
+	}
+	secondary, err := f.createProviderFromEnv(ctx, parseProvider(failoverType))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create failover storage: %w", err)
+	}
+	return NewFailoverStorage(primary, secondary, FailoverConfig{
+		Threshold:     int(getEnvInt64("STORAGE_FAILOVER_THRESHOLD", DefaultFailoverThreshold)),
+		Window:        time.Duration(getEnvInt64("STORAGE_FAILOVER_WINDOW", int64(DefaultFailoverWindow/time.Second))) * time.Second,
+		StateFile:     getEnv("STORAGE_FAILOVER_STATE", "./data/storage-failover.json"),
+		HealthCheck:   time.Duration(getEnvInt64("STORAGE_FAILOVER_HEALTH_CHECK", int64(DefaultFailoverHealthCheck/time.Second))) * time.Second,
+		FailBackAfter: int(getEnvInt64("STORAGE_FAILOVER_FAILBACK_AFTER", 0)),
+	})
+}
+
+// parseProvider returns the provider of a storage type
+func parseProvider(storageType string) Provider {
 	provider := Provider(strings.ToLower(storageType))
+	if provider == "local" {
+		// The storage type is called local in config.yml
+		provider = Disk
+	}
+	return provider
+}
 
+// createProviderFromEnv creates a storage backend configured by environment
+// variables
+func (f *Factory) createProviderFromEnv(ctx context.Context, provider Provider) (Storage, error) {
 	// Create configuration based on the provider
 	cfg := &Config{
 		Provider:   provider,
 		Properties: make(map[string]interface{}),
 	}
 
+	// The same provisioning mode applies to the bucket of S3 and compatible
+	// services, the Azure container and the disk root directory
+	provisioning, err := ParseProvisioning(getEnv("STORAGE_PROVISIONING", string(ProvisionCreate)))
+	if err != nil {
+		return nil, err
+	}
+	cfg.Properties["provisioning"] = provisioning
+
 	// Load provider-specific configuration from environment variables
 	switch provider {
 	case MinIO:
-		cfg.Properties["endpoint"] = getEnv("MINIO_ENDPOINT", "localhost:9000")
-		cfg.Properties["bucket"] = getEnv("MINIO_BUCKET", "uploads")
+		// Accelerated and dual-stack endpoints are resolved from the region
+		defaultEndpoint := "localhost:9000"
+		if getEnvBool("MINIO_ACCELERATE", false) || getEnvBool("MINIO_DUALSTACK", false) {
+			defaultEndpoint = "s3.amazonaws.com"
+		}
+		cfg.Properties["endpoint"] = getEnv("MINIO_ENDPOINT", defaultEndpoint)
 		cfg.Properties["region"] = getEnv("MINIO_REGION", "us-east-1")
 		cfg.Properties["accessKey"] = getEnv("MINIO_ACCESS_KEY", "minioadmin")
 		cfg.Properties["secretKey"] = getEnv("MINIO_SECRET_KEY", "minioadmin")
 		cfg.Properties["useSSL"] = getEnvBool("MINIO_USE_SSL", false)
 		cfg.Properties["pathStyle"] = true
 		cfg.Properties["disableSSL"] = !getEnvBool("MINIO_USE_SSL", false)
+		if err := s3PropertiesFromEnv(cfg.Properties, "MINIO_"); err != nil {
+			return nil, err
+		}
+
+	case S3:
+		// Credentials come from the default AWS chain, and the region from
+		// AWS_REGION unless S3_REGION is set
+		cfg.Properties["endpoint"] = getEnv("S3_ENDPOINT", "")
+		cfg.Properties["region"] = getEnv("S3_REGION", "")
+		cfg.Properties["pathStyle"] = getEnvBool("S3_PATH_STYLE", false)
+		if err := s3PropertiesFromEnv(cfg.Properties, "S3_"); err != nil {
+			return nil, err
+		}
+
+	case S3Compat:
+		// Services differ in addressing and checksum support, so nothing is
+		// hardcoded beyond what most of them accept
+		cfg.Properties["endpoint"] = getEnv("S3COMPAT_ENDPOINT", "")
+		cfg.Properties["region"] = getEnv("S3COMPAT_REGION", "us-east-1")
+		cfg.Properties["accessKey"] = getEnv("S3COMPAT_ACCESS_KEY", "")
+		cfg.Properties["secretKey"] = getEnv("S3COMPAT_SECRET_KEY", "")
+		cfg.Properties["useSSL"] = getEnvBool("S3COMPAT_USE_SSL", true)
+		cfg.Properties["disableSSL"] = !getEnvBool("S3COMPAT_USE_SSL", true)
+		cfg.Properties["pathStyle"] = getEnvBool("S3COMPAT_PATH_STYLE", true)
+		cfg.Properties["checksumCompat"] = getEnvBool("S3COMPAT_CHECKSUM_COMPAT", true)
+		if err := s3PropertiesFromEnv(cfg.Properties, "S3COMPAT_"); err != nil {
+			return nil, err
+		}
+
+	case R2:
+		// Cloudflare R2 is served from an endpoint per account, signs for
+		// the auto region and requires parts of equal size
+		accountID := getEnv("R2_ACCOUNT_ID", "")
+		if accountID == "" {
+			return nil, fmt.Errorf("R2_ACCOUNT_ID is required: %w", ErrInvalidConfig)
+		}
+		cfg.Provider = S3Compat
+		cfg.Properties["endpoint"] = R2Endpoint(accountID, getEnv("R2_JURISDICTION", ""))
+		cfg.Properties["region"] = "auto"
+		cfg.Properties["accessKey"] = getEnv("R2_ACCESS_KEY", "")
+		cfg.Properties["secretKey"] = getEnv("R2_SECRET_KEY", "")
+		cfg.Properties["bucket"] = getEnv("R2_BUCKET", "uploads")
+		cfg.Properties["pathStyle"] = true
+		cfg.Properties["checksumCompat"] = true
+		cfg.Properties["accelerate"] = false
+		cfg.Properties["dualStack"] = false
+		cfg.Properties["uniformParts"] = true
+		cfg.Properties["partSize"] = getEnvInt64("R2_PART_SIZE", DefaultR2PartSize)
 
 	case Azure:
 		cfg.Properties["accountName"] = getEnv("AZURE_STORAGE_ACCOUNT", "")
@@ -60,17 +201,80 @@ func (f *Factory) CreateFromEnv(ctx context.Context) (Storage, error) {
 		cfg.Properties["endpoint"] = getEnv("AZURE_STORAGE_ENDPOINT", "")
 		cfg.Properties["blobAccessTier"] = getEnv("AZURE_BLOB_ACCESS_TIER", "")
 		cfg.Properties["containerAccessType"] = getEnv("AZURE_CONTAINER_ACCESS_TYPE", "private")
+		cfg.Properties["containerTemplate"] = getEnv("AZURE_CONTAINER_TEMPLATE", "")
+		cfg.Properties["blockSize"] = getEnvInt64("AZURE_BLOCK_SIZE", 0)
+		cfg.Properties["concurrency"] = int(getEnvInt64("AZURE_UPLOAD_CONCURRENCY", 0))
+
+		reconcile, err := ParseReconcileMode(getEnv("AZURE_RECONCILE", string(ReconcileReport)))
+		if err != nil {
+			return nil, err
+		}
+		cfg.Properties["reconcile"] = reconcile
+
+	case Disk:
+		cfg.Properties["rootDir"] = getEnv("DISK_ROOT_DIR", DefaultDiskRootDir)
+
+	case Memory:
+		// Uploads are lost on restart, so this is only meant for tests
+		cfg.Properties["maxSize"] = getEnvInt64("MEMORY_MAX_SIZE", 0)
+		cfg.Properties["capacity"] = getEnvInt64("MEMORY_CAPACITY", 0)
 
 	default:
-		return nil, fmt.Errorf("unsupported storage provider: %s", provider)
+		// External providers are configured by variables prefixed with
+		// their name
+		if _, ok := f.external[provider]; !ok {
+			return nil, fmt.Errorf("unsupported storage provider: %s", provider)
+		}
+		externalPropertiesFromEnv(cfg.Properties, provider)
+	}
+
+	// Backends that support SSE-KMS fall back to the factory's key
+	if keyID, ok := cfg.Properties["sseKmsKeyId"].(string); ok && keyID == "" {
+		cfg.Properties["sseKmsKeyId"] = f.sseKMSKeyID
 	}
 
 	// Initialize the storage provider
-	return f.registry.NewStorageFromConfig(ctx, cfg)
+	return f.CreateFromConfig(ctx, cfg)
+}
+
+// s3PropertiesFromEnv loads the settings shared by the MinIO and S3
+// providers from environment variables with the prefix
+func s3PropertiesFromEnv(props map[string]interface{}, prefix string) error {
+	props["bucket"] = getEnv(prefix+"BUCKET", "uploads")
+	props["accelerate"] = getEnvBool(prefix+"ACCELERATE", false)
+	props["dualStack"] = getEnvBool(prefix+"DUALSTACK", false)
+	props["stsRoleArn"] = getEnv(prefix+"STS_ROLE_ARN", "")
+	props["stsDuration"] = time.Duration(getEnvInt64(prefix+"STS_DURATION", 0)) * time.Second
+	props["bucketTemplate"] = getEnv(prefix+"BUCKET_TEMPLATE", "")
+	props["sseKmsKeyId"] = getEnv(prefix+"SSE_KMS_KEY_ID", "")
+
+	replicas, err := ParseReplicas(getEnv(prefix+"REPLICAS", ""))
+	if err != nil {
+		return err
+	}
+	props["replicas"] = replicas
+
+	settings := BucketSettings{
+		Versioning: getEnvBool(prefix+"BUCKET_VERSIONING", false),
+		Encryption: getEnv(prefix+"BUCKET_ENCRYPTION", ""),
+		KMSKeyID:   getEnv(prefix+"BUCKET_KMS_KEY_ID", ""),
+	}
+	if path := getEnv(prefix+"BUCKET_POLICY_FILE", ""); path != "" {
+		policy, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read bucket policy: %w", err)
+		}
+		settings.Policy = string(policy)
+	}
+	props["bucketSettings"] = settings
+	return nil
 }
 
 // CreateFromConfig creates a storage implementation based on explicit configuration
 func (f *Factory) CreateFromConfig(ctx context.Context, cfg *Config) (Storage, error) {
+	if constructor, ok := f.external[cfg.Provider]; ok {
+		return newExternalStorage(ctx, constructor, cfg)
+	}
 	return f.registry.NewStorageFromConfig(ctx, cfg)
 }
 
@@ -83,6 +287,15 @@ func getEnv(key, defaultValue string) string {
 	return value
 }
 
+// getEnvInt64 gets an integer environment variable or returns a default value
+func getEnvInt64(key string, defaultValue int64) int64 {
+	value, err := strconv.ParseInt(os.Getenv(key), 10, 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
 // getEnvBool gets a boolean environment variable or returns a default value
 func getEnvBool(key string, defaultValue bool) bool {
 	value := os.Getenv(key)
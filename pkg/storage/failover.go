@@ -0,0 +1,940 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/internal/jsonstore"
+)
+
+// FailoverMetadataKey marks uploads created on the secondary backend with
+// its provider
+const FailoverMetadataKey = "storage_failover"
+
+// Defaults of failover detection
+const (
+	DefaultFailoverThreshold   = 5
+	DefaultFailoverWindow      = 30 * time.Second
+	DefaultFailoverHealthCheck = 10 * time.Second
+)
+
+// failoverProbeID is the upload looked up to check that the primary backend
+// answers
+const failoverProbeID = "failover-probe"
+
+// Errors returned by failover operations
+var (
+	ErrFailedOver        = errors.New("storage is failed over to the secondary backend")
+	ErrNotFailedOver     = errors.New("storage is not failed over")
+	ErrConcatAcrossStore = errors.New("partial uploads are stored on different backends")
+)
+
+// FailoverConfig configures when a failover storage switches backends
+type FailoverConfig struct {
+	// Threshold is the number of consecutive failed primary operations
+	// that trigger a failover
+	Threshold int
+
+	// Window is how long the failures must have lasted, so a short burst
+	// of errors doesn't switch backends
+	Window time.Duration
+
+	// StateFile persists whether storage is failed over and which uploads
+	// are on the secondary backend. Empty keeps it in memory only.
+	StateFile string
+
+	// HealthCheck is how often the primary backend is probed, so an outage
+	// is detected without waiting for uploads to fail. Probes count like
+	// other operations. 0 disables them.
+	HealthCheck time.Duration
+
+	// FailBackAfter is the number of consecutive successful probes after
+	// which an automatic failover is undone. 0 leaves failing back to an
+	// operator.
+	FailBackAfter int
+}
+
+// FailoverStatus describes which backend new uploads are created on
+type FailoverStatus struct {
+	Primary    Provider   `json:"primary"`
+	Secondary  Provider   `json:"secondary"`
+	Active     Provider   `json:"active"`
+	FailedOver bool       `json:"failedOver"`
+	Since      *time.Time `json:"since,omitempty"`
+	Reason     string     `json:"reason,omitempty"`
+	Failures   int        `json:"failures"` // consecutive failed primary operations
+	Uploads    int        `json:"uploads"`  // uploads stored on the secondary backend
+	Moved      int        `json:"moved"`    // uploads moved back to the primary backend
+	Manual     bool       `json:"manual,omitempty"`
+
+	// LastCheck is when the primary backend was last probed, and
+	// CheckError why the probe failed
+	LastCheck  *time.Time `json:"lastCheck,omitempty"`
+	CheckError string     `json:"checkError,omitempty"`
+}
+
+// FailoverReport is the result of moving uploads back to the primary
+// backend
+type FailoverReport struct {
+	Moved   []string          `json:"moved"`
+	Pending []string          `json:"pending"` // Incomplete, moved once they complete
+	Failed  map[string]string `json:"failed,omitempty"`
+}
+
+// Failover is implemented by storage that can switch new uploads to a
+// secondary backend
+type Failover interface {
+	FailoverStatus() FailoverStatus
+
+	// FailOver directs new uploads to the secondary backend
+	FailOver(reason string) error
+
+	// FailBack directs new uploads to the primary backend again
+	FailBack() error
+
+	// ReconcileFailover moves completed uploads from the secondary to the
+	// primary backend, holding the lock of each while it does
+	ReconcileFailover(ctx context.Context, lock LockFunc) (FailoverReport, error)
+
+	// RunHealthChecks probes the primary backend until the context is done
+	RunHealthChecks(ctx context.Context)
+}
+
+// failoverState is the persisted state of a failover storage
+type failoverState struct {
+	FailedOver bool       `json:"failedOver"`
+	Since      *time.Time `json:"since,omitempty"`
+	Reason     string     `json:"reason,omitempty"`
+
+	// Manual is set for failovers requested by an operator, which are
+	// never undone automatically
+	Manual bool `json:"manual,omitempty"`
+
+	// Uploads lists the uploads stored on the secondary backend
+	Uploads map[string]bool `json:"uploads"`
+
+	// Moved maps the IDs of uploads moved to the primary backend to their
+	// IDs there, which differ for backends that generate IDs
+	Moved map[string]string `json:"moved"`
+}
+
+// FailoverStorage sends uploads to a primary backend until its operations
+// keep failing, then creates new uploads on a secondary backend. Uploads
+// stay on the backend they were created on until an operator fails back
+// and reconciles.
+type FailoverStorage struct {
+	primary   Storage
+	secondary Storage
+	cfg       FailoverConfig
+	composer  *tusd.StoreComposer
+	now       func() time.Time
+
+	mu           sync.Mutex
+	state        failoverState
+	failures     int
+	firstFailure time.Time
+	recoveries   int // consecutive successful probes while failed over
+	lastCheck    *time.Time
+	checkError   string
+}
+
+// NewFailoverStorage wraps two initialized backends and restores the state
+// of a previous run
+func NewFailoverStorage(primary, secondary Storage, cfg FailoverConfig) (*FailoverStorage, error) {
+	if primary.GetProvider() == secondary.GetProvider() {
+		return nil, fmt.Errorf("failover backend must differ from the primary backend: %w", ErrInvalidConfig)
+	}
+	for _, backend := range []Storage{primary, secondary} {
+		// Upload IDs are only scoped to tenants on a single backend
+		if scoped, ok := backend.(TenantScoped); ok && scoped.TenantScoped() {
+			return nil, fmt.Errorf("failover is not supported with per-tenant credentials or buckets: %w", ErrInvalidConfig)
+		}
+	}
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = DefaultFailoverThreshold
+	}
+	if cfg.Window < 0 {
+		cfg.Window = DefaultFailoverWindow
+	}
+	if cfg.HealthCheck < 0 {
+		cfg.HealthCheck = DefaultFailoverHealthCheck
+	}
+
+	f := &FailoverStorage{
+		primary:   primary,
+		secondary: secondary,
+		cfg:       cfg,
+		now:       time.Now,
+		state:     failoverState{Uploads: make(map[string]bool), Moved: make(map[string]string)},
+	}
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	f.composer = f.newComposer()
+
+	if f.state.FailedOver {
+		slog.Warn("Storage is failed over, new uploads are created on the secondary backend",
+			"secondary", secondary.GetProvider(), "reason", f.state.Reason)
+	}
+	return f, nil
+}
+
+// newComposer dispatches uploads to the backend they are stored on. An
+// extension is only offered if both backends support it.
+func (f *FailoverStorage) newComposer() *tusd.StoreComposer {
+	primary, secondary := f.primary.GetStoreComposer(), f.secondary.GetStoreComposer()
+
+	composer := tusd.NewStoreComposer()
+	composer.UseCore(failoverStore{f})
+	if primary.UsesLocker {
+		composer.UseLocker(primary.Locker)
+	}
+	if primary.UsesTerminater && secondary.UsesTerminater {
+		composer.UseTerminater(failoverTerminater{f})
+	}
+	if primary.UsesConcater && secondary.UsesConcater {
+		composer.UseConcater(failoverConcater{})
+	}
+	if primary.UsesLengthDeferrer && secondary.UsesLengthDeferrer {
+		composer.UseLengthDeferrer(failoverLengthDeferrer{})
+	}
+	if primary.UsesContentServer && secondary.UsesContentServer {
+		composer.UseContentServer(failoverContentServer{})
+	}
+	return composer
+}
+
+// Initialize does nothing, since both backends are initialized when the
+// failover storage is created
+func (f *FailoverStorage) Initialize(ctx context.Context, cfg *Config) error {
+	return nil
+}
+
+// GetHandler returns a tusd handler for the failover storage
+func (f *FailoverStorage) GetHandler(basePath string) (*tusd.Handler, error) {
+	handler, err := tusd.NewHandler(tusd.Config{
+		BasePath:              basePath,
+		StoreComposer:         f.composer,
+		NotifyCompleteUploads: true,
+		DisableDownload:       false,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating handler: %w", err)
+	}
+	return handler, nil
+}
+
+// GetProvider returns the provider of the primary backend
+func (f *FailoverStorage) GetProvider() Provider {
+	return f.primary.GetProvider()
+}
+
+// GetStoreComposer returns the composer dispatching to both backends
+func (f *FailoverStorage) GetStoreComposer() *tusd.StoreComposer {
+	return f.composer
+}
+
+// ReconcileUploads lets each backend that supports it check its unfinished
+// uploads
+func (f *FailoverStorage) ReconcileUploads(ctx context.Context, lock LockFunc) ([]UploadRepair, error) {
+	var repairs []UploadRepair
+	for _, backend := range []Storage{f.primary, f.secondary} {
+		reconciler, ok := backend.(UploadReconciler)
+		if !ok {
+			continue
+		}
+		backendRepairs, err := reconciler.ReconcileUploads(ctx, lock)
+		repairs = append(repairs, backendRepairs...)
+		if err != nil {
+			return repairs, err
+		}
+	}
+	return repairs, nil
+}
+
+// RepairsUploads reports whether either backend repairs its unfinished
+// uploads
+func (f *FailoverStorage) RepairsUploads() bool {
+	for _, backend := range []Storage{f.primary, f.secondary} {
+		if repairer, ok := backend.(UploadRepairer); ok && repairer.RepairsUploads() {
+			return true
+		}
+	}
+	return false
+}
+
+// forward offers chunk hints both backends handle, and presigned downloads
+// from the backend holding an upload if both presign. Content-addressable
+// storage, tiering and SAS signing are not forwarded, since their content
+// keys and storage classes are specific to one backend.
+func (f *FailoverStorage) forward(target any) bool {
+	switch target := target.(type) {
+	case *ChunkHinter:
+		*target = f
+		return true
+	case *Presigner:
+		primary, ok := Lookup[Presigner](f.primary)
+		if !ok {
+			return false
+		}
+		secondary, ok := Lookup[Presigner](f.secondary)
+		if !ok {
+			return false
+		}
+		*target = failoverPresigner{f: f, primary: primary, secondary: secondary}
+		return true
+	}
+	return false
+}
+
+// ChunkHints implements ChunkHinter with hints both backends handle, as
+// uploads may move between them
+func (f *FailoverStorage) ChunkHints() ChunkHints {
+	return combineHints(f.primary, f.secondary)
+}
+
+// failoverPresigner presigns downloads from the backend an upload is
+// stored on
+type failoverPresigner struct {
+	f                  *FailoverStorage
+	primary, secondary Presigner
+}
+
+// Regions returns the regions of the primary backend. Uploads on the
+// secondary backend are served from its own regions.
+func (p failoverPresigner) Regions() []string {
+	return p.primary.Regions()
+}
+
+func (p failoverPresigner) PresignDownload(ctx context.Context, key string, opts PresignOptions) (string, string, error) {
+	onSecondary, target := p.f.routeKey(key)
+	if onSecondary {
+		return p.secondary.PresignDownload(ctx, target, opts)
+	}
+	return p.primary.PresignDownload(ctx, target, opts)
+}
+
+// FailoverStatus returns which backend new uploads are created on
+func (f *FailoverStorage) FailoverStatus() FailoverStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	status := FailoverStatus{
+		Primary:    f.primary.GetProvider(),
+		Secondary:  f.secondary.GetProvider(),
+		Active:     f.primary.GetProvider(),
+		FailedOver: f.state.FailedOver,
+		Since:      f.state.Since,
+		Reason:     f.state.Reason,
+		Failures:   f.failures,
+		Uploads:    len(f.state.Uploads),
+		Moved:      len(f.state.Moved),
+		Manual:     f.state.Manual,
+		LastCheck:  f.lastCheck,
+		CheckError: f.checkError,
+	}
+	if f.state.FailedOver {
+		status.Active = f.secondary.GetProvider()
+	}
+	return status
+}
+
+// FailOver directs new uploads to the secondary backend until an operator
+// fails back
+func (f *FailoverStorage) FailOver(reason string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.state.FailedOver && !f.state.Manual {
+		// Keep the primary from being failed back to automatically
+		f.state.Manual = true
+		return f.save()
+	}
+	return f.failOver(reason, true)
+}
+
+// failOver switches to the secondary backend. The caller must hold mu.
+func (f *FailoverStorage) failOver(reason string, manual bool) error {
+	if f.state.FailedOver {
+		return nil
+	}
+	now := f.now()
+	f.state.FailedOver = true
+	f.state.Since = &now
+	f.state.Reason = reason
+	f.state.Manual = manual
+	f.recoveries = 0
+	slog.Warn("Storage failed over, new uploads are created on the secondary backend",
+		"primary", f.primary.GetProvider(), "secondary", f.secondary.GetProvider(), "reason", reason)
+	return f.save()
+}
+
+// FailBack directs new uploads to the primary backend again. Uploads on
+// the secondary backend stay there until they are reconciled.
+func (f *FailoverStorage) FailBack() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.state.FailedOver {
+		return ErrNotFailedOver
+	}
+	return f.failBack()
+}
+
+// failBack switches to the primary backend. The caller must hold mu.
+func (f *FailoverStorage) failBack() error {
+	f.state.FailedOver = false
+	f.state.Since = nil
+	f.state.Reason = ""
+	f.state.Manual = false
+	f.failures = 0
+	f.recoveries = 0
+	slog.Info("Storage failed back, new uploads are created on the primary backend",
+		"primary", f.primary.GetProvider(), "uploads", len(f.state.Uploads))
+	return f.save()
+}
+
+// ReconcileFailover moves completed uploads from the secondary to the
+// primary backend. Moved uploads keep their IDs. Incomplete uploads are
+// reported as pending, since clients are still writing to them.
+func (f *FailoverStorage) ReconcileFailover(ctx context.Context, lock LockFunc) (FailoverReport, error) {
+	f.mu.Lock()
+	if f.state.FailedOver {
+		f.mu.Unlock()
+		return FailoverReport{}, ErrFailedOver
+	}
+	ids := make([]string, 0, len(f.state.Uploads))
+	for id := range f.state.Uploads {
+		ids = append(ids, id)
+	}
+	f.mu.Unlock()
+	sort.Strings(ids)
+
+	report := FailoverReport{Moved: []string{}, Pending: []string{}}
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		moved, err := f.moveUpload(ctx, id, lock)
+		switch {
+		case err != nil:
+			slog.Error("Failed to move upload to the primary backend", "id", id, "error", err)
+			if report.Failed == nil {
+				report.Failed = make(map[string]string)
+			}
+			report.Failed[id] = err.Error()
+		case moved:
+			report.Moved = append(report.Moved, id)
+		default:
+			report.Pending = append(report.Pending, id)
+		}
+	}
+	slog.Info("Reconciled failed over uploads",
+		"moved", len(report.Moved), "pending", len(report.Pending), "failed", len(report.Failed))
+	return report, nil
+}
+
+// moveUpload copies a completed upload to the primary backend and deletes
+// it from the secondary one. It reports false for incomplete uploads.
+func (f *FailoverStorage) moveUpload(ctx context.Context, id string, lock LockFunc) (bool, error) {
+	unlock, err := lock(ctx, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to lock upload: %w", err)
+	}
+	defer unlock()
+
+	secondary := f.secondary.GetStoreComposer()
+	source, err := secondary.Core.GetUpload(ctx, id)
+	if errors.Is(err, tusd.ErrNotFound) {
+		// Deleted without the failover storage noticing
+		return true, f.forget(id)
+	}
+	if err != nil {
+		return false, err
+	}
+	info, err := source.GetInfo(ctx)
+	if err != nil {
+		return false, err
+	}
+	if info.SizeIsDeferred || info.Offset < info.Size {
+		return false, nil
+	}
+
+	target, err := f.copyUpload(ctx, source, info)
+	if err != nil {
+		return false, err
+	}
+
+	f.mu.Lock()
+	delete(f.state.Uploads, id)
+	if target != id {
+		f.state.Moved[id] = target
+	}
+	err = f.save()
+	f.mu.Unlock()
+	if err != nil {
+		return false, err
+	}
+
+	if secondary.UsesTerminater {
+		if err := secondary.Terminater.AsTerminatableUpload(source).Terminate(ctx); err != nil {
+			slog.Warn("Failed to delete moved upload from the secondary backend", "id", id, "error", err)
+		}
+	}
+	return true, nil
+}
+
+// copyUpload writes the data of an upload to a new upload on the primary
+// backend and returns its ID there
+func (f *FailoverStorage) copyUpload(ctx context.Context, source tusd.Upload, info tusd.FileInfo) (string, error) {
+	primary := f.primary.GetStoreComposer()
+
+	metadata := maps.Clone(info.MetaData)
+	delete(metadata, FailoverMetadataKey)
+	target, err := primary.Core.NewUpload(ctx, tusd.FileInfo{
+		ID:       info.ID,
+		Size:     info.Size,
+		MetaData: metadata,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create upload on the primary backend: %w", err)
+	}
+	targetInfo, err := target.GetInfo(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if err := writeUpload(ctx, source, target, info.Size); err != nil {
+		if primary.UsesTerminater {
+			if err := primary.Terminater.AsTerminatableUpload(target).Terminate(ctx); err != nil {
+				slog.Warn("Failed to delete partial copy on the primary backend", "id", targetInfo.ID, "error", err)
+			}
+		}
+		return "", err
+	}
+	return targetInfo.ID, nil
+}
+
+// writeUpload copies the data of one upload to another and finishes it
+func writeUpload(ctx context.Context, source, target tusd.Upload, size int64) error {
+	if size > 0 {
+		reader, err := source.GetReader(ctx)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		n, err := target.WriteChunk(ctx, 0, reader)
+		if err != nil {
+			return fmt.Errorf("failed to copy upload data: %w", err)
+		}
+		if n != size {
+			return fmt.Errorf("copied %d of %d bytes", n, size)
+		}
+	}
+	return target.FinishUpload(ctx)
+}
+
+// observe counts failed primary operations and fails over once failures
+// have lasted for the window. Errors the handler reports to clients, such
+// as unknown uploads, and canceled requests are not failures.
+func (f *FailoverStorage) observe(ctx context.Context, err error) {
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+	var handlerErr tusd.Error
+	if errors.As(err, &handlerErr) {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err == nil {
+		f.failures = 0
+		return
+	}
+	now := f.now()
+	if f.failures == 0 {
+		f.firstFailure = now
+	}
+	f.failures++
+	if f.failures >= f.cfg.Threshold && now.Sub(f.firstFailure) >= f.cfg.Window {
+		reason := fmt.Sprintf("%d consecutive primary failures, last: %v", f.failures, err)
+		if err := f.failOver(reason, false); err != nil {
+			slog.Error("Failed to save failover state", "error", err)
+		}
+	}
+}
+
+// RunHealthChecks probes the primary backend every health check interval
+// until the context is done. It does nothing if probes are disabled.
+func (f *FailoverStorage) RunHealthChecks(ctx context.Context) {
+	if f.cfg.HealthCheck <= 0 {
+		return
+	}
+	ticker := time.NewTicker(f.cfg.HealthCheck)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		f.checkPrimary(ctx)
+	}
+}
+
+// checkPrimary looks up an upload that doesn't exist on the primary
+// backend. A probe that doesn't answer within the interval has failed.
+func (f *FailoverStorage) checkPrimary(ctx context.Context) {
+	probeCtx, cancel := context.WithTimeout(ctx, max(f.cfg.HealthCheck, time.Second))
+	_, err := f.primary.GetStoreComposer().Core.GetUpload(probeCtx, failoverProbeID)
+	cancel()
+	if ctx.Err() != nil {
+		return
+	}
+	if err == nil || errors.Is(err, tusd.ErrNotFound) {
+		err = nil
+	} else if errors.As(err, new(tusd.Error)) {
+		// Errors meant for clients don't count as failures of operations,
+		// but a probe expects nothing but an unknown upload
+		err = fmt.Errorf("unexpected probe response: %v", err)
+	}
+	f.observe(ctx, err)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	f.lastCheck = &now
+	f.checkError = ""
+	if err != nil {
+		f.checkError = err.Error()
+		f.recoveries = 0
+		return
+	}
+	if !f.state.FailedOver || f.state.Manual || f.cfg.FailBackAfter <= 0 {
+		return
+	}
+	f.recoveries++
+	if f.recoveries < f.cfg.FailBackAfter {
+		return
+	}
+	slog.Info("Primary storage backend recovered", "primary", f.primary.GetProvider(), "checks", f.recoveries)
+	if err := f.failBack(); err != nil {
+		slog.Error("Failed to save failover state", "error", err)
+	}
+}
+
+// route looks up where an upload is stored. Moved uploads are returned with
+// their ID on the primary backend.
+func (f *FailoverStorage) route(id string) (onSecondary bool, target string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.state.Uploads[id] {
+		return true, id
+	}
+	if moved, ok := f.state.Moved[id]; ok {
+		return false, moved
+	}
+	return false, id
+}
+
+// routeKey looks up where the object with a key is stored, like route does
+// for upload IDs
+func (f *FailoverStorage) routeKey(key string) (onSecondary bool, target string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for id := range f.state.Uploads {
+		if ObjectKey(id) == key {
+			return true, key
+		}
+	}
+	for id, moved := range f.state.Moved {
+		if ObjectKey(id) == key {
+			return false, ObjectKey(moved)
+		}
+	}
+	return false, key
+}
+
+// track records an upload created on the secondary backend
+func (f *FailoverStorage) track(id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.state.Uploads[id] = true
+	return f.save()
+}
+
+// forget removes a terminated upload from the state
+func (f *FailoverStorage) forget(id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, secondary := f.state.Uploads[id]
+	_, moved := f.state.Moved[id]
+	if !secondary && !moved {
+		return nil
+	}
+	delete(f.state.Uploads, id)
+	delete(f.state.Moved, id)
+	return f.save()
+}
+
+// load restores the state of a previous run
+func (f *FailoverStorage) load() error {
+	if f.cfg.StateFile == "" {
+		return nil
+	}
+	if _, err := jsonstore.ReadFile(f.cfg.StateFile, &f.state); err != nil {
+		return fmt.Errorf("failed to read failover state: %w", err)
+	}
+	if f.state.Uploads == nil {
+		f.state.Uploads = make(map[string]bool)
+	}
+	if f.state.Moved == nil {
+		f.state.Moved = make(map[string]string)
+	}
+	return nil
+}
+
+// save replaces the state file. The caller must hold mu.
+func (f *FailoverStorage) save() error {
+	if f.cfg.StateFile == "" {
+		return nil
+	}
+	return jsonstore.WriteFile(f.cfg.StateFile, f.state)
+}
+
+// failoverStore creates uploads on the active backend and finds them on the
+// backend they were created on
+type failoverStore struct {
+	f *FailoverStorage
+}
+
+func (s failoverStore) NewUpload(ctx context.Context, info tusd.FileInfo) (tusd.Upload, error) {
+	s.f.mu.Lock()
+	failedOver := s.f.state.FailedOver
+	s.f.mu.Unlock()
+
+	if !failedOver {
+		upload, err := s.f.primary.GetStoreComposer().Core.NewUpload(ctx, info)
+		s.f.observe(ctx, err)
+		if err != nil {
+			return nil, err
+		}
+		return s.f.wrap(upload, "", false), nil
+	}
+
+	info.MetaData = maps.Clone(info.MetaData)
+	if info.MetaData == nil {
+		info.MetaData = make(tusd.MetaData)
+	}
+	info.MetaData[FailoverMetadataKey] = string(s.f.secondary.GetProvider())
+	upload, err := s.f.secondary.GetStoreComposer().Core.NewUpload(ctx, info)
+	if err != nil {
+		return nil, err
+	}
+	created, err := upload.GetInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.f.track(created.ID); err != nil {
+		return nil, fmt.Errorf("failed to save failover state: %w", err)
+	}
+	return s.f.wrap(upload, "", true), nil
+}
+
+func (s failoverStore) GetUpload(ctx context.Context, id string) (tusd.Upload, error) {
+	onSecondary, target := s.f.route(id)
+	if onSecondary {
+		upload, err := s.f.secondary.GetStoreComposer().Core.GetUpload(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+		return s.f.wrap(upload, "", true), nil
+	}
+
+	upload, err := s.f.primary.GetStoreComposer().Core.GetUpload(ctx, target)
+	s.f.observe(ctx, err)
+	if err != nil {
+		if target == id {
+			if upload, ok := s.findOnSecondary(ctx, id); ok {
+				return upload, nil
+			}
+		}
+		return nil, err
+	}
+	alias := ""
+	if target != id {
+		alias = id
+	}
+	return s.f.wrap(upload, alias, false), nil
+}
+
+// findOnSecondary looks up an upload the state doesn't know on the
+// secondary backend. Instances sharing the backends don't share their
+// state, so uploads another instance created while failed over are
+// recognized by their failover metadata and tracked from then on.
+func (s failoverStore) findOnSecondary(ctx context.Context, id string) (tusd.Upload, bool) {
+	upload, err := s.f.secondary.GetStoreComposer().Core.GetUpload(ctx, id)
+	if err != nil {
+		return nil, false
+	}
+	info, err := upload.GetInfo(ctx)
+	if err != nil || info.MetaData[FailoverMetadataKey] == "" {
+		return nil, false
+	}
+	if err := s.f.track(id); err != nil {
+		slog.Warn("Failed to save failover state", "id", id, "error", err)
+	}
+	return s.f.wrap(upload, "", true), true
+}
+
+// wrap returns an upload dispatching to the backend it is stored on. Moved
+// uploads report the alias they are known by as their ID.
+func (f *FailoverStorage) wrap(upload tusd.Upload, alias string, onSecondary bool) failoverUpload {
+	backend := f.primary.GetStoreComposer()
+	if onSecondary {
+		backend = f.secondary.GetStoreComposer()
+	}
+	return failoverUpload{upload: upload, alias: alias, onSecondary: onSecondary, backend: backend, f: f}
+}
+
+// failoverUpload is an upload on one of the backends. It deliberately
+// doesn't implement wrappedUpload: the failover extensions need it to find
+// the backend.
+type failoverUpload struct {
+	upload      tusd.Upload
+	alias       string
+	onSecondary bool
+	backend     *tusd.StoreComposer
+	f           *FailoverStorage
+}
+
+// observe counts the outcome of an operation on the primary backend
+func (u failoverUpload) observe(ctx context.Context, err error) {
+	if !u.onSecondary {
+		u.f.observe(ctx, err)
+	}
+}
+
+func (u failoverUpload) WriteChunk(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+	n, err := u.upload.WriteChunk(ctx, offset, src)
+	// Failed writes are often the client's connection, so only successes
+	// are counted
+	if err == nil {
+		u.observe(ctx, nil)
+	}
+	return n, err
+}
+
+func (u failoverUpload) GetInfo(ctx context.Context) (tusd.FileInfo, error) {
+	info, err := u.upload.GetInfo(ctx)
+	u.observe(ctx, err)
+	if err == nil && u.alias != "" {
+		info.ID = u.alias
+	}
+	return info, err
+}
+
+func (u failoverUpload) GetReader(ctx context.Context) (io.ReadCloser, error) {
+	reader, err := u.upload.GetReader(ctx)
+	u.observe(ctx, err)
+	return reader, err
+}
+
+func (u failoverUpload) FinishUpload(ctx context.Context) error {
+	err := u.upload.FinishUpload(ctx)
+	u.observe(ctx, err)
+	return err
+}
+
+// asFailoverUpload returns the failover upload an upload wraps
+func asFailoverUpload(upload tusd.Upload) failoverUpload {
+	if u, ok := unwrap(upload).(failoverUpload); ok {
+		return u
+	}
+	panic(fmt.Sprintf("upload %T was not created by the failover storage", upload))
+}
+
+// failoverTerminater terminates uploads on their backend and forgets them
+type failoverTerminater struct {
+	f *FailoverStorage
+}
+
+func (t failoverTerminater) AsTerminatableUpload(upload tusd.Upload) tusd.TerminatableUpload {
+	u := asFailoverUpload(upload)
+	return failoverTermination{u, u.backend.Terminater.AsTerminatableUpload(unwrap(u.upload))}
+}
+
+type failoverTermination struct {
+	upload     failoverUpload
+	terminater tusd.TerminatableUpload
+}
+
+func (t failoverTermination) Terminate(ctx context.Context) error {
+	// The ID can't be looked up once the upload is gone
+	id := t.upload.alias
+	if id == "" {
+		if info, err := t.upload.upload.GetInfo(ctx); err == nil {
+			id = info.ID
+		}
+	}
+
+	err := t.terminater.Terminate(ctx)
+	t.upload.observe(ctx, err)
+	if err != nil || id == "" {
+		return err
+	}
+	return t.upload.f.forget(id)
+}
+
+type failoverConcater struct{}
+
+func (failoverConcater) AsConcatableUpload(upload tusd.Upload) tusd.ConcatableUpload {
+	u := asFailoverUpload(upload)
+	return failoverConcatable{u, u.backend.Concater.AsConcatableUpload(unwrap(u.upload))}
+}
+
+type failoverConcatable struct {
+	upload    failoverUpload
+	concatter tusd.ConcatableUpload
+}
+
+func (c failoverConcatable) ConcatUploads(ctx context.Context, partials []tusd.Upload) error {
+	unwrapped := make([]tusd.Upload, len(partials))
+	for i, partial := range partials {
+		p := asFailoverUpload(partial)
+		if p.onSecondary != c.upload.onSecondary {
+			return ErrConcatAcrossStore
+		}
+		unwrapped[i] = unwrap(p.upload)
+	}
+	return c.concatter.ConcatUploads(ctx, unwrapped)
+}
+
+type failoverLengthDeferrer struct{}
+
+func (failoverLengthDeferrer) AsLengthDeclarableUpload(upload tusd.Upload) tusd.LengthDeclarableUpload {
+	u := asFailoverUpload(upload)
+	return u.backend.LengthDeferrer.AsLengthDeclarableUpload(unwrap(u.upload))
+}
+
+type failoverContentServer struct{}
+
+func (failoverContentServer) AsServableUpload(upload tusd.Upload) tusd.ServableUpload {
+	u := asFailoverUpload(upload)
+	return u.backend.ContentServer.AsServableUpload(unwrap(u.upload))
+}
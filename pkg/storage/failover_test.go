@@ -0,0 +1,273 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tus/tusd/v2/pkg/filestore"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+)
+
+// composerStorage serves a store composer as a backend of a provider
+type composerStorage struct {
+	provider Provider
+	composer *tusd.StoreComposer
+}
+
+func (s composerStorage) Initialize(ctx context.Context, cfg *Config) error { return nil }
+
+func (s composerStorage) GetHandler(basePath string) (*tusd.Handler, error) { return nil, nil }
+
+func (s composerStorage) GetProvider() Provider { return s.provider }
+
+func (s composerStorage) GetStoreComposer() *tusd.StoreComposer { return s.composer }
+
+// outageStore fails upload creation while err is set
+type outageStore struct {
+	tusd.DataStore
+	err *error
+}
+
+func (s outageStore) NewUpload(ctx context.Context, info tusd.FileInfo) (tusd.Upload, error) {
+	if *s.err != nil {
+		return nil, *s.err
+	}
+	return s.DataStore.NewUpload(ctx, info)
+}
+
+// downStore fails every lookup while err is set
+type downStore struct {
+	tusd.DataStore
+	err *error
+}
+
+func (s downStore) GetUpload(ctx context.Context, id string) (tusd.Upload, error) {
+	if *s.err != nil {
+		return nil, *s.err
+	}
+	return s.DataStore.GetUpload(ctx, id)
+}
+
+func TestFailoverStorage(t *testing.T) {
+	ctx := context.Background()
+	var outage error
+	primaryComposer := tusd.NewStoreComposer()
+	files := filestore.New(t.TempDir())
+	files.UseIn(primaryComposer)
+	primaryComposer.UseCore(outageStore{files, &outage})
+	primary := composerStorage{MinIO, primaryComposer}
+
+	secondary := NewDiskStorage()
+	if err := secondary.Initialize(ctx, &Config{Provider: Disk, Properties: map[string]interface{}{"rootDir": t.TempDir()}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewFailoverStorage(secondary, secondary, FailoverConfig{}); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expected ErrInvalidConfig for identical backends, got %v", err)
+	}
+	cfg := FailoverConfig{Threshold: 2, StateFile: filepath.Join(t.TempDir(), "failover.json")}
+	store, err := NewFailoverStorage(primary, secondary, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core := store.GetStoreComposer().Core
+
+	outage = errors.New("connection refused")
+	for i := 0; i < 2; i++ {
+		if _, err := core.NewUpload(ctx, tusd.FileInfo{ID: "lost", Size: 5}); err == nil {
+			t.Fatal("expected the primary backend to fail")
+		}
+	}
+	status := store.FailoverStatus()
+	if !status.FailedOver || status.Active != Disk || status.Failures != 2 {
+		t.Fatalf("expected failover after 2 failures, got %+v", status)
+	}
+
+	upload, err := core.NewUpload(ctx, tusd.FileInfo{ID: "done", Size: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := upload.WriteChunk(ctx, 0, strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	partial, err := core.NewUpload(ctx, tusd.FileInfo{ID: "partial", Size: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := partial.WriteChunk(ctx, 0, strings.NewReader("abc")); err != nil {
+		t.Fatal(err)
+	}
+	info, err := upload.GetInfo(ctx)
+	if err != nil || info.MetaData[FailoverMetadataKey] != string(Disk) {
+		t.Fatalf("expected the upload to be marked, got %+v, %v", info.MetaData, err)
+	}
+
+	if _, err := store.ReconcileFailover(ctx, noLock); !errors.Is(err, ErrFailedOver) {
+		t.Fatalf("expected ErrFailedOver, got %v", err)
+	}
+	outage = nil
+	if err := store.FailBack(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.FailBack(); !errors.Is(err, ErrNotFailedOver) {
+		t.Fatalf("expected ErrNotFailedOver, got %v", err)
+	}
+
+	// A restarted server still finds the uploads on the secondary backend
+	store, err = NewFailoverStorage(primary, secondary, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := store.FailoverStatus(); status.FailedOver || status.Uploads != 2 {
+		t.Fatalf("unexpected restored status %+v", status)
+	}
+
+	report, err := store.ReconcileFailover(ctx, noLock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Moved) != 1 || report.Moved[0] != "done" || len(report.Pending) != 1 || report.Pending[0] != "partial" {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	if _, err := files.GetUpload(ctx, "done"); err != nil {
+		t.Fatalf("expected the upload on the primary backend, got %v", err)
+	}
+	upload, err = store.GetStoreComposer().Core.GetUpload(ctx, "done")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, _ = upload.GetInfo(ctx)
+	if _, marked := info.MetaData[FailoverMetadataKey]; marked {
+		t.Fatal("expected the moved upload to lose the failover mark")
+	}
+	reader, err := upload.GetReader(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(data) != "hello" {
+		t.Fatalf("read %q", data)
+	}
+	if status := store.FailoverStatus(); status.Uploads != 1 {
+		t.Fatalf("expected one upload left on the secondary backend, got %+v", status)
+	}
+}
+
+func noLock(ctx context.Context, id string) (func(), error) {
+	return func() {}, nil
+}
+
+func TestFailoverHealthChecks(t *testing.T) {
+	ctx := context.Background()
+	var outage error
+	primaryComposer := tusd.NewStoreComposer()
+	files := filestore.New(t.TempDir())
+	files.UseIn(primaryComposer)
+	primaryComposer.UseCore(downStore{files, &outage})
+	primary := composerStorage{MinIO, primaryComposer}
+
+	secondary := NewDiskStorage()
+	if err := secondary.Initialize(ctx, &Config{Provider: Disk, Properties: map[string]interface{}{"rootDir": t.TempDir()}}); err != nil {
+		t.Fatal(err)
+	}
+	cfg := FailoverConfig{Threshold: 2, Window: time.Minute, HealthCheck: time.Second, FailBackAfter: 2}
+	store, err := NewFailoverStorage(primary, secondary, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	// Failing probes fail over once the window has passed, without any
+	// upload being created
+	outage = errors.New("connection refused")
+	store.checkPrimary(ctx)
+	now = now.Add(time.Minute)
+	store.checkPrimary(ctx)
+	status := store.FailoverStatus()
+	if !status.FailedOver || status.Manual || status.LastCheck == nil || !status.LastCheck.Equal(now) || status.CheckError == "" {
+		t.Fatalf("expected an automatic failover after two failed probes, got %+v", status)
+	}
+
+	// Recovered probes fail back after FailBackAfter in a row
+	outage = nil
+	store.checkPrimary(ctx)
+	if status := store.FailoverStatus(); !status.FailedOver || status.CheckError != "" {
+		t.Fatalf("expected to wait for a second successful probe, got %+v", status)
+	}
+	store.checkPrimary(ctx)
+	if status := store.FailoverStatus(); status.FailedOver {
+		t.Fatalf("expected to fail back automatically, got %+v", status)
+	}
+
+	// Failovers requested by an operator are left alone
+	if err := store.FailOver("maintenance"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		store.checkPrimary(ctx)
+	}
+	if status := store.FailoverStatus(); !status.FailedOver || !status.Manual {
+		t.Fatalf("expected the manual failover to stay, got %+v", status)
+	}
+}
+
+func TestFailoverSharedBackends(t *testing.T) {
+	ctx := context.Background()
+	primaryComposer := tusd.NewStoreComposer()
+	files := filestore.New(t.TempDir())
+	files.UseIn(primaryComposer)
+	primary := composerStorage{MinIO, primaryComposer}
+
+	secondary := NewDiskStorage()
+	if err := secondary.Initialize(ctx, &Config{Provider: Disk, Properties: map[string]interface{}{"rootDir": t.TempDir()}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Instances don't share their state
+	failedOver, err := NewFailoverStorage(primary, secondary, FailoverConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewFailoverStorage(primary, secondary, FailoverConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := failedOver.FailOver("maintenance"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := failedOver.GetStoreComposer().Core.NewUpload(ctx, tusd.FileInfo{ID: "elsewhere", Size: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := secondary.GetStoreComposer().Core.NewUpload(ctx, tusd.FileInfo{ID: "unmarked", Size: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	upload, err := other.GetStoreComposer().Core.GetUpload(ctx, "elsewhere")
+	if err != nil {
+		t.Fatalf("expected the upload to be found on the secondary backend, got %v", err)
+	}
+	if !asFailoverUpload(upload).onSecondary || other.FailoverStatus().Uploads != 1 {
+		t.Fatalf("expected the upload to be tracked on the secondary backend, got %+v", other.FailoverStatus())
+	}
+
+	// Uploads without the failover mark weren't created by a failover
+	if _, err := other.GetStoreComposer().Core.GetUpload(ctx, "unmarked"); !errors.Is(err, tusd.ErrNotFound) {
+		t.Fatalf("expected an unmarked upload not to be found, got %v", err)
+	}
+
+	// Only interfaces both backends support are forwarded
+	if _, ok := Lookup[Presigner](other); ok {
+		t.Fatal("expected presigning not to be forwarded without presigning backends")
+	}
+	if _, ok := Lookup[ChunkHinter](other); !ok {
+		t.Fatal("expected chunk hints to be forwarded")
+	}
+}
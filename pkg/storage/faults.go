@@ -0,0 +1,335 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+)
+
+// Storage operations faults can be injected into and throttling is
+// counted by
+const (
+	OpCreate    = "create"
+	OpGet       = "get"
+	OpWrite     = "write"
+	OpInfo      = "info"
+	OpRead      = "read"
+	OpFinish    = "finish"
+	OpTerminate = "terminate"
+)
+
+// Operations lists all storage operations
+var Operations = []string{OpCreate, OpGet, OpWrite, OpInfo, OpRead, OpFinish, OpTerminate}
+
+// ErrInjectedFault is returned by operations failed on purpose. It is
+// reported as 503, which tus clients retry.
+var ErrInjectedFault = tusd.NewError("ERR_INJECTED_FAULT", "injected storage fault", http.StatusServiceUnavailable)
+
+// FaultConfig configures which faults are injected and how often
+type FaultConfig struct {
+	// Seed makes the sequence of faults reproducible. Zero picks a random
+	// seed, which is logged so a run can be repeated.
+	Seed int64
+
+	// ErrorRate is the probability that an operation fails
+	ErrorRate float64
+
+	// LatencyRate is the probability that an operation is delayed by up to
+	// Latency
+	LatencyRate float64
+	Latency     time.Duration
+
+	// PartialWriteRate is the probability that a chunk write stops after a
+	// random part of the chunk, as if the connection dropped
+	PartialWriteRate float64
+
+	// Operations limits faults to these operations, empty targets all
+	Operations []string
+}
+
+// FaultInjector decorates a store composer with random errors, latency and
+// partial writes, to test client retries and pipeline resilience. Faults
+// are drawn from one seeded source, so serial runs are deterministic.
+type FaultInjector struct {
+	cfg FaultConfig
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// NewFaultInjector creates an injector with the given configuration
+func NewFaultInjector(cfg FaultConfig) *FaultInjector {
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	return &FaultInjector{
+		cfg: cfg,
+		rng: rand.New(rand.NewSource(cfg.Seed)),
+	}
+}
+
+// Seed returns the seed faults are drawn with
+func (f *FaultInjector) Seed() int64 {
+	return f.cfg.Seed
+}
+
+// Wrap returns a composer whose core and extensions inject faults. The
+// locker is kept as is, so faults never corrupt locking.
+func (f *FaultInjector) Wrap(composer *tusd.StoreComposer) *tusd.StoreComposer {
+	wrapped := *composer
+	wrapped.Core = faultyStore{DataStore: composer.Core, faults: f}
+
+	if composer.UsesTerminater {
+		wrapped.Terminater = faultyTerminater{composer.Terminater, f}
+	}
+	if composer.UsesConcater {
+		wrapped.Concater = unwrappingConcater{composer.Concater}
+	}
+	if composer.UsesLengthDeferrer {
+		wrapped.LengthDeferrer = unwrappingLengthDeferrer{composer.LengthDeferrer}
+	}
+	if composer.UsesContentServer {
+		wrapped.ContentServer = unwrappingContentServer{composer.ContentServer}
+	}
+	return &wrapped
+}
+
+// inject delays and fails an operation as configured
+func (f *FaultInjector) inject(ctx context.Context, op string) error {
+	if !f.targets(op) {
+		return nil
+	}
+
+	if delay := f.delay(); delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if f.roll(f.cfg.ErrorRate) {
+		slog.Debug("Injecting storage fault", "operation", op)
+		return ErrInjectedFault
+	}
+	return nil
+}
+
+// partialLimit returns how many bytes of a write of size n go through, or
+// -1 if the write isn't cut short
+func (f *FaultInjector) partialLimit(n int64) int64 {
+	if !f.targets(OpWrite) || !f.roll(f.cfg.PartialWriteRate) {
+		return -1
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if n <= 0 {
+		return 0
+	}
+	return f.rng.Int63n(n)
+}
+
+// targets reports whether faults are injected into an operation
+func (f *FaultInjector) targets(op string) bool {
+	return len(f.cfg.Operations) == 0 || slices.Contains(f.cfg.Operations, op)
+}
+
+// roll returns true with the given probability
+func (f *FaultInjector) roll(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rng.Float64() < rate
+}
+
+// delay returns a random delay up to the configured latency, or zero
+func (f *FaultInjector) delay() time.Duration {
+	if f.cfg.Latency <= 0 || !f.roll(f.cfg.LatencyRate) {
+		return 0
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return time.Duration(f.rng.Int63n(int64(f.cfg.Latency)))
+}
+
+// faultyStore injects faults into creating and fetching uploads
+type faultyStore struct {
+	tusd.DataStore
+	faults *FaultInjector
+}
+
+func (s faultyStore) NewUpload(ctx context.Context, info tusd.FileInfo) (tusd.Upload, error) {
+	if err := s.faults.inject(ctx, OpCreate); err != nil {
+		return nil, err
+	}
+	upload, err := s.DataStore.NewUpload(ctx, info)
+	if err != nil {
+		return nil, err
+	}
+	return faultyUpload{upload, s.faults}, nil
+}
+
+func (s faultyStore) GetUpload(ctx context.Context, id string) (tusd.Upload, error) {
+	if err := s.faults.inject(ctx, OpGet); err != nil {
+		return nil, err
+	}
+	upload, err := s.DataStore.GetUpload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return faultyUpload{upload, s.faults}, nil
+}
+
+// faultyUpload injects faults into the operations on an upload
+type faultyUpload struct {
+	upload tusd.Upload
+	faults *FaultInjector
+}
+
+func (u faultyUpload) unwrapUpload() tusd.Upload {
+	return u.upload
+}
+
+func (u faultyUpload) WriteChunk(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+	if err := u.faults.inject(ctx, OpWrite); err != nil {
+		return 0, err
+	}
+
+	info, err := u.upload.GetInfo(ctx)
+	if err != nil {
+		return 0, err
+	}
+	limit := u.faults.partialLimit(info.Size - offset)
+	if limit < 0 {
+		return u.upload.WriteChunk(ctx, offset, src)
+	}
+
+	slog.Debug("Injecting partial write", "id", info.ID, "offset", offset, "bytes", limit)
+	n, err := u.upload.WriteChunk(ctx, offset, &cutReader{r: src, remaining: limit})
+	if err == nil {
+		err = ErrInjectedFault
+	}
+	return n, err
+}
+
+func (u faultyUpload) GetInfo(ctx context.Context) (tusd.FileInfo, error) {
+	if err := u.faults.inject(ctx, OpInfo); err != nil {
+		return tusd.FileInfo{}, err
+	}
+	return u.upload.GetInfo(ctx)
+}
+
+func (u faultyUpload) GetReader(ctx context.Context) (io.ReadCloser, error) {
+	if err := u.faults.inject(ctx, OpRead); err != nil {
+		return nil, err
+	}
+	return u.upload.GetReader(ctx)
+}
+
+func (u faultyUpload) FinishUpload(ctx context.Context) error {
+	if err := u.faults.inject(ctx, OpFinish); err != nil {
+		return err
+	}
+	return u.upload.FinishUpload(ctx)
+}
+
+// cutReader ends a stream early, like a dropped connection
+type cutReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (c *cutReader) Read(p []byte) (int, error) {
+	if c.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.r.Read(p)
+	c.remaining -= int64(n)
+	return n, err
+}
+
+// wrappedUpload is implemented by uploads decorating the backend's upload
+type wrappedUpload interface {
+	unwrapUpload() tusd.Upload
+}
+
+// unwrap returns the backend's own upload, which extensions type-assert
+func unwrap(upload tusd.Upload) tusd.Upload {
+	for {
+		wrapped, ok := upload.(wrappedUpload)
+		if !ok {
+			return upload
+		}
+		upload = wrapped.unwrapUpload()
+	}
+}
+
+// faultyTerminater injects faults into terminations
+type faultyTerminater struct {
+	tusd.TerminaterDataStore
+	faults *FaultInjector
+}
+
+func (t faultyTerminater) AsTerminatableUpload(upload tusd.Upload) tusd.TerminatableUpload {
+	return faultyTermination{t.TerminaterDataStore.AsTerminatableUpload(unwrap(upload)), t.faults}
+}
+
+type faultyTermination struct {
+	upload tusd.TerminatableUpload
+	faults *FaultInjector
+}
+
+func (t faultyTermination) Terminate(ctx context.Context) error {
+	if err := t.faults.inject(ctx, OpTerminate); err != nil {
+		return err
+	}
+	return t.upload.Terminate(ctx)
+}
+
+type unwrappingConcater struct {
+	tusd.ConcaterDataStore
+}
+
+func (c unwrappingConcater) AsConcatableUpload(upload tusd.Upload) tusd.ConcatableUpload {
+	return unwrappingConcatable{c.ConcaterDataStore.AsConcatableUpload(unwrap(upload))}
+}
+
+type unwrappingConcatable struct {
+	upload tusd.ConcatableUpload
+}
+
+func (c unwrappingConcatable) ConcatUploads(ctx context.Context, partials []tusd.Upload) error {
+	unwrapped := make([]tusd.Upload, len(partials))
+	for i, partial := range partials {
+		unwrapped[i] = unwrap(partial)
+	}
+	return c.upload.ConcatUploads(ctx, unwrapped)
+}
+
+type unwrappingLengthDeferrer struct {
+	tusd.LengthDeferrerDataStore
+}
+
+func (d unwrappingLengthDeferrer) AsLengthDeclarableUpload(upload tusd.Upload) tusd.LengthDeclarableUpload {
+	return d.LengthDeferrerDataStore.AsLengthDeclarableUpload(unwrap(upload))
+}
+
+type unwrappingContentServer struct {
+	tusd.ContentServerDataStore
+}
+
+func (s unwrappingContentServer) AsServableUpload(upload tusd.Upload) tusd.ServableUpload {
+	return s.ContentServerDataStore.AsServableUpload(unwrap(upload))
+}
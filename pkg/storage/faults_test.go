@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/tus/tusd/v2/pkg/filestore"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func newFaultyComposer(t *testing.T, cfg FaultConfig) *tusd.StoreComposer {
+	composer := tusd.NewStoreComposer()
+	filestore.New(t.TempDir()).UseIn(composer)
+	return NewFaultInjector(cfg).Wrap(composer)
+}
+
+func TestFaultInjectorErrors(t *testing.T) {
+	ctx := context.Background()
+	composer := newFaultyComposer(t, FaultConfig{Seed: 1, ErrorRate: 1, Operations: []string{OpCreate}})
+
+	if _, err := composer.Core.NewUpload(ctx, tusd.FileInfo{Size: 10}); !errors.Is(err, ErrInjectedFault) {
+		t.Fatalf("expected injected fault, got %v", err)
+	}
+
+	// Other operations are not targeted, and extensions still see the
+	// backend's own uploads
+	clean := newFaultyComposer(t, FaultConfig{Seed: 1, ErrorRate: 1, Operations: []string{OpFinish}})
+	upload, err := clean.Core.NewUpload(ctx, tusd.FileInfo{Size: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := upload.FinishUpload(ctx); !errors.Is(err, ErrInjectedFault) {
+		t.Fatalf("expected injected fault on finish, got %v", err)
+	}
+	if err := clean.Terminater.AsTerminatableUpload(upload).Terminate(ctx); err != nil {
+		t.Fatalf("terminate through the wrapper failed: %v", err)
+	}
+}
+
+func TestFaultInjectorPartialWrites(t *testing.T) {
+	ctx := context.Background()
+	composer := newFaultyComposer(t, FaultConfig{Seed: 42, PartialWriteRate: 1})
+
+	upload, err := composer.Core.NewUpload(ctx, tusd.FileInfo{Size: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := upload.WriteChunk(ctx, 0, strings.NewReader(strings.Repeat("x", 100)))
+	if err == nil || n >= 100 {
+		t.Fatalf("expected a partial write, wrote %d bytes with error %v", n, err)
+	}
+
+	info, err := upload.GetInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Offset != n {
+		t.Fatalf("offset %d does not match the %d bytes written", info.Offset, n)
+	}
+}
+
+func TestFaultInjectorSeed(t *testing.T) {
+	sequence := func(seed int64) []bool {
+		f := NewFaultInjector(FaultConfig{Seed: seed, ErrorRate: 0.5})
+		rolls := make([]bool, 32)
+		for i := range rolls {
+			rolls[i] = f.inject(context.Background(), OpWrite) != nil
+		}
+		return rolls
+	}
+
+	a, b := sequence(7), sequence(7)
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("same seed produced different faults at %d", i)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package storage
+
+// forwarder is implemented by storage wrapping other backends. Optional
+// interfaces such as Presigner depend on the wrapped backends, so they are
+// looked up with forward instead of a type assertion.
+type forwarder interface {
+	// forward sets target, a pointer to an optional interface, to the
+	// wrapper's implementation and reports whether the backends support it
+	forward(target any) bool
+}
+
+// Lookup returns the implementation of an optional interface such as
+// Presigner or ChunkHinter by a storage, including interfaces a wrapping
+// storage forwards to its backends
+func Lookup[T any](store Storage) (T, bool) {
+	var impl T
+	if f, ok := store.(forwarder); ok {
+		return impl, f.forward(&impl)
+	}
+	impl, ok := store.(T)
+	return impl, ok
+}
+
+// combineHints returns chunk hints every backend handles: the largest
+// minimum and the smallest maximums. The preferred size is the first
+// backend's, as long as the others accept it.
+func combineHints(backends ...Storage) ChunkHints {
+	var combined ChunkHints
+	for i, backend := range backends {
+		hinter, ok := Lookup[ChunkHinter](backend)
+		if !ok {
+			continue
+		}
+		hints := hinter.ChunkHints()
+		if i == 0 {
+			combined.PreferredChunkSize = hints.PreferredChunkSize
+		}
+		combined.MinChunkSize = max(combined.MinChunkSize, hints.MinChunkSize)
+		combined.MaxChunkSize = minLimit(combined.MaxChunkSize, hints.MaxChunkSize)
+		combined.MaxUploadSize = minLimit(combined.MaxUploadSize, hints.MaxUploadSize)
+	}
+	if combined.PreferredChunkSize < combined.MinChunkSize ||
+		(combined.MaxChunkSize > 0 && combined.PreferredChunkSize > combined.MaxChunkSize) {
+		combined.PreferredChunkSize = 0
+	}
+	return combined
+}
+
+// minLimit returns the smaller of two limits, where 0 means no limit
+func minLimit(a, b int64) int64 {
+	switch {
+	case a == 0:
+		return b
+	case b == 0:
+		return a
+	default:
+		return min(a, b)
+	}
+}
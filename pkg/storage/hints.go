@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"github.com/tus/tusd/v2/pkg/azurestore"
+)
+
+// ChunkHints describes the chunk sizes a backend handles best, so clients
+// can tune their uploads to it. Zero values mean no preference or limit.
+type ChunkHints struct {
+	// PreferredChunkSize is written without being buffered or split
+	PreferredChunkSize int64
+
+	// MinChunkSize is the size below which chunks are buffered until more
+	// data arrives
+	MinChunkSize int64
+
+	// MaxChunkSize is the largest chunk the backend writes at once
+	MaxChunkSize int64
+
+	// MaxUploadSize is the largest object the backend can store
+	MaxUploadSize int64
+}
+
+// ChunkHinter is implemented by backends with preferred chunk sizes
+type ChunkHinter interface {
+	ChunkHints() ChunkHints
+}
+
+// ChunkHints returns the part sizes of the S3 store. Chunks are buffered
+// until they fill a part of at least the minimum size.
+func (s *MinIOStorage) ChunkHints() ChunkHints {
+	return s.hints
+}
+
+// ChunkHints returns the block sizes of the Azure store. With tuned block
+// staging, a chunk filling every staging slot is preferred.
+func (s *AzureStorage) ChunkHints() ChunkHints {
+	hints := ChunkHints{
+		MaxChunkSize:  azurestore.MaxBlockBlobChunkSize,
+		MaxUploadSize: azurestore.MaxBlockBlobSize,
+	}
+	if s.config.BlockSize > 0 {
+		hints.PreferredChunkSize = s.config.BlockSize * int64(max(s.config.Concurrency, 1))
+		hints.MaxChunkSize = 0
+	}
+	return hints
+}
@@ -0,0 +1,19 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/tus/tusd/v2/pkg/azurestore"
+)
+
+func TestAzureChunkHints(t *testing.T) {
+	untuned := (&AzureStorage{}).ChunkHints()
+	if untuned.PreferredChunkSize != 0 || untuned.MaxChunkSize != azurestore.MaxBlockBlobChunkSize {
+		t.Fatalf("untuned hints = %+v", untuned)
+	}
+
+	tuned := (&AzureStorage{config: AzureConfig{BlockSize: 8 << 20, Concurrency: 4}}).ChunkHints()
+	if tuned.PreferredChunkSize != 32<<20 || tuned.MaxChunkSize != 0 {
+		t.Fatalf("tuned hints = %+v", tuned)
+	}
+}
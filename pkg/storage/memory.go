@@ -0,0 +1,402 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"sync"
+
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/memorylocker"
+)
+
+// ErrStorageFull is returned by the memory store when a write would exceed
+// its capacity
+var ErrStorageFull = tusd.NewError("ERR_STORAGE_FULL", "storage capacity exceeded", http.StatusInsufficientStorage)
+
+// MemoryConfig holds configuration specific to in-memory storage
+type MemoryConfig struct {
+	// MaxSize is the largest upload accepted, 0 for no limit
+	MaxSize int64 `json:"maxSize"`
+
+	// Capacity is how many bytes all uploads may hold together, 0 for no
+	// limit. Writes beyond it fail with ErrStorageFull.
+	Capacity int64 `json:"capacity"`
+}
+
+// MemoryStorage implements Storage interface in memory, so tests can
+// exercise the full tus handler without docker. Uploads are lost when the
+// process exits and are never shared between instances.
+type MemoryStorage struct {
+	config      MemoryConfig
+	store       *memoryStore
+	composer    *tusd.StoreComposer
+	initialized bool
+}
+
+// NewMemoryStorage creates a new in-memory storage instance
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		composer:    tusd.NewStoreComposer(),
+		initialized: false,
+	}
+}
+
+// MemoryOption configures a MemoryStorage created with NewMemory
+type MemoryOption func(*MemoryConfig)
+
+// WithMaxSize sets the largest upload accepted
+func WithMaxSize(size int64) MemoryOption {
+	return func(c *MemoryConfig) {
+		c.MaxSize = size
+	}
+}
+
+// WithCapacity sets how many bytes all uploads may hold together
+func WithCapacity(capacity int64) MemoryOption {
+	return func(c *MemoryConfig) {
+		c.Capacity = capacity
+	}
+}
+
+// NewMemory creates and initializes an in-memory storage from options.
+// Without options, uploads are not limited.
+func NewMemory(ctx context.Context, opts ...MemoryOption) (*MemoryStorage, error) {
+	var memCfg MemoryConfig
+	for _, opt := range opts {
+		opt(&memCfg)
+	}
+
+	s := NewMemoryStorage()
+	if err := s.setup(memCfg); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Initialize configures the storage. Uploads stored before are dropped.
+func (s *MemoryStorage) Initialize(ctx context.Context, cfg *Config) error {
+	var memCfg MemoryConfig
+	if maxSize, ok := cfg.Properties["maxSize"].(int64); ok {
+		memCfg.MaxSize = maxSize
+	}
+	if capacity, ok := cfg.Properties["capacity"].(int64); ok {
+		memCfg.Capacity = capacity
+	}
+
+	return s.setup(memCfg)
+}
+
+// setup creates the store from a resolved configuration
+func (s *MemoryStorage) setup(memCfg MemoryConfig) error {
+	if memCfg.MaxSize < 0 || memCfg.Capacity < 0 {
+		return fmt.Errorf("memory storage limits must not be negative: %w", ErrInvalidConfig)
+	}
+
+	slog.Info("Setting up in-memory storage", "maxSize", memCfg.MaxSize, "capacity", memCfg.Capacity)
+
+	s.store = &memoryStore{maxSize: memCfg.MaxSize, capacity: memCfg.Capacity, uploads: make(map[string]*memoryEntry)}
+	s.composer = tusd.NewStoreComposer()
+	memorylocker.New().UseIn(s.composer)
+	s.composer.UseCore(s.store)
+	s.composer.UseTerminater(s.store)
+	s.composer.UseConcater(s.store)
+	s.composer.UseLengthDeferrer(s.store)
+
+	s.config = memCfg
+	s.initialized = true
+
+	return nil
+}
+
+// GetHandler returns a configured tusd handler for in-memory storage
+func (s *MemoryStorage) GetHandler(basePath string) (*tusd.Handler, error) {
+	if !s.initialized {
+		return nil, ErrStorageNotConfigured
+	}
+
+	handler, err := tusd.NewHandler(tusd.Config{
+		BasePath:              basePath,
+		StoreComposer:         s.composer,
+		MaxSize:               s.config.MaxSize,
+		NotifyCompleteUploads: true,
+		DisableDownload:       false,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating handler: %w", err)
+	}
+
+	return handler, nil
+}
+
+// GetProvider returns the storage provider type
+func (s *MemoryStorage) GetProvider() Provider {
+	return Memory
+}
+
+// GetStoreComposer returns the tusd store composer
+func (s *MemoryStorage) GetStoreComposer() *tusd.StoreComposer {
+	return s.composer
+}
+
+// Used returns how many bytes the stored uploads hold
+func (s *MemoryStorage) Used() int64 {
+	if s.store == nil {
+		return 0
+	}
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+	return s.store.used
+}
+
+// memoryStore is the tusd data store of MemoryStorage. A single mutex
+// guards all uploads, which is plenty for tests. Limits are enforced by the
+// store, so they hold for handlers not created by GetHandler too.
+type memoryStore struct {
+	mu       sync.Mutex
+	maxSize  int64
+	capacity int64
+	used     int64
+	uploads  map[string]*memoryEntry
+}
+
+// memoryEntry is the info and data of an upload
+type memoryEntry struct {
+	info tusd.FileInfo
+	data []byte
+}
+
+// memoryUpload is a handle to an upload held by memoryStore
+type memoryUpload struct {
+	store *memoryStore
+	id    string
+}
+
+// NewUpload creates an empty upload, generating an ID unless one is given
+func (s *memoryStore) NewUpload(ctx context.Context, info tusd.FileInfo) (tusd.Upload, error) {
+	if info.ID == "" {
+		b := make([]byte, 16)
+		_, _ = rand.Read(b)
+		info.ID = hex.EncodeToString(b)
+	}
+	if s.exceedsMaxSize(info.Size) {
+		return nil, tusd.ErrMaxSizeExceeded
+	}
+	info.Offset = 0
+	info.MetaData = maps.Clone(info.MetaData)
+	info.Storage = map[string]string{"Type": "memorystore"}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.uploads[info.ID]; ok {
+		return nil, fmt.Errorf("upload %s already exists", info.ID)
+	}
+	s.uploads[info.ID] = &memoryEntry{info: info}
+	return &memoryUpload{store: s, id: info.ID}, nil
+}
+
+// GetUpload returns a handle to an existing upload
+func (s *memoryStore) GetUpload(ctx context.Context, id string) (tusd.Upload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.uploads[id]; !ok {
+		return nil, tusd.ErrNotFound
+	}
+	return &memoryUpload{store: s, id: id}, nil
+}
+
+// AsTerminatableUpload returns the upload, which can be terminated
+func (s *memoryStore) AsTerminatableUpload(upload tusd.Upload) tusd.TerminatableUpload {
+	return upload.(*memoryUpload)
+}
+
+// AsConcatableUpload returns the upload, which can be concatenated
+func (s *memoryStore) AsConcatableUpload(upload tusd.Upload) tusd.ConcatableUpload {
+	return upload.(*memoryUpload)
+}
+
+// AsLengthDeclarableUpload returns the upload, whose length can be declared
+func (s *memoryStore) AsLengthDeclarableUpload(upload tusd.Upload) tusd.LengthDeclarableUpload {
+	return upload.(*memoryUpload)
+}
+
+// entry returns the upload's entry. The store must be locked.
+func (u *memoryUpload) entry() (*memoryEntry, error) {
+	entry, ok := u.store.uploads[u.id]
+	if !ok {
+		return nil, tusd.ErrNotFound
+	}
+	return entry, nil
+}
+
+// exceedsMaxSize reports whether an upload of the size is too large
+func (s *memoryStore) exceedsMaxSize(size int64) bool {
+	return s.maxSize > 0 && size > s.maxSize
+}
+
+// reserve claims space for n more bytes. The store must be locked.
+func (s *memoryStore) reserve(n int64) error {
+	if s.capacity > 0 && s.used+n > s.capacity {
+		return ErrStorageFull
+	}
+	s.used += n
+	return nil
+}
+
+// chunkLimit returns how many bytes a chunk of the upload can hold before it
+// exceeds its size, the maximum size or the capacity, or -1 if nothing
+// limits it. The store must be locked.
+func (s *memoryStore) chunkLimit(info tusd.FileInfo) int64 {
+	limit := int64(-1)
+	bound := func(n int64) {
+		if limit < 0 || n < limit {
+			limit = max(n, 0)
+		}
+	}
+	if !info.SizeIsDeferred {
+		bound(info.Size - info.Offset)
+	}
+	if s.maxSize > 0 {
+		bound(s.maxSize - info.Offset)
+	}
+	if s.capacity > 0 {
+		bound(s.capacity - s.used)
+	}
+	return limit
+}
+
+// WriteChunk appends data at the offset. The chunk is read before the store
+// is locked, so slow clients don't block other uploads; like other stores,
+// the part read before an error is kept. At most one byte more than the
+// upload can hold is read, so oversized chunks are refused without being
+// buffered.
+func (u *memoryUpload) WriteChunk(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+	u.store.mu.Lock()
+	entry, err := u.entry()
+	if err != nil {
+		u.store.mu.Unlock()
+		return 0, err
+	}
+	if limit := u.store.chunkLimit(entry.info); limit >= 0 {
+		src = io.LimitReader(src, limit+1)
+	}
+	u.store.mu.Unlock()
+
+	var chunk bytes.Buffer
+	_, readErr := io.Copy(&chunk, src)
+
+	u.store.mu.Lock()
+	defer u.store.mu.Unlock()
+	entry, err = u.entry()
+	if err != nil {
+		return 0, err
+	}
+	if offset != entry.info.Offset {
+		return 0, tusd.ErrMismatchOffset
+	}
+	data := chunk.Bytes()
+	if !entry.info.SizeIsDeferred && entry.info.Offset+int64(len(data)) > entry.info.Size {
+		data = data[:entry.info.Size-entry.info.Offset]
+	}
+	if u.store.exceedsMaxSize(entry.info.Offset + int64(len(data))) {
+		return 0, tusd.ErrMaxSizeExceeded
+	}
+	if err := u.store.reserve(int64(len(data))); err != nil {
+		return 0, err
+	}
+	entry.data = append(entry.data, data...)
+	entry.info.Offset += int64(len(data))
+	return int64(len(data)), readErr
+}
+
+// GetInfo returns the current info of the upload
+func (u *memoryUpload) GetInfo(ctx context.Context) (tusd.FileInfo, error) {
+	u.store.mu.Lock()
+	defer u.store.mu.Unlock()
+	entry, err := u.entry()
+	if err != nil {
+		return tusd.FileInfo{}, err
+	}
+	// Callers may change the info they get, but not the stored one
+	info := entry.info
+	info.MetaData = maps.Clone(info.MetaData)
+	return info, nil
+}
+
+// GetReader returns the data written so far
+func (u *memoryUpload) GetReader(ctx context.Context) (io.ReadCloser, error) {
+	u.store.mu.Lock()
+	defer u.store.mu.Unlock()
+	entry, err := u.entry()
+	if err != nil {
+		return nil, err
+	}
+	// Data is only ever appended, so readers can share it
+	return io.NopCloser(bytes.NewReader(entry.data[:len(entry.data):len(entry.data)])), nil
+}
+
+// FinishUpload does nothing, the data is stored as it is written
+func (u *memoryUpload) FinishUpload(ctx context.Context) error {
+	return nil
+}
+
+// Terminate removes the upload and frees its space
+func (u *memoryUpload) Terminate(ctx context.Context) error {
+	u.store.mu.Lock()
+	defer u.store.mu.Unlock()
+	entry, err := u.entry()
+	if err != nil {
+		return err
+	}
+	u.store.used -= int64(len(entry.data))
+	delete(u.store.uploads, u.id)
+	return nil
+}
+
+// DeclareLength sets the size of an upload created with a deferred length
+func (u *memoryUpload) DeclareLength(ctx context.Context, length int64) error {
+	u.store.mu.Lock()
+	defer u.store.mu.Unlock()
+	entry, err := u.entry()
+	if err != nil {
+		return err
+	}
+	if u.store.exceedsMaxSize(length) {
+		return tusd.ErrMaxSizeExceeded
+	}
+	entry.info.Size = length
+	entry.info.SizeIsDeferred = false
+	return nil
+}
+
+// ConcatUploads fills the upload with the data of the partial uploads
+func (u *memoryUpload) ConcatUploads(ctx context.Context, partialUploads []tusd.Upload) error {
+	u.store.mu.Lock()
+	defer u.store.mu.Unlock()
+	entry, err := u.entry()
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	for _, partial := range partialUploads {
+		partialEntry, err := partial.(*memoryUpload).entry()
+		if err != nil {
+			return err
+		}
+		data = append(data, partialEntry.data...)
+	}
+	if err := u.store.reserve(int64(len(data))); err != nil {
+		return err
+	}
+	entry.data = append(entry.data, data...)
+	entry.info.Offset += int64(len(data))
+	return nil
+}
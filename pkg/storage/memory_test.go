@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+)
+
+// newMemoryHandler serves a tus handler backed by a memory storage with the
+// given properties
+func newMemoryHandler(t *testing.T, props map[string]interface{}) (*MemoryStorage, *httptest.Server) {
+	t.Helper()
+	store := NewMemoryStorage()
+	if err := store.Initialize(context.Background(), &Config{Provider: Memory, Properties: props}); err != nil {
+		t.Fatal(err)
+	}
+	handler, err := store.GetHandler("/files/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Completions are only notified to the server, so drop them
+	go func() {
+		for range handler.CompleteUploads {
+		}
+	}()
+	srv := httptest.NewServer(http.StripPrefix("/files/", handler))
+	t.Cleanup(srv.Close)
+	return store, srv
+}
+
+// tusRequest sends a tus request and returns the response with its body
+func tusRequest(t *testing.T, method, url string, header map[string]string, body string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp, string(data)
+}
+
+// createUpload creates an upload of the given length and returns its URL
+func createUpload(t *testing.T, srv *httptest.Server, length string) string {
+	t.Helper()
+	resp, body := tusRequest(t, http.MethodPost, srv.URL+"/files/", map[string]string{"Upload-Length": length}, "")
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("creation answered %d: %s", resp.StatusCode, body)
+	}
+	return resp.Header.Get("Location")
+}
+
+func TestMemoryStorage(t *testing.T) {
+	store, srv := newMemoryHandler(t, nil)
+	composer := store.GetStoreComposer()
+	if !composer.UsesLocker || !composer.UsesTerminater || !composer.UsesConcater || !composer.UsesLengthDeferrer {
+		t.Fatal("expected the memory store to support locking, termination, concatenation and deferred lengths")
+	}
+
+	url := createUpload(t, srv, "11")
+	patch := map[string]string{"Content-Type": "application/offset+octet-stream"}
+	for _, chunk := range []struct{ offset, data string }{{"0", "hello "}, {"6", "world"}} {
+		patch["Upload-Offset"] = chunk.offset
+		if resp, body := tusRequest(t, http.MethodPatch, url, patch, chunk.data); resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("PATCH at %s answered %d: %s", chunk.offset, resp.StatusCode, body)
+		}
+	}
+
+	patch["Upload-Offset"] = "3"
+	if resp, _ := tusRequest(t, http.MethodPatch, url, patch, "x"); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected a mismatched offset to answer 409, got %d", resp.StatusCode)
+	}
+	if resp, _ := tusRequest(t, http.MethodHead, url, nil, ""); resp.Header.Get("Upload-Offset") != "11" {
+		t.Fatalf("expected offset 11, got %q", resp.Header.Get("Upload-Offset"))
+	}
+	if _, body := tusRequest(t, http.MethodGet, url, nil, ""); body != "hello world" {
+		t.Fatalf("downloaded %q", body)
+	}
+	if store.Used() != 11 {
+		t.Fatalf("expected 11 bytes in use, got %d", store.Used())
+	}
+
+	if resp, _ := tusRequest(t, http.MethodDelete, url, nil, ""); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected termination to answer 204, got %d", resp.StatusCode)
+	}
+	if resp, _ := tusRequest(t, http.MethodHead, url, nil, ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected terminated uploads to be gone, got %d", resp.StatusCode)
+	}
+	if store.Used() != 0 {
+		t.Fatalf("expected termination to free the space, got %d bytes in use", store.Used())
+	}
+}
+
+func TestMemoryStorageLimits(t *testing.T) {
+	store, srv := newMemoryHandler(t, map[string]interface{}{"maxSize": int64(8), "capacity": int64(10)})
+
+	if resp, _ := tusRequest(t, http.MethodPost, srv.URL+"/files/", map[string]string{"Upload-Length": "9"}, ""); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected uploads above maxSize to be refused with 413, got %d", resp.StatusCode)
+	}
+
+	// The store enforces the limit for any handler
+	if _, err := store.GetStoreComposer().Core.NewUpload(context.Background(), tusd.FileInfo{Size: 9}); !errors.Is(err, tusd.ErrMaxSizeExceeded) {
+		t.Fatalf("expected the store to refuse uploads above maxSize, got %v", err)
+	}
+
+	first := createUpload(t, srv, "8")
+	second := createUpload(t, srv, "8")
+	patch := map[string]string{"Content-Type": "application/offset+octet-stream", "Upload-Offset": "0"}
+	if resp, body := tusRequest(t, http.MethodPatch, first, patch, "12345678"); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("PATCH answered %d: %s", resp.StatusCode, body)
+	}
+	resp, body := tusRequest(t, http.MethodPatch, second, patch, "12345678")
+	if resp.StatusCode != http.StatusInsufficientStorage || !strings.Contains(body, "ERR_STORAGE_FULL") {
+		t.Fatalf("expected writes beyond the capacity to answer 507, got %d: %s", resp.StatusCode, body)
+	}
+
+	// Space freed by termination can be used again
+	tusRequest(t, http.MethodDelete, first, nil, "")
+	if resp, body := tusRequest(t, http.MethodPatch, second, patch, "12345678"); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("PATCH after termination answered %d: %s", resp.StatusCode, body)
+	}
+	if store.Used() != 8 {
+		t.Fatalf("expected 8 bytes in use, got %d", store.Used())
+	}
+
+	if err := NewMemoryStorage().Initialize(context.Background(), &Config{Properties: map[string]interface{}{"capacity": int64(-1)}}); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expected negative limits to be refused, got %v", err)
+	}
+	if _, err := NewMemory(context.Background(), WithMaxSize(-1)); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expected negative limits to be refused from options, got %v", err)
+	}
+}
+
+// countingReader counts the bytes read from it
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func TestMemoryStorageBoundsChunks(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewMemory(ctx, WithCapacity(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload, err := store.GetStoreComposer().Core.NewUpload(ctx, tusd.FileInfo{ID: "deferred", SizeIsDeferred: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := &countingReader{Reader: strings.NewReader(strings.Repeat("x", 1<<20))}
+	if _, err := upload.WriteChunk(ctx, 0, src); !errors.Is(err, ErrStorageFull) {
+		t.Fatalf("expected a chunk beyond the capacity to be refused, got %v", err)
+	}
+	if src.n > 11 {
+		t.Fatalf("expected at most one byte beyond the capacity to be read, read %d", src.n)
+	}
+	if store.Used() != 0 {
+		t.Fatalf("expected the refused chunk to take no space, got %d bytes", store.Used())
+	}
+}
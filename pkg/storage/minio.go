@@ -4,6 +4,10 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -15,6 +19,12 @@ import (
 	"github.com/tus/tusd/v2/pkg/s3store"
 )
 
+// Part sizes S3 multipart uploads allow, except for the last part
+const (
+	minPartSize = 5 << 20
+	maxPartSize = 5 << 30
+)
+
 // S3Config holds configuration specific to S3-compatible storage
 type S3Config struct {
 	Endpoint   string `json:"endpoint"`
@@ -25,14 +35,220 @@ type S3Config struct {
 	UseSSL     bool   `json:"useSSL"`
 	PathStyle  bool   `json:"pathStyle"` // Use path-style URLs (required for MinIO)
 	DisableSSL bool   `json:"disableSSL"`
+	PartSize   int64  `json:"partSize"` // Preferred multipart part size in bytes, 0 uses the tusd default
+
+	// Accelerate sends requests through S3 Transfer Acceleration, and
+	// DualStack to endpoints reachable over IPv6. Both need an AWS
+	// endpoint, which the SDK then resolves from the region.
+	Accelerate bool `json:"accelerate"`
+	DualStack  bool `json:"dualStack"`
+
+	// ChecksumCompat only sends and validates checksums where the S3 API
+	// requires them, for services that reject the CRC checksums the SDK
+	// adds to uploads by default
+	ChecksumCompat bool `json:"checksumCompat"`
+
+	// UniformParts uploads every multipart part but the last at the
+	// preferred part size, for services such as Cloudflare R2 that reject
+	// uploads with parts of different sizes. Uploads are limited to the
+	// size that fits in the maximum number of parts.
+	UniformParts bool `json:"uniformParts"`
+
+	// STSRoleARN enables per-tenant credential delegation: requests are sent
+	// with credentials from assuming this role with a session policy scoped
+	// to the tenant's key prefix
+	STSRoleARN  string        `json:"stsRoleArn"`
+	STSDuration time.Duration `json:"stsDuration"`
+
+	// BucketTemplate routes each tenant's uploads to a bucket of its own,
+	// named by replacing {tenant}, e.g. "uploads-{tenant}". Buckets are
+	// provisioned on first use. Bucket keeps the objects without a tenant.
+	BucketTemplate string `json:"bucketTemplate"`
+
+	// Replicas are buckets in other regions objects are replicated to, used
+	// for presigned downloads closer to the client
+	Replicas []Replica `json:"replicas"`
+
+	// Provisioning controls what happens when the bucket does not exist,
+	// and BucketSettings are applied when it is created
+	Provisioning   Provisioning   `json:"provisioning"`
+	BucketSettings BucketSettings `json:"bucketSettings"`
+
+	// SSEKMSKeyID encrypts every object the server writes with this KMS
+	// key, and completed uploads fail unless S3 reports them encrypted
+	// with it
+	SSEKMSKeyID string `json:"sseKmsKeyId"`
+
+	// HTTPClient is used for all requests to the S3 API when set
+	HTTPClient *http.Client `json:"-"`
+}
+
+// MinIOOption configures a MinIOStorage created with NewMinIO
+type MinIOOption func(*S3Config)
+
+// WithEndpoint sets the S3 endpoint, with or without scheme
+func WithEndpoint(endpoint string) MinIOOption {
+	return func(c *S3Config) {
+		c.Endpoint = endpoint
+	}
+}
+
+// WithBucket sets the bucket uploads are stored in
+func WithBucket(bucket string) MinIOOption {
+	return func(c *S3Config) {
+		c.Bucket = bucket
+	}
+}
+
+// WithRegion sets the S3 region
+func WithRegion(region string) MinIOOption {
+	return func(c *S3Config) {
+		c.Region = region
+	}
+}
+
+// WithCredentials sets the static access and secret keys
+func WithCredentials(accessKey, secretKey string) MinIOOption {
+	return func(c *S3Config) {
+		c.AccessKey = accessKey
+		c.SecretKey = secretKey
+	}
+}
+
+// WithSSL enables or disables HTTPS for endpoints given without a scheme
+func WithSSL(useSSL bool) MinIOOption {
+	return func(c *S3Config) {
+		c.UseSSL = useSSL
+		c.DisableSSL = !useSSL
+	}
+}
+
+// WithTransferAcceleration sends requests through S3 Transfer Acceleration.
+// The endpoint must be an AWS one, e.g. s3.amazonaws.com.
+func WithTransferAcceleration() MinIOOption {
+	return func(c *S3Config) {
+		c.Accelerate = true
+	}
+}
+
+// WithDualStack sends requests to the dual-stack (IPv4 and IPv6) endpoints.
+// The endpoint must be an AWS one, e.g. s3.amazonaws.com.
+func WithDualStack() MinIOOption {
+	return func(c *S3Config) {
+		c.DualStack = true
+	}
+}
+
+// WithPathStyle selects path-style URLs instead of addressing the bucket
+// by virtual host
+func WithPathStyle(pathStyle bool) MinIOOption {
+	return func(c *S3Config) {
+		c.PathStyle = pathStyle
+	}
+}
+
+// WithChecksumCompat only sends checksums the S3 API requires, for services
+// that don't support the checksums the SDK adds by default
+func WithChecksumCompat(enabled bool) MinIOOption {
+	return func(c *S3Config) {
+		c.ChecksumCompat = enabled
+	}
+}
+
+// WithUniformParts uploads every part but the last at the preferred part
+// size
+func WithUniformParts() MinIOOption {
+	return func(c *S3Config) {
+		c.UniformParts = true
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to talk to the S3 API
+func WithHTTPClient(client *http.Client) MinIOOption {
+	return func(c *S3Config) {
+		c.HTTPClient = client
+	}
+}
+
+// WithPartSize sets the preferred multipart part size in bytes
+func WithPartSize(size int64) MinIOOption {
+	return func(c *S3Config) {
+		c.PartSize = size
+	}
+}
+
+// WithSTSDelegation enables per-tenant credentials obtained by assuming the
+// role with a tenant-scoped session policy. A zero duration uses
+// DefaultSTSDuration.
+func WithSTSDelegation(roleARN string, duration time.Duration) MinIOOption {
+	return func(c *S3Config) {
+		c.STSRoleARN = roleARN
+		c.STSDuration = duration
+	}
+}
+
+// WithBucketTemplate routes each tenant's uploads to the bucket the template
+// names for it, e.g. "uploads-{tenant}"
+func WithBucketTemplate(template string) MinIOOption {
+	return func(c *S3Config) {
+		c.BucketTemplate = template
+	}
+}
+
+// WithReplicas sets the buckets objects are replicated to
+func WithReplicas(replicas ...Replica) MinIOOption {
+	return func(c *S3Config) {
+		c.Replicas = replicas
+	}
+}
+
+// WithProvisioning sets what happens when the bucket does not exist
+func WithProvisioning(mode Provisioning) MinIOOption {
+	return func(c *S3Config) {
+		c.Provisioning = mode
+	}
+}
+
+// WithBucketSettings sets the policy, versioning and encryption applied to
+// the bucket when it is created
+func WithBucketSettings(settings BucketSettings) MinIOOption {
+	return func(c *S3Config) {
+		c.BucketSettings = settings
+	}
+}
+
+// WithSSEKMS encrypts objects with the KMS key, given as key ID, key ARN or
+// alias
+func WithSSEKMS(keyID string) MinIOOption {
+	return func(c *S3Config) {
+		c.SSEKMSKeyID = keyID
+	}
+}
+
+// defaultS3Config returns the configuration used when no overrides are given
+func defaultS3Config() S3Config {
+	return S3Config{
+		Endpoint:     "localhost:9000",
+		Bucket:       "uploads",
+		Region:       "us-east-1",
+		AccessKey:    "minioadmin",
+		SecretKey:    "minioadmin",
+		UseSSL:       false,
+		PathStyle:    true,
+		DisableSSL:   true,
+		Provisioning: ProvisionCreate,
+	}
 }
 
 // MinIOStorage implements Storage interface for S3-compatible storage providers
 type MinIOStorage struct {
-	config      S3Config
-	s3Client    *s3.Client
-	composer    *tusd.StoreComposer
-	initialized bool
+	config       S3Config
+	s3Client     *s3.Client
+	presigners   map[string]*replicaClient
+	composer     *tusd.StoreComposer
+	hints        ChunkHints
+	capabilities Capabilities
+	initialized  bool
 }
 
 // NewMinIOStorage creates a new S3-compatible storage instance
@@ -43,92 +259,181 @@ func NewMinIOStorage() *MinIOStorage {
 	}
 }
 
+// NewMinIO creates and initializes an S3-compatible storage from options.
+// Options not given fall back to the same defaults as the config-driven path.
+func NewMinIO(ctx context.Context, opts ...MinIOOption) (*MinIOStorage, error) {
+	s3Cfg := defaultS3Config()
+	for _, opt := range opts {
+		opt(&s3Cfg)
+	}
+
+	s := NewMinIOStorage()
+	if err := s.setup(ctx, s3Cfg); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
 // Initialize sets up the S3 client and configures the storage
 func (s *MinIOStorage) Initialize(ctx context.Context, cfg *Config) error {
 	// Default values
-	s3Cfg := S3Config{
-		Endpoint:   "localhost:9000",
-		Bucket:     "uploads",
-		Region:     "us-east-1",
-		AccessKey:  "minioadmin",
-		SecretKey:  "minioadmin",
-		UseSSL:     false,
-		PathStyle:  true,
-		DisableSSL: true,
-	}
+	s3Cfg := defaultS3Config()
 
 	// Override with provided configuration if any
-	if cfg.Properties != nil {
-		if endpoint, ok := cfg.Properties["endpoint"].(string); ok && endpoint != "" {
-			s3Cfg.Endpoint = endpoint
-		}
+	s3Cfg.applyProperties(cfg.Properties)
 
-		if bucket, ok := cfg.Properties["bucket"].(string); ok && bucket != "" {
-			s3Cfg.Bucket = bucket
-		}
+	return s.setup(ctx, s3Cfg)
+}
 
-		if region, ok := cfg.Properties["region"].(string); ok && region != "" {
-			s3Cfg.Region = region
-		}
+// applyProperties overrides the configuration with the given properties
+func (c *S3Config) applyProperties(props map[string]interface{}) {
+	if endpoint, ok := props["endpoint"].(string); ok && endpoint != "" {
+		c.Endpoint = endpoint
+	}
 
-		if accessKey, ok := cfg.Properties["accessKey"].(string); ok && accessKey != "" {
-			s3Cfg.AccessKey = accessKey
-		}
+	if bucket, ok := props["bucket"].(string); ok && bucket != "" {
+		c.Bucket = bucket
+	}
 
-		if secretKey, ok := cfg.Properties["secretKey"].(string); ok && secretKey != "" {
-			s3Cfg.SecretKey = secretKey
-		}
+	if region, ok := props["region"].(string); ok && region != "" {
+		c.Region = region
+	}
 
-		if useSSL, ok := cfg.Properties["useSSL"].(bool); ok {
-			s3Cfg.UseSSL = useSSL
-		}
+	if accessKey, ok := props["accessKey"].(string); ok && accessKey != "" {
+		c.AccessKey = accessKey
+	}
 
-		if pathStyle, ok := cfg.Properties["pathStyle"].(bool); ok {
-			s3Cfg.PathStyle = pathStyle
-		}
+	if secretKey, ok := props["secretKey"].(string); ok && secretKey != "" {
+		c.SecretKey = secretKey
+	}
 
-		if disableSSL, ok := cfg.Properties["disableSSL"].(bool); ok {
-			s3Cfg.DisableSSL = disableSSL
-		}
+	if useSSL, ok := props["useSSL"].(bool); ok {
+		c.UseSSL = useSSL
 	}
 
-	// Store the configuration
-	s.config = s3Cfg
+	if pathStyle, ok := props["pathStyle"].(bool); ok {
+		c.PathStyle = pathStyle
+	}
 
-	slog.Info("Setting up S3-compatible storage",
-		"endpoint", s3Cfg.Endpoint,
-		"bucket", s3Cfg.Bucket,
-		"region", s3Cfg.Region,
-		"useSSL", s3Cfg.UseSSL)
+	if disableSSL, ok := props["disableSSL"].(bool); ok {
+		c.DisableSSL = disableSSL
+	}
 
-	// Construct the MinIO URL with appropriate protocol
-	protocol := "http"
-	if s3Cfg.UseSSL {
-		protocol = "https"
+	if partSize, ok := props["partSize"].(int64); ok {
+		c.PartSize = partSize
 	}
 
-	// Create the full URL for MinIO
-	minioURL := s3Cfg.Endpoint
-	if len(minioURL) < 4 || (minioURL[:4] != "http" && minioURL[:5] != "https") {
-		minioURL = fmt.Sprintf("%s://%s", protocol, s3Cfg.Endpoint)
+	if accelerate, ok := props["accelerate"].(bool); ok {
+		c.Accelerate = accelerate
 	}
 
-	// Use a simplified resolver for MinIO
-	resolver := aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
-		return aws.Endpoint{
-			URL:               minioURL,
-			HostnameImmutable: true,
-			Source:            aws.EndpointSourceCustom,
-		}, nil
-	})
+	if dualStack, ok := props["dualStack"].(bool); ok {
+		c.DualStack = dualStack
+	}
+
+	if checksumCompat, ok := props["checksumCompat"].(bool); ok {
+		c.ChecksumCompat = checksumCompat
+	}
+
+	if uniformParts, ok := props["uniformParts"].(bool); ok {
+		c.UniformParts = uniformParts
+	}
+
+	if roleARN, ok := props["stsRoleArn"].(string); ok {
+		c.STSRoleARN = roleARN
+	}
+
+	if duration, ok := props["stsDuration"].(time.Duration); ok {
+		c.STSDuration = duration
+	}
 
-	// Set up AWS SDK configuration with simplified approach
+	if template, ok := props["bucketTemplate"].(string); ok {
+		c.BucketTemplate = template
+	}
+
+	if replicas, ok := props["replicas"].([]Replica); ok {
+		c.Replicas = replicas
+	}
+
+	if provisioning, ok := props["provisioning"].(Provisioning); ok && provisioning != "" {
+		c.Provisioning = provisioning
+	}
+
+	if settings, ok := props["bucketSettings"].(BucketSettings); ok {
+		c.BucketSettings = settings
+	}
+
+	if keyID, ok := props["sseKmsKeyId"].(string); ok {
+		c.SSEKMSKeyID = keyID
+	}
+
+	if httpClient, ok := props["httpClient"].(*http.Client); ok {
+		c.HTTPClient = httpClient
+	}
+}
+
+// setup creates the S3 client and tusd store from a resolved configuration
+func (s *MinIOStorage) setup(ctx context.Context, s3Cfg S3Config) error {
+	if s3Cfg.Bucket == "" {
+		return fmt.Errorf("bucket is required: %w", ErrInvalidConfig)
+	}
+
+	if s3Cfg.PartSize < 0 {
+		return fmt.Errorf("part size must not be negative: %w", ErrInvalidConfig)
+	}
+	if s3Cfg.PartSize > 0 && (s3Cfg.PartSize < minPartSize || s3Cfg.PartSize > maxPartSize) {
+		return fmt.Errorf("part size must be between %d and %d bytes: %w", minPartSize, maxPartSize, ErrInvalidConfig)
+	}
+
+	if s3Cfg.STSDuration < 0 {
+		return fmt.Errorf("STS duration must not be negative: %w", ErrInvalidConfig)
+	}
+	if s3Cfg.STSRoleARN != "" && s3Cfg.STSDuration == 0 {
+		s3Cfg.STSDuration = DefaultSTSDuration
+	}
+
+	if s3Cfg.BucketTemplate != "" {
+		if err := ValidateBucketTemplate(s3Cfg.BucketTemplate); err != nil {
+			return err
+		}
+		// Replicas are single buckets in other regions
+		if len(s3Cfg.Replicas) > 0 {
+			return fmt.Errorf("per-tenant buckets can't be combined with replicas: %w", ErrInvalidConfig)
+		}
+	}
+
+	provisioning, err := ParseProvisioning(string(s3Cfg.Provisioning))
+	if err != nil {
+		return err
+	}
+	s3Cfg.Provisioning = provisioning
+	if err := s3Cfg.BucketSettings.validate(); err != nil {
+		return err
+	}
+	if err := s3Cfg.validateAWSEndpoints(); err != nil {
+		return err
+	}
+
+	// Create the full URL for MinIO
+	minioURL := endpointURL(s3Cfg.Endpoint, s3Cfg.UseSSL)
+
+	// Without static keys, credentials come from the default AWS chain:
+	// environment, shared config, web identity (IRSA) and ECS or EC2 roles
 	awsOpts := []func(*config.LoadOptions) error{
 		config.WithRegion(s3Cfg.Region),
-		config.WithEndpointResolverWithOptions(resolver),
-		config.WithCredentialsProvider(
+	}
+	if s3Cfg.AccessKey != "" {
+		awsOpts = append(awsOpts, config.WithCredentialsProvider(
 			credentials.NewStaticCredentialsProvider(s3Cfg.AccessKey, s3Cfg.SecretKey, ""),
-		),
+		))
+	}
+	if !s3Cfg.awsEndpoints() {
+		awsOpts = append(awsOpts, config.WithEndpointResolverWithOptions(endpointResolver(minioURL, s3Cfg.PathStyle)))
+	}
+
+	if s3Cfg.HTTPClient != nil {
+		awsOpts = append(awsOpts, config.WithHTTPClient(s3Cfg.HTTPClient))
 	}
 
 	// Load the AWS configuration
@@ -137,31 +442,98 @@ func (s *MinIOStorage) Initialize(ctx context.Context, cfg *Config) error {
 		return fmt.Errorf("failed to load AWS SDK config: %w", err)
 	}
 
-	// Create S3 client with path-style access enabled
-	s3Client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
-		o.UsePathStyle = true // Essential for MinIO
-	})
+	// The region may come from the environment or shared config
+	if s3Cfg.Region == "" {
+		s3Cfg.Region = awsCfg.Region
+	}
+	if s3Cfg.Region == "" {
+		return fmt.Errorf("region is required: %w", ErrInvalidConfig)
+	}
+
+	// Store the configuration
+	s.config = s3Cfg
+
+	slog.Info("Setting up S3-compatible storage",
+		"endpoint", s3Cfg.Endpoint,
+		"bucket", s3Cfg.Bucket,
+		"region", s3Cfg.Region,
+		"useSSL", s3Cfg.UseSSL,
+		"pathStyle", s3Cfg.PathStyle,
+		"accelerate", s3Cfg.Accelerate,
+		"dualStack", s3Cfg.DualStack,
+		"checksumCompat", s3Cfg.ChecksumCompat,
+		"bucketTemplate", s3Cfg.BucketTemplate)
+
+	s3Client := s3.NewFromConfig(awsCfg, s3Cfg.clientOptions)
 
 	s.s3Client = s3Client
 
-	// Verify bucket exists or create it
-	_, err = s.s3Client.HeadBucket(ctx, &s3.HeadBucketInput{
-		Bucket: aws.String(s3Cfg.Bucket),
-	})
+	if err := s.setupReplicas(awsCfg, minioURL, s3Cfg); err != nil {
+		return err
+	}
 
+	// Verify the bucket exists, creating it if allowed
+	existed, err := s.provisionBucket(ctx, s3Cfg)
 	if err != nil {
-		slog.Info("Bucket does not exist. Creating...", "bucket", s3Cfg.Bucket)
-		_, err = s.s3Client.CreateBucket(ctx, &s3.CreateBucketInput{
-			Bucket: aws.String(s3Cfg.Bucket),
-		})
-		if err != nil {
-			return fmt.Errorf("error creating bucket: %w", err)
-		}
-		slog.Info("Bucket created successfully", "bucket", s3Cfg.Bucket)
+		return err
+	}
+
+	// Probe the optional features of existing buckets, disabling those
+	// depending on missing ones. Buckets the server creates have the
+	// settings it applied.
+	caps := Capabilities{Tagging: CapabilityUnknown, Versioning: CapabilityDisabled, ObjectLock: CapabilityDisabled}
+	if s3Cfg.BucketSettings.Versioning {
+		caps.Versioning = CapabilityEnabled
+	}
+	if existed {
+		caps = s.probeCapabilities(ctx, s3Cfg)
+	}
+	compat := s3Cfg.ChecksumCompat
+	s.adaptToCapabilities(&caps, &s3Cfg)
+	if s3Cfg.ChecksumCompat != compat {
+		s.config = s3Cfg
+		s.s3Client = s3.NewFromConfig(awsCfg, s3Cfg.clientOptions)
+	}
+
+	// Send requests with tenant-scoped credentials when delegation is enabled
+	var api s3store.S3API = s.s3Client
+	if s3Cfg.STSRoleARN != "" {
+		slog.Info("Delegating S3 credentials per tenant", "roleArn", s3Cfg.STSRoleARN, "duration", s3Cfg.STSDuration)
+		api = newDelegatingS3API(newSTSClientFactory(awsCfg, s.s3Client, s.tenantBucket, s3Cfg.STSRoleARN, s3Cfg.STSDuration))
+	}
+
+	// Send each tenant's requests to its own bucket when routing is enabled
+	if s3Cfg.BucketTemplate != "" {
+		api = bucketRoutingS3API{S3API: api, buckets: s.newTenantBuckets(s3Cfg), fallback: s3Cfg.Bucket}
+	}
+
+	// Encrypt objects with the KMS key and verify it on completion
+	if s3Cfg.SSEKMSKeyID != "" {
+		slog.Info("Encrypting objects with SSE-KMS", "keyId", s3Cfg.SSEKMSKeyID)
+		api = sseKMSS3API{S3API: api, keyID: s3Cfg.SSEKMSKeyID}
 	}
 
 	// Create S3 store for tusd with the configured client
-	store := s3store.New(s3Cfg.Bucket, s.s3Client)
+	// Storage classes selected per upload are applied when the multipart upload is created
+	store := s3store.New(s3Cfg.Bucket, storageClassS3API{api})
+	if s3Cfg.PartSize > 0 {
+		store.PreferredPartSize = s3Cfg.PartSize
+	}
+	if s3Cfg.UniformParts {
+		// Smaller parts are held back until they reach the preferred size,
+		// and uploads must fit in parts of that size, or tusd would use
+		// larger ones
+		store.MinPartSize = store.PreferredPartSize
+		store.MaxObjectSize = store.PreferredPartSize * store.MaxMultipartParts
+	}
+	s.hints = ChunkHints{
+		PreferredChunkSize: store.PreferredPartSize,
+		MinChunkSize:       store.MinPartSize,
+		MaxUploadSize:      store.MaxObjectSize,
+	}
+	caps.setMultipartLimits(store)
+	s.capabilities = caps
+	logCapabilities(s3Cfg.Bucket, caps)
 
 	// Create in-memory locker
 	locker := memorylocker.New()
@@ -175,7 +547,6 @@ func (s *MinIOStorage) Initialize(ctx context.Context, cfg *Config) error {
 
 	// Extra debug logging
 	slog.Debug("S3 store configured",
-		"provider", "MinIO",
 		"bucket", s3Cfg.Bucket)
 
 	s.initialized = true
@@ -183,6 +554,53 @@ func (s *MinIOStorage) Initialize(ctx context.Context, cfg *Config) error {
 	return nil
 }
 
+// awsEndpoints reports whether the SDK resolves AWS endpoints instead of
+// sending every request to the configured endpoint
+func (c S3Config) awsEndpoints() bool {
+	return c.Endpoint == "" || c.Accelerate || c.DualStack
+}
+
+// validateAWSEndpoints checks that acceleration and dual-stack endpoints
+// are only enabled for AWS S3
+func (c S3Config) validateAWSEndpoints() error {
+	if !c.Accelerate && !c.DualStack {
+		return nil
+	}
+	host := c.Endpoint
+	if u, err := url.Parse(endpointURL(c.Endpoint, true)); err == nil {
+		host = u.Hostname()
+	}
+	if c.Endpoint != "" && host != "amazonaws.com" && !strings.HasSuffix(host, ".amazonaws.com") && !strings.HasSuffix(host, ".amazonaws.com.cn") {
+		return fmt.Errorf("transfer acceleration and dual-stack endpoints need AWS S3, not %s: %w", c.Endpoint, ErrInvalidConfig)
+	}
+	// Accelerated buckets are addressed by virtual host, which TLS
+	// certificates don't cover for names with dots
+	if c.Accelerate && strings.Contains(c.Bucket, ".") {
+		return fmt.Errorf("transfer acceleration doesn't support bucket names with dots: %w", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// clientOptions configures S3 clients for the endpoint. Path-style access
+// is essential for MinIO but not supported by accelerated endpoints.
+func (c S3Config) clientOptions(o *s3.Options) {
+	o.UsePathStyle = c.PathStyle && !c.Accelerate
+	o.UseAccelerate = c.Accelerate
+	if c.DualStack {
+		o.EndpointOptions.UseDualStackEndpoint = aws.DualStackEndpointStateEnabled
+	}
+	c.checksumOptions(o)
+}
+
+// checksumOptions limits checksums to the operations that require them
+// when checksum compatibility is enabled
+func (c S3Config) checksumOptions(o *s3.Options) {
+	if c.ChecksumCompat {
+		o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+		o.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+	}
+}
+
 // GetHandler returns a configured tusd handler for S3 storage
 func (s *MinIOStorage) GetHandler(basePath string) (*tusd.Handler, error) {
 	if !s.initialized {
@@ -213,6 +631,17 @@ func (s *MinIOStorage) GetProvider() Provider {
 	return MinIO
 }
 
+// TenantScoped reports whether uploads are isolated per tenant with
+// delegated credentials or buckets of their own
+func (s *MinIOStorage) TenantScoped() bool {
+	return s.config.STSRoleARN != "" || s.config.BucketTemplate != ""
+}
+
+// RoutesBuckets reports whether tenants have buckets of their own
+func (s *MinIOStorage) RoutesBuckets() bool {
+	return s.config.BucketTemplate != ""
+}
+
 // GetStoreComposer returns the tusd store composer
 func (s *MinIOStorage) GetStoreComposer() *tusd.StoreComposer {
 	return s.composer
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/tus/tusd/v2/pkg/s3store"
+)
+
+// capabilityProbeKey is the object capabilities are looked up on. It is
+// never created.
+const capabilityProbeKey = ".capability-probe"
+
+// Capabilities returns the capabilities probed when the storage was set up
+func (s *MinIOStorage) Capabilities() Capabilities {
+	return s.capabilities
+}
+
+// probeCapabilities looks up the optional features of an existing bucket.
+// Probes only read, so a failed probe leaves the capability unknown.
+func (s *MinIOStorage) probeCapabilities(ctx context.Context, s3Cfg S3Config) Capabilities {
+	bucket := aws.String(s3Cfg.Bucket)
+	var caps Capabilities
+
+	// Services without tagging reject the request rather than the key
+	_, err := s.s3Client.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{Bucket: bucket, Key: aws.String(capabilityProbeKey)})
+	caps.Tagging = probedCapability(err, "NoSuchKey")
+	caps.warnUnknown("tagging", caps.Tagging, err)
+
+	versioning, err := s.s3Client.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{Bucket: bucket}, withoutAcceleration)
+	caps.Versioning = probedCapability(err)
+	if err == nil && versioning.Status != types.BucketVersioningStatusEnabled {
+		caps.Versioning = CapabilityDisabled
+	}
+	caps.warnUnknown("versioning", caps.Versioning, err)
+
+	lock, err := s.s3Client.GetObjectLockConfiguration(ctx, &s3.GetObjectLockConfigurationInput{Bucket: bucket}, withoutAcceleration)
+	caps.ObjectLock = probedCapability(err, "ObjectLockConfigurationNotFoundError")
+	if errorCode(err) == "ObjectLockConfigurationNotFoundError" {
+		caps.ObjectLock = CapabilityDisabled
+	} else if err == nil {
+		config := lock.ObjectLockConfiguration
+		if config == nil || config.ObjectLockEnabled != types.ObjectLockEnabledEnabled {
+			caps.ObjectLock = CapabilityDisabled
+		} else if config.Rule != nil && config.Rule.DefaultRetention != nil {
+			caps.Retention = describeRetention(config.Rule.DefaultRetention)
+		}
+	}
+	caps.warnUnknown("object lock", caps.ObjectLock, err)
+
+	return caps
+}
+
+// adaptToCapabilities disables the features the bucket's capabilities rule
+// out and warns about those that behave differently
+func (s *MinIOStorage) adaptToCapabilities(caps *Capabilities, s3Cfg *S3Config) {
+	if caps.Tagging == CapabilityDisabled {
+		caps.warn("Object tagging is not supported, the permission check skips it")
+	}
+	if caps.Versioning == CapabilityEnabled {
+		caps.warn("Versioning is enabled, deleted uploads are kept as noncurrent versions until a lifecycle rule expires them")
+	} else if caps.Versioning == CapabilityDisabled && s3Cfg.BucketSettings.Versioning {
+		caps.warn("Versioning is configured but disabled on the existing bucket, bucket settings only apply to buckets the server creates")
+	}
+	if caps.ObjectLock == CapabilityEnabled {
+		if caps.Retention != "" {
+			caps.warn(fmt.Sprintf("Objects are retained for %s by default, deleted uploads keep using space until then", caps.Retention))
+		}
+		if s3Cfg.ChecksumCompat {
+			// Writes to buckets with object lock must carry a checksum
+			s3Cfg.ChecksumCompat = false
+			caps.warn("Object lock requires checksums on writes, checksum compatibility is disabled")
+		}
+	}
+}
+
+// setMultipartLimits records the multipart limits of the S3 store, warning
+// if they cap the upload size below what S3 allows
+func (caps *Capabilities) setMultipartLimits(store s3store.S3Store) {
+	caps.MaxParts = store.MaxMultipartParts
+	caps.MinPartSize = store.MinPartSize
+	caps.MaxPartSize = store.MaxPartSize
+	caps.MaxObjectSize = store.MaxObjectSize
+	if defaults := s3store.New("", nil); store.MaxObjectSize < defaults.MaxObjectSize {
+		caps.warn(fmt.Sprintf("Uploads are limited to %d bytes by the part size and the maximum of %d parts", store.MaxObjectSize, store.MaxMultipartParts))
+	}
+}
+
+// warn records a warning about the capabilities
+func (caps *Capabilities) warn(warning string) {
+	caps.Warnings = append(caps.Warnings, warning)
+}
+
+// warnUnknown records a warning if probing a capability failed
+func (caps *Capabilities) warnUnknown(capability string, state Capability, err error) {
+	if state == CapabilityUnknown {
+		caps.warn(fmt.Sprintf("Failed to probe %s, features depending on it are left enabled: %v", capability, err))
+	}
+}
+
+// logCapabilities logs the capabilities and their warnings
+func logCapabilities(bucket string, caps Capabilities) {
+	slog.Info("Storage capabilities probed",
+		"bucket", bucket,
+		"tagging", caps.Tagging,
+		"versioning", caps.Versioning,
+		"objectLock", caps.ObjectLock,
+		"maxParts", caps.MaxParts,
+		"maxObjectSize", caps.MaxObjectSize)
+	for _, warning := range caps.Warnings {
+		slog.Warn(warning, "bucket", bucket)
+	}
+}
+
+// probedCapability classifies the outcome of a probe. The feature is there
+// if the probe succeeded or failed with one of the given error codes, and
+// missing if the service doesn't implement the request.
+func probedCapability(err error, present ...string) Capability {
+	if err == nil {
+		return CapabilityEnabled
+	}
+	code := errorCode(err)
+	for _, c := range present {
+		if code == c {
+			return CapabilityEnabled
+		}
+	}
+	var respErr *smithyhttp.ResponseError
+	if code == "NotImplemented" || errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusNotImplemented {
+		return CapabilityDisabled
+	}
+	return CapabilityUnknown
+}
+
+// errorCode returns the S3 error code of an error, if any
+func errorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return ""
+}
+
+// describeRetention describes a default retention, e.g. "30 days (GOVERNANCE)"
+func describeRetention(retention *types.DefaultRetention) string {
+	period := "an unknown period"
+	switch {
+	case retention.Days != nil:
+		period = fmt.Sprintf("%d days", *retention.Days)
+	case retention.Years != nil:
+		period = fmt.Sprintf("%d years", *retention.Years)
+	}
+	return fmt.Sprintf("%s (%s)", period, retention.Mode)
+}
@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// maxCopySize is the largest object S3 copies in a single request
+const maxCopySize = 5 << 30
+
+// copyPartSize is the part size of multipart copies of larger objects
+const copyPartSize = 1 << 30
+
+// errObjectExists is returned by conditional copies when the target exists
+var errObjectExists = errors.New("object already exists")
+
+// MoveToContent moves the object of a finished upload to its content key.
+// Content keys are written with the service credentials, as they are shared
+// across tenants.
+func (s *MinIOStorage) MoveToContent(ctx context.Context, uploadID, digest string) (bool, error) {
+	if !ValidDigest(digest) {
+		return false, fmt.Errorf("invalid digest %q: %w", digest, ErrInvalidConfig)
+	}
+
+	source := ObjectKey(uploadID)
+	target := ContentKey(digest)
+
+	deduplicated := true
+	if _, err := s.headObject(ctx, target); err != nil {
+		if !errors.Is(err, ErrContentNotFound) {
+			return false, err
+		}
+
+		size, err := s.headObject(ctx, source)
+		if err != nil {
+			return false, fmt.Errorf("failed to stat upload %s: %w", uploadID, err)
+		}
+		// Another instance may store the same content in the meantime, so
+		// the copy only creates the key if it still doesn't exist
+		switch err := s.copyObject(ctx, source, target, size, copyOptions{IfAbsent: true}); {
+		case errors.Is(err, errObjectExists):
+		case err != nil:
+			return false, fmt.Errorf("failed to copy upload %s to %s: %w", uploadID, target, err)
+		default:
+			deduplicated = false
+		}
+	}
+
+	// The upload's .info object stays, so tus HEAD requests keep working
+	if _, err := s.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucketFor(source)),
+		Key:    aws.String(source),
+	}); err != nil {
+		return deduplicated, fmt.Errorf("failed to delete upload object %s: %w", source, err)
+	}
+
+	slog.Debug("Upload moved to content key", "id", uploadID, "key", target, "deduplicated", deduplicated)
+	return deduplicated, nil
+}
+
+// OpenContent returns a reader for the content with the given digest
+func (s *MinIOStorage) OpenContent(ctx context.Context, digest string) (io.ReadCloser, int64, error) {
+	out, err := s.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.config.Bucket),
+		Key:    aws.String(ContentKey(digest)),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, 0, ErrContentNotFound
+		}
+		return nil, 0, fmt.Errorf("failed to read content %s: %w", digest, err)
+	}
+	return out.Body, aws.ToInt64(out.ContentLength), nil
+}
+
+// DeleteContent deletes the content with the given digest
+func (s *MinIOStorage) DeleteContent(ctx context.Context, digest string) error {
+	if _, err := s.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.config.Bucket),
+		Key:    aws.String(ContentKey(digest)),
+	}); err != nil {
+		return fmt.Errorf("failed to delete content %s: %w", digest, err)
+	}
+	return nil
+}
+
+// headObject returns the size of an object or ErrContentNotFound
+func (s *MinIOStorage) headObject(ctx context.Context, key string) (int64, error) {
+	out, err := s.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucketFor(key)),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return 0, ErrContentNotFound
+		}
+		return 0, err
+	}
+	return aws.ToInt64(out.ContentLength), nil
+}
+
+// copyOptions configure the object a copy creates
+type copyOptions struct {
+	// StorageClass of the copy, empty for the provider default
+	StorageClass types.StorageClass
+
+	// Metadata and ContentType are set on multipart copies, which don't
+	// take them from the source like single copy requests do
+	Metadata    map[string]string
+	ContentType *string
+
+	// IfAbsent only creates the target if it doesn't exist, and fails with
+	// errObjectExists otherwise. Single copy requests can't be
+	// conditional, so the copy is made in parts, except for empty objects.
+	IfAbsent bool
+}
+
+// copyObject copies an object between the buckets of the keys, in parts if
+// it is too large for a single copy request
+func (s *MinIOStorage) copyObject(ctx context.Context, source, target string, size int64, opts copyOptions) error {
+	// Copies are encrypted with the bucket default unless the key is given
+	copySource := s.bucketFor(source) + "/" + source
+	encryption, keyID := s.sseKMS()
+	if size <= maxCopySize && (!opts.IfAbsent || size == 0) {
+		out, err := s.s3Client.CopyObject(ctx, &s3.CopyObjectInput{
+			Bucket:               aws.String(s.bucketFor(target)),
+			Key:                  aws.String(target),
+			CopySource:           aws.String(copySource),
+			StorageClass:         opts.StorageClass,
+			ServerSideEncryption: encryption,
+			SSEKMSKeyId:          keyID,
+		})
+		if err != nil || keyID == nil {
+			return err
+		}
+		return verifySSEKMS(*keyID, out.ServerSideEncryption, aws.ToString(out.SSEKMSKeyId))
+	}
+
+	created, err := s.s3Client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:               aws.String(s.bucketFor(target)),
+		Key:                  aws.String(target),
+		StorageClass:         opts.StorageClass,
+		Metadata:             opts.Metadata,
+		ContentType:          opts.ContentType,
+		ServerSideEncryption: encryption,
+		SSEKMSKeyId:          keyID,
+	})
+	if err != nil {
+		return err
+	}
+
+	var parts []types.CompletedPart
+	for offset, number := int64(0), int32(1); offset < size; offset, number = offset+copyPartSize, number+1 {
+		end := min(offset+copyPartSize, size) - 1
+		part, err := s.s3Client.UploadPartCopy(ctx, &s3.UploadPartCopyInput{
+			Bucket:          aws.String(s.bucketFor(target)),
+			Key:             aws.String(target),
+			UploadId:        created.UploadId,
+			PartNumber:      aws.Int32(number),
+			CopySource:      aws.String(copySource),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", offset, end)),
+		})
+		if err != nil {
+			s.abortMultipart(target, created.UploadId)
+			return err
+		}
+		parts = append(parts, types.CompletedPart{
+			ETag:       part.CopyPartResult.ETag,
+			PartNumber: aws.Int32(number),
+		})
+	}
+
+	var ifNoneMatch *string
+	if opts.IfAbsent {
+		ifNoneMatch = aws.String("*")
+	}
+	completed, err := s.s3Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucketFor(target)),
+		Key:             aws.String(target),
+		UploadId:        created.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+		IfNoneMatch:     ifNoneMatch,
+	})
+	if err != nil {
+		s.abortMultipart(target, created.UploadId)
+		if isPreconditionFailed(err) {
+			return errObjectExists
+		}
+		return err
+	}
+	if keyID != nil {
+		return verifySSEKMS(*keyID, completed.ServerSideEncryption, aws.ToString(completed.SSEKMSKeyId))
+	}
+	return nil
+}
+
+// abortMultipart discards a failed multipart copy
+func (s *MinIOStorage) abortMultipart(key string, uploadID *string) {
+	if _, err := s.s3Client.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucketFor(key)),
+		Key:      aws.String(key),
+		UploadId: uploadID,
+	}); err != nil {
+		slog.Warn("Failed to abort multipart copy", "key", key, "error", err)
+	}
+}
+
+// ObjectKey returns the object key s3store uses for an upload ID,
+// which has the form <object ID>+<multipart ID>
+func ObjectKey(uploadID string) string {
+	if i := strings.LastIndex(uploadID, "+"); i >= 0 {
+		return uploadID[:i]
+	}
+	return uploadID
+}
+
+// isPreconditionFailed reports whether an S3 error means the condition of a
+// conditional write did not hold
+func isPreconditionFailed(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "PreconditionFailed", "ConditionalRequestConflict":
+			return true
+		}
+	}
+	return false
+}
+
+// isNotFound reports whether an S3 error means the object does not exist
+func isNotFound(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NotFound", "NoSuchKey":
+			return true
+		}
+	}
+	return false
+}
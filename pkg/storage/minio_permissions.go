@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// permissionProbePrefix is the key prefix of the objects permission checks
+// create and remove again
+const permissionProbePrefix = ".permission-check/"
+
+// errDependencyFailed marks checks that were skipped
+var errDependencyFailed = errors.New("skipped because an earlier operation failed")
+
+// CheckPermissions tries every S3 operation the server performs on a probe
+// object, in the order an upload uses them: .info objects are written, read
+// and tagged, data goes through multipart uploads that are listed when
+// resumed, completed when finished and aborted when terminated, finished
+// objects are listed, copied by tiering and content addressing, and objects
+// are deleted.
+func (s *MinIOStorage) CheckPermissions(ctx context.Context) []PermissionCheck {
+	bucket := aws.String(s.config.Bucket)
+	key := aws.String(permissionProbePrefix + newProbeID())
+	var checks []PermissionCheck
+
+	check := func(operation, permission string, skip bool, fn func() error) bool {
+		c := PermissionCheck{Operation: operation, Permission: permission}
+		if skip {
+			c.Err, c.Skipped = errDependencyFailed, true
+		} else if c.Err = fn(); c.Err != nil {
+			c.Denied = isAccessDenied(c.Err)
+		}
+		checks = append(checks, c)
+		return c.Err == nil
+	}
+
+	// Objects are written with the KMS key the server encrypts with, so
+	// missing KMS permissions are caught too
+	encryption, keyID := s.sseKMS()
+	written := check("PutObject", "s3:PutObject", false, func() error {
+		_, err := s.s3Client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:               bucket,
+			Key:                  key,
+			Body:                 bytes.NewReader([]byte("{}")),
+			ServerSideEncryption: encryption,
+			SSEKMSKeyId:          keyID,
+		})
+		return err
+	})
+	check("GetObject", "s3:GetObject", !written, func() error {
+		out, err := s.s3Client.GetObject(ctx, &s3.GetObjectInput{Bucket: bucket, Key: key})
+		if err != nil {
+			return err
+		}
+		return out.Body.Close()
+	})
+	check("HeadObject", "s3:GetObject", !written, func() error {
+		_, err := s.s3Client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: bucket, Key: key})
+		return err
+	})
+	if s.capabilities.Tagging == CapabilityDisabled {
+		checks = append(checks,
+			PermissionCheck{Operation: "PutObjectTagging", Permission: "s3:PutObjectTagging", Unsupported: true},
+			PermissionCheck{Operation: "GetObjectTagging", Permission: "s3:GetObjectTagging", Unsupported: true})
+	} else {
+		tagged := check("PutObjectTagging", "s3:PutObjectTagging", !written, func() error {
+			_, err := s.s3Client.PutObjectTagging(ctx, &s3.PutObjectTaggingInput{
+				Bucket:  bucket,
+				Key:     key,
+				Tagging: &types.Tagging{TagSet: []types.Tag{{Key: aws.String("purpose"), Value: aws.String("permission-check")}}},
+			})
+			return err
+		})
+		check("GetObjectTagging", "s3:GetObjectTagging", !tagged, func() error {
+			_, err := s.s3Client.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{Bucket: bucket, Key: key})
+			return err
+		})
+	}
+
+	var uploadID, etag *string
+	created := check("CreateMultipartUpload", "s3:PutObject", false, func() error {
+		out, err := s.s3Client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket:               bucket,
+			Key:                  key,
+			ServerSideEncryption: encryption,
+			SSEKMSKeyId:          keyID,
+		})
+		if err != nil {
+			return err
+		}
+		uploadID = out.UploadId
+		return nil
+	})
+	uploaded := check("UploadPart", "s3:PutObject", !created, func() error {
+		out, err := s.s3Client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     bucket,
+			Key:        key,
+			UploadId:   uploadID,
+			PartNumber: aws.Int32(1),
+			Body:       bytes.NewReader([]byte("permission check")),
+		})
+		if err != nil {
+			return err
+		}
+		etag = out.ETag
+		return nil
+	})
+	check("ListParts", "s3:ListMultipartUploadParts", !created, func() error {
+		_, err := s.s3Client.ListParts(ctx, &s3.ListPartsInput{Bucket: bucket, Key: key, UploadId: uploadID})
+		return err
+	})
+	// The last part may be smaller than the minimum, so one part completes
+	completed := check("CompleteMultipartUpload", "s3:PutObject", !uploaded, func() error {
+		_, err := s.s3Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          bucket,
+			Key:             key,
+			UploadId:        uploadID,
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: []types.CompletedPart{{ETag: etag, PartNumber: aws.Int32(1)}}},
+		})
+		return err
+	})
+	if created && !completed {
+		s.abortMultipart(*key, uploadID)
+	}
+	// Aborting needs a multipart upload of its own, as the first one is
+	// completed
+	check("AbortMultipartUpload", "s3:AbortMultipartUpload", !created, func() error {
+		out, err := s.s3Client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket:               bucket,
+			Key:                  key,
+			ServerSideEncryption: encryption,
+			SSEKMSKeyId:          keyID,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = s.s3Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{Bucket: bucket, Key: key, UploadId: out.UploadId})
+		if err != nil {
+			slog.Warn("Multipart upload of the permission check was left behind", "key", *key, "uploadId", aws.ToString(out.UploadId))
+		}
+		return err
+	})
+
+	check("ListObjectsV2", "s3:ListBucket", false, func() error {
+		_, err := s.s3Client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{Bucket: bucket, Prefix: key, MaxKeys: aws.Int32(1)})
+		return err
+	})
+	copyKey := aws.String(*key + ".copy")
+	copied := check("CopyObject", "s3:PutObject", !written, func() error {
+		_, err := s.s3Client.CopyObject(ctx, &s3.CopyObjectInput{
+			Bucket:               bucket,
+			Key:                  copyKey,
+			CopySource:           aws.String(s.config.Bucket + "/" + *key),
+			ServerSideEncryption: encryption,
+			SSEKMSKeyId:          keyID,
+		})
+		return err
+	})
+
+	deleted := check("DeleteObject", "s3:DeleteObject", !written, func() error {
+		_, err := s.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: bucket, Key: key})
+		return err
+	})
+	if written && !deleted {
+		slog.Warn("Object of the permission check was left behind", "key", *key)
+	}
+	if copied {
+		if _, err := s.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: bucket, Key: copyKey}); err != nil {
+			slog.Warn("Object of the permission check was left behind", "key", *copyKey, "error", err)
+		}
+	}
+
+	return checks
+}
+
+// isAccessDenied reports whether S3 refused an operation for lack of
+// permission, rather than failing for another reason
+func isAccessDenied(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "AccessDenied", "Forbidden", "AllAccessDisabled":
+			return true
+		}
+	}
+	var respErr *smithyhttp.ResponseError
+	return errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusForbidden
+}
+
+// newProbeID returns a random suffix for permission check objects
+func newProbeID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
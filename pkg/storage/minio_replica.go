@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"mime"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// replicaClient presigns downloads from one bucket
+type replicaClient struct {
+	bucket  string
+	client  *s3.Client
+	presign *s3.PresignClient
+}
+
+// setupReplicas creates presigning clients for the primary bucket and each
+// replica. Replicas without an endpoint share the primary endpoint, or
+// accelerated and dual-stack AWS endpoints in their region.
+func (s *MinIOStorage) setupReplicas(awsCfg aws.Config, primaryURL string, s3Cfg S3Config) error {
+	s.presigners = map[string]*replicaClient{
+		s3Cfg.Region: {
+			bucket:  s3Cfg.Bucket,
+			client:  s.s3Client,
+			presign: s3.NewPresignClient(s.s3Client),
+		},
+	}
+
+	for _, replica := range s3Cfg.Replicas {
+		if _, ok := s.presigners[replica.Region]; ok {
+			return fmt.Errorf("replica region %q is already in use: %w", replica.Region, ErrInvalidConfig)
+		}
+
+		url := primaryURL
+		if replica.Endpoint != "" {
+			url = endpointURL(replica.Endpoint, s3Cfg.UseSSL)
+		}
+
+		cfg := awsCfg.Copy()
+		cfg.Region = replica.Region
+		options := s3Cfg.clientOptions
+		if replica.Endpoint != "" || !s3Cfg.awsEndpoints() {
+			cfg.EndpointResolverWithOptions = endpointResolver(url, s3Cfg.PathStyle)
+			options = func(o *s3.Options) {
+				o.UsePathStyle = s3Cfg.PathStyle
+				s3Cfg.checksumOptions(o)
+			}
+		} else {
+			// The SDK resolves the endpoint from the replica's region
+			url = ""
+		}
+
+		client := s3.NewFromConfig(cfg, options)
+		s.presigners[replica.Region] = &replicaClient{
+			bucket:  replica.Bucket,
+			client:  client,
+			presign: s3.NewPresignClient(client),
+		}
+
+		slog.Info("Registered replica bucket", "region", replica.Region, "bucket", replica.Bucket, "endpoint", url)
+	}
+	return nil
+}
+
+// Regions returns the primary region followed by the replica regions
+func (s *MinIOStorage) Regions() []string {
+	regions := []string{s.config.Region}
+	for _, replica := range s.config.Replicas {
+		regions = append(regions, replica.Region)
+	}
+	return regions
+}
+
+// PresignDownload returns a presigned URL downloading an object, from the
+// requested replica if the object has been replicated there. URLs are
+// signed with the service credentials, so callers must authorize access.
+func (s *MinIOStorage) PresignDownload(ctx context.Context, key string, opts PresignOptions) (string, string, error) {
+	if !s.initialized {
+		return "", "", ErrStorageNotConfigured
+	}
+
+	region := s.config.Region
+	if replica, ok := s.presigners[opts.Region]; ok && opts.Region != region {
+		// Replication is asynchronous, so recent uploads may not exist yet
+		_, err := replica.client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(replica.bucket),
+			Key:    aws.String(key),
+		})
+		switch {
+		case err == nil:
+			region = opts.Region
+		case isNotFound(err):
+			slog.Debug("Object not replicated yet, using primary", "key", key, "region", opts.Region)
+		default:
+			slog.Warn("Failed to check replica, using primary", "key", key, "region", opts.Region, "error", err)
+		}
+	}
+
+	target := s.presigners[region]
+	bucket := target.bucket
+	if region == s.config.Region {
+		// Uploads of tenants may be in buckets of their own
+		bucket = s.bucketFor(key)
+	}
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	if opts.Filename != "" {
+		input.ResponseContentDisposition = aws.String(mime.FormatMediaType("attachment", map[string]string{"filename": opts.Filename}))
+	}
+
+	req, err := target.presign.PresignGetObject(ctx, input, s3.WithPresignExpires(opts.TTL))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to presign download: %w", err)
+	}
+	return req.URL, region, nil
+}
+
+// endpointURL adds a scheme to endpoints given as host and port
+func endpointURL(endpoint string, useSSL bool) string {
+	if strings.HasPrefix(endpoint, "http://") || strings.HasPrefix(endpoint, "https://") {
+		return endpoint
+	}
+
+	protocol := "http"
+	if useSSL {
+		protocol = "https"
+	}
+	return fmt.Sprintf("%s://%s", protocol, endpoint)
+}
+
+// endpointResolver resolves every service to a fixed endpoint, as needed
+// for MinIO and other S3-compatible services. Unless path-style URLs are
+// used, the SDK prefixes the host with the bucket.
+func endpointResolver(url string, pathStyle bool) aws.EndpointResolverWithOptions {
+	return aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
+		return aws.Endpoint{
+			URL:               url,
+			HostnameImmutable: pathStyle,
+			Source:            aws.EndpointSourceCustom,
+		}, nil
+	})
+}
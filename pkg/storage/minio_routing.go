@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/tus/tusd/v2/pkg/s3store"
+)
+
+// newTenantBuckets creates the router sending each tenant's objects to a
+// bucket of its own, provisioned on first use like the configured bucket
+func (s *MinIOStorage) newTenantBuckets(s3Cfg S3Config) *bucketRouter[string] {
+	return newBucketRouter(s3Cfg.BucketTemplate, s3Cfg.Bucket, func(ctx context.Context, name string) (string, error) {
+		tenantCfg := s3Cfg
+		tenantCfg.Bucket = name
+		if _, err := s.provisionBucket(ctx, tenantCfg); err != nil {
+			return "", err
+		}
+		return name, nil
+	})
+}
+
+// tenantBucket returns the bucket holding a tenant's objects
+func (s *MinIOStorage) tenantBucket(tenant string) string {
+	if s.config.BucketTemplate == "" {
+		return s.config.Bucket
+	}
+	return BucketName(s.config.BucketTemplate, tenant)
+}
+
+// bucketFor returns the bucket holding an object key, without provisioning
+// it
+func (s *MinIOStorage) bucketFor(key string) string {
+	if tenant, ok := TenantFromKey(key); ok {
+		return s.tenantBucket(tenant)
+	}
+	return s.config.Bucket
+}
+
+// bucketRoutingS3API sends each request to the bucket of the tenant owning
+// the object key. The tusd store addresses every request to the configured
+// bucket, which only keeps the objects without a tenant.
+type bucketRoutingS3API struct {
+	s3store.S3API
+	buckets  *bucketRouter[string]
+	fallback string
+}
+
+// route points a request at the bucket of the key
+func (api bucketRoutingS3API) route(ctx context.Context, bucket **string, key *string) error {
+	name, err := api.buckets.route(ctx, aws.ToString(key))
+	if err != nil {
+		return err
+	}
+	*bucket = aws.String(name)
+	return nil
+}
+
+// PutObject implements s3store.S3API
+func (api bucketRoutingS3API) PutObject(ctx context.Context, input *s3.PutObjectInput, opts ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if err := api.route(ctx, &input.Bucket, input.Key); err != nil {
+		return nil, err
+	}
+	return api.S3API.PutObject(ctx, input, opts...)
+}
+
+// ListParts implements s3store.S3API
+func (api bucketRoutingS3API) ListParts(ctx context.Context, input *s3.ListPartsInput, opts ...func(*s3.Options)) (*s3.ListPartsOutput, error) {
+	if err := api.route(ctx, &input.Bucket, input.Key); err != nil {
+		return nil, err
+	}
+	return api.S3API.ListParts(ctx, input, opts...)
+}
+
+// UploadPart implements s3store.S3API
+func (api bucketRoutingS3API) UploadPart(ctx context.Context, input *s3.UploadPartInput, opts ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	if err := api.route(ctx, &input.Bucket, input.Key); err != nil {
+		return nil, err
+	}
+	return api.S3API.UploadPart(ctx, input, opts...)
+}
+
+// GetObject implements s3store.S3API
+func (api bucketRoutingS3API) GetObject(ctx context.Context, input *s3.GetObjectInput, opts ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if err := api.route(ctx, &input.Bucket, input.Key); err != nil {
+		return nil, err
+	}
+	return api.S3API.GetObject(ctx, input, opts...)
+}
+
+// HeadObject implements s3store.S3API
+func (api bucketRoutingS3API) HeadObject(ctx context.Context, input *s3.HeadObjectInput, opts ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if err := api.route(ctx, &input.Bucket, input.Key); err != nil {
+		return nil, err
+	}
+	return api.S3API.HeadObject(ctx, input, opts...)
+}
+
+// CreateMultipartUpload implements s3store.S3API
+func (api bucketRoutingS3API) CreateMultipartUpload(ctx context.Context, input *s3.CreateMultipartUploadInput, opts ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	if err := api.route(ctx, &input.Bucket, input.Key); err != nil {
+		return nil, err
+	}
+	return api.S3API.CreateMultipartUpload(ctx, input, opts...)
+}
+
+// AbortMultipartUpload implements s3store.S3API
+func (api bucketRoutingS3API) AbortMultipartUpload(ctx context.Context, input *s3.AbortMultipartUploadInput, opts ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	if err := api.route(ctx, &input.Bucket, input.Key); err != nil {
+		return nil, err
+	}
+	return api.S3API.AbortMultipartUpload(ctx, input, opts...)
+}
+
+// DeleteObject implements s3store.S3API
+func (api bucketRoutingS3API) DeleteObject(ctx context.Context, input *s3.DeleteObjectInput, opts ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	if err := api.route(ctx, &input.Bucket, input.Key); err != nil {
+		return nil, err
+	}
+	return api.S3API.DeleteObject(ctx, input, opts...)
+}
+
+// DeleteObjects implements s3store.S3API. tusd only deletes the objects of
+// one upload at a time, so the first key decides the bucket.
+func (api bucketRoutingS3API) DeleteObjects(ctx context.Context, input *s3.DeleteObjectsInput, opts ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	if input.Delete == nil || len(input.Delete.Objects) == 0 {
+		return &s3.DeleteObjectsOutput{}, nil
+	}
+	if err := api.route(ctx, &input.Bucket, input.Delete.Objects[0].Key); err != nil {
+		return nil, err
+	}
+	return api.S3API.DeleteObjects(ctx, input, opts...)
+}
+
+// CompleteMultipartUpload implements s3store.S3API
+func (api bucketRoutingS3API) CompleteMultipartUpload(ctx context.Context, input *s3.CompleteMultipartUploadInput, opts ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	if err := api.route(ctx, &input.Bucket, input.Key); err != nil {
+		return nil, err
+	}
+	return api.S3API.CompleteMultipartUpload(ctx, input, opts...)
+}
+
+// UploadPartCopy implements s3store.S3API. Concatenation copies partial
+// uploads from the configured bucket, so the source is routed too.
+func (api bucketRoutingS3API) UploadPartCopy(ctx context.Context, input *s3.UploadPartCopyInput, opts ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error) {
+	if err := api.route(ctx, &input.Bucket, input.Key); err != nil {
+		return nil, err
+	}
+	if key, ok := strings.CutPrefix(aws.ToString(input.CopySource), api.fallback+"/"); ok {
+		var source *string
+		if err := api.route(ctx, &source, aws.String(key)); err != nil {
+			return nil, err
+		}
+		input.CopySource = aws.String(aws.ToString(source) + "/" + key)
+	}
+	return api.S3API.UploadPartCopy(ctx, input, opts...)
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/tus/tusd/v2/pkg/s3store"
+)
+
+// ErrNotEncrypted is returned when S3 reports that an object was not
+// encrypted with the configured KMS key
+var ErrNotEncrypted = errors.New("object is not encrypted with the configured KMS key")
+
+// Encrypter is implemented by backends that encrypt objects with a KMS key
+type Encrypter interface {
+	// SSEKMSKeyID returns the key, empty when encryption is left to the
+	// bucket default
+	SSEKMSKeyID() string
+}
+
+// sseKMSS3API encrypts the objects tusd writes with a KMS key and verifies
+// that completed uploads are encrypted with it. Parts need no headers, as
+// they are encrypted with the key of their multipart upload.
+type sseKMSS3API struct {
+	s3store.S3API
+	keyID string
+}
+
+// PutObject encrypts .info objects and incomplete parts
+func (api sseKMSS3API) PutObject(ctx context.Context, input *s3.PutObjectInput, opts ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	input.ServerSideEncryption = types.ServerSideEncryptionAwsKms
+	input.SSEKMSKeyId = aws.String(api.keyID)
+	return api.S3API.PutObject(ctx, input, opts...)
+}
+
+// CreateMultipartUpload encrypts the object the upload completes to. The
+// encryption S3 reports is verified before any data is written, and the
+// multipart upload is aborted when it doesn't match.
+func (api sseKMSS3API) CreateMultipartUpload(ctx context.Context, input *s3.CreateMultipartUploadInput, opts ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	input.ServerSideEncryption = types.ServerSideEncryptionAwsKms
+	input.SSEKMSKeyId = aws.String(api.keyID)
+	out, err := api.S3API.CreateMultipartUpload(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySSEKMS(api.keyID, out.ServerSideEncryption, aws.ToString(out.SSEKMSKeyId)); err != nil {
+		slog.Error("Multipart upload is not encrypted with the KMS key",
+			"bucket", aws.ToString(input.Bucket),
+			"key", aws.ToString(input.Key),
+			"error", err)
+		if _, abortErr := api.S3API.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   input.Bucket,
+			Key:      input.Key,
+			UploadId: out.UploadId,
+		}); abortErr != nil {
+			slog.Warn("Failed to abort unencrypted multipart upload", "key", aws.ToString(input.Key), "error", abortErr)
+		}
+		return nil, fmt.Errorf("object %s: %w", aws.ToString(input.Key), err)
+	}
+	return out, nil
+}
+
+// CompleteMultipartUpload fails the upload when the completed object is not
+// encrypted with the key, deleting the object so it isn't left in the
+// bucket unencrypted
+func (api sseKMSS3API) CompleteMultipartUpload(ctx context.Context, input *s3.CompleteMultipartUploadInput, opts ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	out, err := api.S3API.CompleteMultipartUpload(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySSEKMS(api.keyID, out.ServerSideEncryption, aws.ToString(out.SSEKMSKeyId)); err != nil {
+		slog.Error("Completed upload is not encrypted with the KMS key",
+			"bucket", aws.ToString(input.Bucket),
+			"key", aws.ToString(input.Key),
+			"error", err)
+		if _, deleteErr := api.S3API.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: input.Bucket,
+			Key:    input.Key,
+		}); deleteErr != nil {
+			slog.Warn("Failed to delete unencrypted object", "key", aws.ToString(input.Key), "error", deleteErr)
+		}
+		return nil, fmt.Errorf("object %s: %w", aws.ToString(input.Key), err)
+	}
+	return out, nil
+}
+
+// SSEKMSKeyID implements Encrypter
+func (s *MinIOStorage) SSEKMSKeyID() string {
+	return s.config.SSEKMSKeyID
+}
+
+// sseKMS returns the encryption of objects the server writes itself, which
+// is left to the bucket default without a KMS key
+func (s *MinIOStorage) sseKMS() (types.ServerSideEncryption, *string) {
+	if s.config.SSEKMSKeyID == "" {
+		return "", nil
+	}
+	return types.ServerSideEncryptionAwsKms, aws.String(s.config.SSEKMSKeyID)
+}
+
+// verifySSEKMS checks the encryption S3 reports for an object against the
+// configured KMS key
+func verifySSEKMS(keyID string, encryption types.ServerSideEncryption, reportedKeyID string) error {
+	if encryption != types.ServerSideEncryptionAwsKms && encryption != types.ServerSideEncryptionAwsKmsDsse {
+		if encryption == "" {
+			encryption = "none"
+		}
+		return fmt.Errorf("%w: encrypted with %s", ErrNotEncrypted, encryption)
+	}
+	if !kmsKeyMatches(keyID, reportedKeyID) {
+		return fmt.Errorf("%w: encrypted with key %q", ErrNotEncrypted, reportedKeyID)
+	}
+	return nil
+}
+
+// kmsKeyMatches reports whether the key S3 reports is the configured one.
+// AWS reports the ARN of the key, which an alias doesn't reveal, so only
+// the algorithm is verified for aliases. MinIO reports the key name in an
+// ARN of its own, such as arn:aws:kms:my-key.
+func kmsKeyMatches(keyID, reported string) bool {
+	if strings.HasPrefix(keyID, "alias/") || strings.Contains(keyID, ":alias/") {
+		return true
+	}
+	return kmsKeyName(keyID) == kmsKeyName(reported)
+}
+
+// kmsKeyName returns the key ID of a key ARN, or the key ID itself
+func kmsKeyName(key string) string {
+	if i := strings.LastIndexAny(key, "/:"); i >= 0 {
+		return key[i+1:]
+	}
+	return key
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/tus/tusd/v2/pkg/s3store"
+)
+
+// encryptingS3API records the encryption requested for new objects and
+// reports completed uploads encrypted with a key
+type encryptingS3API struct {
+	s3store.S3API
+	requested  []types.ServerSideEncryption
+	keys       []string
+	encryption types.ServerSideEncryption
+	reported   string
+	aborted    int
+	deleted    int
+}
+
+func (api *encryptingS3API) PutObject(ctx context.Context, input *s3.PutObjectInput, opts ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	api.requested = append(api.requested, input.ServerSideEncryption)
+	api.keys = append(api.keys, aws.ToString(input.SSEKMSKeyId))
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (api *encryptingS3API) CreateMultipartUpload(ctx context.Context, input *s3.CreateMultipartUploadInput, opts ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	api.requested = append(api.requested, input.ServerSideEncryption)
+	api.keys = append(api.keys, aws.ToString(input.SSEKMSKeyId))
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("multipart"), ServerSideEncryption: api.encryption, SSEKMSKeyId: aws.String(api.reported)}, nil
+}
+
+func (api *encryptingS3API) AbortMultipartUpload(ctx context.Context, input *s3.AbortMultipartUploadInput, opts ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	api.aborted++
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func (api *encryptingS3API) DeleteObject(ctx context.Context, input *s3.DeleteObjectInput, opts ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	api.deleted++
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (api *encryptingS3API) CompleteMultipartUpload(ctx context.Context, input *s3.CompleteMultipartUploadInput, opts ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	return &s3.CompleteMultipartUploadOutput{ServerSideEncryption: api.encryption, SSEKMSKeyId: aws.String(api.reported)}, nil
+}
+
+func TestSSEKMSS3API(t *testing.T) {
+	ctx := context.Background()
+	const keyID = "1234abcd-12ab-34cd-56ef-1234567890ab"
+	backend := &encryptingS3API{encryption: types.ServerSideEncryptionAwsKms, reported: keyID}
+	api := sseKMSS3API{S3API: backend, keyID: keyID}
+
+	if _, err := api.PutObject(ctx, &s3.PutObjectInput{Key: aws.String("upload.info")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{Key: aws.String("upload")}); err != nil {
+		t.Fatal(err)
+	}
+	for i, encryption := range backend.requested {
+		if encryption != types.ServerSideEncryptionAwsKms || backend.keys[i] != keyID {
+			t.Fatalf("request %d: expected SSE-KMS with %s, got %q with %q", i, keyID, encryption, backend.keys[i])
+		}
+	}
+
+	tests := []struct {
+		encryption types.ServerSideEncryption
+		reported   string
+		wantErr    bool
+	}{
+		{types.ServerSideEncryptionAwsKms, "arn:aws:kms:us-east-1:111122223333:key/" + keyID, false},
+		{types.ServerSideEncryptionAwsKms, keyID, false},
+		{types.ServerSideEncryptionAwsKms, "arn:aws:kms:us-east-1:111122223333:key/other", true},
+		{types.ServerSideEncryptionAes256, "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		backend.encryption, backend.reported = tt.encryption, tt.reported
+		backend.aborted, backend.deleted = 0, 0
+
+		// Multipart uploads S3 doesn't encrypt with the key are aborted
+		// before any data is written
+		_, err := api.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{Key: aws.String("upload")})
+		if tt.wantErr != (err != nil) || (err != nil && !errors.Is(err, ErrNotEncrypted)) {
+			t.Errorf("creating %q with %q: unexpected error %v", tt.encryption, tt.reported, err)
+		}
+		if tt.wantErr != (backend.aborted == 1) {
+			t.Errorf("creating %q with %q: %d aborted", tt.encryption, tt.reported, backend.aborted)
+		}
+
+		// Completed objects that aren't are deleted
+		_, err = api.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{Key: aws.String("upload")})
+		if tt.wantErr != (err != nil) || (err != nil && !errors.Is(err, ErrNotEncrypted)) {
+			t.Errorf("completing %q with %q: unexpected error %v", tt.encryption, tt.reported, err)
+		}
+		if tt.wantErr != (backend.deleted == 1) {
+			t.Errorf("completing %q with %q: %d deleted", tt.encryption, tt.reported, backend.deleted)
+		}
+	}
+}
+
+func TestKMSKeyMatches(t *testing.T) {
+	tests := []struct {
+		keyID    string
+		reported string
+		want     bool
+	}{
+		{"arn:aws:kms:us-east-1:111122223333:key/abcd", "arn:aws:kms:us-east-1:111122223333:key/abcd", true},
+		{"abcd", "arn:aws:kms:us-east-1:111122223333:key/abcd", true},
+		{"my-key", "arn:aws:kms:my-key", true},
+		{"alias/uploads", "arn:aws:kms:us-east-1:111122223333:key/abcd", true},
+		{"arn:aws:kms:us-east-1:111122223333:alias/uploads", "arn:aws:kms:us-east-1:111122223333:key/abcd", true},
+		{"abcd", "", false},
+		{"abcd", "arn:aws:kms:my-key", false},
+	}
+	for _, tt := range tests {
+		if got := kmsKeyMatches(tt.keyID, tt.reported); got != tt.want {
+			t.Errorf("%s reported as %q: got %v, want %v", tt.keyID, tt.reported, got, tt.want)
+		}
+	}
+}
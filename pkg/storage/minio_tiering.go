@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+)
+
+// TransitionUpload copies the object of a finished upload onto itself in the
+// storage class, keeping its metadata. Objects in archive classes must be
+// restored before they can be downloaded again.
+func (s *MinIOStorage) TransitionUpload(ctx context.Context, uploadID, class string) error {
+	key := ObjectKey(uploadID)
+	head, err := s.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucketFor(key)),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("upload %s has no object: %w", uploadID, tusd.ErrNotFound)
+		}
+		return fmt.Errorf("failed to stat upload %s: %w", uploadID, err)
+	}
+
+	// S3 leaves out the class of objects in STANDARD
+	current := head.StorageClass
+	if current == "" {
+		current = types.StorageClassStandard
+	}
+	if current != types.StorageClass(class) {
+		err := s.copyObject(ctx, key, key, aws.ToInt64(head.ContentLength), copyOptions{
+			StorageClass: types.StorageClass(class),
+			Metadata:     head.Metadata,
+			ContentType:  head.ContentType,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to move upload %s to %s: %w", uploadID, class, err)
+		}
+	}
+
+	if err := s.setInfoClass(ctx, uploadID, class); err != nil {
+		return err
+	}
+	slog.Debug("Upload moved to storage class", "id", uploadID, "from", current, "class", class)
+	return nil
+}
+
+// setInfoClass records the storage class in the metadata of the upload's
+// .info object
+func (s *MinIOStorage) setInfoClass(ctx context.Context, uploadID, class string) error {
+	key := ObjectKey(uploadID) + ".info"
+	out, err := s.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketFor(key)),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read upload info %s: %w", key, err)
+	}
+	data, err := io.ReadAll(out.Body)
+	out.Body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read upload info %s: %w", key, err)
+	}
+
+	var info tusd.FileInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return fmt.Errorf("failed to decode upload info %s: %w", key, err)
+	}
+	if info.MetaData == nil {
+		info.MetaData = make(tusd.MetaData)
+	}
+	info.MetaData[StorageClassMetadataKey] = class
+	if data, err = json.Marshal(info); err != nil {
+		return fmt.Errorf("failed to encode upload info %s: %w", key, err)
+	}
+
+	encryption, keyID := s.sseKMS()
+	if _, err := s.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:               aws.String(s.bucketFor(key)),
+		Key:                  aws.String(key),
+		Body:                 bytes.NewReader(data),
+		ContentLength:        aws.Int64(int64(len(data))),
+		ServerSideEncryption: encryption,
+		SSEKMSKeyId:          keyID,
+	}); err != nil {
+		return fmt.Errorf("failed to write upload info %s: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,817 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/devsnb/large-file-uploads/pkg/internal/jsonstore"
+)
+
+// Defaults of mirror replication
+const (
+	DefaultMirrorRetry       = 30 * time.Second
+	DefaultMirrorMaxAttempts = 10
+)
+
+// maxMirrorRetry caps the backoff between replication attempts
+const maxMirrorRetry = time.Hour
+
+// mirrorLease is how long an instance may take to copy an upload it
+// claimed. Afterwards other instances assume it stopped and try again.
+const mirrorLease = time.Hour
+
+// ErrNotReplicating is returned when retrying an upload that isn't queued
+// for replication
+var ErrNotReplicating = errors.New("upload is not queued for replication")
+
+// MirrorConfig configures how a mirror storage retries replication
+type MirrorConfig struct {
+	// Retry is the delay before the first retry of a failed replication.
+	// It doubles with each attempt, up to an hour.
+	Retry time.Duration
+
+	// MaxAttempts is how often a replication is tried before it is parked
+	// as failed until an operator retries it
+	MaxAttempts int
+
+	// StateDir persists the replication queue as one file per upload.
+	// Instances sharing the directory share the queue. Empty keeps it in
+	// memory only.
+	StateDir string
+}
+
+// MirrorTask is an upload waiting to be copied to mirrors
+type MirrorTask struct {
+	ID          string     `json:"id"`
+	Pending     []Provider `json:"pending"` // mirrors without a copy yet
+	Attempts    int        `json:"attempts"`
+	QueuedAt    time.Time  `json:"queuedAt"`
+	NextAttempt time.Time  `json:"nextAttempt"`
+	LastError   string     `json:"lastError,omitempty"`
+	Failed      bool       `json:"failed"`              // gave up until retried
+	ClaimedBy   string     `json:"claimedBy,omitempty"` // instance copying it
+}
+
+// MirrorStatus describes the replication queue of a mirror storage
+type MirrorStatus struct {
+	Primary    Provider     `json:"primary"`
+	Mirrors    []Provider   `json:"mirrors"`
+	Queued     int          `json:"queued"`     // uploads waiting for an attempt
+	Replicated int64        `json:"replicated"` // copies made by this instance since startup
+	Failed     []MirrorTask `json:"failed"`
+}
+
+// MirrorResult is the outcome of replicating an upload to a mirror. Failed
+// attempts are only reported once replication gives up.
+type MirrorResult struct {
+	Upload   tusd.FileInfo
+	Mirror   Provider
+	Attempts int
+	Err      error
+}
+
+// Mirror is implemented by storage that copies completed uploads to
+// secondary backends
+type Mirror interface {
+	MirrorStatus() MirrorStatus
+
+	// Replicate queues a completed upload for copying to all mirrors
+	Replicate(id string) error
+
+	// RetryReplication retries a queued or failed upload right away
+	RetryReplication(id string) error
+
+	// RunReplication works through the queue until the context is done,
+	// holding the lock of each upload while it is copied
+	RunReplication(ctx context.Context, lock LockFunc, report func(MirrorResult))
+}
+
+// mirrorState is the persisted state of a mirror storage
+
+// mirrorEntry is the persisted replication state of an upload
+type mirrorEntry struct {
+	ID   string      `json:"id"`
+	Task *MirrorTask `json:"task,omitempty"` // nil once every mirror has a copy
+
+	// Copies maps mirrors that generated a different ID to the upload's ID
+	// there, so termination finds them
+	Copies map[Provider]string `json:"copies,omitempty"`
+}
+
+// mirrorEntries stores the replication state of uploads
+type mirrorEntries interface {
+	Put(id string, entry mirrorEntry) error
+	Get(id string) (mirrorEntry, error)
+	List() ([]mirrorEntry, error)
+	Delete(id string) error
+}
+
+// memoryMirrorEntries keeps the replication state in memory
+type memoryMirrorEntries struct {
+	*jsonstore.Memory[mirrorEntry]
+}
+
+func (e memoryMirrorEntries) Put(id string, entry mirrorEntry) error {
+	e.Memory.Put(id, entry)
+	return nil
+}
+
+func (e memoryMirrorEntries) List() ([]mirrorEntry, error) {
+	return e.Memory.List(), nil
+}
+
+// MirrorStorage writes uploads to a primary backend and copies completed
+// uploads to one or more mirrors in the background, e.g. for disaster
+// recovery. All requests are served by the primary backend.
+type MirrorStorage struct {
+	primary  Storage
+	mirrors  []Storage
+	cfg      MirrorConfig
+	composer *tusd.StoreComposer
+	now      func() time.Time
+	wake     chan struct{}
+
+	// instance names this process in the tasks it claims
+	instance string
+
+	mu         sync.Mutex // serializes updates of entries by this instance
+	entries    mirrorEntries
+	replicated int64
+}
+
+// NewMirrorStorage wraps initialized backends and restores the queue of a
+// previous run
+func NewMirrorStorage(primary Storage, mirrors []Storage, cfg MirrorConfig) (*MirrorStorage, error) {
+	if len(mirrors) == 0 {
+		return nil, fmt.Errorf("at least one mirror is required: %w", ErrInvalidConfig)
+	}
+	providers := []Provider{primary.GetProvider()}
+	for _, backend := range append([]Storage{primary}, mirrors...) {
+		// Upload IDs are only scoped to tenants on a single backend
+		if scoped, ok := backend.(TenantScoped); ok && scoped.TenantScoped() {
+			return nil, fmt.Errorf("mirrors are not supported with per-tenant credentials or buckets: %w", ErrInvalidConfig)
+		}
+	}
+	for _, mirror := range mirrors {
+		// Mirrors are told apart by their provider
+		if slices.Contains(providers, mirror.GetProvider()) {
+			return nil, fmt.Errorf("mirror %s is configured twice: %w", mirror.GetProvider(), ErrInvalidConfig)
+		}
+		providers = append(providers, mirror.GetProvider())
+	}
+	if cfg.Retry <= 0 {
+		cfg.Retry = DefaultMirrorRetry
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultMirrorMaxAttempts
+	}
+
+	var entries mirrorEntries = memoryMirrorEntries{jsonstore.NewMemory[mirrorEntry](ErrNotReplicating)}
+	if cfg.StateDir != "" {
+		dir, err := jsonstore.NewDir[mirrorEntry](cfg.StateDir, "replication queue", ErrNotReplicating)
+		if err != nil {
+			return nil, err
+		}
+		entries = dir
+	}
+	hostname, _ := os.Hostname()
+
+	m := &MirrorStorage{
+		primary:  primary,
+		mirrors:  mirrors,
+		cfg:      cfg,
+		now:      time.Now,
+		wake:     make(chan struct{}, 1),
+		instance: fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		entries:  entries,
+	}
+	queued, err := m.prune()
+	if err != nil {
+		return nil, err
+	}
+	m.composer = m.newComposer()
+
+	if queued > 0 {
+		slog.Info("Resuming storage replication", "uploads", queued)
+	}
+	return m, nil
+}
+
+// newComposer serves everything from the primary backend. Only termination
+// is intercepted, so copies are deleted along with the upload.
+func (m *MirrorStorage) newComposer() *tusd.StoreComposer {
+	primary := m.primary.GetStoreComposer()
+
+	composer := tusd.NewStoreComposer()
+	composer.UseCore(primary.Core)
+	if primary.UsesLocker {
+		composer.UseLocker(primary.Locker)
+	}
+	if primary.UsesTerminater {
+		composer.UseTerminater(mirrorTerminater{m, primary.Terminater})
+	}
+	if primary.UsesConcater {
+		composer.UseConcater(primary.Concater)
+	}
+	if primary.UsesLengthDeferrer {
+		composer.UseLengthDeferrer(primary.LengthDeferrer)
+	}
+	if primary.UsesContentServer {
+		composer.UseContentServer(primary.ContentServer)
+	}
+	return composer
+}
+
+// Initialize does nothing, since all backends are initialized when the
+// mirror storage is created
+func (m *MirrorStorage) Initialize(ctx context.Context, cfg *Config) error {
+	return nil
+}
+
+// GetHandler returns a tusd handler for the mirror storage
+func (m *MirrorStorage) GetHandler(basePath string) (*tusd.Handler, error) {
+	handler, err := tusd.NewHandler(tusd.Config{
+		BasePath:              basePath,
+		StoreComposer:         m.composer,
+		NotifyCompleteUploads: true,
+		DisableDownload:       false,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating handler: %w", err)
+	}
+	return handler, nil
+}
+
+// GetProvider returns the provider of the primary backend
+func (m *MirrorStorage) GetProvider() Provider {
+	return m.primary.GetProvider()
+}
+
+// GetStoreComposer returns the composer of the primary backend
+func (m *MirrorStorage) GetStoreComposer() *tusd.StoreComposer {
+	return m.composer
+}
+
+// ReconcileUploads lets the primary backend check its unfinished uploads
+func (m *MirrorStorage) ReconcileUploads(ctx context.Context, lock LockFunc) ([]UploadRepair, error) {
+	reconciler, ok := m.primary.(UploadReconciler)
+	if !ok {
+		return nil, nil
+	}
+	return reconciler.ReconcileUploads(ctx, lock)
+}
+
+// RepairsUploads reports whether the primary backend repairs its unfinished
+// uploads
+func (m *MirrorStorage) RepairsUploads() bool {
+	repairer, ok := m.primary.(UploadRepairer)
+	return ok && repairer.RepairsUploads()
+}
+
+func (m *MirrorStorage) forward(target any) bool {
+	switch target := target.(type) {
+	case *ChunkHinter:
+		*target = m
+		return true
+	case *Presigner:
+		// Downloads are served by the primary backend
+		presigner, ok := Lookup[Presigner](m.primary)
+		*target = presigner
+		return ok
+	case *SASSigner:
+		signer, ok := Lookup[SASSigner](m.primary)
+		*target = signer
+		return ok
+	case *Tierer:
+		// Copies keep the storage class they were written with
+		tierer, ok := Lookup[Tierer](m.primary)
+		*target = tierer
+		return ok
+	case *CapabilityReporter:
+		reporter, ok := Lookup[CapabilityReporter](m.primary)
+		*target = reporter
+		return ok
+	}
+	return false
+}
+
+// ChunkHints implements ChunkHinter with the hints of the primary backend,
+// limiting uploads to a size every mirror can hold
+func (m *MirrorStorage) ChunkHints() ChunkHints {
+	var hints ChunkHints
+	if hinter, ok := Lookup[ChunkHinter](m.primary); ok {
+		hints = hinter.ChunkHints()
+	}
+	for _, mirror := range m.mirrors {
+		if hinter, ok := Lookup[ChunkHinter](mirror); ok {
+			hints.MaxUploadSize = minLimit(hints.MaxUploadSize, hinter.ChunkHints().MaxUploadSize)
+		}
+	}
+	return hints
+}
+
+// MirrorStatus returns the replication queue
+func (m *MirrorStorage) MirrorStatus() MirrorStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := MirrorStatus{
+		Primary:    m.primary.GetProvider(),
+		Mirrors:    make([]Provider, 0, len(m.mirrors)),
+		Replicated: m.replicated,
+		Failed:     []MirrorTask{},
+	}
+	for _, mirror := range m.mirrors {
+		status.Mirrors = append(status.Mirrors, mirror.GetProvider())
+	}
+	for _, task := range m.tasks() {
+		if task.Failed {
+			status.Failed = append(status.Failed, *task)
+		} else {
+			status.Queued++
+		}
+	}
+	sort.Slice(status.Failed, func(i, j int) bool { return status.Failed[i].ID < status.Failed[j].ID })
+	return status
+}
+
+// tasks returns the queued uploads. The caller must hold mu.
+func (m *MirrorStorage) tasks() []*MirrorTask {
+	entries, err := m.entries.List()
+	if err != nil {
+		slog.Error("Failed to read replication queue", "error", err)
+	}
+	var tasks []*MirrorTask
+	for _, entry := range entries {
+		if entry.Task != nil {
+			tasks = append(tasks, entry.Task)
+		}
+	}
+	return tasks
+}
+
+// update changes the replication state of an upload. Nothing is written if
+// change fails, and state without a task or copies is removed.
+func (m *MirrorStorage) update(id string, change func(entry *mirrorEntry) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, err := m.entries.Get(id)
+	if errors.Is(err, ErrNotReplicating) {
+		entry = mirrorEntry{ID: id}
+	} else if err != nil {
+		return err
+	}
+	if err := change(&entry); err != nil {
+		return err
+	}
+	if entry.Task == nil && len(entry.Copies) == 0 {
+		if err := m.entries.Delete(id); err != nil && !errors.Is(err, ErrNotReplicating) {
+			return err
+		}
+		return nil
+	}
+	return m.entries.Put(id, entry)
+}
+
+// Replicate queues a completed upload for copying to all mirrors. Queuing
+// it again starts over.
+func (m *MirrorStorage) Replicate(id string) error {
+	now := m.now()
+	task := &MirrorTask{ID: id, QueuedAt: now, NextAttempt: now}
+	for _, mirror := range m.mirrors {
+		task.Pending = append(task.Pending, mirror.GetProvider())
+	}
+	err := m.update(id, func(entry *mirrorEntry) error {
+		entry.Task = task
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save replication queue: %w", err)
+	}
+	m.signal()
+	return nil
+}
+
+// RetryReplication retries a queued or failed upload right away, with a
+// fresh count of attempts
+func (m *MirrorStorage) RetryReplication(id string) error {
+	err := m.update(id, func(entry *mirrorEntry) error {
+		if entry.Task == nil {
+			return ErrNotReplicating
+		}
+		entry.Task.Failed = false
+		entry.Task.Attempts = 0
+		entry.Task.NextAttempt = m.now()
+		entry.Task.ClaimedBy = ""
+		return nil
+	})
+	if errors.Is(err, ErrNotReplicating) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save replication queue: %w", err)
+	}
+	m.signal()
+	return nil
+}
+
+// signal wakes up RunReplication
+func (m *MirrorStorage) signal() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// RunReplication copies due uploads until the context is done
+func (m *MirrorStorage) RunReplication(ctx context.Context, lock LockFunc, report func(MirrorResult)) {
+	for {
+		m.replicateDue(ctx, lock, report)
+
+		timer := time.NewTimer(m.untilNext())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-m.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// replicateDue copies the uploads whose next attempt has come
+func (m *MirrorStorage) replicateDue(ctx context.Context, lock LockFunc, report func(MirrorResult)) {
+	for _, id := range m.due() {
+		if ctx.Err() != nil {
+			return
+		}
+		m.replicate(ctx, id, lock, report)
+	}
+}
+
+// due returns the uploads whose next attempt has come, oldest first
+func (m *MirrorStorage) due() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	var tasks []*MirrorTask
+	for _, task := range m.tasks() {
+		if !task.Failed && !task.NextAttempt.After(now) {
+			tasks = append(tasks, task)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		if !tasks[i].QueuedAt.Equal(tasks[j].QueuedAt) {
+			return tasks[i].QueuedAt.Before(tasks[j].QueuedAt)
+		}
+		return tasks[i].ID < tasks[j].ID
+	})
+	ids := make([]string, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.ID
+	}
+	return ids
+}
+
+// untilNext returns how long until the next attempt is due. With a shared
+// queue, uploads other instances queued are looked for at least every
+// retry delay.
+func (m *MirrorStorage) untilNext() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wait := maxMirrorRetry
+	if m.cfg.StateDir != "" {
+		wait = m.cfg.Retry
+	}
+	now := m.now()
+	for _, task := range m.tasks() {
+		if task.Failed {
+			continue
+		}
+		wait = min(wait, max(task.NextAttempt.Sub(now), 0))
+	}
+	return wait
+}
+
+// claim takes a due upload for this instance, so instances sharing the
+// queue don't copy it at the same time, and returns the mirrors it is
+// pending on. It reports false if the upload isn't due anymore.
+func (m *MirrorStorage) claim(id string) ([]Provider, bool) {
+	var pending []Provider
+	err := m.update(id, func(entry *mirrorEntry) error {
+		if entry.Task == nil || entry.Task.Failed || entry.Task.NextAttempt.After(m.now()) {
+			return ErrNotReplicating
+		}
+		entry.Task.ClaimedBy = m.instance
+		entry.Task.NextAttempt = m.now().Add(mirrorLease)
+		pending = slices.Clone(entry.Task.Pending)
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, ErrNotReplicating) {
+			slog.Error("Failed to claim upload for replication", "id", id, "error", err)
+		}
+		return nil, false
+	}
+	if m.cfg.StateDir == "" {
+		return pending, true
+	}
+
+	// Another instance may have claimed it at the same time; the last
+	// claim written wins
+	m.mu.Lock()
+	entry, err := m.entries.Get(id)
+	m.mu.Unlock()
+	if err != nil || entry.Task == nil || entry.Task.ClaimedBy != m.instance {
+		return nil, false
+	}
+	return pending, true
+}
+
+// replicate copies an upload to the mirrors still missing it
+func (m *MirrorStorage) replicate(ctx context.Context, id string, lock LockFunc, report func(MirrorResult)) {
+	pending, ok := m.claim(id)
+	if !ok {
+		return
+	}
+
+	unlock, err := lock(ctx, id)
+	if err != nil {
+		m.attempted(ctx, tusd.FileInfo{ID: id}, nil, fmt.Errorf("failed to lock upload: %w", err), report)
+		return
+	}
+	defer unlock()
+
+	source, err := m.primary.GetStoreComposer().Core.GetUpload(ctx, id)
+	if errors.Is(err, tusd.ErrNotFound) {
+		// Terminated without the mirror storage noticing
+		m.drop(id)
+		return
+	}
+	if err != nil {
+		m.attempted(ctx, tusd.FileInfo{ID: id}, nil, err, report)
+		return
+	}
+	info, err := source.GetInfo(ctx)
+	if err == nil && (info.SizeIsDeferred || info.Offset < info.Size) {
+		err = errors.New("upload is not complete")
+	}
+	if err != nil {
+		m.attempted(ctx, tusd.FileInfo{ID: id}, nil, err, report)
+		return
+	}
+
+	copied := make(map[Provider]string)
+	var errs []error
+	for _, mirror := range m.mirrors {
+		if !slices.Contains(pending, mirror.GetProvider()) {
+			continue
+		}
+		target, err := copyToMirror(ctx, mirror, source, info)
+		if err != nil {
+			slog.Warn("Failed to replicate upload", "id", id, "mirror", mirror.GetProvider(), "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", mirror.GetProvider(), err))
+			continue
+		}
+		copied[mirror.GetProvider()] = target
+		slog.Info("Upload replicated", "id", id, "mirror", mirror.GetProvider(), "size", info.Size)
+		report(MirrorResult{Upload: info, Mirror: mirror.GetProvider()})
+	}
+	m.attempted(ctx, info, copied, errors.Join(errs...), report)
+}
+
+// attempted records the outcome of an attempt and releases the upload's
+// claim. Mirrors that got a copy are done; the others are retried with
+// backoff until the attempts run out.
+func (m *MirrorStorage) attempted(ctx context.Context, info tusd.FileInfo, copied map[Provider]string, err error, report func(MirrorResult)) {
+	var gaveUp []MirrorResult
+	updateErr := m.update(info.ID, func(entry *mirrorEntry) error {
+		gaveUp = nil
+		task := entry.Task
+		if task == nil {
+			return ErrNotReplicating
+		}
+		task.ClaimedBy = ""
+		task.NextAttempt = m.now()
+		for provider, target := range copied {
+			task.Pending = slices.DeleteFunc(task.Pending, func(p Provider) bool { return p == provider })
+			if target != info.ID {
+				if entry.Copies == nil {
+					entry.Copies = make(map[Provider]string)
+				}
+				entry.Copies[provider] = target
+			}
+		}
+
+		switch {
+		case len(task.Pending) == 0:
+			entry.Task = nil
+		case ctx.Err() != nil:
+			// Shutting down is not a failed attempt
+		default:
+			task.Attempts++
+			task.LastError = err.Error()
+			if task.Attempts >= m.cfg.MaxAttempts {
+				task.Failed = true
+				slog.Error("Giving up replicating upload", "id", info.ID, "mirrors", task.Pending, "attempts", task.Attempts, "error", err)
+				for _, provider := range task.Pending {
+					gaveUp = append(gaveUp, MirrorResult{Upload: info, Mirror: provider, Attempts: task.Attempts, Err: err})
+				}
+			} else {
+				delay := min(m.cfg.Retry<<(task.Attempts-1), maxMirrorRetry)
+				task.NextAttempt = m.now().Add(delay)
+			}
+		}
+		return nil
+	})
+	if updateErr != nil && !errors.Is(updateErr, ErrNotReplicating) {
+		slog.Error("Failed to save replication queue", "error", updateErr)
+	}
+
+	m.mu.Lock()
+	m.replicated += int64(len(copied))
+	m.mu.Unlock()
+
+	// Reported without holding mu, so subscribers may query the status
+	for _, result := range gaveUp {
+		report(result)
+	}
+}
+
+// copyToMirror writes a completed upload to a mirror under the same ID,
+// unless the mirror generates its own, and returns its ID there. A complete
+// copy left by an earlier attempt is kept, a partial one is replaced.
+func copyToMirror(ctx context.Context, mirror Storage, source tusd.Upload, info tusd.FileInfo) (string, error) {
+	composer := mirror.GetStoreComposer()
+
+	existing, err := composer.Core.GetUpload(ctx, info.ID)
+	switch {
+	case errors.Is(err, tusd.ErrNotFound):
+	case err != nil:
+		return "", err
+	default:
+		existingInfo, err := existing.GetInfo(ctx)
+		if err != nil {
+			return "", err
+		}
+		if !existingInfo.SizeIsDeferred && existingInfo.Size == info.Size && existingInfo.Offset == info.Size {
+			return info.ID, nil
+		}
+		if !composer.UsesTerminater {
+			return "", errors.New("a partial copy exists and the mirror can't delete it")
+		}
+		if err := composer.Terminater.AsTerminatableUpload(existing).Terminate(ctx); err != nil {
+			return "", fmt.Errorf("failed to delete partial copy: %w", err)
+		}
+	}
+
+	target, err := composer.Core.NewUpload(ctx, tusd.FileInfo{
+		ID:       info.ID,
+		Size:     info.Size,
+		MetaData: maps.Clone(info.MetaData),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create copy: %w", err)
+	}
+	targetInfo, err := target.GetInfo(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err := writeUpload(ctx, source, target, info.Size); err != nil {
+		if composer.UsesTerminater {
+			if err := composer.Terminater.AsTerminatableUpload(target).Terminate(ctx); err != nil {
+				slog.Warn("Failed to delete partial copy", "id", targetInfo.ID, "mirror", mirror.GetProvider(), "error", err)
+			}
+		}
+		return "", err
+	}
+	return targetInfo.ID, nil
+}
+
+// drop removes an upload from the queue
+func (m *MirrorStorage) drop(id string) {
+	err := m.update(id, func(entry *mirrorEntry) error {
+		entry.Task = nil
+		return nil
+	})
+	if err != nil {
+		slog.Error("Failed to save replication queue", "error", err)
+	}
+}
+
+// forget removes a terminated upload from the queue and deletes its copies.
+// Mirrors that can't terminate uploads keep theirs.
+func (m *MirrorStorage) forget(ctx context.Context, id string) {
+	var copies map[Provider]string
+	err := m.update(id, func(entry *mirrorEntry) error {
+		copies = entry.Copies
+		entry.Task = nil
+		entry.Copies = nil
+		return nil
+	})
+	if err != nil {
+		slog.Error("Failed to save replication queue", "error", err)
+	}
+
+	for _, mirror := range m.mirrors {
+		composer := mirror.GetStoreComposer()
+		if !composer.UsesTerminater {
+			continue
+		}
+		target := id
+		if copied, ok := copies[mirror.GetProvider()]; ok {
+			target = copied
+		}
+		upload, err := composer.Core.GetUpload(ctx, target)
+		if errors.Is(err, tusd.ErrNotFound) {
+			continue
+		}
+		if err == nil {
+			err = composer.Terminater.AsTerminatableUpload(upload).Terminate(ctx)
+		}
+		if err != nil {
+			slog.Warn("Failed to delete replicated copy", "id", id, "mirror", mirror.GetProvider(), "error", err)
+		}
+	}
+}
+
+// prune stops replicating to mirrors removed from the configuration and
+// returns how many uploads are still queued
+func (m *MirrorStorage) prune() (int, error) {
+	entries, err := m.entries.List()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read replication queue: %w", err)
+	}
+	configured := func(p Provider) bool {
+		return slices.ContainsFunc(m.mirrors, func(mirror Storage) bool { return mirror.GetProvider() == p })
+	}
+
+	queued := 0
+	for _, entry := range entries {
+		if entry.Task == nil {
+			continue
+		}
+		if !slices.ContainsFunc(entry.Task.Pending, func(p Provider) bool { return !configured(p) }) {
+			queued++
+			continue
+		}
+		err := m.update(entry.ID, func(entry *mirrorEntry) error {
+			if entry.Task == nil {
+				return nil
+			}
+			entry.Task.Pending = slices.DeleteFunc(entry.Task.Pending, func(p Provider) bool { return !configured(p) })
+			if len(entry.Task.Pending) == 0 {
+				entry.Task = nil
+			} else {
+				queued++
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, fmt.Errorf("failed to save replication queue: %w", err)
+		}
+	}
+	return queued, nil
+}
+
+// mirrorTerminater deletes the copies of terminated uploads
+type mirrorTerminater struct {
+	m       *MirrorStorage
+	primary tusd.TerminaterDataStore
+}
+
+func (t mirrorTerminater) AsTerminatableUpload(upload tusd.Upload) tusd.TerminatableUpload {
+	return mirrorTermination{t.m, upload, t.primary.AsTerminatableUpload(upload)}
+}
+
+type mirrorTermination struct {
+	m          *MirrorStorage
+	upload     tusd.Upload
+	terminater tusd.TerminatableUpload
+}
+
+func (t mirrorTermination) Terminate(ctx context.Context) error {
+	// The ID can't be looked up once the upload is gone
+	info, infoErr := t.upload.GetInfo(ctx)
+	if err := t.terminater.Terminate(ctx); err != nil {
+		return err
+	}
+	if infoErr == nil {
+		t.m.forget(ctx, info.ID)
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+)
+
+// readUpload returns the data of an upload on a backend
+func readUpload(t *testing.T, backend Storage, id string) string {
+	t.Helper()
+	ctx := context.Background()
+	upload, err := backend.GetStoreComposer().Core.GetUpload(ctx, id)
+	if err != nil {
+		t.Fatalf("upload %s on %s: %v", id, backend.GetProvider(), err)
+	}
+	reader, err := upload.GetReader(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	data, _ := io.ReadAll(reader)
+	return string(data)
+}
+
+func TestMirrorStorage(t *testing.T) {
+	ctx := context.Background()
+	primary := NewMemoryStorage()
+	if err := primary.Initialize(ctx, &Config{Provider: Memory}); err != nil {
+		t.Fatal(err)
+	}
+	disk := NewDiskStorage()
+	if err := disk.Initialize(ctx, &Config{Provider: Disk, Properties: map[string]interface{}{"rootDir": t.TempDir()}}); err != nil {
+		t.Fatal(err)
+	}
+	// The Azure mirror is a memory store that fails while outage is set
+	var outage error
+	azureMemory := NewMemoryStorage()
+	if err := azureMemory.Initialize(ctx, &Config{Provider: Memory}); err != nil {
+		t.Fatal(err)
+	}
+	azureComposer := tusd.NewStoreComposer()
+	azureComposer.UseCore(outageStore{azureMemory.GetStoreComposer().Core, &outage})
+	azureComposer.UseTerminater(azureMemory.GetStoreComposer().Terminater)
+	azure := composerStorage{Azure, azureComposer}
+
+	if _, err := NewMirrorStorage(primary, []Storage{disk, primary}, MirrorConfig{}); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expected ErrInvalidConfig for a mirror of the primary backend, got %v", err)
+	}
+	cfg := MirrorConfig{Retry: time.Minute, MaxAttempts: 2, StateDir: t.TempDir()}
+	store, err := NewMirrorStorage(primary, []Storage{disk, azure}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	upload, err := store.GetStoreComposer().Core.NewUpload(ctx, tusd.FileInfo{ID: "report", Size: 5, MetaData: tusd.MetaData{"filename": "a.txt"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := upload.WriteChunk(ctx, 0, strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := upload.FinishUpload(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Replicate("report"); err != nil {
+		t.Fatal(err)
+	}
+
+	var results []MirrorResult
+	report := func(result MirrorResult) { results = append(results, result) }
+	outage = errors.New("connection refused")
+	store.replicateDue(ctx, noLock, report)
+	if len(results) != 1 || results[0].Mirror != Disk || results[0].Err != nil {
+		t.Fatalf("expected only the disk copy to be reported, got %+v", results)
+	}
+	if data := readUpload(t, disk, "report"); data != "hello" {
+		t.Fatalf("disk copy holds %q", data)
+	}
+
+	// Failed mirrors are retried with backoff until the attempts run out
+	results = nil
+	store.replicateDue(ctx, noLock, report)
+	if len(results) != 0 {
+		t.Fatalf("expected the retry to wait for its backoff, got %+v", results)
+	}
+	now = now.Add(time.Minute)
+	store.replicateDue(ctx, noLock, report)
+	if len(results) != 1 || results[0].Mirror != Azure || results[0].Err == nil || results[0].Attempts != 2 {
+		t.Fatalf("expected giving up on the Azure copy to be reported, got %+v", results)
+	}
+
+	// A restart keeps the failed upload
+	store, err = NewMirrorStorage(primary, []Storage{disk, azure}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.now = func() time.Time { return now }
+	status := store.MirrorStatus()
+	if status.Queued != 0 || len(status.Failed) != 1 || status.Failed[0].Pending[0] != Azure || status.Failed[0].LastError == "" {
+		t.Fatalf("expected the Azure copy to be parked as failed, got %+v", status)
+	}
+
+	if err := store.RetryReplication("unknown"); !errors.Is(err, ErrNotReplicating) {
+		t.Fatalf("expected ErrNotReplicating, got %v", err)
+	}
+	outage = nil
+	if err := store.RetryReplication("report"); err != nil {
+		t.Fatal(err)
+	}
+	results = nil
+	store.replicateDue(ctx, noLock, report)
+	if len(results) != 1 || results[0].Mirror != Azure || results[0].Err != nil {
+		t.Fatalf("expected the retried Azure copy to be reported, got %+v", results)
+	}
+	if data := readUpload(t, azure, "report"); data != "hello" {
+		t.Fatalf("Azure copy holds %q", data)
+	}
+	if status := store.MirrorStatus(); status.Queued != 0 || len(status.Failed) != 0 || status.Replicated != 1 {
+		t.Fatalf("expected an empty queue, got %+v", status)
+	}
+
+	// Terminating an upload deletes its copies
+	composer := store.GetStoreComposer()
+	upload, err = composer.Core.GetUpload(ctx, "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := composer.Terminater.AsTerminatableUpload(upload).Terminate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, backend := range []Storage{primary, disk, azure} {
+		if _, err := backend.GetStoreComposer().Core.GetUpload(ctx, "report"); !errors.Is(err, tusd.ErrNotFound) {
+			t.Fatalf("expected the upload to be deleted from %s, got %v", backend.GetProvider(), err)
+		}
+	}
+}
+
+func TestMirrorStorageSharedQueue(t *testing.T) {
+	ctx := context.Background()
+	primary := NewMemoryStorage()
+	if err := primary.Initialize(ctx, &Config{Provider: Memory}); err != nil {
+		t.Fatal(err)
+	}
+	disk := NewDiskStorage()
+	if err := disk.Initialize(ctx, &Config{Provider: Disk, Properties: map[string]interface{}{"rootDir": t.TempDir()}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two instances sharing the queue directory
+	cfg := MirrorConfig{Retry: time.Minute, StateDir: t.TempDir()}
+	first, err := NewMirrorStorage(primary, []Storage{disk}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewMirrorStorage(primary, []Storage{disk}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.instance = "second"
+	if untilNext := second.untilNext(); untilNext > cfg.Retry {
+		t.Fatalf("expected a shared queue to be polled every retry delay, waits %v", untilNext)
+	}
+
+	upload, err := first.GetStoreComposer().Core.NewUpload(ctx, tusd.FileInfo{ID: "shared", Size: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := upload.WriteChunk(ctx, 0, strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Replicate("shared"); err != nil {
+		t.Fatal(err)
+	}
+
+	// An upload claimed by one instance isn't copied by the other
+	if _, ok := second.claim("shared"); !ok {
+		t.Fatal("expected the second instance to claim the upload")
+	}
+	if due := first.due(); len(due) != 0 {
+		t.Fatalf("expected the claimed upload not to be due, got %v", due)
+	}
+	if status := first.MirrorStatus(); status.Queued != 1 {
+		t.Fatalf("expected the claimed upload to be queued, got %+v", status)
+	}
+
+	// The claiming instance copies it for both
+	second.attempted(ctx, tusd.FileInfo{ID: "shared"}, nil, errors.New("interrupted"), func(MirrorResult) {})
+	now := time.Now().Add(time.Minute)
+	second.now = func() time.Time { return now }
+	var results []MirrorResult
+	second.replicateDue(ctx, noLock, func(result MirrorResult) { results = append(results, result) })
+	if len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("expected the copy to be reported, got %+v", results)
+	}
+	if data := readUpload(t, disk, "shared"); data != "hello" {
+		t.Fatalf("disk copy holds %q", data)
+	}
+	if status := first.MirrorStatus(); status.Queued != 0 || len(status.Failed) != 0 {
+		t.Fatalf("expected the shared queue to be empty, got %+v", status)
+	}
+
+	// Optional interfaces of the primary backend are forwarded
+	if _, ok := Lookup[ChunkHinter](first); !ok {
+		t.Fatal("expected chunk hints to be forwarded")
+	}
+	if _, ok := Lookup[Presigner](first); ok {
+		t.Fatal("expected presigning to be unavailable with a memory primary")
+	}
+}
@@ -0,0 +1,22 @@
+package storage
+
+import "context"
+
+// PermissionCheck is the outcome of trying one operation the server performs
+// on a storage backend
+type PermissionCheck struct {
+	Operation   string // e.g. CreateMultipartUpload
+	Permission  string // Permission the operation requires, e.g. s3:PutObject
+	Err         error  // nil if the operation succeeded
+	Denied      bool   // The backend refused the operation for lack of the permission
+	Skipped     bool   // Not tried because an operation it depends on failed
+	Unsupported bool   // Not tried because the backend lacks the feature, so the server doesn't use it
+}
+
+// PermissionChecker is implemented by storage backends that can verify
+// their credentials allow every operation the server performs
+type PermissionChecker interface {
+	// CheckPermissions tries each operation on a probe object and removes
+	// it again
+	CheckPermissions(ctx context.Context) []PermissionCheck
+}
@@ -0,0 +1,269 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/tus/tusd/v2/pkg/azurestore"
+)
+
+// Provisioning controls what happens when the bucket or container does not
+// exist at startup
+type Provisioning string
+
+const (
+	// ProvisionCreate creates the missing bucket or container
+	ProvisionCreate Provisioning = "create"
+
+	// ProvisionFail refuses to start
+	ProvisionFail Provisioning = "fail"
+
+	// ProvisionWarn logs a warning and starts without creating it, so
+	// uploads fail until it is created out of band
+	ProvisionWarn Provisioning = "warn"
+)
+
+// ErrBucketNotFound is returned when the bucket or container does not exist
+// and provisioning is set to fail
+var ErrBucketNotFound = errors.New("bucket does not exist")
+
+// Encryption algorithms accepted for the default bucket encryption
+const (
+	EncryptionAES256 = string(types.ServerSideEncryptionAes256)
+	EncryptionKMS    = string(types.ServerSideEncryptionAwsKms)
+)
+
+// BucketSettings are applied to a bucket when the server creates it.
+// Existing buckets are left untouched.
+type BucketSettings struct {
+	// Policy is a JSON bucket policy document
+	Policy string `json:"policy"`
+
+	// Versioning enables object versioning
+	Versioning bool `json:"versioning"`
+
+	// Encryption sets the default server-side encryption, AES256 or aws:kms
+	Encryption string `json:"encryption"`
+
+	// KMSKeyID selects the key used with aws:kms, the AWS managed key when empty
+	KMSKeyID string `json:"kmsKeyId"`
+}
+
+// ParseProvisioning parses a provisioning mode. Empty selects ProvisionCreate.
+func ParseProvisioning(value string) (Provisioning, error) {
+	switch mode := Provisioning(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "":
+		return ProvisionCreate, nil
+	case ProvisionCreate, ProvisionFail, ProvisionWarn:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid provisioning mode %q, expected create, fail or warn: %w", value, ErrInvalidConfig)
+	}
+}
+
+// validate checks the settings before anything is created with them
+func (b BucketSettings) validate() error {
+	if b.Policy != "" && !json.Valid([]byte(b.Policy)) {
+		return fmt.Errorf("bucket policy must be a JSON document: %w", ErrInvalidConfig)
+	}
+	switch b.Encryption {
+	case "", EncryptionAES256, EncryptionKMS:
+	default:
+		return fmt.Errorf("invalid bucket encryption %q, expected %s or %s: %w",
+			b.Encryption, EncryptionAES256, EncryptionKMS, ErrInvalidConfig)
+	}
+	if b.KMSKeyID != "" && b.Encryption != EncryptionKMS {
+		return fmt.Errorf("a KMS key requires %s encryption: %w", EncryptionKMS, ErrInvalidConfig)
+	}
+	return nil
+}
+
+// provisionBucket makes sure the bucket exists, creating and configuring it
+// if the provisioning mode allows. It reports whether the bucket existed.
+func (s *MinIOStorage) provisionBucket(ctx context.Context, s3Cfg S3Config) (bool, error) {
+	_, err := s.s3Client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(s3Cfg.Bucket),
+	})
+	if err == nil {
+		return true, nil
+	}
+	var notFound *types.NotFound
+	if !errors.As(err, &notFound) {
+		return false, fmt.Errorf("error checking bucket: %w", err)
+	}
+
+	switch s3Cfg.Provisioning {
+	case ProvisionFail:
+		return false, fmt.Errorf("%w: %s", ErrBucketNotFound, s3Cfg.Bucket)
+	case ProvisionWarn:
+		slog.Warn("Bucket does not exist, uploads will fail until it is created", "bucket", s3Cfg.Bucket)
+		return false, nil
+	}
+
+	slog.Info("Bucket does not exist. Creating...", "bucket", s3Cfg.Bucket)
+	input := &s3.CreateBucketInput{
+		Bucket: aws.String(s3Cfg.Bucket),
+	}
+	// AWS creates buckets in us-east-1 unless told otherwise
+	if s3Cfg.awsEndpoints() && s3Cfg.Region != "us-east-1" {
+		input.CreateBucketConfiguration = &types.CreateBucketConfiguration{
+			LocationConstraint: types.BucketLocationConstraint(s3Cfg.Region),
+		}
+	}
+	_, err = s.s3Client.CreateBucket(ctx, input, withoutAcceleration)
+	if err != nil {
+		return false, fmt.Errorf("error creating bucket: %w", err)
+	}
+
+	if err := s.configureBucket(ctx, s3Cfg.Bucket, s3Cfg.BucketSettings); err != nil {
+		return false, err
+	}
+	if s3Cfg.Accelerate {
+		// Requests through the accelerated endpoint fail until it is enabled
+		_, err := s.s3Client.PutBucketAccelerateConfiguration(ctx, &s3.PutBucketAccelerateConfigurationInput{
+			Bucket:                  aws.String(s3Cfg.Bucket),
+			AccelerateConfiguration: &types.AccelerateConfiguration{Status: types.BucketAccelerateStatusEnabled},
+		}, withoutAcceleration)
+		if err != nil {
+			return false, fmt.Errorf("error enabling transfer acceleration: %w", err)
+		}
+	}
+	slog.Info("Bucket created successfully",
+		"bucket", s3Cfg.Bucket,
+		"versioning", s3Cfg.BucketSettings.Versioning,
+		"encryption", s3Cfg.BucketSettings.Encryption,
+		"policy", s3Cfg.BucketSettings.Policy != "",
+		"accelerate", s3Cfg.Accelerate)
+	return false, nil
+}
+
+// withoutAcceleration sends a request to the regular endpoint, for
+// operations the accelerated endpoint doesn't support
+func withoutAcceleration(o *s3.Options) {
+	o.UseAccelerate = false
+}
+
+// configureBucket applies the settings to a newly created bucket
+func (s *MinIOStorage) configureBucket(ctx context.Context, bucket string, settings BucketSettings) error {
+	if settings.Versioning {
+		_, err := s.s3Client.PutBucketVersioning(ctx, &s3.PutBucketVersioningInput{
+			Bucket: aws.String(bucket),
+			VersioningConfiguration: &types.VersioningConfiguration{
+				Status: types.BucketVersioningStatusEnabled,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("error enabling bucket versioning: %w", err)
+		}
+	}
+
+	if settings.Encryption != "" {
+		byDefault := &types.ServerSideEncryptionByDefault{
+			SSEAlgorithm: types.ServerSideEncryption(settings.Encryption),
+		}
+		if settings.KMSKeyID != "" {
+			byDefault.KMSMasterKeyID = aws.String(settings.KMSKeyID)
+		}
+		_, err := s.s3Client.PutBucketEncryption(ctx, &s3.PutBucketEncryptionInput{
+			Bucket: aws.String(bucket),
+			ServerSideEncryptionConfiguration: &types.ServerSideEncryptionConfiguration{
+				Rules: []types.ServerSideEncryptionRule{{ApplyServerSideEncryptionByDefault: byDefault}},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("error setting bucket encryption: %w", err)
+		}
+	}
+
+	if settings.Policy != "" {
+		_, err := s.s3Client.PutBucketPolicy(ctx, &s3.PutBucketPolicyInput{
+			Bucket: aws.String(bucket),
+			Policy: aws.String(settings.Policy),
+		})
+		if err != nil {
+			return fmt.Errorf("error setting bucket policy: %w", err)
+		}
+	}
+	return nil
+}
+
+// newExistingContainerService creates an Azure service that never creates
+// the container, unlike azurestore.NewAzureService. A missing container
+// fails or is logged depending on the provisioning mode.
+func newExistingContainerService(ctx context.Context, cfg azurestore.AzConfig, mode Provisioning) (azurestore.AzService, error) {
+	client, err := newContainerClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := client.GetProperties(ctx, nil); err != nil {
+		if !bloberror.HasCode(err, bloberror.ContainerNotFound) {
+			return nil, fmt.Errorf("error checking container: %w", err)
+		}
+		if mode == ProvisionFail {
+			return nil, fmt.Errorf("%w: %s", ErrBucketNotFound, cfg.ContainerName)
+		}
+		slog.Warn("Container does not exist, uploads will fail until it is created", "container", cfg.ContainerName)
+	}
+
+	return existingContainerService{client: client, tier: parseAccessTier(cfg.BlobAccessTier)}, nil
+}
+
+// parseAccessTier returns the tier azurestore selects for a configured
+// access tier, or nil for the account default
+func parseAccessTier(name string) *blob.AccessTier {
+	switch name {
+	case "archive", "cool", "hot":
+		tier := blob.AccessTier(strings.ToUpper(name[:1]) + name[1:])
+		return &tier
+	default:
+		return nil
+	}
+}
+
+// newContainerClient creates a client for the container with the same
+// settings as azurestore.NewAzureService
+func newContainerClient(cfg azurestore.AzConfig) (*container.Client, error) {
+	credential, err := azblob.NewSharedKeyCredential(cfg.AccountName, cfg.AccountKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid azure account key: %w", err)
+	}
+	return container.NewClientWithSharedKeyCredential(fmt.Sprintf("%s/%s", cfg.Endpoint, cfg.ContainerName), credential, &container.ClientOptions{
+		ClientOptions: azcore.ClientOptions{
+			Retry: policy.RetryOptions{MaxRetries: 5, RetryDelay: 100, MaxRetryDelay: 5000},
+		},
+	})
+}
+
+// existingContainerService hands out blobs in a container it does not
+// manage, the same way the azurestore service does
+type existingContainerService struct {
+	client *container.Client
+	tier   *blob.AccessTier
+}
+
+// NewBlob returns the info or data blob for the name
+func (s existingContainerService) NewBlob(ctx context.Context, name string) (azurestore.AzBlob, error) {
+	blobClient := s.client.NewBlockBlobClient(name)
+	if strings.HasSuffix(name, azurestore.InfoBlobSuffix) {
+		return &azurestore.InfoBlob{BlobClient: blobClient}, nil
+	}
+	return &azurestore.BlockBlob{
+		BlobClient:     blobClient,
+		Indexes:        []int{},
+		BlobAccessTier: s.tier,
+	}, nil
+}
@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// fakeBucketServer answers S3 requests for a bucket that does not exist and
+// records every other request
+func fakeBucketServer(t *testing.T) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery)
+		mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), requests...)
+	}
+}
+
+func TestParseProvisioning(t *testing.T) {
+	for value, want := range map[string]Provisioning{"": ProvisionCreate, "Fail": ProvisionFail, " warn ": ProvisionWarn} {
+		if mode, err := ParseProvisioning(value); err != nil || mode != want {
+			t.Errorf("ParseProvisioning(%q) = %q, %v", value, mode, err)
+		}
+	}
+	if _, err := ParseProvisioning("ignore"); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expected ErrInvalidConfig, got %v", err)
+	}
+}
+
+func TestBucketProvisioning(t *testing.T) {
+	server, requests := fakeBucketServer(t)
+	if _, err := NewMinIO(context.Background(), WithEndpoint(server.URL), WithProvisioning(ProvisionFail)); !errors.Is(err, ErrBucketNotFound) {
+		t.Fatalf("expected ErrBucketNotFound, got %v", err)
+	}
+	if _, err := NewMinIO(context.Background(), WithEndpoint(server.URL), WithProvisioning(ProvisionWarn)); err != nil {
+		t.Fatal(err)
+	}
+	if got := requests(); len(got) != 0 {
+		t.Fatalf("expected no bucket to be created, got %v", got)
+	}
+
+	_, err := NewMinIO(context.Background(), WithEndpoint(server.URL), WithBucketSettings(BucketSettings{
+		Policy:     `{"Version": "2012-10-17", "Statement": []}`,
+		Versioning: true,
+		Encryption: EncryptionKMS,
+		KMSKeyID:   "alias/uploads",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"PUT /uploads?", "PUT /uploads?versioning=", "PUT /uploads?encryption=", "PUT /uploads?policy="}
+	got := requests()
+	if len(got) != len(want) {
+		t.Fatalf("requests = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("requests = %v, want %v", got, want)
+		}
+	}
+}
+
+// hostRecorder answers S3 requests for a bucket that does not exist and
+// records the host and query of every request
+type hostRecorder struct {
+	mu       sync.Mutex
+	requests []string
+	header   http.Header
+}
+
+func (h *hostRecorder) RoundTrip(r *http.Request) (*http.Response, error) {
+	h.mu.Lock()
+	h.requests = append(h.requests, r.Method+" "+r.URL.Host+"?"+r.URL.RawQuery)
+	h.header = r.Header
+	h.mu.Unlock()
+	status := http.StatusOK
+	if r.Method == http.MethodHead {
+		status = http.StatusNotFound
+	}
+	return &http.Response{StatusCode: status, Header: http.Header{}, Body: http.NoBody, Request: r}, nil
+}
+
+func TestAWSEndpoints(t *testing.T) {
+	ctx := context.Background()
+	if _, err := NewMinIO(ctx, WithTransferAcceleration()); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expected ErrInvalidConfig for a MinIO endpoint, got %v", err)
+	}
+	if _, err := NewMinIO(ctx, WithEndpoint("s3.amazonaws.com"), WithBucket("my.uploads"), WithTransferAcceleration()); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expected ErrInvalidConfig for a bucket name with dots, got %v", err)
+	}
+
+	// A CA bundle can't be added to a client without an *http.Transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	recorder := &hostRecorder{}
+	_, err := NewMinIO(ctx,
+		WithEndpoint("s3.amazonaws.com"),
+		WithRegion("eu-west-1"),
+		WithTransferAcceleration(),
+		WithDualStack(),
+		WithHTTPClient(&http.Client{Transport: recorder}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"HEAD uploads.s3-accelerate.dualstack.amazonaws.com?",
+		"PUT uploads.s3.dualstack.eu-west-1.amazonaws.com?",
+		"PUT uploads.s3.dualstack.eu-west-1.amazonaws.com?accelerate=",
+	}
+	if len(recorder.requests) != len(want) {
+		t.Fatalf("requests = %v, want %v", recorder.requests, want)
+	}
+	for i := range want {
+		if recorder.requests[i] != want[i] {
+			t.Fatalf("requests = %v, want %v", recorder.requests, want)
+		}
+	}
+}
+
+func TestBucketSettingsValidate(t *testing.T) {
+	invalid := []BucketSettings{
+		{Policy: "{"},
+		{Encryption: "aws:kms:dsse"},
+		{Encryption: EncryptionAES256, KMSKeyID: "alias/uploads"},
+	}
+	for _, settings := range invalid {
+		if err := settings.validate(); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("validate(%+v) = %v, want ErrInvalidConfig", settings, err)
+		}
+	}
+}
+
+func TestS3Storage(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AWS_CA_BUNDLE", "")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDCHAIN")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REGION", "")
+
+	recorder := &hostRecorder{}
+	client := WithHTTPClient(&http.Client{Transport: recorder})
+	if _, err := NewS3(ctx, client); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expected ErrInvalidConfig without a region, got %v", err)
+	}
+
+	t.Setenv("AWS_REGION", "eu-west-1")
+	s, err := NewS3(ctx, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.GetProvider() != S3 || s.Regions()[0] != "eu-west-1" {
+		t.Fatalf("provider = %s, regions = %v", s.GetProvider(), s.Regions())
+	}
+	want := []string{
+		"HEAD uploads.s3.eu-west-1.amazonaws.com?",
+		"PUT uploads.s3.eu-west-1.amazonaws.com?",
+	}
+	if len(recorder.requests) != len(want) || recorder.requests[0] != want[0] || recorder.requests[1] != want[1] {
+		t.Fatalf("requests = %v, want %v", recorder.requests, want)
+	}
+	if auth := recorder.header.Get("Authorization"); !strings.Contains(auth, "Credential=AKIDCHAIN/") {
+		t.Fatalf("expected credentials from the environment, got %q", auth)
+	}
+}
+
+func TestS3CompatStorage(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AWS_CA_BUNDLE", "")
+	if _, err := NewS3Compat(ctx); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expected ErrInvalidConfig without an endpoint, got %v", err)
+	}
+
+	recorder := &hostRecorder{}
+	s, err := NewS3Compat(ctx,
+		WithEndpoint("s3.us-west-004.backblazeb2.com"),
+		WithRegion("us-west-004"),
+		WithCredentials("keyID", "applicationKey"),
+		WithHTTPClient(&http.Client{Transport: recorder}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.GetProvider() != S3Compat {
+		t.Fatalf("provider = %s", s.GetProvider())
+	}
+	if auth := recorder.header.Get("Authorization"); !strings.Contains(auth, "/us-west-004/s3/") {
+		t.Fatalf("expected a signature for the region, got %q", auth)
+	}
+
+	// Uploaded parts carry no checksums the service may not support
+	_, err = s.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String("uploads"),
+		Key:    aws.String("object"),
+		Body:   strings.NewReader("data"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name := range recorder.header {
+		if strings.HasPrefix(strings.ToLower(name), "x-amz-checksum-") || strings.EqualFold(name, "x-amz-sdk-checksum-algorithm") {
+			t.Fatalf("unexpected checksum header %s", name)
+		}
+	}
+
+	recorder = &hostRecorder{}
+	if _, err := NewS3Compat(ctx,
+		WithEndpoint("https://s3.wasabisys.com"),
+		WithPathStyle(false),
+		WithCredentials("accessKey", "secretKey"),
+		WithHTTPClient(&http.Client{Transport: recorder})); err != nil {
+		t.Fatal(err)
+	}
+	if want := "HEAD uploads.s3.wasabisys.com?"; recorder.requests[0] != want {
+		t.Fatalf("requests = %v, want virtual-hosted %s", recorder.requests, want)
+	}
+}
+
+func TestUniformParts(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("STORAGE_TYPE", "r2")
+	t.Setenv("R2_ACCOUNT_ID", "")
+	if _, err := NewFactory().CreateFromEnv(ctx); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expected ErrInvalidConfig without an account ID, got %v", err)
+	}
+
+	t.Setenv("AWS_CA_BUNDLE", "")
+	if _, err := NewR2(ctx, ""); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expected ErrInvalidConfig without an account ID, got %v", err)
+	}
+	recorder := &hostRecorder{}
+	s, err := NewR2(ctx, "account",
+		WithCredentials("accessKey", "secretKey"),
+		WithHTTPClient(&http.Client{Transport: recorder}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "HEAD account.r2.cloudflarestorage.com?"; recorder.requests[0] != want {
+		t.Fatalf("requests = %v, want %s", recorder.requests, want)
+	}
+	hints := s.ChunkHints()
+	if hints.MinChunkSize != DefaultR2PartSize || hints.PreferredChunkSize != DefaultR2PartSize || hints.MaxUploadSize != DefaultR2PartSize*10000 {
+		t.Fatalf("unexpected chunk hints %+v", hints)
+	}
+
+	if _, err := NewS3Compat(ctx, WithEndpoint("https://account.r2.cloudflarestorage.com"), WithPartSize(1<<20)); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expected ErrInvalidConfig for a part size below the minimum, got %v", err)
+	}
+}
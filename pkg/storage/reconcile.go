@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+)
+
+// ReconcileMode controls what startup reconciliation does with uploads
+// whose stored data is inconsistent
+type ReconcileMode string
+
+const (
+	// ReconcileRepair repairs inconsistent uploads, or expires them if they
+	// can't be repaired. Repairs race with requests served by other
+	// instances, so it is only safe for a single instance.
+	ReconcileRepair ReconcileMode = "repair"
+
+	// ReconcileReport only logs inconsistent uploads
+	ReconcileReport ReconcileMode = "report"
+
+	// ReconcileOff skips reconciliation
+	ReconcileOff ReconcileMode = "off"
+)
+
+// ParseReconcileMode parses a reconcile mode. Empty selects ReconcileReport.
+func ParseReconcileMode(value string) (ReconcileMode, error) {
+	switch mode := ReconcileMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "":
+		return ReconcileReport, nil
+	case ReconcileRepair, ReconcileReport, ReconcileOff:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid reconcile mode %q, expected repair, report or off: %w", value, ErrInvalidConfig)
+	}
+}
+
+// RepairAction is what reconciliation did about an inconsistent upload
+type RepairAction string
+
+const (
+	// RepairNone means the upload was only reported
+	RepairNone RepairAction = "none"
+
+	// RepairTruncated means data the offset must not include was discarded
+	RepairTruncated RepairAction = "truncated"
+
+	// RepairCommitted means a complete upload that was never finished was
+	// finished. Its completion hooks have not run yet.
+	RepairCommitted RepairAction = "committed"
+
+	// RepairExpired means the upload could not be repaired and was deleted,
+	// so clients start over instead of failing to resume
+	RepairExpired RepairAction = "expired"
+)
+
+// UploadRepair describes an inconsistent upload found by reconciliation
+type UploadRepair struct {
+	UploadID string
+	Problem  string
+	Action   RepairAction
+	Offset   int64 // Offset after the repair
+
+	// Upload is the upload as it was stored before the repair, so expired
+	// uploads can still be told apart by their metadata
+	Upload tusd.FileInfo
+}
+
+// LockFunc locks an upload against concurrent requests until unlock is
+// called
+type LockFunc func(ctx context.Context, id string) (unlock func(), err error)
+
+// UploadReconciler is implemented by storage backends that check the stored
+// data of unfinished uploads after an unclean shutdown, so clients can
+// resume them where the server says they stand
+type UploadReconciler interface {
+	// ReconcileUploads checks every unfinished upload, holding its lock
+	// while it does, and returns the inconsistent ones. It does nothing if
+	// reconciliation is off.
+	ReconcileUploads(ctx context.Context, lock LockFunc) ([]UploadRepair, error)
+}
+
+// UploadRepairer is implemented by reconcilers that report whether they
+// change stored uploads rather than only reporting them. The server
+// finishes such a reconciliation before it accepts requests.
+type UploadRepairer interface {
+	RepairsUploads() bool
+}
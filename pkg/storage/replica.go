@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Replica is a bucket in another region that objects are replicated to,
+// e.g. by S3 cross-region replication
+type Replica struct {
+	Region   string `json:"region"`
+	Bucket   string `json:"bucket"`
+	Endpoint string `json:"endpoint"` // Uses the primary endpoint when empty
+}
+
+// PresignOptions configures a presigned download URL
+type PresignOptions struct {
+	// Region selects the replica to download from, empty for the primary
+	Region string
+
+	// Filename is suggested to the browser in the Content-Disposition header
+	Filename string
+
+	TTL time.Duration
+}
+
+// Presigner is implemented by storage backends that can hand out presigned
+// download URLs, optionally from replicas closer to the client
+type Presigner interface {
+	// Regions returns the region of the primary bucket followed by the
+	// regions of its replicas
+	Regions() []string
+
+	// PresignDownload returns a URL downloading the object with the given
+	// key, and the region it is served from. Objects not yet replicated to
+	// the requested region are served from the primary.
+	PresignDownload(ctx context.Context, key string, opts PresignOptions) (url, region string, err error)
+}
+
+// ParseReplicas parses a comma-separated list of replicas in the form
+// region=bucket or region=bucket@endpoint
+func ParseReplicas(spec string) ([]Replica, error) {
+	var replicas []Replica
+	seen := make(map[string]bool)
+
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		region, target, ok := strings.Cut(item, "=")
+		bucket, endpoint, _ := strings.Cut(target, "@")
+		region, bucket = strings.TrimSpace(region), strings.TrimSpace(bucket)
+		if !ok || region == "" || bucket == "" {
+			return nil, fmt.Errorf("invalid replica %q, expected region=bucket[@endpoint]: %w", item, ErrInvalidConfig)
+		}
+		if seen[region] {
+			return nil, fmt.Errorf("duplicate replica region %q: %w", region, ErrInvalidConfig)
+		}
+		seen[region] = true
+
+		replicas = append(replicas, Replica{
+			Region:   region,
+			Bucket:   bucket,
+			Endpoint: strings.TrimSpace(endpoint),
+		})
+	}
+	return replicas, nil
+}
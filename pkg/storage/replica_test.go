@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseReplicas(t *testing.T) {
+	replicas, err := ParseReplicas(" eu-west-1=uploads-eu, ap-southeast-1=uploads-ap@https://s3.ap-southeast-1.amazonaws.com ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Replica{
+		{Region: "eu-west-1", Bucket: "uploads-eu"},
+		{Region: "ap-southeast-1", Bucket: "uploads-ap", Endpoint: "https://s3.ap-southeast-1.amazonaws.com"},
+	}
+	if !reflect.DeepEqual(replicas, expected) {
+		t.Fatalf("ParseReplicas = %+v, want %+v", replicas, expected)
+	}
+
+	if replicas, err := ParseReplicas(""); err != nil || len(replicas) != 0 {
+		t.Fatalf("ParseReplicas(\"\") = %+v, %v", replicas, err)
+	}
+
+	for _, spec := range []string{"eu-west-1", "=uploads", "eu-west-1=", "eu-west-1=a,eu-west-1=b"} {
+		if _, err := ParseReplicas(spec); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("ParseReplicas(%q) error = %v, want ErrInvalidConfig", spec, err)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// TenantPlaceholder is replaced by the tenant in bucket and container
+// templates, e.g. "uploads-{tenant}"
+const TenantPlaceholder = "{tenant}"
+
+// bucketNamePattern accepts names that are valid both as S3 buckets and as
+// Azure containers
+var bucketNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,61}[a-z0-9]$`)
+
+// ValidateBucketTemplate checks that a template names a different valid
+// bucket or container for each tenant
+func ValidateBucketTemplate(template string) error {
+	if strings.Count(template, TenantPlaceholder) != 1 {
+		return fmt.Errorf("bucket template %q must contain %s once: %w", template, TenantPlaceholder, ErrInvalidConfig)
+	}
+	// Names of tenants too long for the template are refused when routed
+	if name := BucketName(template, "tenant"); !bucketNamePattern.MatchString(name) {
+		return fmt.Errorf("bucket template %q gives invalid names such as %q: %w", template, name, ErrInvalidConfig)
+	}
+	return nil
+}
+
+// BucketName returns the bucket or container of a tenant. Tenants are
+// lowercased and underscores become hyphens, as bucket names allow neither,
+// so tenants differing only in those share a bucket, still separated by
+// their key prefixes.
+func BucketName(template, tenant string) string {
+	tenant = strings.ReplaceAll(strings.ToLower(tenant), "_", "-")
+	return strings.Replace(template, TenantPlaceholder, tenant, 1)
+}
+
+// BucketRouted is implemented by backends that can keep the uploads of each
+// tenant in a bucket or container of its own
+type BucketRouted interface {
+	// RoutesBuckets reports whether a bucket or container template is set
+	RoutesBuckets() bool
+}
+
+// bucketTemplatePattern matches the names a template gives, to find the
+// buckets or containers of all tenants
+func bucketTemplatePattern(template string) *regexp.Regexp {
+	prefix, suffix, _ := strings.Cut(template, TenantPlaceholder)
+	return regexp.MustCompile("^" + regexp.QuoteMeta(prefix) + "[a-z0-9-]{1,64}" + regexp.QuoteMeta(suffix) + "$")
+}
+
+// bucketRouter routes object keys to the bucket or container of the tenant
+// owning them, opening each one on first use. Keys without a tenant, such
+// as content keys, stay in the fallback.
+type bucketRouter[T any] struct {
+	template string
+	fallback T
+	open     func(ctx context.Context, name string) (T, error)
+
+	// opening makes concurrent requests for a bucket wait for one open,
+	// without holding up the requests of other buckets
+	opening singleflight.Group
+
+	mu      sync.Mutex
+	buckets map[string]T
+}
+
+// newBucketRouter creates a router naming buckets with the template. open
+// is called once per bucket and may create it.
+func newBucketRouter[T any](template string, fallback T, open func(ctx context.Context, name string) (T, error)) *bucketRouter[T] {
+	return &bucketRouter[T]{
+		template: template,
+		fallback: fallback,
+		open:     open,
+		buckets:  make(map[string]T),
+	}
+}
+
+// route returns the bucket of the tenant owning the key, opening it if it
+// wasn't yet. Failed opens are retried by the next request.
+func (r *bucketRouter[T]) route(ctx context.Context, key string) (T, error) {
+	tenant, ok := TenantFromKey(key)
+	if !ok {
+		return r.fallback, nil
+	}
+	name := BucketName(r.template, tenant)
+
+	r.mu.Lock()
+	bucket, ok := r.buckets[name]
+	r.mu.Unlock()
+	if ok {
+		return bucket, nil
+	}
+	if !bucketNamePattern.MatchString(name) {
+		var zero T
+		return zero, fmt.Errorf("tenant %s has the invalid bucket name %q: %w", tenant, name, ErrInvalidConfig)
+	}
+
+	opened, err, _ := r.opening.Do(name, func() (any, error) {
+		r.mu.Lock()
+		bucket, ok := r.buckets[name]
+		r.mu.Unlock()
+		if ok {
+			return bucket, nil
+		}
+
+		bucket, err := r.open(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		r.mu.Lock()
+		r.buckets[name] = bucket
+		r.mu.Unlock()
+		return bucket, nil
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return opened.(T), nil
+}
@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/s3store"
+)
+
+// copySourceS3API records the source of part copies
+type copySourceS3API struct {
+	s3store.S3API
+	sources *[]string
+}
+
+func (api copySourceS3API) UploadPartCopy(ctx context.Context, input *s3.UploadPartCopyInput, opts ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error) {
+	*api.sources = append(*api.sources, aws.ToString(input.Bucket)+" <- "+aws.ToString(input.CopySource))
+	return &s3.UploadPartCopyOutput{}, nil
+}
+
+func TestBucketTemplate(t *testing.T) {
+	if err := ValidateBucketTemplate("uploads-{tenant}"); err != nil {
+		t.Fatal(err)
+	}
+	for _, template := range []string{"uploads", "{tenant}-{tenant}", "Uploads-{tenant}", "uploads_{tenant}"} {
+		if err := ValidateBucketTemplate(template); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("expected ErrInvalidConfig for %q, got %v", template, err)
+		}
+	}
+	if name := BucketName("uploads-{tenant}", "Acme_EU"); name != "uploads-acme-eu" {
+		t.Fatalf("unexpected bucket name %q", name)
+	}
+	if !bucketTemplatePattern("uploads-{tenant}").MatchString("uploads-acme-eu") || bucketTemplatePattern("uploads-{tenant}").MatchString("archive-acme") {
+		t.Fatal("unexpected template pattern")
+	}
+}
+
+// fakeMultipartServer answers S3 requests for buckets that don't exist yet,
+// starts multipart uploads and records every request but HEAD ones
+func fakeMultipartServer(t *testing.T) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery)
+		mu.Unlock()
+		if r.URL.Query().Has("uploads") {
+			w.Write([]byte(`<InitiateMultipartUploadResult><UploadId>multipart</UploadId></InitiateMultipartUploadResult>`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), requests...)
+	}
+}
+
+func TestBucketRouting(t *testing.T) {
+	ctx := context.Background()
+	server, requests := fakeMultipartServer(t)
+	if _, err := NewMinIO(ctx, WithEndpoint(server.URL), WithBucketTemplate("uploads-{tenant}"),
+		WithReplicas(Replica{Region: "eu-west-1", Bucket: "uploads-eu"})); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expected ErrInvalidConfig with replicas, got %v", err)
+	}
+
+	store, err := NewMinIO(ctx, WithEndpoint(server.URL), WithBucketTemplate("uploads-{tenant}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !store.TenantScoped() {
+		t.Fatal("expected routed storage to be tenant scoped")
+	}
+
+	// Each tenant's bucket is created by its first upload
+	for _, id := range []string{"Acme_EU~1", "Acme_EU~2", "globex~3"} {
+		if _, err := store.GetStoreComposer().Core.NewUpload(ctx, tusd.FileInfo{ID: id, Size: 5}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var created, uploads []string
+	for _, request := range requests() {
+		switch {
+		case strings.HasSuffix(request, "?"):
+			created = append(created, request)
+		case strings.HasSuffix(request, "?uploads="):
+			uploads = append(uploads, request)
+		}
+	}
+	if strings.Join(created, ",") != "PUT /uploads?,PUT /uploads-acme-eu?,PUT /uploads-globex?" {
+		t.Fatalf("expected each bucket to be created once, got %v", created)
+	}
+	if len(uploads) != 3 || !strings.HasPrefix(uploads[0], "POST /uploads-acme-eu/Acme_EU~1") || !strings.HasPrefix(uploads[2], "POST /uploads-globex/globex~3") {
+		t.Fatalf("expected uploads in the tenant buckets, got %v", uploads)
+	}
+	if bucket := store.bucketFor(ContentKey(strings.Repeat("0", 64))); bucket != "uploads" {
+		t.Fatalf("expected content in the configured bucket, got %s", bucket)
+	}
+
+	// Concatenation copies partial uploads from their tenant's bucket
+	var sources []string
+	api := bucketRoutingS3API{
+		S3API:    copySourceS3API{sources: &sources},
+		buckets:  newBucketRouter("uploads-{tenant}", "uploads", func(ctx context.Context, name string) (string, error) { return name, nil }),
+		fallback: "uploads",
+	}
+	if _, err := api.UploadPartCopy(ctx, &s3.UploadPartCopyInput{Key: aws.String("acme~final"), CopySource: aws.String("uploads/acme~partial")}); err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 1 || sources[0] != "uploads-acme <- uploads-acme/acme~partial" {
+		t.Fatalf("unexpected part copy %v", sources)
+	}
+	if _, err := api.UploadPartCopy(ctx, &s3.UploadPartCopyInput{Key: aws.String(strings.Repeat("a", 60) + "~final")}); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expected ErrInvalidConfig for a tenant too long for a bucket name, got %v", err)
+	}
+}
+
+func TestBucketRouterOpensConcurrently(t *testing.T) {
+	ctx := context.Background()
+	release := make(chan struct{})
+	var mu sync.Mutex
+	opens := make(map[string]int)
+	router := newBucketRouter("uploads-{tenant}", "uploads", func(ctx context.Context, name string) (string, error) {
+		mu.Lock()
+		opens[name]++
+		mu.Unlock()
+		if name == "uploads-slow" {
+			<-release
+		}
+		return name, nil
+	})
+
+	// Requests for a bucket being opened wait for the same open
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if bucket, err := router.route(ctx, "slow~upload"); err != nil || bucket != "uploads-slow" {
+				t.Errorf("unexpected route %q, %v", bucket, err)
+			}
+		}()
+	}
+
+	// Other buckets don't wait for it
+	routed := make(chan struct{})
+	go func() {
+		defer close(routed)
+		router.route(ctx, "fast~upload")
+	}()
+	select {
+	case <-routed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected another tenant's bucket to open while one is being opened")
+	}
+
+	close(release)
+	wg.Wait()
+	if opens["uploads-slow"] != 1 || opens["uploads-fast"] != 1 {
+		t.Fatalf("expected each bucket to be opened once, got %v", opens)
+	}
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+)
+
+// S3Storage implements Storage interface for AWS S3. Unlike MinIOStorage,
+// requests are signed with credentials from the default AWS credential
+// chain, so IAM roles for instances, tasks and service accounts (IRSA) work
+// without static keys, and are sent to the regional endpoint of the bucket
+// in virtual-hosted style.
+type S3Storage struct {
+	MinIOStorage
+}
+
+// NewS3Storage creates a new AWS S3 storage instance
+func NewS3Storage() *S3Storage {
+	return &S3Storage{MinIOStorage: *NewMinIOStorage()}
+}
+
+// NewS3 creates and initializes an AWS S3 storage from options. Without
+// WithRegion, the region is taken from the AWS environment or shared config.
+func NewS3(ctx context.Context, opts ...MinIOOption) (*S3Storage, error) {
+	s3Cfg := defaultAWSConfig()
+	for _, opt := range opts {
+		opt(&s3Cfg)
+	}
+
+	s := NewS3Storage()
+	if err := s.setup(ctx, s3Cfg); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// defaultAWSConfig returns the configuration used for AWS S3 when no
+// overrides are given. Without an endpoint or keys, the SDK resolves both.
+func defaultAWSConfig() S3Config {
+	return S3Config{
+		Bucket:       "uploads",
+		UseSSL:       true,
+		PathStyle:    false,
+		Provisioning: ProvisionCreate,
+	}
+}
+
+// Initialize sets up the S3 client and configures the storage
+func (s *S3Storage) Initialize(ctx context.Context, cfg *Config) error {
+	s3Cfg := defaultAWSConfig()
+	s3Cfg.applyProperties(cfg.Properties)
+
+	return s.setup(ctx, s3Cfg)
+}
+
+// GetProvider returns the storage provider type
+func (s *S3Storage) GetProvider() Provider {
+	return S3
+}
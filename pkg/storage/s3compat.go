@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// S3CompatStorage implements Storage interface for S3-compatible services
+// other than MinIO and AWS, such as Backblaze B2, Wasabi and OVH Object
+// Storage. Nothing is assumed about the service: the endpoint is required,
+// requests are signed for the configured region, and checksums are only
+// sent where the S3 API requires them unless compatibility is turned off.
+type S3CompatStorage struct {
+	MinIOStorage
+}
+
+// NewS3CompatStorage creates a new S3-compatible storage instance
+func NewS3CompatStorage() *S3CompatStorage {
+	return &S3CompatStorage{MinIOStorage: *NewMinIOStorage()}
+}
+
+// NewS3Compat creates and initializes an S3-compatible storage from options.
+// WithEndpoint is required.
+func NewS3Compat(ctx context.Context, opts ...MinIOOption) (*S3CompatStorage, error) {
+	s3Cfg := defaultS3CompatConfig()
+	for _, opt := range opts {
+		opt(&s3Cfg)
+	}
+
+	s := NewS3CompatStorage()
+	if err := s.setupCompat(ctx, s3Cfg); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// defaultS3CompatConfig returns the configuration used for S3-compatible
+// services when no overrides are given. Most of them accept path-style
+// URLs over HTTPS and signatures for us-east-1.
+func defaultS3CompatConfig() S3Config {
+	return S3Config{
+		Bucket:         "uploads",
+		Region:         "us-east-1",
+		UseSSL:         true,
+		PathStyle:      true,
+		DisableSSL:     false,
+		ChecksumCompat: true,
+		Provisioning:   ProvisionCreate,
+	}
+}
+
+// Initialize sets up the S3 client and configures the storage
+func (s *S3CompatStorage) Initialize(ctx context.Context, cfg *Config) error {
+	s3Cfg := defaultS3CompatConfig()
+	s3Cfg.applyProperties(cfg.Properties)
+
+	return s.setupCompat(ctx, s3Cfg)
+}
+
+// setupCompat checks the endpoint is set, since the SDK would otherwise
+// resolve AWS endpoints, and sets up the storage
+func (s *S3CompatStorage) setupCompat(ctx context.Context, s3Cfg S3Config) error {
+	if s3Cfg.Endpoint == "" {
+		return fmt.Errorf("endpoint is required: %w", ErrInvalidConfig)
+	}
+	return s.setup(ctx, s3Cfg)
+}
+
+// NewR2 creates and initializes Cloudflare R2 storage of the account from
+// options. Like STORAGE_TYPE=r2, requests are signed for the auto region and
+// parts have the same size; WithEndpoint selects a jurisdiction endpoint.
+func NewR2(ctx context.Context, accountID string, opts ...MinIOOption) (*S3CompatStorage, error) {
+	if accountID == "" {
+		return nil, fmt.Errorf("R2 account ID is required: %w", ErrInvalidConfig)
+	}
+	s3Cfg := defaultR2Config(accountID)
+	for _, opt := range opts {
+		opt(&s3Cfg)
+	}
+
+	s := NewS3CompatStorage()
+	if err := s.setupCompat(ctx, s3Cfg); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// R2Endpoint returns the endpoint of the R2 account, in the jurisdiction
+// if one is given
+func R2Endpoint(accountID, jurisdiction string) string {
+	if jurisdiction != "" {
+		return "https://" + accountID + "." + jurisdiction + ".r2.cloudflarestorage.com"
+	}
+	return "https://" + accountID + ".r2.cloudflarestorage.com"
+}
+
+// defaultR2Config returns the configuration used for Cloudflare R2 when no
+// overrides are given
+func defaultR2Config(accountID string) S3Config {
+	s3Cfg := defaultS3CompatConfig()
+	s3Cfg.Endpoint = R2Endpoint(accountID, "")
+	s3Cfg.Region = "auto"
+	s3Cfg.UniformParts = true
+	s3Cfg.PartSize = DefaultR2PartSize
+	return s3Cfg
+}
+
+// GetProvider returns the storage provider type
+func (s *S3CompatStorage) GetProvider() Provider {
+	return S3Compat
+}
@@ -23,6 +23,13 @@ const (
 	// MinIO represents S3-compatible storage (MinIO, AWS S3, etc.)
 	MinIO Provider = "minio"
 
+	// S3 represents AWS S3 with credentials from the default AWS chain
+	S3 Provider = "s3"
+
+	// S3Compat represents other S3-compatible services, such as Backblaze
+	// B2, Wasabi and OVH Object Storage
+	S3Compat Provider = "s3compat"
+
 	// Azure represents Azure Blob Storage
 	Azure Provider = "azure"
 
@@ -0,0 +1,256 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/tus/tusd/v2/pkg/s3store"
+)
+
+// DefaultSTSDuration is the lifetime of delegated credentials unless configured
+const DefaultSTSDuration = 15 * time.Minute
+
+// Errors returned when a request can't be mapped to tenant credentials
+var (
+	ErrNoTenant       = errors.New("object key does not belong to a tenant")
+	ErrTenantMismatch = errors.New("object key belongs to another tenant")
+)
+
+// tenantPolicyActions are the S3 actions tusd needs on a tenant's objects
+var tenantPolicyActions = []string{
+	"s3:GetObject",
+	"s3:PutObject",
+	"s3:DeleteObject",
+	"s3:AbortMultipartUpload",
+	"s3:ListMultipartUploadParts",
+}
+
+// maxRoleSessionName is the longest role session name STS accepts
+const maxRoleSessionName = 64
+
+// roleSessionName returns the name of the tenant's STS sessions. Names of
+// long tenants are cut and end with a hash of the tenant, so they stay
+// unique and fit the STS limit.
+func roleSessionName(tenant string) string {
+	name := "tenant-" + tenant
+	if len(name) <= maxRoleSessionName {
+		return name
+	}
+	sum := sha256.Sum256([]byte(tenant))
+	suffix := "-" + hex.EncodeToString(sum[:8])
+	return name[:maxRoleSessionName-len(suffix)] + suffix
+}
+
+// tenantPolicy returns an IAM session policy limiting access to the tenant's
+// objects in the bucket
+func tenantPolicy(bucket, tenant string) (string, error) {
+	policy := map[string]any{
+		"Version": "2012-10-17",
+		"Statement": []map[string]any{{
+			"Effect":   "Allow",
+			"Action":   tenantPolicyActions,
+			"Resource": fmt.Sprintf("arn:aws:s3:::%s/%s%s*", bucket, tenant, TenantSeparator),
+		}},
+	}
+
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// newSTSClientFactory returns a function creating S3 clients that assume the
+// role with a session policy scoped to a single tenant in its bucket
+func newSTSClientFactory(awsCfg aws.Config, base *s3.Client, bucketFor func(tenant string) string, roleARN string, duration time.Duration) func(tenant string) (s3store.S3API, error) {
+	stsClient := sts.NewFromConfig(awsCfg)
+
+	return func(tenant string) (s3store.S3API, error) {
+		policy, err := tenantPolicy(bucketFor(tenant), tenant)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build session policy: %w", err)
+		}
+
+		provider := stscreds.NewAssumeRoleProvider(stsClient, roleARN, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = roleSessionName(tenant)
+			o.Policy = aws.String(policy)
+			o.Duration = duration
+		})
+
+		options := base.Options()
+		options.Credentials = aws.NewCredentialsCache(provider)
+		return s3.New(options), nil
+	}
+}
+
+// delegatingS3API sends each request with credentials scoped to the tenant
+// owning the object key. When the caller's tenant is known it must match the
+// key, so a bug in one tenant's path can never reach another tenant's objects.
+type delegatingS3API struct {
+	newClient func(tenant string) (s3store.S3API, error)
+
+	mu      sync.Mutex
+	clients map[string]s3store.S3API
+}
+
+// newDelegatingS3API creates a delegating API using newClient to create the
+// per-tenant clients
+func newDelegatingS3API(newClient func(tenant string) (s3store.S3API, error)) *delegatingS3API {
+	return &delegatingS3API{
+		newClient: newClient,
+		clients:   make(map[string]s3store.S3API),
+	}
+}
+
+// clientFor returns the client for the tenant owning the keys
+func (api *delegatingS3API) clientFor(ctx context.Context, keys ...*string) (s3store.S3API, error) {
+	var tenant string
+	for _, key := range keys {
+		keyTenant, ok := TenantFromKey(aws.ToString(key))
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrNoTenant, aws.ToString(key))
+		}
+		if tenant != "" && tenant != keyTenant {
+			return nil, fmt.Errorf("%w: %s", ErrTenantMismatch, aws.ToString(key))
+		}
+		tenant = keyTenant
+	}
+
+	if caller, ok := TenantFromContext(ctx); ok && caller != tenant {
+		return nil, fmt.Errorf("%w: caller %s, key tenant %s", ErrTenantMismatch, caller, tenant)
+	}
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	if client, ok := api.clients[tenant]; ok {
+		return client, nil
+	}
+
+	client, err := api.newClient(tenant)
+	if err != nil {
+		return nil, err
+	}
+	api.clients[tenant] = client
+	return client, nil
+}
+
+// PutObject implements s3store.S3API
+func (api *delegatingS3API) PutObject(ctx context.Context, input *s3.PutObjectInput, opts ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	client, err := api.clientFor(ctx, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	return client.PutObject(ctx, input, opts...)
+}
+
+// ListParts implements s3store.S3API
+func (api *delegatingS3API) ListParts(ctx context.Context, input *s3.ListPartsInput, opts ...func(*s3.Options)) (*s3.ListPartsOutput, error) {
+	client, err := api.clientFor(ctx, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	return client.ListParts(ctx, input, opts...)
+}
+
+// UploadPart implements s3store.S3API
+func (api *delegatingS3API) UploadPart(ctx context.Context, input *s3.UploadPartInput, opts ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	client, err := api.clientFor(ctx, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	return client.UploadPart(ctx, input, opts...)
+}
+
+// GetObject implements s3store.S3API
+func (api *delegatingS3API) GetObject(ctx context.Context, input *s3.GetObjectInput, opts ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	client, err := api.clientFor(ctx, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	return client.GetObject(ctx, input, opts...)
+}
+
+// HeadObject implements s3store.S3API
+func (api *delegatingS3API) HeadObject(ctx context.Context, input *s3.HeadObjectInput, opts ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	client, err := api.clientFor(ctx, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	return client.HeadObject(ctx, input, opts...)
+}
+
+// CreateMultipartUpload implements s3store.S3API
+func (api *delegatingS3API) CreateMultipartUpload(ctx context.Context, input *s3.CreateMultipartUploadInput, opts ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	client, err := api.clientFor(ctx, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	return client.CreateMultipartUpload(ctx, input, opts...)
+}
+
+// AbortMultipartUpload implements s3store.S3API
+func (api *delegatingS3API) AbortMultipartUpload(ctx context.Context, input *s3.AbortMultipartUploadInput, opts ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	client, err := api.clientFor(ctx, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	return client.AbortMultipartUpload(ctx, input, opts...)
+}
+
+// DeleteObject implements s3store.S3API
+func (api *delegatingS3API) DeleteObject(ctx context.Context, input *s3.DeleteObjectInput, opts ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	client, err := api.clientFor(ctx, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	return client.DeleteObject(ctx, input, opts...)
+}
+
+// DeleteObjects implements s3store.S3API. All keys must belong to the same
+// tenant.
+func (api *delegatingS3API) DeleteObjects(ctx context.Context, input *s3.DeleteObjectsInput, opts ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	var keys []*string
+	if input.Delete != nil {
+		for _, object := range input.Delete.Objects {
+			keys = append(keys, object.Key)
+		}
+	}
+	if len(keys) == 0 {
+		return &s3.DeleteObjectsOutput{}, nil
+	}
+
+	client, err := api.clientFor(ctx, keys...)
+	if err != nil {
+		return nil, err
+	}
+	return client.DeleteObjects(ctx, input, opts...)
+}
+
+// CompleteMultipartUpload implements s3store.S3API
+func (api *delegatingS3API) CompleteMultipartUpload(ctx context.Context, input *s3.CompleteMultipartUploadInput, opts ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	client, err := api.clientFor(ctx, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	return client.CompleteMultipartUpload(ctx, input, opts...)
+}
+
+// UploadPartCopy implements s3store.S3API
+func (api *delegatingS3API) UploadPartCopy(ctx context.Context, input *s3.UploadPartCopyInput, opts ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error) {
+	client, err := api.clientFor(ctx, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	return client.UploadPartCopy(ctx, input, opts...)
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/tus/tusd/v2/pkg/s3store"
+)
+
+// recordingS3API records which tenant client served a request
+type recordingS3API struct {
+	s3store.S3API
+	tenant string
+	calls  *[]string
+}
+
+func (api recordingS3API) HeadObject(ctx context.Context, input *s3.HeadObjectInput, opts ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	*api.calls = append(*api.calls, api.tenant)
+	return &s3.HeadObjectOutput{}, nil
+}
+
+func (api recordingS3API) DeleteObjects(ctx context.Context, input *s3.DeleteObjectsInput, opts ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	*api.calls = append(*api.calls, api.tenant)
+	return &s3.DeleteObjectsOutput{}, nil
+}
+
+func TestTenantUploadID(t *testing.T) {
+	id, err := NewTenantUploadID("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(id, "acme~") {
+		t.Fatalf("expected tenant prefix, got %q", id)
+	}
+	if tenant, ok := TenantFromKey(id + "+multipart.info"); !ok || tenant != "acme" {
+		t.Fatalf("TenantFromKey = %q, %v", tenant, ok)
+	}
+
+	if _, err := NewTenantUploadID("../other"); err == nil {
+		t.Fatal("expected invalid tenant to be rejected")
+	}
+	if _, ok := TenantFromKey("0123456789abcdef"); ok {
+		t.Fatal("expected key without tenant to have no tenant")
+	}
+}
+
+func TestDelegatingS3API(t *testing.T) {
+	var calls []string
+	created := 0
+	api := newDelegatingS3API(func(tenant string) (s3store.S3API, error) {
+		created++
+		return recordingS3API{tenant: tenant, calls: &calls}, nil
+	})
+
+	ctx := context.Background()
+	for _, key := range []string{"acme~1", "acme~1.info", "globex~2"} {
+		if _, err := api.HeadObject(ctx, &s3.HeadObjectInput{Key: aws.String(key)}); err != nil {
+			t.Fatalf("HeadObject(%s): %v", key, err)
+		}
+	}
+	if strings.Join(calls, ",") != "acme,acme,globex" {
+		t.Fatalf("unexpected routing: %v", calls)
+	}
+	if created != 2 {
+		t.Fatalf("expected one client per tenant, created %d", created)
+	}
+
+	// The caller's tenant must match the key
+	_, err := api.HeadObject(WithTenant(ctx, "acme"), &s3.HeadObjectInput{Key: aws.String("globex~2")})
+	if !errors.Is(err, ErrTenantMismatch) {
+		t.Fatalf("expected tenant mismatch, got %v", err)
+	}
+
+	// Keys outside any tenant are never sent
+	_, err = api.HeadObject(ctx, &s3.HeadObjectInput{Key: aws.String("legacy")})
+	if !errors.Is(err, ErrNoTenant) {
+		t.Fatalf("expected missing tenant, got %v", err)
+	}
+
+	// Batch deletes can't span tenants
+	_, err = api.DeleteObjects(ctx, &s3.DeleteObjectsInput{Delete: &types.Delete{Objects: []types.ObjectIdentifier{
+		{Key: aws.String("acme~1")},
+		{Key: aws.String("globex~2")},
+	}}})
+	if !errors.Is(err, ErrTenantMismatch) {
+		t.Fatalf("expected tenant mismatch for batch delete, got %v", err)
+	}
+}
+
+func TestTenantPolicy(t *testing.T) {
+	policy, err := tenantPolicy("uploads", "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Statement []struct {
+			Resource string
+		}
+	}
+	if err := json.Unmarshal([]byte(policy), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Statement) != 1 || doc.Statement[0].Resource != "arn:aws:s3:::uploads/acme~*" {
+		t.Fatalf("unexpected policy: %s", policy)
+	}
+}
+
+func TestRoleSessionName(t *testing.T) {
+	if name := roleSessionName("acme"); name != "tenant-acme" {
+		t.Fatalf("unexpected session name %q", name)
+	}
+
+	long := strings.Repeat("a", 100)
+	name := roleSessionName(long)
+	if len(name) != maxRoleSessionName || !strings.HasPrefix(name, "tenant-aaa") {
+		t.Fatalf("expected a %d character session name, got %q", maxRoleSessionName, name)
+	}
+	if other := roleSessionName(long + "b"); other == name {
+		t.Fatalf("expected long tenants with the same prefix to get different session names, both got %q", name)
+	}
+}
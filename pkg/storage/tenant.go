@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// TenantSeparator separates the tenant from the random part of upload IDs,
+// so every object of a tenant shares the key prefix "<tenant>~"
+const TenantSeparator = "~"
+
+// tenantPattern restricts tenants to characters that are safe in URLs,
+// object keys and IAM policy resources
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// uploadIDPattern restricts IDs chosen outside the server, such as by a
+// pre-create hook, to characters that keep tenants, object keys and file
+// paths intact
+var uploadIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+// tenantKey is the context key for the tenant of the caller
+type tenantKey struct{}
+
+// TenantScoped is implemented by storage backends that isolate tenants by
+// upload ID prefix and need uploads to be created with NewTenantUploadID
+type TenantScoped interface {
+	TenantScoped() bool
+}
+
+// WithTenant returns a context carrying the tenant of the caller
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant of the caller, if known
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok && tenant != ""
+}
+
+// ValidTenant reports whether a tenant can be used in upload IDs
+func ValidTenant(tenant string) bool {
+	return tenantPattern.MatchString(tenant)
+}
+
+// KeyPrefixSeparator separates a key prefix, such as the one of an intake,
+// from the random part of upload IDs
+const KeyPrefixSeparator = "-"
+
+// NewTenantUploadID returns a random upload ID prefixed with the tenant
+func NewTenantUploadID(tenant string) (string, error) {
+	if !ValidTenant(tenant) {
+		return "", fmt.Errorf("invalid tenant %q: %w", tenant, ErrInvalidConfig)
+	}
+	return NewUploadID(tenant, "")
+}
+
+// NewUploadID returns a random upload ID of the form
+// [<tenant>~][<prefix>-]<random>, so objects can be listed by tenant and
+// key prefix. Both may be empty.
+func NewUploadID(tenant, prefix string) (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("failed to generate upload id: %w", err)
+	}
+	return FormatUploadID(tenant, prefix, hex.EncodeToString(random)), nil
+}
+
+// ValidUploadID reports whether an ID chosen outside the server can be
+// placed under a tenant and key prefix with FormatUploadID
+func ValidUploadID(id string) bool {
+	return uploadIDPattern.MatchString(id)
+}
+
+// FormatUploadID places a generated ID under the tenant and key prefix,
+// which may be empty
+func FormatUploadID(tenant, prefix, id string) string {
+	if prefix != "" {
+		id = prefix + KeyPrefixSeparator + id
+	}
+	if tenant != "" {
+		id = tenant + TenantSeparator + id
+	}
+	return id
+}
+
+// TenantFromKey returns the tenant an upload ID or object key belongs to
+func TenantFromKey(key string) (string, bool) {
+	tenant, _, ok := strings.Cut(key, TenantSeparator)
+	if !ok || !ValidTenant(tenant) {
+		return "", false
+	}
+	return tenant, true
+}
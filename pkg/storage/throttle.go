@@ -0,0 +1,306 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+)
+
+// Kinds of backend throttling
+const (
+	// ThrottleRateLimited means the backend asked to slow down, e.g. S3
+	// SlowDown or Azure ServerBusy
+	ThrottleRateLimited = "rate_limited"
+
+	// ThrottleQuotaExceeded means the account or bucket ran out of space
+	ThrottleQuotaExceeded = "quota_exceeded"
+)
+
+// s3ThrottleCodes maps S3 and MinIO error codes to the kind of throttling
+var s3ThrottleCodes = map[string]string{
+	"SlowDown":                       ThrottleRateLimited,
+	"SlowDownRead":                   ThrottleRateLimited,
+	"SlowDownWrite":                  ThrottleRateLimited,
+	"Throttling":                     ThrottleRateLimited,
+	"ThrottlingException":            ThrottleRateLimited,
+	"RequestLimitExceeded":           ThrottleRateLimited,
+	"RequestThrottled":               ThrottleRateLimited,
+	"TooManyRequests":                ThrottleRateLimited,
+	"ServiceUnavailable":             ThrottleRateLimited,
+	"XMinioServerNotInitialized":     ThrottleRateLimited,
+	"XMinioStorageFull":              ThrottleQuotaExceeded,
+	"XMinioAdminBucketQuotaExceeded": ThrottleQuotaExceeded,
+	"QuotaExceeded":                  ThrottleQuotaExceeded,
+}
+
+// ThrottleError is a backend error caused by throttling or an exhausted
+// quota, which clients should retry later
+type ThrottleError struct {
+	Kind string
+
+	// RetryAfter is the delay the backend asked for, zero if it didn't
+	RetryAfter time.Duration
+
+	Err error
+}
+
+// Error implements the error interface
+func (e *ThrottleError) Error() string {
+	return fmt.Sprintf("storage %s: %v", e.Kind, e.Err)
+}
+
+// Unwrap returns the backend error
+func (e *ThrottleError) Unwrap() error {
+	return e.Err
+}
+
+// ClassifyThrottle returns the throttling described by a backend error, or
+// nil if the error isn't caused by throttling
+func ClassifyThrottle(err error) *ThrottleError {
+	if err == nil {
+		return nil
+	}
+	var throttle *ThrottleError
+	if errors.As(err, &throttle) {
+		return throttle
+	}
+
+	var kind string
+	var header http.Header
+
+	var s3Err *smithyhttp.ResponseError
+	if errors.As(err, &s3Err) {
+		kind = throttleKind(s3Err.HTTPStatusCode())
+		if s3Err.Response != nil {
+			header = s3Err.Response.Header
+		}
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		if codeKind, ok := s3ThrottleCodes[apiErr.ErrorCode()]; ok {
+			kind = codeKind
+		}
+	}
+
+	var azErr *azcore.ResponseError
+	if errors.As(err, &azErr) {
+		kind = throttleKind(azErr.StatusCode)
+		if azErr.RawResponse != nil {
+			header = azErr.RawResponse.Header
+		}
+	}
+
+	if kind == "" {
+		return nil
+	}
+	return &ThrottleError{Kind: kind, RetryAfter: retryAfter(header), Err: err}
+}
+
+// throttleKind classifies an HTTP status code
+func throttleKind(status int) string {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return ThrottleRateLimited
+	case http.StatusInsufficientStorage:
+		return ThrottleQuotaExceeded
+	default:
+		return ""
+	}
+}
+
+// retryAfter parses a Retry-After header given in seconds or as HTTP date
+func retryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
+
+// ThrottleHandler is called with the operation and the throttling of a
+// failed backend call, and returns the error reported to the client instead
+type ThrottleHandler func(op string, throttle *ThrottleError) error
+
+// GuardThrottling returns a composer whose core and extensions pass
+// throttling errors of the backend to the handler. Other errors are
+// returned as they are.
+func GuardThrottling(composer *tusd.StoreComposer, handle ThrottleHandler) *tusd.StoreComposer {
+	guard := throttleGuard(handle)
+	wrapped := *composer
+	wrapped.Core = guardedStore{DataStore: composer.Core, guard: guard}
+
+	if composer.UsesTerminater {
+		wrapped.Terminater = guardedTerminater{composer.Terminater, guard}
+	}
+	if composer.UsesConcater {
+		wrapped.Concater = guardedConcater{composer.Concater, guard}
+	}
+	if composer.UsesLengthDeferrer {
+		wrapped.LengthDeferrer = guardedLengthDeferrer{composer.LengthDeferrer, guard}
+	}
+	if composer.UsesContentServer {
+		wrapped.ContentServer = guardedContentServer{composer.ContentServer, guard}
+	}
+	return &wrapped
+}
+
+// throttleGuard translates throttling errors with a handler
+type throttleGuard ThrottleHandler
+
+// check returns the handler's error for throttling errors, and
+// ErrRestoreRequired for reads of archived objects, which the backends
+// answer with errors that would otherwise reach clients as a bare 500.
+// Other errors are returned unchanged.
+func (g throttleGuard) check(op string, err error) error {
+	if throttle := ClassifyThrottle(err); throttle != nil {
+		return g(op, throttle)
+	}
+	if op == OpRead && IsArchived(err) {
+		return ErrRestoreRequired
+	}
+	return err
+}
+
+// guardedStore guards creating and fetching uploads
+type guardedStore struct {
+	tusd.DataStore
+	guard throttleGuard
+}
+
+func (s guardedStore) NewUpload(ctx context.Context, info tusd.FileInfo) (tusd.Upload, error) {
+	upload, err := s.DataStore.NewUpload(ctx, info)
+	if err != nil {
+		return nil, s.guard.check(OpCreate, err)
+	}
+	return guardedUpload{upload, s.guard}, nil
+}
+
+func (s guardedStore) GetUpload(ctx context.Context, id string) (tusd.Upload, error) {
+	upload, err := s.DataStore.GetUpload(ctx, id)
+	if err != nil {
+		return nil, s.guard.check(OpGet, err)
+	}
+	return guardedUpload{upload, s.guard}, nil
+}
+
+// guardedUpload guards the operations on an upload
+type guardedUpload struct {
+	upload tusd.Upload
+	guard  throttleGuard
+}
+
+func (u guardedUpload) unwrapUpload() tusd.Upload {
+	return u.upload
+}
+
+func (u guardedUpload) WriteChunk(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+	n, err := u.upload.WriteChunk(ctx, offset, src)
+	return n, u.guard.check(OpWrite, err)
+}
+
+func (u guardedUpload) GetInfo(ctx context.Context) (tusd.FileInfo, error) {
+	info, err := u.upload.GetInfo(ctx)
+	return info, u.guard.check(OpInfo, err)
+}
+
+func (u guardedUpload) GetReader(ctx context.Context) (io.ReadCloser, error) {
+	reader, err := u.upload.GetReader(ctx)
+	return reader, u.guard.check(OpRead, err)
+}
+
+func (u guardedUpload) FinishUpload(ctx context.Context) error {
+	return u.guard.check(OpFinish, u.upload.FinishUpload(ctx))
+}
+
+// guardedTerminater guards terminations
+type guardedTerminater struct {
+	tusd.TerminaterDataStore
+	guard throttleGuard
+}
+
+func (t guardedTerminater) AsTerminatableUpload(upload tusd.Upload) tusd.TerminatableUpload {
+	return guardedTermination{t.TerminaterDataStore.AsTerminatableUpload(unwrap(upload)), t.guard}
+}
+
+type guardedTermination struct {
+	upload tusd.TerminatableUpload
+	guard  throttleGuard
+}
+
+func (t guardedTermination) Terminate(ctx context.Context) error {
+	return t.guard.check(OpTerminate, t.upload.Terminate(ctx))
+}
+
+// guardedConcater guards concatenation, which happens when the final upload
+// is created
+type guardedConcater struct {
+	tusd.ConcaterDataStore
+	guard throttleGuard
+}
+
+func (c guardedConcater) AsConcatableUpload(upload tusd.Upload) tusd.ConcatableUpload {
+	return guardedConcatable{unwrappingConcatable{c.ConcaterDataStore.AsConcatableUpload(unwrap(upload))}, c.guard}
+}
+
+type guardedConcatable struct {
+	upload unwrappingConcatable
+	guard  throttleGuard
+}
+
+func (c guardedConcatable) ConcatUploads(ctx context.Context, partials []tusd.Upload) error {
+	return c.guard.check(OpCreate, c.upload.ConcatUploads(ctx, partials))
+}
+
+// guardedLengthDeferrer guards declaring the length, which happens when a
+// chunk is written
+type guardedLengthDeferrer struct {
+	tusd.LengthDeferrerDataStore
+	guard throttleGuard
+}
+
+func (d guardedLengthDeferrer) AsLengthDeclarableUpload(upload tusd.Upload) tusd.LengthDeclarableUpload {
+	return guardedLengthDeclarable{d.LengthDeferrerDataStore.AsLengthDeclarableUpload(unwrap(upload)), d.guard}
+}
+
+type guardedLengthDeclarable struct {
+	upload tusd.LengthDeclarableUpload
+	guard  throttleGuard
+}
+
+func (d guardedLengthDeclarable) DeclareLength(ctx context.Context, length int64) error {
+	return d.guard.check(OpWrite, d.upload.DeclareLength(ctx, length))
+}
+
+// guardedContentServer guards downloads served by the backend itself
+type guardedContentServer struct {
+	tusd.ContentServerDataStore
+	guard throttleGuard
+}
+
+func (s guardedContentServer) AsServableUpload(upload tusd.Upload) tusd.ServableUpload {
+	return guardedServable{s.ContentServerDataStore.AsServableUpload(unwrap(upload)), s.guard}
+}
+
+type guardedServable struct {
+	upload tusd.ServableUpload
+	guard  throttleGuard
+}
+
+func (u guardedServable) ServeContent(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	return u.guard.check(OpRead, u.upload.ServeContent(ctx, w, r))
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+)
+
+// failingStore fails every upload creation with err
+type failingStore struct {
+	tusd.DataStore
+	err error
+}
+
+func (s failingStore) NewUpload(ctx context.Context, info tusd.FileInfo) (tusd.Upload, error) {
+	return nil, s.err
+}
+
+func TestClassifyThrottle(t *testing.T) {
+	header := http.Header{"Retry-After": {"7"}}
+	s3Status := &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusServiceUnavailable, Header: header}},
+		Err:      errors.New("service unavailable"),
+	}
+
+	cases := []struct {
+		err        error
+		kind       string
+		retryAfter time.Duration
+	}{
+		{&smithy.GenericAPIError{Code: "SlowDown"}, ThrottleRateLimited, 0},
+		{&smithy.GenericAPIError{Code: "XMinioStorageFull"}, ThrottleQuotaExceeded, 0},
+		{fmt.Errorf("upload part: %w", s3Status), ThrottleRateLimited, 7 * time.Second},
+		{&azcore.ResponseError{StatusCode: http.StatusServiceUnavailable, ErrorCode: "ServerBusy"}, ThrottleRateLimited, 0},
+		{&azcore.ResponseError{StatusCode: http.StatusInsufficientStorage, RawResponse: &http.Response{Header: header}}, ThrottleQuotaExceeded, 7 * time.Second},
+	}
+	for _, c := range cases {
+		throttle := ClassifyThrottle(c.err)
+		if throttle == nil || throttle.Kind != c.kind || throttle.RetryAfter != c.retryAfter {
+			t.Errorf("ClassifyThrottle(%v) = %+v, want %s after %s", c.err, throttle, c.kind, c.retryAfter)
+		}
+	}
+
+	for _, err := range []error{
+		nil,
+		errors.New("connection reset"),
+		&smithy.GenericAPIError{Code: "NoSuchKey"},
+		&azcore.ResponseError{StatusCode: http.StatusNotFound},
+	} {
+		if throttle := ClassifyThrottle(err); throttle != nil {
+			t.Errorf("ClassifyThrottle(%v) = %+v, want nil", err, throttle)
+		}
+	}
+}
+
+func TestGuardThrottling(t *testing.T) {
+	replaced := errors.New("retry later")
+	var ops []string
+	handle := func(op string, throttle *ThrottleError) error {
+		ops = append(ops, op+" "+throttle.Kind)
+		return replaced
+	}
+
+	composer := tusd.NewStoreComposer()
+	composer.UseCore(failingStore{err: &smithy.GenericAPIError{Code: "SlowDown"}})
+	guarded := GuardThrottling(composer, handle)
+	if _, err := guarded.Core.NewUpload(context.Background(), tusd.FileInfo{}); err != replaced {
+		t.Fatalf("expected the handler's error, got %v", err)
+	}
+
+	other := errors.New("disk on fire")
+	composer.UseCore(failingStore{err: other})
+	guarded = GuardThrottling(composer, handle)
+	if _, err := guarded.Core.NewUpload(context.Background(), tusd.FileInfo{}); err != other {
+		t.Fatalf("expected other errors to pass through, got %v", err)
+	}
+
+	if len(ops) != 1 || ops[0] != "create rate_limited" {
+		t.Fatalf("handler calls = %v", ops)
+	}
+}
+
+func TestRestoreRequired(t *testing.T) {
+	glacier := fmt.Errorf("reading object: %w", &smithy.GenericAPIError{Code: "InvalidObjectState"})
+	archive := &azcore.ResponseError{StatusCode: http.StatusConflict, ErrorCode: "BlobArchived"}
+	for _, err := range []error{glacier, archive} {
+		if !IsArchived(err) {
+			t.Fatalf("expected %v to be archived", err)
+		}
+	}
+	if IsArchived(&smithy.GenericAPIError{Code: "NoSuchKey"}) || IsArchived(errors.New("disk on fire")) {
+		t.Fatal("expected other errors not to be archived")
+	}
+
+	guard := throttleGuard(func(op string, throttle *ThrottleError) error { return throttle })
+	var restore tusd.Error
+	if err := guard.check(OpRead, glacier); !errors.As(err, &restore) || restore.ErrorCode != "ERR_RESTORE_REQUIRED" {
+		t.Fatalf("expected reads of archived objects to require a restore, got %v", err)
+	}
+	if err := guard.check(OpWrite, archive); err != archive {
+		t.Fatalf("expected archived errors of other operations to pass through, got %v", err)
+	}
+}
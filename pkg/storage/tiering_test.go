@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	tusd "github.com/tus/tusd/v2/pkg/handler"
+)
+
+// fakeObjectServer answers S3 and Azure requests for one upload, keeping
+// its info object and the class its data is stored in. Reads of the data
+// fail once it is archived, as they do in S3 Glacier and the Azure Archive
+// tier.
+type fakeObjectServer struct {
+	*httptest.Server
+	mu    sync.Mutex
+	info  []byte
+	class string
+}
+
+func newFakeObjectServer(t *testing.T, id string) *fakeObjectServer {
+	info, err := json.Marshal(tusd.FileInfo{ID: id, Size: 5, Offset: 5, MetaData: tusd.MetaData{"filename": "a.txt"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeObjectServer{info: info}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serve))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *fakeObjectServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	switch {
+	case key == "":
+		// The bucket or container itself
+	case strings.HasSuffix(key, ".info") && r.Method == http.MethodGet:
+		w.Write(s.info)
+	case strings.HasSuffix(key, ".info") && r.Method == http.MethodPut:
+		s.info, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodHead:
+		w.Header().Set("Content-Length", "5")
+		if s.class != "" {
+			w.Header().Set("x-amz-storage-class", s.class)
+		}
+	case r.Header.Get("x-amz-copy-source") != "":
+		s.class = r.Header.Get("x-amz-storage-class")
+		w.Write([]byte(`<CopyObjectResult><ETag>"etag"</ETag></CopyObjectResult>`))
+	case r.URL.Query().Get("comp") == "tier":
+		s.class = r.Header.Get("x-ms-access-tier")
+	case r.Method == http.MethodGet && s.class == "GLACIER":
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`<Error><Code>InvalidObjectState</Code><Message>The operation is not valid for the object's storage class</Message></Error>`))
+	case r.Method == http.MethodGet && s.class == "Archive":
+		w.Header().Set("x-ms-error-code", "BlobArchived")
+		w.WriteHeader(http.StatusConflict)
+	default:
+		w.Write([]byte("hello"))
+	}
+}
+
+// recorded returns the class of the data and the class in the info object
+func (s *fakeObjectServer) recorded(t *testing.T) (string, string) {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var info tusd.FileInfo
+	if err := json.Unmarshal(s.info, &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.MetaData["filename"] != "a.txt" {
+		t.Fatalf("expected the info metadata to be kept, got %v", info.MetaData)
+	}
+	return s.class, info.MetaData[StorageClassMetadataKey]
+}
+
+func TestMinIOTransitionUpload(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeObjectServer(t, "upload")
+	store, err := NewMinIO(ctx, WithEndpoint(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.TransitionUpload(ctx, "upload", "GLACIER"); err != nil {
+		t.Fatal(err)
+	}
+	if class, recorded := server.recorded(t); class != "GLACIER" || recorded != "GLACIER" {
+		t.Fatalf("expected the object and its info in GLACIER, got %q and %q", class, recorded)
+	}
+
+	_, err = store.s3Client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(store.config.Bucket), Key: aws.String("upload")})
+	if !IsArchived(err) {
+		t.Fatalf("expected reads of the moved object to be refused as archived, got %v", err)
+	}
+}
+
+func TestAzureTransitionUpload(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeObjectServer(t, "upload")
+	client, err := container.NewClientWithNoCredential(server.URL+"/uploads", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &AzureStorage{container: client}
+
+	if err := store.TransitionUpload(ctx, "upload", "Archive"); err != nil {
+		t.Fatal(err)
+	}
+	if class, recorded := server.recorded(t); class != "Archive" || recorded != "Archive" {
+		t.Fatalf("expected the blob and its info in Archive, got %q and %q", class, recorded)
+	}
+
+	_, err = client.NewBlobClient("upload").DownloadStream(ctx, nil)
+	if !IsArchived(err) {
+		t.Fatalf("expected reads of the moved blob to be refused as archived, got %v", err)
+	}
+}
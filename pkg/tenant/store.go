@@ -0,0 +1,62 @@
+package tenant
+
+import (
+	"context"
+
+	"github.com/devsnb/large-file-uploads/pkg/internal/jsonstore"
+)
+
+// MemoryStore keeps tenants in memory. They are lost on restart.
+type MemoryStore struct {
+	tenants *jsonstore.Memory[Tenant]
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tenants: jsonstore.NewMemory[Tenant](ErrNotFound)}
+}
+
+// Put inserts or replaces a tenant
+func (s *MemoryStore) Put(ctx context.Context, tenant Tenant) error {
+	s.tenants.Put(tenant.ID, tenant)
+	return nil
+}
+
+// Get returns a tenant by ID
+func (s *MemoryStore) Get(ctx context.Context, id string) (Tenant, error) {
+	return s.tenants.Get(id)
+}
+
+// List returns all tenants
+func (s *MemoryStore) List(ctx context.Context) ([]Tenant, error) {
+	return s.tenants.List(), nil
+}
+
+// FileStore persists each tenant as a JSON file in a directory
+type FileStore struct {
+	tenants *jsonstore.Dir[Tenant]
+}
+
+// NewFileStore creates a file store, creating the directory if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	tenants, err := jsonstore.NewDir[Tenant](dir, "tenant", ErrNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{tenants: tenants}, nil
+}
+
+// Put inserts or replaces a tenant
+func (s *FileStore) Put(ctx context.Context, tenant Tenant) error {
+	return s.tenants.Put(tenant.ID, tenant)
+}
+
+// Get returns a tenant by ID
+func (s *FileStore) Get(ctx context.Context, id string) (Tenant, error) {
+	return s.tenants.Get(id)
+}
+
+// List returns all tenants
+func (s *FileStore) List(ctx context.Context) ([]Tenant, error) {
+	return s.tenants.List()
+}
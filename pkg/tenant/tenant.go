@@ -0,0 +1,177 @@
+// Package tenant manages the tenants uploads are accepted for, with their
+// key prefix, quotas and upload policy, so customers can be onboarded
+// through the API instead of a config deploy
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devsnb/large-file-uploads/pkg/internal/uploadpolicy"
+)
+
+// MaxNameLen limits display names
+const MaxNameLen = 128
+
+// idPattern matches the tenants that can be used in upload IDs and object
+// keys, like storage.ValidTenant
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Common errors returned by tenant operations
+var (
+	ErrNotFound = errors.New("tenant not found")
+	ErrExists   = errors.New("tenant already exists")
+	ErrInvalid  = errors.New("invalid tenant")
+)
+
+// Quotas limit what a tenant may upload. Zero fields don't limit.
+type Quotas struct {
+	MaxUploadSize int64 `json:"maxUploadSize,omitempty"` // bytes per upload
+	MaxIngress    int64 `json:"maxIngress,omitempty"`    // bytes received from the tenant in total
+}
+
+// Tenant is a customer whose users and API keys create uploads
+type Tenant struct {
+	ID           string    `json:"id"` // As in the tenant claim of tokens and in upload IDs
+	Name         string    `json:"name"`
+	Prefix       string    `json:"prefix,omitempty"` // Key prefix of the tenant's uploads
+	Quotas       Quotas    `json:"quotas"`
+	AllowedTypes []string  `json:"allowedTypes,omitempty"` // Empty allows all types
+	Disabled     bool      `json:"disabled,omitempty"`     // No uploads can be created
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// Store persists tenants
+type Store interface {
+	Put(ctx context.Context, tenant Tenant) error
+	Get(ctx context.Context, id string) (Tenant, error)
+	List(ctx context.Context) ([]Tenant, error)
+}
+
+// Registry validates and stores tenants
+type Registry struct {
+	store Store
+	now   func() time.Time
+
+	// mu serializes updates, so concurrent changes aren't lost
+	mu sync.Mutex
+}
+
+// NewRegistry creates a registry backed by the store
+func NewRegistry(store Store) *Registry {
+	return &Registry{store: store, now: time.Now}
+}
+
+// Create validates and stores a new tenant
+func (r *Registry) Create(ctx context.Context, tenant Tenant) (Tenant, error) {
+	if !idPattern.MatchString(tenant.ID) {
+		return Tenant{}, fmt.Errorf("%w: id must match %s", ErrInvalid, idPattern)
+	}
+	if err := normalize(&tenant); err != nil {
+		return Tenant{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.store.Get(ctx, tenant.ID); err == nil {
+		return Tenant{}, ErrExists
+	} else if !errors.Is(err, ErrNotFound) {
+		return Tenant{}, err
+	}
+
+	tenant.CreatedAt = r.now()
+	tenant.UpdatedAt = tenant.CreatedAt
+	if err := r.store.Put(ctx, tenant); err != nil {
+		return Tenant{}, fmt.Errorf("failed to store tenant: %w", err)
+	}
+	return tenant, nil
+}
+
+// Update replaces the settings of a tenant. Whether it is disabled is only
+// changed with SetDisabled.
+func (r *Registry) Update(ctx context.Context, tenant Tenant) (Tenant, error) {
+	if err := normalize(&tenant); err != nil {
+		return Tenant{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, err := r.store.Get(ctx, tenant.ID)
+	if err != nil {
+		return Tenant{}, err
+	}
+	tenant.Disabled = current.Disabled
+	tenant.CreatedAt = current.CreatedAt
+	tenant.UpdatedAt = r.now()
+	if err := r.store.Put(ctx, tenant); err != nil {
+		return Tenant{}, fmt.Errorf("failed to store tenant: %w", err)
+	}
+	return tenant, nil
+}
+
+// SetDisabled disables or re-enables a tenant
+func (r *Registry) SetDisabled(ctx context.Context, id string, disabled bool) (Tenant, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tenant, err := r.store.Get(ctx, id)
+	if err != nil {
+		return Tenant{}, err
+	}
+	if tenant.Disabled == disabled {
+		return tenant, nil
+	}
+	tenant.Disabled = disabled
+	tenant.UpdatedAt = r.now()
+	if err := r.store.Put(ctx, tenant); err != nil {
+		return Tenant{}, fmt.Errorf("failed to store tenant: %w", err)
+	}
+	return tenant, nil
+}
+
+// Get returns a tenant
+func (r *Registry) Get(ctx context.Context, id string) (Tenant, error) {
+	return r.store.Get(ctx, id)
+}
+
+// List returns all tenants ordered by ID
+func (r *Registry) List(ctx context.Context) ([]Tenant, error) {
+	tenants, err := r.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(tenants, func(i, j int) bool {
+		return tenants[i].ID < tenants[j].ID
+	})
+	return tenants, nil
+}
+
+// normalize validates the settings of a tenant and puts them in canonical
+// form
+func normalize(tenant *Tenant) error {
+	tenant.Name = strings.TrimSpace(tenant.Name)
+	if tenant.Name == "" || len(tenant.Name) > MaxNameLen {
+		return fmt.Errorf("%w: name must be 1 to %d characters", ErrInvalid, MaxNameLen)
+	}
+	if tenant.Prefix != "" && !uploadpolicy.ValidPrefix(tenant.Prefix) {
+		return fmt.Errorf("%w: prefix must match %s", ErrInvalid, uploadpolicy.PrefixPattern)
+	}
+	if tenant.Quotas.MaxUploadSize < 0 || tenant.Quotas.MaxIngress < 0 {
+		return fmt.Errorf("%w: quotas must not be negative", ErrInvalid)
+	}
+	types, err := uploadpolicy.NormalizeTypes(tenant.AllowedTypes)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	tenant.AllowedTypes = types
+	return nil
+}
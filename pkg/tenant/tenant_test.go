@@ -0,0 +1,75 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := NewRegistry(store)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	registry.now = func() time.Time { return now }
+
+	created, err := registry.Create(ctx, Tenant{
+		ID:           "acme",
+		Name:         " Acme Corp ",
+		Prefix:       "acme-media",
+		Quotas:       Quotas{MaxUploadSize: 1 << 30},
+		AllowedTypes: []string{"Video/*"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Name != "Acme Corp" || created.AllowedTypes[0] != "video/*" || !created.CreatedAt.Equal(now) {
+		t.Fatalf("unexpected tenant %+v", created)
+	}
+	if _, err := registry.Create(ctx, Tenant{ID: "acme", Name: "Again"}); !errors.Is(err, ErrExists) {
+		t.Fatalf("expected ErrExists, got %v", err)
+	}
+
+	now = now.Add(time.Hour)
+	updated, err := registry.Update(ctx, Tenant{ID: "acme", Name: "Acme", Quotas: Quotas{MaxIngress: 10 << 30}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !updated.CreatedAt.Equal(created.CreatedAt) || !updated.UpdatedAt.Equal(now) || updated.Prefix != "" {
+		t.Fatalf("unexpected update %+v", updated)
+	}
+	if _, err := registry.Update(ctx, Tenant{ID: "globex", Name: "Globex"}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	disabled, err := registry.SetDisabled(ctx, "acme", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := registry.Get(ctx, "acme"); !disabled.Disabled || !got.Disabled {
+		t.Fatalf("expected tenant to be disabled, got %+v", got)
+	}
+
+	invalid := []Tenant{
+		{ID: "", Name: "x"},
+		{ID: "a/b", Name: "x"},
+		{ID: "x", Name: ""},
+		{ID: "x", Name: "x", Prefix: "../etc"},
+		{ID: "x", Name: "x", Quotas: Quotas{MaxUploadSize: -1}},
+		{ID: "x", Name: "x", AllowedTypes: []string{"pdf"}},
+	}
+	for _, tenant := range invalid {
+		if _, err := registry.Create(ctx, tenant); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Create(%+v) error = %v, want ErrInvalid", tenant, err)
+		}
+	}
+
+	tenants, err := registry.List(ctx)
+	if err != nil || len(tenants) != 1 {
+		t.Fatalf("List = %v, %v", tenants, err)
+	}
+}
@@ -0,0 +1,72 @@
+package tiering
+
+import (
+	"context"
+
+	"github.com/devsnb/large-file-uploads/pkg/internal/jsonstore"
+)
+
+// MemoryStore keeps scheduled transitions in memory. They are lost on restart.
+type MemoryStore struct {
+	transitions *jsonstore.Memory[Transition]
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{transitions: jsonstore.NewMemory[Transition](ErrNotFound)}
+}
+
+// Put inserts or replaces a scheduled transition
+func (s *MemoryStore) Put(ctx context.Context, transition Transition) error {
+	s.transitions.Put(transition.UploadID, transition)
+	return nil
+}
+
+// Get returns the scheduled transition of an upload
+func (s *MemoryStore) Get(ctx context.Context, uploadID string) (Transition, error) {
+	return s.transitions.Get(uploadID)
+}
+
+// List returns all scheduled transitions
+func (s *MemoryStore) List(ctx context.Context) ([]Transition, error) {
+	return s.transitions.List(), nil
+}
+
+// Delete removes a scheduled transition
+func (s *MemoryStore) Delete(ctx context.Context, uploadID string) error {
+	return s.transitions.Delete(uploadID)
+}
+
+// FileStore persists each scheduled transition as a JSON file in a directory
+type FileStore struct {
+	transitions *jsonstore.Dir[Transition]
+}
+
+// NewFileStore creates a file store, creating the directory if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	transitions, err := jsonstore.NewDir[Transition](dir, "scheduled transition", ErrNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{transitions: transitions}, nil
+}
+
+// Put inserts or replaces a scheduled transition
+func (s *FileStore) Put(ctx context.Context, transition Transition) error {
+	return s.transitions.Put(transition.UploadID, transition)
+}
+
+// Get returns the scheduled transition of an upload
+func (s *FileStore) Get(ctx context.Context, uploadID string) (Transition, error) {
+	return s.transitions.Get(uploadID)
+}
+
+// List returns all scheduled transitions
+func (s *FileStore) List(ctx context.Context) ([]Transition, error) {
+	return s.transitions.List()
+}
+
+// Delete removes a scheduled transition
+func (s *FileStore) Delete(ctx context.Context, uploadID string) error {
+	return s.transitions.Delete(uploadID)
+}
@@ -0,0 +1,157 @@
+// Package tiering moves completed uploads to cheaper storage classes, such
+// as S3 Glacier or the Azure Archive tier, once they match a rule on their
+// age, size or metadata
+package tiering
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+// ErrNotFound is returned for uploads without a scheduled transition
+var ErrNotFound = errors.New("upload has no scheduled transition")
+
+// Retries of failed transitions back off from the retry delay up to a day,
+// and are given up after MaxAttempts
+const (
+	MaxAttempts = 10
+	maxRetry    = 24 * time.Hour
+)
+
+// Any matches every value of a metadata field, as long as it is set
+const Any = "*"
+
+// Rule moves completed uploads matching it to a storage class once they are
+// old enough
+type Rule struct {
+	Class    string
+	MinAge   time.Duration     // since the upload completed
+	MinSize  int64             // bytes
+	Metadata map[string]string // fields that must have the value, or be set for Any
+}
+
+// Matches reports whether an upload of the size and metadata matches the
+// rule
+func (r Rule) Matches(size int64, metadata map[string]string) bool {
+	if size < r.MinSize {
+		return false
+	}
+	for key, want := range r.Metadata {
+		value, ok := metadata[key]
+		if !ok || (want != Any && value != want) {
+			return false
+		}
+	}
+	return true
+}
+
+// Transition is an upload scheduled to move to a storage class
+type Transition struct {
+	UploadID  string    `json:"uploadId"`
+	Class     string    `json:"class"`
+	DueAt     time.Time `json:"dueAt"`
+	Attempts  int       `json:"attempts,omitempty"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// Store persists scheduled transitions
+type Store interface {
+	Put(ctx context.Context, transition Transition) error
+	Get(ctx context.Context, uploadID string) (Transition, error)
+	List(ctx context.Context) ([]Transition, error)
+	Delete(ctx context.Context, uploadID string) error
+}
+
+// Queue schedules the transitions of completed uploads by the first rule
+// they match
+type Queue struct {
+	store Store
+	rules []Rule
+	retry time.Duration
+	now   func() time.Time
+}
+
+// NewQueue creates a queue applying the rules in order. Failed transitions
+// are retried after the retry delay, doubling with each attempt.
+func NewQueue(store Store, rules []Rule, retry time.Duration) *Queue {
+	return &Queue{
+		store: store,
+		rules: rules,
+		retry: retry,
+		now:   time.Now,
+	}
+}
+
+// Schedule evaluates the rules for a completed upload stored in a class,
+// empty for the provider default. Uploads matching no rule, or already in
+// the class of the matching one, are not scheduled.
+func (q *Queue) Schedule(ctx context.Context, uploadID string, size int64, metadata map[string]string, class string) (Transition, bool, error) {
+	for _, rule := range q.rules {
+		if !rule.Matches(size, metadata) {
+			continue
+		}
+		if rule.Class == class {
+			return Transition{}, false, nil
+		}
+		transition := Transition{
+			UploadID: uploadID,
+			Class:    rule.Class,
+			DueAt:    q.now().Add(rule.MinAge),
+		}
+		return transition, true, q.store.Put(ctx, transition)
+	}
+	return Transition{}, false, nil
+}
+
+// List returns all scheduled transitions, the next one first
+func (q *Queue) List(ctx context.Context) ([]Transition, error) {
+	transitions, err := q.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(transitions, func(i, j int) bool {
+		return transitions[i].DueAt.Before(transitions[j].DueAt)
+	})
+	return transitions, nil
+}
+
+// Due returns the transitions whose time has come
+func (q *Queue) Due(ctx context.Context) ([]Transition, error) {
+	transitions, err := q.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := q.now()
+	for i, t := range transitions {
+		if t.DueAt.After(now) {
+			return transitions[:i], nil
+		}
+	}
+	return transitions, nil
+}
+
+// Done forgets the transition of an upload once it moved or was deleted
+func (q *Queue) Done(ctx context.Context, uploadID string) error {
+	if err := q.store.Delete(ctx, uploadID); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// Failed schedules a retry of a failed transition. After MaxAttempts the
+// transition is forgotten and gaveUp is true.
+func (q *Queue) Failed(ctx context.Context, transition Transition, cause error) (gaveUp bool, err error) {
+	transition.Attempts++
+	if transition.Attempts >= MaxAttempts {
+		return true, q.Done(ctx, transition.UploadID)
+	}
+	delay := maxRetry
+	if shift := transition.Attempts - 1; shift < 20 {
+		delay = min(q.retry<<shift, maxRetry)
+	}
+	transition.DueAt = q.now().Add(delay)
+	transition.LastError = cause.Error()
+	return false, q.store.Put(ctx, transition)
+}
@@ -0,0 +1,79 @@
+package tiering
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := []Rule{
+		{Class: "GLACIER", Metadata: map[string]string{"archive": "true"}},
+		{Class: "STANDARD_IA", MinAge: time.Hour, MinSize: 1 << 20},
+		{Class: "DEEP_ARCHIVE", MinAge: 24 * time.Hour, Metadata: map[string]string{"retention": Any}},
+	}
+	queue := NewQueue(store, rules, time.Minute)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	queue.now = func() time.Time { return now }
+
+	for _, upload := range []struct {
+		id       string
+		size     int64
+		metadata map[string]string
+		class    string
+		want     string
+	}{
+		{"archived", 10, map[string]string{"archive": "true"}, "", "GLACIER"},
+		{"large", 2 << 20, nil, "", "STANDARD_IA"},
+		{"kept", 10, map[string]string{"retention": "7y"}, "", "DEEP_ARCHIVE"},
+		{"small", 10, map[string]string{"archive": "false"}, "", ""},
+		{"already", 2 << 20, nil, "STANDARD_IA", ""},
+	} {
+		transition, scheduled, err := queue.Schedule(ctx, upload.id, upload.size, upload.metadata, upload.class)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if scheduled != (upload.want != "") || transition.Class != upload.want {
+			t.Fatalf("upload %s scheduled %v to %q, want %q", upload.id, scheduled, transition.Class, upload.want)
+		}
+	}
+
+	due, err := queue.Due(ctx)
+	if err != nil || len(due) != 1 || due[0].UploadID != "archived" {
+		t.Fatalf("Due = %v, %v", due, err)
+	}
+	if err := queue.Done(ctx, "archived"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Failed transitions back off, and are given up after MaxAttempts
+	now = now.Add(time.Hour)
+	due, err = queue.Due(ctx)
+	if err != nil || len(due) != 1 || due[0].UploadID != "large" {
+		t.Fatalf("Due = %v, %v", due, err)
+	}
+	transition := due[0]
+	for attempt := 1; attempt < MaxAttempts; attempt++ {
+		gaveUp, err := queue.Failed(ctx, transition, errors.New("slow down"))
+		if err != nil || gaveUp {
+			t.Fatalf("attempt %d: gave up %v, %v", attempt, gaveUp, err)
+		}
+		transitions, _ := queue.List(ctx)
+		transition = transitions[0]
+		if want := now.Add(time.Minute << (attempt - 1)); !transition.DueAt.Equal(want) || transition.Attempts != attempt || transition.LastError != "slow down" {
+			t.Fatalf("attempt %d: unexpected retry %+v, want due at %v", attempt, transition, want)
+		}
+	}
+	if gaveUp, err := queue.Failed(ctx, transition, errors.New("slow down")); err != nil || !gaveUp {
+		t.Fatalf("expected to give up, got %v, %v", gaveUp, err)
+	}
+	if transitions, err := queue.List(ctx); err != nil || len(transitions) != 1 || transitions[0].UploadID != "kept" {
+		t.Fatalf("List = %v, %v", transitions, err)
+	}
+}
@@ -0,0 +1,106 @@
+package traffic
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/devsnb/large-file-uploads/pkg/internal/jsonstore"
+)
+
+// MemoryStore keeps traffic totals in memory. They are lost on restart.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	totals map[Key]Usage
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		totals: make(map[Key]Usage),
+	}
+}
+
+// Add adds counts to the totals of their key
+func (s *MemoryStore) Add(ctx context.Context, usage Usage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total := s.totals[usage.Key]
+	total.add(usage)
+	total.Key = usage.Key
+	s.totals[usage.Key] = total
+	return nil
+}
+
+// List returns the totals of every key
+func (s *MemoryStore) List(ctx context.Context) ([]Usage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	all := make([]Usage, 0, len(s.totals))
+	for _, usage := range s.totals {
+		all = append(all, usage)
+	}
+	return all, nil
+}
+
+// FileStore persists the traffic totals as one JSON file in a directory,
+// which is read once when the store is created and rewritten on every
+// change
+type FileStore struct {
+	path string
+
+	mu     sync.Mutex
+	memory *MemoryStore
+}
+
+// NewFileStore creates a file store, creating the directory if needed and
+// loading the totals written before
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create traffic directory: %w", err)
+	}
+	s := &FileStore{path: filepath.Join(dir, "traffic.json"), memory: NewMemoryStore()}
+
+	var all []Usage
+	if _, err := jsonstore.ReadFile(s.path, &all); err != nil {
+		return nil, fmt.Errorf("failed to read traffic totals: %w", err)
+	}
+	for _, usage := range all {
+		s.memory.totals[usage.Key] = usage
+	}
+	return s, nil
+}
+
+// Add adds counts to the totals of their key
+func (s *FileStore) Add(ctx context.Context, usage Usage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.memory.totals[usage.Key]
+	s.memory.Add(ctx, usage)
+	if err := s.write(ctx); err != nil {
+		if existed {
+			s.memory.totals[usage.Key] = previous
+		} else {
+			delete(s.memory.totals, usage.Key)
+		}
+		return err
+	}
+	return nil
+}
+
+// List returns the totals of every key
+func (s *FileStore) List(ctx context.Context) ([]Usage, error) {
+	return s.memory.List(ctx)
+}
+
+// write replaces the file with the current totals
+func (s *FileStore) write(ctx context.Context) error {
+	all, _ := s.memory.List(ctx)
+	if err := jsonstore.WriteFile(s.path, all); err != nil {
+		return fmt.Errorf("failed to write traffic totals: %w", err)
+	}
+	return nil
+}
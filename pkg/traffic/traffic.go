@@ -0,0 +1,183 @@
+// Package traffic accounts the bytes each tenant and user send to and
+// receive from the server. Counts are collected in memory and added to the
+// store in batches, like download statistics.
+package traffic
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultFlushInterval is how often pending counts are written unless
+// configured
+const DefaultFlushInterval = 30 * time.Second
+
+// Key identifies whose traffic is counted. Requests without a user are
+// counted with an empty user, and requests without a tenant with an empty
+// tenant.
+type Key struct {
+	Tenant string `json:"tenant"`
+	User   string `json:"user"`
+}
+
+// Usage is the traffic of a tenant or user
+type Usage struct {
+	Key
+	Requests int64     `json:"requests"`
+	Ingress  int64     `json:"ingressBytes"` // Request bodies read
+	Egress   int64     `json:"egressBytes"`  // Response bodies written
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// add merges the counts of other into u
+func (u *Usage) add(other Usage) {
+	u.Requests += other.Requests
+	u.Ingress += other.Ingress
+	u.Egress += other.Egress
+	if other.LastSeen.After(u.LastSeen) {
+		u.LastSeen = other.LastSeen
+	}
+}
+
+// Store persists the traffic totals
+type Store interface {
+	// Add adds counts to the totals of their key
+	Add(ctx context.Context, usage Usage) error
+	// List returns the totals of every key
+	List(ctx context.Context) ([]Usage, error)
+}
+
+// Meter collects traffic and adds it to the store periodically
+type Meter struct {
+	store    Store
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[Key]Usage
+}
+
+// NewMeter creates a meter writing batches to the store
+func NewMeter(store Store, interval time.Duration) *Meter {
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+	return &Meter{
+		store:    store,
+		interval: interval,
+		pending:  make(map[Key]Usage),
+	}
+}
+
+// Record counts a request of a tenant and user
+func (m *Meter) Record(key Key, ingress, egress int64, at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usage := m.pending[key]
+	usage.add(Usage{Requests: 1, Ingress: max(ingress, 0), Egress: max(egress, 0), LastSeen: at})
+	usage.Key = key
+	m.pending[key] = usage
+}
+
+// Run flushes pending counts every interval until the context is canceled,
+// then flushes a final time
+func (m *Meter) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.Flush(ctx)
+		case <-ctx.Done():
+			m.Flush(context.Background())
+			return
+		}
+	}
+}
+
+// Flush adds all pending counts to the store in one batch. Counts it fails
+// to write are kept and retried with the next batch.
+func (m *Meter) Flush(ctx context.Context) {
+	m.mu.Lock()
+	batch := m.pending
+	m.pending = make(map[Key]Usage)
+	m.mu.Unlock()
+
+	for key, usage := range batch {
+		if err := m.store.Add(ctx, usage); err != nil {
+			slog.Error("Failed to write traffic counts", "tenant", key.Tenant, "user", key.User, "error", err)
+			m.restore(usage)
+		}
+	}
+}
+
+// restore merges counts that failed to flush back into the pending counts
+func (m *Meter) restore(usage Usage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pending := m.pending[usage.Key]
+	pending.add(usage)
+	pending.Key = usage.Key
+	m.pending[usage.Key] = pending
+}
+
+// Users returns the totals of every user of a tenant, or of all tenants if
+// tenant is empty, including counts not yet written to the store. Users
+// are ordered by tenant, then by the bytes they transferred, most first.
+func (m *Meter) Users(ctx context.Context, tenant string) ([]Usage, error) {
+	stored, err := m.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[Key]Usage, len(stored))
+	for _, usage := range stored {
+		totals[usage.Key] = usage
+	}
+	m.mu.Lock()
+	for key, usage := range m.pending {
+		total := totals[key]
+		total.add(usage)
+		total.Key = key
+		totals[key] = total
+	}
+	m.mu.Unlock()
+
+	users := make([]Usage, 0, len(totals))
+	for _, usage := range totals {
+		if tenant == "" || usage.Tenant == tenant {
+			users = append(users, usage)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].Tenant != users[j].Tenant {
+			return users[i].Tenant < users[j].Tenant
+		}
+		if a, b := users[i].Ingress+users[i].Egress, users[j].Ingress+users[j].Egress; a != b {
+			return a > b
+		}
+		return users[i].User < users[j].User
+	})
+	return users, nil
+}
+
+// Tenants sums the totals of users by tenant, in the order of the users
+func Tenants(users []Usage) []Usage {
+	var tenants []Usage
+	index := make(map[string]int)
+	for _, usage := range users {
+		i, ok := index[usage.Tenant]
+		if !ok {
+			i = len(tenants)
+			index[usage.Tenant] = i
+			tenants = append(tenants, Usage{Key: Key{Tenant: usage.Tenant}})
+		}
+		tenants[i].add(usage)
+	}
+	return tenants
+}
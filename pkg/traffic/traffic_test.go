@@ -0,0 +1,82 @@
+package traffic
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// failingStore fails to add the counts of one tenant
+type failingStore struct {
+	*MemoryStore
+	tenant string
+}
+
+func (s failingStore) Add(ctx context.Context, usage Usage) error {
+	if usage.Tenant == s.tenant {
+		return errors.New("store unavailable")
+	}
+	return s.MemoryStore.Add(ctx, usage)
+}
+
+func TestMeterBatchesTraffic(t *testing.T) {
+	ctx := context.Background()
+	store := failingStore{MemoryStore: NewMemoryStore(), tenant: "globex"}
+	meter := NewMeter(store, time.Hour)
+
+	first := time.Now()
+	alice := Key{Tenant: "acme", User: "alice"}
+	meter.Record(alice, 100, 10, first)
+	meter.Record(alice, 50, -1, first.Add(time.Second))
+	meter.Record(Key{Tenant: "acme", User: "bob"}, 1000, 0, first)
+	meter.Record(Key{Tenant: "globex", User: "carol"}, 5, 5, first)
+
+	// A failed write keeps the counts for the next batch, others are written
+	meter.Flush(ctx)
+	stored, _ := store.List(ctx)
+	if len(stored) != 2 {
+		t.Fatalf("expected 2 stored totals, got %+v", stored)
+	}
+	meter.Record(alice, 1, 1, first.Add(2*time.Second))
+
+	users, err := meter.Users(ctx, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].User != "bob" {
+		t.Fatalf("expected bob first, got %+v", users)
+	}
+	got := users[1]
+	if got.Requests != 3 || got.Ingress != 151 || got.Egress != 11 || !got.LastSeen.Equal(first.Add(2*time.Second)) {
+		t.Fatalf("unexpected totals of alice: %+v", got)
+	}
+
+	all, _ := meter.Users(ctx, "")
+	tenants := Tenants(all)
+	if len(tenants) != 2 || tenants[0].Tenant != "acme" || tenants[0].Ingress != 1151 || tenants[1].Requests != 1 {
+		t.Fatalf("unexpected tenant totals: %+v", tenants)
+	}
+}
+
+func TestFileStoreKeepsTotals(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := Key{Tenant: "acme", User: "alice"}
+	store.Add(ctx, Usage{Key: key, Requests: 1, Ingress: 10, Egress: 20})
+	store.Add(ctx, Usage{Key: key, Requests: 2, Ingress: 5})
+
+	reopened, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, _ := reopened.List(ctx)
+	if len(all) != 1 || all[0].Key != key || all[0].Requests != 3 || all[0].Ingress != 15 || all[0].Egress != 20 {
+		t.Fatalf("unexpected totals after reopening: %+v", all)
+	}
+}
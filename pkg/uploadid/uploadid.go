@@ -0,0 +1,115 @@
+// Package uploadid generates the unique part of upload IDs. Schemes other
+// than Random embed the creation time, so IDs sort by time in listings.
+package uploadid
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Scheme selects how upload IDs are generated
+type Scheme string
+
+const (
+	// Random generates 32 random hex characters, the same format as tusd
+	Random Scheme = "random"
+
+	// UUIDv7 generates time-ordered UUIDs as defined in RFC 9562
+	UUIDv7 Scheme = "uuidv7"
+
+	// ULID generates 26 character, time-ordered ULIDs
+	ULID Scheme = "ulid"
+)
+
+// Schemes are the supported ID schemes
+var Schemes = []Scheme{Random, UUIDv7, ULID}
+
+// Generator creates the unique part of upload IDs. IDs must be unique and
+// only contain characters that are safe in URLs and object keys.
+type Generator interface {
+	NewID() (string, error)
+}
+
+// GeneratorFunc adapts a function to the Generator interface
+type GeneratorFunc func() (string, error)
+
+// NewID calls f
+func (f GeneratorFunc) NewID() (string, error) {
+	return f()
+}
+
+// New returns the generator for a scheme. Empty selects Random.
+func New(scheme Scheme) (Generator, error) {
+	switch Scheme(strings.ToLower(string(scheme))) {
+	case "", Random:
+		return GeneratorFunc(newRandom), nil
+	case UUIDv7:
+		return GeneratorFunc(newUUIDv7), nil
+	case ULID:
+		return GeneratorFunc(newULID), nil
+	default:
+		return nil, fmt.Errorf("unsupported upload ID scheme %q, expected one of %v", scheme, Schemes)
+	}
+}
+
+// newRandom returns 16 random bytes in hex
+func newRandom() (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("failed to generate upload id: %w", err)
+	}
+	return hex.EncodeToString(random), nil
+}
+
+// newUUIDv7 returns a UUIDv7 in its canonical form
+func newUUIDv7() (string, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate upload id: %w", err)
+	}
+	return id.String(), nil
+}
+
+// crockford is the Crockford base32 alphabet used by ULIDs
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID returns a ULID: a 48-bit millisecond timestamp followed by 80
+// random bits, encoded as 26 Crockford base32 characters
+func newULID() (string, error) {
+	return encodeULID(time.Now())
+}
+
+// encodeULID returns a ULID for the given time
+func encodeULID(t time.Time) (string, error) {
+	var id [16]byte
+	ms := uint64(t.UnixMilli())
+	for i := 5; i >= 0; i-- {
+		id[i] = byte(ms)
+		ms >>= 8
+	}
+	if _, err := rand.Read(id[6:]); err != nil {
+		return "", fmt.Errorf("failed to generate upload id: %w", err)
+	}
+	return formatULID(id), nil
+}
+
+// formatULID encodes 128 bits 5 at a time from the end, the first character
+// only holding the top 3 bits
+func formatULID(id [16]byte) string {
+	var out [26]byte
+	for i := len(out) - 1; i >= 0; i-- {
+		bit := (len(out) - 1 - i) * 5
+		index := 15 - bit/8
+		value := uint(id[index]) >> (bit % 8)
+		if bit%8 > 3 && index > 0 {
+			value |= uint(id[index-1]) << (8 - bit%8)
+		}
+		out[i] = crockford[value&31]
+	}
+	return string(out[:])
+}
@@ -0,0 +1,59 @@
+package uploadid
+
+import (
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestSchemes(t *testing.T) {
+	patterns := map[Scheme]*regexp.Regexp{
+		Random: regexp.MustCompile(`^[0-9a-f]{32}$`),
+		UUIDv7: regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+		ULID:   regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`),
+	}
+	for scheme, pattern := range patterns {
+		generator, err := New(scheme)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := generator.NewID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pattern.MatchString(id) {
+			t.Errorf("%s: unexpected id %q", scheme, id)
+		}
+	}
+
+	if _, err := New("snowflake"); err == nil {
+		t.Fatal("expected an unsupported scheme to fail")
+	}
+}
+
+func TestULIDTimestamp(t *testing.T) {
+	// The timestamp example from the ULID specification
+	id, err := encodeULID(time.UnixMilli(1469918176385))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id[:10] != "01ARYZ6S41" {
+		t.Fatalf("timestamp encoded as %q", id[:10])
+	}
+}
+
+func TestTimeOrdered(t *testing.T) {
+	for _, scheme := range []Scheme{UUIDv7, ULID} {
+		generator, _ := New(scheme)
+		var ids []string
+		for i := 0; i < 3; i++ {
+			id, _ := generator.NewID()
+			ids = append(ids, id)
+			time.Sleep(2 * time.Millisecond)
+		}
+		if !sort.StringsAreSorted(ids) {
+			t.Errorf("%s ids do not sort by time: %v", scheme, ids)
+		}
+	}
+}
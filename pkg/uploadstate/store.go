@@ -0,0 +1,62 @@
+package uploadstate
+
+import (
+	"context"
+
+	"github.com/devsnb/large-file-uploads/pkg/internal/jsonstore"
+)
+
+// MemoryStore keeps records in memory. Records are lost on restart.
+type MemoryStore struct {
+	records *jsonstore.Memory[Record]
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: jsonstore.NewMemory[Record](ErrNotFound)}
+}
+
+// Put inserts or replaces a record
+func (s *MemoryStore) Put(ctx context.Context, record Record) error {
+	s.records.Put(record.ID, record)
+	return nil
+}
+
+// Get returns the record of an upload
+func (s *MemoryStore) Get(ctx context.Context, id string) (Record, error) {
+	return s.records.Get(id)
+}
+
+// List returns all records
+func (s *MemoryStore) List(ctx context.Context) ([]Record, error) {
+	return s.records.List(), nil
+}
+
+// FileStore persists each record as a JSON file in a directory
+type FileStore struct {
+	records *jsonstore.Dir[Record]
+}
+
+// NewFileStore creates a file store, creating the directory if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	records, err := jsonstore.NewDir[Record](dir, "upload state", ErrNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{records: records}, nil
+}
+
+// Put inserts or replaces a record
+func (s *FileStore) Put(ctx context.Context, record Record) error {
+	return s.records.Put(record.ID, record)
+}
+
+// Get returns the record of an upload
+func (s *FileStore) Get(ctx context.Context, id string) (Record, error) {
+	return s.records.Get(id)
+}
+
+// List returns all records
+func (s *FileStore) List(ctx context.Context) ([]Record, error) {
+	return s.records.List()
+}
@@ -0,0 +1,293 @@
+// Package uploadstate tracks the lifecycle of each upload as an explicit
+// state machine, so APIs and events report a definite status instead of
+// inferring it from offsets and bucket contents
+package uploadstate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// State is the lifecycle state of an upload
+type State string
+
+const (
+	// Created uploads exist but have not received any data yet
+	Created State = "created"
+	// Uploading uploads are receiving data
+	Uploading State = "uploading"
+	// Uploaded uploads have received all bytes and await processing
+	Uploaded State = "uploaded"
+	// Processing uploads are being post-processed, e.g. scanned or transcoded
+	Processing State = "processing"
+	// Ready uploads are available to consumers
+	Ready State = "ready"
+	// Failed uploads could not be processed
+	Failed State = "failed"
+	// Quarantined uploads were withheld, e.g. by a malware scan
+	Quarantined State = "quarantined"
+	// PendingReview uploads wait for an approver before they become ready
+	PendingReview State = "pending_review"
+	// Rejected uploads were turned down by an approver
+	Rejected State = "rejected"
+	// Deleted uploads have been terminated
+	Deleted State = "deleted"
+)
+
+// maxHistory bounds the number of transitions kept per upload
+const maxHistory = 20
+
+// MaxAnnotationSize bounds the encoded size of a single annotation
+const MaxAnnotationSize = 16 << 10
+
+// annotationKeyPattern restricts annotation keys, which name the processor
+// or kind of result, e.g. "antivirus" or "image"
+var annotationKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_.-]{0,63}$`)
+
+// Errors returned by the state machine
+var (
+	ErrNotFound          = errors.New("upload state not found")
+	ErrInvalidTransition = errors.New("invalid state transition")
+	ErrUnknownState      = errors.New("unknown state")
+	ErrInvalidAnnotation = errors.New("invalid annotation")
+)
+
+// transitions lists the states each state may move to. The empty state is
+// the start for uploads without a record yet.
+var transitions = map[State][]State{
+	"":            {Created, Uploading, Uploaded},
+	Created:       {Uploading, Uploaded, Failed, Deleted},
+	Uploading:     {Uploaded, Failed, Deleted},
+	Uploaded:      {Processing, Ready, PendingReview, Failed, Quarantined, Deleted},
+	Processing:    {Ready, PendingReview, Failed, Quarantined, Deleted},
+	Ready:         {Quarantined, Deleted},
+	Failed:        {Processing, Deleted},
+	Quarantined:   {Ready, PendingReview, Deleted},
+	PendingReview: {Ready, Rejected, Quarantined, Deleted},
+	Rejected:      {PendingReview, Deleted},
+	Deleted:       {},
+}
+
+// Valid reports whether the state is known
+func (s State) Valid() bool {
+	_, ok := transitions[s]
+	return ok && s != ""
+}
+
+// CanTransition reports whether an upload may move from one state to another
+func CanTransition(from, to State) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition is a recorded state change
+type Transition struct {
+	From   State     `json:"from,omitempty"`
+	To     State     `json:"to"`
+	Reason string    `json:"reason,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// Record is the current state of an upload and how it got there
+type Record struct {
+	ID        string       `json:"id"`
+	State     State        `json:"state"`
+	Reason    string       `json:"reason,omitempty"`
+	CreatedAt time.Time    `json:"createdAt"`
+	UpdatedAt time.Time    `json:"updatedAt"`
+	History   []Transition `json:"history"`
+
+	// Offset is the last offset received while the upload was incomplete,
+	// and ProgressAt when it last changed
+	Offset     int64     `json:"offset,omitempty"`
+	ProgressAt time.Time `json:"progressAt,omitzero"`
+
+	// Annotations are structured results post-processors attached to the
+	// upload, such as a scan verdict or image dimensions, by key
+	Annotations map[string]json.RawMessage `json:"annotations,omitempty"`
+}
+
+// Store persists upload state records
+type Store interface {
+	Put(ctx context.Context, record Record) error
+	Get(ctx context.Context, id string) (Record, error)
+	List(ctx context.Context) ([]Record, error)
+}
+
+// Machine applies validated transitions to records in a store
+type Machine struct {
+	store Store
+	mu    sync.Mutex
+	now   func() time.Time
+}
+
+// NewMachine creates a state machine persisting to the store
+func NewMachine(store Store) *Machine {
+	return &Machine{
+		store: store,
+		now:   time.Now,
+	}
+}
+
+// Get returns the state record of an upload
+func (m *Machine) Get(ctx context.Context, id string) (Record, error) {
+	return m.store.Get(ctx, id)
+}
+
+// List returns the records of all uploads, including deleted ones
+func (m *Machine) List(ctx context.Context) ([]Record, error) {
+	return m.store.List(ctx)
+}
+
+// Transition moves an upload to a new state and returns the updated record
+// along with the previous state
+func (m *Machine) Transition(ctx context.Context, id string, to State, reason string) (Record, State, error) {
+	return m.transition(ctx, id, nil, to, reason)
+}
+
+// TransitionFrom moves an upload to a new state like Transition, but only
+// if it is in the given state
+func (m *Machine) TransitionFrom(ctx context.Context, id string, from, to State, reason string) (Record, State, error) {
+	return m.transition(ctx, id, &from, to, reason)
+}
+
+// transition applies a state change, checking the current state against
+// expected if set
+func (m *Machine) transition(ctx context.Context, id string, expected *State, to State, reason string) (Record, State, error) {
+	if !to.Valid() {
+		return Record{}, "", fmt.Errorf("%w: %s", ErrUnknownState, to)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, err := m.store.Get(ctx, id)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return Record{}, "", err
+	}
+
+	from := record.State
+	if expected != nil && from != *expected {
+		return record, from, fmt.Errorf("%w: %s is not %s", ErrInvalidTransition, displayState(from), displayState(*expected))
+	}
+	if !CanTransition(from, to) {
+		return record, from, fmt.Errorf("%w: %s to %s", ErrInvalidTransition, displayState(from), to)
+	}
+
+	now := m.now()
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = now
+	}
+	record.ID = id
+	record.State = to
+	record.Reason = reason
+	record.UpdatedAt = now
+	record.History = append(record.History, Transition{From: from, To: to, Reason: reason, At: now})
+	if len(record.History) > maxHistory {
+		record.History = record.History[len(record.History)-maxHistory:]
+	}
+
+	if err := m.store.Put(ctx, record); err != nil {
+		return Record{}, from, fmt.Errorf("failed to store upload state: %w", err)
+	}
+	return record, from, nil
+}
+
+// Annotate attaches a JSON value to the record of an upload under the key,
+// replacing an earlier value. A null value removes the annotation. The state
+// of the upload is left unchanged.
+func (m *Machine) Annotate(ctx context.Context, id, key string, value json.RawMessage) (Record, error) {
+	if !annotationKeyPattern.MatchString(key) {
+		return Record{}, fmt.Errorf("%w: key must match %s", ErrInvalidAnnotation, annotationKeyPattern)
+	}
+	if len(value) > MaxAnnotationSize {
+		return Record{}, fmt.Errorf("%w: value exceeds %d bytes", ErrInvalidAnnotation, MaxAnnotationSize)
+	}
+	if !json.Valid(value) {
+		return Record{}, fmt.Errorf("%w: value is not valid JSON", ErrInvalidAnnotation)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, err := m.store.Get(ctx, id)
+	if err != nil {
+		return Record{}, err
+	}
+
+	// Records handed out earlier must not change underneath their readers
+	record.Annotations = maps.Clone(record.Annotations)
+	if bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+		delete(record.Annotations, key)
+	} else {
+		if record.Annotations == nil {
+			record.Annotations = make(map[string]json.RawMessage)
+		}
+		record.Annotations[key] = bytes.Clone(value)
+	}
+
+	if err := m.store.Put(ctx, record); err != nil {
+		return Record{}, fmt.Errorf("failed to store upload annotation: %w", err)
+	}
+	return record, nil
+}
+
+// Progress records the offset an incomplete upload received, noting the
+// time if it changed. Records of uploads in other states are left unchanged.
+func (m *Machine) Progress(ctx context.Context, id string, offset int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, err := m.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !record.State.Incomplete() || (offset == record.Offset && !record.ProgressAt.IsZero()) {
+		return nil
+	}
+	record.Offset = offset
+	record.ProgressAt = m.now()
+	if err := m.store.Put(ctx, record); err != nil {
+		return fmt.Errorf("failed to store upload progress: %w", err)
+	}
+	return nil
+}
+
+// LastProgress returns when an upload last received data, or when it was
+// created if it received none
+func (r Record) LastProgress() time.Time {
+	if r.ProgressAt.IsZero() {
+		return r.CreatedAt
+	}
+	return r.ProgressAt
+}
+
+// Incomplete reports whether an upload in the state is still receiving data
+func (s State) Incomplete() bool {
+	return s == Created || s == Uploading
+}
+
+// InReview reports whether an upload in the state is withheld from
+// consumers by the review workflow
+func (s State) InReview() bool {
+	return s == PendingReview || s == Rejected
+}
+
+// displayState names the empty start state in error messages
+func displayState(s State) string {
+	if s == "" {
+		return "none"
+	}
+	return string(s)
+}
@@ -0,0 +1,166 @@
+package uploadstate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMachineTransitions(t *testing.T) {
+	ctx := context.Background()
+	machine := NewMachine(NewMemoryStore())
+
+	for _, state := range []State{Created, Uploading, Uploaded, Processing, Ready} {
+		if _, _, err := machine.Transition(ctx, "a", state, ""); err != nil {
+			t.Fatalf("transition to %s: %v", state, err)
+		}
+	}
+
+	record, from, err := machine.Transition(ctx, "a", Quarantined, "malware found")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from != Ready || record.State != Quarantined || record.Reason != "malware found" {
+		t.Fatalf("unexpected record: from %s, %+v", from, record)
+	}
+	if len(record.History) != 6 || record.History[0].From != "" || record.History[0].To != Created {
+		t.Fatalf("unexpected history: %+v", record.History)
+	}
+
+	// Stale progress after completion is rejected and leaves the record alone
+	if _, _, err := machine.Transition(ctx, "a", Uploading, ""); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("expected invalid transition, got %v", err)
+	}
+	if _, _, err := machine.Transition(ctx, "a", "unknown", ""); !errors.Is(err, ErrUnknownState) {
+		t.Fatalf("expected unknown state, got %v", err)
+	}
+
+	if _, _, err := machine.Transition(ctx, "a", Deleted, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := machine.Transition(ctx, "a", Ready, ""); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("expected deleted to be terminal, got %v", err)
+	}
+}
+
+func TestReviewTransitions(t *testing.T) {
+	ctx := context.Background()
+	machine := NewMachine(NewMemoryStore())
+
+	for _, state := range []State{Uploaded, Processing, PendingReview, Rejected, PendingReview, Ready} {
+		if _, _, err := machine.Transition(ctx, "a", state, ""); err != nil {
+			t.Fatalf("transition to %s: %v", state, err)
+		}
+	}
+	if _, _, err := machine.Transition(ctx, "a", Rejected, ""); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("expected ready uploads to skip review, got %v", err)
+	}
+	if _, _, err := machine.TransitionFrom(ctx, "a", PendingReview, Quarantined, ""); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("expected transition from another state to fail, got %v", err)
+	}
+	if !PendingReview.InReview() || !Rejected.InReview() || Ready.InReview() {
+		t.Fatal("unexpected review states")
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	machine := NewMachine(store)
+	if _, _, err := machine.Transition(ctx, "../escape", Uploaded, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := store.Get(ctx, "../escape")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.State != Uploaded || len(record.History) != 1 || record.CreatedAt.IsZero() {
+		t.Fatalf("unexpected record: %+v", record)
+	}
+
+	records, err := store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].ID != "../escape" {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	ctx := context.Background()
+	machine := NewMachine(NewMemoryStore())
+
+	if _, err := machine.Annotate(ctx, "a", "mime", []byte(`"image/png"`)); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected unknown uploads not to be annotated, got %v", err)
+	}
+
+	machine.Transition(ctx, "a", Uploaded, "")
+	before, _ := machine.Annotate(ctx, "a", "image", []byte(`{"width":640,"height":480}`))
+	record, err := machine.Annotate(ctx, "a", "mime", []byte(`"image/png"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.State != Uploaded || len(record.Annotations) != 2 || string(record.Annotations["mime"]) != `"image/png"` {
+		t.Fatalf("unexpected record: %+v", record)
+	}
+	if len(before.Annotations) != 1 {
+		t.Fatalf("expected earlier records to be unchanged, got %+v", before.Annotations)
+	}
+
+	record, _ = machine.Annotate(ctx, "a", "mime", []byte("null"))
+	if _, ok := record.Annotations["mime"]; ok {
+		t.Fatalf("expected null to remove the annotation, got %+v", record.Annotations)
+	}
+
+	for key, value := range map[string]string{"Bad Key": `1`, "ok": `{not json`} {
+		if _, err := machine.Annotate(ctx, "a", key, []byte(value)); !errors.Is(err, ErrInvalidAnnotation) {
+			t.Errorf("expected %s=%s to be invalid, got %v", key, value, err)
+		}
+	}
+}
+
+func TestProgress(t *testing.T) {
+	ctx := context.Background()
+	machine := NewMachine(NewMemoryStore())
+	now := time.Now()
+	machine.now = func() time.Time { return now }
+
+	machine.Transition(ctx, "a", Created, "")
+	if record, _ := machine.Get(ctx, "a"); record.LastProgress() != now {
+		t.Fatalf("expected uploads without data to count from their creation, got %v", record.LastProgress())
+	}
+	machine.Transition(ctx, "a", Uploading, "")
+	if err := machine.Progress(ctx, "a", 10); err != nil {
+		t.Fatal(err)
+	}
+
+	// Writes that don't move the offset, such as annotations, are no progress
+	now = now.Add(time.Hour)
+	machine.Annotate(ctx, "a", "note", []byte(`"x"`))
+	machine.Progress(ctx, "a", 10)
+	record, _ := machine.Get(ctx, "a")
+	if record.Offset != 10 || record.LastProgress() != now.Add(-time.Hour) {
+		t.Fatalf("expected the progress of offset 10 an hour ago, got %d at %v", record.Offset, record.ProgressAt)
+	}
+	machine.Progress(ctx, "a", 20)
+	if record, _ := machine.Get(ctx, "a"); record.Offset != 20 || record.ProgressAt != now {
+		t.Fatalf("expected new data to be progress, got %d at %v", record.Offset, record.ProgressAt)
+	}
+
+	machine.Transition(ctx, "a", Uploaded, "")
+	machine.Progress(ctx, "a", 30)
+	if record, _ := machine.Get(ctx, "a"); record.Offset != 20 {
+		t.Fatalf("expected finished uploads to be left unchanged, got offset %d", record.Offset)
+	}
+}
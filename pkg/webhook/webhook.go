@@ -0,0 +1,111 @@
+// Package webhook delivers JSON payloads to HTTP endpoints with retries
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ErrDeliveryFailed is returned when a payload could not be delivered
+var ErrDeliveryFailed = errors.New("webhook delivery failed")
+
+// SignatureHeader carries the detached signature of the body when the
+// client signs its payloads
+const SignatureHeader = "X-JWS-Signature"
+
+// SignFunc returns the signature of a request body
+type SignFunc func(body []byte) (string, error)
+
+// Client posts JSON payloads to webhook endpoints
+type Client struct {
+	httpClient *http.Client
+	maxRetries int
+	backoff    time.Duration
+	sign       SignFunc
+}
+
+// NewClient creates a webhook client with the given per-request timeout and
+// number of retries after the first failed attempt
+func NewClient(timeout time.Duration, maxRetries int) *Client {
+	if maxRetries < 0 {
+		maxRetries = 0
+	}
+
+	return &Client{
+		httpClient: &http.Client{Timeout: timeout},
+		maxRetries: maxRetries,
+		backoff:    time.Second,
+	}
+}
+
+// UseSigner signs every body the client posts, sending the signature in
+// SignatureHeader
+func (c *Client) UseSigner(sign SignFunc) {
+	c.sign = sign
+}
+
+// Post marshals the payload as JSON and posts it to the URL, retrying with
+// exponential backoff on network errors and non-2xx responses
+func (c *Client) Post(ctx context.Context, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	var signature string
+	if c.sign != nil {
+		if signature, err = c.sign(body); err != nil {
+			return fmt.Errorf("failed to sign webhook payload: %w", err)
+		}
+	}
+
+	var lastErr error
+	backoff := c.backoff
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%w: %w", ErrDeliveryFailed, ctx.Err())
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		if lastErr = c.send(ctx, url, body, signature); lastErr == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w after %d attempts: %w", ErrDeliveryFailed, c.maxRetries+1, lastErr)
+}
+
+// send performs a single delivery attempt
+func (c *Client) send(ctx context.Context, url string, body []byte, signature string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if signature != "" {
+		req.Header.Set(SignatureHeader, signature)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// Images the suite runs against. They are pinned so a registry update
+// doesn't change what a release was tested with.
+const (
+	minioImage   = "minio/minio:RELEASE.2025-04-22T22-12-26Z"
+	azuriteImage = "mcr.microsoft.com/azure-storage/azurite:3.34.0"
+)
+
+// Well-known Azurite development account
+const (
+	azuriteAccount = "devstoreaccount1"
+	azuriteKey     = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+)
+
+// startMinIO starts a MinIO container and points the storage factory at it
+func startMinIO(t *testing.T) {
+	t.Helper()
+	endpoint := startContainer(t, testcontainers.ContainerRequest{
+		Image:        minioImage,
+		Cmd:          []string{"server", "/data"},
+		ExposedPorts: []string{"9000/tcp"},
+		Env: map[string]string{
+			"MINIO_ROOT_USER":     "minioadmin",
+			"MINIO_ROOT_PASSWORD": "minioadmin",
+		},
+		WaitingFor: wait.ForHTTP("/minio/health/live").WithPort("9000/tcp"),
+	}, "9000/tcp", "")
+
+	t.Setenv("STORAGE_TYPE", "minio")
+	t.Setenv("MINIO_ENDPOINT", endpoint)
+	t.Setenv("MINIO_BUCKET", "uploads")
+	t.Setenv("MINIO_ACCESS_KEY", "minioadmin")
+	t.Setenv("MINIO_SECRET_KEY", "minioadmin")
+	t.Setenv("MINIO_USE_SSL", "false")
+}
+
+// startAzurite starts an Azurite blob service and points the storage
+// factory at it
+func startAzurite(t *testing.T) {
+	t.Helper()
+	endpoint := startContainer(t, testcontainers.ContainerRequest{
+		Image:        azuriteImage,
+		Cmd:          []string{"azurite-blob", "--blobHost", "0.0.0.0", "--loose", "--skipApiVersionCheck"},
+		ExposedPorts: []string{"10000/tcp"},
+		WaitingFor:   wait.ForListeningPort("10000/tcp"),
+	}, "10000/tcp", "http")
+
+	t.Setenv("STORAGE_TYPE", "azure")
+	t.Setenv("AZURE_STORAGE_ACCOUNT", azuriteAccount)
+	t.Setenv("AZURE_STORAGE_KEY", azuriteKey)
+	t.Setenv("AZURE_STORAGE_CONTAINER", "uploads")
+	t.Setenv("AZURE_STORAGE_ENDPOINT", endpoint+"/"+azuriteAccount)
+}
+
+// startContainer starts a container, removes it when the test ends and
+// returns the endpoint of the given port. Tests are skipped when no
+// container runtime is available.
+func startContainer(t *testing.T, req testcontainers.ContainerRequest, port nat.Port, proto string) string {
+	t.Helper()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+
+	ctx := context.Background()
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	testcontainers.CleanupContainer(t, container)
+	if err != nil {
+		t.Fatalf("Failed to start %s: %v", req.Image, err)
+	}
+
+	endpoint, err := container.PortEndpoint(ctx, port, proto)
+	if err != nil {
+		t.Fatalf("Failed to get endpoint of %s: %v", req.Image, err)
+	}
+	return endpoint
+}
@@ -0,0 +1,208 @@
+//go:build integration
+
+// Package integration runs tus upload flows against real storage backends
+// started in containers, through the same factory wiring as the server
+// binary. It only runs with the 'integration' build tag and a container
+// runtime:
+//
+//	go test -tags=integration ./test/integration
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/devsnb/large-file-uploads/pkg/config"
+	"github.com/devsnb/large-file-uploads/pkg/server"
+	"github.com/devsnb/large-file-uploads/pkg/storage"
+)
+
+// uploadSize spans more than one S3 part, so multipart uploads and
+// incomplete parts are exercised
+const uploadSize = 7 << 20
+
+func TestMinIO(t *testing.T) {
+	startMinIO(t)
+	runFlows(t)
+}
+
+func TestAzurite(t *testing.T) {
+	startAzurite(t)
+	runFlows(t)
+}
+
+// runFlows runs the upload flows against the backend configured in the
+// environment
+func runFlows(t *testing.T) {
+	store, err := storage.NewFactory().CreateFromEnv(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	cfg := config.Defaults()
+	cfg.App.Environment = "test"
+	srv, err := server.New(cfg, store)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	ts := httptest.NewServer(srv.Router())
+	t.Cleanup(ts.Close)
+	c := &tusClient{t: t, base: ts.URL + server.DefaultBasePath}
+
+	t.Run("upload", func(t *testing.T) {
+		c.t = t
+		data := randomData(t, uploadSize)
+		location := c.create(int64(len(data)))
+
+		if offset := c.patch(location, 0, data); offset != int64(len(data)) {
+			t.Fatalf("offset after upload = %d, want %d", offset, len(data))
+		}
+		if got := c.download(location); !bytes.Equal(got, data) {
+			t.Fatalf("downloaded %d bytes that differ from the %d uploaded", len(got), len(data))
+		}
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		c.t = t
+		data := randomData(t, uploadSize)
+		location := c.create(int64(len(data)))
+
+		// Upload a first chunk, then continue from the offset the server
+		// reports, as a client does after a dropped connection
+		first := int64(3 << 20)
+		c.patch(location, 0, data[:first])
+		offset := c.offset(location)
+		if offset != first {
+			t.Fatalf("offset after first chunk = %d, want %d", offset, first)
+		}
+		if end := c.patch(location, offset, data[offset:]); end != int64(len(data)) {
+			t.Fatalf("offset after resume = %d, want %d", end, len(data))
+		}
+		if got := c.download(location); !bytes.Equal(got, data) {
+			t.Fatal("resumed upload differs from the uploaded data")
+		}
+	})
+
+	t.Run("terminate", func(t *testing.T) {
+		c.t = t
+		data := randomData(t, uploadSize)
+		location := c.create(int64(len(data)))
+		c.patch(location, 0, data[:1<<20])
+
+		resp := c.do(http.MethodDelete, location, nil, nil)
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("DELETE status = %d, want %d", resp.StatusCode, http.StatusNoContent)
+		}
+		resp = c.do(http.MethodHead, location, nil, nil)
+		if resp.StatusCode != http.StatusNotFound && resp.StatusCode != http.StatusGone {
+			t.Fatalf("HEAD after termination status = %d, want 404 or 410", resp.StatusCode)
+		}
+	})
+}
+
+// tusClient speaks the parts of the tus protocol the flows need
+type tusClient struct {
+	t    *testing.T
+	base string
+}
+
+// create creates an upload and returns its URL
+func (c *tusClient) create(size int64) string {
+	resp := c.do(http.MethodPost, c.base, map[string]string{
+		"Upload-Length":   strconv.FormatInt(size, 10),
+		"Upload-Metadata": "filename dGVzdC5iaW4=,filetype YXBwbGljYXRpb24vb2N0ZXQtc3RyZWFt",
+	}, nil)
+	if resp.StatusCode != http.StatusCreated {
+		c.t.Fatalf("POST status = %d, want %d", resp.StatusCode, http.StatusCreated)
+	}
+	return resp.Header.Get("Location")
+}
+
+// patch uploads a chunk and returns the new offset
+func (c *tusClient) patch(location string, offset int64, chunk []byte) int64 {
+	resp := c.do(http.MethodPatch, location, map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": strconv.FormatInt(offset, 10),
+	}, chunk)
+	if resp.StatusCode != http.StatusNoContent {
+		c.t.Fatalf("PATCH status = %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+	return c.parseOffset(resp)
+}
+
+// offset returns the offset the server has committed
+func (c *tusClient) offset(location string) int64 {
+	resp := c.do(http.MethodHead, location, nil, nil)
+	if resp.StatusCode != http.StatusOK {
+		c.t.Fatalf("HEAD status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	return c.parseOffset(resp)
+}
+
+// download returns the content of a completed upload
+func (c *tusClient) download(location string) []byte {
+	req, err := http.NewRequest(http.MethodGet, location, nil)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		c.t.Fatalf("GET status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatalf("Failed to read download: %v", err)
+	}
+	return data
+}
+
+// do sends a tus request and returns the response with its body drained
+func (c *tusClient) do(method, url string, headers map[string]string, body []byte) *http.Response {
+	c.t.Helper()
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s failed: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	if msg, _ := io.ReadAll(resp.Body); resp.StatusCode >= http.StatusBadRequest {
+		c.t.Logf("%s %s: %d %s", method, url, resp.StatusCode, msg)
+	}
+	return resp
+}
+
+// parseOffset returns the Upload-Offset header of a response
+func (c *tusClient) parseOffset(resp *http.Response) int64 {
+	offset, err := strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		c.t.Fatalf("invalid Upload-Offset %q", resp.Header.Get("Upload-Offset"))
+	}
+	return offset
+}
+
+// randomData returns n random bytes
+func randomData(t *testing.T, n int) []byte {
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}